@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// accessLogEntry describes one request; it is what every format renders
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Method     string    `json:"method"`
+	URI        string    `json:"uri"`   // Path and (redacted) query string
+	Route      string    `json:"route"` // ServeMux pattern, e.g. "GET /api/users/{id}"
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	Duration   string    `json:"duration"`
+	DurationMS float64   `json:"durationMs"`
+	RequestID  string    `json:"requestId,omitempty"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+	Referer    string    `json:"referer,omitempty"`
+}
+
+// accessLogger writes one line per request in the configured format
+type accessLogger struct {
+	out    *log.Logger
+	format string
+	tmpl   *template.Template
+
+	redactAll bool
+	redact    map[string]bool
+	sample    map[string]float64
+
+	level *logLevel // At warn, only failed requests are logged
+}
+
+// newAccessLogger parses the ACCESS_LOG_* settings
+// It returns nil when access logging is off
+func newAccessLogger(cfg LoggingConfig, level *logLevel) (*accessLogger, error) {
+	l := &accessLogger{
+		// Stdout without the log package's own timestamp; every format carries one
+		out:    log.New(os.Stdout, "", 0),
+		level:  level,
+		format: cfg.AccessLogFormat,
+		redact: map[string]bool{},
+		sample: map[string]float64{},
+	}
+
+	switch l.format {
+	case "off":
+		return nil, nil
+	case "common", "json":
+	case "template":
+		tmpl, err := template.New("access").Parse(cfg.AccessLogTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ACCESS_LOG_TEMPLATE: %w", err)
+		}
+		l.tmpl = tmpl
+	default:
+		return nil, fmt.Errorf("unknown ACCESS_LOG_FORMAT %q (want common, json, template, or off)", l.format)
+	}
+
+	for _, name := range strings.Split(cfg.AccessLogRedact, ",") {
+		if name = strings.TrimSpace(name); name == "*" {
+			l.redactAll = true
+		} else if name != "" {
+			l.redact[name] = true
+		}
+	}
+
+	for _, pair := range strings.Split(cfg.AccessLogSampleRates, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		route, value, ok := strings.Cut(pair, "=")
+		rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if !ok || err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid ACCESS_LOG_SAMPLE entry %q (want route=rate, rate between 0 and 1)", pair)
+		}
+		l.sample[strings.TrimSpace(route)] = rate
+	}
+	return l, nil
+}
+
+// middleware logs every request handled by next, after its response is written
+// mux is used to look up the route pattern for sampling and the Route field
+func (l *accessLogger) middleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		// At LOG_LEVEL=warn only failed requests are logged
+		if l.level.get() >= levelWarn && sw.status < http.StatusBadRequest {
+			return
+		}
+		_, route := mux.Handler(r)
+		if !l.sampled(route, r.URL.Path) {
+			return
+		}
+
+		elapsed := time.Since(start)
+		l.write(accessLogEntry{
+			Time:       start,
+			RemoteAddr: remoteHost(r),
+			Method:     r.Method,
+			URI:        l.requestURI(r.URL),
+			Route:      route,
+			Proto:      r.Proto,
+			Status:     sw.status,
+			Bytes:      sw.bytes,
+			Duration:   elapsed.String(),
+			DurationMS: float64(elapsed.Microseconds()) / 1000,
+			RequestID:  w.Header().Get(requestIDHeader),
+			UserAgent:  r.UserAgent(),
+			Referer:    r.Referer(),
+		})
+	})
+}
+
+// sampled decides whether a request is logged, by its route pattern or else its path
+func (l *accessLogger) sampled(route, path string) bool {
+	rate, ok := l.sample[route]
+	if !ok {
+		rate, ok = l.sample[path]
+	}
+	return !ok || rand.Float64() < rate
+}
+
+// requestURI returns the path and query string with sensitive parameter values redacted
+func (l *accessLogger) requestURI(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Path
+	}
+	query := u.Query()
+	for name, values := range query {
+		if l.redactAll || l.redact[name] {
+			for i := range values {
+				values[i] = "REDACTED"
+			}
+		}
+	}
+	return u.Path + "?" + query.Encode()
+}
+
+// write renders entry in the configured format
+func (l *accessLogger) write(entry accessLogEntry) {
+	switch l.format {
+	case "json":
+		line, _ := json.Marshal(entry)
+		l.out.Print(string(line))
+	case "template":
+		var line bytes.Buffer
+		if err := l.tmpl.Execute(&line, entry); err != nil {
+			log.Printf("level=error msg=\"access log template failed\" error=%q", err)
+			return
+		}
+		l.out.Print(line.String())
+	default:
+		// Common Log Format: host ident authuser [date] "request" status bytes
+		l.out.Printf(`%s - - [%s] "%s %s %s" %d %d`,
+			entry.RemoteAddr, entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+			entry.Method, entry.URI, entry.Proto, entry.Status, entry.Bytes)
+	}
+}
+
+// remoteHost returns the client address without its port ("-" over a Unix socket)
+func remoteHost(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	if r.RemoteAddr == "" || r.RemoteAddr == "@" {
+		return "-"
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"github.com/nextjs-microfrontend/backend/internal/tenant"
+	"gorm.io/gorm"
+)
+
+// GET /api/activity is what happened in the system, newest first, for the admin home page.
+// The changes it lists are recorded in activity_events as they happen, from the same places
+// webhooks are sent from: flag changes made on this deployment, users created and deleted
+// through the REST API, zones leaving or returning to "healthy", and deployments recorded by
+// the GitHub webhook. One table keeps the feed one query, so ?filter= and pagination work as
+// they do everywhere else
+
+// activityFilterFields are the activity fields ?filter= and ?orderby= accept
+var activityFilterFields = filterFields{
+	"id":        {Column: "id", Kind: filterNumber},
+	"type":      {Column: "type", Kind: filterString},
+	"action":    {Column: "action", Kind: filterString},
+	"subject":   {Column: "subject", Kind: filterString},
+	"zone":      {Column: "zone", Kind: filterString},
+	"summary":   {Column: "summary", Kind: filterString},
+	"createdAt": {Column: "created_at", Kind: filterTime},
+}
+
+// activityLog records the activity feed's events
+// Its methods do nothing on a nil log, which is what mock mode has
+type activityLog struct {
+	db      *gorm.DB
+	timeout time.Duration // REQUEST_TIMEOUT, for each event's write
+
+	// Zone transitions are seen by every replica that checks the zones, so only the
+	// leader records them; nil (as in tests) records them here
+	leader *leaderElector
+}
+
+// newActivityLog creates a log that stores events in database
+func newActivityLog(database *gorm.DB, cfg Config) *activityLog {
+	return &activityLog{db: database, timeout: cfg.Server.RequestTimeout}
+}
+
+// record stores event
+// The change has already happened, so a cancelled request must not drop its event:
+// record gets a deadline of its own, and a failure is only logged
+func (a *activityLog) record(event models.ActivityEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+	if err := a.db.WithContext(ctx).Create(&event).Error; err != nil {
+		log.Printf("Failed to record %s %s activity: %v", event.Type, event.Action, err)
+	}
+}
+
+// flagChanged records a flag created, updated, or deleted on this replica
+// key is the flag's tenant.FlagKey
+func (a *activityLog) flagChanged(key, action string) {
+	if a == nil {
+		return
+	}
+	projectID, flagKey := tenant.SplitFlagKey(key)
+	a.record(models.ActivityEvent{
+		ProjectID: projectID, Type: "flag", Action: action, Subject: flagKey,
+		Summary: fmt.Sprintf("Flag %s was %s", flagKey, action),
+	})
+}
+
+// userCreated records a user created in ctx's project
+func (a *activityLog) userCreated(ctx context.Context, user models.User) {
+	if a == nil {
+		return
+	}
+	a.record(models.ActivityEvent{
+		ProjectID: tenant.FromContext(ctx).ID, Type: "user", Action: "created", Subject: strconv.FormatUint(uint64(user.ID), 10),
+		Summary: fmt.Sprintf("User %s (%s) was created", user.Name, user.Email),
+	})
+}
+
+// userDeleted records a user deleted from ctx's project
+func (a *activityLog) userDeleted(ctx context.Context, id string) {
+	if a == nil {
+		return
+	}
+	a.record(models.ActivityEvent{
+		ProjectID: tenant.FromContext(ctx).ID, Type: "user", Action: "deleted", Subject: id,
+		Summary: fmt.Sprintf("User %s was deleted", id),
+	})
+}
+
+// zoneChanged records an incident when a zone stops being healthy and a recovery when it is
+// healthy again, and a zone going into maintenance and coming out of it (see maintenance.go);
+// changes between unhealthy and degraded aren't activity
+func (a *activityLog) zoneChanged(previous string, status models.ZoneStatus) {
+	if a == nil || !a.leader.isLeading() {
+		return
+	}
+	event := models.ActivityEvent{Type: "zone", Subject: status.Name, Zone: status.Name}
+	switch transition := zoneTransitionEvent(previous, status.Status); {
+	case status.Status == "maintenance":
+		event.Action = "maintenance"
+		event.Summary = fmt.Sprintf("%s is in maintenance: %s", status.Name, status.Message)
+	case previous == "maintenance" && transition == "":
+		event.Action = "maintenance-ended"
+		event.Summary = fmt.Sprintf("%s is out of maintenance", status.Name)
+	case transition == "zone.incident":
+		event.Action = "incident"
+		event.Summary = fmt.Sprintf("%s is %s: %s", status.Name, status.Status, status.Message)
+	case transition == "zone.recovered":
+		event.Action = "recovered"
+		event.Summary = fmt.Sprintf("%s is healthy again", status.Name)
+	default:
+		return
+	}
+	a.record(event)
+}
+
+// deployment records a deployment event stored by the GitHub webhook
+func (a *activityLog) deployment(event models.DeploymentEvent) {
+	if a == nil {
+		return
+	}
+	summary := "Deployment of " + event.Zone
+	if event.Ref != "" {
+		summary += " at " + event.Ref
+	}
+	if event.Actor != "" {
+		summary += " by " + event.Actor
+	}
+	summary += ": " + event.Status
+	a.record(models.ActivityEvent{
+		Type: "deployment", Action: event.Status, Subject: event.Zone, Zone: event.Zone, Summary: summary,
+	})
+}
+
+// listActivityHandler responds to GET /api/activity
+// Newest first, narrowed with the shared ?filter= and ?orderby= parameters, e.g.
+// ?filter=type eq "flag" and createdAt ge "2024-03-01T00:00:00Z". A project sees its own flags
+// and users, and the incidents and deployments of its zones
+func (s *Server) listActivityHandler(w http.ResponseWriter, r *http.Request) {
+	listQuery, err := parseListQuery(r, activityFilterFields)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid query: "+err.Error())
+		return
+	}
+	project := tenant.FromContext(r.Context())
+	query := s.db.WithContext(r.Context()).Model(&models.ActivityEvent{})
+	if len(project.Zones) == 0 {
+		query = query.Where("project_id IN ?", []uint{project.ID, 0})
+	} else {
+		query = query.Where("(project_id = ? OR (project_id = 0 AND zone IN ?))", project.ID, project.Zones)
+	}
+
+	var events []models.ActivityEvent
+	if err := listQuery.apply(query, "created_at DESC, id DESC").Find(&events).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	setNextPageLink(w, r, listQuery.page, len(events))
+	writeJSON(w, r, http.StatusOK, events)
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The zones send page views and custom events (e.g. "signup") to POST /api/events in batches.
+// Raw events aren't stored: they are counted in memory per day, zone, name, and path and added
+// to the analytics_daily rollups on every flush, the same way usage.go keeps api_usage, and
+// visitors are counted once a day by storing a hash of their ID in analytics_visitors
+
+// maxAnalyticsKeys bounds how many rollup counters are held between flushes
+// Past it, new paths are counted as analyticsOtherPath, so made-up paths can't grow memory
+const maxAnalyticsKeys = 10000
+
+// maxAnalyticsVisitors bounds how many new visitors are held between flushes; reaching it
+// flushes early
+const maxAnalyticsVisitors = 50000
+
+// analyticsOtherPath stands in for paths seen after maxAnalyticsKeys
+const analyticsOtherPath = "(other)"
+
+// maxAnalyticsPathLength is the longest path stored; longer ones are cut (see models.AnalyticsRollup)
+const maxAnalyticsPathLength = 200
+
+// analyticsKey identifies one analytics_daily row
+type analyticsKey struct {
+	day, zone, kind, name, path string
+}
+
+// analyticsVisitorKey identifies one analytics_visitors row
+type analyticsVisitorKey struct {
+	day, zone, visitor string
+}
+
+// analyticsRecorder counts events in memory and periodically adds them to analytics_daily
+type analyticsRecorder struct {
+	db       *gorm.DB
+	cfg      AnalyticsConfig
+	mu       sync.Mutex
+	counts   map[analyticsKey]float64 // Weighted by 1/ANALYTICS_SAMPLE_RATE, so not always whole
+	visitors map[analyticsVisitorKey]bool
+
+	flushNow chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// newAnalyticsRecorder creates a recorder that saves to database and starts its flush loop
+func newAnalyticsRecorder(database *gorm.DB, cfg AnalyticsConfig) *analyticsRecorder {
+	a := &analyticsRecorder{
+		db:       database,
+		cfg:      cfg,
+		counts:   map[analyticsKey]float64{},
+		visitors: map[analyticsVisitorKey]bool{},
+		flushNow: make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// analyticsPath is the path an event is counted under: without the query string and fragment,
+// which would make every page look unique, and cut to maxAnalyticsPathLength
+func analyticsPath(path string) string {
+	path, _, _ = strings.Cut(path, "#")
+	path, _, _ = strings.Cut(path, "?")
+	if len(path) > maxAnalyticsPathLength {
+		path = path[:maxAnalyticsPathLength]
+	}
+	return path
+}
+
+// hashVisitor is what is stored for a visitor ID: enough of its SHA-256 to tell visitors apart
+func hashVisitor(visitor string) string {
+	sum := sha256.Sum256([]byte(visitor))
+	return hex.EncodeToString(sum[:16])
+}
+
+// sampled reports whether an event is kept at rate (ANALYTICS_SAMPLE_RATE). Visitors are sampled
+// as a whole, so a kept visitor's pages and events all count; events without one are sampled
+// one by one
+func sampled(visitor string, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	if visitor == "" {
+		return rand.Float64() < rate
+	}
+	sum := sha256.Sum256([]byte("sample:" + visitor))
+	return float64(binary.BigEndian.Uint64(sum[:8]))/math.MaxUint64 < rate
+}
+
+// record counts one kept event
+func (a *analyticsRecorder) record(day string, event models.AnalyticsEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := analyticsKey{day: day, zone: event.Zone, kind: event.Type, name: event.Name, path: analyticsPath(event.Path)}
+	if _, ok := a.counts[key]; !ok && len(a.counts) >= maxAnalyticsKeys {
+		key.path = analyticsOtherPath
+	}
+	a.counts[key] += 1 / a.cfg.SampleRate
+
+	if event.Visitor != "" {
+		visitor := hashVisitor(event.Visitor)
+		a.visitors[analyticsVisitorKey{day: day, zone: event.Zone, visitor: visitor}] = true
+		a.visitors[analyticsVisitorKey{day: day, visitor: visitor}] = true
+		if len(a.visitors) >= maxAnalyticsVisitors {
+			select {
+			case a.flushNow <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// run flushes every ANALYTICS_FLUSH_INTERVAL (or sooner when many visitors are waiting) until
+// close is called, then flushes one last time
+func (a *analyticsRecorder) run() {
+	defer close(a.done)
+	ticker := time.NewTicker(a.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.flush()
+		case <-a.flushNow:
+			a.flush()
+		case <-a.stop:
+			a.flush()
+			return
+		}
+	}
+}
+
+// close writes the counts collected since the last flush; called during shutdown
+// before the database pool is closed. Safe to call on a nil recorder
+func (a *analyticsRecorder) close() {
+	if a == nil {
+		return
+	}
+	close(a.stop)
+	<-a.done
+}
+
+// flush stores the new visitors, then adds the collected counts, including how many of the
+// visitors were new, to analytics_daily. Like usage, each replica adds its own counts; on
+// failure they are kept for the next flush
+func (a *analyticsRecorder) flush() {
+	a.mu.Lock()
+	counts, visitors := a.counts, a.visitors
+	a.counts, a.visitors = map[analyticsKey]float64{}, map[analyticsVisitorKey]bool{}
+	a.mu.Unlock()
+	if len(counts) == 0 && len(visitors) == 0 {
+		return
+	}
+
+	// Visitors another replica (or an earlier flush) already stored that day don't count again
+	byDayZone := map[analyticsVisitorKey][]models.AnalyticsVisitor{}
+	for key := range visitors {
+		day, _ := time.Parse(time.DateOnly, key.day)
+		group := analyticsVisitorKey{day: key.day, zone: key.zone}
+		byDayZone[group] = append(byDayZone[group], models.AnalyticsVisitor{Day: day, Zone: key.zone, Visitor: key.visitor})
+	}
+	var failed error
+	for group, rows := range byDayZone {
+		result := a.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows)
+		if result.Error != nil {
+			failed = result.Error
+			a.keep(nil, visitorKeys(rows, group))
+			continue
+		}
+		if result.RowsAffected > 0 {
+			counts[analyticsKey{day: group.day, zone: group.zone, kind: "visitor"}] += float64(result.RowsAffected) / a.cfg.SampleRate
+		}
+	}
+	if failed != nil {
+		log.Printf("Failed to save analytics visitors, retrying on the next flush: %v", failed)
+	}
+
+	rows := make([]models.AnalyticsRollup, 0, len(counts))
+	for key, count := range counts {
+		day, _ := time.Parse(time.DateOnly, key.day)
+		rows = append(rows, models.AnalyticsRollup{
+			Day: day, Zone: key.zone, Type: key.kind, Name: key.name, Path: key.path, Count: int64(math.Round(count)),
+		})
+	}
+	err := a.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "day"}, {Name: "zone"}, {Name: "type"}, {Name: "name"}, {Name: "path"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "count"}, Value: gorm.Expr("analytics_daily.count + " + excludedColumn(a.db, "count"))},
+		},
+	}).Create(&rows).Error
+	if err != nil {
+		log.Printf("Failed to save analytics (%d rows), retrying on the next flush: %v", len(rows), err)
+		a.keep(counts, nil)
+	}
+}
+
+// visitorKeys turns stored rows back into the keys record uses
+func visitorKeys(rows []models.AnalyticsVisitor, group analyticsVisitorKey) []analyticsVisitorKey {
+	keys := make([]analyticsVisitorKey, len(rows))
+	for i, row := range rows {
+		keys[i] = analyticsVisitorKey{day: group.day, zone: group.zone, visitor: row.Visitor}
+	}
+	return keys
+}
+
+// keep puts counts and visitors that failed to save back for the next flush
+func (a *analyticsRecorder) keep(counts map[analyticsKey]float64, visitors []analyticsVisitorKey) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, count := range counts {
+		a.counts[key] += count
+	}
+	for _, key := range visitors {
+		a.visitors[key] = true
+	}
+}
+
+// prune deletes rollups older than ANALYTICS_RETENTION_DAYS and returns how many there were
+// (on a dry run, would be). It runs on the leader only, as the cleanup-analytics schedule (see schedules.go)
+func (a *analyticsRecorder) prune(ctx context.Context, dryRun bool) (int64, error) {
+	if a.cfg.RetentionDays <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().UTC().AddDate(0, 0, -a.cfg.RetentionDays).Format(time.DateOnly)
+	return purge(a.db.WithContext(ctx).Where("day < ?", cutoff), &models.AnalyticsRollup{}, dryRun)
+}
+
+// pruneVisitors deletes visitors older than ANALYTICS_VISITOR_RETENTION_DAYS, like prune; they
+// are only needed to count each visitor once on their day, so they can go long before the
+// rollups. The cleanup-analytics-visitors schedule
+func (a *analyticsRecorder) pruneVisitors(ctx context.Context, dryRun bool) (int64, error) {
+	if a.cfg.VisitorRetentionDays <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().UTC().AddDate(0, 0, -a.cfg.VisitorRetentionDays).Format(time.DateOnly)
+	return purge(a.db.WithContext(ctx).Where("day < ?", cutoff), &models.AnalyticsVisitor{}, dryRun)
+}
+
+// recordEventsHandler responds to POST /api/events
+// Events are counted straight away but reach GET /api/analytics on the next flush; zones
+// that aren't configured are rejected, like bodies over ANALYTICS_MAX_BODY_BYTES
+// (413) and batches over ANALYTICS_MAX_BATCH_SIZE
+func (s *Server) recordEventsHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := s.config.Analytics
+	if r.ContentLength > int64(cfg.MaxBodyBytes) {
+		writeError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body is over %d bytes", cfg.MaxBodyBytes))
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, int64(cfg.MaxBodyBytes))
+
+	var req models.AnalyticsEventsRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	var fieldErrors []models.FieldError
+	if len(req.Events) > cfg.MaxBatchSize {
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "events", Message: fmt.Sprintf("must have at most %d items", cfg.MaxBatchSize)})
+	}
+	for i, event := range req.Events {
+		if _, ok := s.findZone(event.Zone); !ok {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: fmt.Sprintf("events[%d].zone", i), Message: "must be a zone (" + s.zoneNames() + ")"})
+		}
+	}
+	if len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+
+	day := time.Now().UTC().Format(time.DateOnly)
+	response := models.AnalyticsEventsResponse{SampleRate: cfg.SampleRate}
+	for _, event := range req.Events {
+		if event.Type == "pageview" {
+			event.Name = ""
+		}
+		if !sampled(event.Visitor, cfg.SampleRate) {
+			response.Sampled++
+			continue
+		}
+		s.analytics.record(day, event)
+		response.Accepted++
+	}
+	writeJSON(w, r, http.StatusAccepted, response)
+}
+
+// getAnalyticsHandler responds to GET /api/analytics
+// Query parameters: from and to (YYYY-MM-DD, UTC, default the last 7 days, at most 366 days),
+// zone to narrow the report, and limit for the top pages and events (default 10, at most
+// LIST_MAX_PAGE_SIZE). Counts flushed in the last ANALYTICS_FLUSH_INTERVAL may not be included yet
+func (s *Server) getAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	from, to := today.AddDate(0, 0, -6), today
+	for name, target := range map[string]*time.Time{"from": &from, "to": &to} {
+		if value := query.Get(name); value != "" {
+			day, err := time.Parse(time.DateOnly, value)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, fmt.Sprintf("%s must be a date (YYYY-MM-DD)", name))
+				return
+			}
+			*target = day
+		}
+	}
+	switch {
+	case to.Before(from):
+		writeError(w, r, http.StatusBadRequest, "to must not be before from")
+		return
+	case to.Sub(from) >= 366*24*time.Hour:
+		writeError(w, r, http.StatusBadRequest, "A report can cover at most 366 days")
+		return
+	}
+	zone := query.Get("zone")
+	if _, ok := s.findZone(zone); zone != "" && !ok {
+		writeError(w, r, http.StatusBadRequest, "Unknown zone "+zone+" (expected one of "+s.zoneNames()+")")
+		return
+	}
+
+	limit := 10
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			writeError(w, r, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, s.config.API.MaxPageSize)
+	}
+
+	report, err := s.analyticsReport(r.Context(), from, to, zone, limit)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, report)
+}
+
+// analyticsReport totals the rollups from from to to (UTC days, inclusive), in zone unless
+// it is empty
+func (s *Server) analyticsReport(ctx context.Context, from, to time.Time, zone string, limit int) (models.AnalyticsReport, error) {
+	// A half-open range rather than BETWEEN, for SQLite (see usageReport)
+	rollups := func() *gorm.DB {
+		return s.db.WithContext(ctx).Model(&models.AnalyticsRollup{}).
+			Where("day >= ? AND day < ?", from.Format(time.DateOnly), to.AddDate(0, 0, 1).Format(time.DateOnly))
+	}
+	inZone := func(query *gorm.DB) *gorm.DB {
+		if zone != "" {
+			return query.Where("zone = ?", zone)
+		}
+		return query
+	}
+
+	// Visitors have their own site-wide rows (zone ""), since a visitor of both zones is one visitor
+	dailyQuery := rollups().Select("day, type, SUM(count) AS count").Group("day, type")
+	if zone != "" {
+		dailyQuery = dailyQuery.Where("zone = ?", zone)
+	} else {
+		dailyQuery = dailyQuery.Where("type <> ? OR zone = ?", "visitor", "")
+	}
+	var daily []struct {
+		Day   time.Time
+		Type  string
+		Count int64
+	}
+	if err := dailyQuery.Scan(&daily).Error; err != nil {
+		return models.AnalyticsReport{}, err
+	}
+
+	report := models.AnalyticsReport{
+		From:      from.Format(time.DateOnly),
+		To:        to.Format(time.DateOnly),
+		Zone:      zone,
+		Days:      []models.AnalyticsDay{},
+		TopPages:  []models.AnalyticsPage{},
+		TopEvents: []models.AnalyticsEventTotal{},
+	}
+	index := map[string]int{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		index[day.Format(time.DateOnly)] = len(report.Days)
+		report.Days = append(report.Days, models.AnalyticsDay{Day: day.Format(time.DateOnly)})
+	}
+	for _, row := range daily {
+		i, ok := index[row.Day.UTC().Format(time.DateOnly)]
+		if !ok {
+			continue
+		}
+		switch row.Type {
+		case "pageview":
+			report.Days[i].PageViews += row.Count
+			report.Totals.PageViews += row.Count
+		case "custom":
+			report.Days[i].Events += row.Count
+			report.Totals.Events += row.Count
+		case "visitor":
+			report.Days[i].Visitors += row.Count
+		}
+	}
+
+	err := inZone(rollups()).Select("path, SUM(count) AS views").Where("type = ?", "pageview").
+		Group("path").Order("views DESC").Order("path").Limit(limit).Scan(&report.TopPages).Error
+	if err == nil {
+		err = inZone(rollups()).Select("name, SUM(count) AS count").Where("type = ?", "custom").
+			Group("name").Order("count DESC").Order("name").Limit(limit).Scan(&report.TopEvents).Error
+	}
+	return report, err
+}
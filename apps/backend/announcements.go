@@ -0,0 +1,190 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+)
+
+// Announcements are banners the zones show, such as the welcome banner or an outage notice.
+// They are managed from zone-admin through /api/announcements, and zone-main reads the ones
+// that are active right now from GET /api/announcements/active?zone=zone-main, so changing
+// a banner doesn't need a deploy
+
+// announcementSeverities orders severities from least to most urgent
+var announcementSeverities = []string{"info", "warning", "critical"}
+
+// checkAnnouncement returns the problems with an announcement that the validate tags can't see:
+// zones that don't exist, and an end that isn't after the start
+func (s *Server) checkAnnouncement(announcement models.Announcement) []models.FieldError {
+	var fieldErrors []models.FieldError
+	for i, name := range announcement.Zones {
+		if _, ok := s.findZone(name); !ok {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: fmt.Sprintf("zones[%d]", i), Message: "must be a zone (" + s.zoneNames() + ")"})
+		}
+	}
+	if announcement.StartsAt != nil && announcement.EndsAt != nil && !announcement.EndsAt.After(*announcement.StartsAt) {
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "endsAt", Message: "must be after startsAt"})
+	}
+	return fieldErrors
+}
+
+// zoneNames lists the zones' names for error messages
+func (s *Server) zoneNames() string {
+	names := make([]string, len(s.zones))
+	for i, zone := range s.zones {
+		names[i] = zone.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// listAnnouncementsHandler responds to GET /api/announcements
+// Every announcement, including scheduled and ended ones, newest first
+func (s *Server) listAnnouncementsHandler(w http.ResponseWriter, r *http.Request) {
+	var announcements []models.Announcement
+	if err := s.db.WithContext(r.Context()).Order("id DESC").Find(&announcements).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, announcements)
+}
+
+// getActiveAnnouncementsHandler responds to GET /api/announcements/active?zone=
+// The announcements shown right now, in the zone when one is given: most severe first,
+// then newest first
+func (s *Server) getActiveAnnouncementsHandler(w http.ResponseWriter, r *http.Request) {
+	zone := r.URL.Query().Get("zone")
+	if _, ok := s.findZone(zone); zone != "" && !ok {
+		writeError(w, r, http.StatusBadRequest, "Unknown zone "+zone+" (expected one of "+s.zoneNames()+")")
+		return
+	}
+
+	now := time.Now()
+	var announcements []models.Announcement
+	err := s.db.WithContext(r.Context()).
+		Where("(starts_at IS NULL OR starts_at <= ?) AND (ends_at IS NULL OR ends_at > ?)", now, now).
+		Order("id DESC").Find(&announcements).Error
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	// Zones are a JSON list, so they are matched here rather than in SQL; there are only ever a few
+	active := []models.Announcement{}
+	for _, announcement := range announcements {
+		if zone == "" || len(announcement.Zones) == 0 || slices.Contains(announcement.Zones, zone) {
+			active = append(active, announcement)
+		}
+	}
+	slices.SortStableFunc(active, func(a, b models.Announcement) int {
+		return cmp.Compare(slices.Index(announcementSeverities, b.Severity), slices.Index(announcementSeverities, a.Severity))
+	})
+	if err := s.translations.localizeAnnouncements(w, r, active); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, active)
+}
+
+// createAnnouncementHandler responds to POST /api/announcements
+func (s *Server) createAnnouncementHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateAnnouncementRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	announcement := models.Announcement{
+		Message:     req.Message,
+		Severity:    cmp.Or(req.Severity, "info"),
+		Zones:       models.StringList(req.Zones),
+		StartsAt:    req.StartsAt,
+		EndsAt:      req.EndsAt,
+		Dismissible: req.Dismissible,
+	}
+	if announcement.Zones == nil {
+		announcement.Zones = models.StringList{}
+	}
+	if fieldErrors := s.checkAnnouncement(announcement); len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+	if err := s.db.WithContext(r.Context()).Create(&announcement).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to create announcement: %v", err))
+		return
+	}
+	log.Printf("Announcement %d created (%s)", announcement.ID, announcement.Severity)
+
+	w.Header().Set("Location", fmt.Sprintf("%s/api/announcements/%d", s.config.Server.BasePath, announcement.ID))
+	writeJSON(w, r, http.StatusCreated, announcement)
+}
+
+// getAnnouncementHandler responds to GET /api/announcements/{id}
+func (s *Server) getAnnouncementHandler(w http.ResponseWriter, r *http.Request) {
+	if announcement, ok := findByID[models.Announcement](w, r, s.db, "Announcement"); ok {
+		writeJSON(w, r, http.StatusOK, announcement)
+	}
+}
+
+// updateAnnouncementHandler responds to PATCH /api/announcements/{id}
+// Setting endsAt to now takes an announcement down while keeping it for later
+func (s *Server) updateAnnouncementHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateAnnouncementRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	announcement, ok := findByID[models.Announcement](w, r, s.db, "Announcement")
+	if !ok {
+		return
+	}
+
+	if req.Message != nil {
+		announcement.Message = *req.Message
+	}
+	if req.Severity != nil {
+		announcement.Severity = *req.Severity
+	}
+	if req.Zones != nil {
+		announcement.Zones = models.StringList(req.Zones)
+	}
+	if req.StartsAt != nil {
+		announcement.StartsAt = req.StartsAt
+	}
+	if req.EndsAt != nil {
+		announcement.EndsAt = req.EndsAt
+	}
+	if req.Dismissible != nil {
+		announcement.Dismissible = *req.Dismissible
+	}
+	if fieldErrors := s.checkAnnouncement(announcement); len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+	if err := s.db.WithContext(r.Context()).Save(&announcement).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to update announcement: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, announcement)
+}
+
+// deleteAnnouncementHandler responds to DELETE /api/announcements/{id}
+func (s *Server) deleteAnnouncementHandler(w http.ResponseWriter, r *http.Request) {
+	announcement, ok := findByID[models.Announcement](w, r, s.db, "Announcement")
+	if !ok {
+		return
+	}
+	if err := s.db.WithContext(r.Context()).Delete(&announcement).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	if _, err := s.translations.remove(r.Context(), 0, translatedAnnouncement, strconv.FormatUint(uint64(announcement.ID), 10), ""); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "Announcement deleted successfully"})
+}
@@ -0,0 +1,3427 @@
+//go:build integration
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testWebhookSecret = "integration-test-secret"
+
+func TestHealth(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.do(t, "GET", "/health", nil).expect(t, http.StatusOK).golden(t, "health")
+	ts.do(t, "GET", "/version", nil).expect(t, http.StatusOK).golden(t, "version")
+	ts.doInternal(t, "GET", "/readyz", nil).expect(t, http.StatusOK).golden(t, "ready")
+	// Only the API is public
+	ts.do(t, "GET", "/readyz", nil).expect(t, http.StatusNotFound)
+	ts.do(t, "GET", "/metrics", nil).expect(t, http.StatusNotFound)
+}
+
+func TestInternalEndpoints(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.doInternal(t, "GET", "/internal/log-level", nil).expect(t, http.StatusOK).golden(t, "log-level")
+
+	var stats cacheStatsResponse
+	ts.doInternal(t, "GET", "/internal/cache/stats", nil).expect(t, http.StatusOK).decode(t, &stats)
+
+	ts.do(t, "GET", "/health", nil).expect(t, http.StatusOK)
+	metrics := ts.doInternal(t, "GET", "/metrics", nil).expect(t, http.StatusOK)
+	if !strings.Contains(string(metrics.body), "http_requests_total") {
+		t.Error("/metrics has no http_requests_total")
+	}
+}
+
+func TestRuntimeConfig(t *testing.T) {
+	t.Setenv("LIST_MAX_PAGE_SIZE", "150")
+	ts := newTestServer(t, func(c *Config) {
+		c.API.Token = "not-for-your-eyes"
+		c.API.MaxPageSize = 150
+	})
+
+	var got runtimeConfigResponse
+	ts.doInternal(t, "GET", "/internal/config", nil).expect(t, http.StatusOK).decode(t, &got)
+	settings := map[string]configSetting{}
+	for _, setting := range got.Settings {
+		settings[setting.Key] = setting
+	}
+
+	want := map[string]configSetting{
+		"api.token":                 {Key: "api.token", Env: "API_TOKEN", Value: redactedValue, Source: "default", Secret: true},
+		"api.max_page_size":         {Key: "api.max_page_size", Env: "LIST_MAX_PAGE_SIZE", Value: 150.0, Source: "env"},
+		"zones.proxy_token":         {Key: "zones.proxy_token", Env: "ZONE_PROXY_TOKEN", Value: "", Source: "default", Secret: true},
+		"zones.status_max_age":      {Key: "zones.status_max_age", Env: "ZONE_STATUS_MAX_AGE", Value: "10s", Source: "default", Reloadable: true},
+		"server.request_timeout":    {Key: "server.request_timeout", Env: "REQUEST_TIMEOUT", Value: ts.config.Server.RequestTimeout.String(), Source: "default"},
+		"logging.access_log_format": {Key: "logging.access_log_format", Env: "ACCESS_LOG_FORMAT", Value: ts.config.Logging.AccessLogFormat, Source: "default"},
+	}
+	for key, setting := range want {
+		if !reflect.DeepEqual(settings[key], setting) {
+			t.Errorf("%s = %+v, want %+v", key, settings[key], setting)
+		}
+	}
+	if strings.Contains(string(ts.doInternal(t, "GET", "/internal/config", nil).body), "not-for-your-eyes") {
+		t.Error("/internal/config shows API_TOKEN")
+	}
+}
+
+// fakeTool writes a shell script standing in for pg_dump or pg_restore and returns its path
+func fakeTool(t *testing.T, name, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0o755); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+// waitForBackupJob polls a backup job until it has finished
+func waitForBackupJob(t *testing.T, ts *testServer, job models.BackupJob) models.BackupJob {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for job.Status == "running" {
+		if time.Now().After(deadline) {
+			t.Fatalf("backup job %d is still running", job.ID)
+		}
+		time.Sleep(20 * time.Millisecond)
+		ts.doInternal(t, "GET", fmt.Sprintf("/internal/backups/jobs/%d", job.ID), nil).expect(t, http.StatusOK).decode(t, &job)
+	}
+	return job
+}
+
+func TestBackups(t *testing.T) {
+	dir := t.TempDir()
+	restored := filepath.Join(t.TempDir(), "restored")
+	ts := newTestServer(t, func(c *Config) {
+		c.Backup.Enabled = true
+		c.Backup.Dir = dir
+		c.Backup.PgDump = fakeTool(t, "pg_dump", `echo "dump $*"`)
+		c.Backup.PgRestore = fakeTool(t, "pg_restore", `cat > `+restored)
+	})
+
+	var job models.BackupJob
+	ts.doInternal(t, "POST", "/internal/backups", nil).expect(t, http.StatusAccepted).decode(t, &job)
+	job = waitForBackupJob(t, ts, job)
+	if job.Status != "succeeded" || job.Kind != "backup" || job.SizeBytes == 0 {
+		t.Fatalf("backup job = %+v, want a succeeded backup", job)
+	}
+	dump, err := os.ReadFile(filepath.Join(dir, job.Backup))
+	if err != nil {
+		t.Fatalf("backup was not stored: %v", err)
+	}
+	for _, arg := range []string{"--format=custom", "--exclude-table=backup_jobs", "--no-password"} {
+		if !strings.Contains(string(dump), arg) {
+			t.Errorf("pg_dump ran without %s: %s", arg, dump)
+		}
+	}
+
+	var list models.BackupsResponse
+	ts.doInternal(t, "GET", "/internal/backups", nil).expect(t, http.StatusOK).decode(t, &list)
+	if len(list.Backups) != 1 || list.Backups[0].Name != job.Backup {
+		t.Errorf("backups = %+v, want just %s", list.Backups, job.Backup)
+	}
+
+	t.Run("restore", func(t *testing.T) {
+		path := "/internal/backups/" + job.Backup + "/restore"
+		ts.doInternal(t, "POST", path, models.RestoreRequest{Confirm: "something-else.dump"}).expect(t, http.StatusBadRequest)
+		ts.doInternal(t, "POST", "/internal/backups/missing.dump/restore", models.RestoreRequest{Confirm: "missing.dump"}).expect(t, http.StatusNotFound)
+
+		var restore models.BackupJob
+		ts.doInternal(t, "POST", path, models.RestoreRequest{Confirm: job.Backup}).expect(t, http.StatusAccepted).decode(t, &restore)
+		if restore = waitForBackupJob(t, ts, restore); restore.Status != "succeeded" {
+			t.Fatalf("restore job = %+v, want succeeded", restore)
+		}
+		if got, _ := os.ReadFile(restored); string(got) != string(dump) {
+			t.Errorf("pg_restore read %q, want the backup %q", got, dump)
+		}
+	})
+
+	t.Run("failed dump", func(t *testing.T) {
+		// Output before the failure must not end up stored as a backup
+		ts.backups.cfg.PgDump = fakeTool(t, "pg_dump", `echo partial; echo "connection refused" >&2; exit 1`)
+		var failed models.BackupJob
+		ts.doInternal(t, "POST", "/internal/backups", nil).expect(t, http.StatusAccepted).decode(t, &failed)
+		failed = waitForBackupJob(t, ts, failed)
+		if failed.Status != "failed" || !strings.Contains(failed.Error, "connection refused") {
+			t.Errorf("job = %+v, want failed with pg_dump's error", failed)
+		}
+		if _, err := os.Stat(filepath.Join(dir, failed.Backup)); err == nil {
+			t.Errorf("failed dump %s was stored", failed.Backup)
+		}
+	})
+
+	var jobs models.BackupJobsResponse
+	ts.doInternal(t, "GET", "/internal/backups/jobs", nil).expect(t, http.StatusOK).decode(t, &jobs)
+	if len(jobs.Jobs) != 3 || jobs.Jobs[0].Status != "failed" || jobs.Jobs[2].ID != job.ID {
+		t.Errorf("jobs = %+v, want the failed backup, the restore, and the backup", jobs.Jobs)
+	}
+}
+
+// TestBackupRoundTrip backs up and restores the test database for real, when the Postgres tools are installed
+func TestBackupRoundTrip(t *testing.T) {
+	if _, err := exec.LookPath("pg_dump"); err != nil {
+		t.Skip("pg_dump is not installed")
+	}
+	ts := newTestServer(t, func(c *Config) {
+		c.Backup.Enabled = true
+		c.Backup.Dir = t.TempDir()
+	})
+
+	var backup models.BackupJob
+	ts.doInternal(t, "POST", "/internal/backups", nil).expect(t, http.StatusAccepted).decode(t, &backup)
+	if backup = waitForBackupJob(t, ts, backup); backup.Status != "succeeded" {
+		t.Fatalf("backup job = %+v, want succeeded", backup)
+	}
+
+	ts.do(t, "DELETE", "/api/feature-flags/dark_mode", nil).expect(t, http.StatusOK)
+	ts.do(t, "GET", "/api/feature-flags/dark_mode", nil).expect(t, http.StatusNotFound)
+
+	var restore models.BackupJob
+	ts.doInternal(t, "POST", "/internal/backups/"+backup.Backup+"/restore", models.RestoreRequest{Confirm: backup.Backup}).
+		expect(t, http.StatusAccepted).decode(t, &restore)
+	if restore = waitForBackupJob(t, ts, restore); restore.Status != "succeeded" {
+		t.Fatalf("restore job = %+v, want succeeded", restore)
+	}
+	ts.do(t, "GET", "/api/feature-flags/dark_mode", nil).expect(t, http.StatusOK)
+}
+
+// waitForLeader waits until exactly one of electors leads and returns it
+func waitForLeader(t *testing.T, electors ...*leaderElector) *leaderElector {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		var leaders []*leaderElector
+		for _, l := range electors {
+			if l.leading.Load() {
+				leaders = append(leaders, l)
+			}
+		}
+		if len(leaders) == 1 {
+			return leaders[0]
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("no single leader elected")
+	return nil
+}
+
+func TestLeaderElection(t *testing.T) {
+	t.Parallel()
+	cfg := testConfig.Leader
+	cfg.Enabled = true
+	cfg.Namespace = "test"
+	cfg.LeaseDuration = 2 * time.Second
+	cfg.RenewDeadline = time.Second
+	cfg.RetryPeriod = 100 * time.Millisecond
+	client := fake.NewSimpleClientset()
+
+	// The task counts how many replicas run it at once
+	var running, overlaps atomic.Int32
+	task := func(ctx context.Context) {
+		if running.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond) // Still cleaning up after cancellation
+		running.Add(-1)
+	}
+	var electors []*leaderElector
+	for _, identity := range []string{"backend-a", "backend-b", "backend-c"} {
+		l := newLeaderElector(cfg)
+		l.identity, l.client = identity, client
+		l.onLeader("test", task)
+		if err := l.start(); err != nil {
+			t.Fatalf("start %s: %v", identity, err)
+		}
+		t.Cleanup(l.stop)
+		electors = append(electors, l)
+	}
+
+	// Stopping the leader hands the lease over well before it would expire
+	first := waitForLeader(t, electors...)
+	stopped := time.Now()
+	first.stop()
+	var rest []*leaderElector
+	for _, l := range electors {
+		if l != first {
+			rest = append(rest, l)
+		}
+	}
+	second := waitForLeader(t, rest...)
+	if took := time.Since(stopped); took >= cfg.LeaseDuration {
+		t.Errorf("failover took %s, want less than the lease duration", took)
+	}
+	if status := second.status(); status.Leader != second.identity || !reflect.DeepEqual(status.Tasks, []string{"test"}) {
+		t.Errorf("status = %+v", status)
+	}
+	if status := first.status(); status.Leading {
+		t.Errorf("stopped elector still leading: %+v", status)
+	}
+	if n := overlaps.Load(); n != 0 {
+		t.Errorf("task ran on %d replicas at once", n+1)
+	}
+}
+
+func TestLeaderElectionDisabled(t *testing.T) {
+	t.Parallel()
+	ran := make(chan struct{})
+	l := newLeaderElector(testConfig.Leader)
+	l.onLeader("test", func(ctx context.Context) {
+		close(ran)
+		<-ctx.Done()
+	})
+	if err := l.start(); err != nil {
+		t.Fatal(err)
+	}
+	<-ran
+	if status := l.status(); !status.Leading || status.Enabled || status.Leader != l.identity {
+		t.Errorf("status = %+v, want this replica leading", status)
+	}
+	l.stop()
+	if l.leading.Load() {
+		t.Error("still leading after stop")
+	}
+}
+
+func TestStatusPage(t *testing.T) {
+	ts := newTestServer(t)
+
+	page := ts.do(t, "GET", "/dashboard/", nil).expect(t, http.StatusOK)
+	if !strings.Contains(string(page.body), "<title>Backend Status</title>") {
+		t.Errorf("/dashboard/ is not the status page: %s", page.body)
+	}
+	for _, asset := range []string{"status.js", "status.css"} {
+		ts.do(t, "GET", "/dashboard/"+asset, nil).expect(t, http.StatusOK)
+	}
+}
+
+func TestZonesStatus(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.do(t, "GET", "/api/zones/status", nil).expect(t, http.StatusOK).golden(t, "v1")
+	ts.do(t, "GET", "/api/v2/zones/status", nil).expect(t, http.StatusOK).golden(t, "v2")
+}
+
+func TestUsers(t *testing.T) {
+	ts := newTestServer(t)
+
+	t.Run("list", func(t *testing.T) {
+		ts.do(t, "GET", "/api/users", nil).expect(t, http.StatusOK).golden(t, "all")
+		ts.do(t, "GET", "/api/users?"+listParams("name co \"an\"", "name desc"), nil).expect(t, http.StatusOK).golden(t, "filtered")
+		ts.do(t, "GET", "/api/users?filter=nickname+eq+1", nil).expect(t, http.StatusBadRequest).golden(t, "bad-filter")
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		resp := ts.do(t, "GET", "/api/users?pageSize=2", nil).expect(t, http.StatusOK)
+		resp.golden(t, "first")
+		if link := resp.header.Get("Link"); !strings.Contains(link, `rel="next"`) {
+			t.Errorf("Link = %q, want a next link", link)
+		}
+		ts.do(t, "GET", "/api/v2/users?pageSize=2&page=2", nil).expect(t, http.StatusOK).golden(t, "v2-second")
+	})
+
+	t.Run("get", func(t *testing.T) {
+		resp := ts.do(t, "GET", "/api/users/2", nil).expect(t, http.StatusOK)
+		resp.golden(t, "found")
+		ts.do(t, "GET", "/api/users/2", nil, "If-None-Match", resp.header.Get("ETag")).expect(t, http.StatusNotModified)
+		// v2 bodies carry the request's ID, which doesn't count towards the ETag
+		v2 := ts.do(t, "GET", "/api/v2/users/2", nil).expect(t, http.StatusOK)
+		ts.do(t, "GET", "/api/v2/users/2", nil, "If-None-Match", v2.header.Get("ETag")).expect(t, http.StatusNotModified)
+		ts.do(t, "GET", "/api/v2/users/2", nil, "Accept", jsonAPIContentType, "If-None-Match", v2.header.Get("ETag")).expect(t, http.StatusOK)
+		ts.do(t, "GET", "/api/users/2", nil, "Accept", jsonAPIContentType).expect(t, http.StatusOK).golden(t, "jsonapi")
+		ts.do(t, "GET", "/api/users/999", nil).expect(t, http.StatusNotFound).golden(t, "missing")
+	})
+
+	t.Run("create", func(t *testing.T) {
+		ts.do(t, "POST", "/api/users", models.CreateUserRequest{Email: "grace@example.com", Name: "Grace Hopper"}).
+			expect(t, http.StatusCreated).golden(t, "created")
+		ts.do(t, "POST", "/api/users", models.CreateUserRequest{Email: "not-an-email"}).
+			expect(t, http.StatusBadRequest).golden(t, "invalid")
+		ts.do(t, "POST", "/api/users", "{not json").expect(t, http.StatusBadRequest).golden(t, "malformed")
+	})
+
+	t.Run("bulk", func(t *testing.T) {
+		ts.do(t, "POST", "/api/users/bulk", models.BulkCreateUsersRequest{Users: []models.CreateUserRequest{
+			{Email: "heidi@example.com", Name: "Heidi Klum"},
+			{Email: "ivan@example.com", Name: "Ivan Petrov"},
+		}}).expect(t, http.StatusCreated).golden(t, "created")
+
+		// One duplicate email rolls back the whole batch
+		ts.do(t, "POST", "/api/users/bulk", models.BulkCreateUsersRequest{Users: []models.CreateUserRequest{
+			{Email: "judy@example.com", Name: "Judy Garland"},
+			{Email: "alice@example.com", Name: "Alice Again"},
+		}}).expect(t, http.StatusInternalServerError)
+		ts.do(t, "GET", "/api/users?filter=email+eq+%22judy@example.com%22", nil).expect(t, http.StatusOK).golden(t, "rolled-back")
+	})
+
+	t.Run("export", func(t *testing.T) {
+		csv := ts.do(t, "GET", "/api/users?columns=id,email,name&orderby=id", nil, "Accept", csvContentType).expect(t, http.StatusOK)
+		if got := csv.lines(); len(got) < 2 || got[0] != "id,email,name" || got[1] != "1,alice@example.com,Alice Johnson" {
+			t.Errorf("CSV export starts with %q", got[:min(len(got), 2)])
+		}
+
+		var users []models.User
+		ts.do(t, "GET", "/api/users", nil).expect(t, http.StatusOK).decode(t, &users)
+		ndjson := ts.do(t, "GET", "/api/users", nil, "Accept", ndjsonContentType).expect(t, http.StatusOK)
+		if got := ndjson.lines(); len(got) != len(users) {
+			t.Errorf("NDJSON export has %d lines, want %d", len(got), len(users))
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		ts.do(t, "DELETE", "/api/users/3", nil).expect(t, http.StatusOK).golden(t, "deleted")
+		ts.do(t, "GET", "/api/users/3", nil).expect(t, http.StatusNotFound)
+		ts.do(t, "DELETE", "/api/users/3", nil).expect(t, http.StatusNotFound).golden(t, "missing")
+	})
+}
+
+func TestFeatureFlags(t *testing.T) {
+	ts := newTestServer(t)
+
+	t.Run("list", func(t *testing.T) {
+		ts.do(t, "GET", "/api/feature-flags", nil).expect(t, http.StatusOK).golden(t, "all")
+		ts.do(t, "GET", "/api/feature-flags?"+listParams("enabled eq true", "key"), nil).expect(t, http.StatusOK).golden(t, "enabled")
+		ts.do(t, "GET", "/api/v2/feature-flags", nil).expect(t, http.StatusOK).golden(t, "v2")
+	})
+
+	t.Run("get", func(t *testing.T) {
+		ts.do(t, "GET", "/api/feature-flags/dark_mode", nil).expect(t, http.StatusOK).golden(t, "found")
+		ts.do(t, "GET", "/api/feature-flags/no_such_flag", nil).expect(t, http.StatusNotFound).golden(t, "missing")
+		ts.do(t, "GET", "/api/feature-flags/dark_mode", nil, "Accept", msgpackContentType).expect(t, http.StatusOK)
+	})
+
+	t.Run("create", func(t *testing.T) {
+		ts.do(t, "POST", "/api/feature-flags", models.CreateFeatureFlagRequest{Key: "live_chat", Name: "Live Chat", Enabled: true}).
+			expect(t, http.StatusCreated).golden(t, "created")
+		ts.do(t, "POST", "/api/feature-flags", models.CreateFeatureFlagRequest{Key: "Not-A-Key", Name: "Bad"}).
+			expect(t, http.StatusBadRequest).golden(t, "invalid")
+	})
+
+	t.Run("bulk", func(t *testing.T) {
+		ts.do(t, "POST", "/api/feature-flags/bulk", models.BulkCreateFeatureFlagsRequest{Flags: []models.CreateFeatureFlagRequest{
+			{Key: "promo_banner", Name: "Promo Banner"},
+			{Key: "checkout_v2", Name: "Checkout v2", Enabled: true},
+		}}).expect(t, http.StatusCreated).golden(t, "created")
+	})
+
+	t.Run("update", func(t *testing.T) {
+		enabled := true
+		ts.do(t, "PATCH", "/api/feature-flags/dark_mode", models.UpdateFeatureFlagRequest{Enabled: &enabled}).
+			expect(t, http.StatusOK).golden(t, "updated")
+		// Served from the cache, which the update refreshed
+		ts.do(t, "GET", "/api/feature-flags/dark_mode", nil).expect(t, http.StatusOK).golden(t, "after")
+		ts.do(t, "PATCH", "/api/feature-flags/no_such_flag", models.UpdateFeatureFlagRequest{Enabled: &enabled}).
+			expect(t, http.StatusNotFound)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		ts.do(t, "DELETE", "/api/feature-flags/beta_search", nil).expect(t, http.StatusOK).golden(t, "deleted")
+		ts.do(t, "GET", "/api/feature-flags/beta_search", nil).expect(t, http.StatusNotFound)
+	})
+}
+
+func TestDashboard(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.do(t, "GET", "/api/dashboard", nil).expect(t, http.StatusOK).golden(t, "dashboard")
+}
+
+func TestBootstrap(t *testing.T) {
+	ts := newTestServer(t)
+
+	resp := ts.do(t, "GET", "/api/bootstrap", nil).expect(t, http.StatusOK)
+	resp.golden(t, "initial")
+	etag := resp.header.Get("ETag")
+	ts.do(t, "GET", "/api/bootstrap", nil, "If-None-Match", etag).expect(t, http.StatusNotModified)
+
+	// The snapshot is rebuilt in the background after a change
+	enabled := true
+	ts.do(t, "PATCH", "/api/feature-flags/dark_mode", models.UpdateFeatureFlagRequest{Enabled: &enabled}).expect(t, http.StatusOK)
+	deadline := time.Now().Add(5 * time.Second)
+	for resp.header.Get("ETag") == etag && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		resp = ts.do(t, "GET", "/api/bootstrap", nil).expect(t, http.StatusOK)
+	}
+	resp.golden(t, "updated")
+}
+
+func TestChanges(t *testing.T) {
+	ts := newTestServer(t)
+
+	var start models.ChangesResponse
+	ts.do(t, "GET", "/api/changes", nil).expect(t, http.StatusOK).decode(t, &start)
+
+	ts.do(t, "POST", "/api/feature-flags", models.CreateFeatureFlagRequest{Key: "live_chat", Name: "Live Chat"}).expect(t, http.StatusCreated)
+	ts.do(t, "DELETE", "/api/feature-flags/dark_mode", nil).expect(t, http.StatusOK)
+	ts.do(t, "GET", "/api/changes?wait=1s&since="+start.Cursor, nil).expect(t, http.StatusOK).golden(t, "flags")
+
+	ts.do(t, "GET", "/api/changes?since=later", nil).expect(t, http.StatusBadRequest).golden(t, "bad-cursor")
+}
+
+func TestFlagPolling(t *testing.T) {
+	other := newTestServer(t)
+	ts := newTestServer(t) // Shares the database with other, like a second replica
+	poller := newFlagPoller(ts.Server)
+	if err := poller.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cached here before other changes it
+	ts.do(t, "GET", "/api/feature-flags/new_dashboard", nil).expect(t, http.StatusOK)
+
+	enabled := true
+	other.do(t, "POST", "/api/feature-flags", models.CreateFeatureFlagRequest{Key: "live_chat", Name: "Live Chat"}).expect(t, http.StatusCreated)
+	other.do(t, "PATCH", "/api/feature-flags/dark_mode", models.UpdateFeatureFlagRequest{Enabled: &enabled}).expect(t, http.StatusOK)
+	other.do(t, "DELETE", "/api/feature-flags/new_dashboard", nil).expect(t, http.StatusOK)
+	// Already published here when it happened, so the poll leaves it out
+	ts.do(t, "DELETE", "/api/feature-flags/beta_search", nil).expect(t, http.StatusOK)
+	cursor := ts.changes.latest()
+
+	if err := poller.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	events, _, _, _ := ts.changes.since(cursor)
+	got := map[string]string{}
+	for _, event := range events {
+		got[event.Key] = event.Action
+	}
+	want := map[string]string{"live_chat": "created", "dark_mode": "updated", "new_dashboard": "deleted"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changes = %v, want %v", got, want)
+	}
+	ts.do(t, "GET", "/api/feature-flags/new_dashboard", nil).expect(t, http.StatusNotFound)
+}
+
+func TestDeployments(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.do(t, "GET", "/api/deployments", nil).expect(t, http.StatusOK).golden(t, "all")
+	ts.do(t, "GET", "/api/deployments?zone=zone-admin", nil).expect(t, http.StatusOK).golden(t, "zone-admin")
+	ts.do(t, "GET", "/api/deployments?"+listParams("status eq \"success\"", ""), nil).expect(t, http.StatusOK).golden(t, "succeeded")
+}
+
+// TestQueryPlans checks that each index in migrations.go is used by the query it was added for
+// The fixtures are too small for the planner to prefer any index, so each table gets 10,000 rows first
+// Run with -v to see the plans
+func TestQueryPlans(t *testing.T) {
+	resetDatabase(t)
+	for _, statement := range []string{
+		`INSERT INTO users (project_id, email, name, created_at, updated_at)
+			SELECT 1, 'plan' || i || '@example.com', 'Plan ' || i, now() - i * interval '50 minutes', now()
+			FROM generate_series(1, 10000) i`,
+		`INSERT INTO feature_flags (project_id, key, name, enabled, created_at, updated_at)
+			SELECT 1, 'plan_' || i, 'Plan ' || i, i % 2 = 0, now(), now()
+			FROM generate_series(1, 10000) i`,
+		`INSERT INTO deployment_events (zone, source, delivery_id, event_type, created_at)
+			SELECT 'zone-' || i % 5, 'github', 'plan-' || i, 'deployment_status', now() - i * interval '1 minute'
+			FROM generate_series(1, 10000) i`,
+		`ANALYZE users, feature_flags, deployment_events`,
+	} {
+		if err := testDB.Exec(statement).Error; err != nil {
+			t.Fatalf("Failed to fill the tables: %v", err)
+		}
+	}
+
+	for _, c := range []struct {
+		name  string
+		query string // As the API runs it, with its parameters filled in
+		index string
+	}{
+		{"dashboard recent users", `SELECT * FROM users WHERE project_id = 1 ORDER BY created_at DESC LIMIT 5`, "idx_users_created_at"},
+		{"dashboard new users", `SELECT count(*) FROM users WHERE project_id = 1 AND created_at >= now() - interval '7 days'`, "idx_users_created_at"},
+		{"deployments for a zone", `SELECT * FROM deployment_events WHERE zone = 'zone-1' ORDER BY created_at DESC LIMIT 100`, "idx_deployment_events_zone_created_at"},
+		{"enabled flags", `SELECT * FROM feature_flags WHERE project_id = 1 AND enabled = true ORDER BY id LIMIT 50`, "feature_flags_pkey"},
+		{"flag by key", `SELECT * FROM feature_flags WHERE project_id = 1 AND "key" = 'plan_42' ORDER BY id LIMIT 1`, "idx_feature_flags_project_key"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var lines []string
+			if err := testDB.Raw("EXPLAIN " + c.query).Scan(&lines).Error; err != nil {
+				t.Fatalf("EXPLAIN failed: %v", err)
+			}
+			plan := strings.Join(lines, "\n")
+			t.Logf("%s\n%s", c.query, plan)
+			if !strings.Contains(plan, c.index) {
+				t.Errorf("plan doesn't use %s", c.index)
+			}
+		})
+	}
+}
+
+func TestSeed(t *testing.T) {
+	ts := newTestServer(t)
+
+	// alice and bob are already in the fixtures
+	ts.do(t, "POST", "/api/seed", nil).expect(t, http.StatusOK).golden(t, "first")
+	ts.do(t, "POST", "/api/seed", nil).expect(t, http.StatusOK).golden(t, "again")
+}
+
+func TestSeedDocument(t *testing.T) {
+	dir := t.TempDir()
+	ts := newTestServer(t, func(c *Config) { c.Database.SeedDir = dir })
+
+	// alice is in the fixtures with another name, and dark_mode is in them disabled
+	doc := `
+users:
+  - {email: alice@example.com, name: Alice Cooper}
+  - {email: zoe@example.com, name: Zoe Park}
+featureFlags:
+  - {key: dark_mode, name: Dark Mode, enabled: true}
+  - {key: staging_banner, name: Staging Banner, description: Marks the staging environment}
+`
+	ts.do(t, "POST", "/api/seed", doc, "Content-Type", "application/yaml").expect(t, http.StatusOK).golden(t, "applied")
+	ts.do(t, "POST", "/api/seed", doc, "Content-Type", "application/yaml").expect(t, http.StatusOK).golden(t, "again")
+	ts.do(t, "GET", "/api/feature-flags/dark_mode", nil).expect(t, http.StatusOK).golden(t, "dark-mode")
+
+	t.Run("file", func(t *testing.T) {
+		data := `{"featureFlags": [{"key": "dark_mode", "name": "Dark Mode", "enabled": false}]}`
+		if err := os.WriteFile(filepath.Join(dir, "staging.json"), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		ts.do(t, "POST", "/api/seed?file=staging.json", nil).expect(t, http.StatusOK).golden(t, "applied")
+		ts.do(t, "POST", "/api/seed?file=../staging.json", nil).expect(t, http.StatusBadRequest)
+		ts.do(t, "POST", "/api/seed?file=missing.json", nil).expect(t, http.StatusBadRequest)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		invalid := `{"users": [{"email": "not-an-email", "name": "X"}], "featureFlags": [{"key": "a", "name": "A"}, {"key": "a", "name": "B"}]}`
+		ts.do(t, "POST", "/api/v2/seed", invalid).expect(t, http.StatusBadRequest).golden(t, "fields")
+		ts.do(t, "POST", "/api/seed", `{"user": []}`).expect(t, http.StatusBadRequest).golden(t, "unknown-field")
+	})
+}
+
+func TestGenerate(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		ts := newTestServer(t)
+		ts.do(t, "POST", "/api/seed/generate?users=10", nil).expect(t, http.StatusNotFound)
+	})
+
+	ts := newTestServer(t, func(c *Config) {
+		c.Database.SeedGenerateEnabled = true
+		c.Database.SeedGenerateMax = 100
+	})
+
+	ts.do(t, "POST", "/api/seed/generate?users=50&flags=10", nil).expect(t, http.StatusOK).golden(t, "first")
+	// The same seed makes the same records, so only the 20 new users are added
+	ts.do(t, "POST", "/api/seed/generate?users=70&flags=10", nil).expect(t, http.StatusOK).golden(t, "more")
+	ts.do(t, "POST", "/api/seed/generate?users=101", nil).expect(t, http.StatusBadRequest).golden(t, "over-limit")
+	ts.do(t, "POST", "/api/seed/generate", nil).expect(t, http.StatusBadRequest)
+
+	// Generated records pass the same validation as the create endpoints
+	var flags []models.FeatureFlag
+	ts.do(t, "GET", "/api/feature-flags?pageSize=100", nil).expect(t, http.StatusOK).decode(t, &flags)
+	for _, flag := range flags {
+		if problems := validateStruct(models.CreateFeatureFlagRequest{Key: flag.Key, Name: flag.Name, Description: flag.Description}); len(problems) > 0 {
+			t.Errorf("generated flag %s is invalid: %v", flag.Key, problems)
+		}
+	}
+}
+
+func TestDemoReset(t *testing.T) {
+	t.Parallel()
+	cfg := testConfig
+	cfg.Demo.Users = 30
+	cfg.Demo.Flags = 4
+	s := newServer(nil, cfg)
+	store := newDemoStore(time.Now(), s.zones, cfg.Demo)
+	handler, err := s.handler(s.routes(s.mockAPIHandlers(store)), false)
+	if err != nil {
+		t.Fatalf("Failed to build handler: %v", err)
+	}
+	public := httptest.NewServer(handler)
+	t.Cleanup(public.Close)
+	ts := &testServer{Server: s, url: public.URL}
+
+	countUsers := func() int {
+		var users []models.User
+		ts.do(t, "GET", "/api/users?pageSize=100", nil).expect(t, http.StatusOK).decode(t, &users)
+		return len(users)
+	}
+	if n := countUsers(); n != 30 {
+		t.Fatalf("demo store has %d users, want 30", n)
+	}
+
+	// What a visitor might do
+	enabled := false
+	ts.do(t, "PATCH", "/api/feature-flags/show_welcome_banner", models.UpdateFeatureFlagRequest{Enabled: &enabled}).expect(t, http.StatusOK)
+	ts.do(t, "POST", "/api/feature-flags", models.CreateFeatureFlagRequest{Key: "visitor_flag", Name: "Visitor Flag"}).expect(t, http.StatusCreated)
+	ts.do(t, "DELETE", "/api/users/1", nil).expect(t, http.StatusOK)
+
+	cursor := s.changes.latest()
+	s.resetDemo(store, time.Now())
+
+	if n := countUsers(); n != 30 {
+		t.Errorf("after the reset there are %d users, want 30", n)
+	}
+	var flag models.FeatureFlag
+	ts.do(t, "GET", "/api/feature-flags/show_welcome_banner", nil).expect(t, http.StatusOK).decode(t, &flag)
+	if !flag.Enabled {
+		t.Error("show_welcome_banner is still disabled after the reset")
+	}
+	ts.do(t, "GET", "/api/feature-flags/visitor_flag", nil).expect(t, http.StatusNotFound)
+
+	// Only the flags the visitor changed are published
+	events, _, _, _ := s.changes.since(cursor)
+	var got []string
+	for _, event := range events {
+		got = append(got, event.Key+" "+event.Action)
+	}
+	if want := []string{"show_welcome_banner updated", "visitor_flag deleted"}; !slices.Equal(got, want) {
+		t.Errorf("changes = %q, want %q", got, want)
+	}
+}
+
+func TestGitHubWebhook(t *testing.T) {
+	ts := newTestServer(t)
+
+	deliver := func(t *testing.T, event, delivery, body string) response {
+		t.Helper()
+		return ts.do(t, "POST", "/api/webhooks/github", body,
+			"X-GitHub-Event", event,
+			"X-GitHub-Delivery", delivery,
+			"X-Hub-Signature-256", signGitHubPayload(body),
+		)
+	}
+	deployment := `{"action":"created","deployment":{"environment":"zone-main","ref":"main","sha":"f00dfeed","url":"https://github.com/example/deployments/9"},` +
+		`"deployment_status":{"state":"success","target_url":"https://zone-main.example.com"},"sender":{"login":"dave"}}`
+
+	deliver(t, "ping", "ping-1", `{"zen":"Keep it logically awesome."}`).expect(t, http.StatusOK).golden(t, "ping")
+	deliver(t, "deployment_status", "delivery-1", deployment).expect(t, http.StatusAccepted).golden(t, "recorded")
+	deliver(t, "deployment_status", "delivery-1", deployment).expect(t, http.StatusOK).golden(t, "duplicate")
+	deliver(t, "deployment_status", "delivery-2", strings.Replace(deployment, "zone-main", "staging", 1)).
+		expect(t, http.StatusAccepted).golden(t, "unknown-zone")
+	deliver(t, "issues", "delivery-3", `{}`).expect(t, http.StatusAccepted).golden(t, "ignored")
+
+	ts.do(t, "POST", "/api/webhooks/github", deployment,
+		"X-GitHub-Event", "deployment_status",
+		"X-GitHub-Delivery", "delivery-4",
+		"X-Hub-Signature-256", "sha256=00",
+	).expect(t, http.StatusUnauthorized).golden(t, "bad-signature")
+}
+
+func TestUsage(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.do(t, "GET", "/api/usage?from=2024-03-01&to=2024-03-07", nil).expect(t, http.StatusOK).golden(t, "week")
+	ts.do(t, "GET", "/api/usage?from=2024-03-01&to=2024-03-31&route="+url.QueryEscape("GET /api/users"), nil).
+		expect(t, http.StatusOK).golden(t, "route")
+	ts.do(t, "GET", "/api/usage?from=2024-03-07&to=2024-03-01", nil).expect(t, http.StatusBadRequest).golden(t, "reversed")
+}
+
+func TestSLO(t *testing.T) {
+	ts := newTestServer(t)
+
+	// Burn rates count every request this process has served, including earlier tests',
+	// so only the shape and the (empty) api_usage window are compared
+	var report models.SLOReport
+	ts.do(t, "GET", "/api/slo/self", nil).expect(t, http.StatusOK).decode(t, &report)
+	if report.Source != "api_usage" {
+		t.Errorf("source = %q, want api_usage", report.Source)
+	}
+	var names []string
+	for _, objective := range report.Objectives {
+		names = append(names, objective.Name)
+		if objective.Window.Total != 0 {
+			t.Errorf("%s window total = %d, want 0 (fixtures are outside the window)", objective.Name, objective.Window.Total)
+		}
+	}
+	if got := strings.Join(names, ","); got != "availability,latency" {
+		t.Errorf("objectives = %s, want availability,latency", got)
+	}
+}
+
+func TestGraphQL(t *testing.T) {
+	ts := newTestServer(t)
+
+	query := func(t *testing.T, q string) response {
+		t.Helper()
+		return ts.do(t, "POST", "/api/graphql", map[string]string{"query": q}).expect(t, http.StatusOK)
+	}
+
+	query(t, `{ users(limit: 3) { id email name } featureFlags { key enabled } zones { name status message } }`).golden(t, "query")
+	query(t, `{ user(id: "2") { email } featureFlag(key: "dark_mode") { name enabled } }`).golden(t, "lookup")
+	query(t, `mutation { updateFeatureFlag(key: "dark_mode", input: {enabled: true}) { key enabled } }`).golden(t, "mutation")
+	ts.do(t, "GET", "/api/feature-flags/dark_mode", nil).expect(t, http.StatusOK).golden(t, "after-mutation")
+}
+
+// listParams encodes ?filter= and ?orderby= (either may be empty)
+func listParams(filter, orderby string) string {
+	values := url.Values{}
+	if filter != "" {
+		values.Set("filter", filter)
+	}
+	if orderby != "" {
+		values.Set("orderby", orderby)
+	}
+	return values.Encode()
+}
+
+// signGitHubPayload returns the X-Hub-Signature-256 header GitHub would send for body
+func signGitHubPayload(body string) string {
+	mac := hmac.New(sha256.New, []byte(testWebhookSecret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestAPIToken(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) { c.API.Token = "test-token" })
+
+	// Reads stay open
+	ts.do(t, "GET", "/api/feature-flags", nil).expect(t, http.StatusOK)
+
+	flag := models.CreateFeatureFlagRequest{Key: "token_test", Name: "Token Test", Enabled: true}
+	ts.do(t, "POST", "/api/feature-flags", flag).expect(t, http.StatusUnauthorized)
+	ts.do(t, "POST", "/api/v2/feature-flags", flag, "Authorization", "Bearer wrong").
+		expect(t, http.StatusUnauthorized).golden(t, "v2-wrong-token")
+	ts.do(t, "POST", "/api/feature-flags", flag, "Authorization", "Bearer test-token").expect(t, http.StatusCreated)
+
+	// GraphQL over POST can carry mutations
+	ts.do(t, "POST", "/api/graphql", map[string]any{"query": "{ featureFlags { key } }"}).expect(t, http.StatusUnauthorized)
+}
+
+func TestAdminToken(t *testing.T) {
+	bucket := newFakeS3(t)
+	ts := newTestServer(t, func(c *Config) {
+		c.API.Token = "test-token"
+		c.Email.Provider = "sendgrid"
+		c.Email.From = "Backend <noreply@example.com>"
+		c.Email.SendGridAPIKey = "sendgrid-key"
+		c.Newsletter.ConfirmURL = "https://example.com/newsletter/confirm"
+		c.Newsletter.UnsubscribeURL = "https://example.com/newsletter/unsubscribe"
+		c.Uploads.S3Endpoint = strings.TrimPrefix(bucket.URL, "http://")
+		c.Uploads.S3Insecure = true
+		c.Uploads.S3Bucket = "uploads"
+		c.Uploads.S3AccessKey = "access-key"
+		c.Uploads.S3SecretKey = "secret-key"
+	})
+
+	// Visitors' addresses and messages aren't for the zones to read, so reads need the token too
+	for _, read := range []struct {
+		path   string
+		accept string
+		status int // With the token
+	}{
+		{"/api/emails", "", http.StatusOK},
+		{"/api/emails/99", "", http.StatusNotFound},
+		{"/api/email-suppressions", "", http.StatusOK},
+		{"/api/contact/submissions", "", http.StatusOK},
+		{"/api/contact/submissions/99", "", http.StatusNotFound},
+		{"/api/newsletter/subscriptions", "", http.StatusOK},
+		{"/api/newsletter/subscriptions", csvContentType, http.StatusOK},
+		{"/api/feedback", "", http.StatusOK},
+		{"/api/feedback", csvContentType, http.StatusOK},
+		{"/api/feedback/99", "", http.StatusNotFound},
+		// Upload IDs are sequential, so files are only public by their unguessable key
+		{"/api/uploads", "", http.StatusOK},
+		{"/api/uploads/99", "", http.StatusNotFound},
+		{"/api/uploads/99/download", "", http.StatusNotFound},
+		// User events name users and their addresses
+		{"/api/activity", "", http.StatusOK},
+		// Bundles hold the whole configuration
+		{"/api/export/bundle", "", http.StatusOK},
+		// Survey responses carry user IDs and what they wrote
+		{"/api/surveys/nps_q4/responses", "", http.StatusNotFound},
+	} {
+		ts.do(t, "GET", read.path, nil, "Accept", read.accept).expect(t, http.StatusUnauthorized)
+		ts.do(t, "GET", read.path, nil, "Accept", read.accept, "Authorization", "Bearer test-token").expect(t, read.status)
+	}
+	ts.do(t, "GET", "/api/files/0123456789abcdef0123456789abcdef/report.pdf", nil).expect(t, http.StatusNotFound)
+}
+
+func TestZoneProxy(t *testing.T) {
+	var proxied http.Header
+	zone := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.Header.Clone()
+		fmt.Fprint(w, r.Method+" "+r.URL.Path)
+	}))
+	defer zone.Close()
+	ts := newTestServer(t, func(c *Config) {
+		c.Zones.MainURL = zone.URL
+		c.Zones.GatewayMode = true
+		c.Zones.ProxyToken = "zone-secret"
+		c.API.Token = "test-token"
+	})
+
+	// Anonymous requests never reach the zone, reads included
+	for _, method := range []string{"GET", "POST", "DELETE"} {
+		ts.do(t, method, "/api/zones/zone-main/proxy/api/internal", nil).expect(t, http.StatusUnauthorized)
+	}
+	if proxied != nil {
+		t.Fatalf("the zone got an anonymous request: %v", proxied)
+	}
+
+	got := ts.do(t, "POST", "/api/zones/zone-main/proxy/api/internal", nil, "Authorization", "Bearer test-token").expect(t, http.StatusOK)
+	if string(got.body) != "POST /api/internal" {
+		t.Errorf("proxied to %q", got.body)
+	}
+	if proxied.Get("X-Backend-Proxy-Token") != "zone-secret" || proxied.Get("Authorization") != "" {
+		t.Errorf("zone got X-Backend-Proxy-Token %q and Authorization %q", proxied.Get("X-Backend-Proxy-Token"), proxied.Get("Authorization"))
+	}
+
+	// Encoded dot segments can't climb out of the zone's base path
+	proxied = nil
+	for _, path := range []string{"/api/zones/zone-main/proxy/api%2F..%2F..%2Fsecret", "/api/zones/zone-main/proxy/%2E%2E/secret"} {
+		ts.do(t, "GET", path, nil, "Authorization", "Bearer test-token").expect(t, http.StatusBadRequest)
+	}
+	if proxied != nil {
+		t.Errorf("the zone got a request out of its base path: %v", proxied)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) {
+		c.API.RateLimitRPS = 0.001 // No refill during the test
+		c.API.RateLimitBurst = 3
+	})
+
+	for i := 0; i < 3; i++ {
+		ts.do(t, "GET", "/api/feature-flags", nil).expect(t, http.StatusOK)
+	}
+	limited := ts.do(t, "GET", "/api/v2/feature-flags", nil).expect(t, http.StatusTooManyRequests)
+	if got := limited.header.Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+	limited.golden(t, "v2-limited")
+
+	// Only /api is limited
+	ts.do(t, "GET", "/health", nil).expect(t, http.StatusOK)
+
+	// X-Forwarded-For is ignored from an untrusted peer, so it can't buy a fresh budget
+	ts.do(t, "GET", "/api/feature-flags", nil, "X-Forwarded-For", "203.0.113.7").expect(t, http.StatusTooManyRequests)
+}
+
+func TestRateLimitBehindProxy(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) {
+		c.API.RateLimitRPS = 0.001
+		c.API.RateLimitBurst = 2
+		c.Server.TrustedProxies = []string{"127.0.0.0/8", "10.0.0.0/8"}
+	})
+
+	// Each client behind the proxy gets its own budget; hops through trusted proxies are skipped
+	for _, forwarded := range []string{"203.0.113.7", "198.51.100.1, 203.0.113.8, 10.0.0.2"} {
+		for i := 0; i < 2; i++ {
+			ts.do(t, "GET", "/api/feature-flags", nil, "X-Forwarded-For", forwarded).expect(t, http.StatusOK)
+		}
+		ts.do(t, "GET", "/api/feature-flags", nil, "X-Forwarded-For", forwarded).expect(t, http.StatusTooManyRequests)
+	}
+	// A client can prepend whatever it likes, but the proxy appends the address it saw
+	ts.do(t, "GET", "/api/feature-flags", nil, "X-Forwarded-For", "192.0.2.1, 203.0.113.7").expect(t, http.StatusTooManyRequests)
+}
+
+func TestRateLimitReload(t *testing.T) {
+	ts := newTestServer(t)
+	for i := 0; i < 3; i++ {
+		ts.do(t, "GET", "/api/feature-flags", nil).expect(t, http.StatusOK)
+	}
+
+	// Switched on by a reload, with no restart
+	cfg := ts.config
+	cfg.API.RateLimitRPS = 0.001
+	cfg.API.RateLimitBurst = 1
+	ts.live.store(cfg)
+	ts.do(t, "GET", "/api/feature-flags", nil).expect(t, http.StatusOK)
+	ts.do(t, "GET", "/api/feature-flags", nil).expect(t, http.StatusTooManyRequests)
+
+	var got runtimeConfigResponse
+	ts.doInternal(t, "GET", "/internal/config", nil).expect(t, http.StatusOK).decode(t, &got)
+	for _, setting := range got.Settings {
+		if setting.Env == "RATE_LIMIT_BURST" && (setting.Value != 1.0 || !setting.Reloadable) {
+			t.Errorf("RATE_LIMIT_BURST = %+v, want the reloaded 1", setting)
+		}
+	}
+
+	// And off again
+	ts.live.store(ts.config)
+	ts.do(t, "GET", "/api/feature-flags", nil).expect(t, http.StatusOK)
+}
+
+func TestBasePath(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) { c.Server.BasePath = "/backend" })
+
+	ts.do(t, "GET", "/backend/health", nil).expect(t, http.StatusOK)
+	ts.do(t, "GET", "/backend/dashboard/", nil).expect(t, http.StatusOK)
+	ts.do(t, "GET", "/api/feature-flags", nil).expect(t, http.StatusNotFound)
+
+	// Links and pagination point back under the base path
+	ts.do(t, "GET", "/backend/api/v2/feature-flags?pageSize=2", nil).expect(t, http.StatusOK).golden(t, "v2-flags")
+	page := ts.do(t, "GET", "/backend/api/users?pageSize=2", nil).expect(t, http.StatusOK)
+	if got := page.header.Get("Link"); !strings.HasPrefix(got, "</backend/api/users?") {
+		t.Errorf("Link = %q, want a link under /backend/api/users", got)
+	}
+
+	// The internal listener isn't behind the ingress, so it keeps its paths
+	ts.doInternal(t, "GET", "/readyz", nil).expect(t, http.StatusOK)
+
+	// Probes stay out of the usage report under the base path too
+	if sloCounted("GET", "/backend/health", ts.config.Server.BasePath) {
+		t.Error("/backend/health is counted in usage and SLOs")
+	}
+}
+
+// webhookRequest is a delivery as the receiving end saw it
+type webhookRequest struct {
+	event, signature string
+	body             []byte
+}
+
+// runLeaderTask runs task (e.g. the job queue) until the test ends, as the leader would
+func runLeaderTask(t *testing.T, task func(context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		task(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// waitForWebhookDeliveries polls a subscription's delivery log until none of its newest
+// count deliveries is pending, and returns them
+func waitForWebhookDeliveries(t *testing.T, ts *testServer, path string, count int) []models.WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var deliveries []models.WebhookDelivery
+		ts.do(t, "GET", fmt.Sprintf("%s/deliveries?pageSize=%d", path, count), nil).expect(t, http.StatusOK).decode(t, &deliveries)
+		if len(deliveries) == count && !slices.ContainsFunc(deliveries, func(d models.WebhookDelivery) bool { return d.Status == "pending" }) {
+			return deliveries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deliveries = %+v, want %d finished", deliveries, count)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// receiveWebhook waits for the next delivery to arrive at a test target
+func receiveWebhook(t *testing.T, received <-chan webhookRequest) webhookRequest {
+	t.Helper()
+	select {
+	case request := <-received:
+		return request
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook delivery arrived")
+		return webhookRequest{}
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) {
+		c.Jobs.PollInterval = 10 * time.Millisecond
+		c.Webhooks.RetryBackoff = 10 * time.Millisecond
+		c.Webhooks.MaxAttempts = 3
+	})
+	runLeaderTask(t, ts.jobs.run)
+
+	// The target fails the first delivery, so it is retried
+	received := make(chan webhookRequest, 10)
+	var failures atomic.Int32
+	failures.Store(1)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if failures.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		received <- webhookRequest{event: r.Header.Get(webhookEventHeader), signature: r.Header.Get(webhookSignatureHeader), body: body}
+	}))
+	t.Cleanup(target.Close)
+
+	ts.do(t, "POST", "/api/webhook-subscriptions", models.CreateWebhookSubscriptionRequest{URL: "ftp://example.com", Events: []string{"flag.renamed"}}).
+		expect(t, http.StatusBadRequest).golden(t, "invalid")
+
+	const secret = "webhook-test-secret-0123"
+	var subscription models.WebhookSubscriptionCreated
+	created := ts.do(t, "POST", "/api/webhook-subscriptions", models.CreateWebhookSubscriptionRequest{
+		URL: target.URL, Events: []string{"flag.updated", "user.created", "zone.incident"}, Secret: secret,
+	}).expect(t, http.StatusCreated)
+	created.decode(t, &subscription)
+	if subscription.Secret != secret || !subscription.Enabled {
+		t.Fatalf("created subscription = %+v", subscription)
+	}
+	path := created.header.Get("Location")
+	if path != fmt.Sprintf("/api/webhook-subscriptions/%d", subscription.ID) {
+		t.Fatalf("Location = %q", path)
+	}
+	// The secret is only shown once
+	if body := string(ts.do(t, "GET", path, nil).expect(t, http.StatusOK).body); strings.Contains(body, secret) {
+		t.Errorf("GET %s shows the secret: %s", path, body)
+	}
+
+	// Not subscribed to flag.created, so only the update is delivered
+	ts.do(t, "POST", "/api/feature-flags", models.CreateFeatureFlagRequest{Key: "webhook_test", Name: "Webhook Test"}).expect(t, http.StatusCreated)
+	enabled := true
+	ts.do(t, "PATCH", "/api/feature-flags/webhook_test", models.UpdateFeatureFlagRequest{Enabled: &enabled}).expect(t, http.StatusOK)
+	delivery := receiveWebhook(t, received)
+	if delivery.event != "flag.updated" {
+		t.Errorf("event = %q, want flag.updated", delivery.event)
+	}
+	if want := signWebhookPayload(secret, delivery.body); delivery.signature != want {
+		t.Errorf("signature = %q, want %q", delivery.signature, want)
+	}
+	var event struct {
+		models.WebhookEvent
+		Data models.FeatureFlag `json:"data"`
+	}
+	if err := json.Unmarshal(delivery.body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != "flag.updated" || event.Data.Key != "webhook_test" || !event.Data.Enabled {
+		t.Errorf("payload = %s", delivery.body)
+	}
+
+	ts.do(t, "POST", "/api/users", models.CreateUserRequest{Email: "hook@example.com", Name: "Hook"}).expect(t, http.StatusCreated)
+	if delivery := receiveWebhook(t, received); delivery.event != "user.created" || !strings.Contains(string(delivery.body), "hook@example.com") {
+		t.Errorf("delivery = %s %s, want user.created", delivery.event, delivery.body)
+	}
+
+	// Zone incidents: a zone that stops being healthy
+	ts.changes.observeZoneStatus(models.ZoneStatus{Name: "zone-main", Status: "healthy"})
+	ts.changes.observeZoneStatus(models.ZoneStatus{Name: "zone-main", Status: "unhealthy", Message: "connection refused"})
+	if delivery := receiveWebhook(t, received); delivery.event != "zone.incident" || !strings.Contains(string(delivery.body), `"previousStatus":"healthy"`) {
+		t.Errorf("delivery = %s %s, want zone.incident", delivery.event, delivery.body)
+	}
+
+	// The delivery log, newest first; the first delivery took two attempts
+	deliveries := waitForWebhookDeliveries(t, ts, path, 3)
+	for _, d := range deliveries {
+		if d.Status != "delivered" {
+			t.Errorf("delivery %d (%s) is %s: %s", d.ID, d.Event, d.Status, d.Error)
+		}
+	}
+	if first := deliveries[2]; first.Event != "flag.updated" || first.Attempts != 2 || first.ResponseStatus != http.StatusOK {
+		t.Errorf("first delivery = %+v, want flag.updated delivered on the second attempt", first)
+	}
+	ts.do(t, "GET", path+"/deliveries?filter="+url.QueryEscape(`event eq "user.created"`), nil).expect(t, http.StatusOK).decode(t, &deliveries)
+	if len(deliveries) != 1 {
+		t.Errorf("got %d user.created deliveries, want 1", len(deliveries))
+	}
+
+	// A target that never answers 2xx runs out of attempts
+	failures.Store(100)
+	ts.do(t, "DELETE", "/api/users/1", nil).expect(t, http.StatusOK) // Not subscribed
+	ts.do(t, "PATCH", "/api/feature-flags/webhook_test", models.UpdateFeatureFlagRequest{Enabled: new(bool)}).expect(t, http.StatusOK)
+	if d := waitForWebhookDeliveries(t, ts, path, 1)[0]; d.Status != "failed" || d.Attempts != 3 || d.ResponseStatus != http.StatusServiceUnavailable || d.Error == "" {
+		t.Errorf("last delivery = %+v, want failed after 3 attempts answered 503", d)
+	}
+
+	ts.do(t, "DELETE", path, nil).expect(t, http.StatusOK)
+	ts.do(t, "GET", path, nil).expect(t, http.StatusNotFound)
+	ts.do(t, "GET", "/api/webhook-subscriptions/abc", nil).expect(t, http.StatusNotFound)
+}
+
+const testSlackSecret = "slack-signing-secret"
+
+// slackCommand sends a slash command from user, signed the way Slack signs it
+func slackCommand(t *testing.T, ts *testServer, user, command, text string) response {
+	t.Helper()
+	body := url.Values{"command": {command}, "text": {text}, "user_id": {user}}.Encode()
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(testSlackSecret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	return ts.do(t, "POST", "/api/slack/commands", body,
+		"Content-Type", "application/x-www-form-urlencoded",
+		"X-Slack-Request-Timestamp", timestamp,
+		"X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)),
+	)
+}
+
+func TestSlack(t *testing.T) {
+	posted := make(chan string, 10)
+	channel := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message struct{ Text string }
+		json.NewDecoder(r.Body).Decode(&message)
+		posted <- message.Text
+	}))
+	defer channel.Close()
+	ts := newTestServer(t, func(c *Config) {
+		c.Slack.SigningSecret = testSlackSecret
+		c.Slack.WebhookURL = channel.URL
+		c.Slack.AllowedUsers = []string{"U100", "U200"}
+	})
+
+	slackCommand(t, ts, "U100", "/flags", "toggle dark_mode").expect(t, http.StatusOK).golden(t, "toggle")
+	var flag models.FeatureFlag
+	ts.do(t, "GET", "/api/feature-flags/dark_mode", nil).expect(t, http.StatusOK).decode(t, &flag)
+	if !flag.Enabled {
+		t.Error("dark_mode is still off after /flags toggle")
+	}
+	slackCommand(t, ts, "U100", "/flags", "toggle missing_flag").expect(t, http.StatusOK).golden(t, "unknown-flag")
+	slackCommand(t, ts, "U100", "/flags", "list").expect(t, http.StatusOK).golden(t, "usage")
+	slackCommand(t, ts, "U200", "/zones", "status").expect(t, http.StatusOK).golden(t, "zones")
+	slackCommand(t, ts, "U300", "/flags", "toggle dark_mode").expect(t, http.StatusOK).golden(t, "not-allowed")
+
+	// Unsigned and replayed commands
+	ts.do(t, "POST", "/api/slack/commands", "command=/zones&text=status",
+		"X-Slack-Request-Timestamp", strconv.FormatInt(time.Now().Unix(), 10),
+		"X-Slack-Signature", "v0=00",
+	).expect(t, http.StatusUnauthorized).golden(t, "bad-signature")
+	if validSlackSignature(testSlackSecret, "1700000000", nil, "", time.Unix(1700000000, 0).Add(10*time.Minute)) {
+		t.Error("a 10 minute old request was accepted")
+	}
+
+	// Incidents and recoveries are posted to the channel; degraded to unhealthy isn't
+	ts.changes.observeZoneStatus(models.ZoneStatus{Name: "zone-main", Status: "healthy"})
+	ts.changes.observeZoneStatus(models.ZoneStatus{Name: "zone-main", Status: "degraded", Message: "HTTP 503"})
+	ts.changes.observeZoneStatus(models.ZoneStatus{Name: "zone-main", Status: "unhealthy", Message: "connection refused"})
+	ts.changes.observeZoneStatus(models.ZoneStatus{Name: "zone-main", Status: "healthy"})
+	want := []string{
+		":large_green_circle: *zone-main* has recovered (was unhealthy)",
+		":large_yellow_circle: *zone-main* is degraded (was healthy): HTTP 503",
+	}
+	var got []string
+	for len(got) < len(want) {
+		select {
+		case text := <-posted:
+			got = append(got, text)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("posted %q, want %q", got, want)
+		}
+	}
+	slices.Sort(got) // Each is posted in the background, in no particular order
+	if !slices.Equal(got, want) {
+		t.Errorf("posted %q, want %q", got, want)
+	}
+}
+
+// sendGridRequest is a message as the fake SendGrid API received it
+type sendGridRequest struct {
+	to, subject, text, html string
+}
+
+// waitForEmail polls the send log until message is no longer pending, and returns it
+func waitForEmail(t *testing.T, ts *testServer, message models.EmailMessage) models.EmailMessage {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ts.do(t, "GET", fmt.Sprintf("/api/emails/%d", message.ID), nil).expect(t, http.StatusOK).decode(t, &message)
+		if message.Status != "pending" {
+			return message
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("email %d is still pending: %s", message.ID, message.Error)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestEmail(t *testing.T) {
+	received := make(chan sendGridRequest, 10)
+	var retried atomic.Bool
+	sendGrid := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v3/mail/send" || r.Header.Get("Authorization") != "Bearer sendgrid-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body struct {
+			Personalizations []struct{ To []struct{ Email string } }
+			Subject          string
+			Content          []struct{ Value string }
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		to := body.Personalizations[0].To[0].Email
+		switch {
+		case to == "flaky@example.com" && !retried.Swap(true):
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		case to == "invalid@example.com":
+			http.Error(w, `{"errors":[{"message":"Does not contain a valid address."}]}`, http.StatusBadRequest)
+			return
+		}
+		received <- sendGridRequest{to: to, subject: body.Subject, text: body.Content[0].Value, html: body.Content[1].Value}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer sendGrid.Close()
+	ts := newTestServer(t, func(c *Config) {
+		c.Email.Provider = "sendgrid"
+		c.Email.From = "Backend <noreply@example.com>"
+		c.Email.SendGridAPIKey = "sendgrid-key"
+		c.Email.SendGridURL = sendGrid.URL
+		c.Email.RetryBackoff = 10 * time.Millisecond
+		c.Jobs.PollInterval = 10 * time.Millisecond
+		c.Email.AlertRecipients = []string{"oncall@example.com"}
+	})
+	runLeaderTask(t, ts.jobs.run)
+	send := func(t *testing.T, to string) models.EmailMessage {
+		t.Helper()
+		var message models.EmailMessage
+		ts.do(t, "POST", "/api/emails", models.SendEmailRequest{
+			Template: "invitation",
+			To:       to,
+			Data:     map[string]string{"inviter": "Ada <admin>", "url": "https://admin.example.com/invite/1"},
+		}).expect(t, http.StatusAccepted).decode(t, &message)
+		return message
+	}
+
+	ts.do(t, "POST", "/api/emails", models.SendEmailRequest{Template: "welcome", To: "nobody"}).
+		expect(t, http.StatusBadRequest).golden(t, "invalid")
+	ts.do(t, "POST", "/api/emails", models.SendEmailRequest{Template: "password-reset", To: "ada@example.com", Data: map[string]string{"url": "x"}}).
+		expect(t, http.StatusBadRequest).golden(t, "missing-data")
+
+	// Rendered from the template; the HTML part escapes the data
+	message := send(t, "Ada@Example.com")
+	if message = waitForEmail(t, ts, message); message.Status != "sent" || message.Attempts != 1 {
+		t.Errorf("email = %s after %d attempts (%s), want sent after 1", message.Status, message.Attempts, message.Error)
+	}
+	email := <-received
+	if email.to != "ada@example.com" || email.subject != "Ada <admin> invited you to the admin dashboard" {
+		t.Errorf("sent %q to %s", email.subject, email.to)
+	}
+	if !strings.Contains(email.text, "Accept the invitation: https://admin.example.com/invite/1") ||
+		!strings.Contains(email.html, "<p>Ada &lt;admin&gt; invited you") {
+		t.Errorf("text = %q, html = %q", email.text, email.html)
+	}
+
+	// Server errors are retried; requests SendGrid refuses aren't
+	if message = waitForEmail(t, ts, send(t, "flaky@example.com")); message.Status != "sent" || message.Attempts != 2 {
+		t.Errorf("flaky email = %s after %d attempts, want sent after 2", message.Status, message.Attempts)
+	}
+	<-received
+	if message = waitForEmail(t, ts, send(t, "invalid@example.com")); message.Status != "failed" || message.Attempts != 1 {
+		t.Errorf("invalid email = %s after %d attempts, want failed after 1", message.Status, message.Attempts)
+	}
+
+	// Suppressed addresses aren't sent to
+	suppression := models.CreateEmailSuppressionRequest{Email: "Gone@example.com", Reason: "unsubscribe"}
+	ts.do(t, "POST", "/api/email-suppressions", suppression).expect(t, http.StatusCreated).golden(t, "suppressed")
+	ts.do(t, "POST", "/api/email-suppressions", suppression).expect(t, http.StatusConflict)
+	if message = waitForEmail(t, ts, send(t, "gone@example.com")); message.Status != "suppressed" || message.Attempts != 0 {
+		t.Errorf("suppressed email = %s after %d attempts, want suppressed", message.Status, message.Attempts)
+	}
+	ts.do(t, "GET", "/api/email-suppressions", nil).expect(t, http.StatusOK).golden(t, "suppressions")
+	ts.do(t, "DELETE", "/api/email-suppressions/gone@example.com", nil).expect(t, http.StatusOK)
+	ts.do(t, "DELETE", "/api/email-suppressions/gone@example.com", nil).expect(t, http.StatusNotFound)
+
+	// Zone incidents are emailed to EMAIL_ALERT_RECIPIENTS
+	ts.changes.observeZoneStatus(models.ZoneStatus{Name: "zone-main", Status: "healthy"})
+	ts.changes.observeZoneStatus(models.ZoneStatus{Name: "zone-main", Status: "unhealthy", Message: "connection refused"})
+	select {
+	case email := <-received:
+		if email.to != "oncall@example.com" || email.subject != "[Alert] zone-main is unhealthy" {
+			t.Errorf("sent %q to %s, want the zone alert", email.subject, email.to)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no zone alert was sent")
+	}
+
+	// The send log, newest first
+	waitForEmail(t, ts, models.EmailMessage{ID: 5})
+	ts.do(t, "GET", "/api/emails?filter="+url.QueryEscape(`status ne "sent"`), nil).expect(t, http.StatusOK).golden(t, "log")
+	ts.do(t, "GET", "/api/emails/99", nil).expect(t, http.StatusNotFound)
+}
+
+// waitForJob polls a job until it has succeeded or is dead, and returns it
+func waitForJob(t *testing.T, ts *testServer, id uint) models.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var job models.Job
+		ts.do(t, "GET", fmt.Sprintf("/api/jobs/%d", id), nil).expect(t, http.StatusOK).decode(t, &job)
+		if job.Status == "succeeded" || job.Status == "dead" {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %d is still %s: %s", id, job.Status, job.LastError)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) {
+		c.Jobs.PollInterval = 10 * time.Millisecond
+	})
+	// Fails until fixed is set, and for good on a poison payload
+	var fixed atomic.Bool
+	ts.jobs.register("test.job", jobWorker{
+		run: func(ctx context.Context, job models.Job) error {
+			var payload struct {
+				Name string `json:"name"`
+			}
+			if err := decodeJobPayload(job, &payload); err != nil {
+				return err
+			}
+			switch {
+			case payload.Name == "poison":
+				return permanent(errors.New("poison payload"))
+			case !fixed.Load():
+				return errors.New("not fixed yet")
+			}
+			return nil
+		},
+		maxAttempts: 3,
+		backoff:     10 * time.Millisecond,
+		concurrency: 1,
+	})
+	runLeaderTask(t, ts.jobs.run)
+	for _, name := range []string{"flaky", "poison"} {
+		if err := ts.jobs.enqueue(testDB, "test.job", map[string]string{"name": name}); err != nil {
+			t.Fatalf("Failed to queue %s: %v", name, err)
+		}
+	}
+	ts.jobs.notify("test.job")
+	if err := ts.jobs.enqueue(testDB, "test.unknown", nil); err == nil {
+		t.Error("queued a job nobody runs")
+	}
+
+	// Retried until out of attempts, or dead right away
+	if job := waitForJob(t, ts, 1); job.Status != "dead" || job.Attempts != 3 {
+		t.Errorf("flaky job = %s after %d attempts, want dead after 3", job.Status, job.Attempts)
+	}
+	if job := waitForJob(t, ts, 2); job.Status != "dead" || job.Attempts != 1 {
+		t.Errorf("poison job = %s after %d attempts, want dead after 1", job.Status, job.Attempts)
+	}
+	ts.do(t, "GET", "/api/jobs?filter="+url.QueryEscape(`status eq "dead"`), nil).expect(t, http.StatusOK).golden(t, "dead")
+
+	// A retried dead letter gets all of its attempts again
+	fixed.Store(true)
+	ts.do(t, "POST", "/api/jobs/1/retry", nil).expect(t, http.StatusOK)
+	if job := waitForJob(t, ts, 1); job.Status != "succeeded" || job.Attempts != 1 {
+		t.Errorf("retried job = %s after %d attempts, want succeeded after 1", job.Status, job.Attempts)
+	}
+	ts.do(t, "POST", "/api/jobs/1/retry", nil).expect(t, http.StatusConflict).golden(t, "not-dead")
+	ts.do(t, "POST", "/api/jobs/99/retry", nil).expect(t, http.StatusNotFound)
+
+	// Only dead letters can be deleted
+	ts.do(t, "DELETE", "/api/jobs/1", nil).expect(t, http.StatusConflict)
+	ts.do(t, "DELETE", "/api/jobs/2", nil).expect(t, http.StatusOK)
+	ts.do(t, "GET", "/api/jobs/2", nil).expect(t, http.StatusNotFound)
+}
+
+// waitForScheduleRun polls a schedule's runs until one newer than run after has finished
+func waitForScheduleRun(t *testing.T, ts *testServer, scheduleID, after uint) models.ScheduleRun {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var runs []models.ScheduleRun
+		ts.do(t, "GET", fmt.Sprintf("/api/schedules/%d/runs?pageSize=1", scheduleID), nil).expect(t, http.StatusOK).decode(t, &runs)
+		if len(runs) > 0 && runs[0].ID > after && (runs[0].Status == "succeeded" || runs[0].Status == "failed") {
+			return runs[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("schedule %d has no finished run: %+v", scheduleID, runs)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestSchedules(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) {
+		c.Jobs.PollInterval = 10 * time.Millisecond
+	})
+	runLeaderTask(t, ts.jobs.run)
+
+	// The retention cleanups are built in, and can't be deleted
+	ts.do(t, "GET", "/api/schedules", nil).expect(t, http.StatusOK).golden(t, "builtins")
+	ts.do(t, "DELETE", "/api/schedules/1", nil).expect(t, http.StatusConflict)
+	ts.do(t, "POST", "/api/schedules/1/run", nil).expect(t, http.StatusAccepted)
+	if run := waitForScheduleRun(t, ts, 1, 0); run.Status != "succeeded" || run.Trigger != "manual" {
+		t.Errorf("cleanup run = %s (%s): %s, want a succeeded manual run", run.Status, run.Trigger, run.Error)
+	}
+
+	ts.do(t, "POST", "/api/schedules", `{"name": "Nightly!", "cron": "61 * * * *", "task": "flag.delete"}`).
+		expect(t, http.StatusBadRequest).golden(t, "invalid")
+	ts.do(t, "POST", "/api/schedules", `{"name": "dark-mode-on", "cron": "@daily", "task": "flag.set", "params": {"key": "dark_mode", "on": true}}`).
+		expect(t, http.StatusBadRequest).golden(t, "invalid-params")
+
+	// Run now turns the flag on without waiting for Monday
+	var schedule models.Schedule
+	ts.do(t, "POST", "/api/schedules", `{"name": "dark-mode-on", "cron": "0 9 * * 1", "task": "flag.set", "params": {"key": "dark_mode", "enabled": true}}`).
+		expect(t, http.StatusCreated).decode(t, &schedule)
+	ts.do(t, "POST", "/api/schedules", `{"name": "dark-mode-on", "cron": "@daily", "task": "zones.check"}`).expect(t, http.StatusConflict)
+	ts.do(t, "POST", fmt.Sprintf("/api/schedules/%d/run", schedule.ID), nil).expect(t, http.StatusAccepted)
+	manual := waitForScheduleRun(t, ts, schedule.ID, 0)
+	if manual.Status != "succeeded" || manual.Output != "Turned dark_mode on" {
+		t.Errorf("flag.set run = %s %q: %s", manual.Status, manual.Output, manual.Error)
+	}
+	var flag models.FeatureFlag
+	ts.do(t, "GET", "/api/feature-flags/dark_mode", nil).expect(t, http.StatusOK).decode(t, &flag)
+	if !flag.Enabled {
+		t.Error("dark_mode is still off after the schedule ran")
+	}
+
+	// The scheduler starts due schedules on its own; a failed task is recorded, not retried
+	runLeaderTask(t, ts.scheduler.run)
+	ts.do(t, "PATCH", fmt.Sprintf("/api/schedules/%d", schedule.ID), `{"cron": "@every 1s", "params": {"key": "no_such_flag", "enabled": false}}`).
+		expect(t, http.StatusOK)
+	run := waitForScheduleRun(t, ts, schedule.ID, manual.ID)
+	if run.Status != "failed" || run.Trigger != "cron" || run.Error != "no feature flag named no_such_flag" {
+		t.Errorf("cron run = %s (%s): %q, want a failed cron run", run.Status, run.Trigger, run.Error)
+	}
+
+	// Disabled schedules have no next run; deleting one deletes its runs
+	var disabled models.Schedule
+	ts.do(t, "PATCH", fmt.Sprintf("/api/schedules/%d", schedule.ID), `{"enabled": false}`).expect(t, http.StatusOK).decode(t, &disabled)
+	if disabled.NextRunAt != nil {
+		t.Errorf("disabled schedule runs next at %s", disabled.NextRunAt)
+	}
+	ts.do(t, "DELETE", fmt.Sprintf("/api/schedules/%d", schedule.ID), nil).expect(t, http.StatusOK)
+	ts.do(t, "GET", fmt.Sprintf("/api/schedules/%d/runs", schedule.ID), nil).expect(t, http.StatusNotFound)
+}
+
+func TestAnnouncements(t *testing.T) {
+	ts := newTestServer(t)
+	now := time.Now().UTC()
+	hour := func(n int) string { return now.Add(time.Duration(n) * time.Hour).Format(time.RFC3339) }
+
+	ts.do(t, "POST", "/api/announcements", `{"message": "", "severity": "urgent"}`).
+		expect(t, http.StatusBadRequest).golden(t, "invalid")
+	ts.do(t, "POST", "/api/announcements", fmt.Sprintf(`{"message": "Hi", "zones": ["zone-shop"], "startsAt": %q, "endsAt": %q}`, hour(1), hour(-1))).
+		expect(t, http.StatusBadRequest).golden(t, "invalid-zone")
+
+	for _, body := range []string{
+		`{"message": "Welcome to the new dashboard!", "zones": ["zone-main"], "dismissible": true}`,
+		fmt.Sprintf(`{"message": "Admin is down for maintenance", "severity": "critical", "zones": ["zone-admin"], "endsAt": %q}`, hour(1)),
+		fmt.Sprintf(`{"message": "Search is slow", "severity": "warning", "startsAt": %q}`, hour(-1)),
+		fmt.Sprintf(`{"message": "Tomorrow's maintenance", "startsAt": %q}`, hour(24)),
+		fmt.Sprintf(`{"message": "Yesterday's outage", "severity": "critical", "endsAt": %q}`, hour(-1)),
+	} {
+		ts.do(t, "POST", "/api/announcements", body).expect(t, http.StatusCreated)
+	}
+
+	// Only those running now and shown in the zone, the most severe first
+	ts.do(t, "GET", "/api/announcements/active?zone=zone-main", nil).expect(t, http.StatusOK).golden(t, "active-main")
+	var active []models.Announcement
+	ts.do(t, "GET", "/api/announcements/active", nil).expect(t, http.StatusOK).decode(t, &active)
+	if len(active) != 3 || active[0].ID != 2 {
+		t.Errorf("active announcements = %+v, want 3 with the critical one first", active)
+	}
+	ts.do(t, "GET", "/api/announcements/active?zone=zone-shop", nil).expect(t, http.StatusBadRequest)
+
+	// Ending one now takes it down
+	ts.do(t, "PATCH", "/api/announcements/1", fmt.Sprintf(`{"endsAt": %q}`, now.Format(time.RFC3339Nano))).expect(t, http.StatusOK)
+	ts.do(t, "PATCH", "/api/announcements/1", fmt.Sprintf(`{"startsAt": %q}`, hour(1))).expect(t, http.StatusBadRequest)
+	ts.do(t, "GET", "/api/announcements/active?zone=zone-main", nil).expect(t, http.StatusOK).decode(t, &active)
+	if len(active) != 1 || active[0].ID != 3 {
+		t.Errorf("active announcements in zone-main = %+v, want only the warning", active)
+	}
+
+	ts.do(t, "DELETE", "/api/announcements/3", nil).expect(t, http.StatusOK)
+	ts.do(t, "GET", "/api/announcements/3", nil).expect(t, http.StatusNotFound)
+	var all []models.Announcement
+	ts.do(t, "GET", "/api/announcements", nil).expect(t, http.StatusOK).decode(t, &all)
+	if len(all) != 4 {
+		t.Errorf("got %d announcements, want 4", len(all))
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.do(t, "POST", "/api/navigation/items", `{"key": "Flags!", "label": "", "href": "//evil.example.com"}`).
+		expect(t, http.StatusBadRequest).golden(t, "invalid")
+	ts.do(t, "POST", "/api/navigation/items", `{"key": "shop", "label": "Shop", "href": "/shop", "zone": "zone-shop"}`).
+		expect(t, http.StatusBadRequest)
+
+	for _, body := range []string{
+		`{"key": "home", "label": "Home", "href": "/", "zone": "zone-main"}`,
+		`{"key": "users", "label": "Users", "href": "/admin/users", "zone": "zone-admin", "roles": ["admin"]}`,
+		`{"key": "dashboard", "label": "Dashboard", "href": "/admin", "zone": "zone-admin", "flag": "new_dashboard"}`,
+		`{"key": "dark-mode", "label": "Dark mode", "href": "/settings/theme", "zone": "zone-main", "flag": "dark_mode"}`,
+		`{"key": "docs", "label": "Docs", "href": "https://nextjs.org/docs/app/guides/multi-zones"}`,
+	} {
+		ts.do(t, "POST", "/api/navigation/items", body).expect(t, http.StatusCreated)
+	}
+	ts.do(t, "POST", "/api/navigation/items", `{"key": "home", "label": "Home", "href": "/"}`).expect(t, http.StatusConflict)
+
+	// Flags and roles decide what each viewer sees
+	ts.do(t, "GET", "/api/navigation?role=admin", nil).expect(t, http.StatusOK).golden(t, "admin")
+	keys := func(path string) []string {
+		var items []models.NavigationItem
+		ts.do(t, "GET", path, nil).expect(t, http.StatusOK).decode(t, &items)
+		keys := make([]string, len(items))
+		for i, item := range items {
+			keys[i] = item.Key
+		}
+		return keys
+	}
+	if got, want := keys("/api/navigation"), []string{"home", "dashboard", "docs"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("navigation = %v, want %v", got, want)
+	}
+	ts.do(t, "PATCH", "/api/feature-flags/dark_mode", `{"enabled": true}`).expect(t, http.StatusOK)
+	if got, want := keys("/api/navigation"), []string{"home", "dashboard", "dark-mode", "docs"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("navigation with dark_mode on = %v, want %v", got, want)
+	}
+
+	// Reordering names every item once
+	ts.do(t, "PUT", "/api/navigation/order", `{"keys": ["docs", "home"]}`).expect(t, http.StatusBadRequest)
+	ts.do(t, "PUT", "/api/navigation/order", `{"keys": ["docs", "home", "dashboard", "users", "dark-mode"]}`).expect(t, http.StatusOK)
+	if got, want := keys("/api/navigation/items"), []string{"docs", "home", "dashboard", "users", "dark-mode"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("items after reordering = %v, want %v", got, want)
+	}
+
+	ts.do(t, "PATCH", "/api/navigation/items/users", `{"roles": []}`).expect(t, http.StatusOK)
+	ts.do(t, "PATCH", "/api/navigation/items/users", `{"zone": "zone-shop"}`).expect(t, http.StatusBadRequest)
+	ts.do(t, "DELETE", "/api/navigation/items/docs", nil).expect(t, http.StatusOK)
+	ts.do(t, "GET", "/api/navigation/items/docs", nil).expect(t, http.StatusNotFound)
+	if got, want := keys("/api/navigation"), []string{"home", "dashboard", "users", "dark-mode"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("navigation = %v, want %v", got, want)
+	}
+}
+
+func TestRoutingManifest(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.do(t, "POST", "/api/zone-routes", `{"path": "/admin*", "zone": "zone-shop"}`).
+		expect(t, http.StatusBadRequest).golden(t, "invalid")
+	ts.do(t, "POST", "/api/zone-routes", `{"path": "/shop/*", "zone": "zone-shop"}`).
+		expect(t, http.StatusBadRequest)
+
+	for _, body := range []string{
+		`{"path": "/*", "zone": "zone-main", "description": "Everything else"}`,
+		`{"path": "/admin/*", "zone": "zone-admin"}`,
+		`{"path": "/admin/status", "zone": "zone-main"}`,
+		`{"path": "/admin/flags/*", "zone": "zone-main"}`,
+	} {
+		ts.do(t, "POST", "/api/zone-routes", body).expect(t, http.StatusCreated)
+	}
+	ts.do(t, "POST", "/api/zone-routes", `{"path": "/admin/*", "zone": "zone-main"}`).expect(t, http.StatusConflict)
+
+	// The flags section moves back to the admin zone, and the status page goes away
+	ts.do(t, "PATCH", "/api/zone-routes/4", `{"zone": "zone-admin"}`).expect(t, http.StatusOK)
+	ts.do(t, "PATCH", "/api/zone-routes/4", `{"path": "/admin/*"}`).expect(t, http.StatusConflict)
+	ts.do(t, "DELETE", "/api/zone-routes/3", nil).expect(t, http.StatusOK)
+	ts.do(t, "GET", "/api/zone-routes/3", nil).expect(t, http.StatusNotFound)
+
+	// Most specific first, in the shape of Next.js rewrites
+	ts.do(t, "GET", "/api/routing-manifest", nil).expect(t, http.StatusOK).golden(t, "manifest")
+
+	// Every change is kept, with who made it
+	var changes []models.ZoneRouteChange
+	ts.do(t, "GET", "/api/zone-routes/changes?filter="+url.QueryEscape(`routeId ge 3`), nil).expect(t, http.StatusOK).decode(t, &changes)
+	var log []string
+	for _, change := range changes {
+		log = append(log, fmt.Sprintf("%s %s %s->%s by %s", change.Action, change.Path, change.PreviousZone, change.Zone, change.ChangedBy))
+	}
+	want := []string{
+		"deleted /admin/status zone-main-> by integration-test",
+		"updated /admin/flags/* zone-main->zone-admin by integration-test",
+		"created /admin/flags/* ->zone-main by integration-test",
+		"created /admin/status ->zone-main by integration-test",
+	}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("changes = %q, want %q", log, want)
+	}
+}
+
+func TestExperiments(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.do(t, "POST", "/api/experiments", `{"key": "Checkout", "variants": [{"key": "control", "weight": 0}], "allocation": 150}`).
+		expect(t, http.StatusBadRequest).golden(t, "invalid")
+	ts.do(t, "POST", "/api/experiments", `{"key": "checkout", "name": "Checkout", "variants": [{"key": "a", "weight": 1}, {"key": "a", "weight": 1}]}`).
+		expect(t, http.StatusBadRequest)
+
+	ts.do(t, "POST", "/api/experiments", models.CreateExperimentRequest{
+		Key:           "checkout_button",
+		Name:          "Green checkout button",
+		Hypothesis:    "A green button gets more purchases than a blue one",
+		Variants:      []models.ExperimentVariant{{Key: "control", Weight: 1}, {Key: "green", Weight: 1}},
+		Flag:          "checkout_test",
+		PrimaryMetric: "purchase",
+	}).expect(t, http.StatusCreated)
+	ts.do(t, "POST", "/api/experiments", `{"key": "checkout_button", "name": "Again", "variants": [{"key": "a", "weight": 1}, {"key": "b", "weight": 1}]}`).
+		expect(t, http.StatusConflict)
+
+	assign := func(unit string) models.AssignmentResponse {
+		var assignment models.AssignmentResponse
+		ts.do(t, "POST", "/api/experiments/checkout_button/assignments", models.AssignExperimentRequest{Unit: unit}).
+			expect(t, http.StatusOK).decode(t, &assignment)
+		return assignment
+	}
+
+	// Nobody is enrolled in a draft, nor while the linked flag is missing or off
+	if assignment := assign("user-1"); assignment.Enrolled {
+		t.Errorf("draft assigned %+v", assignment)
+	}
+	ts.do(t, "PATCH", "/api/experiments/checkout_button", `{"status": "stopped"}`).expect(t, http.StatusConflict)
+	ts.do(t, "PATCH", "/api/experiments/checkout_button", `{"status": "running"}`).expect(t, http.StatusOK)
+	if assignment := assign("user-1"); assignment.Enrolled {
+		t.Errorf("assigned %+v without the flag", assignment)
+	}
+	ts.do(t, "POST", "/api/feature-flags", models.CreateFeatureFlagRequest{Key: "checkout_test", Name: "Checkout test", Enabled: true}).
+		expect(t, http.StatusCreated)
+	ts.do(t, "PATCH", "/api/experiments/checkout_button", `{"variants": [{"key": "control", "weight": 1}, {"key": "blue", "weight": 1}]}`).expect(t, http.StatusConflict)
+
+	// Bucketing is sticky, and splits units between the variants
+	variants := map[string]string{}
+	split := map[string]int{}
+	for i := range 200 {
+		unit := fmt.Sprintf("user-%d", i)
+		assignment := assign(unit)
+		if !assignment.Enrolled {
+			t.Fatalf("%s not enrolled: %+v", unit, assignment)
+		}
+		variants[unit] = assignment.Variant
+		split[assignment.Variant]++
+	}
+	if again := assign("user-7"); again.Variant != variants["user-7"] {
+		t.Errorf("user-7 moved from %s to %s", variants["user-7"], again.Variant)
+	}
+	if split["control"] < 70 || split["green"] < 70 {
+		t.Errorf("split = %v, want roughly even", split)
+	}
+
+	// Every unit is exposed; green converts more often. Conversions without an exposure count
+	// towards their metric but not the conversion rate
+	var events []models.ExperimentEventInput
+	for i := range 200 {
+		unit := fmt.Sprintf("user-%d", i)
+		events = append(events, models.ExperimentEventInput{Experiment: "checkout_button", Unit: unit, Type: "exposure"})
+		if i%5 == 0 || (variants[unit] == "green" && i%3 == 0) {
+			events = append(events, models.ExperimentEventInput{Experiment: "checkout_button", Unit: unit, Type: "conversion"})
+		}
+		if i%10 == 0 {
+			events = append(events, models.ExperimentEventInput{Experiment: "checkout_button", Unit: unit, Type: "conversion", Metric: "add_to_cart"})
+		}
+	}
+	events = append(events,
+		models.ExperimentEventInput{Experiment: "checkout_button", Unit: "visitor-x", Type: "exposure"},
+		models.ExperimentEventInput{Experiment: "no_such_test", Unit: "user-1", Type: "exposure"},
+	)
+	var recorded models.ExperimentEventsResponse
+	for start := 0; start < len(events); start += 500 {
+		var batch models.ExperimentEventsResponse
+		ts.do(t, "POST", "/api/experiments/events", models.ExperimentEventsRequest{Events: events[start:min(start+500, len(events))]}).
+			expect(t, http.StatusAccepted).decode(t, &batch)
+		recorded.Accepted += batch.Accepted
+		recorded.Ignored += batch.Ignored
+	}
+	if recorded.Ignored != 2 || recorded.Accepted != len(events)-2 {
+		t.Errorf("recorded %+v of %d events, want 2 ignored", recorded, len(events))
+	}
+	ts.do(t, "GET", "/api/experiments/checkout_button/results", nil).expect(t, http.StatusOK).golden(t, "results")
+
+	// Once stopped, assigned units keep their variant, nobody new is enrolled, and events are ignored
+	ts.do(t, "PATCH", "/api/experiments/checkout_button", `{"status": "stopped"}`).expect(t, http.StatusOK)
+	if assignment := assign("user-7"); assignment.Variant != variants["user-7"] {
+		t.Errorf("user-7 after stopping = %+v", assignment)
+	}
+	if assignment := assign("user-500"); assignment.Enrolled {
+		t.Errorf("stopped experiment assigned %+v", assignment)
+	}
+	ts.do(t, "POST", "/api/experiments/events", `{"events": [{"experiment": "checkout_button", "unit": "user-7", "type": "exposure"}]}`).
+		expect(t, http.StatusAccepted).golden(t, "stopped-events")
+
+	ts.do(t, "DELETE", "/api/experiments/checkout_button", nil).expect(t, http.StatusOK)
+	ts.do(t, "GET", "/api/experiments/checkout_button/results", nil).expect(t, http.StatusNotFound)
+}
+
+func TestSurveys(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.do(t, "POST", "/api/surveys", `{"key": "NPS", "questions": [{"key": "why", "type": "choice"}], "sample": 150}`).
+		expect(t, http.StatusBadRequest).golden(t, "invalid")
+	ts.do(t, "POST", "/api/surveys", `{"key": "nps", "title": "NPS", "questions": [{"key": "a", "type": "text", "prompt": "?"}, {"key": "a", "type": "text", "prompt": "?"}]}`).
+		expect(t, http.StatusBadRequest)
+
+	ts.do(t, "POST", "/api/surveys", models.CreateSurveyRequest{
+		Key:   "nps_q4",
+		Title: "How are we doing?",
+		Questions: []models.SurveyQuestion{
+			{Key: "recommend", Type: "nps", Prompt: "How likely are you to recommend us?", Required: true},
+			{Key: "why", Type: "multiple", Prompt: "What do you use most?", Options: []models.SurveyOption{{Key: "flags", Label: "Feature flags"}, {Key: "zones", Label: "Zones"}}},
+			{Key: "comment", Type: "text", Prompt: "Anything else?"},
+		},
+		Zones:    []string{"zone-main"},
+		Segments: []string{"pro"},
+		Flag:     "nps_survey",
+	}).expect(t, http.StatusCreated)
+	ts.do(t, "POST", "/api/surveys", `{"key": "nps_q4", "title": "Again", "questions": [{"key": "a", "type": "text", "prompt": "?"}]}`).
+		expect(t, http.StatusConflict)
+
+	// active returns the survey the unit should see, or "" for a 204
+	active := func(query string) string {
+		t.Helper()
+		resp := ts.do(t, "GET", "/api/surveys/active?"+query, nil)
+		if resp.status == http.StatusNoContent {
+			return ""
+		}
+		var survey models.Survey
+		resp.expect(t, http.StatusOK).decode(t, &survey)
+		return survey.Key
+	}
+	respond := func(unit string, answers ...models.SurveyAnswer) response {
+		return ts.do(t, "POST", "/api/surveys/nps_q4/responses", models.SubmitSurveyResponseRequest{Unit: unit, Zone: "zone-main", Answers: answers})
+	}
+	score := func(n int) *int { return &n }
+
+	// Nobody sees a draft, nor an active survey while its flag is missing or off
+	ts.do(t, "GET", "/api/surveys/active?zone=zone-main", nil).expect(t, http.StatusBadRequest)
+	if key := active("unit=user-1&zone=zone-main&segment=pro"); key != "" {
+		t.Errorf("draft shown: %s", key)
+	}
+	respond("user-1", models.SurveyAnswer{Question: "recommend", Score: score(10)}).expect(t, http.StatusConflict)
+	ts.do(t, "PATCH", "/api/surveys/nps_q4", `{"status": "closed"}`).expect(t, http.StatusConflict)
+	ts.do(t, "PATCH", "/api/surveys/nps_q4", `{"status": "active"}`).expect(t, http.StatusOK)
+	ts.do(t, "PATCH", "/api/surveys/nps_q4", `{"questions": [{"key": "a", "type": "text", "prompt": "?"}]}`).expect(t, http.StatusConflict)
+	if key := active("unit=user-1&zone=zone-main&segment=pro"); key != "" {
+		t.Errorf("shown without the flag: %s", key)
+	}
+	ts.do(t, "POST", "/api/feature-flags", models.CreateFeatureFlagRequest{Key: "nps_survey", Name: "NPS survey", Enabled: true}).
+		expect(t, http.StatusCreated)
+
+	// Targeting by zone and segment
+	for query, want := range map[string]string{
+		"unit=user-1&zone=zone-main&segment=pro":               "nps_q4",
+		"unit=user-1&zone=zone-main&segment=trial&segment=pro": "nps_q4",
+		"unit=user-1&zone=zone-admin&segment=pro":              "",
+		"unit=user-1&zone=zone-main&segment=trial":             "",
+		"unit=user-1&zone=zone-main":                           "",
+	} {
+		if key := active(query); key != want {
+			t.Errorf("active?%s = %q, want %q", query, key, want)
+		}
+	}
+
+	// Answers must fit their questions, and each unit responds once
+	respond("user-1", models.SurveyAnswer{Question: "recommend", Score: score(11)}).expect(t, http.StatusBadRequest)
+	respond("user-1", models.SurveyAnswer{Question: "why", Options: []string{"flags"}}).expect(t, http.StatusBadRequest)
+	respond("user-1", models.SurveyAnswer{Question: "recommend", Score: score(10)}, models.SurveyAnswer{Question: "why", Options: []string{"flags", "pricing"}}).
+		expect(t, http.StatusBadRequest)
+	respond("user-1", models.SurveyAnswer{Question: "recommend", Score: score(10)}, models.SurveyAnswer{Question: "why", Options: []string{"flags", "zones"}}).
+		expect(t, http.StatusCreated)
+	respond("user-2", models.SurveyAnswer{Question: "recommend", Score: score(9)}, models.SurveyAnswer{Question: "why", Options: []string{"flags"}}).
+		expect(t, http.StatusCreated)
+	respond("user-3", models.SurveyAnswer{Question: "recommend", Score: score(7)}).expect(t, http.StatusCreated)
+	respond("user-4", models.SurveyAnswer{Question: "recommend", Score: score(3)}, models.SurveyAnswer{Question: "why", Options: []string{"zones"}},
+		models.SurveyAnswer{Question: "comment", Text: "Too slow"}).expect(t, http.StatusCreated)
+	respond("user-1", models.SurveyAnswer{Question: "recommend", Score: score(0)}).expect(t, http.StatusConflict)
+	if key := active("unit=user-1&zone=zone-main&segment=pro"); key != "" {
+		t.Errorf("shown again after responding: %s", key)
+	}
+	if key := active("unit=user-5&zone=zone-main&segment=pro"); key != "nps_q4" {
+		t.Errorf("user-5 shown %q, want nps_q4", key)
+	}
+	ts.do(t, "GET", "/api/surveys/nps_q4/results", nil).expect(t, http.StatusOK).golden(t, "results")
+
+	var responses []models.SurveyResponse
+	ts.do(t, "GET", "/api/surveys/nps_q4/responses?"+listParams(`unit eq "user-4"`, ""), nil).expect(t, http.StatusOK).decode(t, &responses)
+	if len(responses) != 1 || len(responses[0].Answers) != 3 || responses[0].Answers[2].Text != "Too slow" {
+		t.Errorf("user-4's responses = %+v", responses)
+	}
+
+	// A sample is shown to about that share of units, and always to the same ones
+	ts.do(t, "POST", "/api/surveys", `{"key": "beta_poll", "title": "Beta", "questions": [{"key": "join", "type": "choice", "prompt": "Join the beta?", "options": [{"key": "yes", "label": "Yes"}, {"key": "no", "label": "No"}]}], "sample": 10}`).
+		expect(t, http.StatusCreated)
+	ts.do(t, "PATCH", "/api/surveys/beta_poll", `{"status": "active"}`).expect(t, http.StatusOK)
+	var sampled []string
+	for i := range 200 {
+		unit := fmt.Sprintf("visitor-%d", i)
+		if active("unit="+unit+"&zone=zone-admin") == "beta_poll" {
+			sampled = append(sampled, unit)
+		}
+	}
+	if len(sampled) < 5 || len(sampled) > 40 {
+		t.Errorf("%d of 200 units sampled, want about 20", len(sampled))
+	}
+	if len(sampled) > 0 && active("unit="+sampled[0]+"&zone=zone-admin") != "beta_poll" {
+		t.Errorf("%s left the sample", sampled[0])
+	}
+
+	// Closed surveys aren't shown and take no responses; deleting one deletes its responses
+	ts.do(t, "PATCH", "/api/surveys/nps_q4", `{"status": "closed"}`).expect(t, http.StatusOK)
+	if key := active("unit=user-5&zone=zone-main&segment=pro"); key != "" {
+		t.Errorf("closed survey shown: %s", key)
+	}
+	respond("user-5", models.SurveyAnswer{Question: "recommend", Score: score(8)}).expect(t, http.StatusConflict)
+	ts.do(t, "DELETE", "/api/surveys/nps_q4", nil).expect(t, http.StatusOK)
+	ts.do(t, "GET", "/api/surveys/nps_q4/results", nil).expect(t, http.StatusNotFound)
+	var left int64
+	testDB.Model(&models.SurveyResponse{}).Count(&left)
+	if left != 0 {
+		t.Errorf("%d responses left after deleting the survey", left)
+	}
+}
+
+func TestReleaseNotes(t *testing.T) {
+	ts := newTestServer(t)
+	now := time.Now()
+	at := func(d time.Duration) *time.Time { when := now.Add(d); return &when }
+
+	ts.do(t, "POST", "/api/release-notes", `{"version": "", "flag": "Beta"}`).expect(t, http.StatusBadRequest).golden(t, "invalid")
+	ts.do(t, "POST", "/api/release-notes", `{"version": "2.0.0", "zone": "zone-nope", "body": "x"}`).expect(t, http.StatusBadRequest)
+
+	for _, note := range []models.CreateReleaseNoteRequest{
+		{Version: "2.0.0", Body: "## Dark mode\nEvery zone has a dark theme.", PublishedAt: at(-48 * time.Hour)},
+		{Version: "2.1.0", Zone: "zone-admin", Body: "Bulk flag edits.", PublishedAt: at(-24 * time.Hour)},
+		{Version: "2.1.0", Zone: "zone-main", Body: "Faster search.", PublishedAt: at(-time.Hour), Flag: "new_search"},
+		{Version: "2.2.0", Body: "Coming soon.", PublishedAt: at(24 * time.Hour)},
+		{Version: "2.3.0", Body: "A draft."},
+	} {
+		ts.do(t, "POST", "/api/release-notes", note).expect(t, http.StatusCreated)
+	}
+	// A version is noted once per zone, and once for the whole site
+	ts.do(t, "POST", "/api/release-notes", `{"version": "2.1.0", "zone": "zone-admin", "body": "Again"}`).expect(t, http.StatusConflict)
+	ts.do(t, "PATCH", "/api/release-notes/3", `{"zone": "zone-admin"}`).expect(t, http.StatusConflict)
+
+	// published returns the versions of the notes listed, newest first
+	published := func(query string) []string {
+		t.Helper()
+		var notes []models.ReleaseNote
+		ts.do(t, "GET", "/api/release-notes/published"+query, nil).expect(t, http.StatusOK).decode(t, &notes)
+		versions := make([]string, len(notes))
+		for i, note := range notes {
+			versions[i] = note.Zone + "@" + note.Version
+		}
+		return versions
+	}
+	// Drafts, scheduled notes, and notes whose flag is missing or off aren't listed
+	if got, want := published(""), []string{"zone-admin@2.1.0", "@2.0.0"}; !slices.Equal(got, want) {
+		t.Errorf("published = %q, want %q", got, want)
+	}
+	ts.do(t, "POST", "/api/feature-flags", models.CreateFeatureFlagRequest{Key: "new_search", Name: "New search", Enabled: true}).
+		expect(t, http.StatusCreated)
+	for query, want := range map[string][]string{
+		"":                         {"zone-main@2.1.0", "zone-admin@2.1.0", "@2.0.0"},
+		"?zone=zone-main":          {"zone-main@2.1.0", "@2.0.0"},
+		"?zone=zone-admin&limit=1": {"zone-admin@2.1.0"},
+		"?since=" + url.QueryEscape(now.Add(-30*time.Hour).Format(time.RFC3339)): {"zone-main@2.1.0", "zone-admin@2.1.0"},
+	} {
+		if got := published(query); !slices.Equal(got, want) {
+			t.Errorf("published%s = %q, want %q", query, got, want)
+		}
+	}
+	ts.do(t, "GET", "/api/release-notes/published?zone=zone-nope", nil).expect(t, http.StatusBadRequest)
+	ts.do(t, "GET", "/api/release-notes/published?limit=0", nil).expect(t, http.StatusBadRequest)
+	ts.do(t, "GET", "/api/release-notes/published?since=yesterday", nil).expect(t, http.StatusBadRequest)
+
+	// Publishing the draft lists it; the admin list has every note
+	ts.do(t, "PATCH", "/api/release-notes/5", models.UpdateReleaseNoteRequest{PublishedAt: at(-time.Minute)}).expect(t, http.StatusOK)
+	if got := published("?zone=zone-admin"); len(got) != 3 || got[0] != "@2.3.0" {
+		t.Errorf("published?zone=zone-admin after publishing 2.3.0 = %q", got)
+	}
+	var notes []models.ReleaseNote
+	ts.do(t, "GET", "/api/release-notes?filter="+url.QueryEscape(`zone eq ""`), nil).expect(t, http.StatusOK).decode(t, &notes)
+	if len(notes) != 3 || notes[0].Version != "2.3.0" {
+		t.Errorf("site-wide release notes = %+v", notes)
+	}
+
+	ts.do(t, "DELETE", "/api/release-notes/5", nil).expect(t, http.StatusOK)
+	ts.do(t, "GET", "/api/release-notes/5", nil).expect(t, http.StatusNotFound)
+	ts.do(t, "GET", "/api/release-notes/nope", nil).expect(t, http.StatusNotFound)
+}
+
+func TestAnalytics(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) {
+		c.Analytics.MaxBatchSize = 6
+		c.Analytics.MaxBodyBytes = 2048
+	})
+
+	ts.do(t, "POST", "/api/events", `{"events": [{"type": "click", "zone": "zone-main", "path": "/"}, {"type": "custom", "zone": "zone-shop", "path": "about"}]}`).
+		expect(t, http.StatusBadRequest).golden(t, "invalid")
+	event := `{"type": "pageview", "zone": "zone-main", "path": "/"}`
+	ts.do(t, "POST", "/api/events", `{"events": [`+strings.Repeat(event+", ", 6)+event+`]}`).expect(t, http.StatusBadRequest)
+	ts.do(t, "POST", "/api/events", `{"events": [{"type": "pageview", "zone": "zone-main", "path": "/`+strings.Repeat("x", 2048)+`"}]}`).
+		expect(t, http.StatusRequestEntityTooLarge)
+
+	var recorded models.AnalyticsEventsResponse
+	ts.do(t, "POST", "/api/events", models.AnalyticsEventsRequest{Events: []models.AnalyticsEvent{
+		{Type: "pageview", Zone: "zone-main", Path: "/", Visitor: "visitor-a"},
+		{Type: "pageview", Zone: "zone-main", Path: "/pricing?ref=newsletter#plans", Visitor: "visitor-a"},
+		{Type: "custom", Name: "signup", Zone: "zone-main", Path: "/pricing", Visitor: "visitor-a"},
+		{Type: "pageview", Zone: "zone-main", Path: "/", Visitor: "visitor-b"},
+		{Type: "pageview", Zone: "zone-admin", Path: "/admin", Visitor: "visitor-b"},
+		{Type: "pageview", Zone: "zone-main", Path: "/"},
+	}}).expect(t, http.StatusAccepted).decode(t, &recorded)
+	if recorded.Accepted != 6 || recorded.Sampled != 0 {
+		t.Errorf("recorded = %+v, want all 6 accepted", recorded)
+	}
+	ts.analytics.flush()
+	// A visitor seen again after a flush is still one visitor that day
+	ts.do(t, "POST", "/api/events", `{"events": [{"type": "pageview", "zone": "zone-main", "path": "/", "visitor": "visitor-a"}]}`).
+		expect(t, http.StatusAccepted)
+	ts.analytics.flush()
+
+	today := time.Now().UTC().Format(time.DateOnly)
+	for _, tc := range []struct {
+		zone                       string
+		pageViews, events, visitor int64
+	}{
+		{"", 6, 1, 2},
+		{"zone-main", 5, 1, 2},
+		{"zone-admin", 1, 0, 1},
+	} {
+		var report models.AnalyticsReport
+		ts.do(t, "GET", "/api/analytics?zone="+tc.zone, nil).expect(t, http.StatusOK).decode(t, &report)
+		got := report.Days[len(report.Days)-1]
+		if len(report.Days) != 7 || got.Day != today {
+			t.Fatalf("zone %q: days = %+v, want the last 7 ending today", tc.zone, report.Days)
+		}
+		if got.PageViews != tc.pageViews || got.Events != tc.events || got.Visitors != tc.visitor || report.Totals.PageViews != tc.pageViews {
+			t.Errorf("zone %q: today = %+v, totals = %+v, want %d page views, %d events, %d visitors", tc.zone, got, report.Totals, tc.pageViews, tc.events, tc.visitor)
+		}
+		if tc.zone == "" {
+			wantPages := []models.AnalyticsPage{{Path: "/", Views: 4}, {Path: "/admin", Views: 1}, {Path: "/pricing", Views: 1}}
+			if !reflect.DeepEqual(report.TopPages, wantPages) {
+				t.Errorf("top pages = %+v, want %+v", report.TopPages, wantPages)
+			}
+			if want := []models.AnalyticsEventTotal{{Name: "signup", Count: 1}}; !reflect.DeepEqual(report.TopEvents, want) {
+				t.Errorf("top events = %+v, want %+v", report.TopEvents, want)
+			}
+		}
+	}
+	ts.do(t, "GET", "/api/analytics?zone=zone-shop", nil).expect(t, http.StatusBadRequest)
+	ts.do(t, "GET", "/api/analytics?from=2024-01-01&to=2025-06-01", nil).expect(t, http.StatusBadRequest)
+}
+
+func TestActiveUsers(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.do(t, "POST", "/api/zones/zone-shop/heartbeat", `{"session": "a"}`).expect(t, http.StatusNotFound)
+	ts.do(t, "POST", "/api/zones/zone-main/heartbeat", `{"session": ""}`).expect(t, http.StatusBadRequest)
+
+	var start models.ChangesResponse
+	ts.do(t, "GET", "/api/changes", nil).expect(t, http.StatusOK).decode(t, &start)
+	// A session's repeated heartbeats count once
+	for _, session := range []string{"session-a", "session-b", "session-a"} {
+		ts.do(t, "POST", "/api/zones/zone-main/heartbeat", models.HeartbeatRequest{Session: session}).expect(t, http.StatusOK)
+	}
+	var active models.ActiveUsers
+	ts.do(t, "GET", "/api/zones/zone-main/active-users", nil).expect(t, http.StatusOK).decode(t, &active)
+	if active.Zone != "zone-main" || active.ActiveUsers != 2 || active.WindowSeconds != 120 {
+		t.Errorf("active users = %+v, want 2 in zone-main over 120s", active)
+	}
+	ts.do(t, "GET", "/api/zones/zone-admin/active-users", nil).expect(t, http.StatusOK).decode(t, &active)
+	if active.ActiveUsers != 0 {
+		t.Errorf("zone-admin active users = %d, want 0", active.ActiveUsers)
+	}
+	ts.do(t, "GET", "/api/zones/zone-shop/active-users", nil).expect(t, http.StatusNotFound)
+
+	// Sweeps publish the count when it changes, including when every session expires
+	ts.presence.sweep(time.Now())
+	ts.presence.sweep(time.Now())
+	ts.presence.sweep(time.Now().Add(ts.config.Analytics.ActiveWindow))
+	var changes models.ChangesResponse
+	ts.do(t, "GET", "/api/changes?wait=0s&since="+start.Cursor, nil).expect(t, http.StatusOK).decode(t, &changes)
+	var counts []string
+	for _, change := range changes.Changes {
+		if change.Type == "activeUsers" && change.Key == "zone-main" {
+			counts = append(counts, change.Action)
+		}
+	}
+	if want := []string{"2", "0"}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("zone-main active users changes = %v, want %v", counts, want)
+	}
+}
+
+func TestTenancy(t *testing.T) {
+	bucket := newFakeS3(t)
+	ts := newTestServer(t, func(c *Config) {
+		c.API.Token = "test-token"
+		// For the avatar endpoints
+		c.Uploads.S3Endpoint = strings.TrimPrefix(bucket.URL, "http://")
+		c.Uploads.S3Insecure = true
+		c.Uploads.S3Bucket = "uploads"
+		c.Uploads.S3AccessKey = "access-key"
+		c.Uploads.S3SecretKey = "secret-key"
+	})
+	admin := []string{"Authorization", "Bearer test-token"}
+
+	ts.do(t, "POST", "/api/organizations", `{"slug": "Acme!", "name": ""}`, admin...).
+		expect(t, http.StatusBadRequest).golden(t, "invalid")
+	ts.do(t, "POST", "/api/organizations", `{"slug": "acme", "name": "Acme"}`, admin...).expect(t, http.StatusCreated)
+	ts.do(t, "POST", "/api/organizations", `{"slug": "acme", "name": "Acme again"}`, admin...).expect(t, http.StatusConflict)
+	ts.do(t, "POST", "/api/organizations/acme/projects", `{"slug": "web", "name": "Web", "zones": ["zone-shop"]}`, admin...).
+		expect(t, http.StatusBadRequest)
+	ts.do(t, "POST", "/api/organizations/acme/projects", `{"slug": "web", "name": "Web", "zones": ["zone-main"]}`, admin...).
+		expect(t, http.StatusCreated)
+	var created models.ProjectAPIKeyCreated
+	ts.do(t, "POST", "/api/organizations/acme/projects/web/api-keys", `{"name": "zone-main"}`, admin...).
+		expect(t, http.StatusCreated).decode(t, &created)
+	web := []string{"Authorization", "Bearer " + created.Key}
+
+	// The project's key changes only the project's data; the same keys and emails are free there
+	ts.do(t, "GET", "/api/feature-flags", nil, web...).expect(t, http.StatusOK).golden(t, "empty")
+	ts.do(t, "POST", "/api/feature-flags", models.CreateFeatureFlagRequest{Key: "new_dashboard", Name: "New Dashboard", Enabled: true}, web...).
+		expect(t, http.StatusCreated)
+	var user models.User
+	ts.do(t, "POST", "/api/users", models.CreateUserRequest{Email: "alice@example.com", Name: "Web Alice"}, web...).
+		expect(t, http.StatusCreated).decode(t, &user)
+	ts.do(t, "POST", "/api/announcements", `{"message": "Hi"}`, web...).expect(t, http.StatusUnauthorized)
+
+	var flag models.FeatureFlag
+	ts.do(t, "GET", "/api/feature-flags/new_dashboard", nil, web...).expect(t, http.StatusOK).decode(t, &flag)
+	if flag.ID == 1 {
+		t.Errorf("acme/web flag new_dashboard = %+v, want the one it created", flag)
+	}
+	ts.do(t, "GET", "/api/feature-flags/new_dashboard", nil).expect(t, http.StatusOK).decode(t, &flag)
+	if flag.ID != 1 {
+		t.Errorf("default project flag new_dashboard = %+v, want the fixture", flag)
+	}
+	ts.do(t, "GET", fmt.Sprintf("/api/users/%d", user.ID), nil).expect(t, http.StatusNotFound)
+	ts.do(t, "GET", "/api/users/1", nil, web...).expect(t, http.StatusNotFound)
+	ts.do(t, "DELETE", "/api/feature-flags/dark_mode", nil, web...).expect(t, http.StatusNotFound)
+
+	// With the API token, X-Project picks the project; without it, it is refused
+	ts.do(t, "GET", "/api/users", nil, "X-Project", "acme/web").expect(t, http.StatusUnauthorized)
+	ts.do(t, "GET", "/api/users", nil, "X-Project", "acme/mobile", admin[0], admin[1]).expect(t, http.StatusBadRequest)
+	var users []models.User
+	ts.do(t, "GET", "/api/users", nil, "X-Project", "acme/web", admin[0], admin[1]).expect(t, http.StatusOK).decode(t, &users)
+	if len(users) != 1 || users[0].Name != "Web Alice" {
+		t.Errorf("acme/web users = %+v, want only Web Alice", users)
+	}
+
+	// Zones, bootstrap, changes, and GraphQL see only the project
+	ts.do(t, "GET", "/api/zones/status", nil, web...).expect(t, http.StatusOK).golden(t, "zones")
+	ts.do(t, "GET", "/api/bootstrap", nil, web...).expect(t, http.StatusOK).golden(t, "bootstrap")
+	var changes models.ChangesResponse
+	ts.do(t, "GET", "/api/changes?wait=0s&since=0", nil, web...).expect(t, http.StatusOK).decode(t, &changes)
+	if len(changes.Changes) != 1 || changes.Changes[0].Key != "new_dashboard" {
+		t.Errorf("acme/web changes = %+v, want only new_dashboard created", changes.Changes)
+	}
+	ts.do(t, "POST", "/api/graphql", map[string]any{"query": "{ featureFlags { key enabled } users { email name } }"}, web...).
+		expect(t, http.StatusOK).golden(t, "graphql")
+
+	// So do the unversioned endpoints that read the project's data
+	var found models.SearchResponse
+	ts.do(t, "GET", "/api/search?q=alice&type=user", nil, web...).expect(t, http.StatusOK).decode(t, &found)
+	if len(found.Results) != 1 || found.Results[0].Title != "Web Alice" {
+		t.Errorf("acme/web search = %+v, want only Web Alice", found.Results)
+	}
+	ts.do(t, "GET", "/api/search?q=new+dashboard&type=flag", nil, "X-Project", "acme/web", admin[0], admin[1]).expect(t, http.StatusOK).decode(t, &found)
+	if len(found.Results) != 1 || found.Results[0].ID != "new_dashboard" || found.Results[0].URL != "/api/feature-flags/new_dashboard" {
+		t.Errorf("acme/web search = %+v, want only its new_dashboard", found.Results)
+	}
+	var events []models.ActivityEvent
+	ts.do(t, "GET", "/api/activity", nil).expect(t, http.StatusUnauthorized)
+	ts.do(t, "GET", "/api/activity", nil, web...).expect(t, http.StatusOK).decode(t, &events)
+	if len(events) != 2 || events[0].Summary != "User Web Alice (alice@example.com) was created" || events[1].Summary != "Flag new_dashboard was created" {
+		t.Errorf("acme/web activity = %+v, want its user and flag created", events)
+	}
+	ts.do(t, "GET", "/api/activity", nil, admin...).expect(t, http.StatusOK).decode(t, &events)
+	if len(events) != 0 {
+		t.Errorf("default project activity = %+v, want none of acme/web's", events)
+	}
+
+	// Bundles export and import the project's flags, with the shared configuration
+	var bundle models.Bundle
+	ts.do(t, "GET", "/api/export/bundle", nil).expect(t, http.StatusUnauthorized)
+	ts.do(t, "GET", "/api/export/bundle", nil, "X-Project", "acme/web", admin[0], admin[1]).expect(t, http.StatusOK).decode(t, &bundle)
+	if len(bundle.FeatureFlags) != 1 || bundle.FeatureFlags[0].Key != "new_dashboard" {
+		t.Fatalf("acme/web bundle flags = %+v, want only its new_dashboard", bundle.FeatureFlags)
+	}
+	bundle.FeatureFlags[0].Enabled = false
+	var imported models.BundleImportResponse
+	ts.do(t, "POST", "/api/import/bundle", bundle, "X-Project", "acme/web", admin[0], admin[1]).expect(t, http.StatusOK).decode(t, &imported)
+	if len(imported.Changes) != 1 || imported.Changes[0].Key != "new_dashboard" || !slices.Equal(imported.Changes[0].Fields, []string{"enabled"}) {
+		t.Errorf("acme/web import = %+v, want only its new_dashboard turned off", imported)
+	}
+	var flags []models.FeatureFlag
+	ts.do(t, "GET", "/api/feature-flags", nil).expect(t, http.StatusOK).decode(t, &flags)
+	if len(flags) != 3 {
+		t.Errorf("default project flags after the acme/web import = %+v, want the 3 fixtures", flags)
+	}
+
+	// Flag translations and user avatars are the project's
+	ts.do(t, "PUT", "/api/feature-flags/new_dashboard/translations/de", `{"name": "Neues Dashboard"}`, web...).expect(t, http.StatusOK)
+	var webTranslations, defaultTranslations map[string]models.FlagTranslation
+	ts.do(t, "GET", "/api/feature-flags/new_dashboard/translations", nil, web...).expect(t, http.StatusOK).decode(t, &webTranslations)
+	if webTranslations["de"].Name != "Neues Dashboard" {
+		t.Errorf("acme/web new_dashboard translations = %+v, want de", webTranslations)
+	}
+	ts.do(t, "GET", "/api/feature-flags/new_dashboard/translations", nil).expect(t, http.StatusOK).decode(t, &defaultTranslations)
+	if len(defaultTranslations) != 0 {
+		t.Errorf("default project new_dashboard translations = %+v, want none", defaultTranslations)
+	}
+	ts.do(t, "PUT", "/api/feature-flags/dark_mode/translations/de", `{"name": "Dunkelmodus"}`, web...).expect(t, http.StatusNotFound)
+	ts.do(t, "DELETE", "/api/feature-flags/new_dashboard/translations/de", nil, web...).expect(t, http.StatusOK)
+	ts.do(t, "DELETE", fmt.Sprintf("/api/users/%d/avatar", user.ID), nil, web...).expect(t, http.StatusOK)
+	ts.do(t, "DELETE", "/api/users/1/avatar", nil, web...).expect(t, http.StatusNotFound)
+
+	// Active users are counted for the project's zones only
+	ts.do(t, "GET", "/api/zones/zone-main/active-users", nil, web...).expect(t, http.StatusOK)
+	ts.do(t, "GET", "/api/zones/zone-admin/active-users", nil, web...).expect(t, http.StatusNotFound)
+
+	// The incident feed has only the incidents of the project's zones
+	testDB.Create(&[]models.ActivityEvent{
+		{Type: "zone", Action: "incident", Subject: "zone-main", Zone: "zone-main", Summary: "zone-main is unhealthy"},
+		{Type: "zone", Action: "incident", Subject: "zone-admin", Zone: "zone-admin", Summary: "zone-admin is unhealthy"},
+	})
+	if feed := string(ts.do(t, "GET", "/api/incidents/feed.atom", nil, web...).expect(t, http.StatusOK).body); !strings.Contains(feed, "zone-main is unhealthy") ||
+		strings.Contains(feed, "zone-admin") {
+		t.Errorf("acme/web incident feed = %s, want only zone-main's incident", feed)
+	}
+	if feed := string(ts.do(t, "GET", "/api/incidents/feed.atom", nil).expect(t, http.StatusOK).body); !strings.Contains(feed, "zone-admin is unhealthy") {
+		t.Errorf("public incident feed = %s, want every zone's incidents", feed)
+	}
+
+	// Revoked keys and deleted projects stop working; the default project stays
+	ts.do(t, "DELETE", "/api/organizations/acme", nil, admin...).expect(t, http.StatusConflict)
+	ts.do(t, "DELETE", "/api/organizations/default/projects/default", nil, admin...).expect(t, http.StatusConflict)
+	ts.do(t, "DELETE", fmt.Sprintf("/api/organizations/acme/projects/web/api-keys/%d", created.ID), nil, admin...).expect(t, http.StatusOK)
+	ts.do(t, "GET", "/api/feature-flags", nil, web...).expect(t, http.StatusUnauthorized)
+	ts.do(t, "DELETE", "/api/organizations/acme/projects/web", nil, admin...).expect(t, http.StatusOK)
+	ts.do(t, "DELETE", "/api/organizations/acme", nil, admin...).expect(t, http.StatusOK)
+	var remaining int64
+	testDB.Model(&models.User{}).Count(&remaining)
+	if remaining != 6 {
+		t.Errorf("%d users left after deleting acme/web, want the 6 fixtures", remaining)
+	}
+}
+
+func TestContact(t *testing.T) {
+	captcha := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		ok := r.PostForm.Get("secret") == "captcha-secret" && r.PostForm.Get("response") == "human"
+		fmt.Fprintf(w, `{"success": %t}`, ok)
+	}))
+	defer captcha.Close()
+	ts := newTestServer(t, func(c *Config) {
+		c.Contact.RateLimit = 6
+		c.Contact.MaxLinks = 1
+		c.Server.TrustedProxies = []string{"127.0.0.1"}
+		c.Contact.CaptchaVerifyURL = captcha.URL
+		c.Contact.CaptchaSecret = "captcha-secret"
+		c.Contact.NotifyRecipients = []string{"support@example.com"}
+		// Notifications are only queued, since the job queue doesn't run
+		c.Email.Provider = "sendgrid"
+		c.Email.From = "Backend <noreply@example.com>"
+		c.Email.SendGridAPIKey = "sendgrid-key"
+	})
+
+	ts.do(t, "POST", "/api/contact", `{"name": "", "email": "ada", "message": ""}`).
+		expect(t, http.StatusBadRequest).golden(t, "invalid")
+	ts.do(t, "POST", "/api/contact", `{"name": "Ada", "email": "ada@example.com", "message": "Hi", "zone": "zone-shop", "captchaToken": "human"}`).
+		expect(t, http.StatusBadRequest)
+	ts.do(t, "POST", "/api/contact", `{"name": "Ada", "email": "ada@example.com", "message": "Hi", "captchaToken": "robot"}`).
+		expect(t, http.StatusBadRequest)
+
+	// Spam is answered like everything else, but only the real message is emailed
+	for _, body := range []string{
+		`{"name": "Ada", "email": "Ada@Example.com", "subject": "Pricing question", "message": "Do you offer a team plan?", "zone": "zone-main", "captchaToken": "human"}`,
+		`{"name": "Bot", "email": "bot@example.com", "message": "Great site", "website": "https://spam.example.com", "captchaToken": "human"}`,
+		`{"name": "Bot", "email": "bot@example.com", "message": "Cheap pills at https://a.example.com and www.b.example.com", "captchaToken": "human"}`,
+	} {
+		ts.do(t, "POST", "/api/contact", body).expect(t, http.StatusAccepted)
+	}
+	ts.do(t, "GET", "/api/contact/submissions", nil).expect(t, http.StatusOK).golden(t, "submissions")
+	var emails []models.EmailMessage
+	ts.do(t, "GET", "/api/emails", nil).expect(t, http.StatusOK).decode(t, &emails)
+	if len(emails) != 1 || emails[0].To != "support@example.com" || emails[0].Subject != "[Contact] Pricing question" {
+		t.Errorf("emails = %+v, want one notification to support@example.com", emails)
+	}
+
+	// Each client has CONTACT_RATE_LIMIT messages an hour, whatever became of them
+	limited := ts.do(t, "POST", "/api/contact", `{"name": "Ada", "email": "ada@example.com", "message": "Me again", "captchaToken": "human"}`).
+		expect(t, http.StatusTooManyRequests)
+	if got := limited.header.Get("Retry-After"); got != "600" {
+		t.Errorf("Retry-After = %q, want 600", got)
+	}
+	// Behind a trusted proxy, each visitor has a budget of their own
+	ts.do(t, "POST", "/api/contact", `{"name": "Grace", "email": "grace@example.com", "message": "Hello", "captchaToken": "human"}`,
+		"X-Forwarded-For", "203.0.113.7").expect(t, http.StatusAccepted)
+
+	// Triage
+	ts.do(t, "PATCH", "/api/contact/submissions/1", `{"status": "closed"}`).expect(t, http.StatusBadRequest)
+	ts.do(t, "PATCH", "/api/contact/submissions/1", `{"status": "resolved", "note": "Replied by email"}`).expect(t, http.StatusOK)
+	var submissions []models.ContactSubmission
+	ts.do(t, "GET", "/api/contact/submissions?"+listParams(`status eq "spam"`, ""), nil).expect(t, http.StatusOK).decode(t, &submissions)
+	if len(submissions) != 2 || submissions[0].SpamReason != "links" || submissions[1].SpamReason != "honeypot" {
+		t.Errorf("spam = %+v, want the two bot messages, newest first", submissions)
+	}
+	ts.do(t, "DELETE", "/api/contact/submissions/2", nil).expect(t, http.StatusOK)
+	ts.do(t, "GET", "/api/contact/submissions/2", nil).expect(t, http.StatusNotFound)
+	ts.do(t, "GET", "/api/contact/submissions/1", nil).expect(t, http.StatusOK).decode(t, &submissions[0])
+	if submissions[0].Status != "resolved" || submissions[0].Email != "ada@example.com" {
+		t.Errorf("submission 1 = %+v, want resolved with the email in lower case", submissions[0])
+	}
+}
+
+func TestNewsletter(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) {
+		c.Newsletter.ConfirmURL = "https://example.com/newsletter/confirm"
+		c.Newsletter.UnsubscribeURL = "https://example.com/newsletter/unsubscribe"
+		c.Newsletter.RateLimit = 6
+		// Confirmations are only queued, since the job queue doesn't run
+		c.Email.Provider = "sendgrid"
+		c.Email.From = "Backend <noreply@example.com>"
+		c.Email.SendGridAPIKey = "sendgrid-key"
+	})
+	// tokens returns the confirmation and unsubscribe tokens of the latest email; only the first
+	// email to an address has an unsubscribe link
+	tokens := func(t *testing.T) (string, string) {
+		t.Helper()
+		var message models.EmailMessage
+		testDB.Order("id DESC").First(&message)
+		confirm := regexp.MustCompile(`/newsletter/confirm\?token=(\w+)`).FindStringSubmatch(message.TextBody)
+		if confirm == nil {
+			t.Fatalf("email %d has no confirmation link:\n%s", message.ID, message.TextBody)
+		}
+		if unsubscribe := regexp.MustCompile(`/newsletter/unsubscribe\?token=(\w+)`).FindStringSubmatch(message.TextBody); unsubscribe != nil {
+			return confirm[1], unsubscribe[1]
+		}
+		return confirm[1], ""
+	}
+	emails := func() int64 {
+		var n int64
+		testDB.Model(&models.EmailMessage{}).Where("template = ?", "newsletter-confirm").Count(&n)
+		return n
+	}
+
+	ts.do(t, "POST", "/api/newsletter/subscribe", `{"email": "ada"}`).expect(t, http.StatusBadRequest).golden(t, "invalid")
+	ts.do(t, "POST", "/api/newsletter/subscribe", `{"email": "ada@example.com", "zone": "zone-shop"}`).expect(t, http.StatusBadRequest)
+
+	// Signing up again while pending sends a new confirmation link and retires the old one, but
+	// keeps the unsubscribe link of the first email
+	ts.do(t, "POST", "/api/newsletter/subscribe", `{"email": "Ada@Example.com", "zone": "zone-main"}`).expect(t, http.StatusAccepted)
+	oldConfirm, unsubscribe := tokens(t)
+	ts.do(t, "POST", "/api/newsletter/subscribe", `{"email": "ada@example.com", "zone": "zone-main"}`).expect(t, http.StatusAccepted)
+	confirm, newUnsubscribe := tokens(t)
+	if unsubscribe == "" || newUnsubscribe != "" {
+		t.Errorf("unsubscribe tokens = %q, then %q; want one in the first email only", unsubscribe, newUnsubscribe)
+	}
+	ts.do(t, "POST", "/api/newsletter/confirm", map[string]string{"token": oldConfirm}).expect(t, http.StatusNotFound)
+	ts.do(t, "POST", "/api/newsletter/confirm", map[string]string{"token": confirm}).expect(t, http.StatusOK)
+	ts.do(t, "POST", "/api/newsletter/confirm", map[string]string{"token": confirm}).expect(t, http.StatusNotFound)
+
+	// A confirmed address gets the same answer, but no email
+	ts.do(t, "POST", "/api/newsletter/subscribe", `{"email": "ada@example.com"}`).expect(t, http.StatusAccepted)
+	if n := emails(); n != 2 {
+		t.Errorf("%d confirmation emails, want 2", n)
+	}
+
+	ts.do(t, "POST", "/api/newsletter/subscribe", `{"email": "grace@example.com"}`).expect(t, http.StatusAccepted)
+	graceConfirm, _ := tokens(t)
+	testDB.Model(&models.NewsletterSubscription{}).Where("email = ?", "grace@example.com").Update("confirm_expires_at", time.Now().Add(-time.Minute))
+	ts.do(t, "POST", "/api/newsletter/confirm", map[string]string{"token": graceConfirm}).expect(t, http.StatusGone)
+
+	// Each client has NEWSLETTER_RATE_LIMIT signups an hour, valid or not
+	limited := ts.do(t, "POST", "/api/newsletter/subscribe", `{"email": "alan@example.com"}`).expect(t, http.StatusTooManyRequests)
+	if got := limited.header.Get("Retry-After"); got != "600" {
+		t.Errorf("Retry-After = %q, want 600", got)
+	}
+
+	// The mailing list, as CSV
+	csv := ts.do(t, "GET", "/api/newsletter/subscriptions?columns=email,status,zone&"+listParams("", "id"), nil, "Accept", csvContentType).
+		expect(t, http.StatusOK)
+	want := []string{"email,status,zone", "ada@example.com,confirmed,zone-main", "grace@example.com,pending,"}
+	if got := csv.lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("CSV = %q, want %q", got, want)
+	}
+
+	// Unsubscribing works from the first email, and again from it later
+	ts.do(t, "POST", "/api/newsletter/unsubscribe", map[string]string{"token": "0123456789abcdef0123456789abcdef"}).expect(t, http.StatusNotFound)
+	ts.do(t, "POST", "/api/newsletter/unsubscribe", map[string]string{"token": unsubscribe}).expect(t, http.StatusOK)
+	ts.do(t, "POST", "/api/newsletter/unsubscribe", map[string]string{"token": unsubscribe}).expect(t, http.StatusOK)
+	var subscriptions []models.NewsletterSubscription
+	ts.do(t, "GET", "/api/newsletter/subscriptions?"+listParams(`status eq "unsubscribed"`, ""), nil).expect(t, http.StatusOK).decode(t, &subscriptions)
+	if len(subscriptions) != 1 || subscriptions[0].Email != "ada@example.com" || subscriptions[0].ConfirmedAt == nil || subscriptions[0].UnsubscribedAt == nil {
+		t.Errorf("unsubscribed = %+v, want ada@example.com, confirmed and then unsubscribed", subscriptions)
+	}
+
+	ts.do(t, "DELETE", "/api/newsletter/subscriptions/1", nil).expect(t, http.StatusOK)
+	ts.do(t, "DELETE", "/api/newsletter/subscriptions/1", nil).expect(t, http.StatusNotFound)
+}
+
+func TestFeedback(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.do(t, "POST", "/api/feedback", `{"rating": 6, "zone": ""}`).expect(t, http.StatusBadRequest).golden(t, "invalid")
+	ts.do(t, "POST", "/api/feedback", `{"rating": 3, "zone": "zone-shop"}`).expect(t, http.StatusBadRequest)
+
+	for _, body := range []string{
+		`{"rating": 5, "message": "Love the new dashboard", "page": "/dashboard", "zone": "zone-main", "userId": "42"}`,
+		`{"rating": 1, "message": "=HYPERLINK(\"https://evil.example.com\")", "page": "/pricing", "zone": "zone-main"}`,
+		`{"rating": 2, "message": "Search is slow", "page": "/admin/users", "zone": "zone-admin", "userId": "7"}`,
+	} {
+		ts.do(t, "POST", "/api/feedback", body).expect(t, http.StatusCreated)
+	}
+	ts.do(t, "GET", "/api/feedback", nil).expect(t, http.StatusOK).golden(t, "list")
+
+	// Triage: new feedback can be triaged or closed, and closed feedback reopened, but nothing goes back to new
+	ts.do(t, "PATCH", "/api/feedback/3", `{"status": "triaged", "note": "Roadmap: search index"}`).expect(t, http.StatusOK)
+	ts.do(t, "PATCH", "/api/feedback/1", `{"status": "closed"}`).expect(t, http.StatusOK)
+	ts.do(t, "PATCH", "/api/feedback/1", `{"status": "new"}`).expect(t, http.StatusConflict)
+	ts.do(t, "PATCH", "/api/feedback/1", `{"status": "triaged"}`).expect(t, http.StatusOK)
+	ts.do(t, "PATCH", "/api/feedback/1", `{"status": "done"}`).expect(t, http.StatusBadRequest)
+
+	var low []models.Feedback
+	ts.do(t, "GET", "/api/feedback?"+listParams(`status ne "closed" and rating le 2`, "rating"), nil).expect(t, http.StatusOK).decode(t, &low)
+	if len(low) != 2 || low[0].ID != 2 || low[1].Status != "triaged" {
+		t.Errorf("low ratings = %+v, want feedback 2 and the triaged 3", low)
+	}
+
+	// CSV exports stream every match, with formulas defused
+	csv := ts.do(t, "GET", "/api/feedback?columns=id,rating,status,message&"+listParams(`zone eq "zone-main"`, "id"), nil, "Accept", csvContentType).
+		expect(t, http.StatusOK)
+	want := []string{"id,rating,status,message", "1,5,triaged,Love the new dashboard", `2,1,new,"'=HYPERLINK(""https://evil.example.com"")"`}
+	if got := csv.lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("CSV = %q, want %q", got, want)
+	}
+
+	ts.do(t, "DELETE", "/api/feedback/2", nil).expect(t, http.StatusOK)
+	ts.do(t, "GET", "/api/feedback/2", nil).expect(t, http.StatusNotFound)
+}
+
+func TestUploads(t *testing.T) {
+	bucket := newFakeS3(t)
+	ts := newTestServer(t, func(c *Config) {
+		c.Uploads.S3Endpoint = strings.TrimPrefix(bucket.URL, "http://")
+		c.Uploads.S3Insecure = true
+		c.Uploads.S3Bucket = "uploads"
+		c.Uploads.S3AccessKey = "access-key"
+		c.Uploads.S3SecretKey = "secret-key"
+		c.Uploads.TypeLimits = []string{"image/*=1KB", "image/svg+xml=16B", "text/plain=64"}
+	})
+
+	ts.do(t, "POST", "/api/uploads", `{"filename": "", "contentType": "application/zip", "size": 0}`).
+		expect(t, http.StatusBadRequest).golden(t, "invalid")
+	ts.do(t, "POST", "/api/uploads", `{"filename": "a.zip", "contentType": "application/zip", "size": 10}`).
+		expect(t, http.StatusBadRequest).golden(t, "type")
+	// An exact type's limit wins over its type/*
+	ts.do(t, "POST", "/api/uploads", `{"filename": "logo.svg", "contentType": "image/svg+xml", "size": 100}`).
+		expect(t, http.StatusBadRequest).golden(t, "size")
+
+	// The browser PUTs the file to the presigned URL, with the signed headers
+	put := func(created models.UploadCreated, body string) {
+		t.Helper()
+		headers := []string{}
+		for name, value := range created.Headers {
+			headers = append(headers, name, value)
+		}
+		send(t, "PUT", created.UploadURL, body, headers...).expect(t, http.StatusOK)
+	}
+	var created models.UploadCreated
+	resp := ts.do(t, "POST", "/api/uploads", `{"filename": "Q3 report (final).txt", "contentType": "Text/Plain; charset=utf-8", "size": 11, "zone": "zone-admin"}`).
+		expect(t, http.StatusCreated)
+	resp.decode(t, &created)
+	if created.Status != "pending" || created.ContentType != "text/plain" || !strings.HasSuffix(created.Key, "/Q3-report-final-.txt") ||
+		!strings.HasPrefix(created.UploadURL, bucket.URL+"/uploads/"+created.Key) || created.Headers["Content-Type"] != "text/plain" {
+		t.Fatalf("upload = %+v, want a pending text/plain upload with a URL to PUT it to", created)
+	}
+	if got := resp.header.Get("Location"); got != fmt.Sprintf("/api/uploads/%d", created.ID) {
+		t.Errorf("Location = %q", got)
+	}
+	path := fmt.Sprintf("/api/uploads/%d", created.ID)
+	ts.do(t, "POST", path+"/complete", nil).expect(t, http.StatusConflict)
+	ts.do(t, "GET", path+"/download", nil).expect(t, http.StatusConflict)
+	put(created, "hello world")
+	var upload models.Upload
+	ts.do(t, "POST", path+"/complete", nil).expect(t, http.StatusOK).decode(t, &upload)
+	if upload.Status != "ready" || upload.CompletedAt == nil {
+		t.Errorf("completed upload = %+v, want ready", upload)
+	}
+	ts.do(t, "POST", path+"/complete", nil).expect(t, http.StatusConflict)
+	// The download redirect is followed to the bucket, by ID or by the public object key
+	for _, download := range []string{path + "/download", "/api/files/" + created.Key} {
+		if got := ts.do(t, "GET", download, nil).expect(t, http.StatusOK); string(got.body) != "hello world" ||
+			got.header.Get("Content-Disposition") != `attachment; filename="Q3 report (final).txt"` {
+			t.Errorf("%s = %q (%s), want the file as an attachment", download, got.body, got.header.Get("Content-Disposition"))
+		}
+	}
+	ts.do(t, "GET", "/api/files/"+strings.TrimSuffix(created.Key, "Q3-report-final-.txt")+"other.txt", nil).expect(t, http.StatusNotFound)
+
+	// Files that aren't what was declared are deleted and the upload rejected
+	ts.do(t, "POST", "/api/uploads", `{"filename": "photo.png", "contentType": "image/png", "size": 4}`).
+		expect(t, http.StatusCreated).decode(t, &created)
+	put(created, "much more than four bytes")
+	ts.do(t, "POST", fmt.Sprintf("/api/uploads/%d/complete", created.ID), nil).expect(t, http.StatusUnprocessableEntity).golden(t, "rejected")
+	if bucket.has(created.Key) {
+		t.Errorf("rejected file %s was kept", created.Key)
+	}
+
+	var uploads []models.Upload
+	ts.do(t, "GET", "/api/uploads?"+listParams(`status eq "rejected"`, ""), nil).expect(t, http.StatusOK).decode(t, &uploads)
+	if len(uploads) != 1 || uploads[0].RejectReason != "the file is 25 bytes, not the 4 declared" {
+		t.Errorf("rejected uploads = %+v, want the PNG", uploads)
+	}
+
+	// An upload whose URL has expired can't be completed; the cleanup deletes it and its file
+	ts.do(t, "POST", "/api/uploads", `{"filename": "late.txt", "contentType": "text/plain", "size": 4}`).
+		expect(t, http.StatusCreated).decode(t, &created)
+	put(created, "late")
+	testDB.Model(&models.Upload{}).Where("id = ?", created.ID).Update("expires_at", time.Now().Add(-time.Minute))
+	ts.do(t, "POST", fmt.Sprintf("/api/uploads/%d/complete", created.ID), nil).expect(t, http.StatusGone)
+	output, err := ts.cleanupTask(context.Background(), &cleanupParams{Target: "uploads"})
+	if err != nil || output != "Deleted 1 rows" {
+		t.Errorf("uploads cleanup = %q, %v", output, err)
+	}
+	ts.do(t, "GET", fmt.Sprintf("/api/uploads/%d", created.ID), nil).expect(t, http.StatusNotFound)
+	if bucket.has(created.Key) {
+		t.Errorf("expired file %s was kept", created.Key)
+	}
+
+	ts.do(t, "DELETE", path, nil).expect(t, http.StatusOK)
+	ts.do(t, "GET", path, nil).expect(t, http.StatusNotFound)
+	if bucket.has(upload.Key) {
+		t.Errorf("deleted file %s was kept", upload.Key)
+	}
+}
+
+// fakeS3 is an S3 bucket with just the object calls uploads make; it doesn't check signatures
+type fakeS3 struct {
+	*httptest.Server
+	mu      sync.Mutex
+	objects map[string]fakeS3Object // By bucket/key
+}
+
+type fakeS3Object struct {
+	contentType string
+	body        []byte
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	s3 := &fakeS3{objects: map[string]fakeS3Object{}}
+	s3.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s3.mu.Lock()
+		defer s3.mu.Unlock()
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		object, ok := s3.objects[name]
+		switch {
+		case r.Method == http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			if r.Header.Get("X-Amz-Content-Sha256") == "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
+				body = decodeAWSChunked(body)
+			}
+			s3.objects[name] = fakeS3Object{contentType: r.Header.Get("Content-Type"), body: body}
+			w.Header().Set("ETag", `"etag"`)
+		case r.Method == http.MethodDelete:
+			delete(s3.objects, name)
+			w.WriteHeader(http.StatusNoContent)
+		case !ok:
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				fmt.Fprint(w, `<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+			}
+		default:
+			w.Header().Set("Content-Type", object.contentType)
+			w.Header().Set("Content-Length", strconv.Itoa(len(object.body)))
+			w.Header().Set("ETag", `"etag"`)
+			w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+			if disposition := r.URL.Query().Get("response-content-disposition"); disposition != "" {
+				w.Header().Set("Content-Disposition", disposition)
+			}
+			if r.Method == http.MethodGet {
+				w.Write(object.body)
+			}
+		}
+	}))
+	t.Cleanup(s3.Close)
+	return s3
+}
+
+// decodeAWSChunked returns the payload of a streaming signature V4 upload, which the SDK sends
+// over plain HTTP: chunks of "<size in hex>;chunk-signature=<signature>\r\n<data>\r\n"
+func decodeAWSChunked(body []byte) []byte {
+	var payload []byte
+	for len(body) > 0 {
+		header, rest, _ := bytes.Cut(body, []byte("\r\n"))
+		hexSize, _, _ := bytes.Cut(header, []byte(";"))
+		size, err := strconv.ParseInt(string(hexSize), 16, 64)
+		if err != nil || size == 0 || int(size) > len(rest) {
+			break
+		}
+		payload = append(payload, rest[:size]...)
+		body = bytes.TrimPrefix(rest[size:], []byte("\r\n"))
+	}
+	return payload
+}
+
+// has reports whether the upload bucket has an object at key
+func (s3 *fakeS3) has(key string) bool {
+	s3.mu.Lock()
+	defer s3.mu.Unlock()
+	_, ok := s3.objects["uploads/"+key]
+	return ok
+}
+
+func TestAvatars(t *testing.T) {
+	bucket := newFakeS3(t)
+	ts := newTestServer(t, func(c *Config) {
+		c.Jobs.PollInterval = 10 * time.Millisecond
+		c.Uploads.S3Endpoint = strings.TrimPrefix(bucket.URL, "http://")
+		c.Uploads.S3Insecure = true
+		c.Uploads.S3Bucket = "uploads"
+		c.Uploads.S3AccessKey = "access-key"
+		c.Uploads.S3SecretKey = "secret-key"
+		c.Uploads.ThumbSize = 16
+		c.Uploads.MediumSize = 32
+	})
+	runLeaderTask(t, ts.jobs.run)
+
+	// upload creates, uploads, and completes a file
+	upload := func(filename, contentType string, body []byte) models.Upload {
+		t.Helper()
+		var created models.UploadCreated
+		ts.do(t, "POST", "/api/uploads", models.CreateUploadRequest{Filename: filename, ContentType: contentType, Size: int64(len(body))}).
+			expect(t, http.StatusCreated).decode(t, &created)
+		send(t, "PUT", created.UploadURL, string(body), "Content-Type", contentType).expect(t, http.StatusOK)
+		var upload models.Upload
+		ts.do(t, "POST", fmt.Sprintf("/api/uploads/%d/complete", created.ID), nil).expect(t, http.StatusOK).decode(t, &upload)
+		return upload
+	}
+	// A 64x48 photo taken with the camera on its side, with a location in its EXIF
+	photo := testJPEG(t, 64, 48, 6, "GPS 51.5007N 0.1246W")
+	avatar := upload("me.jpg", "image/jpeg", photo)
+	notes := upload("notes.txt", "text/plain", []byte("not an image"))
+
+	ts.do(t, "PUT", "/api/users/1/avatar", models.SetAvatarRequest{UploadID: notes.ID}).expect(t, http.StatusBadRequest).golden(t, "not-image")
+	ts.do(t, "PUT", "/api/users/1/avatar", models.SetAvatarRequest{UploadID: 99}).expect(t, http.StatusBadRequest)
+	ts.do(t, "PUT", "/api/users/99/avatar", models.SetAvatarRequest{UploadID: avatar.ID}).expect(t, http.StatusNotFound)
+	ts.do(t, "PUT", "/api/users/1/avatar", models.SetAvatarRequest{UploadID: avatar.ID}).expect(t, http.StatusAccepted).golden(t, "processing")
+
+	// The job turns the photo upright, drops its EXIF, and makes the variants
+	if job := waitForJob(t, ts, 1); job.Status != "succeeded" {
+		t.Fatalf("image job = %+v, want succeeded", job)
+	}
+	var ready models.User
+	resp := ts.do(t, "GET", "/api/users/1", nil).expect(t, http.StatusOK)
+	resp.golden(t, "ready")
+	resp.decode(t, &ready)
+	for variant, want := range map[string]image.Point{"": {48, 64}, "?variant=thumb": {12, 16}, "?variant=medium": {24, 32}} {
+		got := ts.do(t, "GET", ready.Avatar.URL+variant, nil).expect(t, http.StatusOK)
+		decoded, err := jpeg.DecodeConfig(bytes.NewReader(got.body))
+		if err != nil || decoded.Width != want.X || decoded.Height != want.Y {
+			t.Errorf("download%s = %dx%d (%v), want %dx%d", variant, decoded.Width, decoded.Height, err, want.X, want.Y)
+		}
+		if bytes.Contains(got.body, []byte("GPS")) {
+			t.Errorf("download%s kept the EXIF", variant)
+		}
+	}
+	ts.do(t, "GET", ready.Avatar.URL+"?variant=huge", nil).expect(t, http.StatusNotFound)
+
+	// A file that isn't the image it claims to be fails for good
+	fake := upload("fake.png", "image/png", photo)
+	ts.do(t, "PUT", "/api/users/2/avatar", models.SetAvatarRequest{UploadID: fake.ID}).expect(t, http.StatusAccepted)
+	if job := waitForJob(t, ts, 2); job.Status != "dead" || job.Attempts != 1 {
+		t.Errorf("image job = %+v, want dead after 1 attempt", job)
+	}
+	var user models.User
+	ts.do(t, "GET", "/api/users/2", nil).expect(t, http.StatusOK).decode(t, &user)
+	if user.Avatar == nil || user.Avatar.Status != "failed" || user.Avatar.Variants != nil {
+		t.Errorf("avatar = %+v, want failed", user.Avatar)
+	}
+	var removed models.User
+	ts.do(t, "DELETE", "/api/users/2/avatar", nil).expect(t, http.StatusOK).decode(t, &removed)
+	if removed.Avatar != nil {
+		t.Errorf("avatar = %+v after removing it", removed.Avatar)
+	}
+
+	// Deleting the upload deletes its variants and takes it away from the user
+	ts.do(t, "DELETE", fmt.Sprintf("/api/uploads/%d", avatar.ID), nil).expect(t, http.StatusOK)
+	var deleted models.User
+	ts.do(t, "GET", "/api/users/1", nil).expect(t, http.StatusOK).decode(t, &deleted)
+	if deleted.Avatar != nil {
+		t.Errorf("avatar = %+v after deleting its upload", deleted.Avatar)
+	}
+	if bucket.has(path.Dir(avatar.Key) + "/variants/thumb.jpg") {
+		t.Error("the thumb variant was kept")
+	}
+}
+
+// testJPEG encodes a width by height JPEG with an EXIF orientation, and comment in its EXIF
+func testJPEG(t *testing.T, width, height, orientation int, comment string) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{200, 80, 40, 255}), image.Point{}, draw.Src)
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	// A big-endian TIFF with one IFD entry, Orientation, and the comment after it
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 1, 0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, byte(orientation), 0, 0, 0, 0, 0, 0}
+	segment := append(append([]byte("Exif\x00\x00"), tiff...), comment...)
+	app1 := append([]byte{0xFF, 0xE1, byte((len(segment) + 2) >> 8), byte(len(segment) + 2)}, segment...)
+	data := encoded.Bytes()
+	return append(append(append([]byte{}, data[:2]...), app1...), data[2:]...)
+}
+
+func TestSearch(t *testing.T) {
+	ts := newTestServer(t)
+	ts.do(t, "POST", "/api/announcements", `{"message": "Dark mode is coming to every zone"}`).expect(t, http.StatusCreated)
+
+	// search returns the types, IDs, and facets of a search's results, which don't depend on the
+	// ranks the dialects give them
+	search := func(query string) ([]string, map[string]int64) {
+		t.Helper()
+		var response models.SearchResponse
+		ts.do(t, "GET", "/api/search?"+query, nil).expect(t, http.StatusOK).decode(t, &response)
+		found := make([]string, len(response.Results))
+		for i, result := range response.Results {
+			found[i] = result.Type + ":" + result.ID
+		}
+		slices.Sort(found)
+		return found, response.Facets
+	}
+
+	found, facets := search("q=dark")
+	if want := []string{"announcement:1", "flag:dark_mode"}; !slices.Equal(found, want) {
+		t.Errorf("q=dark found %v, want %v", found, want)
+	}
+	if want := map[string]int64{"user": 0, "flag": 1, "announcement": 1}; !maps.Equal(facets, want) {
+		t.Errorf("q=dark facets = %v, want %v", facets, want)
+	}
+	// Every word has to match, and a word matches the start of a longer one
+	if found, _ := search("q=New+Dash"); !slices.Equal(found, []string{"flag:new_dashboard"}) {
+		t.Errorf("q=New+Dash found %v", found)
+	}
+	if found, _ := search("q=dave+brown"); !slices.Equal(found, []string{"user:4"}) {
+		t.Errorf("q=dave+brown found %v", found)
+	}
+	// ?type= narrows the results but not the facets
+	found, facets = search("q=dark&type=announcement")
+	if !slices.Equal(found, []string{"announcement:1"}) || facets["flag"] != 1 {
+		t.Errorf("q=dark&type=announcement found %v with facets %v", found, facets)
+	}
+	if found, _ := search("q=e&limit=2"); len(found) != 2 {
+		t.Errorf("q=e&limit=2 found %v", found)
+	}
+
+	var response models.SearchResponse
+	ts.do(t, "GET", "/api/search?q=full-text", nil).expect(t, http.StatusOK).decode(t, &response)
+	if len(response.Results) != 1 || response.Results[0].URL != "/api/feature-flags/beta_search" {
+		t.Errorf("q=full-text = %+v", response.Results)
+	}
+
+	ts.do(t, "GET", "/api/search?q=!!!", nil).expect(t, http.StatusBadRequest).golden(t, "no-words")
+	ts.do(t, "GET", "/api/search?q=dark&type=zone", nil).expect(t, http.StatusBadRequest).golden(t, "bad-type")
+	ts.do(t, "GET", "/api/search?q=dark&limit=0", nil).expect(t, http.StatusBadRequest)
+}
+
+func TestActivity(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.do(t, "PATCH", "/api/feature-flags/dark_mode", `{"enabled": false}`).expect(t, http.StatusOK)
+	ts.do(t, "DELETE", "/api/users/2", nil).expect(t, http.StatusOK)
+	ts.changes.observeZoneStatus(models.ZoneStatus{Name: "zone-main", Status: "healthy"})
+	ts.changes.observeZoneStatus(models.ZoneStatus{Name: "zone-main", Status: "unhealthy", Message: "connection refused"})
+	deployment := `{"action":"created","deployment":{"environment":"zone-admin","ref":"main","sha":"f00dfeed"},` +
+		`"deployment_status":{"state":"success"},"sender":{"login":"dave"}}`
+	ts.do(t, "POST", "/api/webhooks/github", deployment,
+		"X-GitHub-Event", "deployment_status",
+		"X-GitHub-Delivery", "delivery-1",
+		"X-Hub-Signature-256", signGitHubPayload(deployment),
+	).expect(t, http.StatusAccepted)
+
+	// summaries returns the summaries of GET /api/activity with query, newest first
+	summaries := func(query string) []string {
+		t.Helper()
+		var events []models.ActivityEvent
+		ts.do(t, "GET", "/api/activity"+query, nil).expect(t, http.StatusOK).decode(t, &events)
+		found := make([]string, len(events))
+		for i, event := range events {
+			found[i] = event.Type + " " + event.Action + ": " + event.Summary
+		}
+		return found
+	}
+
+	want := []string{
+		"deployment success: Deployment of zone-admin at main by dave: success",
+		"zone incident: zone-main is unhealthy: connection refused",
+		"user deleted: User 2 was deleted",
+		"flag updated: Flag dark_mode was updated",
+	}
+	if found := summaries(""); !slices.Equal(found, want) {
+		t.Errorf("activity = %q, want %q", found, want)
+	}
+	if found := summaries("?" + listParams(`type eq "flag" or type eq "user"`, "")); !slices.Equal(found, want[2:]) {
+		t.Errorf("flag and user activity = %q", found)
+	}
+	if found := summaries("?pageSize=1&page=2"); !slices.Equal(found, want[1:2]) {
+		t.Errorf("second page of activity = %q", found)
+	}
+	ts.do(t, "GET", "/api/activity?"+listParams(`actor eq "dave"`, ""), nil).expect(t, http.StatusBadRequest)
+}
+
+func TestRetention(t *testing.T) {
+	ts := newTestServer(t)
+	old := time.Now().AddDate(-2, 0, 0)
+	testDB.Create(&models.ActivityEvent{Type: "flag", Action: "created", Subject: "dark_mode", Summary: "Flag dark_mode was created", CreatedAt: old})
+	testDB.Create(&[]models.ZoneRouteChange{
+		{RouteID: 1, Action: "created", Path: "/shop/*", Zone: "zone-main", ChangedBy: "test", CreatedAt: old},
+		{RouteID: 1, Action: "deleted", Path: "/shop/*", PreviousZone: "zone-main", ChangedBy: "test", CreatedAt: old},
+	})
+	ts.do(t, "PATCH", "/api/feature-flags/dark_mode", `{"enabled": false}`).expect(t, http.StatusOK)
+
+	// due returns how many rows each cleanup would delete
+	due := func() map[string]int64 {
+		t.Helper()
+		var policies []models.RetentionPolicy
+		ts.do(t, "GET", "/api/retention", nil).expect(t, http.StatusOK).decode(t, &policies)
+		counts := map[string]int64{}
+		for _, policy := range policies {
+			counts[policy.Target] = policy.Due
+		}
+		return counts
+	}
+
+	// The fixtures' deployments are from 2024; the latest routing change is kept for the manifest's version
+	if counts := due(); counts["health"] != 3 || counts["audit"] != 2 {
+		t.Errorf("due = %v, want 3 health and 2 audit rows", counts)
+	}
+	output, err := ts.cleanupTask(context.Background(), &cleanupParams{Target: "audit", DryRun: true})
+	if err != nil || output != "Would delete 2 rows" {
+		t.Errorf("audit dry run = %q, %v", output, err)
+	}
+	output, err = ts.cleanupTask(context.Background(), &cleanupParams{Target: "audit"})
+	if err != nil || output != "Deleted 2 rows" {
+		t.Errorf("audit cleanup = %q, %v", output, err)
+	}
+	if counts := due(); counts["audit"] != 0 || counts["health"] != 3 {
+		t.Errorf("due after the audit cleanup = %v", counts)
+	}
+	var activity, changes int64
+	testDB.Model(&models.ActivityEvent{}).Count(&activity)
+	testDB.Model(&models.ZoneRouteChange{}).Count(&changes)
+	if activity != 1 || changes != 1 {
+		t.Errorf("%d activity events and %d routing changes left, want 1 of each", activity, changes)
+	}
+
+	ts.config.Retention.HealthDays = 0 // Read when the policies are listed
+	if counts := due(); counts["health"] != 0 {
+		t.Errorf("health due with RETENTION_HEALTH_DAYS=0: %d", counts["health"])
+	}
+}
+
+func TestBundle(t *testing.T) {
+	ts := newTestServer(t)
+	ts.do(t, "POST", "/api/zone-routes", `{"path": "/admin/*", "zone": "zone-admin"}`).expect(t, http.StatusCreated)
+	ts.do(t, "POST", "/api/navigation/items", `{"key": "flags", "label": "Flags", "href": "/admin/flags", "zone": "zone-admin"}`).expect(t, http.StatusCreated)
+	ts.do(t, "POST", "/api/announcements", `{"message": "Welcome!", "zones": ["zone-main"]}`).expect(t, http.StatusCreated)
+
+	var bundle models.Bundle
+	got := ts.do(t, "GET", "/api/export/bundle", nil).expect(t, http.StatusOK)
+	got.decode(t, &bundle)
+	if !strings.HasPrefix(got.header.Get("Content-Disposition"), `attachment; filename="bundle-`) {
+		t.Errorf("Content-Disposition = %q, want a bundle file", got.header.Get("Content-Disposition"))
+	}
+	if bundle.Version != 1 || len(bundle.FeatureFlags) != 3 || len(bundle.Announcements) != 1 || len(bundle.Navigation) != 1 || len(bundle.ZoneRoutes) != 1 {
+		t.Fatalf("bundle = %+v, want the fixtures' flags and one of everything else", bundle)
+	}
+
+	// The environment drifts: a flag is deleted and another turned on, the route moves, and a new item is added
+	ts.do(t, "DELETE", "/api/feature-flags/beta_search", nil).expect(t, http.StatusOK)
+	ts.do(t, "PATCH", "/api/feature-flags/dark_mode", `{"enabled": true}`).expect(t, http.StatusOK)
+	ts.do(t, "PATCH", "/api/zone-routes/1", `{"zone": "zone-main"}`).expect(t, http.StatusOK)
+	ts.do(t, "POST", "/api/navigation/items", `{"key": "docs", "label": "Docs", "href": "https://example.com/docs"}`).expect(t, http.StatusCreated)
+
+	// A dry run lists what restoring the bundle changes, and changes nothing
+	var preview models.BundleImportResponse
+	ts.do(t, "POST", "/api/import/bundle?dryRun=true", bundle).expect(t, http.StatusOK).decode(t, &preview)
+	var changes []string
+	for _, change := range preview.Changes {
+		changes = append(changes, fmt.Sprintf("%s %s %s %v", change.Action, change.Resource, change.Key, change.Fields))
+	}
+	want := []string{
+		"created featureFlag beta_search []",
+		"updated featureFlag dark_mode [enabled]",
+		"deleted navigationItem docs []",
+		"updated zoneRoute /admin/* [zone]",
+	}
+	if !preview.DryRun || preview.Unchanged != 3 || !slices.Equal(changes, want) {
+		t.Errorf("preview = %v (%d unchanged), want %v", changes, preview.Unchanged, want)
+	}
+	ts.do(t, "GET", "/api/feature-flags/beta_search", nil).expect(t, http.StatusNotFound)
+
+	// Importing makes the environment match the bundle again; the flag is visible right away
+	var result models.BundleImportResponse
+	ts.do(t, "POST", "/api/import/bundle", bundle).expect(t, http.StatusOK).decode(t, &result)
+	if result.DryRun || len(result.Changes) != 4 {
+		t.Errorf("import = %+v, want the previewed changes", result)
+	}
+	var flag models.FeatureFlag
+	ts.do(t, "GET", "/api/feature-flags/dark_mode", nil).expect(t, http.StatusOK).decode(t, &flag)
+	if flag.Enabled {
+		t.Error("dark_mode is still on after the import")
+	}
+	ts.do(t, "GET", "/api/feature-flags/beta_search", nil).expect(t, http.StatusOK)
+	ts.do(t, "GET", "/api/navigation/items/docs", nil).expect(t, http.StatusNotFound)
+	var routeChanges []models.ZoneRouteChange
+	ts.do(t, "GET", "/api/zone-routes/changes", nil).expect(t, http.StatusOK).decode(t, &routeChanges)
+	if len(routeChanges) != 3 || routeChanges[0].Zone != "zone-admin" || routeChanges[0].PreviousZone != "zone-main" {
+		t.Errorf("routing changes = %+v, want the import's move back to zone-admin last", routeChanges)
+	}
+
+	ts.do(t, "POST", "/api/import/bundle", bundle).expect(t, http.StatusOK).decode(t, &result)
+	if len(result.Changes) != 0 || result.Unchanged != 6 {
+		t.Errorf("second import = %+v, want nothing to change", result)
+	}
+
+	ts.do(t, "POST", "/api/import/bundle", `{"version": 2}`).expect(t, http.StatusBadRequest)
+	ts.do(t, "POST", "/api/import/bundle", `{"version": 1, "zoneRoutes": [{"path": "/shop/*", "zone": "zone-shop"}], "featureFlags": [
+		{"key": "a", "name": "A"}, {"key": "a", "name": "A again"}]}`).expect(t, http.StatusBadRequest).golden(t, "invalid")
+}
+
+func TestApplyFeatureFlags(t *testing.T) {
+	ts := newTestServer(t)
+
+	// The desired state is the flag export, edited: dark_mode is on, beta_search is gone, and there is a new flag
+	var flags []models.FeatureFlag
+	ts.do(t, "GET", "/api/feature-flags", nil).expect(t, http.StatusOK).decode(t, &flags)
+	state := []models.FeatureFlag{flags[0], flags[1], {Key: "checkout_v2", Name: "Checkout v2"}}
+	state[1].Enabled = true
+	if state[1].Key != "dark_mode" {
+		t.Fatalf("flags = %+v, want the fixtures in ID order", flags)
+	}
+
+	var preview models.BundleImportResponse
+	ts.do(t, "POST", "/api/feature-flags/apply?dryRun=true&prune=true", state).expect(t, http.StatusOK).decode(t, &preview)
+	var changes []string
+	for _, change := range preview.Changes {
+		changes = append(changes, fmt.Sprintf("%s %s %v", change.Action, change.Key, change.Fields))
+	}
+	want := []string{"updated dark_mode [enabled]", "created checkout_v2 []", "deleted beta_search []"}
+	if !preview.DryRun || preview.Unchanged != 1 || !slices.Equal(changes, want) {
+		t.Errorf("preview = %v (%d unchanged), want %v", changes, preview.Unchanged, want)
+	}
+	ts.do(t, "GET", "/api/feature-flags/checkout_v2", nil).expect(t, http.StatusNotFound)
+
+	// Without ?prune=true the flags the list doesn't have are kept
+	ts.do(t, "POST", "/api/feature-flags/apply?dryRun=true", state).expect(t, http.StatusOK).decode(t, &preview)
+	if len(preview.Changes) != 2 {
+		t.Errorf("preview without prune = %+v, want beta_search kept", preview.Changes)
+	}
+
+	// The same state as YAML, as CI would apply it from the repository
+	yamlState := `
+- {key: new_dashboard, name: New Dashboard, description: Redesigned admin dashboard, enabled: true}
+- {key: dark_mode, name: Dark Mode, description: Dark theme for every zone, enabled: true}
+- {key: checkout_v2, name: Checkout v2}
+`
+	var result models.BundleImportResponse
+	ts.do(t, "POST", "/api/feature-flags/apply?prune=true", yamlState, "Content-Type", "application/yaml").expect(t, http.StatusOK).decode(t, &result)
+	if result.DryRun || len(result.Changes) != 3 {
+		t.Errorf("apply = %+v, want the previewed changes", result)
+	}
+	var flag models.FeatureFlag
+	ts.do(t, "GET", "/api/feature-flags/dark_mode", nil).expect(t, http.StatusOK).decode(t, &flag)
+	if !flag.Enabled {
+		t.Error("dark_mode is still off after applying")
+	}
+	ts.do(t, "GET", "/api/feature-flags/beta_search", nil).expect(t, http.StatusNotFound)
+	ts.do(t, "GET", "/api/feature-flags/checkout_v2", nil).expect(t, http.StatusOK)
+
+	// The NDJSON export has every flag, and applies back unchanged
+	export := ts.do(t, "GET", "/api/feature-flags", nil, "Accept", "application/x-ndjson").expect(t, http.StatusOK)
+	ts.do(t, "POST", "/api/feature-flags/apply?prune=true", string(export.body), "Content-Type", "application/x-ndjson").
+		expect(t, http.StatusOK).decode(t, &result)
+	if len(result.Changes) != 0 || result.Unchanged != 3 {
+		t.Errorf("applying the export = %+v, want nothing to change", result)
+	}
+
+	ts.do(t, "POST", "/api/feature-flags/apply", `{"key": "dark_mode"}`).expect(t, http.StatusBadRequest)
+	ts.do(t, "POST", "/api/feature-flags/apply?prune=true", `[]`).expect(t, http.StatusBadRequest)
+	ts.do(t, "POST", "/api/feature-flags/apply", `[{"key": "Dark Mode", "name": "Dark"}, {"key": "a", "name": "A"}, {"key": "a", "name": "A"}]`).
+		expect(t, http.StatusBadRequest).golden(t, "invalid")
+}
+
+func TestMaintenance(t *testing.T) {
+	ts := newTestServer(t)
+	// Seen healthy (zone-main) and degraded (zone-admin) before any maintenance
+	ts.checkAllZones()
+
+	ts.do(t, "PUT", "/api/maintenance", `{"message": "", "allowedIps": ["nope"]}`).expect(t, http.StatusBadRequest).golden(t, "invalid")
+	ts.do(t, "PUT", "/api/maintenance", fmt.Sprintf(`{"message": "Later", "endsAt": %q}`, time.Now().Add(-time.Hour).Format(time.RFC3339))).
+		expect(t, http.StatusBadRequest)
+	ts.do(t, "PUT", "/api/zones/zone-shop/maintenance", `{"message": "Closed"}`).expect(t, http.StatusNotFound)
+	ts.do(t, "DELETE", "/api/maintenance", nil).expect(t, http.StatusNotFound)
+
+	var status models.MaintenanceStatus
+	ts.do(t, "GET", "/api/zones/zone-main/maintenance", nil).expect(t, http.StatusOK).decode(t, &status)
+	if status.Maintenance || status.Show {
+		t.Errorf("status before maintenance = %+v, want none", status)
+	}
+
+	// Every zone's maintenance, then zone-admin's own, which takes precedence for zone-admin
+	ts.do(t, "PUT", "/api/maintenance", models.SetMaintenanceRequest{Message: "Upgrading", AllowedIPs: []string{"203.0.113.7", "10.0.0.0/8"}}).
+		expect(t, http.StatusOK)
+	ts.do(t, "PUT", "/api/zones/zone-admin/maintenance", models.SetMaintenanceRequest{Message: "Admin is moving"}).expect(t, http.StatusOK)
+	var modes []models.MaintenanceMode
+	ts.do(t, "GET", "/api/maintenance", nil).expect(t, http.StatusOK).decode(t, &modes)
+	if len(modes) != 2 || modes[0].Zone != "" || modes[1].Zone != "zone-admin" {
+		t.Fatalf("maintenance modes = %+v, want every zone's, then zone-admin's", modes)
+	}
+
+	for _, tc := range []struct {
+		path          string
+		show, global  bool
+		wantedMessage string
+	}{
+		{"/api/zones/zone-main/maintenance?ip=198.51.100.1", true, true, "Upgrading"},
+		{"/api/zones/zone-main/maintenance?ip=203.0.113.7", false, true, "Upgrading"},
+		{"/api/zones/zone-main/maintenance?ip=10.1.2.3", false, true, "Upgrading"},
+		{"/api/zones/zone-admin/maintenance?ip=203.0.113.7", true, false, "Admin is moving"},
+	} {
+		ts.do(t, "GET", tc.path, nil).expect(t, http.StatusOK).decode(t, &status)
+		if !status.Maintenance || status.Show != tc.show || status.Global != tc.global || status.Message != tc.wantedMessage {
+			t.Errorf("%s = %+v, want show %v, global %v, %q", tc.path, status, tc.show, tc.global, tc.wantedMessage)
+		}
+	}
+	ts.do(t, "GET", "/api/zones/zone-main/maintenance?ip=office", nil).expect(t, http.StatusBadRequest)
+
+	// Zones in maintenance aren't down; zone-main went into it from healthy
+	for _, zone := range ts.checkAllZones() {
+		if zone.Status != "maintenance" {
+			t.Errorf("zone %s = %s (%s), want maintenance", zone.Name, zone.Status, zone.Message)
+		}
+	}
+	ts.do(t, "DELETE", "/api/maintenance", nil).expect(t, http.StatusOK)
+	ts.do(t, "DELETE", "/api/zones/zone-admin/maintenance", nil).expect(t, http.StatusOK)
+	ts.checkAllZones()
+
+	var events []models.ActivityEvent
+	testDB.Where("type = ?", "zone").Order("id").Find(&events)
+	var actions []string
+	for _, event := range events {
+		actions = append(actions, event.Subject+" "+event.Action)
+	}
+	// zone-admin comes out of maintenance still degraded, which is an incident
+	want := []string{"zone-main maintenance", "zone-admin maintenance", "zone-main maintenance-ended", "zone-admin incident"}
+	if !reflect.DeepEqual(actions, want) {
+		t.Errorf("zone activity = %v, want %v", actions, want)
+	}
+}
+
+func TestIncidentFeed(t *testing.T) {
+	ts := newTestServer(t)
+	start := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	testDB.Create(&[]models.ActivityEvent{
+		{Type: "zone", Action: "incident", Subject: "zone-admin", Zone: "zone-admin", Summary: "zone-admin is unhealthy: HTTP 503", CreatedAt: start},
+		{Type: "zone", Action: "recovered", Subject: "zone-admin", Zone: "zone-admin", Summary: "zone-admin is healthy again", CreatedAt: start.Add(time.Hour)},
+		{ProjectID: 1, Type: "flag", Action: "created", Subject: "dark_mode", Summary: "Flag dark_mode was created", CreatedAt: start.Add(2 * time.Hour)},
+	})
+
+	got := ts.do(t, "GET", "/api/incidents/feed.atom", nil).expect(t, http.StatusOK)
+	if got.header.Get("Content-Type") != "application/atom+xml; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got.header.Get("Content-Type"))
+	}
+	var feed struct {
+		ID      string `xml:"id"`
+		Updated string `xml:"updated"`
+		Entries []struct {
+			ID        string `xml:"id"`
+			Title     string `xml:"title"`
+			Published string `xml:"published"`
+			Summary   string `xml:"summary"`
+			Link      struct {
+				Href string `xml:"href,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(got.body, &feed); err != nil {
+		t.Fatalf("Failed to decode the feed: %v; body: %s", err, got.body)
+	}
+
+	// Only the zone events, newest first, with stable IDs and the status page as their link
+	if feed.Updated != "2024-05-01T10:00:00Z" || len(feed.Entries) != 2 {
+		t.Fatalf("feed = %+v, want the two zone events", feed)
+	}
+	recovery, incident := feed.Entries[0], feed.Entries[1]
+	if recovery.Title != "zone-admin recovered" || recovery.ID != "urn:nextjs-microfrontend:incidents:2" {
+		t.Errorf("first entry = %+v, want the recovery", recovery)
+	}
+	if incident.Title != "zone-admin incident" || incident.Published != "2024-05-01T09:00:00Z" || incident.Summary != "zone-admin is unhealthy: HTTP 503" {
+		t.Errorf("second entry = %+v, want the incident", incident)
+	}
+	if !strings.HasPrefix(incident.Link.Href, "http://") || !strings.HasSuffix(incident.Link.Href, "/dashboard/") {
+		t.Errorf("entry link = %q, want the status page's absolute URL", incident.Link.Href)
+	}
+}
+
+func TestTranslations(t *testing.T) {
+	ts := newTestServer(t)
+	ts.do(t, "PUT", "/api/feature-flags/dark_mode/translations/de", `{"name": "Dunkelmodus", "description": "Dunkles Design für alle Zonen"}`).expect(t, http.StatusOK)
+	ts.do(t, "PUT", "/api/feature-flags/dark_mode/translations/pt-br", `{"name": "Modo escuro"}`).expect(t, http.StatusOK)
+	ts.do(t, "PUT", "/api/feature-flags/dark_mode/translations/x!", `{"name": "x"}`).expect(t, http.StatusBadRequest)
+	ts.do(t, "PUT", "/api/feature-flags/missing/translations/de", `{"name": "x"}`).expect(t, http.StatusNotFound)
+	ts.do(t, "GET", "/api/feature-flags/dark_mode/translations", nil).expect(t, http.StatusOK).golden(t, "flag")
+
+	// flag fetches dark_mode for a client that accepts the given languages
+	flag := func(acceptLanguage string) models.FeatureFlag {
+		t.Helper()
+		var flag models.FeatureFlag
+		got := ts.do(t, "GET", "/api/feature-flags/dark_mode", nil, "Accept-Language", acceptLanguage).expect(t, http.StatusOK)
+		got.decode(t, &flag)
+		if !strings.Contains(strings.Join(got.header.Values("Vary"), ","), "Accept-Language") {
+			t.Errorf("Vary = %q, want Accept-Language", got.header.Values("Vary"))
+		}
+		return flag
+	}
+	if got := flag("de-AT, en;q=0.5"); got.Name != "Dunkelmodus" || got.Description != "Dunkles Design für alle Zonen" {
+		t.Errorf("de-AT flag = %q, %q", got.Name, got.Description)
+	}
+	// Without a translated description the English one stays
+	if got := flag("pt-BR"); got.Name != "Modo escuro" || got.Description != "Dark theme for every zone" {
+		t.Errorf("pt-BR flag = %q, %q", got.Name, got.Description)
+	}
+	if got := flag("fr, en;q=0.8"); got.Name != "Dark Mode" {
+		t.Errorf("fr flag = %q, want the English name", got.Name)
+	}
+
+	var flags []models.FeatureFlag
+	ts.do(t, "GET", "/api/feature-flags", nil, "Accept-Language", "de").expect(t, http.StatusOK).decode(t, &flags)
+	names := map[string]string{}
+	for _, f := range flags {
+		names[f.Key] = f.Name
+	}
+	if names["dark_mode"] != "Dunkelmodus" || names["beta_search"] != "Beta Search" {
+		t.Errorf("names in German = %v", names)
+	}
+
+	ts.do(t, "POST", "/api/announcements", `{"message": "Scheduled maintenance tonight"}`).expect(t, http.StatusCreated)
+	ts.do(t, "PUT", "/api/announcements/1/translations/de", `{"message": "Heute Nacht geplante Wartung"}`).expect(t, http.StatusOK)
+	var active []models.Announcement
+	ts.do(t, "GET", "/api/announcements/active", nil, "Accept-Language", "de-DE").expect(t, http.StatusOK).decode(t, &active)
+	if len(active) != 1 || active[0].Message != "Heute Nacht geplante Wartung" || active[0].Locale != "de" {
+		t.Errorf("active announcements in German = %+v", active)
+	}
+	ts.do(t, "GET", "/api/announcements/active", nil).expect(t, http.StatusOK).decode(t, &active)
+	if active[0].Message != "Scheduled maintenance tonight" || active[0].Locale != "" {
+		t.Errorf("active announcements without Accept-Language = %+v", active)
+	}
+
+	ts.do(t, "DELETE", "/api/feature-flags/dark_mode/translations/de", nil).expect(t, http.StatusOK)
+	ts.do(t, "DELETE", "/api/feature-flags/dark_mode/translations/de", nil).expect(t, http.StatusNotFound)
+	if got := flag("de"); got.Name != "Dark Mode" {
+		t.Errorf("flag after deleting the German translation = %q", got.Name)
+	}
+
+	// Deleting an announcement deletes its translations
+	ts.do(t, "DELETE", "/api/announcements/1", nil).expect(t, http.StatusOK)
+	var left int64
+	testDB.Model(&models.Translation{}).Where("resource = ?", "announcement").Count(&left)
+	if left != 0 {
+		t.Errorf("%d announcement translations left after deleting it", left)
+	}
+}
+
+func TestFaultInjection(t *testing.T) {
+	ts := newTestServer(t, func(c *Config) { c.Server.ChaosEnabled = true })
+
+	ts.doInternal(t, "POST", "/internal/faults", `{"kind": "latency", "latency": "2h", "duration": "1m"}`).expect(t, http.StatusBadRequest)
+	ts.doInternal(t, "POST", "/internal/faults", `{"kind": "error", "rate": 2, "duration": "1m"}`).expect(t, http.StatusBadRequest)
+	ts.doInternal(t, "POST", "/internal/faults", `{"kind": "error", "duration": "48h"}`).expect(t, http.StatusBadRequest)
+	ts.doInternal(t, "POST", "/internal/faults", `{"kind": "unhealthy", "zone": "zone-shop", "duration": "1m"}`).expect(t, http.StatusBadRequest)
+
+	var latency fault
+	ts.doInternal(t, "POST", "/internal/faults", `{"kind": "latency", "route": "/api/users", "latency": "200ms", "duration": "1m"}`).
+		expect(t, http.StatusCreated).decode(t, &latency)
+	start := time.Now()
+	resp := ts.do(t, "GET", "/api/users", nil).expect(t, http.StatusOK)
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("GET /api/users took %s with a 200ms latency fault", elapsed)
+	}
+	if got := resp.header.Get("X-Injected-Fault"); got != strconv.Itoa(latency.ID) {
+		t.Errorf("X-Injected-Fault = %q, want %d", got, latency.ID)
+	}
+	if got := ts.do(t, "GET", "/api/feature-flags", nil).expect(t, http.StatusOK).header.Get("X-Injected-Fault"); got != "" {
+		t.Errorf("X-Injected-Fault on another route = %q", got)
+	}
+
+	ts.doInternal(t, "POST", "/internal/faults", `{"kind": "error", "route": "/api/feature-flags", "duration": "1m"}`).expect(t, http.StatusCreated)
+	resp = ts.do(t, "GET", "/api/feature-flags", nil).expect(t, http.StatusServiceUnavailable)
+	if resp.header.Get("X-Injected-Fault") != "2" || resp.header.Get("Retry-After") != "1" {
+		t.Errorf("injected error headers = %v", resp.header)
+	}
+	ts.do(t, "GET", "/health", nil).expect(t, http.StatusOK)
+
+	// zone-main answers its health check, but is reported unhealthy while the fault lasts
+	ts.doInternal(t, "POST", "/internal/faults", `{"kind": "unhealthy", "zone": "zone-main", "duration": "1m"}`).expect(t, http.StatusCreated)
+	for _, zone := range ts.checkAllZones() {
+		if zone.Name == "zone-main" && (zone.Status != "unhealthy" || zone.Message != "Injected fault 3") {
+			t.Errorf("zone-main = %s (%s), want unhealthy from the fault", zone.Status, zone.Message)
+		}
+	}
+
+	var faults []fault
+	ts.doInternal(t, "GET", "/internal/faults", nil).expect(t, http.StatusOK).decode(t, &faults)
+	if len(faults) != 3 || faults[0].Kind != "latency" || faults[0].Latency != "200ms" || faults[1].Status != http.StatusServiceUnavailable || faults[2].Rate != 1 {
+		t.Fatalf("faults = %+v", faults)
+	}
+	ts.doInternal(t, "DELETE", "/internal/faults/1", nil).expect(t, http.StatusOK)
+	ts.doInternal(t, "DELETE", "/internal/faults/1", nil).expect(t, http.StatusNotFound)
+	ts.doInternal(t, "DELETE", "/internal/faults", nil).expect(t, http.StatusOK)
+	ts.do(t, "GET", "/api/feature-flags", nil).expect(t, http.StatusOK)
+	for _, zone := range ts.checkAllZones() {
+		if zone.Name == "zone-main" && zone.Status != "healthy" {
+			t.Errorf("zone-main after clearing the faults = %s, want healthy", zone.Status)
+		}
+	}
+}
+
+func TestMockZone(t *testing.T) {
+	options := mockZoneOptions{Name: "zone-main", Behavior: "healthy", Status: http.StatusBadGateway, Latency: "0s", ErrorRate: 0.5, Period: "1h"}
+	if err := options.validate(); err != nil {
+		t.Fatal(err)
+	}
+	zone := httptest.NewServer(newMockZone(options, nil))
+	defer zone.Close()
+	ts := newTestServer(t, func(c *Config) { c.Zones.MainURL = zone.URL })
+
+	mainStatus := func() models.ZoneStatus {
+		t.Helper()
+		for _, status := range ts.checkAllZones() {
+			if status.Name == "zone-main" {
+				return status
+			}
+		}
+		t.Fatal("zone-main wasn't checked")
+		return models.ZoneStatus{}
+	}
+	for _, tc := range []struct {
+		query, want, message string
+	}{
+		{"", "healthy", "Zone is responding"},
+		{"?behavior=degraded", "degraded", "HTTP 502"},
+		{"?behavior=down", "unhealthy", "Connection failed"},
+		{"?behavior=flaky&error-rate=1&status=500", "degraded", "HTTP 500"},
+		{"?behavior=healthy", "healthy", "Zone is responding"},
+	} {
+		send(t, "PUT", zone.URL+"/_mockzone"+tc.query, nil).expect(t, http.StatusOK)
+		if status := mainStatus(); status.Status != tc.want || !strings.HasPrefix(status.Message, tc.message) {
+			t.Errorf("zone-main with %q = %s (%s), want %s", tc.query, status.Status, status.Message, tc.want)
+		}
+	}
+	send(t, "PUT", zone.URL+"/_mockzone?behavior=sleepy", nil).expect(t, http.StatusBadRequest)
+
+	// One incident from degraded to healthy again; unhealthy and degraded in between are the same incident
+	var actions []string
+	testDB.Model(&models.ActivityEvent{}).Where("type = ? AND subject = ?", "zone", "zone-main").Order("id").Pluck("action", &actions)
+	if !slices.Equal(actions, []string{"incident", "recovered"}) {
+		t.Errorf("zone-main activity = %v, want an incident and its recovery", actions)
+	}
+}
+
+func TestSettings(t *testing.T) {
+	ts := newTestServer(t)
+
+	var settings models.Settings
+	ts.do(t, "GET", "/api/settings", nil).expect(t, http.StatusOK).decode(t, &settings)
+	if settings != defaultSettings() {
+		t.Errorf("settings before any was set = %+v, want the defaults", settings)
+	}
+
+	ts.do(t, "PATCH", "/api/settings", `{"siteTitle": "", "supportEmail": "nope", "defaultLocale": "xx-!!", "dashboardRefreshSeconds": 1}`).
+		expect(t, http.StatusBadRequest).golden(t, "invalid")
+	cursor := ts.Server.changes.latest()
+	ts.do(t, "PATCH", "/api/settings", `{"siteTitle": "Acme", "supportEmail": "help@acme.test", "defaultLocale": "pt-br"}`).
+		expect(t, http.StatusOK).decode(t, &settings)
+	want := models.Settings{SiteTitle: "Acme", SupportEmail: "help@acme.test", DefaultLocale: "pt-BR", DashboardRefreshSeconds: 30}
+	if settings != want {
+		t.Errorf("settings after PATCH = %+v, want %+v", settings, want)
+	}
+	// Read straight after the change, not from the cache of the first GET
+	ts.do(t, "GET", "/api/settings", nil).expect(t, http.StatusOK).decode(t, &settings)
+	if settings != want {
+		t.Errorf("GET after PATCH = %+v, want %+v", settings, want)
+	}
+	changes, _, _, _ := ts.Server.changes.since(cursor)
+	if len(changes) != 3 || changes[0].Type != "setting" || changes[0].Key != "defaultLocale" {
+		t.Errorf("changes after PATCH = %+v, want the three settings", changes)
+	}
+
+	ts.do(t, "PATCH", "/api/settings", `{"supportEmail": ""}`).expect(t, http.StatusOK).decode(t, &settings)
+	if settings.SupportEmail != "" || settings.SiteTitle != "Acme" {
+		t.Errorf("settings after removing the support email = %+v", settings)
+	}
+	ts.do(t, "DELETE", "/api/settings/siteTitle", nil).expect(t, http.StatusOK).decode(t, &settings)
+	if settings.SiteTitle != defaultSettings().SiteTitle || settings.DefaultLocale != "pt-BR" {
+		t.Errorf("settings after resetting the site title = %+v", settings)
+	}
+	ts.do(t, "DELETE", "/api/settings/theme", nil).expect(t, http.StatusNotFound)
+
+	// A row left behind by a setting that no longer exists, or of the wrong type, is ignored
+	testDB.Create(&[]models.Setting{{Key: "theme", Value: `"dark"`}, {Key: "dashboardRefreshSeconds", Value: `"often"`}})
+	ts.Server.settings.invalidate()
+	ts.do(t, "GET", "/api/settings", nil).expect(t, http.StatusOK).decode(t, &settings)
+	if settings.DashboardRefreshSeconds != 30 || settings.DefaultLocale != "pt-BR" {
+		t.Errorf("settings with stale rows = %+v", settings)
+	}
+}
+
+func TestRedirects(t *testing.T) {
+	ts := newTestServer(t)
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	follow := func(path string) *http.Response {
+		t.Helper()
+		resp, err := client.Get(ts.url + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	ts.do(t, "POST", "/api/redirects", `{"slug": "Spring Sale", "targetUrl": "ftp://example.com"}`).expect(t, http.StatusBadRequest).golden(t, "invalid")
+	ts.do(t, "POST", "/api/redirects", fmt.Sprintf(`{"targetUrl": "https://example.com", "expiresAt": %q}`, time.Now().Add(-time.Hour).Format(time.RFC3339))).
+		expect(t, http.StatusBadRequest)
+
+	var sale, generated models.Redirect
+	resp := ts.do(t, "POST", "/api/redirects", `{"slug": "spring-sale", "targetUrl": "https://example.com/sale?utm_campaign=spring"}`).
+		expect(t, http.StatusCreated)
+	resp.decode(t, &sale)
+	if resp.header.Get("Location") != "/api/redirects/spring-sale" {
+		t.Errorf("Location = %q", resp.header.Get("Location"))
+	}
+	ts.do(t, "POST", "/api/redirects", `{"slug": "spring-sale", "targetUrl": "https://example.com"}`).expect(t, http.StatusConflict)
+	ts.do(t, "POST", "/api/redirects", `{"targetUrl": "https://example.com/docs"}`).expect(t, http.StatusCreated).decode(t, &generated)
+	if len(generated.Slug) != 7 {
+		t.Errorf("generated slug = %q, want 7 characters", generated.Slug)
+	}
+
+	// The short link's query parameters are passed on, except those the target sets itself
+	got := follow("/r/spring-sale?utm_source=newsletter&utm_campaign=other")
+	if got.StatusCode != http.StatusFound || got.Header.Get("Location") != "https://example.com/sale?utm_campaign=spring&utm_source=newsletter" {
+		t.Errorf("GET /r/spring-sale = %d to %q", got.StatusCode, got.Header.Get("Location"))
+	}
+	follow("/r/spring-sale")
+	if got := follow("/r/summer-sale"); got.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /r/summer-sale = %d, want 404", got.StatusCode)
+	}
+
+	// A new target takes effect at once on the replica that changed it
+	ts.do(t, "PATCH", "/api/redirects/spring-sale", `{"targetUrl": "https://example.com/spring"}`).expect(t, http.StatusOK)
+	if got := follow("/r/spring-sale"); got.Header.Get("Location") != "https://example.com/spring" {
+		t.Errorf("GET /r/spring-sale after PATCH goes to %q", got.Header.Get("Location"))
+	}
+
+	ts.Server.redirects.flush()
+	ts.do(t, "GET", "/api/redirects/spring-sale", nil).expect(t, http.StatusOK).decode(t, &sale)
+	if sale.Hits != 3 || sale.LastHitAt == nil || sale.TargetURL != "https://example.com/spring" {
+		t.Errorf("redirect after 3 visits = %+v", sale)
+	}
+
+	ts.do(t, "PATCH", "/api/redirects/spring-sale", fmt.Sprintf(`{"expiresAt": %q}`, time.Now().Format(time.RFC3339Nano))).expect(t, http.StatusOK)
+	if got := follow("/r/spring-sale"); got.StatusCode != http.StatusGone {
+		t.Errorf("GET /r/spring-sale after it expired = %d, want 410", got.StatusCode)
+	}
+
+	var redirects []models.Redirect
+	ts.do(t, "GET", "/api/redirects", nil).expect(t, http.StatusOK).decode(t, &redirects)
+	if len(redirects) != 2 || redirects[0].Slug != generated.Slug {
+		t.Errorf("redirects = %+v, want both, newest first", redirects)
+	}
+	ts.do(t, "DELETE", "/api/redirects/spring-sale", nil).expect(t, http.StatusOK)
+	ts.do(t, "DELETE", "/api/redirects/spring-sale", nil).expect(t, http.StatusNotFound)
+	if got := follow("/r/spring-sale"); got.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /r/spring-sale after it was deleted = %d, want 404", got.StatusCode)
+	}
+}
+
+func TestSitemap(t *testing.T) {
+	// zone-main serves a sitemap index once up; zone-admin answers 503 throughout
+	var up atomic.Bool
+	zone := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			fmt.Fprint(w, `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"><sitemap><loc>https://example.com/sitemap/0.xml</loc></sitemap></sitemapindex>`)
+		case "/sitemap/0.xml":
+			fmt.Fprint(w, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+				<url><loc>https://example.com/</loc><lastmod>2024-05-01</lastmod></url>
+				<url><loc>https://example.com/pricing</loc><priority>0.8</priority></url>
+				<url><loc>https://example.com/</loc></url>
+			</urlset>`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer zone.Close()
+	ts := newTestServer(t, func(c *Config) {
+		c.Zones.MainURL = zone.URL
+		c.Zones.SitemapCacheTTL = time.Nanosecond // Built again on every request
+	})
+
+	// No zone's sitemap has ever been fetched
+	ts.do(t, "GET", "/sitemap.xml", nil).expect(t, http.StatusServiceUnavailable)
+
+	locs := func() []string {
+		t.Helper()
+		got := ts.do(t, "GET", "/sitemap.xml", nil).expect(t, http.StatusOK)
+		if got.header.Get("Content-Type") != "application/xml; charset=utf-8" {
+			t.Errorf("Content-Type = %q", got.header.Get("Content-Type"))
+		}
+		var sitemap struct {
+			URLs []struct {
+				Loc     string `xml:"loc"`
+				LastMod string `xml:"lastmod"`
+			} `xml:"url"`
+		}
+		if err := xml.Unmarshal(got.body, &sitemap); err != nil {
+			t.Fatalf("Failed to decode the sitemap: %v; body: %s", err, got.body)
+		}
+		var locs []string
+		for _, u := range sitemap.URLs {
+			locs = append(locs, u.Loc+" "+u.LastMod)
+		}
+		return locs
+	}
+	// The index is followed on the zone's own URL, and each URL is listed once
+	up.Store(true)
+	want := []string{"https://example.com/ 2024-05-01", "https://example.com/pricing "}
+	if got := locs(); !slices.Equal(got, want) {
+		t.Errorf("sitemap = %q, want %q", got, want)
+	}
+	// A zone that goes down keeps the URLs of its last sitemap
+	up.Store(false)
+	if got := locs(); !slices.Equal(got, want) {
+		t.Errorf("sitemap with zone-main down = %q, want its last URLs %q", got, want)
+	}
+}
+
+func TestSitemapFailureCached(t *testing.T) {
+	var fetches atomic.Int32
+	zone := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer zone.Close()
+	sitemap := newSitemapCache(zone.Client(), []zoneTarget{{Name: "zone-main", URL: zone.URL}},
+		ZonesConfig{SitemapCacheTTL: time.Hour, SitemapTimeout: time.Hour})
+
+	// Until SITEMAP_TIMEOUT has passed, requests get the failure without fetching again
+	for range 3 {
+		if _, err := sitemap.get(context.Background()); err == nil {
+			t.Fatal("get succeeded with no zone's sitemap")
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("%d fetches, want 1", n)
+	}
+	sitemap.failedAt = time.Now().Add(-time.Hour)
+	sitemap.get(context.Background())
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("%d fetches after SITEMAP_TIMEOUT, want 2", n)
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Logical backups of the Postgres database: pg_dump (custom format) streamed to the backup
+// store, and pg_restore from it, each tracked as a row in backup_jobs. Started with
+// `backend backup create|restore`, or through /internal/backups when BACKUP_ENABLED=true
+//
+// Only one backup or restore runs at a time across every replica (a Postgres advisory lock),
+// and the backup_jobs table is left out of dumps, so restoring keeps the job history
+
+// Job states
+const (
+	backupRunning   = "running"
+	backupSucceeded = "succeeded"
+	backupFailed    = "failed"
+)
+
+// backupLockID is the Postgres advisory lock held while a job runs (see migrationLockID)
+const backupLockID = 741853
+
+// errBackupBusy is returned when another backup or restore is already running
+var errBackupBusy = errors.New("another backup or restore is running")
+
+// SQLite has no advisory locks; its database belongs to one process, so a mutex will do
+var localBackupLock sync.Mutex
+
+// backupRunner runs backups and restores of database into store
+type backupRunner struct {
+	db       *gorm.DB
+	store    backupStore
+	cfg      BackupConfig
+	database DatabaseConfig // Where pg_dump and pg_restore connect
+	// Called after a successful restore with the flag keys from before it, so cached
+	// flags can be dropped; may be nil
+	onRestore func(ctx context.Context, flagsBefore []string)
+}
+
+// newBackupRunner returns a runner for the backup store configured in cfg
+func newBackupRunner(database *gorm.DB, cfg Config) (*backupRunner, error) {
+	store, err := newBackupStore(cfg.Backup)
+	if err != nil {
+		return nil, err
+	}
+	return &backupRunner{db: database, store: store, cfg: cfg.Backup, database: cfg.Database}, nil
+}
+
+// newBackupName names a backup after the time it starts, e.g. "backup-20261014T093000.125Z.dump"
+func newBackupName(now time.Time) string {
+	return "backup-" + now.UTC().Format("20060102T150405.000Z") + ".dump"
+}
+
+// start locks out other jobs, records a running job, and returns it with the function
+// that runs it; run always releases the lock and records the outcome
+func (b *backupRunner) start(ctx context.Context, kind, name string) (models.BackupJob, func(context.Context) error, error) {
+	release, err := b.lock(ctx)
+	if err != nil {
+		return models.BackupJob{}, nil, err
+	}
+
+	// Holding the lock, any job still marked running was cut short by a restart
+	b.db.Model(&models.BackupJob{}).Where("status = ?", backupRunning).
+		Updates(map[string]any{"status": backupFailed, "error": "interrupted: the process running it exited", "finished_at": time.Now()})
+
+	host, _ := os.Hostname()
+	job := models.BackupJob{Kind: kind, Backup: name, Status: backupRunning, Host: host, StartedAt: time.Now()}
+	if err := b.db.Create(&job).Error; err != nil {
+		release()
+		return job, nil, err
+	}
+
+	run := func(ctx context.Context) error {
+		defer release()
+		ctx, cancel := context.WithTimeout(ctx, b.cfg.Timeout)
+		defer cancel()
+
+		size, err := b.runJob(ctx, kind, name)
+		finished := time.Now()
+		job.SizeBytes, job.FinishedAt, job.Status = size, &finished, backupSucceeded
+		if err != nil {
+			job.Status, job.Error = backupFailed, err.Error()
+		}
+		// The job may have run for an hour; its outcome is recorded even if ctx was cancelled
+		if saveErr := b.db.WithContext(context.Background()).Save(&job).Error; saveErr != nil {
+			log.Printf("Failed to record %s job %d: %v", kind, job.ID, saveErr)
+		}
+		log.Printf("%s %s %s in %s (%d bytes)", kind, name, job.Status, finished.Sub(job.StartedAt).Round(time.Millisecond), size)
+		return err
+	}
+	return job, run, nil
+}
+
+// runJob does the actual dump or restore
+func (b *backupRunner) runJob(ctx context.Context, kind, name string) (int64, error) {
+	if kind == "backup" {
+		return b.backup(ctx, name)
+	}
+	flagsBefore := flagKeys(ctx, b.db)
+	size, err := b.restore(ctx, name)
+	if err == nil && b.onRestore != nil {
+		b.onRestore(ctx, flagsBefore)
+	}
+	return size, err
+}
+
+// lock takes the advisory lock on a connection of its own, since session locks belong to
+// whichever pooled connection ran the query; the returned function releases it
+func (b *backupRunner) lock(ctx context.Context) (func(), error) {
+	if b.db.Dialector.Name() != "postgres" {
+		if !localBackupLock.TryLock() {
+			return nil, errBackupBusy
+		}
+		return localBackupLock.Unlock, nil
+	}
+
+	sqlDB, err := b.db.DB()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", backupLockID).Scan(&locked); err != nil || !locked {
+		conn.Close()
+		if err == nil {
+			err = errBackupBusy
+		}
+		return nil, err
+	}
+	return func() {
+		conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", backupLockID)
+		conn.Close()
+	}, nil
+}
+
+// postgresCommand runs one of the Postgres client tools against DB_* with the password
+// in the environment rather than on the command line, where any process could read it
+func (b *backupRunner) postgresCommand(ctx context.Context, tool string, args ...string) (*exec.Cmd, *bytes.Buffer, error) {
+	switch {
+	case usingSQLite(b.db):
+		return nil, nil, errors.New("backups need Postgres; with DB_DRIVER=sqlite copy DB_SQLITE_PATH instead")
+	case usingMySQL(b.db):
+		return nil, nil, errors.New("backups need Postgres; with DB_DRIVER=mysql use mysqldump or the platform's backups")
+	}
+	args = append([]string{
+		"--host=" + b.database.Host,
+		"--port=" + strconv.Itoa(b.database.Port),
+		"--username=" + b.database.User,
+		"--dbname=" + b.database.Name,
+		"--no-password",
+	}, args...)
+	cmd := exec.CommandContext(ctx, tool, args...)
+	cmd.Env = append(os.Environ(), "PGPASSWORD="+b.database.Password)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	return cmd, &stderr, nil
+}
+
+// commandError describes a failed pg_dump or pg_restore with the end of what it printed
+func commandError(tool string, err error, stderr *bytes.Buffer) error {
+	output := strings.TrimSpace(stderr.String())
+	if len(output) > 2000 {
+		output = "..." + output[len(output)-2000:]
+	}
+	if output == "" {
+		return fmt.Errorf("%s: %w", tool, err)
+	}
+	return fmt.Errorf("%s: %w: %s", tool, err, output)
+}
+
+// backup streams pg_dump's output to the store as name
+func (b *backupRunner) backup(ctx context.Context, name string) (int64, error) {
+	cmd, stderr, err := b.postgresCommand(ctx, b.cfg.PgDump, "--format=custom", "--no-owner", "--exclude-table=backup_jobs")
+	if err != nil {
+		return 0, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start %s: %w", b.cfg.PgDump, err)
+	}
+
+	size, err := b.store.Put(ctx, name, &dumpReader{r: stdout, wait: func() error {
+		if err := cmd.Wait(); err != nil {
+			return commandError("pg_dump", err, stderr)
+		}
+		return nil
+	}})
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+	return size, err
+}
+
+// dumpReader reads pg_dump's output but reports its exit status in place of EOF, so a dump
+// that fails halfway fails the upload instead of being stored truncated
+type dumpReader struct {
+	r    io.Reader
+	wait func() error
+	done bool
+}
+
+func (d *dumpReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	if err == io.EOF && !d.done {
+		d.done = true
+		if waitErr := d.wait(); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// restore replaces the database's contents with the backup called name, in one transaction,
+// so a restore that fails leaves the database as it was
+func (b *backupRunner) restore(ctx context.Context, name string) (int64, error) {
+	backup, err := b.store.Open(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	defer backup.Close()
+
+	cmd, stderr, err := b.postgresCommand(ctx, b.cfg.PgRestore, "--clean", "--if-exists", "--no-owner", "--single-transaction", "--exit-on-error")
+	if err != nil {
+		return 0, err
+	}
+	counted := &countingReader{r: backup}
+	cmd.Stdin = counted
+	if err := cmd.Run(); err != nil {
+		return counted.n, commandError("pg_restore", err, stderr)
+	}
+	return counted.n, nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// recentBackupJobs returns the newest backup and restore jobs
+func (b *backupRunner) recentBackupJobs(ctx context.Context, limit int) ([]models.BackupJob, error) {
+	jobs := []models.BackupJob{}
+	err := b.db.WithContext(ctx).Order("id DESC").Limit(limit).Find(&jobs).Error
+	return jobs, err
+}
+
+// startBackupJob starts a job in the background and answers 202 with it, or 409 if another is running
+// Jobs outlive the request, so they don't use its context
+func (b *backupRunner) startBackupJob(w http.ResponseWriter, r *http.Request, kind, name string) {
+	job, run, err := b.start(r.Context(), kind, name)
+	if errors.Is(err, errBackupBusy) {
+		writeError(w, r, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to start %s: %v", kind, err))
+		return
+	}
+	go run(context.Background())
+
+	w.Header().Set("Location", fmt.Sprintf("/internal/backups/jobs/%d", job.ID))
+	writeJSON(w, r, http.StatusAccepted, job)
+}
+
+// backupsHandler responds to GET /internal/backups
+func (b *backupRunner) backupsHandler(w http.ResponseWriter, r *http.Request) {
+	backups, err := b.store.List(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, fmt.Sprintf("Failed to list backups: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, models.BackupsResponse{Store: b.store.String(), Backups: backups})
+}
+
+// createBackupHandler responds to POST /internal/backups
+func (b *backupRunner) createBackupHandler(w http.ResponseWriter, r *http.Request) {
+	b.startBackupJob(w, r, "backup", newBackupName(time.Now()))
+}
+
+// restoreBackupHandler responds to POST /internal/backups/{name}/restore
+// The body must confirm the name: {"confirm": "backup-20261014T093000.125Z.dump"}
+func (b *backupRunner) restoreBackupHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	var req models.RestoreRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Confirm != name {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf(`Restoring replaces every table; send {"confirm": %q} to go ahead`, name))
+		return
+	}
+
+	// Missing backups are reported now rather than as a failed job
+	if !backupNamePattern.MatchString(name) {
+		writeError(w, r, http.StatusNotFound, "Backup not found")
+		return
+	}
+	backup, err := b.store.Open(r.Context(), name)
+	if errors.Is(err, errNotFound) {
+		writeError(w, r, http.StatusNotFound, "Backup not found")
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, fmt.Sprintf("Failed to read backup: %v", err))
+		return
+	}
+	backup.Close()
+
+	b.startBackupJob(w, r, "restore", name)
+}
+
+// backupJobsHandler responds to GET /internal/backups/jobs
+func (b *backupRunner) backupJobsHandler(w http.ResponseWriter, r *http.Request) {
+	jobs, err := b.recentBackupJobs(r.Context(), 50)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Failed to load backup jobs")
+		return
+	}
+	writeJSON(w, r, http.StatusOK, models.BackupJobsResponse{Jobs: jobs})
+}
+
+// backupJobHandler responds to GET /internal/backups/jobs/{id}
+func (b *backupRunner) backupJobHandler(w http.ResponseWriter, r *http.Request) {
+	var job models.BackupJob
+	err := b.db.WithContext(r.Context()).First(&job, "id = ?", r.PathValue("id")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeError(w, r, http.StatusNotFound, "Backup job not found")
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Failed to load backup job")
+		return
+	}
+	writeJSON(w, r, http.StatusOK, job)
+}
+
+// flagsRestored is the server's onRestore: flags may now differ from what any replica has
+// cached, so every key from before and after the restore is published like a change
+// (other replicas drop it from their caches, see flag_notify.go)
+func (s *Server) flagsRestored(ctx context.Context, before []string) {
+	s.flagCache.Purge()
+	after := flagKeys(ctx, s.db)
+	seen := map[string]bool{}
+	for _, key := range append(before, after...) {
+		if !seen[key] {
+			seen[key] = true
+			s.changes.publishFlagChange(key, "updated")
+		}
+	}
+}
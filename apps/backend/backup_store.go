@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/nextjs-microfrontend/backend/internal/models"
+)
+
+// backupStore keeps database dumps: an S3-compatible bucket (BACKUP_S3_BUCKET) in
+// production, or a directory (BACKUP_DIR), e.g. a mounted volume or a laptop
+type backupStore interface {
+	// Put stores r as name and returns its size; a failed Put leaves nothing behind
+	Put(ctx context.Context, name string, r io.Reader) (int64, error)
+	// Open reads the backup called name; errNotFound if there is none
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+	// List returns every backup, newest first
+	List(ctx context.Context) ([]models.Backup, error)
+	// String describes where backups go, e.g. "s3://bucket/backups/"
+	String() string
+}
+
+// Backup names are what the store sees, so they are kept to one plain file name
+var backupNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*\.dump$`)
+
+// newBackupStore returns the store configured by BACKUP_S3_* or BACKUP_DIR
+func newBackupStore(cfg BackupConfig) (backupStore, error) {
+	switch {
+	case cfg.S3Bucket != "":
+		client, err := newS3Client(cfg.S3Endpoint, cfg.S3Region, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3Insecure)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BACKUP_S3_ENDPOINT: %w", err)
+		}
+		return &s3BackupStore{client: client, bucket: cfg.S3Bucket, prefix: cfg.S3Prefix}, nil
+	case cfg.Dir != "":
+		if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create BACKUP_DIR: %w", err)
+		}
+		return dirBackupStore(cfg.Dir), nil
+	default:
+		return nil, errors.New("no backup store: set BACKUP_S3_BUCKET or BACKUP_DIR")
+	}
+}
+
+// newS3Client returns a client for an S3-compatible endpoint, shared by backups and uploads
+func newS3Client(endpoint, region, accessKey, secretKey string, insecure bool) (*minio.Client, error) {
+	return minio.New(endpoint, &minio.Options{
+		// Without keys the SDK looks for them like the AWS CLI does (environment, IRSA, instance profile)
+		Creds: credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.Static{Value: credentials.Value{AccessKeyID: accessKey, SecretAccessKey: secretKey, SignerType: credentials.SignatureV4}},
+			&credentials.EnvAWS{},
+			&credentials.IAM{Client: &http.Client{Transport: http.DefaultTransport}}, // The SDK needs a client to reach the metadata service
+		}),
+		Secure: !insecure,
+		Region: region,
+	})
+}
+
+// dirBackupStore keeps backups as files in a directory
+type dirBackupStore string
+
+func (d dirBackupStore) String() string { return string(d) }
+
+// Put writes to a temporary file first, so a failed dump never looks like a backup
+func (d dirBackupStore) Put(ctx context.Context, name string, r io.Reader) (int64, error) {
+	file, err := os.CreateTemp(string(d), "."+name+".*.partial")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(file.Name()) // Only still there if something failed
+
+	size, err := io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return size, os.Rename(file.Name(), filepath.Join(string(d), name))
+}
+
+func (d dirBackupStore) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	file, err := os.Open(filepath.Join(string(d), name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errNotFound
+	}
+	return file, err
+}
+
+func (d dirBackupStore) List(ctx context.Context) ([]models.Backup, error) {
+	entries, err := os.ReadDir(string(d))
+	if err != nil {
+		return nil, err
+	}
+	backups := []models.Backup{}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || !backupNamePattern.MatchString(entry.Name()) {
+			continue
+		}
+		backups = append(backups, models.Backup{Name: entry.Name(), SizeBytes: info.Size(), CreatedAt: info.ModTime().UTC()})
+	}
+	sortBackups(backups)
+	return backups, nil
+}
+
+// s3BackupStore keeps backups as objects under a prefix of one bucket
+type s3BackupStore struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func (s *s3BackupStore) String() string { return "s3://" + s.bucket + "/" + s.prefix }
+
+// Put streams r as a multipart upload; the SDK aborts it if r fails, so no partial object appears
+func (s *s3BackupStore) Put(ctx context.Context, name string, r io.Reader) (int64, error) {
+	info, err := s.client.PutObject(ctx, s.bucket, s.prefix+name, r, -1, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	return info.Size, err
+}
+
+func (s *s3BackupStore) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, s.prefix+name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy; Stat is what finds out whether the object exists
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, errNotFound
+		}
+		return nil, err
+	}
+	return object, nil
+}
+
+func (s *s3BackupStore) List(ctx context.Context) ([]models.Backup, error) {
+	backups := []models.Backup{}
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.prefix}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		name := strings.TrimPrefix(object.Key, s.prefix)
+		if backupNamePattern.MatchString(name) {
+			backups = append(backups, models.Backup{Name: name, SizeBytes: object.Size, CreatedAt: object.LastModified.UTC()})
+		}
+	}
+	sortBackups(backups)
+	return backups, nil
+}
+
+// sortBackups orders backups newest first
+func sortBackups(backups []models.Backup) {
+	sort.Slice(backups, func(a, b int) bool {
+		return backups[a].CreatedAt.After(backups[b].CreatedAt)
+	})
+}
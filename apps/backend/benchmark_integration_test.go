@@ -0,0 +1,111 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// The benchmarks compare the hot flag and status paths with and without the
+// settings from openPrimaryDB and newServer (prepared statements and no
+// default transaction), against the same Postgres container as the tests:
+//
+//	go test -tags integration -run '^$' -bench . -benchmem
+
+// BenchmarkFlagLookup reads one flag through the repository, as a cache miss does
+func BenchmarkFlagLookup(b *testing.B) {
+	resetDatabase(b)
+	ctx := context.Background()
+
+	for _, bench := range []struct {
+		name string
+		stmt *gorm.DB
+	}{
+		{"plain", testDB},
+		{"prepared", testDB.Session(&gorm.Session{PrepareStmt: true})},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			flags := newGormFlagRepository(testDB, bench.stmt)
+			b.ResetTimer()
+			for range b.N {
+				if _, err := flags.Get(ctx, "dark_mode"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkFlagWrite toggles one flag with a single statement; "default transaction"
+// wraps it the way GORM does without SkipDefaultTransaction
+func BenchmarkFlagWrite(b *testing.B) {
+	resetDatabase(b)
+	ctx := context.Background()
+	toggle := func(db *gorm.DB, enabled bool) error {
+		return db.Model(&models.FeatureFlag{}).Where(byKey("dark_mode")).Update("enabled", enabled).Error
+	}
+
+	b.Run("default transaction", func(b *testing.B) {
+		for i := range b.N {
+			err := testDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				return toggle(tx, i%2 == 0)
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("no transaction", func(b *testing.B) {
+		for i := range b.N {
+			if err := toggle(testDB.WithContext(ctx), i%2 == 0); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkFlagUpdate runs the whole find/update/reload of PATCH /api/feature-flags/{key}
+func BenchmarkFlagUpdate(b *testing.B) {
+	resetDatabase(b)
+	ctx := context.Background()
+
+	for _, bench := range []struct {
+		name string
+		stmt *gorm.DB
+	}{
+		{"plain", testDB},
+		{"prepared", testDB.Session(&gorm.Session{PrepareStmt: true})},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			flags := newGormFlagRepository(testDB, bench.stmt)
+			b.ResetTimer()
+			for i := range b.N {
+				enabled := i%2 == 0
+				if _, err := flags.Update(ctx, "dark_mode", models.UpdateFeatureFlagRequest{Enabled: &enabled}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkStatusPaths measures the endpoints the zones poll, through the real routes and middleware
+func BenchmarkStatusPaths(b *testing.B) {
+	ts := newTestServer(b)
+
+	for _, path := range []string{
+		"/api/feature-flags/dark_mode",
+		"/api/zones/status",
+	} {
+		b.Run(path, func(b *testing.B) {
+			for range b.N {
+				ts.do(b, http.MethodGet, path, nil).expect(b, http.StatusOK)
+			}
+		})
+	}
+}
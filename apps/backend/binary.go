@@ -0,0 +1,87 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"github.com/nextjs-microfrontend/backend/internal/pb"
+	"github.com/tinylib/msgp/msgp"
+	"google.golang.org/protobuf/proto"
+)
+
+// Binary media types for internal consumers that want smaller, faster payloads than JSON
+// Only the hot read endpoints (zone status and feature flags) support them
+const (
+	protobufContentType = "application/x-protobuf"
+	msgpackContentType  = "application/msgpack"
+)
+
+// binaryFormat returns the binary media type the client asked for, or "" for JSON
+// "application/x-msgpack" is accepted too since many msgpack clients still send it
+func binaryFormat(r *http.Request) string {
+	switch {
+	case acceptsMediaType(r, protobufContentType):
+		return protobufContentType
+	case acceptsMediaType(r, msgpackContentType), acceptsMediaType(r, "application/x-msgpack"):
+		return msgpackContentType
+	default:
+		return ""
+	}
+}
+
+// writeBinary sends v as protobuf or MessagePack when the client asked for it
+// It returns false without writing a body when the client wants JSON or v has
+// no binary encoding, so handlers fall back to writeJSON
+//
+// Binary responses are always the bare payload: there is no v2 envelope, and the
+// request ID is only available from the X-Request-ID header
+func writeBinary(w http.ResponseWriter, r *http.Request, status int, v interface{}) bool {
+	// The representation depends on Accept, so shared caches must key on it
+	w.Header().Add("Vary", "Accept")
+
+	format := binaryFormat(r)
+	if format == "" {
+		return false
+	}
+
+	var body []byte
+	var err error
+	switch format {
+	case protobufContentType:
+		var message proto.Message
+		switch value := v.(type) {
+		case models.HealthResponse:
+			message = pb.FromHealthResponse(value)
+		case []models.FeatureFlag:
+			message = pb.FromFeatureFlags(value)
+		default:
+			return false
+		}
+		body, err = proto.Marshal(message)
+	case msgpackContentType:
+		switch value := v.(type) {
+		case models.HealthResponse:
+			body, err = value.MarshalMsg(nil)
+		case []models.FeatureFlag:
+			// Generated serializers exist per struct, so the array header is written here
+			body = msgp.AppendArrayHeader(nil, uint32(len(value)))
+			for i := 0; i < len(value) && err == nil; i++ {
+				body, err = value[i].MarshalMsg(body)
+			}
+		default:
+			return false
+		}
+	}
+
+	if err != nil {
+		log.Printf("Failed to encode %s response: %v", format, err)
+		writeError(w, r, http.StatusInternalServerError, "Failed to encode response")
+		return true
+	}
+
+	w.Header().Set("Content-Type", format)
+	w.WriteHeader(status)
+	w.Write(body)
+	return true
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+)
+
+// bulkCreateUsersHandler responds to POST /api/users/bulk
+// Creates every user in the request in one transaction: either all are created or none are
+func (a *restAPI) bulkCreateUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.BulkCreateUsersRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	users, err := a.users.createMany(r.Context(), req)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to create users: %v", err))
+		return
+	}
+
+	writeJSON(w, r, http.StatusCreated, users)
+}
+
+// bulkCreateFeatureFlagsHandler responds to POST /api/feature-flags/bulk
+// Creates every flag in the request in one transaction: either all are created or none are
+func (a *restAPI) bulkCreateFeatureFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.BulkCreateFeatureFlagsRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	flags, err := a.flags.createMany(r.Context(), req)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to create feature flags: %v", err))
+		return
+	}
+
+	writeJSON(w, r, http.StatusCreated, flags)
+}
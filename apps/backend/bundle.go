@@ -0,0 +1,482 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"github.com/nextjs-microfrontend/backend/internal/tenant"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// A bundle is the configuration an environment is made of, in one JSON document: the project's
+// feature flags, and the announcements, navigation menu, and routing table the zones share.
+// GET /api/export/bundle downloads it and POST /api/import/bundle makes another environment
+// (or this one, after a disaster) match it, so cloning an environment is one call to each.
+// An import first works out what it would create, update, and delete, matching records by
+// their natural keys, since IDs differ between environments; with ?dryRun=true that preview
+// is all it does
+
+// bundleVersion is the bundle format this server writes; imports of other versions are refused
+const bundleVersion = 1
+
+// Largest bundle POST /api/import/bundle reads
+const maxBundleSize = 10 << 20
+
+// Resources in a bundle, as BundleChange names them
+const (
+	bundleFlags         = "featureFlag"
+	bundleAnnouncements = "announcement"
+	bundleNavigation    = "navigationItem"
+	bundleRoutes        = "zoneRoute"
+)
+
+// bundleRows is the current state of everything a bundle holds, with the rows' IDs
+type bundleRows struct {
+	flags         []models.FeatureFlag
+	announcements []models.Announcement
+	navigation    []models.NavigationItem
+	routes        []models.ZoneRoute
+}
+
+// loadBundleRows reads the flags of db's project and the shared configuration
+func loadBundleRows(db *gorm.DB) (bundleRows, error) {
+	var rows bundleRows
+	if err := db.Scopes(tenant.Scope(db.Statement.Context)).Order(quoteColumn(db, "key")).Find(&rows.flags).Error; err != nil {
+		return rows, err
+	}
+	if err := db.Order("id").Find(&rows.announcements).Error; err != nil {
+		return rows, err
+	}
+	if err := navigationOrder(db).Find(&rows.navigation).Error; err != nil {
+		return rows, err
+	}
+	err := db.Order("path").Find(&rows.routes).Error
+	return rows, err
+}
+
+// bundle turns rows into a bundle's entries
+func (rows bundleRows) bundle() models.Bundle {
+	bundle := models.Bundle{
+		Version:       bundleVersion,
+		ExportedAt:    time.Now().UTC(),
+		FeatureFlags:  make([]models.CreateFeatureFlagRequest, len(rows.flags)),
+		Announcements: make([]models.CreateAnnouncementRequest, len(rows.announcements)),
+		Navigation:    make([]models.CreateNavigationItemRequest, len(rows.navigation)),
+		ZoneRoutes:    make([]models.CreateZoneRouteRequest, len(rows.routes)),
+	}
+	for i, f := range rows.flags {
+		bundle.FeatureFlags[i] = flagEntry(f)
+	}
+	for i, a := range rows.announcements {
+		bundle.Announcements[i] = models.CreateAnnouncementRequest{
+			Message: a.Message, Severity: a.Severity, Zones: []string(a.Zones), StartsAt: a.StartsAt, EndsAt: a.EndsAt, Dismissible: a.Dismissible,
+		}
+	}
+	for i, n := range rows.navigation {
+		position := n.Position
+		bundle.Navigation[i] = models.CreateNavigationItemRequest{
+			Key: n.Key, Label: n.Label, Href: n.Href, Zone: n.Zone, Position: &position, Flag: n.Flag, Roles: []string(n.Roles),
+		}
+	}
+	for i, route := range rows.routes {
+		bundle.ZoneRoutes[i] = models.CreateZoneRouteRequest{Path: route.Path, Zone: route.Zone, Description: route.Description}
+	}
+	normalizeBundle(&bundle)
+	return bundle
+}
+
+// normalizeBundle gives equal entries the same form, whether exported here or read from a
+// request: times in UTC, empty lists rather than none, and a navigation item without a
+// position placed where it is in the list
+func normalizeBundle(bundle *models.Bundle) {
+	utc := func(t *time.Time) *time.Time {
+		if t == nil {
+			return nil
+		}
+		u := t.UTC()
+		return &u
+	}
+	for i := range bundle.Announcements {
+		a := &bundle.Announcements[i]
+		a.Severity = cmp.Or(a.Severity, "info")
+		a.StartsAt, a.EndsAt = utc(a.StartsAt), utc(a.EndsAt)
+		if a.Zones == nil {
+			a.Zones = []string{}
+		}
+	}
+	for i := range bundle.Navigation {
+		n := &bundle.Navigation[i]
+		if n.Position == nil {
+			position := i
+			n.Position = &position
+		}
+		if n.Roles == nil {
+			n.Roles = []string{}
+		}
+	}
+}
+
+// bundlePlan is what importing one resource's entries does: the entries to create, the
+// current rows to update (by index) with the entry each now gets, and the rows to delete
+type bundlePlan[T any] struct {
+	create  []T
+	update  map[int]T
+	delete  []int
+	changes []models.BundleChange
+	same    int
+}
+
+// planBundle matches wanted entries to current ones by key. Current entries no other entry
+// matches are deleted; when several current entries share a key, the first is the match
+func planBundle[T any](resource string, current, wanted []T, keyOf func(T) string) bundlePlan[T] {
+	plan := bundlePlan[T]{update: map[int]T{}}
+	byKey := map[string]int{}
+	for i, entry := range current {
+		if _, seen := byKey[keyOf(entry)]; !seen {
+			byKey[keyOf(entry)] = i
+		}
+	}
+	matched := make([]bool, len(current))
+	for _, entry := range wanted {
+		i, found := byKey[keyOf(entry)]
+		if !found {
+			plan.create = append(plan.create, entry)
+			plan.changes = append(plan.changes, models.BundleChange{Resource: resource, Key: keyOf(entry), Action: "created"})
+			continue
+		}
+		matched[i] = true
+		if fields := changedFields(current[i], entry); len(fields) > 0 {
+			plan.update[i] = entry
+			plan.changes = append(plan.changes, models.BundleChange{Resource: resource, Key: keyOf(entry), Action: "updated", Fields: fields})
+		} else {
+			plan.same++
+		}
+	}
+	for i, entry := range current {
+		if !matched[i] {
+			plan.delete = append(plan.delete, i)
+			plan.changes = append(plan.changes, models.BundleChange{Resource: resource, Key: keyOf(entry), Action: "deleted"})
+		}
+	}
+	return plan
+}
+
+// changedFields lists the JSON fields whose values differ between two entries
+func changedFields(current, wanted any) []string {
+	var a, b map[string]any
+	for _, pair := range []struct {
+		entry any
+		into  *map[string]any
+	}{{current, &a}, {wanted, &b}} {
+		data, _ := json.Marshal(pair.entry)
+		_ = json.Unmarshal(data, pair.into)
+	}
+	var fields []string
+	for name, value := range b {
+		if !reflect.DeepEqual(a[name], value) {
+			fields = append(fields, name)
+		}
+	}
+	for name := range a {
+		if _, ok := b[name]; !ok {
+			fields = append(fields, name)
+		}
+	}
+	slices.Sort(fields)
+	return fields
+}
+
+// bundleImport is the plan for every resource of one import
+type bundleImport struct {
+	rows          bundleRows
+	flags         bundlePlan[models.CreateFeatureFlagRequest]
+	announcements bundlePlan[models.CreateAnnouncementRequest]
+	navigation    bundlePlan[models.CreateNavigationItemRequest]
+	routes        bundlePlan[models.CreateZoneRouteRequest]
+}
+
+// planBundleImport works out what making rows match bundle takes
+func planBundleImport(rows bundleRows, bundle models.Bundle) bundleImport {
+	current := rows.bundle()
+	return bundleImport{
+		rows:  rows,
+		flags: planFlags(rows.flags, bundle.FeatureFlags, true),
+		announcements: planBundle(bundleAnnouncements, current.Announcements, bundle.Announcements,
+			func(a models.CreateAnnouncementRequest) string { return a.Message }),
+		navigation: planBundle(bundleNavigation, current.Navigation, bundle.Navigation, func(n models.CreateNavigationItemRequest) string { return n.Key }),
+		routes:     planBundle(bundleRoutes, current.ZoneRoutes, bundle.ZoneRoutes, func(r models.CreateZoneRouteRequest) string { return r.Path }),
+	}
+}
+
+// response summarizes the plan
+func (p bundleImport) response(dryRun bool) models.BundleImportResponse {
+	return models.BundleImportResponse{
+		DryRun:    dryRun,
+		Unchanged: p.flags.same + p.announcements.same + p.navigation.same + p.routes.same,
+		Changes:   slices.Concat([]models.BundleChange{}, p.flags.changes, p.announcements.changes, p.navigation.changes, p.routes.changes),
+	}
+}
+
+// response summarizes the plan of one resource
+func (plan bundlePlan[T]) response(dryRun bool) models.BundleImportResponse {
+	return models.BundleImportResponse{DryRun: dryRun, Unchanged: plan.same, Changes: slices.Concat([]models.BundleChange{}, plan.changes)}
+}
+
+// apply makes the plan's changes in tx, recording the route changes as made by r
+func (p bundleImport) apply(tx *gorm.DB, r *http.Request) error {
+	if err := applyFlagPlan(tx, p.rows.flags, p.flags); err != nil {
+		return err
+	}
+
+	// Announcements
+	for _, index := range p.announcements.delete {
+		if err := tx.Delete(&p.rows.announcements[index]).Error; err != nil {
+			return fmt.Errorf("error deleting announcements: %w", err)
+		}
+	}
+	for index, a := range p.announcements.update {
+		announcement := p.rows.announcements[index]
+		announcement.Message, announcement.Severity, announcement.Zones = a.Message, a.Severity, models.StringList(a.Zones)
+		announcement.StartsAt, announcement.EndsAt, announcement.Dismissible = a.StartsAt, a.EndsAt, a.Dismissible
+		if err := tx.Save(&announcement).Error; err != nil {
+			return fmt.Errorf("error updating announcements: %w", err)
+		}
+	}
+	for _, a := range p.announcements.create {
+		announcement := models.Announcement{
+			Message: a.Message, Severity: a.Severity, Zones: models.StringList(a.Zones), StartsAt: a.StartsAt, EndsAt: a.EndsAt, Dismissible: a.Dismissible,
+		}
+		if err := tx.Create(&announcement).Error; err != nil {
+			return fmt.Errorf("error creating announcements: %w", err)
+		}
+	}
+
+	// Navigation items
+	for _, index := range p.navigation.delete {
+		if err := tx.Delete(&p.rows.navigation[index]).Error; err != nil {
+			return fmt.Errorf("error deleting navigation items: %w", err)
+		}
+	}
+	for index, n := range p.navigation.update {
+		item := p.rows.navigation[index]
+		item.Label, item.Href, item.Zone, item.Position, item.Flag, item.Roles = n.Label, n.Href, n.Zone, *n.Position, n.Flag, models.StringList(n.Roles)
+		if err := tx.Save(&item).Error; err != nil {
+			return fmt.Errorf("error updating navigation items: %w", err)
+		}
+	}
+	for _, n := range p.navigation.create {
+		item := models.NavigationItem{Key: n.Key, Label: n.Label, Href: n.Href, Zone: n.Zone, Position: *n.Position, Flag: n.Flag, Roles: models.StringList(n.Roles)}
+		if err := tx.Create(&item).Error; err != nil {
+			return fmt.Errorf("error creating navigation items: %w", err)
+		}
+	}
+
+	// Routes, each change recorded in the routing change log like one made through /api/zone-routes
+	for _, index := range p.routes.delete {
+		route := p.rows.routes[index]
+		if err := tx.Delete(&route).Error; err != nil {
+			return fmt.Errorf("error deleting zone routes: %w", err)
+		}
+		if err := recordRouteChange(tx, r, route, "deleted", route.Zone); err != nil {
+			return err
+		}
+	}
+	for index, entry := range p.routes.update {
+		route := p.rows.routes[index]
+		previousZone := route.Zone
+		route.Zone, route.Description = entry.Zone, entry.Description
+		if err := tx.Save(&route).Error; err != nil {
+			return fmt.Errorf("error updating zone routes: %w", err)
+		}
+		if err := recordRouteChange(tx, r, route, "updated", previousZone); err != nil {
+			return err
+		}
+	}
+	for _, entry := range p.routes.create {
+		route := models.ZoneRoute{Path: entry.Path, Zone: entry.Zone, Description: entry.Description}
+		if err := tx.Create(&route).Error; err != nil {
+			return fmt.Errorf("error creating zone routes: %w", err)
+		}
+		if err := recordRouteChange(tx, r, route, "created", ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flagEntry is flag as a bundle or desired state has it
+func flagEntry(flag models.FeatureFlag) models.CreateFeatureFlagRequest {
+	return models.CreateFeatureFlagRequest{Key: flag.Key, Name: flag.Name, Description: flag.Description, Enabled: flag.Enabled}
+}
+
+// planFlags is planBundle for the flags of a project; without prune, flags wanted doesn't have
+// are kept rather than deleted
+func planFlags(current []models.FeatureFlag, wanted []models.CreateFeatureFlagRequest, prune bool) bundlePlan[models.CreateFeatureFlagRequest] {
+	entries := make([]models.CreateFeatureFlagRequest, len(current))
+	for i, f := range current {
+		entries[i] = flagEntry(f)
+	}
+	plan := planBundle(bundleFlags, entries, wanted, func(f models.CreateFeatureFlagRequest) string { return f.Key })
+	if !prune {
+		plan.delete = nil
+		plan.changes = slices.DeleteFunc(plan.changes, func(change models.BundleChange) bool { return change.Action == "deleted" })
+	}
+	return plan
+}
+
+// applyFlagPlan makes plan's changes to the flags of tx's project, current being the flags it
+// was worked out from: the flags to delete are deleted by key, the rest upserted
+func applyFlagPlan(tx *gorm.DB, current []models.FeatureFlag, plan bundlePlan[models.CreateFeatureFlagRequest]) error {
+	if len(plan.delete) > 0 {
+		keys := make([]string, len(plan.delete))
+		for i, index := range plan.delete {
+			keys[i] = current[index].Key
+		}
+		if err := tx.Scopes(tenant.Scope(tx.Statement.Context)).Where(quoteColumn(tx, "key")+" IN ?", keys).Delete(&models.FeatureFlag{}).Error; err != nil {
+			return fmt.Errorf("error deleting feature flags: %w", err)
+		}
+	}
+
+	projectID := tenant.FromContext(tx.Statement.Context).ID
+	var flags []models.FeatureFlag
+	for _, f := range slices.Concat(plan.create, mapValues(plan.update)) {
+		flags = append(flags, models.FeatureFlag{ProjectID: projectID, Key: f.Key, Name: f.Name, Description: f.Description, Enabled: f.Enabled})
+	}
+	if len(flags) == 0 {
+		return nil
+	}
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "project_id"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "description", "enabled", "updated_at"}),
+	}).Create(&flags).Error; err != nil {
+		return fmt.Errorf("error upserting feature flags: %w", err)
+	}
+	return nil
+}
+
+// changedKeys are the keys of plan's changes, with their actions
+func (plan bundlePlan[T]) changedKeys() map[string]string {
+	changed := make(map[string]string, len(plan.changes))
+	for _, change := range plan.changes {
+		changed[change.Key] = change.Action
+	}
+	return changed
+}
+
+// mapValues returns m's values ordered by key
+func mapValues[T any](m map[int]T) []T {
+	keys := make([]int, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	values := make([]T, len(keys))
+	for i, key := range keys {
+		values[i] = m[key]
+	}
+	return values
+}
+
+// checkBundle returns the problems with a bundle that the validate tags can't see: versions
+// this server doesn't read, zones that don't exist, and keys that appear twice
+func (s *Server) checkBundle(bundle models.Bundle) []models.FieldError {
+	var fieldErrors []models.FieldError
+	if bundle.Version != bundleVersion {
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "version", Message: fmt.Sprintf("must be %d", bundleVersion)})
+	}
+	prefixed := func(prefix string, errs []models.FieldError) {
+		for _, fe := range errs {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: prefix + "." + fe.Field, Message: fe.Message})
+		}
+	}
+	unique := func(seen map[string]bool, field, key string) {
+		if seen[key] {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: field, Message: "appears more than once in the bundle"})
+		}
+		seen[key] = true
+	}
+
+	seen := map[string]bool{}
+	for i, f := range bundle.FeatureFlags {
+		unique(seen, fmt.Sprintf("featureFlags[%d].key", i), f.Key)
+	}
+	seen = map[string]bool{}
+	for i, a := range bundle.Announcements {
+		unique(seen, fmt.Sprintf("announcements[%d].message", i), a.Message)
+		prefixed(fmt.Sprintf("announcements[%d]", i), s.checkAnnouncement(models.Announcement{Zones: a.Zones, StartsAt: a.StartsAt, EndsAt: a.EndsAt}))
+	}
+	seen = map[string]bool{}
+	for i, n := range bundle.Navigation {
+		unique(seen, fmt.Sprintf("navigation[%d].key", i), n.Key)
+		prefixed(fmt.Sprintf("navigation[%d]", i), s.checkNavigationItem(models.NavigationItem{Zone: n.Zone, Flag: n.Flag}))
+	}
+	seen = map[string]bool{}
+	for i, route := range bundle.ZoneRoutes {
+		unique(seen, fmt.Sprintf("zoneRoutes[%d].path", i), route.Path)
+		prefixed(fmt.Sprintf("zoneRoutes[%d]", i), s.checkZoneRoute(models.ZoneRoute{Zone: route.Zone}))
+	}
+	return fieldErrors
+}
+
+// exportBundleHandler responds to GET /api/export/bundle
+// The project's flags and the shared configuration as a bundle, downloaded as a file
+func (s *Server) exportBundleHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := loadBundleRows(s.db.WithContext(r.Context()))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	bundle := rows.bundle()
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "bundle-"+bundle.ExportedAt.Format("20060102-150405")+".json"))
+	writeJSON(w, r, http.StatusOK, bundle)
+}
+
+// importBundleHandler responds to POST /api/import/bundle?dryRun=
+// Makes the project's flags and the shared configuration match the bundle in the body, in one
+// transaction, and lists the changes; with ?dryRun=true it only lists them. Flag changes reach
+// the flag cache, change feed, and webhooks like any other, and route changes the routing log
+func (s *Server) importBundleHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBundleSize)
+	var bundle models.Bundle
+	if !decodeAndValidate(w, r, &bundle) {
+		return
+	}
+	normalizeBundle(&bundle)
+	if fieldErrors := s.checkBundle(bundle); len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+
+	var plan bundleImport
+	err := s.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		rows, err := loadBundleRows(tx)
+		if err != nil {
+			return err
+		}
+		plan = planBundleImport(rows, bundle)
+		if dryRun {
+			return nil
+		}
+		return plan.apply(tx, r)
+	})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to import bundle: %v", err))
+		return
+	}
+
+	response := plan.response(dryRun)
+	if !dryRun {
+		s.flags.changed(r.Context(), plan.flags.changedKeys())
+		log.Printf("Bundle imported: %d changes, %d unchanged", len(response.Changes), response.Unchanged)
+	}
+	writeJSON(w, r, http.StatusOK, response)
+}
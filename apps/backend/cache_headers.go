@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// conditionalGet adds ETag and Cache-Control headers to a read endpoint and
+// answers with 304 Not Modified when the client already has the current version
+//
+// maxAge controls how long clients may reuse a response without asking again
+// A maxAge of 0 means "no-cache": clients must revalidate every time, which is
+// cheap because an unchanged response costs only a 304 with no body
+func conditionalGet(maxAge time.Duration) middleware {
+	cacheControl := "no-cache"
+	if maxAge > 0 {
+		cacheControl = fmt.Sprintf("max-age=%d, must-revalidate", int(maxAge.Seconds()))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Only safe methods are cacheable, and streamed exports are never buffered
+			if (r.Method != http.MethodGet && r.Method != http.MethodHead) || wantsNDJSON(r) || wantsCSV(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Capture the response so we can hash the body before sending it
+			rec := &bufferedResponseWriter{header: http.Header{}, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			// Copy the handler's headers to the real response
+			for key, values := range rec.header {
+				w.Header()[key] = values
+			}
+
+			// Errors are passed through untouched and never cached
+			if rec.status != http.StatusOK {
+				w.WriteHeader(rec.status)
+				w.Write(rec.body.Bytes())
+				return
+			}
+
+			// Weak ETag because the compression middleware may re-encode the bytes
+			sum := sha256.Sum256(etagContent(r, rec.body.Bytes()))
+			etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Cache-Control", cacheControl)
+
+			if notModified(r, etag, w.Header().Get("Last-Modified")) {
+				// 304 responses must not include a body or Content-Type
+				w.Header().Del("Content-Type")
+				w.Header().Del("Content-Length")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			w.WriteHeader(rec.status)
+			w.Write(rec.body.Bytes())
+		})
+	}
+}
+
+// etagContent is the part of body the ETag is computed from: all of it except the request's ID,
+// which v2 and JSON:API responses have in their meta. The ID is new on every request (and already
+// in X-Request-ID), so hashing it would make every response look changed
+func etagContent(r *http.Request, body []byte) []byte {
+	id := requestIDFrom(r.Context())
+	if id == "" {
+		return body
+	}
+	quoted, _ := json.Marshal(id)
+	// Compact and indented (?pretty) JSON
+	body = bytes.ReplaceAll(body, append([]byte(`"requestId":`), quoted...), nil)
+	return bytes.ReplaceAll(body, append([]byte(`"requestId": `), quoted...), nil)
+}
+
+// notModified reports whether the client's cached copy is still current
+// If-None-Match takes precedence over If-Modified-Since (RFC 9110 section 13.2.2)
+func notModified(r *http.Request, etag, lastModified string) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			// Weak comparison: W/"abc" matches "abc"
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && lastModified != "" {
+		since, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		modified, err := http.ParseTime(lastModified)
+		if err != nil {
+			return false
+		}
+		return !modified.After(since)
+	}
+
+	return false
+}
+
+// setLastModified sets the Last-Modified header used by If-Modified-Since checks
+// HTTP dates only have second precision, so the time is truncated to seconds
+func setLastModified(w http.ResponseWriter, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	w.Header().Set("Last-Modified", t.UTC().Truncate(time.Second).Format(http.TimeFormat))
+}
+
+// bufferedResponseWriter records a handler's response in memory
+type bufferedResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponseWriter) Header() http.Header         { return b.header }
+func (b *bufferedResponseWriter) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *bufferedResponseWriter) WriteHeader(code int)        { b.status = code }
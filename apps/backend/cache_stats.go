@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/nextjs-microfrontend/backend/internal/cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// flagCacheStats is the flag cache section of GET /internal/cache/stats
+type flagCacheStats struct {
+	cache.Stats
+	HitRatio float64 `json:"hitRatio"`
+}
+
+// cacheStatsResponse is the body of GET /internal/cache/stats
+// Counters are totals since the process started
+type cacheStatsResponse struct {
+	Flags      flagCacheStats       `json:"flags"`
+	ZoneStatus zoneStatusCacheStats `json:"zoneStatus"`
+}
+
+// cacheStatsHandler responds to GET /internal/cache/stats
+// It shows whether the caches are earning their keep, e.g. before and after tuning
+// FLAG_CACHE_SIZE or ZONE_STATUS_MAX_AGE
+func (s *Server) cacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	flags := s.flagCache.Stats()
+	writeJSON(w, r, http.StatusOK, cacheStatsResponse{
+		Flags:      flagCacheStats{Stats: flags, HitRatio: flags.HitRatio()},
+		ZoneStatus: s.zoneStatuses.stats(),
+	})
+}
+
+// registerZoneStatusMetrics registers the zone status cache metrics, read from the
+// snapshot's counters when Prometheus scrapes (the flag cache's are in metrics.go)
+func (s *Server) registerZoneStatusMetrics() {
+	factory := promauto.With(metricsRegistry)
+	factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "flag_cache_hit_ratio",
+		Help: "Fraction of feature flag lookups served from the cache since startup.",
+	}, func() float64 { return s.flagCache.Stats().HitRatio() })
+
+	zoneCounter := func(name, help string, value func(zoneStatusCacheStats) uint64) {
+		factory.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help},
+			func() float64 { return float64(value(s.zoneStatuses.stats())) })
+	}
+	zoneCounter("zone_status_cache_hits_total", "Zone status reads served from a fresh snapshot.",
+		func(c zoneStatusCacheStats) uint64 { return c.Hits })
+	zoneCounter("zone_status_cache_stale_serves_total", "Zone status reads served from a stale snapshot while it refreshed.",
+		func(c zoneStatusCacheStats) uint64 { return c.StaleServes })
+	zoneCounter("zone_status_cache_misses_total", "Zone status reads that waited for health checks because there was no snapshot.",
+		func(c zoneStatusCacheStats) uint64 { return c.Misses })
+	zoneCounter("zone_status_cache_refreshes_total", "Background zone status refreshes.",
+		func(c zoneStatusCacheStats) uint64 { return c.Refreshes })
+	zoneCounter("zone_status_cache_refresh_failures_total", "Background refreshes in which at least one zone was unhealthy or unreachable.",
+		func(c zoneStatusCacheStats) uint64 { return c.RefreshFailures })
+	factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "zone_status_cache_age_seconds",
+		Help: "Age of the zone status snapshot.",
+	}, func() float64 { return s.zoneStatuses.stats().AgeSeconds })
+}
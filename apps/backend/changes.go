@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"github.com/nextjs-microfrontend/backend/internal/tenant"
+)
+
+// Long-polling limits for GET /api/changes
+const (
+	defaultChangesWait = 30 * time.Second
+	maxChangesWait     = 60 * time.Second
+
+	// maxBufferedChanges is how many recent changes are kept in memory
+	// Clients further behind than this get reset=true and must refetch
+	maxBufferedChanges = 1000
+)
+
+// changeFeed is an in-memory, append-only log of recent changes
+// Waiting clients are woken by closing the notify channel on every publish
+type changeFeed struct {
+	mu     sync.Mutex
+	seq    uint64               // Sequence number of the latest change
+	events []models.ChangeEvent // Most recent changes, oldest first
+	notify chan struct{}        // Closed and replaced whenever a change is published
+	done   chan struct{}        // Closed when the server shuts down, to release long-polling clients
+	once   sync.Once
+
+	lastZoneStatus map[string]string // Last known status per zone, to detect transitions
+
+	// broadcast tells other backend replicas about a local flag change (see flag_notify.go)
+	// Set once at startup, before the server handles requests; nil when running alone
+	broadcast func(key, action string)
+
+	// Outbound webhooks for local flag changes and zone transitions (see webhooks.go); nil in mock mode
+	webhooks *webhookDispatcher
+
+	// Zone incident notifications in a Slack channel (see slack.go); nil when not configured
+	slack *slackNotifier
+
+	// Zone incident emails to EMAIL_ALERT_RECIPIENTS (see email.go); nil when email is off
+	mailer *mailer
+
+	// The activity feed behind /api/activity (see activity.go); nil in mock mode
+	activity *activityLog
+}
+
+// newChangeFeed creates an empty change feed
+func newChangeFeed() *changeFeed {
+	return &changeFeed{
+		notify:         make(chan struct{}),
+		done:           make(chan struct{}),
+		lastZoneStatus: map[string]string{},
+	}
+}
+
+// publish appends a change and wakes every waiting client
+func (f *changeFeed) publish(changeType, key, action string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.seq++
+	f.events = append(f.events, models.ChangeEvent{
+		Seq:    f.seq,
+		Type:   changeType,
+		Key:    key,
+		Action: action,
+		At:     time.Now(),
+	})
+	if len(f.events) > maxBufferedChanges {
+		f.events = f.events[len(f.events)-maxBufferedChanges:]
+	}
+
+	close(f.notify)
+	f.notify = make(chan struct{})
+}
+
+// close releases every long-polling client so the server can shut down
+// without waiting out their wait durations
+func (f *changeFeed) close() {
+	f.once.Do(func() { close(f.done) })
+}
+
+// publishFlagChange records that a feature flag was created, updated, or deleted on this replica
+// key is the flag's tenant.FlagKey; webhooks are only sent for the default project's flags
+func (f *changeFeed) publishFlagChange(key, action string) {
+	f.publish("flag", key, action)
+	if f.broadcast != nil {
+		f.broadcast(key, action)
+	}
+	if projectID, _ := tenant.SplitFlagKey(key); projectID == tenant.DefaultProjectID {
+		f.webhooks.flagChanged(key, action)
+	}
+	f.activity.flagChanged(key, action)
+}
+
+// observeZoneStatus records a zone health check result
+// Only transitions (e.g., healthy -> unhealthy) are published as changes
+func (f *changeFeed) observeZoneStatus(status models.ZoneStatus) {
+	f.mu.Lock()
+	previous, seen := f.lastZoneStatus[status.Name]
+	f.lastZoneStatus[status.Name] = status.Status
+	f.mu.Unlock()
+
+	if seen && previous != status.Status {
+		f.publish("zone", status.Name, status.Status)
+		f.webhooks.zoneChanged(previous, status)
+		f.slack.zoneChanged(previous, status)
+		f.mailer.zoneChanged(previous, status)
+		f.activity.zoneChanged(previous, status)
+	}
+}
+
+// since returns the changes after cursor, the latest cursor, whether the client
+// fell too far behind, and a channel that is closed when the next change arrives
+func (f *changeFeed) since(cursor uint64) ([]models.ChangeEvent, uint64, bool, <-chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// A cursor from the future (e.g., from before a restart) can't be trusted
+	if cursor > f.seq {
+		return nil, f.seq, true, f.notify
+	}
+
+	// Changes between cursor and the oldest buffered change were dropped
+	reset := len(f.events) > 0 && cursor+1 < f.events[0].Seq
+
+	var result []models.ChangeEvent
+	for _, event := range f.events {
+		if event.Seq > cursor {
+			result = append(result, event)
+		}
+	}
+	return result, f.seq, reset, f.notify
+}
+
+// visibleChanges returns the events ctx's project may see: its own flags, under their plain
+// keys, and its zones
+func visibleChanges(ctx context.Context, events []models.ChangeEvent) []models.ChangeEvent {
+	project := tenant.FromContext(ctx)
+	var visible []models.ChangeEvent
+	for _, event := range events {
+		switch event.Type {
+		case "flag":
+			projectID, key := tenant.SplitFlagKey(event.Key)
+			if projectID != project.ID {
+				continue
+			}
+			event.Key = key
+		case "zone", "activeUsers":
+			if !project.HasZone(event.Key) {
+				continue
+			}
+		}
+		visible = append(visible, event)
+	}
+	return visible
+}
+
+// latest returns the sequence number of the most recent change
+func (f *changeFeed) latest() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.seq
+}
+
+// handler responds to GET /api/changes?since=<cursor>&wait=30s
+// It returns immediately if there are changes after the cursor; otherwise it
+// blocks until a flag or zone change happens or the wait expires (long polling)
+//
+// Without ?since= it returns the current cursor right away, which clients
+// use as the starting point for their next request
+func (f *changeFeed) handler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if query.Get("since") == "" {
+		writeJSON(w, r, http.StatusOK, models.ChangesResponse{
+			Changes: []models.ChangeEvent{},
+			Cursor:  strconv.FormatUint(f.latest(), 10),
+		})
+		return
+	}
+
+	cursor, err := strconv.ParseUint(query.Get("since"), 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "since must be a cursor returned by a previous request")
+		return
+	}
+
+	wait := defaultChangesWait
+	if raw := query.Get("wait"); raw != "" {
+		wait, err = time.ParseDuration(raw)
+		if err != nil || wait < 0 {
+			writeError(w, r, http.StatusBadRequest, "wait must be a duration such as 30s")
+			return
+		}
+		if wait > maxChangesWait {
+			wait = maxChangesWait
+		}
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	// The wait may be longer than the server's write timeout
+	extendWriteDeadline(w, wait+requestConfig(r).Server.WriteTimeout)
+
+	for {
+		events, latest, reset, notify := f.since(cursor)
+		events = visibleChanges(r.Context(), events)
+		if len(events) > 0 || reset {
+			writeJSON(w, r, http.StatusOK, models.ChangesResponse{
+				Changes: events,
+				Cursor:  strconv.FormatUint(latest, 10),
+				Reset:   reset,
+			})
+			return
+		}
+
+		select {
+		case <-notify:
+			// Something changed; loop to collect it
+		case <-f.done:
+			// Shutting down: answer like a timeout so the client reconnects to another pod
+			w.Header().Set("Connection", "close")
+			writeJSON(w, r, http.StatusOK, models.ChangesResponse{
+				Changes: []models.ChangeEvent{},
+				Cursor:  strconv.FormatUint(latest, 10),
+			})
+			return
+		case <-timer.C:
+			// Nothing changed within the wait; the client should simply ask again
+			writeJSON(w, r, http.StatusOK, models.ChangesResponse{
+				Changes: []models.ChangeEvent{},
+				Cursor:  strconv.FormatUint(latest, 10),
+			})
+			return
+		case <-r.Context().Done():
+			// Client disconnected
+			return
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Fault injection makes this replica misbehave on purpose for a while, so dashboards, alerting
+// rules, and the zones' retry logic can be checked before a real incident: public requests can be
+// slowed down or answered with errors, and zones reported unhealthy. It is off unless
+// CHAOS_ENABLED=true, faults are set through /internal/faults on the internal listener, each one
+// affects only the replica it was posted to, and each ends after its duration
+
+// maxFaultLatency is the longest delay a latency fault adds, below the default write timeout
+const maxFaultLatency = time.Minute
+
+// faultsInjected counts the requests and zone checks faults were injected into, so a dashboard can
+// tell an injected error from a real one
+var faultsInjected = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+	Name: "faults_injected_total",
+	Help: "Requests and zone checks a fault was injected into (CHAOS_ENABLED), by kind.",
+}, []string{"kind"})
+
+// fault is one injected fault, as listed by GET /internal/faults
+type fault struct {
+	ID        int       `json:"id"`
+	Kind      string    `json:"kind"`              // "latency", "error", or "unhealthy"
+	Route     string    `json:"route,omitempty"`   // Path prefix of the requests it affects; empty for all of /api
+	Zone      string    `json:"zone,omitempty"`    // The zone an unhealthy fault reports as unhealthy
+	Latency   string    `json:"latency,omitempty"` // Delay a latency fault adds
+	Status    int       `json:"status,omitempty"`  // Status an error fault answers with
+	Rate      float64   `json:"rate"`              // Share of matching requests or checks affected
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	latency time.Duration
+}
+
+// faultRequest is the body of POST /internal/faults
+type faultRequest struct {
+	Kind    string `json:"kind" validate:"required,oneof=latency error unhealthy"`
+	Route   string `json:"route" validate:"omitempty,startswith=/,max=200"` // e.g. "/api/feature-flags"
+	Zone    string `json:"zone" validate:"required_if=Kind unhealthy"`
+	Latency string `json:"latency" validate:"required_if=Kind latency"` // e.g. "2s"
+	Status  int    `json:"status" validate:"omitempty,min=400,max=599"` // Default 503
+	// Optional share of matching requests affected, above 0 and at most 1 (the default)
+	Rate float64 `json:"rate"`
+	// How long the fault lasts (e.g. "10m"), at most CHAOS_MAX_DURATION
+	Duration string `json:"duration" validate:"required"`
+}
+
+// faultInjector holds this replica's faults; its methods do nothing on a nil injector, which
+// is what the server has unless CHAOS_ENABLED=true
+type faultInjector struct {
+	basePath string // BASE_PATH, stripped before matching a fault's path prefix
+
+	mu     sync.Mutex
+	faults []fault
+	lastID int
+}
+
+// newFaultInjector creates an injector without faults for the routes under basePath
+func newFaultInjector(basePath string) *faultInjector {
+	return &faultInjector{basePath: basePath}
+}
+
+// active returns the faults that haven't expired by now, dropping the rest
+func (f *faultInjector) active(now time.Time) []fault {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = slices.DeleteFunc(f.faults, func(ft fault) bool { return !now.Before(ft.ExpiresAt) })
+	return slices.Clone(f.faults)
+}
+
+// add stores ft with the next ID and returns it
+func (f *faultInjector) add(ft fault) fault {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastID++
+	ft.ID = f.lastID
+	f.faults = append(f.faults, ft)
+	return ft
+}
+
+// remove deletes the fault with id, reporting whether there was one
+func (f *faultInjector) remove(id int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := len(f.faults)
+	f.faults = slices.DeleteFunc(f.faults, func(ft fault) bool { return ft.ID == id })
+	return len(f.faults) < n
+}
+
+// hits reports whether a fault of rate applies to one request or check
+func (ft fault) hits() bool {
+	return ft.Rate >= 1 || rand.Float64() < ft.Rate
+}
+
+// matches reports whether a latency or error fault applies to a request for path
+// (relative to BASE_PATH)
+func (ft fault) matches(path string) bool {
+	if ft.Route == "" {
+		return path == "/api" || strings.HasPrefix(path, "/api/")
+	}
+	return strings.HasPrefix(path, ft.Route)
+}
+
+// middleware delays or fails the public requests the active faults match
+// Latency faults all apply, then the first error fault that hits answers the request
+func (f *faultInjector) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, f.basePath)
+		faults := f.active(time.Now())
+		for _, ft := range faults {
+			if ft.Kind != "latency" || !ft.matches(path) || !ft.hits() {
+				continue
+			}
+			faultsInjected.WithLabelValues(ft.Kind).Inc()
+			w.Header().Add("X-Injected-Fault", strconv.Itoa(ft.ID))
+			if !sleepContext(r.Context(), ft.latency) {
+				return // The client gave up
+			}
+		}
+		for _, ft := range faults {
+			if ft.Kind != "error" || !ft.matches(path) || !ft.hits() {
+				continue
+			}
+			faultsInjected.WithLabelValues(ft.Kind).Inc()
+			w.Header().Add("X-Injected-Fault", strconv.Itoa(ft.ID))
+			if ft.Status == http.StatusTooManyRequests || ft.Status == http.StatusServiceUnavailable {
+				w.Header().Set("Retry-After", "1")
+			}
+			writeError(w, r, ft.Status, fmt.Sprintf("Injected fault %d", ft.ID))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sleepContext waits for d, or until ctx is done; it reports whether the whole wait passed
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// applyZone reports a zone as unhealthy while an unhealthy fault for it hits, whatever its
+// health check (or maintenance) found
+func (f *faultInjector) applyZone(status *models.ZoneStatus) {
+	for _, ft := range f.active(time.Now()) {
+		if ft.Kind == "unhealthy" && ft.Zone == status.Name && ft.hits() {
+			faultsInjected.WithLabelValues(ft.Kind).Inc()
+			status.Status = "unhealthy"
+			status.Message = fmt.Sprintf("Injected fault %d", ft.ID)
+			return
+		}
+	}
+}
+
+// listFaultsHandler responds to GET /internal/faults
+// The faults active on this replica, oldest first
+func (f *faultInjector) listFaultsHandler(w http.ResponseWriter, r *http.Request) {
+	faults := f.active(time.Now())
+	if faults == nil {
+		faults = []fault{}
+	}
+	writeJSON(w, r, http.StatusOK, faults)
+}
+
+// injectFaultHandler responds to POST /internal/faults
+// Starts a fault on this replica; it ends on its own after its duration
+func (s *Server) injectFaultHandler(w http.ResponseWriter, r *http.Request) {
+	var req faultRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	now := time.Now()
+	ft := fault{Kind: req.Kind, Rate: req.Rate, CreatedAt: now}
+	var fieldErrors []models.FieldError
+	duration, err := time.ParseDuration(req.Duration)
+	if err != nil || duration <= 0 || duration > s.config.Server.ChaosMaxDuration {
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "duration", Message: fmt.Sprintf("must be a positive duration of at most %s, e.g. 10m", s.config.Server.ChaosMaxDuration)})
+	}
+	ft.ExpiresAt = now.Add(duration)
+	if req.Rate < 0 || req.Rate > 1 {
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "rate", Message: "must be above 0 and at most 1"})
+	} else if req.Rate == 0 {
+		ft.Rate = 1
+	}
+	switch req.Kind {
+	case "latency":
+		ft.Route = req.Route
+		ft.latency, err = time.ParseDuration(req.Latency)
+		if err != nil || ft.latency <= 0 || ft.latency > maxFaultLatency {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: "latency", Message: fmt.Sprintf("must be a positive duration of at most %s, e.g. 2s", maxFaultLatency)})
+		}
+		ft.Latency = ft.latency.String()
+	case "error":
+		ft.Route = req.Route
+		ft.Status = cmp.Or(req.Status, http.StatusServiceUnavailable)
+	case "unhealthy":
+		if _, ok := s.findZone(req.Zone); !ok {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: "zone", Message: "must be a zone (" + s.zoneNames() + ")"})
+		}
+		ft.Zone = req.Zone
+	}
+	if len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+
+	ft = s.faults.add(ft)
+	log.Printf("Fault %d injected until %s: %s", ft.ID, ft.ExpiresAt.Format(time.RFC3339), faultSummary(ft))
+	writeJSON(w, r, http.StatusCreated, ft)
+}
+
+// faultSummary describes a fault for the log
+func faultSummary(ft fault) string {
+	target := ft.Route
+	if target == "" {
+		target = "/api"
+	}
+	switch ft.Kind {
+	case "latency":
+		return fmt.Sprintf("%s added to %g of %s", ft.Latency, ft.Rate, target)
+	case "error":
+		return fmt.Sprintf("%d for %g of %s", ft.Status, ft.Rate, target)
+	default:
+		return fmt.Sprintf("%s unhealthy in %g of checks", ft.Zone, ft.Rate)
+	}
+}
+
+// deleteFaultHandler responds to DELETE /internal/faults/{id}
+func (f *faultInjector) deleteFaultHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || !f.remove(id) {
+		writeError(w, r, http.StatusNotFound, "Fault not found")
+		return
+	}
+	log.Printf("Fault %d removed", id)
+	writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "Fault removed"})
+}
+
+// clearFaultsHandler responds to DELETE /internal/faults
+// Ends every fault on this replica at once
+func (f *faultInjector) clearFaultsHandler(w http.ResponseWriter, r *http.Request) {
+	n := len(f.active(time.Now()))
+	f.mu.Lock()
+	f.faults = nil
+	f.mu.Unlock()
+	log.Printf("Removed %d faults", n)
+	writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: fmt.Sprintf("Removed %d faults", n)})
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+// newRootCommand builds the backend CLI
+// Running `backend` with no subcommand serves the API, so existing deployments
+// and `go run . --mock` keep working
+func newRootCommand() *cobra.Command {
+	// Filled in before any command runs; the commands hand it to what they build
+	var cfg Config
+	var configFile string
+	serve := newServeCommand(&cfg, &configFile)
+
+	root := &cobra.Command{
+		Use:   "backend",
+		Short: "Backend API for the multi-zone microfrontend",
+		Args:  cobra.NoArgs,
+		RunE:  serve.RunE,
+		// Every command runs with the validated configuration (see config.go)
+		PersistentPreRunE: func(*cobra.Command, []string) error {
+			loaded, err := loadConfig(configFile)
+			if err != nil {
+				return err
+			}
+			cfg = loaded
+			return nil
+		},
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	root.PersistentFlags().StringVar(&configFile, "config", os.Getenv("CONFIG_FILE"), "YAML config file; environment variables override its values")
+	root.Flags().AddFlagSet(serve.Flags())
+	root.CompletionOptions.DisableDefaultCmd = true
+
+	root.AddCommand(serve, newSeedCommand(&cfg), newMigrateCommand(&cfg), newBackupCommand(&cfg), newMockZoneCommand())
+	return root
+}
+
+// newServeCommand builds `backend serve` with the configuration in cfg, loaded from configFile
+func newServeCommand(cfg *Config, configFile *string) *cobra.Command {
+	var mockMode, demoMode bool
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the REST and GraphQL APIs",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			runServer(*cfg, *configFile, mockMode, demoMode || cfg.Demo.Enabled)
+			return nil
+		},
+	}
+	// --mock serves sample data from memory so zones can be developed without Postgres
+	cmd.Flags().BoolVar(&mockMode, "mock", false, "serve in-memory sample data instead of connecting to Postgres")
+	// --demo is mock mode with generated data that resets periodically (see demo.go)
+	cmd.Flags().BoolVar(&demoMode, "demo", false, "serve resettable in-memory demo data with external effects disabled")
+	return cmd
+}
+
+// newSeedCommand builds `backend seed [--file path | --generate users=N flags=N]`
+// Without --file it adds the sample users and feature flags; existing emails and keys are skipped
+// With --file the file's users and flags are upserted, so existing records are updated to match it
+// With --generate it adds that many fake records (see generate.go)
+func newSeedCommand(cfg *Config) *cobra.Command {
+	var file string
+	var generate bool
+	var randomSeed uint64
+	cmd := &cobra.Command{
+		Use:   "seed [--generate users=N flags=N]",
+		Short: "Add sample (or file-provided, or generated) users and feature flags to the database",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if generate {
+				return nil
+			}
+			return cobra.NoArgs(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if generate && file != "" {
+				return errors.New("--file and --generate can't be combined")
+			}
+
+			// Read the file (or the counts) first so a typo doesn't wait for the database
+			var doc seedDocument
+			var spec generateSpec
+			if file != "" {
+				var err error
+				if doc, err = readSeedFile(file); err != nil {
+					return err
+				}
+			}
+			if generate {
+				var err error
+				if spec, err = parseGenerateSpec(args); err != nil {
+					return err
+				}
+			}
+
+			database, err := openMigratedDB(*cfg)
+			if err != nil {
+				return err
+			}
+			defer closeDB(database)
+
+			if generate {
+				started := time.Now()
+				seed := randomSeedIfZero(randomSeed)
+				log.Printf("Generating %d users and %d feature flags (--random-seed %d)", spec.Users, spec.Flags, seed)
+				users, flags, err := generateData(cmd.Context(), database, spec, seed)
+				log.Printf("Users: %d generated, %d already existed", users.Created, users.Unchanged)
+				log.Printf("Feature flags: %d generated, %d already existed", flags.Created, flags.Unchanged)
+				if err != nil {
+					return err
+				}
+				log.Printf("Generated in %s", time.Since(started).Round(time.Millisecond))
+				return nil
+			}
+
+			if file != "" {
+				users, flags, err := upsertSeed(cmd.Context(), database, doc)
+				if err != nil {
+					return err
+				}
+				log.Printf("Users: %d created, %d updated, %d unchanged", users.Created, users.Updated, users.Unchanged)
+				log.Printf("Feature flags: %d created, %d updated, %d unchanged", flags.Created, flags.Updated, flags.Unchanged)
+				return nil
+			}
+
+			users, flags := sampleUsers(), sampleFeatureFlags()
+			usersCreated, flagsCreated, err := seedDatabase(cmd.Context(), database, users, flags)
+			if err != nil {
+				return err
+			}
+			log.Printf("Users: %d created, %d already existed", usersCreated, len(users)-usersCreated)
+			log.Printf("Feature flags: %d created, %d already existed", flagsCreated, len(flags)-flagsCreated)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&file, "file", "", `JSON or YAML (.yaml, .yml) file with "users" and "featureFlags" to upsert instead of the samples`)
+	cmd.Flags().BoolVar(&generate, "generate", false, "generate fake records instead, e.g. --generate users=10000 flags=200")
+	cmd.Flags().Uint64Var(&randomSeed, "random-seed", 1, "seed for --generate; the same seed generates the same records (0 picks a random one)")
+	return cmd
+}
+
+// newMigrateCommand builds `backend migrate up|down|status`
+func newMigrateCommand(cfg *Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply, roll back, or list schema migrations",
+	}
+
+	up := &cobra.Command{
+		Use:   "up",
+		Short: "Create or update tables and apply pending migrations",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			database, err := openMigratedDB(*cfg)
+			if err != nil {
+				return err
+			}
+			closeDB(database)
+			log.Println("Database is up to date")
+			return nil
+		},
+	}
+
+	var steps int
+	down := &cobra.Command{
+		Use:   "down",
+		Short: "Roll back the most recently applied migrations",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			if steps < 1 {
+				return fmt.Errorf("--steps must be at least 1")
+			}
+			database, err := openPrimaryDB(cfg.Database, newLogLevel(cfg.Logging.Level))
+			if err != nil {
+				return err
+			}
+			defer closeDB(database)
+			return rollbackMigrations(database, steps)
+		},
+	}
+	down.Flags().IntVar(&steps, "steps", 1, "number of migrations to roll back")
+
+	status := &cobra.Command{
+		Use:   "status",
+		Short: "List migrations and when they were applied",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			database, err := openPrimaryDB(cfg.Database, newLogLevel(cfg.Logging.Level))
+			if err != nil {
+				return err
+			}
+			defer closeDB(database)
+
+			states, err := migrationStatus(database)
+			if err != nil {
+				return err
+			}
+			out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(out, "ID\tAPPLIED\tDESCRIPTION")
+			for _, state := range states {
+				applied := "pending"
+				if state.AppliedAt != nil {
+					applied = state.AppliedAt.Format(time.RFC3339)
+				}
+				fmt.Fprintf(out, "%s\t%s\t%s\n", state.ID, applied, state.Description)
+			}
+			return out.Flush()
+		},
+	}
+
+	cmd.AddCommand(up, down, status)
+	return cmd
+}
+
+// newBackupCommand builds `backend backup create|list|restore|jobs` (see backup.go)
+// Jobs run in the foreground and are recorded in backup_jobs like those started through the API
+func newBackupCommand(cfg *Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Back up the database to the backup store, or restore it from there",
+	}
+
+	// runBackupJob connects, starts a job and waits for it
+	runBackupJob := func(ctx context.Context, kind, name string) error {
+		database, err := openMigratedDB(*cfg)
+		if err != nil {
+			return err
+		}
+		defer closeDB(database)
+		runner, err := newBackupRunner(database, *cfg)
+		if err != nil {
+			return err
+		}
+		if kind == "restore" && !usingSQLite(database) {
+			// Running servers drop the restored flags from their caches like any other change
+			s := newServer(database, *cfg)
+			s.changes.broadcast = s.notifyFlagChange
+			runner.onRestore = s.flagsRestored
+		}
+
+		job, run, err := runner.start(ctx, kind, name)
+		if err != nil {
+			return err
+		}
+		log.Printf("Started %s job %d: %s -> %s", kind, job.ID, name, runner.store)
+		return run(ctx)
+	}
+
+	create := &cobra.Command{
+		Use:   "create",
+		Short: "Dump the database with pg_dump and store it",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runBackupJob(cmd.Context(), "backup", newBackupName(time.Now()))
+		},
+	}
+
+	var confirmed bool
+	restore := &cobra.Command{
+		Use:   "restore <name>",
+		Short: "Replace every table with the contents of a stored backup",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			if !backupNamePattern.MatchString(name) {
+				return fmt.Errorf("invalid backup name %q; see `backend backup list`", name)
+			}
+			if !confirmed {
+				return fmt.Errorf("restoring replaces every table; run again with --yes to restore %s", name)
+			}
+			return runBackupJob(cmd.Context(), "restore", name)
+		},
+	}
+	restore.Flags().BoolVar(&confirmed, "yes", false, "confirm that the database may be overwritten")
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List stored backups, newest first",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			store, err := newBackupStore(cfg.Backup)
+			if err != nil {
+				return err
+			}
+			backups, err := store.List(cmd.Context())
+			if err != nil {
+				return err
+			}
+			out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(out, "NAME\tSIZE\tCREATED")
+			for _, backup := range backups {
+				fmt.Fprintf(out, "%s\t%d\t%s\n", backup.Name, backup.SizeBytes, backup.CreatedAt.Format(time.RFC3339))
+			}
+			return out.Flush()
+		},
+	}
+
+	jobs := &cobra.Command{
+		Use:   "jobs",
+		Short: "List recent backup and restore jobs",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			database, err := openMigratedDB(*cfg)
+			if err != nil {
+				return err
+			}
+			defer closeDB(database)
+
+			recent, err := (&backupRunner{db: database}).recentBackupJobs(cmd.Context(), 20)
+			if err != nil {
+				return err
+			}
+			out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(out, "ID\tKIND\tBACKUP\tSTATUS\tSTARTED\tHOST\tERROR")
+			for _, job := range recent {
+				fmt.Fprintf(out, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", job.ID, job.Kind, job.Backup, job.Status, job.StartedAt.Format(time.RFC3339), job.Host, job.Error)
+			}
+			return out.Flush()
+		},
+	}
+
+	cmd.AddCommand(create, restore, list, jobs)
+	return cmd
+}
+
+// newMockZoneCommand builds `backend mockzone --name zone-main --port 3999 --behavior flaky` (see mockzone.go)
+// It needs no database, and serves until it is interrupted
+func newMockZoneCommand() *cobra.Command {
+	var port int
+	var htmlFile string
+	options := mockZoneOptions{Status: http.StatusServiceUnavailable}
+	cmd := &cobra.Command{
+		Use:   "mockzone",
+		Short: "Serve a stand-in zone that is healthy, failing, or slow on demand",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := options.validate(); err != nil {
+				return err
+			}
+			html, err := readMockZoneHTML(htmlFile)
+			if err != nil {
+				return err
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGTERM, syscall.SIGINT)
+			defer stop()
+			server := &http.Server{
+				Addr:              net.JoinHostPort("", strconv.Itoa(port)),
+				Handler:           newMockZone(options, html),
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			go func() {
+				<-ctx.Done()
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				server.Shutdown(shutdownCtx)
+			}()
+
+			log.Printf("Mock zone %s is %s on http://localhost:%d (change it with PUT /_mockzone?behavior=...)", options.Name, options.Behavior, port)
+			if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&options.Name, "name", "zone-main", "zone name shown on the page")
+	cmd.Flags().IntVar(&port, "port", 3999, "port to listen on")
+	cmd.Flags().StringVar(&options.Behavior, "behavior", "healthy", "one of "+strings.Join(mockZoneBehaviors, ", "))
+	cmd.Flags().IntVar(&options.Status, "status", options.Status, "status of failed responses (degraded, flaky, flapping)")
+	cmd.Flags().StringVar(&options.Latency, "latency", "8s", "delay of every response with --behavior slow")
+	cmd.Flags().Float64Var(&options.ErrorRate, "error-rate", 0.5, "share of failed responses with --behavior flaky")
+	cmd.Flags().StringVar(&options.Period, "period", "30s", "how long --behavior flapping stays up, then down")
+	cmd.Flags().StringVar(&htmlFile, "html", "", "HTML file served for successful responses instead of the built-in page")
+	return cmd
+}
+
+// openMigratedDB connects to the primary configured in cfg and brings the schema up to date
+// Queries are logged at cfg's LOG_LEVEL
+func openMigratedDB(cfg Config) (*gorm.DB, error) {
+	database, err := openPrimaryDB(cfg.Database, newLogLevel(cfg.Logging.Level))
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateSchema(database); err != nil {
+		closeDB(database)
+		return nil, err
+	}
+	return database, nil
+}
+
+// closeDB closes a connection pool opened by a command
+func closeDB(database *gorm.DB) {
+	if sqlDB, err := database.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
@@ -0,0 +1,331 @@
+// Package client is a typed Go SDK for the backend API
+// Other Go services and tools should use it instead of making raw HTTP calls
+//
+// Example:
+//
+//	c := client.New("http://backend:8080", client.WithToken(os.Getenv("BACKEND_TOKEN")))
+//	users, err := c.ListUsers(ctx)
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Default settings used when no options are given
+const (
+	DefaultTimeout    = 10 * time.Second
+	DefaultMaxRetries = 3
+	DefaultRetryWait  = 200 * time.Millisecond
+)
+
+// Re-export the API models so callers don't need to import an internal package
+type (
+	User            = models.User
+	FeatureFlag     = models.FeatureFlag
+	ZoneStatus      = models.ZoneStatus
+	HealthResponse  = models.HealthResponse
+	SeedResponse    = models.SeedResponse
+	MessageResponse = models.MessageResponse
+)
+
+// Client talks to the backend API over HTTP
+// It is safe for concurrent use by multiple goroutines
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+	userAgent  string
+	maxRetries int
+	retryWait  time.Duration
+	timeout    time.Duration // Set by WithTimeout; zero keeps the http.Client's own
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient replaces the underlying http.Client (for custom transports or tests)
+// The client is never changed; with WithTimeout, a copy of it is used
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithTimeout sets the timeout for a single HTTP attempt, whatever order it is given in with
+// WithHTTPClient
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) { c.timeout = d }
+}
+
+// WithToken sends the token as a Bearer Authorization header on every request
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithUserAgent sets the User-Agent header so the backend can identify the caller
+func WithUserAgent(ua string) Option {
+	return func(c *Client) { c.userAgent = ua }
+}
+
+// WithRetries sets how many times a failed idempotent request is retried
+// The wait between attempts doubles after each retry
+func WithRetries(maxRetries int, wait time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.retryWait = wait
+	}
+}
+
+// New creates a Client for the backend at baseURL (e.g., "http://backend:8080")
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		userAgent:  "backend-go-client",
+		maxRetries: DefaultMaxRetries,
+		retryWait:  DefaultRetryWait,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.httpClient == nil {
+		c.httpClient = &http.Client{Timeout: DefaultTimeout}
+	}
+	if c.timeout > 0 {
+		// A copy, so a shared client such as http.DefaultClient keeps its own timeout
+		hc := *c.httpClient
+		hc.Timeout = c.timeout
+		c.httpClient = &hc
+	}
+	return c
+}
+
+// APIError is returned when the backend responds with a non-2xx status code
+type APIError struct {
+	StatusCode int    // HTTP status code
+	Message    string // Response body sent by the backend
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("backend API error: HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether err is an APIError with status 404
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// Health calls GET /health
+func (c *Client) Health(ctx context.Context) (map[string]string, error) {
+	var out map[string]string
+	err := c.do(ctx, http.MethodGet, "/health", nil, &out)
+	return out, err
+}
+
+// ZoneStatus calls GET /api/zones/status and returns the health of every zone
+func (c *Client) ZoneStatus(ctx context.Context) (*HealthResponse, error) {
+	var out HealthResponse
+	if err := c.do(ctx, http.MethodGet, "/api/zones/status", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListUsers calls GET /api/users
+func (c *Client) ListUsers(ctx context.Context) ([]User, error) {
+	var out []User
+	err := c.do(ctx, http.MethodGet, "/api/users", nil, &out)
+	return out, err
+}
+
+// GetUser calls GET /api/users/{id}
+func (c *Client) GetUser(ctx context.Context, id uint) (*User, error) {
+	var out User
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/users/%d", id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateUser calls POST /api/users
+func (c *Client) CreateUser(ctx context.Context, email, name string) (*User, error) {
+	var out User
+	body := User{Email: email, Name: name}
+	if err := c.do(ctx, http.MethodPost, "/api/users", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteUser calls DELETE /api/users/{id}
+func (c *Client) DeleteUser(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/users/%d", id), nil, nil)
+}
+
+// ListFeatureFlags calls GET /api/feature-flags
+func (c *Client) ListFeatureFlags(ctx context.Context) ([]FeatureFlag, error) {
+	var out []FeatureFlag
+	err := c.do(ctx, http.MethodGet, "/api/feature-flags", nil, &out)
+	return out, err
+}
+
+// GetFeatureFlag calls GET /api/feature-flags/{key}
+func (c *Client) GetFeatureFlag(ctx context.Context, key string) (*FeatureFlag, error) {
+	var out FeatureFlag
+	if err := c.do(ctx, http.MethodGet, "/api/feature-flags/"+url.PathEscape(key), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// EvaluateFlag reports whether the feature flag is enabled
+// A flag that doesn't exist evaluates to false, matching the zones' fail-safe behavior
+func (c *Client) EvaluateFlag(ctx context.Context, key string) (bool, error) {
+	flag, err := c.GetFeatureFlag(ctx, key)
+	if err != nil {
+		if IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return flag.Enabled, nil
+}
+
+// CreateFeatureFlag calls POST /api/feature-flags
+func (c *Client) CreateFeatureFlag(ctx context.Context, flag FeatureFlag) (*FeatureFlag, error) {
+	var out FeatureFlag
+	if err := c.do(ctx, http.MethodPost, "/api/feature-flags", flag, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetFeatureFlagEnabled calls PATCH /api/feature-flags/{key} to toggle a flag
+func (c *Client) SetFeatureFlagEnabled(ctx context.Context, key string, enabled bool) (*FeatureFlag, error) {
+	var out FeatureFlag
+	body := map[string]interface{}{"enabled": enabled}
+	if err := c.do(ctx, http.MethodPatch, "/api/feature-flags/"+url.PathEscape(key), body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteFeatureFlag calls DELETE /api/feature-flags/{key}
+func (c *Client) DeleteFeatureFlag(ctx context.Context, key string) error {
+	return c.do(ctx, http.MethodDelete, "/api/feature-flags/"+url.PathEscape(key), nil, nil)
+}
+
+// Seed calls POST /api/seed
+func (c *Client) Seed(ctx context.Context) (*SeedResponse, error) {
+	var out SeedResponse
+	if err := c.do(ctx, http.MethodPost, "/api/seed", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// do sends a request and decodes the JSON response into out (if non-nil)
+// Idempotent requests are retried on network errors and 5xx/429 responses
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var payload []byte
+	if in != nil {
+		var err error
+		if payload, err = json.Marshal(in); err != nil {
+			return fmt.Errorf("failed to encode request body: %w", err)
+		}
+	}
+
+	attempts := 1
+	if isIdempotent(method) {
+		attempts += c.maxRetries
+	}
+
+	wait := c.retryWait
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			// Wait before retrying, unless the caller gives up first
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+			wait *= 2
+		}
+
+		retry, err := c.attempt(ctx, method, path, payload, out)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry {
+			break
+		}
+	}
+	return lastErr
+}
+
+// attempt performs a single HTTP round trip
+// It returns whether the failure is worth retrying
+func (c *Client) attempt(ctx context.Context, method, path string, payload []byte, out interface{}) (bool, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return false, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	// Continue the caller's trace (W3C traceparent) if its service uses OpenTelemetry
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// Network errors are retryable unless the context was cancelled
+		return ctx.Err() == nil, fmt.Errorf("request to %s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+
+	if out == nil {
+		return false, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return false, nil
+}
+
+// isIdempotent reports whether a request with this method can be safely retried
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient starts handler behind an httptest server and returns a client for it that retries
+// without waiting
+func newTestClient(t *testing.T, handler http.HandlerFunc, opts ...Option) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return New(server.URL, append([]Option{WithRetries(DefaultMaxRetries, time.Millisecond)}, opts...)...)
+}
+
+func TestRetriesIdempotentRequests(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"key":"dark_mode","enabled":true}`))
+	})
+
+	enabled, err := c.EvaluateFlag(context.Background(), "dark_mode")
+	if err != nil || !enabled {
+		t.Fatalf("EvaluateFlag = %v, %v; want true after two 503s", enabled, err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("%d attempts, want 3", calls.Load())
+	}
+}
+
+func TestGivesUpAfterMaxRetries(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	_, err := c.ListUsers(context.Background())
+	apiErr, ok := err.(*APIError)
+	if !ok || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("ListUsers error = %v, want the 429", err)
+	}
+	if calls.Load() != 1+DefaultMaxRetries {
+		t.Errorf("%d attempts, want %d", calls.Load(), 1+DefaultMaxRetries)
+	}
+}
+
+func TestDoesNotRetryPostOrClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	if _, err := c.CreateUser(context.Background(), "a@example.com", "A"); err == nil {
+		t.Fatal("CreateUser succeeded on a 502")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("POST made %d attempts, want 1", calls.Load())
+	}
+
+	calls.Store(0)
+	enabled, err := c.EvaluateFlag(context.Background(), "missing")
+	if err != nil || enabled {
+		t.Errorf("EvaluateFlag of a missing flag = %v, %v; want false", enabled, err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("404 made %d attempts, want 1", calls.Load())
+	}
+}
+
+func TestSendsTokenAndUserAgent(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("User-Agent") != "flag-sync/1.0" {
+			t.Errorf("User-Agent = %q", r.Header.Get("User-Agent"))
+		}
+		w.Write([]byte(`{"message":"ok"}`))
+	}, WithToken("secret"), WithUserAgent("flag-sync/1.0"))
+
+	if err := c.DeleteFeatureFlag(context.Background(), "dark_mode"); err != nil {
+		t.Errorf("DeleteFeatureFlag with the token: %v", err)
+	}
+
+	anonymous := New(c.baseURL, WithRetries(0, 0))
+	err := anonymous.DeleteFeatureFlag(context.Background(), "dark_mode")
+	if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("DeleteFeatureFlag without a token = %v, want a 401", err)
+	}
+}
+
+func TestWithTimeoutCopiesTheHTTPClient(t *testing.T) {
+	shared := &http.Client{Timeout: time.Minute}
+	for _, c := range []*Client{
+		New("http://backend", WithHTTPClient(shared), WithTimeout(time.Second)),
+		New("http://backend", WithTimeout(time.Second), WithHTTPClient(shared)),
+	} {
+		if c.httpClient == shared || c.httpClient.Timeout != time.Second {
+			t.Errorf("client timeout = %v (shared client: %v), want a copy with 1s", c.httpClient.Timeout, c.httpClient == shared)
+		}
+	}
+	if shared.Timeout != time.Minute {
+		t.Errorf("shared client timeout = %v, want it left at 1m", shared.Timeout)
+	}
+	if c := New("http://backend", WithHTTPClient(shared)); c.httpClient != shared {
+		t.Error("without WithTimeout the given client isn't used as is")
+	}
+	if c := New("http://backend"); c.httpClient.Timeout != DefaultTimeout {
+		t.Errorf("default timeout = %v, want %v", c.httpClient.Timeout, DefaultTimeout)
+	}
+}
@@ -0,0 +1,247 @@
+// Command tsgen generates TypeScript interfaces from the backend's Go models
+// The Next.js zones import the generated file instead of hand-writing interfaces,
+// so the frontend types can't drift away from the Go structs
+//
+// Usage:
+//
+//	go run ./cmd/tsgen -out ../zone-main/app/lib/api-types.ts -out ../zone-admin/app/lib/api-types.ts
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+)
+
+// exportedTypes lists every Go type that gets a TypeScript interface
+// Add new API models and payloads here to expose them to the zones
+var exportedTypes = []interface{}{
+	models.User{},
+	models.FeatureFlag{},
+	models.DeploymentEvent{},
+	models.ZoneStatus{},
+	models.HealthResponse{},
+	models.SeedResponse{},
+	models.MessageResponse{},
+	models.CreateUserRequest{},
+	models.BulkCreateUsersRequest{},
+	models.CreateFeatureFlagRequest{},
+	models.BulkCreateFeatureFlagsRequest{},
+	models.UpdateFeatureFlagRequest{},
+	models.FieldError{},
+	models.DashboardResponse{},
+	models.UserStats{},
+	models.FlagSummary{},
+	models.ChangeEvent{},
+	models.ChangesResponse{},
+	models.FlagBootstrap{},
+	models.APIUsage{},
+	models.APIUsageTotal{},
+	models.APIUsageReport{},
+	models.SLOReport{},
+	models.SLOObjective{},
+	models.SLOWindow{},
+	models.Announcement{},
+	models.CreateAnnouncementRequest{},
+	models.UpdateAnnouncementRequest{},
+	models.MaintenanceMode{},
+	models.SetMaintenanceRequest{},
+	models.MaintenanceStatus{},
+	models.Settings{},
+	models.UpdateSettingsRequest{},
+	models.Redirect{},
+	models.CreateRedirectRequest{},
+	models.UpdateRedirectRequest{},
+	models.NewsletterSubscription{},
+	models.SubscribeRequest{},
+	models.NewsletterTokenRequest{},
+	models.SurveyOption{},
+	models.SurveyQuestion{},
+	models.Survey{},
+	models.CreateSurveyRequest{},
+	models.UpdateSurveyRequest{},
+	models.SurveyAnswer{},
+	models.SurveyResponse{},
+	models.SubmitSurveyResponseRequest{},
+	models.SurveyResults{},
+	models.SurveyQuestionResult{},
+	models.ReleaseNote{},
+	models.CreateReleaseNoteRequest{},
+	models.UpdateReleaseNoteRequest{},
+	models.NavigationItem{},
+	models.CreateNavigationItemRequest{},
+	models.UpdateNavigationItemRequest{},
+	models.NavigationOrderRequest{},
+	models.ZoneRoute{},
+	models.ZoneRouteChange{},
+	models.RoutingManifest{},
+	models.RoutingManifestRoute{},
+	models.CreateZoneRouteRequest{},
+	models.UpdateZoneRouteRequest{},
+	models.ExperimentVariant{},
+	models.Experiment{},
+	models.CreateExperimentRequest{},
+	models.UpdateExperimentRequest{},
+	models.AssignExperimentRequest{},
+	models.AssignmentResponse{},
+	models.ExperimentEventInput{},
+	models.ExperimentEventsRequest{},
+	models.ExperimentEventsResponse{},
+	models.ExperimentResults{},
+	models.ExperimentVariantResult{},
+	models.AnalyticsEvent{},
+	models.AnalyticsEventsRequest{},
+	models.AnalyticsEventsResponse{},
+	models.AnalyticsReport{},
+	models.AnalyticsTotals{},
+	models.AnalyticsDay{},
+	models.AnalyticsPage{},
+	models.AnalyticsEventTotal{},
+	models.HeartbeatRequest{},
+	models.ActiveUsers{},
+	models.Organization{},
+	models.Project{},
+	models.ProjectAPIKey{},
+	models.ProjectAPIKeyCreated{},
+	models.CreateOrganizationRequest{},
+	models.UpdateOrganizationRequest{},
+	models.CreateProjectRequest{},
+	models.UpdateProjectRequest{},
+	models.CreateProjectAPIKeyRequest{},
+	models.ContactSubmission{},
+	models.ContactRequest{},
+	models.UpdateContactSubmissionRequest{},
+	models.Feedback{},
+	models.CreateFeedbackRequest{},
+	models.UpdateFeedbackRequest{},
+	models.Upload{},
+	models.UploadCreated{},
+	models.CreateUploadRequest{},
+	models.UserAvatar{},
+	models.SetAvatarRequest{},
+	models.SearchResult{},
+	models.SearchResponse{},
+	models.ActivityEvent{},
+	models.RetentionPolicy{},
+	models.Bundle{},
+	models.BundleChange{},
+	models.BundleImportResponse{},
+	models.FlagTranslation{},
+	models.AnnouncementTranslation{},
+}
+
+// outputFlags collects repeated -out flags so one run can write to every zone
+type outputFlags []string
+
+func (o *outputFlags) String() string     { return strings.Join(*o, ",") }
+func (o *outputFlags) Set(v string) error { *o = append(*o, v); return nil }
+
+func main() {
+	var outputs outputFlags
+	flag.Var(&outputs, "out", "path of a TypeScript file to write (can be repeated)")
+	flag.Parse()
+
+	if len(outputs) == 0 {
+		log.Fatal("at least one -out path is required")
+	}
+
+	source := generate(exportedTypes)
+
+	for _, path := range outputs {
+		if err := os.WriteFile(path, source, 0o644); err != nil {
+			log.Fatalf("Failed to write %s: %v", path, err)
+		}
+		log.Printf("Wrote %s", path)
+	}
+}
+
+// generate renders a TypeScript interface for each of the given Go values
+func generate(values []interface{}) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by apps/backend/cmd/tsgen from the Go models. DO NOT EDIT.\n")
+	buf.WriteString("// Regenerate with: cd apps/backend && go generate ./internal/models\n")
+
+	for _, v := range values {
+		t := reflect.TypeOf(v)
+		buf.WriteString("\n")
+		fmt.Fprintf(&buf, "// Mirrors models.%s in the Go backend\n", t.Name())
+		fmt.Fprintf(&buf, "export interface %s {\n", t.Name())
+		writeFields(&buf, t)
+		buf.WriteString("}\n")
+	}
+
+	return buf.Bytes()
+}
+
+// writeFields writes one TypeScript property per JSON-encoded struct field
+// Embedded structs are flattened the same way encoding/json flattens them
+func writeFields(buf *bytes.Buffer, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			writeFields(buf, field.Type)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		optional := ""
+		if strings.Contains(opts, "omitempty") {
+			optional = "?"
+		}
+
+		fmt.Fprintf(buf, "  %s%s: %s\n", name, optional, tsType(field.Type))
+	}
+}
+
+// tsType maps a Go type to its TypeScript equivalent as seen through encoding/json
+func tsType(t reflect.Type) string {
+	// time.Time is marshaled as an RFC 3339 string
+	if t == reflect.TypeOf(time.Time{}) {
+		return "string"
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Pointer:
+		return tsType(t.Elem()) + " | null"
+	case reflect.Slice, reflect.Array:
+		elem := tsType(t.Elem())
+		if strings.Contains(elem, " ") {
+			elem = "(" + elem + ")"
+		}
+		return elem + "[]"
+	case reflect.Map:
+		return fmt.Sprintf("Record<%s, %s>", tsType(t.Key()), tsType(t.Elem()))
+	case reflect.Struct:
+		// Named structs are expected to be listed in exportedTypes
+		return t.Name()
+	default:
+		return "unknown"
+	}
+}
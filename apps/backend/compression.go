@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Writer pools so we don't allocate a new compressor for every response
+var (
+	gzipWriterPool = sync.Pool{
+		New: func() interface{} { return gzip.NewWriter(io.Discard) },
+	}
+	brotliWriterPool = sync.Pool{
+		New: func() interface{} { return brotli.NewWriterLevel(io.Discard, brotli.DefaultCompression) },
+	}
+)
+
+// compressionMiddleware compresses responses with brotli or gzip
+// The encoding is negotiated from the client's Accept-Encoding header
+func (s *Server) compressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Caches must store compressed and uncompressed variants separately
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), s.config.Server.CompressionBrotli)
+
+		// WebSocket upgrades (GraphQL subscriptions) and HEAD requests are never compressed
+		if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressResponseWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+			minSize:        s.config.Server.CompressionMinSize,
+			status:         http.StatusOK,
+		}
+		// If the handler panics, the buffered start of its response is dropped instead of
+		// being sent as a 200, so the recovery middleware can still answer with a 500
+		finished := false
+		defer func() {
+			if finished {
+				cw.Close()
+			}
+		}()
+
+		next.ServeHTTP(cw, r)
+		finished = true
+	})
+}
+
+// negotiateEncoding picks the best supported encoding from an Accept-Encoding header
+// (brotli only when COMPRESSION_BROTLI allows it)
+// Returns "" if the client doesn't accept any encoding we support
+func negotiateEncoding(header string, brotliEnabled bool) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		// "gzip;q=0" explicitly means the client does NOT want gzip
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if value, err := strconv.ParseFloat(q, 64); err == nil && value == 0 {
+				continue
+			}
+		}
+		accepted[name] = true
+	}
+
+	// Prefer brotli since it compresses JSON noticeably better than gzip
+	if brotliEnabled && accepted["br"] {
+		return "br"
+	}
+	if accepted["gzip"] || accepted["*"] {
+		return "gzip"
+	}
+	return ""
+}
+
+// compressResponseWriter buffers the start of a response until it knows whether
+// compressing is worthwhile, then either compresses or passes bytes through unchanged
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding string // "br" or "gzip"
+	minSize  int    // COMPRESSION_MIN_SIZE: smaller responses are sent uncompressed
+	status   int    // Status code passed to WriteHeader (sent once we decide)
+
+	buf     []byte         // Bytes written before the decision was made
+	decided bool           // Whether headers have been sent to the client
+	encoder io.WriteCloser // Active compressor, nil when passing through
+}
+
+// WriteHeader records the status code; it is sent once we know whether to compress
+func (cw *compressResponseWriter) WriteHeader(code int) {
+	if cw.decided {
+		return
+	}
+	cw.status = code
+}
+
+// Write buffers data until the minimum size is reached, then starts compressing
+func (cw *compressResponseWriter) Write(p []byte) (int, error) {
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.minSize {
+			return len(p), nil
+		}
+		if err := cw.start(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if cw.encoder != nil {
+		return cw.encoder.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush sends buffered data to the client immediately (used by streaming responses)
+// A streaming response is assumed to be large, so it is compressed once flushed
+func (cw *compressResponseWriter) Flush() {
+	if !cw.decided {
+		if err := cw.start(true); err != nil {
+			return
+		}
+	}
+
+	switch enc := cw.encoder.(type) {
+	case *gzip.Writer:
+		enc.Flush()
+	case *brotli.Writer:
+		enc.Flush()
+	}
+
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack lets WebSocket handlers take over the connection
+func (cw *compressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := cw.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Unwrap exposes the underlying ResponseWriter to http.ResponseController
+func (cw *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close finishes the response, sending any buffered bytes and the compressor trailer
+func (cw *compressResponseWriter) Close() error {
+	if !cw.decided {
+		// The whole response fit in the buffer, so only compress if it's big enough
+		if err := cw.start(len(cw.buf) >= cw.minSize); err != nil {
+			return err
+		}
+	}
+
+	if cw.encoder == nil {
+		return nil
+	}
+
+	err := cw.encoder.Close()
+	switch enc := cw.encoder.(type) {
+	case *gzip.Writer:
+		gzipWriterPool.Put(enc)
+	case *brotli.Writer:
+		brotliWriterPool.Put(enc)
+	}
+	cw.encoder = nil
+	return err
+}
+
+// start sends the response headers and flushes the buffer, compressing if requested and allowed
+func (cw *compressResponseWriter) start(compress bool) error {
+	cw.decided = true
+	header := cw.Header()
+
+	if compress && cw.shouldCompress() {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length") // The compressed length isn't known up front
+
+		switch cw.encoding {
+		case "br":
+			enc := brotliWriterPool.Get().(*brotli.Writer)
+			enc.Reset(cw.ResponseWriter)
+			cw.encoder = enc
+		default:
+			enc := gzipWriterPool.Get().(*gzip.Writer)
+			enc.Reset(cw.ResponseWriter)
+			cw.encoder = enc
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if cw.encoder != nil {
+		_, err := cw.encoder.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// shouldCompress reports whether this response is a compressible type and status
+func (cw *compressResponseWriter) shouldCompress() bool {
+	header := cw.Header()
+
+	// Already encoded by the handler
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	// These statuses must not have a body
+	if cw.status < http.StatusOK || cw.status == http.StatusNoContent || cw.status == http.StatusNotModified {
+		return false
+	}
+
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(cw.buf)
+	}
+	return isCompressibleType(contentType)
+}
+
+// isCompressibleType reports whether a Content-Type is text-like and benefits from compression
+// Images, archives and other binary formats are already compressed
+func isCompressibleType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+	if strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "+json") ||
+		strings.HasSuffix(mediaType, "+xml") {
+		return true
+	}
+
+	switch mediaType {
+	case "application/json", "application/x-ndjson", "application/javascript",
+		"application/xml", "application/graphql-response+json", "image/svg+xml":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,703 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting of the backend
+// Values come from, in increasing priority: the defaults below, the YAML file
+// given by --config (or CONFIG_FILE), and the environment variable named by each env tag
+// Fields tagged secret are masked in GET /internal/config (see runtime_config.go)
+type Config struct {
+	Server     ServerConfig     `yaml:"server"`
+	Database   DatabaseConfig   `yaml:"database"`
+	Zones      ZonesConfig      `yaml:"zones"`
+	API        APIConfig        `yaml:"api"`
+	Logging    LoggingConfig    `yaml:"logging"`
+	Sentry     SentryConfig     `yaml:"sentry"`
+	GitHub     GitHubConfig     `yaml:"github"`
+	Usage      UsageConfig      `yaml:"usage"`
+	SLO        SLOConfig        `yaml:"slo"`
+	Demo       DemoConfig       `yaml:"demo"`
+	Backup     BackupConfig     `yaml:"backup"`
+	Leader     LeaderConfig     `yaml:"leader_election"`
+	Webhooks   WebhookConfig    `yaml:"webhooks"`
+	Slack      SlackConfig      `yaml:"slack"`
+	Email      EmailConfig      `yaml:"email"`
+	Jobs       JobsConfig       `yaml:"jobs"`
+	Scheduler  SchedulerConfig  `yaml:"scheduler"`
+	Analytics  AnalyticsConfig  `yaml:"analytics"`
+	Contact    ContactConfig    `yaml:"contact"`
+	Newsletter NewsletterConfig `yaml:"newsletter"`
+	Uploads    UploadConfig     `yaml:"uploads"`
+	Retention  RetentionConfig  `yaml:"retention"`
+}
+
+// RetentionConfig covers the history tables without a retention setting of their own (see
+// retention.go); the cleanup-health and cleanup-audit schedules delete what is older
+type RetentionConfig struct {
+	HealthDays int `yaml:"health_days" env:"RETENTION_HEALTH_DAYS" validate:"gte=0"` // deployment_events; 0 keeps everything
+	AuditDays  int `yaml:"audit_days" env:"RETENTION_AUDIT_DAYS" validate:"gte=0"`   // activity_events and zone_route_changes; 0 keeps everything
+}
+
+// SchedulerConfig covers schedules (see schedules.go): the time zone cron expressions are read
+// in, how long a run may take, and how long the run history is kept
+type SchedulerConfig struct {
+	Timezone         string        `yaml:"timezone" env:"SCHEDULER_TIMEZONE" validate:"timezone"` // A cron expression can name its own with CRON_TZ=
+	RunTimeout       time.Duration `yaml:"run_timeout" env:"SCHEDULER_RUN_TIMEOUT" validate:"gt=0"`
+	RunRetentionDays int           `yaml:"run_retention_days" env:"SCHEDULER_RUN_RETENTION_DAYS" validate:"gte=0"` // 0 keeps everything
+}
+
+// JobsConfig covers the job queue (see jobs.go): how often the leader looks for due jobs
+// and how long finished ones are kept; retries are set per kind of job
+type JobsConfig struct {
+	PollInterval  time.Duration `yaml:"poll_interval" env:"JOB_POLL_INTERVAL" validate:"gt=0"`    // Jobs queued on the leader start right away
+	RetentionDays int           `yaml:"retention_days" env:"JOB_RETENTION_DAYS" validate:"gte=0"` // For succeeded jobs; 0 keeps everything
+}
+
+// EmailConfig covers outbound email (see email.go): the provider and its credentials, the
+// sender, how failed sends are retried, and who is told about zone incidents; email is off
+// while the provider is empty
+type EmailConfig struct {
+	Provider        string        `yaml:"provider" env:"EMAIL_PROVIDER" validate:"omitempty,oneof=smtp sendgrid"`
+	From            string        `yaml:"from" env:"EMAIL_FROM" validate:"required_with=Provider"` // e.g. "Backend <noreply@example.com>"
+	SMTPHost        string        `yaml:"smtp_host" env:"EMAIL_SMTP_HOST" validate:"required_if=Provider smtp"`
+	SMTPPort        int           `yaml:"smtp_port" env:"EMAIL_SMTP_PORT" validate:"min=1,max=65535"` // 465 is implicit TLS; other ports use STARTTLS when offered
+	SMTPUsername    string        `yaml:"smtp_username" env:"EMAIL_SMTP_USERNAME"`
+	SMTPPassword    string        `yaml:"smtp_password" env:"EMAIL_SMTP_PASSWORD" secret:"true"`
+	SendGridAPIKey  string        `yaml:"sendgrid_api_key" env:"EMAIL_SENDGRID_API_KEY" validate:"required_if=Provider sendgrid" secret:"true"`
+	SendGridURL     string        `yaml:"sendgrid_url" env:"EMAIL_SENDGRID_URL" validate:"http_url"` // https://api.eu.sendgrid.com for EU data residency
+	Timeout         time.Duration `yaml:"timeout" env:"EMAIL_TIMEOUT" validate:"gt=0"`
+	MaxAttempts     int           `yaml:"max_attempts" env:"EMAIL_MAX_ATTEMPTS" validate:"min=1"`
+	RetryBackoff    time.Duration `yaml:"retry_backoff" env:"EMAIL_RETRY_BACKOFF" validate:"gt=0"`    // Doubles after each retry, up to an hour
+	RetentionDays   int           `yaml:"retention_days" env:"EMAIL_RETENTION_DAYS" validate:"gte=0"` // 0 keeps everything
+	AlertRecipients []string      `yaml:"alert_recipients" env:"EMAIL_ALERT_RECIPIENTS" validate:"dive,email"`
+}
+
+// SlackConfig covers the Slack app (see slack.go): slash commands are verified with the
+// signing secret, and zone incidents are posted to the incoming webhook; each is off when empty
+type SlackConfig struct {
+	SigningSecret string   `yaml:"signing_secret" env:"SLACK_SIGNING_SECRET" secret:"true"`
+	WebhookURL    string   `yaml:"webhook_url" env:"SLACK_WEBHOOK_URL" validate:"omitempty,http_url" secret:"true"`
+	AllowedUsers  []string `yaml:"allowed_users" env:"SLACK_ALLOWED_USERS" validate:"dive,required"` // Slack user IDs; empty allows everyone in the workspace
+}
+
+// WebhookConfig covers outbound webhook deliveries (see webhooks.go): how long a target gets
+// to answer, how failed deliveries are retried, and how long the delivery log is kept
+type WebhookConfig struct {
+	Timeout       time.Duration `yaml:"timeout" env:"WEBHOOK_TIMEOUT" validate:"gt=0"`
+	MaxAttempts   int           `yaml:"max_attempts" env:"WEBHOOK_MAX_ATTEMPTS" validate:"min=1"`     // Then the delivery is failed
+	RetryBackoff  time.Duration `yaml:"retry_backoff" env:"WEBHOOK_RETRY_BACKOFF" validate:"gt=0"`    // Before the first retry; doubles after each, up to an hour
+	RetentionDays int           `yaml:"retention_days" env:"WEBHOOK_RETENTION_DAYS" validate:"gte=0"` // 0 keeps everything
+}
+
+// LeaderConfig covers leader election (see leader.go): the Kubernetes Lease replicas compete
+// for, and how quickly a new leader takes over when the old one stops renewing it
+type LeaderConfig struct {
+	Enabled       bool          `yaml:"enabled" env:"LEADER_ELECTION_ENABLED"` // Off: every replica runs the background tasks
+	LeaseName     string        `yaml:"lease_name" env:"LEADER_ELECTION_LEASE_NAME" validate:"required"`
+	Namespace     string        `yaml:"namespace" env:"LEADER_ELECTION_NAMESPACE"` // Empty: POD_NAMESPACE, then the service account's
+	LeaseDuration time.Duration `yaml:"lease_duration" env:"LEADER_ELECTION_LEASE_DURATION" validate:"gtfield=RenewDeadline"`
+	RenewDeadline time.Duration `yaml:"renew_deadline" env:"LEADER_ELECTION_RENEW_DEADLINE" validate:"gtfield=RetryPeriod"`
+	RetryPeriod   time.Duration `yaml:"retry_period" env:"LEADER_ELECTION_RETRY_PERIOD" validate:"gt=0"`
+}
+
+// BackupConfig covers database backups (see backup.go): where dumps are kept, in a directory
+// or an S3-compatible bucket, and the Postgres tools that make and restore them
+type BackupConfig struct {
+	Enabled     bool          `yaml:"enabled" env:"BACKUP_ENABLED"` // Serve /internal/backups; the CLI works without it
+	Dir         string        `yaml:"dir" env:"BACKUP_DIR"`         // Used when no bucket is set
+	S3Endpoint  string        `yaml:"s3_endpoint" env:"BACKUP_S3_ENDPOINT" validate:"required"`
+	S3Bucket    string        `yaml:"s3_bucket" env:"BACKUP_S3_BUCKET"`
+	S3Prefix    string        `yaml:"s3_prefix" env:"BACKUP_S3_PREFIX"`
+	S3Region    string        `yaml:"s3_region" env:"BACKUP_S3_REGION"`
+	S3AccessKey string        `yaml:"s3_access_key" env:"BACKUP_S3_ACCESS_KEY" secret:"true"`
+	S3SecretKey string        `yaml:"s3_secret_key" env:"BACKUP_S3_SECRET_KEY" secret:"true"`
+	S3Insecure  bool          `yaml:"s3_insecure" env:"BACKUP_S3_INSECURE"` // Plain HTTP, e.g. a MinIO in the cluster
+	PgDump      string        `yaml:"pg_dump" env:"BACKUP_PG_DUMP" validate:"required"`
+	PgRestore   string        `yaml:"pg_restore" env:"BACKUP_PG_RESTORE" validate:"required"`
+	Timeout     time.Duration `yaml:"timeout" env:"BACKUP_TIMEOUT" validate:"gt=0"`
+}
+
+// DemoConfig covers demo mode (see demo.go); --demo turns it on too
+type DemoConfig struct {
+	Enabled       bool          `yaml:"enabled" env:"DEMO_MODE"`
+	ResetInterval time.Duration `yaml:"reset_interval" env:"DEMO_RESET_INTERVAL" validate:"gt=0"`
+	Users         int           `yaml:"users" env:"DEMO_USERS" validate:"min=0,max=100000"`
+	Flags         int           `yaml:"flags" env:"DEMO_FLAGS" validate:"min=0,max=10000"`
+}
+
+// ServerConfig covers the listeners, HTTP timeouts, and shutdown (see listener.go, timeouts.go, shutdown.go)
+type ServerConfig struct {
+	Port             int    `yaml:"port" env:"PORT" validate:"min=1,max=65535"`
+	Listen           string `yaml:"listen" env:"LISTEN"` // "unix:/path" or a TCP address; empty listens on Port
+	ListenSocketMode string `yaml:"listen_socket_mode" env:"LISTEN_SOCKET_MODE" validate:"octal"`
+	// Path prefix for every public route and generated link (e.g. "/backend"), for mounting the
+	// backend under a path on a shared ingress; the internal listener ignores it
+	BasePath string `yaml:"base_path" env:"BASE_PATH" validate:"basepath"`
+	// Operational endpoints (/metrics, /internal/*, /debug/pprof) listen on a port the
+	// Service doesn't expose, so only Prometheus and other pods can reach them; empty disables it
+	InternalAddr string `yaml:"internal_addr" env:"INTERNAL_ADDR" validate:"omitempty,hostname_port|startswith=:"`
+	// Off by default: a CPU or trace profile keeps a request open (and costs CPU) for its whole duration
+	PprofEnabled bool `yaml:"pprof_enabled" env:"PPROF_ENABLED"`
+	// Off by default: /internal/faults makes this replica slow, fail, or report zones down on purpose (see chaos.go)
+	ChaosEnabled     bool          `yaml:"chaos_enabled" env:"CHAOS_ENABLED"`
+	ChaosMaxDuration time.Duration `yaml:"chaos_max_duration" env:"CHAOS_MAX_DURATION" validate:"gt=0"` // Longest a fault may last
+
+	// Timeouts stop slow or idle clients from holding connections (and goroutines) forever
+
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT" validate:"gt=0"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"HTTP_READ_TIMEOUT" validate:"gt=0"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT" validate:"gt=0"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT" validate:"gt=0"`
+	// Bounds a request's database queries; shorter than WriteTimeout so a hung query
+	// turns into a clean error response
+	RequestTimeout time.Duration `yaml:"request_timeout" env:"REQUEST_TIMEOUT" validate:"gt=0,ltfield=WriteTimeout"`
+
+	// After SIGTERM, keep serving (with /readyz failing) for ShutdownDelay, then give in-flight
+	// requests ShutdownTimeout; together they must stay below terminationGracePeriodSeconds
+	ShutdownDelay   time.Duration `yaml:"shutdown_delay" env:"SHUTDOWN_DELAY" validate:"gte=0"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" validate:"gt=0"`
+
+	// Smaller responses are sent uncompressed; the overhead outweighs the savings
+	CompressionMinSize int  `yaml:"compression_min_size" env:"COMPRESSION_MIN_SIZE" validate:"gte=0"`
+	CompressionBrotli  bool `yaml:"compression_brotli" env:"COMPRESSION_BROTLI"`
+
+	// Origins allowed to call the API from a browser; "*" allows any
+	CORSAllowedOrigins []string `yaml:"cors_allowed_origins" env:"CORS_ALLOWED_ORIGINS" validate:"min=1,dive,required"`
+
+	// Addresses or CIDR ranges of the proxies in front of the server (ingress, load balancer)
+	// whose X-Forwarded-For is believed when limiting per client (see clientIP); empty trusts none
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES" validate:"dive,cidr|ip"`
+
+	// How often the --config file is checked for changes (see reload.go); 0 leaves reloads to SIGHUP
+	ConfigReloadInterval time.Duration `yaml:"config_reload_interval" env:"CONFIG_RELOAD_INTERVAL" validate:"gte=0"`
+}
+
+// DatabaseConfig covers the database connection, pool, and migrations
+// The server settings (host, credentials, replicas) apply to Postgres and MySQL and are ignored when DB_DRIVER=sqlite
+type DatabaseConfig struct {
+	Driver     string `yaml:"driver" env:"DB_DRIVER" validate:"oneof=postgres sqlite mysql"`
+	SQLitePath string `yaml:"sqlite_path" env:"DB_SQLITE_PATH" validate:"required"` // ":memory:" for a throwaway database
+
+	Host         string   `yaml:"host" env:"DB_HOST" validate:"required"`
+	Port         int      `yaml:"port" env:"DB_PORT" validate:"min=1,max=65535"` // 3306 for MySQL
+	User         string   `yaml:"user" env:"DB_USER" validate:"required"`
+	Password     string   `yaml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name         string   `yaml:"name" env:"DB_NAME" validate:"required"`
+	ReplicaHosts []string `yaml:"replica_hosts" env:"DB_REPLICA_HOSTS" validate:"dive,required"`
+	AutoMigrate  bool     `yaml:"auto_migrate" env:"DB_AUTO_MIGRATE"`
+
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS" validate:"min=1"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" validate:"gte=0"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" validate:"gte=0"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME" validate:"gte=0"`
+	ConnectAttempts int           `yaml:"connect_attempts" env:"DB_CONNECT_ATTEMPTS" validate:"min=1"`
+	ConnectBackoff  time.Duration `yaml:"connect_backoff" env:"DB_CONNECT_BACKOFF" validate:"gt=0"`
+
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold" env:"DB_SLOW_QUERY_THRESHOLD" validate:"gte=0"` // 0 disables slow query logs
+	// Rows per multi-row INSERT; Postgres caps a statement at 65535 parameters
+	BatchSize int `yaml:"batch_size" env:"DB_BATCH_SIZE" validate:"min=1,max=5000"`
+	// Directory of seed files that POST /api/seed?file= may load; empty disables ?file=
+	SeedDir string `yaml:"seed_dir" env:"SEED_DIR"`
+	// POST /api/seed/generate is served only when enabled, and makes at most
+	// SEED_GENERATE_MAX records of each kind per request
+	SeedGenerateEnabled bool `yaml:"seed_generate_enabled" env:"SEED_GENERATE_ENABLED"`
+	SeedGenerateMax     int  `yaml:"seed_generate_max" env:"SEED_GENERATE_MAX" validate:"min=1"`
+}
+
+// ZonesConfig covers the zones the backend checks and proxies to
+type ZonesConfig struct {
+	// Internal Kubernetes service URLs (pod-to-pod communication)
+	MainURL  string `yaml:"main_url" env:"ZONE_MAIN_URL" validate:"required,http_url"`
+	AdminURL string `yaml:"admin_url" env:"ZONE_ADMIN_URL" validate:"required,http_url"`
+
+	HealthCheckTimeout time.Duration `yaml:"health_check_timeout" env:"HEALTH_CHECK_TIMEOUT" validate:"gt=0"`
+	StatusMaxAge       time.Duration `yaml:"status_max_age" env:"ZONE_STATUS_MAX_AGE" validate:"gte=0"` // Older snapshots are refreshed in the background
+	GatewayMode        bool          `yaml:"gateway_mode" env:"GATEWAY_MODE"`
+	ProxyToken         string        `yaml:"proxy_token" env:"ZONE_PROXY_TOKEN" secret:"true"` // Sent to zones so they can trust proxied requests
+	// The merged /sitemap.xml is built again this often, fetching every zone's sitemap within SitemapTimeout (see sitemap.go)
+	SitemapCacheTTL time.Duration `yaml:"sitemap_cache_ttl" env:"SITEMAP_CACHE_TTL" validate:"gt=0"`
+	SitemapTimeout  time.Duration `yaml:"sitemap_timeout" env:"SITEMAP_TIMEOUT" validate:"gt=0"`
+}
+
+// APIConfig covers list sizes and the flag caches
+type APIConfig struct {
+	DefaultPageSize int `yaml:"default_page_size" env:"LIST_DEFAULT_PAGE_SIZE" validate:"min=1,ltefield=MaxPageSize"`
+	MaxPageSize     int `yaml:"max_page_size" env:"LIST_MAX_PAGE_SIZE" validate:"min=1"` // Caps every list response, whatever the client asks for
+	FlagCacheSize   int `yaml:"flag_cache_size" env:"FLAG_CACHE_SIZE" validate:"min=1"`
+	// The bootstrap snapshot is rebuilt this often even without local changes,
+	// which is how flags changed through another pod reach this one
+	FlagSnapshotRefresh time.Duration `yaml:"flag_snapshot_refresh" env:"FLAG_SNAPSHOT_REFRESH" validate:"gt=0"`
+	// Per-client limit on /api requests, keyed by clientIP; 0 disables it (see middleware.go)
+	RateLimitRPS   float64 `yaml:"rate_limit_rps" env:"RATE_LIMIT_RPS" validate:"min=0"`
+	RateLimitBurst int     `yaml:"rate_limit_burst" env:"RATE_LIMIT_BURST" validate:"min=1"`
+	// When set, API requests that change data must send "Authorization: Bearer <token>"
+	Token string `yaml:"token" env:"API_TOKEN" secret:"true"`
+}
+
+// LoggingConfig covers the log level and access log (see log_level.go, access_log.go)
+type LoggingConfig struct {
+	Level                string `yaml:"level" env:"LOG_LEVEL" validate:"oneof=debug info warn"`
+	AccessLogFormat      string `yaml:"access_log_format" env:"ACCESS_LOG_FORMAT" validate:"oneof=common json template off"`
+	AccessLogTemplate    string `yaml:"access_log_template" env:"ACCESS_LOG_TEMPLATE" validate:"required_if=AccessLogFormat template"` // Fields of accessLogEntry
+	AccessLogRedact      string `yaml:"access_log_redact_params" env:"ACCESS_LOG_REDACT_PARAMS"`                                       // Comma-separated; "*" redacts every parameter
+	AccessLogSampleRates string `yaml:"access_log_sample" env:"ACCESS_LOG_SAMPLE"`                                                     // e.g. "/health=0.01,GET /api/bootstrap=0.1"
+}
+
+// SentryConfig covers error reporting (see sentry.go); an empty DSN disables it
+type SentryConfig struct {
+	DSN         string `yaml:"dsn" env:"SENTRY_DSN" validate:"omitempty,url" secret:"true"`
+	Environment string `yaml:"environment" env:"SENTRY_ENVIRONMENT"`
+	Release     string `yaml:"release" env:"SENTRY_RELEASE"`
+}
+
+// GitHubConfig covers the incoming webhook; every delivery is signed with the
+// secret, and an empty secret disables the webhook
+type GitHubConfig struct {
+	WebhookSecret string `yaml:"webhook_secret" env:"GITHUB_WEBHOOK_SECRET" secret:"true"`
+}
+
+// UsageConfig covers the api_usage table (see usage.go)
+type UsageConfig struct {
+	FlushInterval time.Duration `yaml:"flush_interval" env:"USAGE_FLUSH_INTERVAL" validate:"gt=0"`
+	RetentionDays int           `yaml:"retention_days" env:"USAGE_RETENTION_DAYS" validate:"gte=0"` // 0 keeps everything
+}
+
+// AnalyticsConfig covers POST /api/events and its daily rollups (see analytics.go)
+type AnalyticsConfig struct {
+	SampleRate    float64       `yaml:"sample_rate" env:"ANALYTICS_SAMPLE_RATE" validate:"gt=0,lte=1"` // Share of visitors whose events are kept
+	MaxBatchSize  int           `yaml:"max_batch_size" env:"ANALYTICS_MAX_BATCH_SIZE" validate:"min=1"`
+	MaxBodyBytes  int           `yaml:"max_body_bytes" env:"ANALYTICS_MAX_BODY_BYTES" validate:"min=1024"`
+	FlushInterval time.Duration `yaml:"flush_interval" env:"ANALYTICS_FLUSH_INTERVAL" validate:"gt=0"`
+	RetentionDays int           `yaml:"retention_days" env:"ANALYTICS_RETENTION_DAYS" validate:"gte=0"` // Daily rollups; 0 keeps everything
+	// Raw visitor hashes, only needed to count each visitor once on their day; 0 keeps everything
+	VisitorRetentionDays int `yaml:"visitor_retention_days" env:"ANALYTICS_VISITOR_RETENTION_DAYS" validate:"gte=0"`
+	// How long a session counts as active after its last heartbeat (see presence.go)
+	ActiveWindow      time.Duration `yaml:"active_window" env:"ANALYTICS_ACTIVE_WINDOW" validate:"gt=0"`
+	MaxActiveSessions int           `yaml:"max_active_sessions" env:"ANALYTICS_MAX_ACTIVE_SESSIONS" validate:"min=1"` // Sessions held in memory across zones
+}
+
+// ContactConfig covers POST /api/contact (see contact.go): how often a client may send the form,
+// what marks a message as spam, the optional CAPTCHA check, and who is emailed about new messages
+type ContactConfig struct {
+	RateLimit        int           `yaml:"rate_limit" env:"CONTACT_RATE_LIMIT" validate:"gte=0"`                              // Messages per client an hour; 0 disables the limit
+	MaxLinks         int           `yaml:"max_links" env:"CONTACT_MAX_LINKS" validate:"gte=0"`                                // Messages with more links are marked spam
+	CaptchaVerifyURL string        `yaml:"captcha_verify_url" env:"CONTACT_CAPTCHA_VERIFY_URL" validate:"omitempty,http_url"` // A siteverify endpoint (Turnstile, hCaptcha, reCAPTCHA); empty disables the check
+	CaptchaSecret    string        `yaml:"captcha_secret" env:"CONTACT_CAPTCHA_SECRET" validate:"required_with=CaptchaVerifyURL" secret:"true"`
+	CaptchaTimeout   time.Duration `yaml:"captcha_timeout" env:"CONTACT_CAPTCHA_TIMEOUT" validate:"gt=0"`
+	NotifyRecipients []string      `yaml:"notify_recipients" env:"CONTACT_NOTIFY_RECIPIENTS" validate:"dive,email"` // Emailed about every message that isn't spam, when EMAIL_PROVIDER is set
+}
+
+// NewsletterConfig covers the newsletter signup (see newsletter.go): the zone-main pages the
+// confirmation and unsubscribe links open, how long a confirmation link works, and how often a
+// client may sign up; the endpoints are off while ConfirmURL is empty
+type NewsletterConfig struct {
+	ConfirmURL     string        `yaml:"confirm_url" env:"NEWSLETTER_CONFIRM_URL" validate:"omitempty,http_url"` // Opened with ?token=, which the page posts to /api/newsletter/confirm
+	UnsubscribeURL string        `yaml:"unsubscribe_url" env:"NEWSLETTER_UNSUBSCRIBE_URL" validate:"required_with=ConfirmURL,omitempty,http_url"`
+	TokenTTL       time.Duration `yaml:"token_ttl" env:"NEWSLETTER_TOKEN_TTL" validate:"gt=0"`
+	RateLimit      int           `yaml:"rate_limit" env:"NEWSLETTER_RATE_LIMIT" validate:"gte=0"` // Signups per client an hour; 0 disables the limit
+}
+
+// UploadConfig covers file uploads (see uploads.go): the S3-compatible bucket the zones upload
+// to with presigned URLs, how long those URLs work, which types may be uploaded at what size, and
+// the avatar variants made of images; uploads are off while the bucket is empty
+type UploadConfig struct {
+	S3Endpoint       string        `yaml:"s3_endpoint" env:"UPLOAD_S3_ENDPOINT" validate:"required"`
+	S3PublicEndpoint string        `yaml:"s3_public_endpoint" env:"UPLOAD_S3_PUBLIC_ENDPOINT"` // The host browsers reach the bucket at, when it isn't S3Endpoint
+	S3Bucket         string        `yaml:"s3_bucket" env:"UPLOAD_S3_BUCKET"`
+	S3Prefix         string        `yaml:"s3_prefix" env:"UPLOAD_S3_PREFIX"`
+	S3Region         string        `yaml:"s3_region" env:"UPLOAD_S3_REGION" validate:"required"` // Presigning needs it up front
+	S3AccessKey      string        `yaml:"s3_access_key" env:"UPLOAD_S3_ACCESS_KEY" secret:"true"`
+	S3SecretKey      string        `yaml:"s3_secret_key" env:"UPLOAD_S3_SECRET_KEY" secret:"true"`
+	S3Insecure       bool          `yaml:"s3_insecure" env:"UPLOAD_S3_INSECURE"` // Plain HTTP, e.g. a MinIO in the cluster
+	URLExpiry        time.Duration `yaml:"url_expiry" env:"UPLOAD_URL_EXPIRY" validate:"gte=1s,lte=168h"`
+	// The types that may be uploaded, each with its largest size, e.g. "image/*=10MB"
+	TypeLimits []string `yaml:"type_limits" env:"UPLOAD_TYPE_LIMITS" validate:"min=1,dive,uploadlimit"`
+	// Avatars (see images.go) get square-bounded variants of these sizes, in pixels
+	ThumbSize      int `yaml:"thumb_size" env:"UPLOAD_THUMB_SIZE" validate:"gte=16,lte=4096"`
+	MediumSize     int `yaml:"medium_size" env:"UPLOAD_MEDIUM_SIZE" validate:"gte=16,lte=4096"`
+	ImageMaxPixels int `yaml:"image_max_pixels" env:"UPLOAD_IMAGE_MAX_PIXELS" validate:"gte=1"` // Larger images aren't decoded
+}
+
+// SLOConfig covers the backend's own objectives (see slo.go)
+type SLOConfig struct {
+	WindowDays         int           `yaml:"window_days" env:"SLO_WINDOW_DAYS" validate:"min=1"`
+	AvailabilityTarget float64       `yaml:"availability_target" env:"SLO_AVAILABILITY_TARGET" validate:"gt=0,lt=1"` // A target of 1 leaves no error budget
+	LatencyThreshold   time.Duration `yaml:"latency_threshold" env:"SLO_LATENCY_THRESHOLD" validate:"gt=0"`
+	LatencyTarget      float64       `yaml:"latency_target" env:"SLO_LATENCY_TARGET" validate:"gt=0,lt=1"`
+}
+
+// defaultConfig is what the backend runs with when nothing is configured
+func defaultConfig() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:                 8080,
+			ListenSocketMode:     "0660", // Sidecars need read/write
+			InternalAddr:         ":9090",
+			ChaosMaxDuration:     time.Hour,
+			ReadHeaderTimeout:    5 * time.Second,
+			ReadTimeout:          15 * time.Second,
+			WriteTimeout:         30 * time.Second,
+			IdleTimeout:          120 * time.Second,
+			RequestTimeout:       10 * time.Second,
+			ShutdownDelay:        5 * time.Second,
+			ShutdownTimeout:      20 * time.Second,
+			CompressionMinSize:   1024,
+			CompressionBrotli:    true,
+			CORSAllowedOrigins:   []string{"*"},
+			ConfigReloadInterval: 10 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Driver:             "postgres",
+			SQLitePath:         "backend.db",
+			Host:               "postgres",
+			Port:               5432,
+			User:               "admin",
+			Password:           "devpassword",
+			Name:               "multizone",
+			AutoMigrate:        true,
+			MaxOpenConns:       10,
+			MaxIdleConns:       5,
+			ConnMaxLifetime:    30 * time.Minute,
+			ConnMaxIdleTime:    5 * time.Minute,
+			ConnectAttempts:    10,
+			ConnectBackoff:     500 * time.Millisecond,
+			SlowQueryThreshold: 200 * time.Millisecond,
+			BatchSize:          100,
+			SeedGenerateMax:    100000,
+		},
+		Zones: ZonesConfig{
+			MainURL:            "http://zone-main",
+			AdminURL:           "http://zone-admin/admin",
+			HealthCheckTimeout: 5 * time.Second,
+			StatusMaxAge:       10 * time.Second,
+			SitemapCacheTTL:    time.Hour,
+			SitemapTimeout:     10 * time.Second,
+		},
+		API: APIConfig{
+			DefaultPageSize:     50,
+			MaxPageSize:         200,
+			FlagCacheSize:       10000,
+			FlagSnapshotRefresh: 30 * time.Second,
+			RateLimitBurst:      20,
+		},
+		Logging: LoggingConfig{
+			Level:             "info",
+			AccessLogFormat:   "common",
+			AccessLogTemplate: `{{.RemoteAddr}} {{.Method}} {{.URI}} {{.Status}} {{.Bytes}} {{.Duration}} {{.RequestID}}`,
+			AccessLogRedact:   "token,secret,password,signature",
+		},
+		Sentry: SentryConfig{
+			Environment: "development",
+			Release:     buildRevision(),
+		},
+		Usage: UsageConfig{
+			FlushInterval: time.Minute,
+			RetentionDays: 90,
+		},
+		SLO: SLOConfig{
+			WindowDays:         30,
+			AvailabilityTarget: 0.999,
+			LatencyThreshold:   500 * time.Millisecond,
+			LatencyTarget:      0.99,
+		},
+		Backup: BackupConfig{
+			S3Endpoint: "s3.amazonaws.com",
+			S3Prefix:   "backups/",
+			PgDump:     "pg_dump",
+			PgRestore:  "pg_restore",
+			Timeout:    time.Hour,
+		},
+		Leader: LeaderConfig{
+			LeaseName:     "backend-leader",
+			LeaseDuration: 15 * time.Second,
+			RenewDeadline: 10 * time.Second,
+			RetryPeriod:   2 * time.Second,
+		},
+		Webhooks: WebhookConfig{
+			Timeout:       10 * time.Second,
+			MaxAttempts:   8,
+			RetryBackoff:  30 * time.Second,
+			RetentionDays: 30,
+		},
+		Email: EmailConfig{
+			SMTPPort:      587,
+			SendGridURL:   "https://api.sendgrid.com",
+			Timeout:       30 * time.Second,
+			MaxAttempts:   5,
+			RetryBackoff:  time.Minute,
+			RetentionDays: 30,
+		},
+		Jobs: JobsConfig{
+			PollInterval:  5 * time.Second,
+			RetentionDays: 7,
+		},
+		Scheduler: SchedulerConfig{
+			Timezone:         "UTC",
+			RunTimeout:       10 * time.Minute,
+			RunRetentionDays: 30,
+		},
+		Analytics: AnalyticsConfig{
+			SampleRate:           1,
+			MaxBatchSize:         100,
+			MaxBodyBytes:         64 << 10,
+			FlushInterval:        time.Minute,
+			RetentionDays:        400,
+			VisitorRetentionDays: 30,
+			ActiveWindow:         2 * time.Minute,
+			MaxActiveSessions:    100000,
+		},
+		Uploads: UploadConfig{
+			S3Endpoint:     "s3.amazonaws.com",
+			S3Prefix:       "uploads/",
+			S3Region:       "us-east-1",
+			URLExpiry:      15 * time.Minute,
+			TypeLimits:     []string{"image/*=10MB", "application/pdf=25MB", "text/plain=1MB"},
+			ThumbSize:      128,
+			MediumSize:     512,
+			ImageMaxPixels: 40_000_000,
+		},
+		Retention: RetentionConfig{
+			HealthDays: 90,
+			AuditDays:  365,
+		},
+		Contact: ContactConfig{
+			RateLimit:      5,
+			MaxLinks:       3,
+			CaptchaTimeout: 5 * time.Second,
+		},
+		Newsletter: NewsletterConfig{
+			TokenTTL:  48 * time.Hour,
+			RateLimit: 5,
+		},
+		Demo: DemoConfig{
+			ResetInterval: time.Hour,
+			Users:         250,
+			Flags:         24,
+		},
+	}
+}
+
+// configKey is the context key under which the serving Server's configuration is stored
+type configKey struct{}
+
+// withConfig makes cfg available to the request helpers that aren't Server methods
+// (paging, links, streaming write deadlines); Server.handler installs it
+func withConfig(cfg *Config) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), configKey{}, cfg)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// baseConfig is what requestConfig returns outside a Server's handler chain; it is never modified
+var baseConfig = defaultConfig()
+
+// requestConfig returns the configuration of the Server handling r (the defaults if none is)
+func requestConfig(r *http.Request) *Config {
+	if cfg, ok := r.Context().Value(configKey{}).(*Config); ok {
+		return cfg
+	}
+	return &baseConfig
+}
+
+// loadConfig builds the configuration from the defaults, the YAML file at path
+// (skipped when path is empty), and the environment, then validates it
+// Every problem is reported at once, so a bad deploy fails with the full list
+func loadConfig(path string) (Config, error) {
+	cfg := defaultConfig()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to read config file: %w", err)
+		}
+		// Unknown keys are most likely typos, which would otherwise be ignored silently
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return cfg, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+
+	problems := applyEnvOverrides(reflect.ValueOf(&cfg).Elem())
+	for _, fe := range validateConfig(cfg) {
+		problems = append(problems, fe.Field+": "+fe.Message)
+	}
+	if len(problems) > 0 {
+		return cfg, fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return cfg, nil
+}
+
+// durationType is special-cased because time.Duration is an int64 underneath
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyEnvOverrides sets every field with an env tag whose variable is set (and not empty)
+// It returns one problem per variable that doesn't parse as its field's type
+func applyEnvOverrides(v reflect.Value) []string {
+	var problems []string
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			problems = append(problems, applyEnvOverrides(value)...)
+			continue
+		}
+
+		name := field.Tag.Get("env")
+		raw := os.Getenv(name)
+		if name == "" || raw == "" {
+			continue
+		}
+
+		var err error
+		switch {
+		case field.Type == durationType:
+			var d time.Duration
+			if d, err = time.ParseDuration(raw); err == nil {
+				value.SetInt(int64(d))
+			}
+		case field.Type.Kind() == reflect.String:
+			value.SetString(raw)
+		case field.Type.Kind() == reflect.Int:
+			var n int
+			if n, err = strconv.Atoi(raw); err == nil {
+				value.SetInt(int64(n))
+			}
+		case field.Type.Kind() == reflect.Float64:
+			var f float64
+			if f, err = strconv.ParseFloat(raw, 64); err == nil {
+				value.SetFloat(f)
+			}
+		case field.Type.Kind() == reflect.Bool:
+			var b bool
+			if b, err = strconv.ParseBool(raw); err == nil {
+				value.SetBool(b)
+			}
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.String:
+			// Comma-separated, e.g. DB_REPLICA_HOSTS=replica-1,replica-2
+			var items []string
+			for _, item := range strings.Split(raw, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			value.Set(reflect.ValueOf(items))
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s=%q: not a valid %s", name, raw, field.Type))
+		}
+	}
+	return problems
+}
+
+// configValidate checks Config against its validate tags, reporting YAML key paths
+var configValidate = newConfigValidator()
+
+// newConfigValidator creates a validator that names fields by their YAML keys
+func newConfigValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		return name
+	})
+
+	// octal: a Unix permission mode such as "0660"
+	v.RegisterValidation("octal", func(fl validator.FieldLevel) bool {
+		_, err := strconv.ParseUint(fl.Field().String(), 8, 32)
+		return err == nil
+	})
+	// Empty, or a path like "/backend": it is put in front of route patterns, so no trailing
+	// slash, wildcards, or spaces
+	v.RegisterValidation("basepath", func(fl validator.FieldLevel) bool {
+		path := fl.Field().String()
+		return path == "" || (strings.HasPrefix(path, "/") && !strings.HasSuffix(path, "/") && !strings.ContainsAny(path, "{} \t?#"))
+	})
+	// uploadlimit: "<media type>=<size>", e.g. "image/*=10MB" (see parseUploadLimit)
+	v.RegisterValidation("uploadlimit", func(fl validator.FieldLevel) bool {
+		_, err := parseUploadLimit(fl.Field().String())
+		return err == nil
+	})
+	return v
+}
+
+// validateConfig runs the config validator; field paths look like "server.port"
+func validateConfig(cfg Config) []models.FieldError {
+	var fieldErrors []models.FieldError
+	// The tags can't compare settings in different sections
+	if cfg.Zones.GatewayMode && cfg.API.Token == "" {
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "zones.gateway_mode", Message: "needs api.token, which every proxied request must send"})
+	}
+
+	err := configValidate.Struct(cfg)
+	if err == nil {
+		return fieldErrors
+	}
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return append(fieldErrors, models.FieldError{Field: "", Message: err.Error()})
+	}
+	for _, fe := range validationErrors {
+		_, field, _ := strings.Cut(fe.Namespace(), ".")
+		fieldErrors = append(fieldErrors, models.FieldError{Field: field, Message: configMessage(fe)})
+	}
+	return fieldErrors
+}
+
+// configConditions describe the required_if and required_with conditions in configMessage
+var configConditions = map[string]string{
+	"AccessLogFormat template": "access_log_format is template",
+	"Provider":                 "provider is set",
+	"Provider smtp":            "provider is smtp",
+	"Provider sendgrid":        "provider is sendgrid",
+	"CaptchaVerifyURL":         "captcha_verify_url is set",
+}
+
+// configMessage explains a failed rule; unlike request bodies, most settings are numbers
+func configMessage(fe validator.FieldError) string {
+	comparisons := map[string]string{"min": "at least", "max": "at most", "gt": "greater than", "gte": "at least", "lt": "less than"}
+	switch tag := fe.Tag(); {
+	case comparisons[tag] != "" && fe.Kind() != reflect.String:
+		return fmt.Sprintf("must be %s %s", comparisons[tag], fe.Param())
+	case tag == "http_url":
+		return "must be an http:// or https:// URL"
+	case tag == "url":
+		return "must be a URL"
+	case tag == "octal":
+		return "must be an octal permission mode, e.g. 0660"
+	case tag == "uploadlimit":
+		return `must be "<media type>=<size>", e.g. image/*=10MB`
+	case tag == "basepath":
+		return `must start with "/" and not end with it, e.g. /backend`
+	case tag == "hostname_port|startswith=:":
+		return `must be "host:port" or ":port"`
+	case tag == "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case tag == "timezone":
+		return "must be a time zone name, e.g. Europe/Berlin"
+	case tag == "ltefield":
+		return "must not be greater than max_page_size"
+	case tag == "ltfield":
+		return "must be shorter than write_timeout"
+	case tag == "required_if", tag == "required_with":
+		return "is required when " + configConditions[fe.Param()]
+	}
+	return validationMessage(fe)
+}
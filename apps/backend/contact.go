@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/cache"
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"golang.org/x/time/rate"
+)
+
+// zone-main's contact page posts to POST /api/contact instead of a third-party form service.
+// Every message is stored in contact_submissions for triage: ones that look like spam (the
+// honeypot field is filled in, or there are more than CONTACT_MAX_LINKS links) are kept with
+// the status "spam" but answered like any other, so bots can't tell, and the rest are emailed
+// to CONTACT_NOTIFY_RECIPIENTS. Each client may send CONTACT_RATE_LIMIT messages an hour, and
+// with CONTACT_CAPTCHA_VERIFY_URL set every message needs a CAPTCHA token the provider accepts
+
+// contactLinkPattern finds the links counted against CONTACT_MAX_LINKS
+var contactLinkPattern = regexp.MustCompile(`(?i)https?://|www\.`)
+
+// contactSubmissionFilterFields are the submission fields ?filter= and ?orderby= accept
+var contactSubmissionFilterFields = filterFields{
+	"id":        {Column: "id", Kind: filterNumber},
+	"status":    {Column: "status", Kind: filterString},
+	"email":     {Column: "email", Kind: filterString},
+	"zone":      {Column: "zone", Kind: filterString},
+	"createdAt": {Column: "created_at", Kind: filterTime},
+}
+
+// newContactRateLimiter allows each client CONTACT_RATE_LIMIT messages an hour, all at once or
+// spread out, or returns nil when it is 0
+func newContactRateLimiter(cfg ContactConfig) *rateLimiter {
+	if cfg.RateLimit <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		clients: cache.NewLRU[string, *rate.Limiter](rateLimitClients),
+		limit:   rate.Every(time.Hour / time.Duration(cfg.RateLimit)),
+		burst:   cfg.RateLimit,
+	}
+}
+
+// contactSpamReason returns why a message looks like spam, or "" if it doesn't
+// More than maxLinks (CONTACT_MAX_LINKS) links in the subject and message count as spam
+func contactSpamReason(req models.ContactRequest, maxLinks int) string {
+	switch {
+	case req.Website != "":
+		return "honeypot"
+	case len(contactLinkPattern.FindAllStringIndex(req.Subject+" "+req.Message, -1)) > maxLinks:
+		return "links"
+	}
+	return ""
+}
+
+// captchaVerifier checks CAPTCHA tokens with the provider's siteverify endpoint, which
+// Turnstile, hCaptcha, and reCAPTCHA all implement the same way
+// A nil verifier accepts everything, which is what an empty CONTACT_CAPTCHA_VERIFY_URL gives
+type captchaVerifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// newCaptchaVerifier returns a verifier for CONTACT_CAPTCHA_VERIFY_URL, or nil when it is empty
+func newCaptchaVerifier(cfg ContactConfig) *captchaVerifier {
+	if cfg.CaptchaVerifyURL == "" {
+		return nil
+	}
+	return &captchaVerifier{
+		url:    cfg.CaptchaVerifyURL,
+		secret: cfg.CaptchaSecret,
+		client: &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport), Timeout: cfg.CaptchaTimeout},
+	}
+}
+
+// verify reports whether the provider accepts token from the client at remoteIP
+// An error means the provider couldn't be asked, not that the token is bad
+func (v *captchaVerifier) verify(ctx context.Context, token, remoteIP string) (bool, error) {
+	if v == nil {
+		return true, nil
+	}
+	if token == "" {
+		return false, nil
+	}
+	form := url.Values{"secret": {v.secret}, "response": {token}, "remoteip": {remoteIP}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("CAPTCHA provider responded %s", resp.Status)
+	}
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&result); err != nil {
+		return false, fmt.Errorf("invalid CAPTCHA provider response: %w", err)
+	}
+	return result.Success, nil
+}
+
+// notifyContact emails CONTACT_NOTIFY_RECIPIENTS about a new message
+func (s *Server) notifyContact(ctx context.Context, submission models.ContactSubmission) {
+	if s.mailer == nil {
+		return
+	}
+	data := map[string]string{
+		"name":    submission.Name,
+		"email":   submission.Email,
+		"subject": submission.Subject,
+		"message": submission.Message,
+		"zone":    submission.Zone,
+		"id":      strconv.FormatUint(uint64(submission.ID), 10),
+	}
+	for _, to := range s.config.Contact.NotifyRecipients {
+		if _, err := s.mailer.enqueue(ctx, "contact", to, data); err != nil {
+			log.Printf("Failed to queue contact notification for %s: %v", to, err)
+		}
+	}
+}
+
+// submitContactHandler responds to POST /api/contact
+// 202 for every stored message, spam included; 429 past CONTACT_RATE_LIMIT, 400 when the
+// CAPTCHA token is missing or refused, and 502 when the CAPTCHA provider can't be reached
+func (s *Server) submitContactHandler(w http.ResponseWriter, r *http.Request) {
+	if s.contactLimit != nil && !s.contactLimit.allow(s.clientIP(r)) {
+		w.Header().Set("Retry-After", strconv.Itoa(int((time.Hour / time.Duration(s.config.Contact.RateLimit)).Seconds())))
+		writeError(w, r, http.StatusTooManyRequests, "Too many messages; try again later")
+		return
+	}
+	var req models.ContactRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	if _, ok := s.findZone(req.Zone); req.Zone != "" && !ok {
+		writeValidationErrors(w, r, []models.FieldError{{Field: "zone", Message: "must be a zone (" + s.zoneNames() + ")"}})
+		return
+	}
+	valid, err := s.captcha.verify(r.Context(), req.CaptchaToken, s.clientIP(r))
+	switch {
+	case err != nil:
+		writeError(w, r, http.StatusBadGateway, fmt.Sprintf("Failed to check the CAPTCHA: %v", err))
+		return
+	case !valid:
+		writeError(w, r, http.StatusBadRequest, "CAPTCHA check failed")
+		return
+	}
+
+	submission := models.ContactSubmission{
+		Name: req.Name, Email: strings.ToLower(req.Email), Subject: req.Subject, Message: req.Message, Zone: req.Zone,
+		Status: "new", SpamReason: contactSpamReason(req, s.config.Contact.MaxLinks),
+	}
+	if submission.SpamReason != "" {
+		submission.Status = "spam"
+	}
+	if err := s.db.WithContext(r.Context()).Create(&submission).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to save message: %v", err))
+		return
+	}
+	if submission.Status == "spam" {
+		log.Printf("Contact submission %d marked spam (%s)", submission.ID, submission.SpamReason)
+	} else {
+		s.notifyContact(r.Context(), submission)
+	}
+	writeJSON(w, r, http.StatusAccepted, models.MessageResponse{Message: "Thanks, your message was received"})
+}
+
+// listContactSubmissionsHandler responds to GET /api/contact/submissions
+// Newest first, narrowed with the shared ?filter= and ?orderby= parameters, e.g. ?filter=status eq "new"
+func (s *Server) listContactSubmissionsHandler(w http.ResponseWriter, r *http.Request) {
+	listQuery, err := parseListQuery(r, contactSubmissionFilterFields)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid query: "+err.Error())
+		return
+	}
+	var submissions []models.ContactSubmission
+	if err := listQuery.apply(s.db.WithContext(r.Context()).Model(&models.ContactSubmission{}), "id DESC").Find(&submissions).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	setNextPageLink(w, r, listQuery.page, len(submissions))
+	writeJSON(w, r, http.StatusOK, submissions)
+}
+
+// getContactSubmissionHandler responds to GET /api/contact/submissions/{id}
+func (s *Server) getContactSubmissionHandler(w http.ResponseWriter, r *http.Request) {
+	if submission, ok := findByID[models.ContactSubmission](w, r, s.db, "Contact submission"); ok {
+		writeJSON(w, r, http.StatusOK, submission)
+	}
+}
+
+// updateContactSubmissionHandler responds to PATCH /api/contact/submissions/{id}
+// Moving a message out of spam doesn't send the notification it missed
+func (s *Server) updateContactSubmissionHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateContactSubmissionRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	submission, ok := findByID[models.ContactSubmission](w, r, s.db, "Contact submission")
+	if !ok {
+		return
+	}
+	if req.Status != nil {
+		submission.Status = *req.Status
+	}
+	if req.Note != nil {
+		submission.Note = *req.Note
+	}
+	if err := s.db.WithContext(r.Context()).Save(&submission).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to update contact submission: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, submission)
+}
+
+// deleteContactSubmissionHandler responds to DELETE /api/contact/submissions/{id}
+func (s *Server) deleteContactSubmissionHandler(w http.ResponseWriter, r *http.Request) {
+	submission, ok := findByID[models.ContactSubmission](w, r, s.db, "Contact submission")
+	if !ok {
+		return
+	}
+	if err := s.db.WithContext(r.Context()).Delete(&submission).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "Contact submission deleted successfully"})
+}
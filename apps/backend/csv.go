@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+)
+
+// csvContentType is the media type for comma-separated values
+// List endpoints return CSV when it is in the Accept header, for one-off data pulls into spreadsheets
+const csvContentType = "text/csv"
+
+// csvFlushEvery controls how many records are written between flushes
+const csvFlushEvery = 100
+
+// wantsCSV reports whether the client asked for CSV via the Accept header
+func wantsCSV(r *http.Request) bool {
+	return acceptsMediaType(r, csvContentType)
+}
+
+// csvColumn is one column of a CSV export
+// Name matches the JSON field name so ?columns= uses the same names as ?filter=
+type csvColumn[T any] struct {
+	Name  string
+	Value func(T) string
+}
+
+// CSV columns for each list endpoint, in default order
+var (
+	userCSVColumns = []csvColumn[models.User]{
+		{"id", func(u models.User) string { return strconv.FormatUint(uint64(u.ID), 10) }},
+		{"email", func(u models.User) string { return u.Email }},
+		{"name", func(u models.User) string { return u.Name }},
+		{"createdAt", func(u models.User) string { return csvTime(u.CreatedAt) }},
+		{"updatedAt", func(u models.User) string { return csvTime(u.UpdatedAt) }},
+	}
+	flagCSVColumns = []csvColumn[models.FeatureFlag]{
+		{"id", func(f models.FeatureFlag) string { return strconv.FormatUint(uint64(f.ID), 10) }},
+		{"key", func(f models.FeatureFlag) string { return f.Key }},
+		{"name", func(f models.FeatureFlag) string { return f.Name }},
+		{"description", func(f models.FeatureFlag) string { return f.Description }},
+		{"enabled", func(f models.FeatureFlag) string { return strconv.FormatBool(f.Enabled) }},
+		{"createdAt", func(f models.FeatureFlag) string { return csvTime(f.CreatedAt) }},
+		{"updatedAt", func(f models.FeatureFlag) string { return csvTime(f.UpdatedAt) }},
+	}
+	deploymentCSVColumns = []csvColumn[models.DeploymentEvent]{
+		{"id", func(e models.DeploymentEvent) string { return strconv.FormatUint(uint64(e.ID), 10) }},
+		{"zone", func(e models.DeploymentEvent) string { return e.Zone }},
+		{"source", func(e models.DeploymentEvent) string { return e.Source }},
+		{"eventType", func(e models.DeploymentEvent) string { return e.EventType }},
+		{"action", func(e models.DeploymentEvent) string { return e.Action }},
+		{"environment", func(e models.DeploymentEvent) string { return e.Environment }},
+		{"ref", func(e models.DeploymentEvent) string { return e.Ref }},
+		{"sha", func(e models.DeploymentEvent) string { return e.SHA }},
+		{"status", func(e models.DeploymentEvent) string { return e.Status }},
+		{"url", func(e models.DeploymentEvent) string { return e.URL }},
+		{"actor", func(e models.DeploymentEvent) string { return e.Actor }},
+		{"healthStatus", func(e models.DeploymentEvent) string { return e.HealthStatus }},
+		{"createdAt", func(e models.DeploymentEvent) string { return csvTime(e.CreatedAt) }},
+	}
+)
+
+// csvTime formats timestamps the same way the JSON responses do
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// selectCSVColumns returns the columns named in ?columns=id,email (in that order),
+// or every column when the parameter is missing
+func selectCSVColumns[T any](r *http.Request, all []csvColumn[T]) ([]csvColumn[T], error) {
+	param := strings.TrimSpace(r.URL.Query().Get("columns"))
+	if param == "" {
+		return all, nil
+	}
+
+	var selected []csvColumn[T]
+	for _, name := range strings.Split(param, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, column := range all {
+			if column.Name == name {
+				selected = append(selected, column)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+	}
+	return selected, nil
+}
+
+// csvStream writes a header row followed by one record per item
+type csvStream[T any] struct {
+	writer  *csv.Writer
+	columns []csvColumn[T]
+	record  []string
+}
+
+// startCSV sends the CSV headers and the header row
+// filename is suggested to browsers so downloads get a sensible name
+func startCSV[T any](w http.ResponseWriter, filename string, columns []csvColumn[T]) (*csvStream[T], error) {
+	w.Header().Set("Content-Type", csvContentType+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	s := &csvStream[T]{writer: csv.NewWriter(w), columns: columns, record: make([]string, len(columns))}
+	for i, column := range columns {
+		s.record[i] = column.Name
+	}
+	return s, s.writer.Write(s.record)
+}
+
+// write adds one record
+func (s *csvStream[T]) write(item T) error {
+	for i, column := range s.columns {
+		s.record[i] = csvSafe(column.Value(item))
+	}
+	return s.writer.Write(s.record)
+}
+
+// flush sends buffered records to the client
+func (s *csvStream[T]) flush() error {
+	s.writer.Flush()
+	return s.writer.Error()
+}
+
+// csvSafe stops spreadsheet apps from evaluating user-provided text as a formula
+// by prefixing values that start with a formula character with a single quote
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// streamCSV writes every row of rows as one CSV record, and closes rows
+// Like streamNDJSON, rows are read from a database cursor so memory use stays flat
+func streamCSV[T any](w http.ResponseWriter, r *http.Request, filename string, rows rowCursor[T], all []csvColumn[T]) {
+	defer rows.Close()
+
+	columns, err := selectCSVColumns(r, all)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid columns: "+err.Error())
+		return
+	}
+
+	stream, err := startCSV(w, filename, columns)
+	if err != nil {
+		log.Printf("CSV stream aborted while writing header: %v", err)
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+	extendWriteDeadline(w, requestConfig(r).Server.WriteTimeout)
+
+	count := 0
+	for rows.Next() {
+		var item T
+		if err := rows.Scan(&item); err != nil {
+			// Headers are already sent, so the best we can do is stop and log
+			log.Printf("CSV stream aborted while scanning row: %v", err)
+			return
+		}
+		if err := stream.write(item); err != nil {
+			log.Printf("CSV stream aborted while writing: %v", err)
+			return
+		}
+
+		count++
+		if count%csvFlushEvery == 0 {
+			if err := stream.flush(); err != nil {
+				// Usually means the client disconnected
+				log.Printf("CSV stream aborted while flushing: %v", err)
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			extendWriteDeadline(w, requestConfig(r).Server.WriteTimeout)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("CSV stream aborted by cursor error: %v", err)
+	}
+	if err := stream.flush(); err != nil {
+		log.Printf("CSV stream aborted while flushing: %v", err)
+	}
+}
+
+// writeCSV writes items that are already in memory (used by mock mode)
+func writeCSV[T any](w http.ResponseWriter, r *http.Request, filename string, items []T, all []csvColumn[T]) {
+	columns, err := selectCSVColumns(r, all)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid columns: "+err.Error())
+		return
+	}
+
+	stream, err := startCSV(w, filename, columns)
+	for i := 0; i < len(items) && err == nil; i++ {
+		err = stream.write(items[i])
+	}
+	if err == nil {
+		err = stream.flush()
+	}
+	if err != nil {
+		log.Printf("CSV response aborted: %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"golang.org/x/sync/errgroup"
+)
+
+// dashboardHandler responds to GET /api/dashboard
+// It gathers user stats, flag summaries, and zone statuses concurrently and returns
+// them in one response, so the admin dashboard's first paint needs a single request
+func (a *restAPI) dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	var response models.DashboardResponse
+
+	// Each section runs in its own goroutine; the first error cancels the rest
+	group, ctx := errgroup.WithContext(r.Context())
+
+	// Each section gets a span, so a slow dashboard shows which part was slow
+	group.Go(func() error {
+		ctx, span := tracer.Start(ctx, "dashboard.users")
+		defer span.End()
+		stats, err := a.users.stats(ctx)
+		response.Users = stats
+		return err
+	})
+
+	group.Go(func() error {
+		ctx, span := tracer.Start(ctx, "dashboard.flags")
+		defer span.End()
+		summary, err := a.flags.summary(ctx)
+		response.Flags = summary
+		return err
+	})
+
+	group.Go(func() error {
+		_, span := tracer.Start(ctx, "dashboard.zones")
+		defer span.End()
+		// Zone checks never fail; unreachable zones are reported as unhealthy
+		response.Zones = projectZones(ctx, a.zones.Statuses())
+		return nil
+	})
+
+	if err := group.Wait(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+
+	response.GeneratedAt = time.Now()
+	writeJSON(w, r, http.StatusOK, response)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/utils"
+)
+
+// dbLogger is the GORM logger: it logs failed queries and queries slower than
+// threshold as key=value lines, so log search can filter on duration or rows
+// Regular queries are not logged
+type dbLogger struct {
+	threshold time.Duration
+	level     logger.LogLevel // Zero follows logLevel
+	logLevel  *logLevel       // The server's or command's LOG_LEVEL (see log_level.go)
+}
+
+// newDBLogger creates a logger that reports warnings and errors, or every
+// query while level is debug
+func newDBLogger(threshold time.Duration, level *logLevel) *dbLogger {
+	return &dbLogger{threshold: threshold, logLevel: level}
+}
+
+// effectiveLevel is the level set by LogMode, or the one matching LOG_LEVEL
+func (l *dbLogger) effectiveLevel() logger.LogLevel {
+	if l.level != 0 {
+		return l.level
+	}
+	return l.logLevel.gormLevel()
+}
+
+// LogMode returns a copy of the logger with a different level (used by db.Debug())
+func (l *dbLogger) LogMode(level logger.LogLevel) logger.Interface {
+	copy := *l
+	copy.level = level
+	return &copy
+}
+
+// Info logs GORM's own informational messages
+func (l *dbLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.effectiveLevel() >= logger.Info {
+		log.Printf("level=info msg=%q", fmt.Sprintf(msg, args...))
+	}
+}
+
+// Warn logs GORM's own warnings
+func (l *dbLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.effectiveLevel() >= logger.Warn {
+		log.Printf("level=warn msg=%q", fmt.Sprintf(msg, args...))
+	}
+}
+
+// Error logs GORM's own errors
+func (l *dbLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.effectiveLevel() >= logger.Error {
+		log.Printf("level=error msg=%q", fmt.Sprintf(msg, args...))
+	}
+}
+
+// ParamsFilter drops bound values before GORM builds the logged SQL, so the
+// logs show placeholders ($1) instead of emails and other user data
+func (l *dbLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
+
+// Trace is called after every query with its SQL and how long it took
+func (l *dbLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	level := l.effectiveLevel()
+	if level <= logger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+
+	switch {
+	// A missing record is a normal result (e.g., a 404), not a failure
+	case err != nil && level >= logger.Error && !errors.Is(err, gorm.ErrRecordNotFound):
+		sql, rows := fc()
+		log.Printf("level=error msg=\"query failed\" error=%q duration=%s rows=%d caller=%s sql=%q",
+			err, elapsed, rows, utils.FileWithLineNum(), sql)
+	case l.threshold > 0 && elapsed > l.threshold && level >= logger.Warn:
+		sql, rows := fc()
+		log.Printf("level=warn msg=\"slow query\" duration=%s threshold=%s rows=%d caller=%s sql=%q",
+			elapsed, l.threshold, rows, utils.FileWithLineNum(), sql)
+	case level >= logger.Info:
+		sql, rows := fc()
+		log.Printf("level=info msg=query duration=%s rows=%d caller=%s sql=%q", elapsed, rows, utils.FileWithLineNum(), sql)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+)
+
+// Demo mode (--demo or DEMO_MODE=true) is mock mode for public playgrounds: the in-memory
+// store is filled with generated users and flags (see generate.go), everything visitors
+// change is put back every DEMO_RESET_INTERVAL, and nothing reaches outside the process
+//
+// Mock mode already leaves out the database-only endpoints (webhooks, usage, GraphQL) and
+// never contacts the zones; demo mode also turns off the settings below
+
+// demoConfig returns cfg with everything that has effects outside the process turned off:
+// Sentry reports, the zone proxy (which forwards writes to the zones), and seed files
+func demoConfig(cfg Config) Config {
+	cfg.Sentry.DSN = ""
+	cfg.Zones.GatewayMode = false
+	cfg.Database.SeedDir = ""
+	cfg.Database.SeedGenerateEnabled = false
+	return cfg
+}
+
+// Random seed of the demo data, so every reset brings back the same users and flags
+const demoSeed = 1
+
+// newDemoStore builds a mock store with DEMO_USERS generated users, and DEMO_FLAGS generated
+// flags after the sample flags the zones read; dates are relative to now like newMockStore's
+func newDemoStore(now time.Time, zones []zoneTarget, cfg DemoConfig) *mockStore {
+	m := newMockStore(now, zones)
+	g := newGenerator(demoSeed, now)
+
+	// Oldest first so IDs increase with creation time, like the samples
+	users := g.nextUsers(cfg.Users)
+	sort.SliceStable(users, func(a, b int) bool { return users[a].CreatedAt.Before(users[b].CreatedAt) })
+	m.users, m.nextUserID = make([]models.User, 0, len(users)), 0
+	for _, user := range users {
+		m.nextUserID++
+		user.ID = m.nextUserID
+		m.users = append(m.users, user)
+	}
+
+	for _, flag := range g.nextFlags(cfg.Flags) {
+		m.nextFlagID++
+		flag.ID = m.nextFlagID
+		m.flags = append(m.flags, flag)
+	}
+	return m
+}
+
+// replace swaps m's data for fresh's and returns the flags m had until now
+func (m *mockStore) replace(fresh *mockStore) []models.FeatureFlag {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	previous := m.flags
+	m.users, m.flags, m.deployments = fresh.users, fresh.flags, fresh.deployments
+	m.nextUserID, m.nextFlagID = fresh.nextUserID, fresh.nextFlagID
+	return previous
+}
+
+// resetDemo puts m back to freshly built demo data
+// Flags visitors changed are published like any other change, so the bootstrap snapshot
+// and long-polling clients pick up the reset; the flag cache is dropped entirely
+func (s *Server) resetDemo(m *mockStore, now time.Time) {
+	fresh := newDemoStore(now, m.zones, s.config.Demo)
+	previous := m.replace(fresh)
+	s.flagCache.Purge()
+
+	before := make(map[string]models.FeatureFlag, len(previous))
+	for _, flag := range previous {
+		before[flag.Key] = flag
+	}
+	after := make(map[string]bool, len(fresh.flags))
+	for _, flag := range fresh.flags {
+		after[flag.Key] = true
+		old, existed := before[flag.Key]
+		switch {
+		case !existed:
+			s.changes.publishFlagChange(flag.Key, "created")
+		case old.Name != flag.Name || old.Description != flag.Description || old.Enabled != flag.Enabled:
+			s.changes.publishFlagChange(flag.Key, "updated")
+		}
+	}
+	// Flags visitors created are gone
+	for _, flag := range previous {
+		if !after[flag.Key] {
+			s.changes.publishFlagChange(flag.Key, "deleted")
+		}
+	}
+}
+
+// resetDemoEvery resets m every interval; it runs until the process exits
+func (s *Server) resetDemoEvery(m *mockStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		s.resetDemo(m, now)
+		log.Printf("Demo data reset; next reset at %s", now.Add(interval).Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DB_DRIVER picks the database: postgres (the default), sqlite (see sqlite.go), or mysql
+// (see mysql.go). All three share the models and migrations; GORM writes most SQL for
+// the selected dialect, and the few raw fragments that differ go through the helpers below
+
+// usingSQLite reports whether database is SQLite (DB_DRIVER=sqlite)
+func usingSQLite(database *gorm.DB) bool {
+	return database.Dialector.Name() == "sqlite"
+}
+
+// usingMySQL reports whether database is MySQL (DB_DRIVER=mysql)
+func usingMySQL(database *gorm.DB) bool {
+	return database.Dialector.Name() == "mysql"
+}
+
+// primaryDialector opens the database selected by DB_DRIVER
+func primaryDialector(cfg DatabaseConfig) gorm.Dialector {
+	switch cfg.Driver {
+	case "sqlite":
+		return sqlite.Open(sqliteDSN(cfg.SQLitePath))
+	case "mysql":
+		return mysqlDialector(cfg, cfg.Host)
+	default:
+		return postgres.Open(postgresDSN(cfg, cfg.Host))
+	}
+}
+
+// replicaDialector opens the read replica on host (DB_REPLICA_HOSTS); not for SQLite
+func replicaDialector(cfg DatabaseConfig, host string) gorm.Dialector {
+	if cfg.Driver == "mysql" {
+		return mysqlDialector(cfg, host)
+	}
+	return postgres.Open(postgresDSN(cfg, host))
+}
+
+// quoteColumn quotes a column name in raw SQL, where GORM doesn't do it for us
+// Needed for "key", which MySQL reserves; Postgres and SQLite take standard double quotes
+func quoteColumn(database *gorm.DB, name string) string {
+	if usingMySQL(database) {
+		return "`" + name + "`"
+	}
+	return `"` + name + `"`
+}
+
+// excludedColumn is the value an upsert tried to insert into column, for DoUpdates expressions
+func excludedColumn(database *gorm.DB, name string) string {
+	if usingMySQL(database) {
+		return "VALUES(" + name + ")" // ON DUPLICATE KEY UPDATE
+	}
+	return "EXCLUDED." + name // ON CONFLICT DO UPDATE
+}
+
+// likeEscape ends a LIKE pattern whose wildcards escapeLike escaped with a backslash
+// MySQL string literals treat the backslash as an escape too, so it is doubled there
+func likeEscape(database *gorm.DB) string {
+	if usingMySQL(database) {
+		return `ESCAPE '\\'`
+	}
+	return `ESCAPE '\'`
+}
+
+// likeEscapeClause is likeEscape as a query argument, for conditions that are written before the
+// database is known (see filter.go); GORM builds it for the query it ends up in
+type likeEscapeClause struct{}
+
+func (likeEscapeClause) Build(builder clause.Builder) {
+	if stmt, ok := builder.(*gorm.Statement); ok {
+		builder.WriteString(likeEscape(stmt.DB))
+	}
+}
@@ -0,0 +1,612 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// Outbound email: a message is rendered from one of the email_templates when it is queued,
+// stored in email_messages, and sent by an email.send job (see jobs.go) through the EMAIL_PROVIDER,
+// SMTP or SendGrid, with retries like webhook deliveries. Addresses on the suppression list
+// (bounces, complaints, unsubscribes) are never sent to
+
+//go:embed email_templates/*.tmpl
+var emailTemplateFiles embed.FS
+
+// emailTemplate is one email_templates file, which defines "subject", "text", and "html"
+// The HTML part goes through html/template, so data is escaped there
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// emailTemplates are the templates by name, the file name without .tmpl (e.g. "invitation")
+var emailTemplates = loadEmailTemplates()
+
+// emailJobKind is the job (see jobs.go) that sends one message
+const emailJobKind = "email.send"
+
+// emailAttempts counts send attempts by result: "sent", "retry" (failed, will be retried),
+// "failed" (out of attempts or rejected), or "suppressed" (not sent)
+var emailAttempts = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+	Name: "email_send_attempts_total",
+	Help: "Outbound email send attempts by result.",
+}, []string{"result"})
+
+// loadEmailTemplates parses the embedded templates; a broken one fails at startup
+// Missing data is an error rather than "<no value>" in somebody's inbox
+func loadEmailTemplates() map[string]emailTemplate {
+	files, err := fs.Glob(emailTemplateFiles, "email_templates/*.tmpl")
+	if err != nil {
+		panic(err)
+	}
+	templates := make(map[string]emailTemplate, len(files))
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".tmpl")
+		templates[name] = emailTemplate{
+			text: texttemplate.Must(texttemplate.New(name).Option("missingkey=error").ParseFS(emailTemplateFiles, file)),
+			html: htmltemplate.Must(htmltemplate.New(name).Option("missingkey=error").ParseFS(emailTemplateFiles, file)),
+		}
+	}
+	return templates
+}
+
+// emailTemplateNames returns the template names in order, for validation messages
+func emailTemplateNames() []string {
+	names := make([]string, 0, len(emailTemplates))
+	for name := range emailTemplates {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// errEmailData is returned for data that doesn't fill in the template
+var errEmailData = errors.New("invalid template data")
+
+// renderEmail fills in template name with data and returns the message to queue for to
+func renderEmail(name, to string, data map[string]string) (models.EmailMessage, error) {
+	tmpl, ok := emailTemplates[name]
+	if !ok {
+		return models.EmailMessage{}, fmt.Errorf("%w: no template named %q", errEmailData, name)
+	}
+	var subject, text, html bytes.Buffer
+	for _, err := range []error{
+		tmpl.text.ExecuteTemplate(&subject, "subject", data),
+		tmpl.text.ExecuteTemplate(&text, "text", data),
+		tmpl.html.ExecuteTemplate(&html, "html", data),
+	} {
+		if err != nil {
+			return models.EmailMessage{}, fmt.Errorf("%w: %v", errEmailData, err)
+		}
+	}
+	return models.EmailMessage{
+		Template: name,
+		To:       strings.ToLower(to),
+		// A line break in the data must not start a new header
+		Subject:  strings.Join(strings.Fields(subject.String()), " "),
+		TextBody: strings.TrimSpace(text.String()) + "\n",
+		HTMLBody: strings.TrimSpace(html.String()) + "\n",
+	}, nil
+}
+
+// emailProvider sends one message; EMAIL_PROVIDER picks the implementation
+type emailProvider interface {
+	send(ctx context.Context, from *mail.Address, message models.EmailMessage) error
+}
+
+// emailRejectedError is a send that can never succeed, so it isn't retried
+// bounce is set when the recipient's address itself was refused, which suppresses it
+type emailRejectedError struct {
+	err    error
+	bounce bool
+}
+
+func (e *emailRejectedError) Error() string { return e.err.Error() }
+func (e *emailRejectedError) Unwrap() error { return e.err }
+
+// mailer queues and sends email
+// Its methods do nothing on a nil mailer, which is what an empty EMAIL_PROVIDER gives
+type mailer struct {
+	db       *gorm.DB
+	provider emailProvider
+	from     *mail.Address
+	cfg      EmailConfig
+
+	// REQUEST_TIMEOUT, for queueing zone alerts outside any request
+	timeout time.Duration
+
+	// Zone alerts are seen by every replica that checks the zones, so only the leader queues them
+	leader *leaderElector
+
+	jobs *jobQueue // Sends the messages
+
+	logLevel *logLevel // The server's, for debug lines about each message
+}
+
+// newMailer creates a mailer that stores messages in database and registers the job that sends
+// them with jobs, or returns nil when EMAIL_PROVIDER is empty
+func newMailer(database *gorm.DB, jobs *jobQueue, cfg Config) (*mailer, error) {
+	var provider emailProvider
+	switch cfg.Email.Provider {
+	case "":
+		return nil, nil
+	case "smtp":
+		provider = smtpProvider{cfg: cfg.Email}
+	case "sendgrid":
+		provider = sendGridProvider{
+			client: &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)},
+			url:    cfg.Email.SendGridURL,
+			apiKey: cfg.Email.SendGridAPIKey,
+		}
+	}
+	from, err := mail.ParseAddress(cfg.Email.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid EMAIL_FROM %q: %w", cfg.Email.From, err)
+	}
+	m := &mailer{db: database, provider: provider, from: from, cfg: cfg.Email, timeout: cfg.Server.RequestTimeout, jobs: jobs}
+	jobs.register(emailJobKind, jobWorker{
+		run:         m.deliver,
+		maxAttempts: cfg.Email.MaxAttempts,
+		backoff:     cfg.Email.RetryBackoff,
+		concurrency: 1, // Mail servers limit connections per client
+	})
+	return m, nil
+}
+
+// enqueue renders template name for to and queues it; errEmailData means the data doesn't fit
+func (m *mailer) enqueue(ctx context.Context, name, to string, data map[string]string) (models.EmailMessage, error) {
+	message, err := renderEmail(name, to, data)
+	if err != nil {
+		return message, err
+	}
+	now := time.Now()
+	message.Status, message.NextAttemptAt = "pending", &now
+	err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&message).Error; err != nil {
+			return err
+		}
+		return m.jobs.enqueue(tx, emailJobKind, emailSendJob{MessageID: message.ID})
+	})
+	if err != nil {
+		return message, err
+	}
+	m.logLevel.debugf("queued %s email %d to %s", name, message.ID, message.To)
+	m.jobs.notify(emailJobKind)
+	return message, nil
+}
+
+// zoneChanged emails EMAIL_ALERT_RECIPIENTS when a zone stops being healthy or recovers
+func (m *mailer) zoneChanged(previous string, status models.ZoneStatus) {
+	if m == nil || len(m.cfg.AlertRecipients) == 0 || !m.leader.isLeading() {
+		return
+	}
+	var data map[string]string
+	switch zoneTransitionEvent(previous, status.Status) {
+	case "zone.incident":
+		data = map[string]string{
+			"title":   fmt.Sprintf("%s is %s", status.Name, status.Status),
+			"message": fmt.Sprintf("%s was %s and is now %s: %s", status.Name, previous, status.Status, status.Message),
+		}
+	case "zone.recovered":
+		data = map[string]string{
+			"title":   fmt.Sprintf("%s has recovered", status.Name),
+			"message": fmt.Sprintf("%s was %s and is healthy again.", status.Name, previous),
+		}
+	default:
+		return
+	}
+
+	// Called from a health check, not a request, so it gets a deadline of its own
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+	for _, to := range m.cfg.AlertRecipients {
+		if _, err := m.enqueue(ctx, "alert", to, data); err != nil {
+			log.Printf("Failed to queue zone alert for %s: %v", to, err)
+		}
+	}
+}
+
+// emailSendJob is the payload of an email.send job
+type emailSendJob struct {
+	MessageID uint `json:"messageId"`
+}
+
+// deliver sends a message once and records the outcome; the email.send job worker
+// A message to a suppressed address is marked suppressed instead, even if it was queued first
+func (m *mailer) deliver(ctx context.Context, job models.Job) error {
+	var payload emailSendJob
+	if err := decodeJobPayload(job, &payload); err != nil {
+		return err
+	}
+	var message models.EmailMessage
+	err := m.db.WithContext(ctx).Clauses(dbresolver.Write).First(&message, payload.MessageID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || message.Status == "sent" || message.Status == "suppressed" {
+		return nil // Pruned, or already handled by an earlier run
+	}
+	if err != nil {
+		return err
+	}
+
+	var suppressed int64
+	if err := m.db.WithContext(ctx).Model(&models.EmailSuppression{}).Where("email = ?", message.To).Count(&suppressed).Error; err != nil {
+		return err
+	}
+	if suppressed > 0 {
+		m.record(message, nil, "suppressed")
+		return nil
+	}
+	return m.attempt(ctx, message, job.Attempts >= job.MaxAttempts)
+}
+
+// attempt sends message once and records the outcome; final is set on the last attempt
+func (m *mailer) attempt(ctx context.Context, message models.EmailMessage, final bool) error {
+	sendCtx, cancel := context.WithTimeout(ctx, m.cfg.Timeout)
+	err := m.provider.send(sendCtx, m.from, message)
+	cancel()
+	if err != nil && ctx.Err() != nil {
+		return err // Leadership ended mid-send; the next leader sends it again
+	}
+	message.Attempts++
+
+	var rejected *emailRejectedError
+	switch {
+	case err == nil:
+		m.record(message, nil, "sent")
+	case errors.As(err, &rejected):
+		m.record(message, err, "failed")
+		if rejected.bounce {
+			m.suppress(message.To, "bounce")
+		}
+		return permanent(err)
+	case final:
+		m.record(message, err, "failed")
+	default:
+		m.record(message, err, "pending")
+	}
+	return err
+}
+
+// record stores a message's new status: sent, failed, suppressed, or pending a retry after the backoff
+func (m *mailer) record(message models.EmailMessage, err error, status string) {
+	now := time.Now()
+	updates := map[string]interface{}{"status": status, "attempts": message.Attempts, "error": "", "next_attempt_at": nil}
+	if err != nil {
+		updates["error"] = err.Error()
+	}
+	switch status {
+	case "sent":
+		updates["sent_at"] = now
+		emailAttempts.WithLabelValues("sent").Inc()
+	case "pending":
+		updates["next_attempt_at"] = now.Add(retryWait(m.cfg.RetryBackoff, message.Attempts))
+		emailAttempts.WithLabelValues("retry").Inc()
+		m.logLevel.debugf("email %d attempt %d failed: %v", message.ID, message.Attempts, err)
+	case "failed":
+		emailAttempts.WithLabelValues("failed").Inc()
+		log.Printf("Email %d (%s) to %s failed after %d attempts: %v", message.ID, message.Template, message.To, message.Attempts, err)
+	default:
+		emailAttempts.WithLabelValues(status).Inc()
+	}
+
+	// Not tied to the leader's context: an attempt that was made is recorded even if leadership just ended
+	if err := m.db.Model(&models.EmailMessage{}).Where("id = ?", message.ID).Updates(updates).Error; err != nil {
+		log.Printf("Failed to record email %d: %v", message.ID, err)
+	}
+}
+
+// suppress adds address to the suppression list, unless it is already on it
+func (m *mailer) suppress(address, reason string) {
+	suppression := models.EmailSuppression{Email: address, Reason: reason}
+	result := m.db.Where(models.EmailSuppression{Email: address}).FirstOrCreate(&suppression)
+	if result.Error != nil {
+		log.Printf("Failed to suppress %s: %v", address, result.Error)
+	} else if result.RowsAffected > 0 {
+		log.Printf("Suppressed email to %s (%s)", address, reason)
+	}
+}
+
+// prune deletes messages that are no longer pending and are older than EMAIL_RETENTION_DAYS,
+// and returns how many there were (on a dry run, would be); the cleanup-email schedule (see schedules.go)
+func (m *mailer) prune(ctx context.Context, dryRun bool) (int64, error) {
+	if m.cfg.RetentionDays <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().AddDate(0, 0, -m.cfg.RetentionDays)
+	return purge(m.db.WithContext(ctx).Where("status <> ? AND created_at < ?", "pending", cutoff), &models.EmailMessage{}, dryRun)
+}
+
+// smtpProvider sends through EMAIL_SMTP_HOST: implicit TLS on port 465, otherwise
+// STARTTLS when the server offers it, and AUTH PLAIN when a username is set
+type smtpProvider struct {
+	cfg EmailConfig
+}
+
+func (p smtpProvider) send(ctx context.Context, from *mail.Address, message models.EmailMessage) error {
+	host := p.cfg.SMTPHost
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(p.cfg.SMTPPort)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if p.cfg.SMTPPort == 465 {
+		conn = tls.Client(conn, &tls.Config{ServerName: host})
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if p.cfg.SMTPUsername != "" {
+		if err := client.Auth(smtp.PlainAuth("", p.cfg.SMTPUsername, p.cfg.SMTPPassword, host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return smtpRejected(err, false)
+	}
+	if err := client.Rcpt(message.To); err != nil {
+		return smtpRejected(err, true)
+	}
+	body, err := client.Data()
+	if err != nil {
+		return smtpRejected(err, false)
+	}
+	if err := writeMIMEMessage(body, from, message); err != nil {
+		return err
+	}
+	if err := body.Close(); err != nil {
+		return smtpRejected(err, false)
+	}
+	return client.Quit()
+}
+
+// smtpRejected marks permanent (5xx) SMTP replies as rejected; anything else is retried
+func smtpRejected(err error, bounce bool) error {
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return &emailRejectedError{err: err, bounce: bounce}
+	}
+	return err
+}
+
+// writeMIMEMessage writes message as a multipart/alternative email with text and HTML parts
+func writeMIMEMessage(w io.Writer, from *mail.Address, message models.EmailMessage) error {
+	parts := multipart.NewWriter(w)
+	header := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: multipart/alternative; boundary=%q\r\n\r\n",
+		from, message.To, mime.QEncoding.Encode("utf-8", message.Subject), time.Now().Format(time.RFC1123Z), parts.Boundary())
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", message.TextBody},
+		{"text/html; charset=utf-8", message.HTMLBody},
+	} {
+		pw, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return err
+		}
+		qp := quotedprintable.NewWriter(pw)
+		if _, err := io.WriteString(qp, part.body); err != nil {
+			return err
+		}
+		if err := qp.Close(); err != nil {
+			return err
+		}
+	}
+	return parts.Close()
+}
+
+// sendGridProvider sends through the SendGrid v3 Mail Send API at EMAIL_SENDGRID_URL
+type sendGridProvider struct {
+	client *http.Client
+	url    string // EMAIL_SENDGRID_URL
+	apiKey string // EMAIL_SENDGRID_API_KEY
+}
+
+// sendGridAddress is an address in a SendGrid request
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+func (p sendGridProvider) send(ctx context.Context, from *mail.Address, message models.EmailMessage) error {
+	type content struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"personalizations": []map[string]interface{}{{"to": []sendGridAddress{{Email: message.To}}}},
+		"from":             sendGridAddress{Email: from.Address, Name: from.Name},
+		"subject":          message.Subject,
+		"content":          []content{{"text/plain", message.TextBody}, {"text/html", message.HTMLBody}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url+"/v3/mail/send", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode <= 499 && resp.StatusCode != http.StatusTooManyRequests:
+		// The request itself is wrong (bad key, invalid address), so retrying won't help
+		return &emailRejectedError{err: fmt.Errorf("SendGrid responded %s: %s", resp.Status, bytes.TrimSpace(detail))}
+	default:
+		return fmt.Errorf("SendGrid responded %s", resp.Status)
+	}
+}
+
+// emailFilterFields are the send log fields ?filter= and ?orderby= accept
+var emailFilterFields = filterFields{
+	"id":        {Column: "id", Kind: filterNumber},
+	"template":  {Column: "template", Kind: filterString},
+	"to":        {Column: "recipient", Kind: filterString},
+	"status":    {Column: "status", Kind: filterString},
+	"attempts":  {Column: "attempts", Kind: filterNumber},
+	"createdAt": {Column: "created_at", Kind: filterTime},
+}
+
+// emailSuppressionFilterFields are the suppression list fields ?filter= and ?orderby= accept
+var emailSuppressionFilterFields = filterFields{
+	"email":     {Column: "email", Kind: filterString},
+	"reason":    {Column: "reason", Kind: filterString},
+	"createdAt": {Column: "created_at", Kind: filterTime},
+}
+
+// sendEmailHandler responds to POST /api/emails
+// The message is rendered and queued; 202 means it will be sent, not that it was
+func (s *Server) sendEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.SendEmailRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	message, err := s.mailer.enqueue(r.Context(), req.Template, req.To, req.Data)
+	if err != nil {
+		if errors.Is(err, errEmailData) {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+		} else {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to queue email: %v", err))
+		}
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s/api/emails/%d", s.config.Server.BasePath, message.ID))
+	writeJSON(w, r, http.StatusAccepted, message)
+}
+
+// getEmailsHandler responds to GET /api/emails
+// The send log, newest first (the latest 100 unless a page size is asked for), narrowed with
+// the shared ?filter= and ?orderby= parameters, e.g. ?filter=status eq "failed"
+func (s *Server) getEmailsHandler(w http.ResponseWriter, r *http.Request) {
+	listQuery, err := parseListQuery(r, emailFilterFields)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid query: "+err.Error())
+		return
+	}
+	if r.URL.Query().Get("pageSize") == "" {
+		listQuery.page.PageSize = min(listQuery.page.PageSize, 100)
+	}
+
+	var messages []models.EmailMessage
+	if err := listQuery.apply(s.db.WithContext(r.Context()).Model(&models.EmailMessage{}), "id DESC").Find(&messages).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	setNextPageLink(w, r, listQuery.page, len(messages))
+	writeJSON(w, r, http.StatusOK, messages)
+}
+
+// getEmailHandler responds to GET /api/emails/{id}
+func (s *Server) getEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if message, ok := findByID[models.EmailMessage](w, r, s.db, "Email"); ok {
+		writeJSON(w, r, http.StatusOK, message)
+	}
+}
+
+// getEmailSuppressionsHandler responds to GET /api/email-suppressions
+// Ordered by address; ?filter=, ?orderby=, and pagination work like the other list endpoints
+func (s *Server) getEmailSuppressionsHandler(w http.ResponseWriter, r *http.Request) {
+	listQuery, err := parseListQuery(r, emailSuppressionFilterFields)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid query: "+err.Error())
+		return
+	}
+	var suppressions []models.EmailSuppression
+	if err := listQuery.apply(s.db.WithContext(r.Context()).Model(&models.EmailSuppression{}), "email").Find(&suppressions).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	setNextPageLink(w, r, listQuery.page, len(suppressions))
+	writeJSON(w, r, http.StatusOK, suppressions)
+}
+
+// createEmailSuppressionHandler responds to POST /api/email-suppressions
+// Pending messages to the address are suppressed when they come up, not sent
+func (s *Server) createEmailSuppressionHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateEmailSuppressionRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	suppression := models.EmailSuppression{Email: strings.ToLower(req.Email), Reason: req.Reason}
+	if suppression.Reason == "" {
+		suppression.Reason = "manual"
+	}
+
+	result := s.db.WithContext(r.Context()).Where(models.EmailSuppression{Email: suppression.Email}).FirstOrCreate(&suppression)
+	if result.Error != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to suppress email address: %v", result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		writeError(w, r, http.StatusConflict, "Email address is already suppressed")
+		return
+	}
+	writeJSON(w, r, http.StatusCreated, suppression)
+}
+
+// deleteEmailSuppressionHandler responds to DELETE /api/email-suppressions/{email}
+func (s *Server) deleteEmailSuppressionHandler(w http.ResponseWriter, r *http.Request) {
+	result := s.db.WithContext(r.Context()).Where("email = ?", strings.ToLower(r.PathValue("email"))).Delete(&models.EmailSuppression{})
+	switch {
+	case result.Error != nil:
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", result.Error))
+	case result.RowsAffected == 0:
+		writeError(w, r, http.StatusNotFound, "Email address is not suppressed")
+	default:
+		writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "Email address unsuppressed successfully"})
+	}
+}
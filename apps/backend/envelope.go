@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+)
+
+// apiVersionKey is the context key under which the API version is stored
+type apiVersionKey struct{}
+
+// withAPIVersion marks requests as belonging to an API version
+// Handlers and render helpers use it to decide the response shape
+func withAPIVersion(version int) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), apiVersionKey{}, version)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// apiVersion returns the API version of the request (1 if unversioned)
+func apiVersion(r *http.Request) int {
+	if version, ok := r.Context().Value(apiVersionKey{}).(int); ok {
+		return version
+	}
+	return 1
+}
+
+// envelope is the v2 response shape
+// Lists:  {data: [...], meta: {total, page, pageSize, requestId}, links: {...}}
+// Single: {data: {...}, meta: {requestId}}
+type envelope struct {
+	Data  interface{}    `json:"data"`
+	Meta  envelopeMeta   `json:"meta"`
+	Links *envelopeLinks `json:"links,omitempty"`
+}
+
+// envelopeMeta holds response metadata
+// Pagination fields are only present on list responses
+type envelopeMeta struct {
+	Total     *int64 `json:"total,omitempty"`
+	Page      int    `json:"page,omitempty"`
+	PageSize  int    `json:"pageSize,omitempty"`
+	RequestID string `json:"requestId"`
+}
+
+// envelopeLinks holds pagination links for list responses
+type envelopeLinks struct {
+	Self  string `json:"self"`
+	First string `json:"first"`
+	Last  string `json:"last"`
+	Prev  string `json:"prev,omitempty"`
+	Next  string `json:"next,omitempty"`
+}
+
+// envelopeError is the v2 error shape: {error: {status, message, fields}, meta: {requestId}}
+type envelopeError struct {
+	Error struct {
+		Status  int                 `json:"status"`
+		Message string              `json:"message"`
+		Fields  []models.FieldError `json:"fields,omitempty"` // Per-field validation errors
+	} `json:"error"`
+	Meta envelopeMeta `json:"meta"`
+}
+
+// pageRequest is the page requested by a client via ?page=&pageSize=
+type pageRequest struct {
+	Page     int // 1-based page number
+	PageSize int // Number of items per page
+}
+
+// Offset returns the number of rows to skip for this page
+func (p pageRequest) Offset() int {
+	return (p.Page - 1) * p.PageSize
+}
+
+// parsePageRequest reads page and pageSize query parameters with sane defaults
+// Out-of-range values are clamped rather than rejected
+// v1 lists have no pagination metadata, so they default to the largest page allowed
+func parsePageRequest(r *http.Request) pageRequest {
+	cfg := requestConfig(r).API
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(r.URL.Query().Get("pageSize"))
+	if err != nil || pageSize < 1 {
+		pageSize = cfg.DefaultPageSize
+		if apiVersion(r) < 2 {
+			pageSize = cfg.MaxPageSize
+		}
+	}
+	if pageSize > cfg.MaxPageSize {
+		pageSize = cfg.MaxPageSize
+	}
+
+	return pageRequest{Page: page, PageSize: pageSize}
+}
+
+// writeList sends one page of a collection wrapped in the v2 envelope
+// JSON:API clients get the same pagination data in the document's meta and links
+func writeList(w http.ResponseWriter, r *http.Request, items interface{}, total int64, page pageRequest) {
+	links := buildPageLinks(r.URL, total, page)
+
+	if wantsJSONAPI(r) {
+		doc := toJSONAPIDocument(r, items)
+		doc.addMeta("total", total)
+		doc.addMeta("page", page.Page)
+		doc.addMeta("pageSize", page.PageSize)
+		doc.addMeta("requestId", requestIDFrom(r.Context()))
+		doc.Links = links
+		writeDocument(w, http.StatusOK, jsonAPIContentType, doc)
+		return
+	}
+
+	env := envelope{
+		Data: withLinks(r, items),
+		Meta: envelopeMeta{
+			Total:     &total,
+			Page:      page.Page,
+			PageSize:  page.PageSize,
+			RequestID: requestIDFrom(r.Context()),
+		},
+		Links: links,
+	}
+	writeRaw(w, r, http.StatusOK, env)
+}
+
+// setNextPageLink adds a Link: <...>; rel="next" header when a list without
+// pagination metadata (v1, binary formats) returned a full page, so clients
+// can tell the list was cut off and fetch the rest
+func setNextPageLink(w http.ResponseWriter, r *http.Request, page pageRequest, count int) {
+	if count < page.PageSize {
+		return
+	}
+	query := r.URL.Query()
+	query.Set("page", strconv.Itoa(page.Page+1))
+	query.Set("pageSize", strconv.Itoa(page.PageSize))
+	w.Header().Set("Link", "<"+r.URL.Path+"?"+query.Encode()+`>; rel="next"`)
+}
+
+// buildPageLinks builds self/first/last/prev/next links that keep all other query parameters
+func buildPageLinks(u *url.URL, total int64, page pageRequest) *envelopeLinks {
+	lastPage := int(math.Ceil(float64(total) / float64(page.PageSize)))
+	if lastPage < 1 {
+		lastPage = 1
+	}
+
+	link := func(n int) string {
+		query := u.Query()
+		query.Set("page", strconv.Itoa(n))
+		query.Set("pageSize", strconv.Itoa(page.PageSize))
+		return u.Path + "?" + query.Encode()
+	}
+
+	links := &envelopeLinks{
+		Self:  link(page.Page),
+		First: link(1),
+		Last:  link(lastPage),
+	}
+	if page.Page > 1 {
+		links.Prev = link(page.Page - 1)
+	}
+	if page.Page < lastPage {
+		links.Next = link(page.Page + 1)
+	}
+	return links
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Experiments are A/B tests. A zone asks POST /api/experiments/{key}/assignments which variant
+// a unit (a user ID, or a visitor ID for anonymous traffic) sees; the unit is bucketed by
+// hashing, and the first assignment is stored so it never changes. The zones then report
+// exposures (the unit saw its variant) and conversions (it did the thing being measured) to
+// POST /api/experiments/events, and GET /api/experiments/{key}/results compares the variants
+
+// experimentTransitions are the status changes allowed, from each status to the next
+var experimentTransitions = map[string]string{"draft": "running", "running": "stopped"}
+
+// experimentBuckets is how finely units are bucketed; allocation percentages map onto it
+const experimentBuckets = 10000
+
+// experimentBucket hashes unit into [0, experimentBuckets) for one experiment
+// The salt keeps the allocation and the variant choice independent of each other
+func experimentBucket(salt, experiment, unit string) int {
+	sum := sha256.Sum256([]byte(salt + ":" + experiment + ":" + unit))
+	return int(binary.BigEndian.Uint64(sum[:8]) % experimentBuckets)
+}
+
+// pickVariant buckets unit into one of the experiment's variants by weight, or returns false when
+// the unit falls outside the allocation. The same unit always gets the same answer as long as
+// the variants and allocation don't change
+func pickVariant(experiment models.Experiment, unit string) (string, bool) {
+	if experimentBucket("allocation", experiment.Key, unit) >= experiment.Allocation*experimentBuckets/100 {
+		return "", false
+	}
+	total := 0
+	for _, variant := range experiment.Variants {
+		total += variant.Weight
+	}
+	point := experimentBucket("variant", experiment.Key, unit) * total / experimentBuckets
+	for _, variant := range experiment.Variants {
+		if point < variant.Weight {
+			return variant.Key, true
+		}
+		point -= variant.Weight
+	}
+	return experiment.Variants[len(experiment.Variants)-1].Key, true
+}
+
+// checkExperiment returns the problems with an experiment that the validate tags can't see:
+// repeated variant keys and a badly formed flag. A flag that doesn't exist yet is allowed;
+// nobody is enrolled until it is created and on
+func checkExperiment(experiment models.Experiment) []models.FieldError {
+	var fieldErrors []models.FieldError
+	seen := map[string]bool{}
+	for i, variant := range experiment.Variants {
+		if seen[variant.Key] {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: fmt.Sprintf("variants[%d].key", i), Message: "must not repeat another variant's key"})
+		}
+		seen[variant.Key] = true
+	}
+	if experiment.FlagKey != "" && !flagKeyPattern.MatchString(experiment.FlagKey) {
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "flag", Message: "must contain only lowercase letters, digits, and underscores"})
+	}
+	return fieldErrors
+}
+
+// listExperimentsHandler responds to GET /api/experiments
+// Every experiment, newest first
+func (s *Server) listExperimentsHandler(w http.ResponseWriter, r *http.Request) {
+	var experiments []models.Experiment
+	if err := s.db.WithContext(r.Context()).Order("id DESC").Find(&experiments).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, experiments)
+}
+
+// createExperimentHandler responds to POST /api/experiments
+// New experiments are drafts; nobody is enrolled until they are set running
+func (s *Server) createExperimentHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateExperimentRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	experiment := models.Experiment{
+		Key:           req.Key,
+		Name:          req.Name,
+		Hypothesis:    req.Hypothesis,
+		Status:        "draft",
+		Variants:      models.JSONList[models.ExperimentVariant](req.Variants),
+		Allocation:    cmp.Or(req.Allocation, 100),
+		FlagKey:       req.Flag,
+		PrimaryMetric: cmp.Or(req.PrimaryMetric, "conversion"),
+	}
+	if fieldErrors := checkExperiment(experiment); len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+
+	var existing int64
+	if err := s.db.WithContext(r.Context()).Model(&models.Experiment{}).Where(byKey(req.Key)).Count(&existing).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	if existing > 0 {
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("An experiment with key %s already exists", req.Key))
+		return
+	}
+	if err := s.db.WithContext(r.Context()).Create(&experiment).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to create experiment: %v", err))
+		return
+	}
+	log.Printf("Experiment %s created with %d variants", experiment.Key, len(experiment.Variants))
+
+	w.Header().Set("Location", fmt.Sprintf("%s/api/experiments/%s", s.config.Server.BasePath, experiment.Key))
+	writeJSON(w, r, http.StatusCreated, experiment)
+}
+
+// getExperimentHandler responds to GET /api/experiments/{key}
+func (s *Server) getExperimentHandler(w http.ResponseWriter, r *http.Request) {
+	if experiment, ok := findBy[models.Experiment](w, r, s.db, "Experiment", byKey(r.PathValue("key"))); ok {
+		writeJSON(w, r, http.StatusOK, experiment)
+	}
+}
+
+// updateExperimentHandler responds to PATCH /api/experiments/{key}
+// Setting the status starts ("running") or stops ("stopped") the experiment. The variants are
+// fixed once it has started, since changing them would move units that are already assigned
+func (s *Server) updateExperimentHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateExperimentRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	experiment, ok := findBy[models.Experiment](w, r, s.db, "Experiment", byKey(r.PathValue("key")))
+	if !ok {
+		return
+	}
+
+	previousStatus := experiment.Status
+	if req.Variants != nil && experiment.Status != "draft" {
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("Experiment %s has started, so its variants can't change", experiment.Key))
+		return
+	}
+	if req.Status != nil && *req.Status != experiment.Status {
+		if experimentTransitions[experiment.Status] != *req.Status {
+			writeError(w, r, http.StatusConflict, fmt.Sprintf("Experiment %s can't go from %s to %s", experiment.Key, experiment.Status, *req.Status))
+			return
+		}
+		now := time.Now()
+		if *req.Status == "running" {
+			experiment.StartedAt = &now
+		} else {
+			experiment.StoppedAt = &now
+		}
+		experiment.Status = *req.Status
+	}
+
+	if req.Name != nil {
+		experiment.Name = *req.Name
+	}
+	if req.Hypothesis != nil {
+		experiment.Hypothesis = *req.Hypothesis
+	}
+	if req.Variants != nil {
+		experiment.Variants = models.JSONList[models.ExperimentVariant](req.Variants)
+	}
+	if req.Allocation != nil {
+		experiment.Allocation = *req.Allocation
+	}
+	if req.Flag != nil {
+		experiment.FlagKey = *req.Flag
+	}
+	if req.PrimaryMetric != nil {
+		experiment.PrimaryMetric = *req.PrimaryMetric
+	}
+	if fieldErrors := checkExperiment(experiment); len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+	if err := s.db.WithContext(r.Context()).Save(&experiment).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to update experiment: %v", err))
+		return
+	}
+	if experiment.Status != previousStatus {
+		log.Printf("Experiment %s is %s", experiment.Key, experiment.Status)
+	}
+	writeJSON(w, r, http.StatusOK, experiment)
+}
+
+// deleteExperimentHandler responds to DELETE /api/experiments/{key}
+// Its assignments and events go with it
+func (s *Server) deleteExperimentHandler(w http.ResponseWriter, r *http.Request) {
+	experiment, ok := findBy[models.Experiment](w, r, s.db, "Experiment", byKey(r.PathValue("key")))
+	if !ok {
+		return
+	}
+	err := s.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("experiment_id = ?", experiment.ID).Delete(&models.ExperimentEvent{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("experiment_id = ?", experiment.ID).Delete(&models.ExperimentAssignment{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&experiment).Error
+	})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "Experiment deleted successfully"})
+}
+
+// assignExperimentHandler responds to POST /api/experiments/{key}/assignments
+// The unit's variant: the stored one if it has been assigned before, otherwise a new one while
+// the experiment is running and its flag (if any) is on. Units that aren't enrolled should be
+// shown the control, and their events are ignored
+func (s *Server) assignExperimentHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.AssignExperimentRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	experiment, ok := findBy[models.Experiment](w, r, s.db, "Experiment", byKey(r.PathValue("key")))
+	if !ok {
+		return
+	}
+	response := models.AssignmentResponse{Experiment: experiment.Key, Unit: req.Unit}
+
+	var assignment models.ExperimentAssignment
+	err := s.db.WithContext(r.Context()).Where("experiment_id = ? AND unit = ?", experiment.ID, req.Unit).Limit(1).Find(&assignment).Error
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	if assignment.ID == 0 && experiment.Status == "running" {
+		enrolled := true
+		if experiment.FlagKey != "" {
+			flag, err := s.flags.get(r.Context(), experiment.FlagKey)
+			if err != nil && !errors.Is(err, errNotFound) {
+				writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+				return
+			}
+			enrolled = err == nil && flag.Enabled
+		}
+		if variant, ok := pickVariant(experiment, req.Unit); enrolled && ok {
+			// A concurrent request for the same unit may win the insert; both then read its row
+			assignment = models.ExperimentAssignment{ExperimentID: experiment.ID, Unit: req.Unit, Variant: variant}
+			err := s.db.WithContext(r.Context()).Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "experiment_id"}, {Name: "unit"}},
+				DoNothing: true,
+			}).Create(&assignment).Error
+			if err == nil {
+				err = s.db.WithContext(r.Context()).Where("experiment_id = ? AND unit = ?", experiment.ID, req.Unit).First(&assignment).Error
+			}
+			if err != nil {
+				writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to assign variant: %v", err))
+				return
+			}
+		}
+	}
+	if assignment.ID != 0 {
+		response.Enrolled = true
+		response.Variant = assignment.Variant
+	}
+	writeJSON(w, r, http.StatusOK, response)
+}
+
+// recordExperimentEventsHandler responds to POST /api/experiments/events
+// Events are only kept for running experiments and units assigned to them, and are stored
+// against the unit's variant; the others are counted as ignored rather than rejected, so a zone
+// can send whatever it saw without checking first
+func (s *Server) recordExperimentEventsHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.ExperimentEventsRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	keys := map[string]bool{}
+	for _, event := range req.Events {
+		keys[event.Experiment] = true
+	}
+	var experiments []models.Experiment
+	if err := s.db.WithContext(r.Context()).Where("status = ?", "running").Find(&experiments).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	running := map[string]models.Experiment{}
+	for _, experiment := range experiments {
+		if keys[experiment.Key] {
+			running[experiment.Key] = experiment
+		}
+	}
+
+	// The variant of each unit, looked up once per experiment
+	variants := map[string]map[string]string{}
+	for key, experiment := range running {
+		var units []string
+		for _, event := range req.Events {
+			if event.Experiment == key {
+				units = append(units, event.Unit)
+			}
+		}
+		var assignments []models.ExperimentAssignment
+		if err := s.db.WithContext(r.Context()).Where("experiment_id = ? AND unit IN ?", experiment.ID, units).Find(&assignments).Error; err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+			return
+		}
+		variants[key] = map[string]string{}
+		for _, assignment := range assignments {
+			variants[key][assignment.Unit] = assignment.Variant
+		}
+	}
+
+	var events []models.ExperimentEvent
+	for _, input := range req.Events {
+		variant, ok := variants[input.Experiment][input.Unit]
+		if !ok {
+			continue
+		}
+		experiment := running[input.Experiment]
+		event := models.ExperimentEvent{ExperimentID: experiment.ID, Type: input.Type, Variant: variant, Unit: input.Unit}
+		if input.Type == "conversion" {
+			event.Metric = cmp.Or(input.Metric, experiment.PrimaryMetric)
+		}
+		events = append(events, event)
+	}
+	if len(events) > 0 {
+		if err := s.db.WithContext(r.Context()).Create(&events).Error; err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to record events: %v", err))
+			return
+		}
+	}
+	writeJSON(w, r, http.StatusAccepted, models.ExperimentEventsResponse{Accepted: len(events), Ignored: len(req.Events) - len(events)})
+}
+
+// getExperimentResultsHandler responds to GET /api/experiments/{key}/results
+// Per variant: how many units were assigned, exposed, and converted on the primary metric after
+// an exposure, with each variant's conversion rate compared against the control's
+func (s *Server) getExperimentResultsHandler(w http.ResponseWriter, r *http.Request) {
+	experiment, ok := findBy[models.Experiment](w, r, s.db, "Experiment", byKey(r.PathValue("key")))
+	if !ok {
+		return
+	}
+
+	type variantCount struct {
+		Variant string
+		Metric  string
+		Units   int64
+	}
+	db := s.db.WithContext(r.Context())
+	var assigned, exposed, converted, metrics []variantCount
+	err := db.Model(&models.ExperimentAssignment{}).Select("variant, COUNT(*) AS units").
+		Where("experiment_id = ?", experiment.ID).Group("variant").Scan(&assigned).Error
+	if err == nil {
+		err = db.Model(&models.ExperimentEvent{}).Select("variant, COUNT(DISTINCT unit) AS units").
+			Where("experiment_id = ? AND type = ?", experiment.ID, "exposure").Group("variant").Scan(&exposed).Error
+	}
+	if err == nil {
+		err = db.Table("experiment_events AS conversions").Select("conversions.variant, COUNT(DISTINCT conversions.unit) AS units").
+			Where("conversions.experiment_id = ? AND conversions.type = ? AND conversions.metric = ?", experiment.ID, "conversion", experiment.PrimaryMetric).
+			Where("EXISTS (SELECT 1 FROM experiment_events AS exposures WHERE exposures.experiment_id = conversions.experiment_id AND exposures.unit = conversions.unit AND exposures.type = ?)", "exposure").
+			Group("conversions.variant").Scan(&converted).Error
+	}
+	if err == nil {
+		err = db.Model(&models.ExperimentEvent{}).Select("variant, metric, COUNT(DISTINCT unit) AS units").
+			Where("experiment_id = ? AND type = ?", experiment.ID, "conversion").Group("variant, metric").Scan(&metrics).Error
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+
+	results := models.ExperimentResults{
+		Experiment:    experiment.Key,
+		Status:        experiment.Status,
+		PrimaryMetric: experiment.PrimaryMetric,
+		Variants:      make([]models.ExperimentVariantResult, len(experiment.Variants)),
+	}
+	index := map[string]int{}
+	for i, variant := range experiment.Variants {
+		index[variant.Key] = i
+		results.Variants[i] = models.ExperimentVariantResult{Variant: variant.Key, Metrics: map[string]int64{}}
+	}
+	for _, count := range assigned {
+		if i, ok := index[count.Variant]; ok {
+			results.Variants[i].Assigned = count.Units
+		}
+	}
+	for _, count := range exposed {
+		if i, ok := index[count.Variant]; ok {
+			results.Variants[i].Exposed = count.Units
+		}
+	}
+	for _, count := range converted {
+		if i, ok := index[count.Variant]; ok {
+			results.Variants[i].Converted = count.Units
+		}
+	}
+	for _, count := range metrics {
+		if i, ok := index[count.Variant]; ok {
+			results.Variants[i].Metrics[count.Metric] = count.Units
+		}
+	}
+
+	control := &results.Variants[0]
+	control.ConversionRate = conversionRate(control.Converted, control.Exposed)
+	for i := 1; i < len(results.Variants); i++ {
+		variant := &results.Variants[i]
+		variant.ConversionRate = conversionRate(variant.Converted, variant.Exposed)
+		if control.ConversionRate > 0 {
+			uplift := round4((variant.ConversionRate - control.ConversionRate) / control.ConversionRate)
+			variant.Uplift = &uplift
+		}
+		if pValue, ok := twoProportionPValue(control.Converted, control.Exposed, variant.Converted, variant.Exposed); ok {
+			variant.PValue = &pValue
+		}
+	}
+	writeJSON(w, r, http.StatusOK, results)
+}
+
+// conversionRate is converted / exposed, or 0 before anyone is exposed
+func conversionRate(converted, exposed int64) float64 {
+	if exposed == 0 {
+		return 0
+	}
+	return round4(float64(converted) / float64(exposed))
+}
+
+// twoProportionPValue is the two-sided p-value of a pooled two-proportion z-test of whether
+// the conversion rates c1/n1 and c2/n2 differ; false when there is nothing to compare yet
+func twoProportionPValue(c1, n1, c2, n2 int64) (float64, bool) {
+	if n1 == 0 || n2 == 0 {
+		return 0, false
+	}
+	pooled := float64(c1+c2) / float64(n1+n2)
+	se := math.Sqrt(pooled * (1 - pooled) * (1/float64(n1) + 1/float64(n2)))
+	if se == 0 {
+		return 0, false
+	}
+	z := (float64(c2)/float64(n2) - float64(c1)/float64(n1)) / se
+	return math.Erfc(math.Abs(z) / math.Sqrt2), true
+}
+
+// round4 rounds to four decimal places, which is as precise as the results are worth
+func round4(x float64) float64 {
+	return math.Round(x*10000) / 10000
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+)
+
+// The zones' feedback widget posts a rating, with an optional message, to POST /api/feedback.
+// Product triages it from the admin zone: new feedback is triaged (kept for the roadmap) or
+// closed, and the whole queue, or any ?filter= of it, can be pulled into a spreadsheet as CSV
+
+// feedbackTransitions are the status changes allowed, from each status to the next ones;
+// feedback never goes back to new, but closed feedback can be reopened as triaged
+var feedbackTransitions = map[string][]string{"new": {"triaged", "closed"}, "triaged": {"closed"}, "closed": {"triaged"}}
+
+// feedbackFilterFields are the feedback fields ?filter= and ?orderby= accept
+var feedbackFilterFields = filterFields{
+	"id":        {Column: "id", Kind: filterNumber},
+	"rating":    {Column: "rating", Kind: filterNumber},
+	"status":    {Column: "status", Kind: filterString},
+	"zone":      {Column: "zone", Kind: filterString},
+	"page":      {Column: "page", Kind: filterString},
+	"userId":    {Column: "user_id", Kind: filterString},
+	"createdAt": {Column: "created_at", Kind: filterTime},
+}
+
+// feedbackCSVColumns are the columns of GET /api/feedback as CSV, in default order
+var feedbackCSVColumns = []csvColumn[models.Feedback]{
+	{"id", func(f models.Feedback) string { return strconv.FormatUint(uint64(f.ID), 10) }},
+	{"rating", func(f models.Feedback) string { return strconv.Itoa(f.Rating) }},
+	{"message", func(f models.Feedback) string { return f.Message }},
+	{"page", func(f models.Feedback) string { return f.Page }},
+	{"zone", func(f models.Feedback) string { return f.Zone }},
+	{"userId", func(f models.Feedback) string { return f.UserID }},
+	{"status", func(f models.Feedback) string { return f.Status }},
+	{"note", func(f models.Feedback) string { return f.Note }},
+	{"createdAt", func(f models.Feedback) string { return csvTime(f.CreatedAt) }},
+	{"updatedAt", func(f models.Feedback) string { return csvTime(f.UpdatedAt) }},
+}
+
+// createFeedbackHandler responds to POST /api/feedback
+func (s *Server) createFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateFeedbackRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	if _, ok := s.findZone(req.Zone); !ok {
+		writeValidationErrors(w, r, []models.FieldError{{Field: "zone", Message: "must be a zone (" + s.zoneNames() + ")"}})
+		return
+	}
+
+	feedback := models.Feedback{
+		Rating: req.Rating, Message: req.Message, Page: req.Page, Zone: req.Zone, UserID: req.UserID, Status: "new",
+	}
+	if err := s.db.WithContext(r.Context()).Create(&feedback).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to save feedback: %v", err))
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s/api/feedback/%d", s.config.Server.BasePath, feedback.ID))
+	writeJSON(w, r, http.StatusCreated, feedback)
+}
+
+// listFeedbackHandler responds to GET /api/feedback
+// Newest first, narrowed with the shared ?filter= and ?orderby= parameters, e.g.
+// ?filter=status eq "new" and rating le 2. CSV exports (Accept: text/csv) stream every match
+func (s *Server) listFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	listQuery, err := parseListQuery(r, feedbackFilterFields)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid query: "+err.Error())
+		return
+	}
+	query := s.db.WithContext(r.Context()).Model(&models.Feedback{})
+
+	if wantsCSV(r) {
+		rows, err := openGormCursor[models.Feedback](listQuery.stream(query, "id DESC"))
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+			return
+		}
+		streamCSV(w, r, "feedback.csv", rows, feedbackCSVColumns)
+		return
+	}
+
+	var feedback []models.Feedback
+	if err := listQuery.apply(query, "id DESC").Find(&feedback).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	setNextPageLink(w, r, listQuery.page, len(feedback))
+	writeJSON(w, r, http.StatusOK, feedback)
+}
+
+// getFeedbackHandler responds to GET /api/feedback/{id}
+func (s *Server) getFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	if feedback, ok := findByID[models.Feedback](w, r, s.db, "Feedback"); ok {
+		writeJSON(w, r, http.StatusOK, feedback)
+	}
+}
+
+// updateFeedbackHandler responds to PATCH /api/feedback/{id}
+// Status changes other than those in feedbackTransitions are a 409
+func (s *Server) updateFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateFeedbackRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	feedback, ok := findByID[models.Feedback](w, r, s.db, "Feedback")
+	if !ok {
+		return
+	}
+
+	previousStatus := feedback.Status
+	if req.Status != nil && *req.Status != feedback.Status {
+		if !slices.Contains(feedbackTransitions[feedback.Status], *req.Status) {
+			writeError(w, r, http.StatusConflict, fmt.Sprintf("Feedback %d can't go from %s to %s", feedback.ID, feedback.Status, *req.Status))
+			return
+		}
+		feedback.Status = *req.Status
+	}
+	if req.Note != nil {
+		feedback.Note = *req.Note
+	}
+	if err := s.db.WithContext(r.Context()).Save(&feedback).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to update feedback: %v", err))
+		return
+	}
+	if feedback.Status != previousStatus {
+		log.Printf("Feedback %d is %s", feedback.ID, feedback.Status)
+	}
+	writeJSON(w, r, http.StatusOK, feedback)
+}
+
+// deleteFeedbackHandler responds to DELETE /api/feedback/{id}
+func (s *Server) deleteFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	feedback, ok := findByID[models.Feedback](w, r, s.db, "Feedback")
+	if !ok {
+		return
+	}
+	if err := s.db.WithContext(r.Context()).Delete(&feedback).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "Feedback deleted successfully"})
+}
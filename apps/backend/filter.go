@@ -0,0 +1,474 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Shared query language for list endpoints
+//
+//	?filter=enabled eq true and (name co "dash" or key sw "beta_")
+//	?orderby=updatedAt desc,name
+//
+// Filters are translated into parameterized SQL: field names are looked up in a
+// per-resource allowlist and values are always passed as bind arguments, so
+// nothing from the query string is ever spliced into the SQL text. Columns are
+// arguments too (clause.Column), so GORM quotes them for whichever database runs the query
+
+// Filter limits so a single request can't build an arbitrarily large query
+const (
+	maxFilterLength = 1000
+	maxFilterDepth  = 10
+)
+
+// filterKind is the type of a filterable field, which decides the allowed operators and values
+type filterKind int
+
+const (
+	filterString filterKind = iota
+	filterNumber
+	filterBool
+	filterTime
+)
+
+// filterField maps a public (JSON) field name to its database column
+type filterField struct {
+	Column string
+	Kind   filterKind
+}
+
+// filterFields is the allowlist of fields a list endpoint can filter and sort on
+type filterFields map[string]filterField
+
+// Filterable fields for each list endpoint, keyed by the JSON field name
+var (
+	userFilterFields = filterFields{
+		"id":        {Column: "id", Kind: filterNumber},
+		"email":     {Column: "email", Kind: filterString},
+		"name":      {Column: "name", Kind: filterString},
+		"createdAt": {Column: "created_at", Kind: filterTime},
+		"updatedAt": {Column: "updated_at", Kind: filterTime},
+	}
+	flagFilterFields = filterFields{
+		"id":          {Column: "id", Kind: filterNumber},
+		"key":         {Column: "key", Kind: filterString},
+		"name":        {Column: "name", Kind: filterString},
+		"description": {Column: "description", Kind: filterString},
+		"enabled":     {Column: "enabled", Kind: filterBool},
+		"createdAt":   {Column: "created_at", Kind: filterTime},
+		"updatedAt":   {Column: "updated_at", Kind: filterTime},
+	}
+	deploymentFilterFields = filterFields{
+		"id":           {Column: "id", Kind: filterNumber},
+		"zone":         {Column: "zone", Kind: filterString},
+		"source":       {Column: "source", Kind: filterString},
+		"eventType":    {Column: "event_type", Kind: filterString},
+		"action":       {Column: "action", Kind: filterString},
+		"environment":  {Column: "environment", Kind: filterString},
+		"ref":          {Column: "ref", Kind: filterString},
+		"sha":          {Column: "sha", Kind: filterString},
+		"status":       {Column: "status", Kind: filterString},
+		"actor":        {Column: "actor", Kind: filterString},
+		"healthStatus": {Column: "health_status", Kind: filterString},
+		"createdAt":    {Column: "created_at", Kind: filterTime},
+	}
+)
+
+// listQuery is a parsed ?filter=, ?orderby=, and ?page=&pageSize= ready to be applied to a GORM query
+type listQuery struct {
+	where string                 // SQL condition with ? placeholders, "" when there is no filter
+	args  []interface{}          // Bind arguments for where
+	order []clause.OrderByColumn // ORDER BY columns, none when the client didn't ask for an order
+	page  pageRequest            // Requested page, already clamped to LIST_MAX_PAGE_SIZE
+}
+
+// parseListQuery reads ?filter= and ?orderby= from the request
+// Errors describe what's wrong with the expression and should be returned as 400 Bad Request
+func parseListQuery(r *http.Request, fields filterFields) (listQuery, error) {
+	var q listQuery
+
+	if filter := strings.TrimSpace(r.URL.Query().Get("filter")); filter != "" {
+		if len(filter) > maxFilterLength {
+			return q, fmt.Errorf("filter is longer than %d characters", maxFilterLength)
+		}
+		tokens, err := tokenizeFilter(filter)
+		if err != nil {
+			return q, err
+		}
+		p := &filterParser{tokens: tokens, fields: fields}
+		where, err := p.parseOr(0)
+		if err != nil {
+			return q, err
+		}
+		if tok := p.peek(); tok.kind != tokenEOF {
+			return q, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+		}
+		q.where, q.args = where, p.args
+	}
+
+	if orderBy := strings.TrimSpace(r.URL.Query().Get("orderby")); orderBy != "" {
+		order, err := parseOrderBy(orderBy, fields)
+		if err != nil {
+			return q, err
+		}
+		q.order = order
+	}
+
+	q.page = parsePageRequest(r)
+	return q, nil
+}
+
+// filter adds the WHERE condition to tx (use this for counts)
+func (q listQuery) filter(tx *gorm.DB) *gorm.DB {
+	if q.where == "" {
+		return tx
+	}
+	return tx.Where(q.where, q.args...)
+}
+
+// apply adds the WHERE condition, ORDER BY, and the requested page to tx
+// defaultOrder is used when the client didn't send ?orderby= ("" keeps the database order)
+// Every list query goes through here, so no response can hold more than LIST_MAX_PAGE_SIZE rows
+func (q listQuery) apply(tx *gorm.DB, defaultOrder string) *gorm.DB {
+	return q.stream(tx, defaultOrder).Offset(q.page.Offset()).Limit(q.page.PageSize)
+}
+
+// stream adds the WHERE condition and ORDER BY without a page limit
+// Only for NDJSON and CSV exports, which read rows from a cursor instead of loading them
+// The primary key is always the final tie-breaker so pages are stable
+func (q listQuery) stream(tx *gorm.DB, defaultOrder string) *gorm.DB {
+	tx = q.filter(tx)
+	switch {
+	case len(q.order) > 0:
+		return tx.Order(clause.OrderBy{Columns: append(slices.Clip(q.order), clause.OrderByColumn{Column: clause.Column{Name: "id"}})})
+	case defaultOrder != "":
+		return tx.Order(defaultOrder)
+	default:
+		return tx
+	}
+}
+
+// parseOrderBy converts "updatedAt desc,name" into the columns updated_at DESC, name ASC
+func parseOrderBy(orderBy string, fields filterFields) ([]clause.OrderByColumn, error) {
+	var columns []clause.OrderByColumn
+	for _, part := range strings.Split(orderBy, ",") {
+		words := strings.Fields(part)
+		if len(words) == 0 || len(words) > 2 {
+			return nil, fmt.Errorf("invalid orderby %q: expected \"field [asc|desc]\"", strings.TrimSpace(part))
+		}
+		field, ok := fields[words[0]]
+		if !ok {
+			return nil, fmt.Errorf("cannot order by unknown field %q", words[0])
+		}
+		column := clause.OrderByColumn{Column: clause.Column{Name: field.Column}}
+		if len(words) == 2 {
+			switch strings.ToLower(words[1]) {
+			case "asc":
+			case "desc":
+				column.Desc = true
+			default:
+				return nil, fmt.Errorf("invalid order direction %q: expected asc or desc", words[1])
+			}
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// Filter tokens
+
+type tokenKind int
+
+const (
+	tokenEOF    tokenKind = iota
+	tokenWord             // Field names, operators, and keywords (and, or, not, true, false, null)
+	tokenString           // "quoted string"
+	tokenNumber           // 42, -1.5
+	tokenLParen
+	tokenRParen
+)
+
+type filterToken struct {
+	kind tokenKind
+	text string // Raw text, or the unescaped value for strings
+	pos  int    // Byte offset in the filter, for error messages
+}
+
+// tokenizeFilter splits a filter expression into tokens
+func tokenizeFilter(input string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(input); {
+		c := rune(input[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, filterToken{kind: tokenLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, filterToken{kind: tokenRParen, text: ")", pos: i})
+			i++
+		case c == '"':
+			// Strings support \" and \\ escapes
+			start := i
+			var value strings.Builder
+			i++
+			for {
+				if i >= len(input) {
+					return nil, fmt.Errorf("unterminated string starting at position %d", start)
+				}
+				if input[i] == '\\' && i+1 < len(input) {
+					value.WriteByte(input[i+1])
+					i += 2
+					continue
+				}
+				if input[i] == '"' {
+					i++
+					break
+				}
+				value.WriteByte(input[i])
+				i++
+			}
+			tokens = append(tokens, filterToken{kind: tokenString, text: value.String(), pos: start})
+		case c == '-' || unicode.IsDigit(c):
+			start := i
+			i++
+			for i < len(input) && (unicode.IsDigit(rune(input[i])) || input[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, filterToken{kind: tokenNumber, text: input[start:i], pos: start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(input) && (unicode.IsLetter(rune(input[i])) || unicode.IsDigit(rune(input[i])) || input[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, filterToken{kind: tokenWord, text: input[start:i], pos: start})
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+		}
+	}
+	return append(tokens, filterToken{kind: tokenEOF, text: "end of filter", pos: len(input)}), nil
+}
+
+// filterParser is a recursive descent parser that emits SQL as it goes
+//
+//	or         = and { "or" and }
+//	and        = unary { "and" unary }
+//	unary      = "not" unary | "(" or ")" | comparison
+//	comparison = field operator value
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+	fields filterFields
+	args   []interface{}
+}
+
+func (p *filterParser) peek() filterToken { return p.tokens[p.pos] }
+
+func (p *filterParser) next() filterToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// isKeyword reports whether the next token is the given keyword (case-insensitive)
+func (p *filterParser) isKeyword(keyword string) bool {
+	tok := p.peek()
+	return tok.kind == tokenWord && strings.EqualFold(tok.text, keyword)
+}
+
+func (p *filterParser) parseOr(depth int) (string, error) {
+	left, err := p.parseAnd(depth)
+	if err != nil {
+		return "", err
+	}
+	for p.isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd(depth)
+		if err != nil {
+			return "", err
+		}
+		left = left + " OR " + right
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd(depth int) (string, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return "", err
+	}
+	for p.isKeyword("and") {
+		p.next()
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return "", err
+		}
+		left = left + " AND " + right
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary(depth int) (string, error) {
+	if depth > maxFilterDepth {
+		return "", fmt.Errorf("filter is nested more than %d levels deep", maxFilterDepth)
+	}
+
+	if p.isKeyword("not") {
+		p.next()
+		inner, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return "", err
+		}
+		return "NOT " + inner, nil
+	}
+
+	if p.peek().kind == tokenLParen {
+		p.next()
+		inner, err := p.parseOr(depth + 1)
+		if err != nil {
+			return "", err
+		}
+		if tok := p.next(); tok.kind != tokenRParen {
+			return "", fmt.Errorf("expected \")\" at position %d, got %q", tok.pos, tok.text)
+		}
+		return "(" + inner + ")", nil
+	}
+
+	return p.parseComparison()
+}
+
+// Comparison operators and their SQL equivalents
+var filterOperators = map[string]string{
+	"eq": "=",
+	"ne": "<>",
+	"gt": ">",
+	"ge": ">=",
+	"lt": "<",
+	"le": "<=",
+	"co": "LIKE", // contains (case-insensitive)
+	"sw": "LIKE", // starts with (case-insensitive)
+	"ew": "LIKE", // ends with (case-insensitive)
+}
+
+func (p *filterParser) parseComparison() (string, error) {
+	fieldTok := p.next()
+	if fieldTok.kind != tokenWord {
+		return "", fmt.Errorf("expected a field name at position %d, got %q", fieldTok.pos, fieldTok.text)
+	}
+	field, ok := p.fields[fieldTok.text]
+	if !ok {
+		return "", fmt.Errorf("cannot filter on unknown field %q", fieldTok.text)
+	}
+
+	opTok := p.next()
+	op := strings.ToLower(opTok.text)
+	sqlOp, ok := filterOperators[op]
+	if opTok.kind != tokenWord || !ok {
+		return "", fmt.Errorf("expected an operator (eq, ne, gt, ge, lt, le, co, sw, ew) after %q, got %q", fieldTok.text, opTok.text)
+	}
+
+	valueTok := p.next()
+
+	// "null" compares with IS NULL / IS NOT NULL
+	if valueTok.kind == tokenWord && strings.EqualFold(valueTok.text, "null") {
+		switch op {
+		case "eq":
+			p.args = append(p.args, clause.Column{Name: field.Column})
+			return "? IS NULL", nil
+		case "ne":
+			p.args = append(p.args, clause.Column{Name: field.Column})
+			return "? IS NOT NULL", nil
+		default:
+			return "", fmt.Errorf("null can only be compared with eq or ne")
+		}
+	}
+
+	value, err := filterValue(fieldTok.text, field.Kind, valueTok)
+	if err != nil {
+		return "", err
+	}
+
+	switch op {
+	case "co", "sw", "ew":
+		text, isString := value.(string)
+		if field.Kind != filterString || !isString {
+			return "", fmt.Errorf("operator %s only works on text fields", op)
+		}
+		pattern := escapeLike(strings.ToLower(text))
+		switch op {
+		case "co":
+			pattern = "%" + pattern + "%"
+		case "sw":
+			pattern = pattern + "%"
+		case "ew":
+			pattern = "%" + pattern
+		}
+		p.args = append(p.args, clause.Column{Name: field.Column}, pattern, likeEscapeClause{})
+		return "LOWER(?) " + sqlOp + " ? ?", nil
+	case "gt", "ge", "lt", "le":
+		if field.Kind == filterBool {
+			return "", fmt.Errorf("operator %s doesn't work on true/false field %q", op, fieldTok.text)
+		}
+	}
+
+	p.args = append(p.args, clause.Column{Name: field.Column}, value)
+	return "? " + sqlOp + " ?", nil
+}
+
+// filterValue converts a literal token into a Go value of the field's kind
+func filterValue(name string, kind filterKind, tok filterToken) (interface{}, error) {
+	switch kind {
+	case filterString:
+		if tok.kind != tokenString {
+			return nil, fmt.Errorf("%q expects a quoted string, got %q", name, tok.text)
+		}
+		return tok.text, nil
+	case filterNumber:
+		if tok.kind != tokenNumber {
+			return nil, fmt.Errorf("%q expects a number, got %q", name, tok.text)
+		}
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", tok.text)
+		}
+		return n, nil
+	case filterBool:
+		if tok.kind == tokenWord {
+			switch strings.ToLower(tok.text) {
+			case "true":
+				return true, nil
+			case "false":
+				return false, nil
+			}
+		}
+		return nil, fmt.Errorf("%q expects true or false, got %q", name, tok.text)
+	case filterTime:
+		// Accepts full RFC 3339 timestamps ("2024-05-01T12:00:00Z") or plain dates ("2024-05-01")
+		if tok.kind == tokenString {
+			if t, err := time.Parse(time.RFC3339, tok.text); err == nil {
+				return t, nil
+			}
+			if t, err := time.Parse("2006-01-02", tok.text); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("%q expects a quoted RFC 3339 timestamp or date, got %q", name, tok.text)
+	}
+	return nil, fmt.Errorf("%q can't be filtered", name)
+}
+
+// escapeLike escapes LIKE wildcards so user input matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
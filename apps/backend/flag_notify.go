@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"gorm.io/plugin/dbresolver"
+)
+
+// flagNotifyChannel is the Postgres NOTIFY channel for feature flag changes
+const flagNotifyChannel = "feature_flag_changes"
+
+// replicaID identifies this backend process in notifications, so it can ignore its own
+var replicaID = uuid.NewString()
+
+// flagNotification is the payload sent on flagNotifyChannel
+type flagNotification struct {
+	Key    string `json:"key"`
+	Action string `json:"action"` // "created", "updated", or "deleted"
+	Origin string `json:"origin"` // replicaID of the sender
+}
+
+// notifyFlagChange tells the other backend replicas that a flag changed
+// It is the change feed's broadcast hook, so every flag write path sends it
+func (s *Server) notifyFlagChange(key, action string) {
+	payload, _ := json.Marshal(flagNotification{Key: key, Action: action, Origin: replicaID})
+
+	// pg_notify has to run on the primary: replicas are read-only and don't share notifications
+	if err := s.db.Clauses(dbresolver.Write).Exec("SELECT pg_notify(?, ?)", flagNotifyChannel, string(payload)).Error; err != nil {
+		// Other replicas stay stale until their cache entry is reloaded or the bootstrap snapshot refreshes
+		log.Printf("Failed to notify replicas of flag %s change: %v", key, err)
+	}
+}
+
+// listenForFlagChanges keeps a dedicated connection LISTENing on flagNotifyChannel
+// and applies changes made by other replicas to the local cache and change feed
+// It reconnects with backoff if the connection drops and runs until the process exits
+func (s *Server) listenForFlagChanges(dsn string) {
+	backoff := time.Second
+	const maxBackoff = 30 * time.Second
+
+	for {
+		err := s.listenOnce(dsn, func() { backoff = time.Second })
+		log.Printf("Flag change listener disconnected, reconnecting in %s: %v", backoff, err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// listenOnce connects, LISTENs, and handles notifications until the connection fails
+// connected is called once LISTEN succeeds
+func (s *Server) listenOnce(dsn string, connected func()) error {
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	if _, err := conn.Exec(ctx, "LISTEN "+flagNotifyChannel); err != nil {
+		return err
+	}
+	connected()
+
+	// Notifications sent while disconnected are lost, so drop everything cached
+	// and let the next reads reload from the database
+	s.flagCache.Purge()
+	log.Printf("Listening for flag changes from other replicas on %q", flagNotifyChannel)
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var change flagNotification
+		if err := json.Unmarshal([]byte(notification.Payload), &change); err != nil {
+			log.Printf("Ignoring malformed flag notification %q: %v", notification.Payload, err)
+			continue
+		}
+		if change.Origin == replicaID {
+			continue
+		}
+		s.live.logLevel.debugf("flag %s %s on replica %s", change.Key, change.Action, change.Origin)
+
+		// The next read loads the new value; the change feed wakes long-polling
+		// clients and the bootstrap snapshot on this replica too
+		s.flagCache.Delete(change.Key)
+		s.changes.publish("flag", change.Key, change.Action)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"github.com/nextjs-microfrontend/backend/internal/tenant"
+)
+
+// flagSnapshot is an immutable, already-encoded FlagBootstrap response
+type flagSnapshot struct {
+	body []byte
+	etag string
+}
+
+// flagSnapshotStore serves GET /api/bootstrap from a snapshot that is rebuilt
+// whenever a flag changes and swapped in atomically, so requests never query
+// the database or encode JSON
+// Each project has its own snapshot, built the first time the project asks for one
+type flagSnapshotStore struct {
+	current sync.Map // Project ID -> *atomic.Pointer[flagSnapshot]
+	load    func(ctx context.Context) ([]models.FeatureFlag, error)
+	refresh time.Duration // FLAG_SNAPSHOT_REFRESH
+	mu      sync.Mutex    // Serializes rebuilds so an older load can't replace a newer one
+}
+
+// newFlagSnapshotStore creates a store that reads flags with load, and every one of them again
+// every refresh. Call watch to keep it up to date
+func newFlagSnapshotStore(load func(ctx context.Context) ([]models.FeatureFlag, error), refresh time.Duration) *flagSnapshotStore {
+	return &flagSnapshotStore{load: load, refresh: refresh}
+}
+
+// snapshot returns where the snapshot of the project with projectID is kept
+func (s *flagSnapshotStore) snapshot(projectID uint) *atomic.Pointer[flagSnapshot] {
+	current, _ := s.current.LoadOrStore(projectID, &atomic.Pointer[flagSnapshot]{})
+	return current.(*atomic.Pointer[flagSnapshot])
+}
+
+// rebuild loads every flag of ctx's project, encodes the bootstrap response, and swaps it in
+func (s *flagSnapshotStore) rebuild(ctx context.Context) (*flagSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	flags, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	bootstrap := models.FlagBootstrap{
+		Flags:       make(map[string]bool, len(flags)),
+		GeneratedAt: time.Now(),
+	}
+	for _, flag := range flags {
+		bootstrap.Flags[flag.Key] = flag.Enabled
+	}
+
+	body, err := json.Marshal(bootstrap)
+	if err != nil {
+		return nil, err
+	}
+
+	// The ETag covers only the flags, so a rebuild with nothing changed keeps it stable
+	flagsJSON, _ := json.Marshal(bootstrap.Flags)
+	sum := sha256.Sum256(flagsJSON)
+
+	snapshot := &flagSnapshot{body: body, etag: `"` + hex.EncodeToString(sum[:16]) + `"`}
+	current := s.snapshot(tenant.FromContext(ctx).ID)
+	if previous := current.Load(); previous != nil && previous.etag == snapshot.etag {
+		return previous, nil
+	}
+	current.Store(snapshot)
+	return snapshot, nil
+}
+
+// watch rebuilds a project's snapshot after every change to its flags in feed, and every
+// snapshot every FLAG_SNAPSHOT_REFRESH regardless; it runs until the process exits
+func (s *flagSnapshotStore) watch(feed *changeFeed) {
+	cursor := feed.latest()
+	ticker := time.NewTicker(s.refresh)
+	defer ticker.Stop()
+
+	// Build the default project's snapshot at startup so the first request doesn't wait for it
+	stale := map[uint]bool{tenant.DefaultProjectID: true}
+	all := func() {
+		s.current.Range(func(projectID, _ any) bool {
+			stale[projectID.(uint)] = true
+			return true
+		})
+	}
+	for {
+		events, next, reset, wait := feed.since(cursor)
+		cursor = next
+
+		if reset {
+			all()
+		}
+		for _, event := range events {
+			if event.Type != "flag" {
+				continue
+			}
+			// Projects without a snapshot yet get one on their first request
+			if projectID, _ := tenant.SplitFlagKey(event.Key); projectID == tenant.DefaultProjectID || s.has(projectID) {
+				stale[projectID] = true
+			}
+		}
+
+		if len(stale) == 0 {
+			select {
+			case <-wait:
+				continue
+			case <-ticker.C:
+				all()
+			}
+		}
+
+		for projectID := range stale {
+			ctx := tenant.NewContext(context.Background(), tenant.Project{ID: projectID})
+			if _, err := s.rebuild(ctx); err != nil {
+				// Keep serving the previous snapshot; the next change or tick tries again
+				log.Printf("Failed to rebuild flag snapshot of project %d: %v", projectID, err)
+			}
+		}
+		clear(stale)
+	}
+}
+
+// has reports whether the project with projectID has a snapshot
+func (s *flagSnapshotStore) has(projectID uint) bool {
+	_, ok := s.current.Load(projectID)
+	return ok
+}
+
+// handler responds to GET /api/bootstrap
+// The body is the same in every API version (no v2 envelope), like the binary formats
+func (s *flagSnapshotStore) handler(w http.ResponseWriter, r *http.Request) {
+	snapshot := s.snapshot(tenant.FromContext(r.Context()).ID).Load()
+	if snapshot == nil {
+		// Only until the first snapshot exists
+		var err error
+		if snapshot, err = s.rebuild(r.Context()); err != nil {
+			writeError(w, r, http.StatusInternalServerError, "Failed to load feature flags")
+			return
+		}
+	}
+
+	w.Header().Set("ETag", snapshot.etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if notModified(r, snapshot.etag, "") {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(snapshot.body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(snapshot.body)
+}
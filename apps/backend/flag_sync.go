@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+// POST /api/feature-flags/apply takes the flags a project should have, as a JSON or YAML list
+// or NDJSON, and makes its flags match: new keys are created and differing flags updated, all in
+// one transaction. Flags the list doesn't have are only deleted with ?prune=true, so a file that
+// lost some lines doesn't take the flags with it. The NDJSON export (GET /api/feature-flags with
+// Accept: application/x-ndjson) has every flag, not one page, so the flags can live in a Git
+// repository and CI applies the file on merge, with ?dryRun=true on pull requests to show what
+// the merge will change
+
+// Largest desired state POST /api/feature-flags/apply reads
+const maxFlagStateSize = 10 << 20
+
+// readFlagState decodes and validates the desired state in the body of r
+// JSON unless the Content-Type is YAML or NDJSON; fields other than a create request's, such as the
+// export's id and timestamps, are ignored
+func readFlagState(w http.ResponseWriter, r *http.Request) ([]models.CreateFeatureFlagRequest, []models.FieldError, error) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxFlagStateSize))
+	if err != nil {
+		return nil, nil, err
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/yaml" || mediaType == "application/x-yaml" || mediaType == "text/yaml" {
+		// Converted to JSON first, as seed documents are, so both formats share the field names
+		var value interface{}
+		if err := yaml.Unmarshal(data, &value); err != nil {
+			return nil, nil, err
+		}
+		if data, err = json.Marshal(value); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var flags []models.CreateFeatureFlagRequest
+	if mediaType == ndjsonContentType {
+		for decoder := json.NewDecoder(bytes.NewReader(data)); decoder.More(); {
+			var flag models.CreateFeatureFlagRequest
+			if err := decoder.Decode(&flag); err != nil {
+				return nil, nil, err
+			}
+			flags = append(flags, flag)
+		}
+	} else if err := json.NewDecoder(bytes.NewReader(data)).Decode(&flags); err != nil {
+		return nil, nil, err
+	}
+	// An empty list would delete every flag with ?prune=true; it's far more likely a broken export
+	if len(flags) == 0 {
+		return nil, nil, errors.New("the desired state must list at least one flag")
+	}
+
+	// A list naming the same key twice doesn't say which of the two is wanted
+	var fieldErrors []models.FieldError
+	keys := map[string]int{}
+	for i, f := range flags {
+		for _, fe := range validateStruct(f) {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: fmt.Sprintf("[%d].%s", i, fe.Field), Message: fe.Message})
+		}
+		if first, ok := keys[f.Key]; ok {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: fmt.Sprintf("[%d].key", i), Message: fmt.Sprintf("duplicates [%d]", first)})
+		}
+		keys[f.Key] = i
+	}
+	return flags, fieldErrors, nil
+}
+
+// applyFeatureFlagsHandler responds to POST /api/feature-flags/apply?dryRun=&prune=
+// Makes the project's flags match the list in the body and returns the changes; with
+// ?dryRun=true it only returns them, and only ?prune=true deletes flags the list doesn't have
+func (a *restAPI) applyFeatureFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	flags, fieldErrors, err := readFlagState(w, r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid desired state: "+err.Error())
+		return
+	}
+	if len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+
+	query := r.URL.Query()
+	response, err := a.flags.apply(r.Context(), flags, query.Get("dryRun") == "true", query.Get("prune") == "true")
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to apply feature flags: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, response)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Bulk fake data for load testing pagination and caching: `backend seed --generate
+// users=10000 flags=200`, or POST /api/seed/generate when SEED_GENERATE_ENABLED=true
+//
+// The same random seed always produces the same records in the same order, so running
+// again with a bigger count adds only the new ones (existing emails and keys are skipped)
+
+// generateSpec is how many records of each kind to generate
+type generateSpec struct {
+	Users int
+	Flags int
+}
+
+// Most records one run may generate, whatever is asked for
+const (
+	maxGeneratedUsers = 1_000_000
+	maxGeneratedFlags = 100_000
+)
+
+// Records generated and inserted at a time, so memory stays flat however many are asked for
+const generateChunkSize = 5000
+
+// parseGenerateSpec reads "users=10000" and "flags=200" arguments; kinds left out generate nothing
+func parseGenerateSpec(args []string) (generateSpec, error) {
+	var spec generateSpec
+	if len(args) == 0 {
+		return spec, errors.New("nothing to generate: expected users=<count> and/or flags=<count>")
+	}
+	for _, arg := range args {
+		kind, value, ok := strings.Cut(arg, "=")
+		n, err := strconv.Atoi(value)
+		if !ok || err != nil || n < 0 {
+			return spec, fmt.Errorf("invalid %q: expected users=<count> or flags=<count>", arg)
+		}
+		switch kind {
+		case "users":
+			spec.Users = n
+		case "flags":
+			spec.Flags = n
+		default:
+			return spec, fmt.Errorf("unknown kind %q: expected users or flags", kind)
+		}
+	}
+	return spec, spec.check(maxGeneratedUsers, maxGeneratedFlags)
+}
+
+// check rejects specs over the given limits
+func (spec generateSpec) check(maxUsers, maxFlags int) error {
+	if spec.Users > maxUsers {
+		return fmt.Errorf("users=%d is over the limit of %d", spec.Users, maxUsers)
+	}
+	if spec.Flags > maxFlags {
+		return fmt.Errorf("flags=%d is over the limit of %d", spec.Flags, maxFlags)
+	}
+	return nil
+}
+
+// Reserved domains (RFC 2606), so generated addresses can never reach anyone
+var generatedEmailDomains = []string{"example.com", "example.org", "example.net"}
+
+// Characters not allowed in email local parts and flag keys
+var nonWordPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// generator produces fake users and flags, deterministically for a given seed
+// Each kind has its own faker, so the flags don't depend on how many users came first
+type generator struct {
+	userFaker, flagFaker *gofakeit.Faker
+	now                  time.Time
+	users                int // Users generated so far; numbers the emails so they are unique
+	flags                int // Same for flag keys
+}
+
+// randomSeedIfZero returns seed, or a random seed for 0, so the seed used can always be reported
+// Random seeds fit in 32 bits so they survive JSON clients that read numbers as float64
+func randomSeedIfZero(seed uint64) uint64 {
+	for seed == 0 {
+		seed = uint64(rand.Uint32())
+	}
+	return seed
+}
+
+func newGenerator(seed uint64, now time.Time) *generator {
+	return &generator{userFaker: gofakeit.New(seed), flagFaker: gofakeit.New(seed), now: now}
+}
+
+// slug lowercases s and joins its words with sep
+func slug(s, sep string) string {
+	return strings.Trim(nonWordPattern.ReplaceAllString(strings.ToLower(s), sep), sep)
+}
+
+// nextUsers returns the next n users, created at random times over the last 90 days
+func (g *generator) nextUsers(n int) []models.User {
+	users := make([]models.User, n)
+	for i := range users {
+		g.users++
+		first, last := g.userFaker.FirstName(), g.userFaker.LastName()
+		created := g.userFaker.DateRange(g.now.AddDate(0, 0, -90), g.now)
+		users[i] = models.User{
+			Email:     fmt.Sprintf("%s.%s.%d@%s", slug(first, "."), slug(last, "."), g.users, g.userFaker.RandomString(generatedEmailDomains)),
+			Name:      first + " " + last,
+			CreatedAt: created,
+			UpdatedAt: created,
+		}
+	}
+	return users
+}
+
+// nextFlags returns the next n feature flags, about a third of them enabled
+func (g *generator) nextFlags(n int) []models.FeatureFlag {
+	flags := make([]models.FeatureFlag, n)
+	for i := range flags {
+		g.flags++
+		adjective, noun := g.flagFaker.HackerAdjective(), g.flagFaker.HackerNoun()
+		created := g.flagFaker.DateRange(g.now.AddDate(0, 0, -180), g.now)
+		flags[i] = models.FeatureFlag{
+			Key:         fmt.Sprintf("%s_%s_%d", slug(adjective, "_"), slug(noun, "_"), g.flags),
+			Name:        strings.ToUpper(adjective[:1]) + adjective[1:] + " " + noun,
+			Description: g.flagFaker.Sentence(8),
+			Enabled:     g.flagFaker.IntRange(1, 3) == 1,
+			CreatedAt:   created,
+			UpdatedAt:   created,
+		}
+	}
+	return flags
+}
+
+// generateData inserts spec's fake records (see seedDatabase), generateChunkSize at a time
+func generateData(ctx context.Context, database *gorm.DB, spec generateSpec, seed uint64) (users, flags models.SeedCounts, err error) {
+	g := newGenerator(seed, time.Now())
+	users.Total, flags.Total = spec.Users, spec.Flags
+
+	for done := 0; done < spec.Users; done += generateChunkSize {
+		batch := g.nextUsers(min(generateChunkSize, spec.Users-done))
+		created, _, err := seedDatabase(ctx, database, batch, nil)
+		users.Created += created
+		if err != nil {
+			return users, flags, err
+		}
+	}
+	for done := 0; done < spec.Flags; done += generateChunkSize {
+		batch := g.nextFlags(min(generateChunkSize, spec.Flags-done))
+		_, created, err := seedDatabase(ctx, database, nil, batch)
+		flags.Created += created
+		if err != nil {
+			return users, flags, err
+		}
+	}
+	users.Unchanged = users.Total - users.Created
+	flags.Unchanged = flags.Total - flags.Created
+	return users, flags, nil
+}
+
+// generateHandler responds to POST /api/seed/generate?users=10000&flags=200[&seed=1]
+// Only registered with SEED_GENERATE_ENABLED=true; each count is capped by SEED_GENERATE_MAX
+func (s *Server) generateHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var args []string
+	for _, kind := range []string{"users", "flags"} {
+		if value := query.Get(kind); value != "" {
+			args = append(args, kind+"="+value)
+		}
+	}
+	spec, err := parseGenerateSpec(args)
+	if err == nil {
+		err = spec.check(s.config.Database.SeedGenerateMax, s.config.Database.SeedGenerateMax)
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	seed := uint64(1)
+	if value := query.Get("seed"); value != "" {
+		if seed, err = strconv.ParseUint(value, 10, 64); err != nil {
+			writeError(w, r, http.StatusBadRequest, "seed must be a non-negative integer")
+			return
+		}
+	}
+	seed = randomSeedIfZero(seed)
+
+	// Big runs take longer than HTTP_WRITE_TIMEOUT, so allow about a millisecond per record on top
+	extendWriteDeadline(w, requestConfig(r).Server.WriteTimeout+time.Duration(spec.Users+spec.Flags)*time.Millisecond)
+	users, flags, err := generateData(r.Context(), s.db, spec, seed)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to generate data: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, models.GenerateResponse{
+		Message:      "Fake data generated",
+		Seed:         seed,
+		Users:        users,
+		FeatureFlags: flags,
+	})
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"gorm.io/gorm/clause"
+)
+
+// maxWebhookBodySize limits how much of a webhook payload we read (GitHub caps payloads at 25MB)
+const maxWebhookBodySize = 5 << 20
+
+// githubWebhookPayload holds the fields we use from deployment, deployment_status,
+// and workflow_run events; everything else in the payload is ignored
+type githubWebhookPayload struct {
+	Action     string `json:"action"`
+	Deployment *struct {
+		Environment string `json:"environment"`
+		Ref         string `json:"ref"`
+		SHA         string `json:"sha"`
+		URL         string `json:"url"`
+	} `json:"deployment"`
+	DeploymentStatus *struct {
+		State     string `json:"state"`
+		TargetURL string `json:"target_url"`
+	} `json:"deployment_status"`
+	WorkflowRun *struct {
+		Name       string `json:"name"`
+		HeadBranch string `json:"head_branch"`
+		HeadSHA    string `json:"head_sha"`
+		Status     string `json:"status"`
+		Conclusion string `json:"conclusion"`
+		HTMLURL    string `json:"html_url"`
+	} `json:"workflow_run"`
+	Sender *struct {
+		Login string `json:"login"`
+	} `json:"sender"`
+}
+
+// githubWebhookHandler responds to POST /api/webhooks/github
+// It verifies the signature, records a deployment event for the affected zone,
+// and immediately re-checks that zone's health so the timeline shows the result
+func (s *Server) githubWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if s.config.GitHub.WebhookSecret == "" {
+		writeError(w, r, http.StatusServiceUnavailable, "GitHub webhook secret is not configured")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodySize))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+
+	// Reject anything not signed with our secret
+	if !validGitHubSignature(s.config.GitHub.WebhookSecret, body, r.Header.Get("X-Hub-Signature-256")) {
+		writeError(w, r, http.StatusUnauthorized, "Invalid webhook signature")
+		return
+	}
+
+	eventType := r.Header.Get("X-GitHub-Event")
+	switch eventType {
+	case "ping":
+		// Sent once when the webhook is created
+		writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "pong"})
+		return
+	case "deployment", "deployment_status", "workflow_run":
+		// Handled below
+	default:
+		writeJSON(w, r, http.StatusAccepted, models.MessageResponse{Message: "Event ignored: " + eventType})
+		return
+	}
+
+	var payload githubWebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid webhook payload")
+		return
+	}
+
+	event := deploymentEventFromGitHub(eventType, payload)
+	event.DeliveryID = r.Header.Get("X-GitHub-Delivery")
+	if event.DeliveryID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing X-GitHub-Delivery header")
+		return
+	}
+
+	// Figure out which zone this event is about from the environment or workflow name
+	zone, ok := s.zoneForDeployment(event.Environment)
+	if !ok {
+		writeJSON(w, r, http.StatusAccepted, models.MessageResponse{
+			Message: fmt.Sprintf("No zone matches environment %q; event ignored", event.Environment),
+		})
+		return
+	}
+	event.Zone = zone.Name
+
+	// GitHub may redeliver the same event, so duplicates (same delivery ID) are skipped
+	result := s.db.WithContext(r.Context()).Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "delivery_id"}}, DoNothing: true}).Create(&event)
+	if result.Error != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to record deployment event: %v", result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "Duplicate delivery ignored"})
+		return
+	}
+
+	s.activity.deployment(event)
+
+	// Re-check the zone's health in the background
+	// GitHub expects a response within 10 seconds and health checks can take up to 5
+	go s.recheckZoneAfterDeployment(zone, event.ID)
+
+	writeJSON(w, r, http.StatusAccepted, event)
+}
+
+// validGitHubSignature checks the X-Hub-Signature-256 header ("sha256=<hex HMAC>")
+// hmac.Equal compares in constant time so the signature can't be guessed byte by byte
+func validGitHubSignature(secret string, body []byte, header string) bool {
+	signature, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// deploymentEventFromGitHub converts a GitHub payload into a DeploymentEvent
+func deploymentEventFromGitHub(eventType string, payload githubWebhookPayload) models.DeploymentEvent {
+	event := models.DeploymentEvent{
+		Source:    "github",
+		EventType: eventType,
+		Action:    payload.Action,
+	}
+	if payload.Sender != nil {
+		event.Actor = payload.Sender.Login
+	}
+
+	if d := payload.Deployment; d != nil {
+		event.Environment = d.Environment
+		event.Ref = d.Ref
+		event.SHA = d.SHA
+		event.URL = d.URL
+		event.Status = "created"
+	}
+	if ds := payload.DeploymentStatus; ds != nil {
+		event.Status = ds.State
+		if ds.TargetURL != "" {
+			event.URL = ds.TargetURL
+		}
+	}
+	if run := payload.WorkflowRun; run != nil {
+		event.Environment = run.Name
+		event.Ref = run.HeadBranch
+		event.SHA = run.HeadSHA
+		event.URL = run.HTMLURL
+		event.Status = run.Status
+		if run.Conclusion != "" {
+			event.Status = run.Conclusion
+		}
+	}
+	return event
+}
+
+// zoneForDeployment finds the zone whose name appears in a deployment environment
+// or workflow name (e.g., "zone-admin" or "Deploy zone-admin")
+func (s *Server) zoneForDeployment(environment string) (zoneTarget, bool) {
+	environment = strings.ToLower(environment)
+	for _, zone := range s.zones {
+		if strings.Contains(environment, zone.Name) {
+			return zone, true
+		}
+	}
+	return zoneTarget{}, false
+}
+
+// recheckZoneAfterDeployment runs a health check and stores the result on the event
+func (s *Server) recheckZoneAfterDeployment(zone zoneTarget, eventID uint) {
+	status := s.checkZoneHealth(context.Background(), zone.Name, zone.URL)
+	s.changes.observeZoneStatus(status)
+	log.Printf("Post-deployment health check for %s: %s (%s)", zone.Name, status.Status, status.Message)
+
+	if err := s.db.Model(&models.DeploymentEvent{}).Where("id = ?", eventID).
+		Update("health_status", status.Status).Error; err != nil {
+		log.Printf("Failed to store post-deployment health for event %d: %v", eventID, err)
+	}
+}
+
+// getDeploymentEventsHandler responds to GET /api/deployments
+// Returns the most recent deployment events, optionally filtered by ?zone=
+// or the shared ?filter= and ?orderby= parameters (see filter.go)
+func (s *Server) getDeploymentEventsHandler(w http.ResponseWriter, r *http.Request) {
+	listQuery, err := parseListQuery(r, deploymentFilterFields)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid query: "+err.Error())
+		return
+	}
+
+	query := s.db.WithContext(r.Context()).Model(&models.DeploymentEvent{})
+	if zone := r.URL.Query().Get("zone"); zone != "" {
+		query = query.Where("zone = ?", zone)
+	}
+
+	// CSV exports stream every matching event instead of the latest 100 (Accept: text/csv)
+	if wantsCSV(r) {
+		rows, err := openGormCursor[models.DeploymentEvent](listQuery.stream(query, "created_at DESC"))
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+			return
+		}
+		streamCSV(w, r, "deployments.csv", rows, deploymentCSVColumns)
+		return
+	}
+
+	// The timeline shows the latest 100 events unless a page size is asked for
+	if r.URL.Query().Get("pageSize") == "" {
+		listQuery.page.PageSize = min(listQuery.page.PageSize, 100)
+	}
+
+	var events []models.DeploymentEvent
+	if err := listQuery.apply(query, "created_at DESC").Find(&events).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	setNextPageLink(w, r, listQuery.page, len(events))
+	writeJSON(w, r, http.StatusOK, events)
+}
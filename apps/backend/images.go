@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // Registers the GIF decoder with image.Decode
+	"image/jpeg"
+	"image/png"
+	"log"
+	"net/http"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"github.com/nextjs-microfrontend/backend/internal/tenant"
+	"gorm.io/gorm"
+)
+
+// Avatars are image uploads (see uploads.go) that a job makes safe to show: PUT
+// /api/users/{id}/avatar queues an image.process job, which checks the file really is the JPEG,
+// PNG, or GIF it was uploaded as and at most UPLOAD_IMAGE_MAX_PIXELS, rewrites JPEGs (turned
+// upright first) and PNGs without their metadata, so EXIF GPS positions don't leak, and stores
+// thumb and medium variants next to the original. GET /api/users/{id} then returns their URLs
+
+// imageJobKind is the kind of the jobs that process avatars
+const imageJobKind = "image.process"
+
+// avatarContentTypes are the upload types an avatar may be: the ones the standard library decodes
+var avatarContentTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+// imageVariantSize is a variant made of every avatar, fitted within a size by size square
+type imageVariantSize struct {
+	name string
+	size int
+}
+
+// imageVariantSizes are the variants made of every avatar, from UPLOAD_THUMB_SIZE and UPLOAD_MEDIUM_SIZE
+func imageVariantSizes(cfg UploadConfig) []imageVariantSize {
+	return []imageVariantSize{{"thumb", cfg.ThumbSize}, {"medium", cfg.MediumSize}}
+}
+
+// imageProcessor runs the image.process jobs and reads the variants they made
+// A nil processor has no avatars, which is what mock mode and an empty UPLOAD_S3_BUCKET give
+type imageProcessor struct {
+	db       *gorm.DB
+	uploads  *uploadStore
+	jobs     *jobQueue
+	cfg      UploadConfig
+	basePath string // BASE_PATH, for the download URLs
+}
+
+// newImageProcessor creates a processor for uploads and registers its job with jobs, or
+// returns nil when uploads is nil
+func newImageProcessor(database *gorm.DB, uploads *uploadStore, jobs *jobQueue, cfg Config) *imageProcessor {
+	if uploads == nil {
+		return nil
+	}
+	p := &imageProcessor{db: database, uploads: uploads, jobs: jobs, cfg: cfg.Uploads, basePath: cfg.Server.BasePath}
+	jobs.register(imageJobKind, jobWorker{
+		run:         p.process,
+		maxAttempts: 5,
+		backoff:     10 * time.Second,
+		concurrency: 2, // Decoding a large image takes a lot of memory
+	})
+	return p
+}
+
+// imageProcessJob is the payload of an image.process job
+type imageProcessJob struct {
+	UploadID uint `json:"uploadId"`
+	UserID   uint `json:"userId"`
+}
+
+// process makes the variants of an avatar and marks it ready, or failed for a file that isn't
+// a usable image; the image.process job worker
+// Trouble reaching the bucket is retried, and the avatar stays processing meanwhile
+func (p *imageProcessor) process(ctx context.Context, job models.Job) error {
+	var payload imageProcessJob
+	if err := decodeJobPayload(job, &payload); err != nil {
+		return err
+	}
+	var upload models.Upload
+	err := p.db.WithContext(ctx).First(&upload, payload.UploadID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return permanent(fmt.Errorf("upload %d was deleted", payload.UploadID))
+	} else if err != nil {
+		return err
+	}
+
+	status := "ready"
+	err = p.makeVariants(ctx, upload)
+	var failed *permanentJobError
+	switch {
+	case errors.As(err, &failed):
+		status = "failed"
+	case err != nil:
+		return err
+	}
+	// Only if the user hasn't picked another avatar since
+	update := p.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND avatar_upload_id = ?", payload.UserID, payload.UploadID).
+		Update("avatar_status", status)
+	if update.Error != nil {
+		return update.Error
+	}
+	log.Printf("Avatar upload %d of user %d is %s", upload.ID, payload.UserID, status)
+	return err
+}
+
+// makeVariants checks upload is an image, rewrites it without metadata, and stores its variants
+// Errors about the file itself are permanent; running it again redoes everything
+func (p *imageProcessor) makeVariants(ctx context.Context, upload models.Upload) error {
+	maxBytes, ok := p.uploads.maxBytes(upload.ContentType)
+	if !ok || maxBytes < upload.Size {
+		maxBytes = upload.Size
+	}
+	data, err := p.uploads.get(ctx, upload.Key, maxBytes)
+	if errors.Is(err, errNotFound) {
+		return permanent(fmt.Errorf("%s is not in the bucket", upload.Key))
+	} else if err != nil {
+		return err
+	}
+
+	imageConfig, format, err := image.DecodeConfig(bytes.NewReader(data))
+	switch {
+	case err != nil:
+		return permanent(fmt.Errorf("not an image: %w", err))
+	case "image/"+format != upload.ContentType:
+		return permanent(fmt.Errorf("the file is a %s image, not %s", format, upload.ContentType))
+	case imageConfig.Width*imageConfig.Height > p.cfg.ImageMaxPixels:
+		return permanent(fmt.Errorf("the image is %dx%d, over %d pixels", imageConfig.Width, imageConfig.Height, p.cfg.ImageMaxPixels))
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return permanent(fmt.Errorf("invalid %s image: %w", format, err))
+	}
+	img := toRGBA(decoded)
+	if format == "jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+
+	// Encoding writes the pixels and nothing else; GIFs carry no EXIF, and rewriting one would
+	// lose its animation
+	if format != "gif" {
+		stripped, err := encodeImage(img, format)
+		if err != nil {
+			return err
+		}
+		if err := p.uploads.put(ctx, upload.Key, upload.ContentType, stripped); err != nil {
+			return err
+		}
+		if err := p.db.WithContext(ctx).Model(&upload).Update("size", len(stripped)).Error; err != nil {
+			return err
+		}
+	}
+
+	// Variants of GIFs are PNGs of the first frame
+	variantFormat, ext := "png", ".png"
+	if format == "jpeg" {
+		variantFormat, ext = "jpeg", ".jpg"
+	}
+	var variants []models.ImageVariant
+	for _, size := range imageVariantSizes(p.cfg) {
+		resized := fit(img, size.size)
+		encoded, err := encodeImage(resized, variantFormat)
+		if err != nil {
+			return err
+		}
+		variant := models.ImageVariant{
+			UploadID: upload.ID, Name: size.name, Key: path.Dir(upload.Key) + "/variants/" + size.name + ext,
+			ContentType: "image/" + variantFormat, Width: resized.Bounds().Dx(), Height: resized.Bounds().Dy(), Size: int64(len(encoded)),
+		}
+		if err := p.uploads.put(ctx, variant.Key, variant.ContentType, encoded); err != nil {
+			return err
+		}
+		variants = append(variants, variant)
+	}
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("upload_id = ?", upload.ID).Delete(&models.ImageVariant{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&variants).Error
+	})
+}
+
+// avatar returns user's avatar as GET /api/users/{id} shows it, or nil if they have none
+func (p *imageProcessor) avatar(ctx context.Context, user models.User) (*models.UserAvatar, error) {
+	if p == nil || user.AvatarUploadID == nil {
+		return nil, nil
+	}
+	var upload models.Upload
+	if err := p.db.WithContext(ctx).First(&upload, *user.AvatarUploadID).Error; err != nil {
+		return nil, err
+	}
+	avatar := &models.UserAvatar{
+		UploadID: upload.ID,
+		Status:   user.AvatarStatus,
+		URL:      fileURL(p.basePath, upload),
+	}
+	if avatar.Status != "ready" {
+		return avatar, nil
+	}
+	var variants []models.ImageVariant
+	if err := p.db.WithContext(ctx).Where("upload_id = ?", avatar.UploadID).Order("name").Find(&variants).Error; err != nil {
+		return nil, err
+	}
+	avatar.Variants = map[string]string{}
+	for _, variant := range variants {
+		avatar.Variants[variant.Name] = avatar.URL + "?variant=" + variant.Name
+	}
+	return avatar, nil
+}
+
+// forget deletes the variants of an upload that is being deleted, and takes it away from the
+// users who have it as their avatar
+func (p *imageProcessor) forget(ctx context.Context, upload models.Upload) error {
+	if p == nil {
+		return nil
+	}
+	var variants []models.ImageVariant
+	if err := p.db.WithContext(ctx).Where("upload_id = ?", upload.ID).Find(&variants).Error; err != nil {
+		return err
+	}
+	for _, variant := range variants {
+		if err := p.uploads.remove(ctx, variant.Key); err != nil {
+			return err
+		}
+	}
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("upload_id = ?", upload.ID).Delete(&models.ImageVariant{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("avatar_upload_id = ?", upload.ID).
+			Updates(map[string]interface{}{"avatar_upload_id": nil, "avatar_status": ""}).Error
+	})
+}
+
+// toRGBA copies img into an RGBA image whose bounds start at 0, 0
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// fit scales img down to fit within a size by size square, keeping its aspect ratio, by
+// averaging the pixels each one covers; smaller images are returned as they are
+func fit(img *image.RGBA, size int) *image.RGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if w <= size && h <= size {
+		return img
+	}
+	dw, dh := size, max(1, h*size/w)
+	if h > w {
+		dw, dh = max(1, w*size/h), size
+	}
+	resized := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for dy := 0; dy < dh; dy++ {
+		sy0, sy1 := dy*h/dh, max((dy+1)*h/dh, dy*h/dh+1)
+		for dx := 0; dx < dw; dx++ {
+			sx0, sx1 := dx*w/dw, max((dx+1)*w/dw, dx*w/dw+1)
+			var sum [4]int
+			for sy := sy0; sy < sy1; sy++ {
+				row := img.Pix[sy*img.Stride+sx0*4 : sy*img.Stride+sx1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0], sum[1], sum[2], sum[3] = sum[0]+int(row[i]), sum[1]+int(row[i+1]), sum[2]+int(row[i+2]), sum[3]+int(row[i+3])
+				}
+			}
+			n := (sy1 - sy0) * (sx1 - sx0)
+			offset := dy*resized.Stride + dx*4
+			for c := range sum {
+				resized.Pix[offset+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return resized
+}
+
+// orient turns img upright according to its EXIF orientation (1 to 8)
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	// Where each source pixel goes; 5 to 8 swap the width and height
+	dest := map[int]func(x, y int) (int, int){
+		2: func(x, y int) (int, int) { return w - 1 - x, y },
+		3: func(x, y int) (int, int) { return w - 1 - x, h - 1 - y },
+		4: func(x, y int) (int, int) { return x, h - 1 - y },
+		5: func(x, y int) (int, int) { return y, x },
+		6: func(x, y int) (int, int) { return h - 1 - y, x },
+		7: func(x, y int) (int, int) { return h - 1 - y, w - 1 - x },
+		8: func(x, y int) (int, int) { return y, w - 1 - x },
+	}[orientation]
+	oriented := image.NewRGBA(image.Rect(0, 0, w, h))
+	if orientation >= 5 {
+		oriented = image.NewRGBA(image.Rect(0, 0, h, w))
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := dest(x, y)
+			copy(oriented.Pix[dy*oriented.Stride+dx*4:][:4], img.Pix[y*img.Stride+x*4:][:4])
+		}
+	}
+	return oriented
+}
+
+// jpegOrientation returns the EXIF orientation of a JPEG (1 to 8), or 1 when it has none
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		marker := data[i+1]
+		switch {
+		case data[i] != 0xFF:
+			return 1
+		case marker == 0xFF: // Padding before a marker
+			i++
+			continue
+		case marker == 0xDA || marker == 0xD9: // The image data starts, and the metadata is before it
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		if segment := data[i+4 : i+2+length]; marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation reads the Orientation tag from the first IFD of EXIF data (a TIFF file)
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for entry := ifd + 2; entries > 0 && entry+12 <= len(tiff); entry, entries = entry+12, entries-1 {
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// encodeImage encodes img as a JPEG or a PNG
+func encodeImage(img image.Image, format string) ([]byte, error) {
+	var encoded bytes.Buffer
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(&encoded, img, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&encoded, img)
+	}
+	return encoded.Bytes(), err
+}
+
+// setAvatarHandler responds to PUT /api/users/{id}/avatar
+// 202 with the user, whose avatar is processing until the image.process job has made its variants
+// The upload must be a completed JPEG, PNG, or GIF
+func (s *Server) setAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.SetAvatarRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	user, ok := findByID[models.User](w, r, s.db.Scopes(tenant.Scope(r.Context())), "User")
+	if !ok {
+		return
+	}
+	var upload models.Upload
+	err := s.db.WithContext(r.Context()).First(&upload, req.UploadID).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		writeValidationErrors(w, r, []models.FieldError{{Field: "uploadId", Message: "must be an upload"}})
+		return
+	case err != nil:
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	case upload.Status != "ready":
+		writeValidationErrors(w, r, []models.FieldError{{Field: "uploadId", Message: "must be a completed upload"}})
+		return
+	case !slices.Contains(avatarContentTypes, upload.ContentType):
+		writeValidationErrors(w, r, []models.FieldError{{Field: "uploadId", Message: "must be a JPEG, PNG, or GIF image"}})
+		return
+	}
+
+	user.AvatarUploadID, user.AvatarStatus = &upload.ID, "processing"
+	err = s.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Select("avatar_upload_id", "avatar_status").Updates(&user).Error; err != nil {
+			return err
+		}
+		return s.jobs.enqueue(tx, imageJobKind, imageProcessJob{UploadID: upload.ID, UserID: user.ID})
+	})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to set avatar: %v", err))
+		return
+	}
+	s.jobs.notify(imageJobKind)
+	user.Avatar, _ = s.images.avatar(r.Context(), user) // Processing, so there are no variants to load
+	writeJSON(w, r, http.StatusAccepted, user)
+}
+
+// deleteAvatarHandler responds to DELETE /api/users/{id}/avatar
+// The upload is kept; delete it with DELETE /api/uploads/{id}
+func (s *Server) deleteAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := findByID[models.User](w, r, s.db.Scopes(tenant.Scope(r.Context())), "User")
+	if !ok {
+		return
+	}
+	user.AvatarUploadID, user.AvatarStatus = nil, ""
+	if err := s.db.WithContext(r.Context()).Model(&user).Select("avatar_upload_id", "avatar_status").Updates(&user).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to remove avatar: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, user)
+}
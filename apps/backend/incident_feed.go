@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"github.com/nextjs-microfrontend/backend/internal/tenant"
+)
+
+// GET /api/incidents/feed.atom is the zones' incidents, recoveries, and maintenance as an Atom
+// feed, read from the activity feed (see activity.go). It is public, so stakeholders can follow
+// the zones in a feed reader or Slack's RSS app without an API key; each entry links to the
+// status page
+
+// incidentFeedSize is how many entries the feed has, newest first
+const incidentFeedSize = 50
+
+// incidentFeedID is the feed's Atom ID; entries' IDs add the activity event's ID, so an entry
+// keeps its ID whatever host the feed is read through
+const incidentFeedID = "urn:nextjs-microfrontend:incidents"
+
+// atomFeed is an Atom (RFC 4287) feed document
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID        string       `xml:"id"`
+	Title     string       `xml:"title"`
+	Published string       `xml:"published"`
+	Updated   string       `xml:"updated"`
+	Link      atomLink     `xml:"link"`
+	Category  atomCategory `xml:"category"`
+	Summary   string       `xml:"summary"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// absoluteURL is path on the host the request was sent to; feed readers need absolute links
+func absoluteURL(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + path
+}
+
+// incidentTitle is the title of an incident, recovery, or maintenance entry
+func incidentTitle(event models.ActivityEvent) string {
+	switch event.Action {
+	case "recovered":
+		return event.Zone + " recovered"
+	case "maintenance":
+		return event.Zone + " maintenance"
+	case "maintenance-ended":
+		return event.Zone + " maintenance ended"
+	}
+	return event.Zone + " incident"
+}
+
+// incidentFeedHandler responds to GET /api/incidents/feed.atom
+// The latest incidents, recoveries, and maintenance of the project's zones (every zone for a
+// project without any), newest first
+func (s *Server) incidentFeedHandler(w http.ResponseWriter, r *http.Request) {
+	query := s.db.WithContext(r.Context()).Where("type = ? AND project_id = 0", "zone")
+	if project := tenant.FromContext(r.Context()); len(project.Zones) > 0 {
+		query = query.Where("zone IN ?", project.Zones)
+	}
+	var events []models.ActivityEvent
+	if err := query.Order("created_at DESC").Order("id DESC").Limit(incidentFeedSize).Find(&events).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+
+	statusPage := absoluteURL(r, s.config.Server.BasePath+"/dashboard/")
+	feed := atomFeed{
+		ID:    incidentFeedID,
+		Title: "Zone incidents",
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: absoluteURL(r, r.URL.Path)},
+			{Rel: "alternate", Type: "text/html", Href: statusPage},
+		},
+		Author:  atomAuthor{Name: "nextjs-microfrontend"},
+		Entries: make([]atomEntry, len(events)),
+	}
+	// A feed without entries was last updated when it was read
+	updated := time.Now().UTC()
+	if len(events) > 0 {
+		updated = events[0].CreatedAt.UTC()
+	}
+	feed.Updated = updated.Format(time.RFC3339)
+	for i, event := range events {
+		at := event.CreatedAt.UTC().Format(time.RFC3339)
+		feed.Entries[i] = atomEntry{
+			ID:        incidentFeedID + ":" + strconv.FormatUint(uint64(event.ID), 10),
+			Title:     incidentTitle(event),
+			Published: at,
+			Updated:   at,
+			Link:      atomLink{Rel: "alternate", Type: "text/html", Href: statusPage},
+			Category:  atomCategory{Term: event.Action},
+			Summary:   event.Summary,
+		}
+	}
+
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to encode the feed: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
@@ -0,0 +1,379 @@
+//go:build integration
+
+// Integration tests run every public endpoint end to end, through the same routes
+// and middleware as the real server, against a throwaway Postgres container
+//
+//	go test -tags integration ./...           # needs Docker
+//	go test -tags integration -run TestUsers -update .   # rewrite testdata/golden
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	tcpostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"gorm.io/gorm"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/golden with the current responses")
+
+// testDB is the migrated database shared by every test; each test starts from the fixtures
+var testDB *gorm.DB
+
+// testConfig is what every test server is configured with before its test's changes (see
+// newTestServer); set by TestMain and never modified afterwards
+var testConfig Config
+
+// Fake zones for the health checks: zone-main is healthy, zone-admin answers 503
+var zoneMain, zoneAdmin *httptest.Server
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	os.Exit(runIntegrationTests(m))
+}
+
+// runIntegrationTests starts Postgres and the fake zones, runs the tests, and tears everything down
+func runIntegrationTests(m *testing.M) int {
+	ctx := context.Background()
+
+	container, err := tcpostgres.Run(ctx, "postgres:16-alpine",
+		tcpostgres.WithDatabase("multizone"),
+		tcpostgres.WithUsername("admin"),
+		tcpostgres.WithPassword("testpassword"),
+		tcpostgres.BasicWaitStrategies(),
+	)
+	if err != nil {
+		log.Printf("Failed to start Postgres: %v", err)
+		return 1
+	}
+	defer func() {
+		if err := container.Terminate(ctx); err != nil {
+			log.Printf("Failed to stop Postgres: %v", err)
+		}
+	}()
+
+	host, err := container.Host(ctx)
+	if err != nil {
+		log.Printf("Failed to get Postgres host: %v", err)
+		return 1
+	}
+	port, err := container.MappedPort(ctx, "5432/tcp")
+	if err != nil {
+		log.Printf("Failed to get Postgres port: %v", err)
+		return 1
+	}
+
+	zoneMain = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer zoneMain.Close()
+	zoneAdmin = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer zoneAdmin.Close()
+
+	testConfig = defaultConfig()
+	testConfig.Database.Host = host
+	testConfig.Database.Port = port.Int()
+	testConfig.Database.Password = "testpassword"
+	testConfig.Zones.MainURL = zoneMain.URL
+	testConfig.Zones.AdminURL = zoneAdmin.URL
+	testConfig.Logging.AccessLogFormat = "off"
+	testConfig.GitHub.WebhookSecret = testWebhookSecret
+	// Counts reach api_usage only when a test server closes, so reports only show fixtures
+	testConfig.Usage.FlushInterval = time.Hour
+
+	testDB, err = initDB(testConfig.Database, newLogLevel(testConfig.Logging.Level))
+	if err != nil {
+		log.Printf("Failed to initialize database: %v", err)
+		return 1
+	}
+	return m.Run()
+}
+
+// testServer is a Server behind httptest listeners, with its own caches and change feed
+type testServer struct {
+	*Server
+	url         string // Public API
+	internalURL string // Operational endpoints (INTERNAL_ADDR)
+}
+
+// newTestServer resets the database to the fixtures and starts a server on it, configured by
+// testConfig with configure's changes applied. The server keeps its own copy, so changes never
+// leak into other tests
+func newTestServer(t testing.TB, configure ...func(*Config)) *testServer {
+	t.Helper()
+	resetDatabase(t)
+
+	cfg := testConfig
+	for _, change := range configure {
+		change(&cfg)
+	}
+	s := newServer(testDB, cfg)
+	s.usage = newUsageRecorder(testDB, cfg)
+	s.analytics = newAnalyticsRecorder(testDB, cfg.Analytics)
+	// Jobs are queued, but only run by tests that run the queue (see runLeaderTask)
+	s.jobs = newJobQueue(testDB, cfg.Jobs)
+	s.webhooks = newWebhookDispatcher(testDB, s.jobs, cfg)
+	s.changes.webhooks = s.webhooks
+	s.activity = newActivityLog(testDB, cfg)
+	s.changes.activity = s.activity
+	s.translations = newTranslationStore(testDB)
+	s.settings = newSettingsStore(testDB)
+	s.redirects = newRedirectStore(testDB)
+	s.changes.slack = newSlackNotifier(cfg.Slack.WebhookURL, nil) // Only when a test sets SLACK_WEBHOOK_URL
+	var err error
+	if s.mailer, err = newMailer(testDB, s.jobs, cfg); err != nil {
+		t.Fatalf("Failed to set up email: %v", err)
+	}
+	s.changes.mailer = s.mailer // Only when a test sets EMAIL_PROVIDER
+	// Schedules are only started by tests that run the scheduler
+	s.scheduler = newScheduler(testDB, s.jobs, s.scheduledTasks(), cfg.Scheduler)
+	if err := s.scheduler.createBuiltins(context.Background(), s.builtinSchedules()); err != nil {
+		t.Fatalf("Failed to create the built-in schedules: %v", err)
+	}
+	if cfg.Backup.Enabled {
+		if s.backups, err = newBackupRunner(testDB, cfg); err != nil {
+			t.Fatalf("Failed to set up backups: %v", err)
+		}
+		s.backups.onRestore = s.flagsRestored
+	}
+	if s.uploads, err = newUploadStore(cfg.Uploads); err != nil {
+		t.Fatalf("Failed to set up uploads: %v", err)
+	}
+	s.images = newImageProcessor(testDB, s.uploads, s.jobs, cfg)
+	handler, err := s.handler(s.routes(s.databaseAPIHandlers()), false)
+	if err != nil {
+		t.Fatalf("Failed to build handler: %v", err)
+	}
+
+	public := httptest.NewServer(handler)
+	internal := httptest.NewServer(withConfig(&s.config)(s.internalRoutes()))
+	t.Cleanup(func() {
+		public.Close()
+		internal.Close()
+		s.usage.close()
+		s.analytics.close()
+		s.redirects.close()
+	})
+	return &testServer{Server: s, url: public.URL, internalURL: internal.URL}
+}
+
+// resetDatabase empties every table, restarts the IDs at 1, and loads testdata/fixtures
+func resetDatabase(t testing.TB) {
+	t.Helper()
+	if err := testDB.Exec("TRUNCATE users, feature_flags, deployment_events, api_usage, backup_jobs, webhook_subscriptions, webhook_deliveries, email_messages, email_suppressions, jobs, schedules, schedule_runs, announcements, navigation_items, zone_routes, zone_route_changes, experiments, experiment_assignments, experiment_events, analytics_daily, analytics_visitors, organizations, projects, project_api_keys, contact_submissions, feedback, uploads, image_variants, activity_events, translations, maintenance_modes, settings, redirects, newsletter_subscriptions, surveys, survey_responses, release_notes RESTART IDENTITY").Error; err != nil {
+		t.Fatalf("Failed to reset database: %v", err)
+	}
+	if err := ensureDefaultProject(testDB); err != nil {
+		t.Fatalf("Failed to reset database: %v", err)
+	}
+	loadFixtures[models.User](t, "users.json")
+	loadFixtures[models.FeatureFlag](t, "feature_flags.json")
+	loadFixtures[models.DeploymentEvent](t, "deployment_events.json")
+	loadFixtures[models.APIUsage](t, "api_usage.json")
+}
+
+// loadFixtures inserts the rows in testdata/fixtures/name, in file order
+func loadFixtures[T any](t testing.TB, name string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "fixtures", name))
+	if err != nil {
+		t.Fatalf("Failed to read fixture %s: %v", name, err)
+	}
+	var rows []T
+	if err := json.Unmarshal(data, &rows); err != nil {
+		t.Fatalf("Failed to parse fixture %s: %v", name, err)
+	}
+	// One at a time so the IDs follow the file order
+	for i := range rows {
+		if err := testDB.Create(&rows[i]).Error; err != nil {
+			t.Fatalf("Failed to load fixture %s: %v", name, err)
+		}
+	}
+}
+
+// response is what a test request got back
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// do sends a request to the public API; body is encoded as JSON unless it is already a string
+// headers are name/value pairs, e.g. "Accept", "text/csv"
+func (ts *testServer) do(t testing.TB, method, path string, body any, headers ...string) response {
+	t.Helper()
+	return send(t, method, ts.url+path, body, headers...)
+}
+
+// doInternal sends a request to the internal listener
+func (ts *testServer) doInternal(t *testing.T, method, path string, body any) response {
+	t.Helper()
+	return send(t, method, ts.internalURL+path, body)
+}
+
+func send(t testing.TB, method, url string, body any, headers ...string) response {
+	t.Helper()
+
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			t.Fatalf("Failed to encode request body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-API-Consumer", "integration-test")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read %s %s response: %v", method, url, err)
+	}
+	return response{status: resp.StatusCode, header: resp.Header, body: data}
+}
+
+// expect fails the test unless the response has the wanted status
+func (r response) expect(t testing.TB, status int) response {
+	t.Helper()
+	if r.status != status {
+		t.Fatalf("status = %d, want %d; body: %s", r.status, status, r.body)
+	}
+	return r
+}
+
+// decode unmarshals the JSON body into v
+func (r response) decode(t *testing.T, v any) {
+	t.Helper()
+	if err := json.Unmarshal(r.body, v); err != nil {
+		t.Fatalf("Failed to decode response: %v; body: %s", err, r.body)
+	}
+}
+
+// golden compares the body with testdata/golden/<test name>/<name>.json (JSON bodies)
+// or <name>.txt (anything else, e.g. v1 plain-text errors), or rewrites the file with -update
+// Timestamps, request IDs, and the fake zones' addresses change on every run,
+// so JSON bodies have them replaced with placeholders first
+func (r response) golden(t *testing.T, name string) {
+	t.Helper()
+
+	got, ext := r.body, ".txt"
+	if strings.Contains(r.header.Get("Content-Type"), "json") {
+		var body any
+		decoder := json.NewDecoder(bytes.NewReader(r.body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&body); err != nil {
+			t.Fatalf("Failed to decode response: %v; body: %s", err, r.body)
+		}
+		var encoded bytes.Buffer
+		encoder := json.NewEncoder(&encoded)
+		encoder.SetEscapeHTML(false) // Keep "<dynamic>" and "&" in links readable
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(normalize(body)); err != nil {
+			t.Fatalf("Failed to encode response: %v", err)
+		}
+		got, ext = encoded.Bytes(), ".json"
+	}
+
+	path := filepath.Join("testdata", "golden", t.Name(), name+ext)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s (run with -update to create it): %v", path, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("response does not match %s (run with -update to accept it)\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// Fields whose values differ between runs
+var dynamicFields = map[string]bool{
+	"createdAt":   true,
+	"updatedAt":   true,
+	"lastCheck":   true,
+	"generatedAt": true,
+	"at":          true,
+	"requestId":   true,
+	"goVersion":   true,
+	"runAt":       true,
+	"startedAt":   true,
+	"finishedAt":  true,
+	"lastRunAt":   true,
+	"nextRunAt":   true,
+	"startsAt":    true,
+	"endsAt":      true,
+}
+
+// randomHexPattern matches the random hex of object keys (see objectKey) and the like
+var randomHexPattern = regexp.MustCompile(`\b[0-9a-f]{32}\b`)
+
+// normalize replaces the values of dynamicFields with "<dynamic>", the fake zones' URLs with their
+// names, and random hex with "<random>"
+func normalize(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if s, ok := value.(string); ok && dynamicFields[key] && s != "" {
+				v[key] = "<dynamic>"
+			} else {
+				v[key] = normalize(value)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = normalize(v[i])
+		}
+	case string:
+		v = strings.ReplaceAll(v, zoneMain.URL, "http://zone-main")
+		v = strings.ReplaceAll(v, zoneAdmin.URL, "http://zone-admin")
+		return randomHexPattern.ReplaceAllString(v, "<random>")
+	}
+	return v
+}
+
+// lines splits a text body (CSV, NDJSON) into lines without the trailing newline
+func (r response) lines() []string {
+	return strings.Split(strings.TrimSuffix(string(r.body), "\n"), "\n")
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/http/pprof"
+)
+
+// The public listener (PORT) serves only the API and /health; everything operators and
+// Kubernetes use (readiness, metrics, runtime switches, profiling) is on INTERNAL_ADDR,
+// a port the Service doesn't expose, so it is reachable only from inside the cluster
+
+// startInternalServer serves the operational endpoints on INTERNAL_ADDR in the background
+// It is not drained on shutdown, so /readyz keeps reporting 503 until the process exits
+func (s *Server) startInternalServer() {
+	if s.config.Server.InternalAddr == "" {
+		return
+	}
+
+	server := newHTTPServer(s.config.Server, withConfig(&s.config)(s.internalRoutes()))
+	server.Addr = s.config.Server.InternalAddr
+	if s.config.Server.PprofEnabled {
+		// CPU profiles and execution traces stream for ?seconds= (up to a few minutes)
+		server.WriteTimeout = 0
+	}
+	go func() {
+		log.Printf("Internal server (readyz, metrics, pprof=%t) listening on %s", s.config.Server.PprofEnabled, s.config.Server.InternalAddr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Internal server stopped: %v", err)
+		}
+	}()
+}
+
+// internalRoutes registers the operational endpoints on a new mux
+func (s *Server) internalRoutes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /readyz", s.readyHandler)                    // Readiness probe: also checks the database
+	mux.Handle("GET /metrics", metricsHandler())                     // Prometheus scrape endpoint
+	mux.HandleFunc("GET /internal/log-level", s.getLogLevelHandler)  // Current log level
+	mux.HandleFunc("PUT /internal/log-level", s.setLogLevelHandler)  // Switch debug/info/warn at runtime
+	mux.HandleFunc("GET /internal/cache/stats", s.cacheStatsHandler) // Flag and zone status cache counters
+	mux.HandleFunc("GET /internal/config", s.runtimeConfigHandler)   // Effective settings and their sources, secrets masked
+	if s.leader != nil {
+		mux.HandleFunc("GET /internal/leader", s.leader.leaderHandler) // Which replica runs the leader tasks
+	}
+
+	// Database backups (see backup.go); only reachable from inside the cluster, like the rest of this mux
+	if s.backups != nil {
+		mux.HandleFunc("GET /internal/backups", s.backups.backupsHandler)                       // Backups in the store, newest first
+		mux.HandleFunc("POST /internal/backups", s.backups.createBackupHandler)                 // Start a backup
+		mux.HandleFunc("POST /internal/backups/{name}/restore", s.backups.restoreBackupHandler) // Start a restore (the body confirms the name)
+		mux.HandleFunc("GET /internal/backups/jobs", s.backups.backupJobsHandler)               // Recent backup and restore jobs
+		mux.HandleFunc("GET /internal/backups/jobs/{id}", s.backups.backupJobHandler)           // One job's status
+	}
+
+	// Fault injection (see chaos.go); only when CHAOS_ENABLED=true, and only on this replica
+	if s.faults != nil {
+		mux.HandleFunc("GET /internal/faults", s.faults.listFaultsHandler)          // Active faults
+		mux.HandleFunc("POST /internal/faults", s.injectFaultHandler)               // Start a fault for a while
+		mux.HandleFunc("DELETE /internal/faults", s.faults.clearFaultsHandler)      // End every fault
+		mux.HandleFunc("DELETE /internal/faults/{id}", s.faults.deleteFaultHandler) // End one fault
+	}
+
+	// Profiling, e.g.: kubectl port-forward pod/<backend-pod> 9090 &&
+	// go tool pprof http://localhost:9090/debug/pprof/profile?seconds=30
+	if s.config.Server.PprofEnabled {
+		mux.HandleFunc("GET /debug/pprof/", pprof.Index) // Also serves heap, goroutine, allocs, block, mutex, threadcreate
+		mux.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("POST /debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+	}
+	return mux
+}
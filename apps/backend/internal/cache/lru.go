@@ -0,0 +1,87 @@
+// Package cache provides the size-bounded caches shared by the REST and GraphQL handlers
+package cache
+
+import (
+	"sync/atomic"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// LRU is a size-bounded, least-recently-used cache that counts hits, misses, and evictions
+// It is safe for concurrent use
+type LRU[K comparable, V any] struct {
+	entries  *lru.Cache[K, V]
+	capacity int
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+// Stats is a snapshot of an LRU's size and counters
+type Stats struct {
+	Size      int    `json:"size"`      // Entries currently cached
+	Capacity  int    `json:"capacity"`  // Maximum number of entries
+	Hits      uint64 `json:"hits"`      // Loads that found an entry
+	Misses    uint64 `json:"misses"`    // Loads that found nothing
+	Evictions uint64 `json:"evictions"` // Entries dropped to make room for new ones
+}
+
+// HitRatio is the fraction of loads that found an entry (0 before any load)
+func (s Stats) HitRatio() float64 {
+	if total := s.Hits + s.Misses; total > 0 {
+		return float64(s.Hits) / float64(total)
+	}
+	return 0
+}
+
+// NewLRU creates a cache that holds at most capacity entries (minimum 1)
+// When full, storing a new key evicts the least recently used one
+func NewLRU[K comparable, V any](capacity int) *LRU[K, V] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	// New only fails for a non-positive size, which is ruled out above
+	entries, _ := lru.New[K, V](capacity)
+	return &LRU[K, V]{entries: entries, capacity: capacity}
+}
+
+// Load returns the cached value for key and whether it was found
+func (c *LRU[K, V]) Load(key K) (V, bool) {
+	value, ok := c.entries.Get(key)
+	if ok {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	return value, ok
+}
+
+// Store adds or replaces the value for key
+func (c *LRU[K, V]) Store(key K, value V) {
+	if evicted := c.entries.Add(key, value); evicted {
+		c.evictions.Add(1)
+	}
+}
+
+// Delete removes key from the cache
+// Deleted entries are not counted as evictions
+func (c *LRU[K, V]) Delete(key K) {
+	c.entries.Remove(key)
+}
+
+// Purge removes every entry, e.g. when invalidations may have been missed
+func (c *LRU[K, V]) Purge() {
+	c.entries.Purge()
+}
+
+// Stats returns the current size and counters
+func (c *LRU[K, V]) Stats() Stats {
+	return Stats{
+		Size:      c.entries.Len(),
+		Capacity:  c.capacity,
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+	}
+}
@@ -0,0 +1,27 @@
+// Code generated by github.com/99designs/gqlgen, DO NOT EDIT.
+
+package graph
+
+type Mutation struct {
+}
+
+type NewFeatureFlag struct {
+	Key         string  `json:"key"`
+	Name        string  `json:"name"`
+	Description *string `json:"description,omitempty"`
+	Enabled     *bool   `json:"enabled,omitempty"`
+}
+
+type NewUser struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+type Query struct {
+}
+
+type UpdateFeatureFlag struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Enabled     *bool   `json:"enabled,omitempty"`
+}
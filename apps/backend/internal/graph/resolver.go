@@ -0,0 +1,43 @@
+package graph
+
+import (
+	"github.com/nextjs-microfrontend/backend/internal/cache"
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+//go:generate go run github.com/99designs/gqlgen generate
+
+// Resolver is the root GraphQL resolver
+// It holds the dependencies shared by every query and mutation resolver
+type Resolver struct {
+	// DB is the GORM database connection
+	DB *gorm.DB
+
+	// FlagCache is the same feature flag cache used by the REST handlers, keyed by tenant.FlagKey
+	// Mutations keep it in sync so both APIs return consistent data
+	FlagCache *cache.LRU[string, models.FeatureFlag]
+
+	// CheckZones returns the current health status of every zone
+	CheckZones func() []models.ZoneStatus
+
+	// MaxListSize caps how many rows a list query returns, like the REST page size limit
+	MaxListSize int
+
+	// OnFlagChange is called with the flag's tenant.FlagKey after a mutation creates ("created"),
+	// updates ("updated"), or deletes ("deleted") a feature flag, so change listeners are notified
+	// Every query and mutation acts for the project in its context (see tenant.Scope)
+	OnFlagChange func(key, action string)
+}
+
+// page limits a list query to the requested rows, never more than MaxListSize
+func (r *Resolver) page(tx *gorm.DB, limit, offset *int) *gorm.DB {
+	size := r.MaxListSize
+	if limit != nil && *limit > 0 && *limit < size {
+		size = *limit
+	}
+	if offset != nil && *offset > 0 {
+		tx = tx.Offset(*offset)
+	}
+	return tx.Limit(size)
+}
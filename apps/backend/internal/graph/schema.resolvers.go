@@ -0,0 +1,212 @@
+package graph
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.49
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"github.com/nextjs-microfrontend/backend/internal/tenant"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateUser is the resolver for the createUser field.
+func (r *mutationResolver) CreateUser(ctx context.Context, input NewUser) (*models.User, error) {
+	user := models.User{ProjectID: tenant.FromContext(ctx).ID, Email: input.Email, Name: input.Name}
+	if user.Email == "" || user.Name == "" {
+		return nil, fmt.Errorf("email and name are required")
+	}
+
+	// GORM will execute: INSERT INTO users (project_id, email, name, created_at, updated_at) VALUES (...)
+	if err := r.DB.WithContext(ctx).Create(&user).Error; err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	return &user, nil
+}
+
+// DeleteUser is the resolver for the deleteUser field.
+func (r *mutationResolver) DeleteUser(ctx context.Context, id string) (bool, error) {
+	result := r.DB.WithContext(ctx).Scopes(tenant.Scope(ctx)).Delete(&models.User{}, id)
+	if result.Error != nil {
+		return false, fmt.Errorf("database error: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, fmt.Errorf("user not found")
+	}
+	return true, nil
+}
+
+// CreateFeatureFlag is the resolver for the createFeatureFlag field.
+func (r *mutationResolver) CreateFeatureFlag(ctx context.Context, input NewFeatureFlag) (*models.FeatureFlag, error) {
+	flag := models.FeatureFlag{ProjectID: tenant.FromContext(ctx).ID, Key: input.Key, Name: input.Name}
+	if input.Description != nil {
+		flag.Description = *input.Description
+	}
+	if input.Enabled != nil {
+		flag.Enabled = *input.Enabled
+	}
+	if flag.Key == "" || flag.Name == "" {
+		return nil, fmt.Errorf("key and name are required")
+	}
+
+	if err := r.DB.WithContext(ctx).Create(&flag).Error; err != nil {
+		return nil, fmt.Errorf("failed to create feature flag: %w", err)
+	}
+
+	// Keep the REST cache in sync
+	scoped := tenant.FlagKey(flag.ProjectID, flag.Key)
+	r.FlagCache.Store(scoped, flag)
+	r.OnFlagChange(scoped, "created")
+	return &flag, nil
+}
+
+// UpdateFeatureFlag is the resolver for the updateFeatureFlag field.
+func (r *mutationResolver) UpdateFeatureFlag(ctx context.Context, key string, input UpdateFeatureFlag) (*models.FeatureFlag, error) {
+	// Only update the fields that were provided
+	// A map is used so that "enabled: false" is not skipped as a zero value
+	updates := map[string]interface{}{}
+	if input.Name != nil {
+		updates["name"] = *input.Name
+	}
+	if input.Description != nil {
+		updates["description"] = *input.Description
+	}
+	if input.Enabled != nil {
+		updates["enabled"] = *input.Enabled
+	}
+
+	// Find, update, and reload in one transaction so the result is exactly this update
+	var flag models.FeatureFlag
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Scopes(tenant.Scope(ctx)).Where(clause.Eq{Column: "key", Value: key}).First(&flag).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("feature flag not found")
+			}
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		if len(updates) > 0 {
+			if err := tx.Model(&flag).Updates(updates).Error; err != nil {
+				return fmt.Errorf("failed to update feature flag: %w", err)
+			}
+		}
+
+		// Reload the updated flag
+		if err := tx.Scopes(tenant.Scope(ctx)).Where(clause.Eq{Column: "key", Value: key}).First(&flag).Error; err != nil {
+			return fmt.Errorf("failed to reload feature flag: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the REST cache in sync
+	scoped := tenant.FlagKey(flag.ProjectID, flag.Key)
+	r.FlagCache.Store(scoped, flag)
+	r.OnFlagChange(scoped, "updated")
+	return &flag, nil
+}
+
+// DeleteFeatureFlag is the resolver for the deleteFeatureFlag field.
+func (r *mutationResolver) DeleteFeatureFlag(ctx context.Context, key string) (bool, error) {
+	result := r.DB.WithContext(ctx).Scopes(tenant.Scope(ctx)).Where(clause.Eq{Column: "key", Value: key}).Delete(&models.FeatureFlag{})
+	if result.Error != nil {
+		return false, fmt.Errorf("database error: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, fmt.Errorf("feature flag not found")
+	}
+
+	// Keep the REST cache in sync
+	scoped := tenant.FlagKey(tenant.FromContext(ctx).ID, key)
+	r.FlagCache.Delete(scoped)
+	r.OnFlagChange(scoped, "deleted")
+	return true, nil
+}
+
+// Users is the resolver for the users field.
+func (r *queryResolver) Users(ctx context.Context, limit *int, offset *int) ([]*models.User, error) {
+	var users []*models.User
+	// GORM will execute: SELECT * FROM users WHERE project_id = ? ORDER BY id LIMIT ? OFFSET ?
+	if err := r.page(r.DB.WithContext(ctx).Scopes(tenant.Scope(ctx)).Order("id"), limit, offset).Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return users, nil
+}
+
+// User is the resolver for the user field.
+func (r *queryResolver) User(ctx context.Context, id string) (*models.User, error) {
+	var user models.User
+	// GORM will execute: SELECT * FROM users WHERE project_id = ? AND id = ?
+	if err := r.DB.WithContext(ctx).Scopes(tenant.Scope(ctx)).First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// A missing user resolves to null rather than an error
+			return nil, nil
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return &user, nil
+}
+
+// FeatureFlags is the resolver for the featureFlags field.
+func (r *queryResolver) FeatureFlags(ctx context.Context, limit *int, offset *int) ([]*models.FeatureFlag, error) {
+	var flags []*models.FeatureFlag
+	if err := r.page(r.DB.WithContext(ctx).Scopes(tenant.Scope(ctx)).Order("id"), limit, offset).Find(&flags).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	// Update cache with fresh data
+	for _, flag := range flags {
+		r.FlagCache.Store(tenant.FlagKey(flag.ProjectID, flag.Key), *flag)
+	}
+	return flags, nil
+}
+
+// FeatureFlag is the resolver for the featureFlag field.
+func (r *queryResolver) FeatureFlag(ctx context.Context, key string) (*models.FeatureFlag, error) {
+	// Try to get from cache first
+	scoped := tenant.FlagKey(tenant.FromContext(ctx).ID, key)
+	if cached, ok := r.FlagCache.Load(scoped); ok {
+		return &cached, nil
+	}
+
+	var flag models.FeatureFlag
+	if err := r.DB.WithContext(ctx).Scopes(tenant.Scope(ctx)).Where(clause.Eq{Column: "key", Value: key}).First(&flag).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// A missing flag resolves to null rather than an error
+			return nil, nil
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	r.FlagCache.Store(scoped, flag)
+	return &flag, nil
+}
+
+// Zones is the resolver for the zones field.
+func (r *queryResolver) Zones(ctx context.Context) ([]*models.ZoneStatus, error) {
+	statuses := r.CheckZones()
+	project := tenant.FromContext(ctx)
+	zones := make([]*models.ZoneStatus, 0, len(statuses))
+	for i := range statuses {
+		if project.HasZone(statuses[i].Name) {
+			zones = append(zones, &statuses[i])
+		}
+	}
+	return zones, nil
+}
+
+// Mutation returns MutationResolver implementation.
+func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
+
+// Query returns QueryResolver implementation.
+func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
+
+type mutationResolver struct{ *Resolver }
+type queryResolver struct{ *Resolver }
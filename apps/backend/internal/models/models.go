@@ -1,6 +1,48 @@
 package models
 
+//go:generate go run ../../cmd/tsgen -out ../../../zone-main/app/lib/api-types.ts -out ../../../zone-admin/app/lib/api-types.ts
+//go:generate go run github.com/tinylib/msgp -file models.go -o models_msgp.go -tests=false
+
+// MessagePack serializers are only generated for payloads of the hot read endpoints
+// (zone status and feature flags); keys use the same names as the JSON fields
+//msgp:tag json
+//msgp:ignore User DeploymentEvent SeedResponse MessageResponse CreateUserRequest CreateFeatureFlagRequest UpdateFeatureFlagRequest
+//msgp:ignore BulkCreateUsersRequest BulkCreateFeatureFlagsRequest
+//msgp:ignore FieldError DashboardResponse UserStats FlagSummary ChangeEvent ChangesResponse FlagBootstrap
+//msgp:ignore APIUsage APIUsageTotal APIUsageReport SLOReport SLOObjective SLOWindow
+//msgp:ignore SeedCounts SeedDocumentResponse GenerateResponse BuildInfo
+//msgp:ignore BackupJob Backup BackupsResponse BackupJobsResponse RestoreRequest
+//msgp:ignore JSONList StringList WebhookSubscription WebhookSubscriptionCreated WebhookDelivery WebhookEvent
+//msgp:ignore CreateWebhookSubscriptionRequest UpdateWebhookSubscriptionRequest
+//msgp:ignore EmailMessage EmailSuppression SendEmailRequest CreateEmailSuppressionRequest
+//msgp:ignore Job Schedule ScheduleParams ScheduleRun CreateScheduleRequest UpdateScheduleRequest
+//msgp:ignore Announcement CreateAnnouncementRequest UpdateAnnouncementRequest
+//msgp:ignore ExperimentVariant Experiment ExperimentAssignment ExperimentEvent
+//msgp:ignore CreateExperimentRequest UpdateExperimentRequest AssignExperimentRequest AssignmentResponse
+//msgp:ignore ExperimentEventInput ExperimentEventsRequest ExperimentEventsResponse ExperimentResults ExperimentVariantResult
+//msgp:ignore AnalyticsRollup AnalyticsVisitor AnalyticsEvent AnalyticsEventsRequest AnalyticsEventsResponse
+//msgp:ignore AnalyticsReport AnalyticsTotals AnalyticsDay AnalyticsPage AnalyticsEventTotal
+//msgp:ignore ZoneRoute ZoneRouteChange RoutingManifest RoutingManifestRoute CreateZoneRouteRequest UpdateZoneRouteRequest
+//msgp:ignore NavigationItem CreateNavigationItemRequest UpdateNavigationItemRequest NavigationOrderRequest
+//msgp:ignore Organization Project ProjectAPIKey ProjectAPIKeyCreated CreateOrganizationRequest UpdateOrganizationRequest
+//msgp:ignore CreateProjectRequest UpdateProjectRequest CreateProjectAPIKeyRequest
+//msgp:ignore ContactSubmission ContactRequest UpdateContactSubmissionRequest
+//msgp:ignore Feedback CreateFeedbackRequest UpdateFeedbackRequest
+//msgp:ignore Upload UploadCreated CreateUploadRequest UserAvatar SetAvatarRequest ImageVariant
+//msgp:ignore SearchResult SearchResponse ActivityEvent RetentionPolicy Bundle BundleChange BundleImportResponse
+//msgp:ignore Translation FlagTranslation AnnouncementTranslation HeartbeatRequest ActiveUsers
+//msgp:ignore MaintenanceMode SetMaintenanceRequest MaintenanceStatus
+//msgp:ignore Setting Settings UpdateSettingsRequest
+//msgp:ignore Redirect CreateRedirectRequest UpdateRedirectRequest
+//msgp:ignore NewsletterSubscription SubscribeRequest NewsletterTokenRequest
+//msgp:ignore SurveyOption SurveyQuestion Survey CreateSurveyRequest UpdateSurveyRequest
+//msgp:ignore SurveyAnswer SurveyResponse SubmitSurveyResponseRequest SurveyResults SurveyQuestionResult
+//msgp:ignore ReleaseNote CreateReleaseNoteRequest UpdateReleaseNoteRequest
+
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -8,20 +50,1402 @@ import (
 // GORM will automatically create a table called "users" from this struct
 type User struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	Email     string    `gorm:"uniqueIndex;not null" json:"email"` // Unique email addresses
+	ProjectID uint      `gorm:"not null;default:1;uniqueIndex:idx_users_project_email,priority:1" json:"-"` // See Project
+	Email     string    `gorm:"not null;uniqueIndex:idx_users_project_email,priority:2" json:"email"`       // Unique within the project
 	Name      string    `gorm:"not null" json:"name"`
 	CreatedAt time.Time `json:"createdAt"` // GORM automatically manages this
 	UpdatedAt time.Time `json:"updatedAt"` // GORM automatically manages this
+
+	// The user's avatar is an image upload (see images.go); only GET /api/users/{id} returns it, as Avatar
+	AvatarUploadID *uint       `gorm:"index" json:"-"`
+	AvatarStatus   string      `json:"-"` // "processing", "ready", or "failed"
+	Avatar         *UserAvatar `gorm:"-" json:"avatar,omitempty"`
+}
+
+// UserAvatar is a user's avatar as GET /api/users/{id} returns it; the URLs redirect to the
+// image itself (see GET /api/uploads/{id}/download), so they can go straight into an <img>
+type UserAvatar struct {
+	UploadID uint              `json:"uploadId"`
+	Status   string            `json:"status"` // "processing" until the variants are made, then "ready", or "failed"
+	URL      string            `json:"url"`
+	Variants map[string]string `json:"variants,omitempty"` // URL of each resized variant, by name ("thumb", "medium")
+}
+
+// SetAvatarRequest is the JSON body accepted by PUT /api/users/{id}/avatar
+type SetAvatarRequest struct {
+	UploadID uint `json:"uploadId" validate:"required"`
 }
 
 // FeatureFlag represents a feature flag in the database
 // Feature flags allow dynamic control of features without code deployments
 type FeatureFlag struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
-	Key         string    `gorm:"uniqueIndex;not null" json:"key"`         // Unique identifier (e.g., "new_dashboard")
-	Name        string    `gorm:"not null" json:"name"`                    // Human-readable name
-	Description string    `gorm:"type:text" json:"description"`            // What this flag controls
-	Enabled     bool      `gorm:"default:false;not null" json:"enabled"`   // Current state (true/false)
-	CreatedAt   time.Time `json:"createdAt"`                               // GORM automatically manages this
-	UpdatedAt   time.Time `json:"updatedAt"`                               // GORM automatically manages this
+	ProjectID   uint      `gorm:"not null;default:1;uniqueIndex:idx_feature_flags_project_key,priority:1" json:"-"` // See Project
+	Key         string    `gorm:"not null;uniqueIndex:idx_feature_flags_project_key,priority:2" json:"key"`         // Unique identifier within the project (e.g., "new_dashboard")
+	Name        string    `gorm:"not null" json:"name"`                                                             // Human-readable name
+	Description string    `gorm:"type:text" json:"description"`                                                     // What this flag controls
+	Enabled     bool      `gorm:"default:false;not null" json:"enabled"`                                            // Current state (true/false)
+	CreatedAt   time.Time `json:"createdAt"`                                                                        // GORM automatically manages this
+	UpdatedAt   time.Time `json:"updatedAt"`                                                                        // GORM automatically manages this
+}
+
+// DeploymentEvent records CI/CD activity for a zone (e.g., a GitHub deployment)
+// Together with health checks it forms the zone's monitoring timeline
+type DeploymentEvent struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Zone         string    `gorm:"not null" json:"zone"`          // Affected zone; indexed with created_at (see migrations.go)
+	Source       string    `gorm:"not null" json:"source"`        // Where the event came from (e.g., "github")
+	DeliveryID   string    `gorm:"uniqueIndex" json:"deliveryId"` // Provider delivery ID, used to ignore redeliveries
+	EventType    string    `gorm:"not null" json:"eventType"`     // e.g., "deployment_status", "workflow_run"
+	Action       string    `json:"action"`                        // e.g., "created", "completed"
+	Environment  string    `json:"environment"`                   // Deployment environment or workflow name
+	Ref          string    `json:"ref"`                           // Branch or tag
+	SHA          string    `json:"sha"`                           // Commit SHA
+	Status       string    `json:"status"`                        // e.g., "success", "failure", "in_progress"
+	URL          string    `json:"url"`                           // Link to the run or deployment
+	Actor        string    `json:"actor"`                         // Who triggered it
+	HealthStatus string    `json:"healthStatus"`                  // Zone health right after the event
+	CreatedAt    time.Time `gorm:"index" json:"createdAt"`        // GORM automatically manages this
+}
+
+// ZoneStatus represents the health status of a single zone (Next.js app)
+// This struct will be converted to JSON when sent to clients
+type ZoneStatus struct {
+	Name      string    `json:"name"`      // Name of the zone (e.g., "zone-main")
+	Status    string    `json:"status"`    // Health status: "healthy", "unhealthy", "degraded", or "maintenance"
+	URL       string    `json:"url"`       // URL that was checked
+	LastCheck time.Time `json:"lastCheck"` // When we last checked this zone
+	Message   string    `json:"message"`   // Human-readable message about the status
+}
+
+// BuildInfo is the JSON structure returned by /version and included in /health
+// Commit and BuildTime are empty when the build didn't record them
+type BuildInfo struct {
+	Version   string `json:"version"`             // Release version, "dev" for local builds
+	Commit    string `json:"commit,omitempty"`    // Git SHA
+	Modified  bool   `json:"modified,omitempty"`  // Built from a checkout with uncommitted changes
+	BuildTime string `json:"buildTime,omitempty"` // RFC 3339, UTC
+	GoVersion string `json:"goVersion"`
+}
+
+// HealthResponse is the JSON structure returned by /api/zones/status
+// Contains overall status and array of individual zone statuses
+type HealthResponse struct {
+	Status string       `json:"status"` // Overall API status
+	Zones  []ZoneStatus `json:"zones"`  // Array of zone health statuses
+}
+
+// SeedResponse is the JSON structure returned by POST /api/seed
+// Summarizes how many sample users were created or already existed
+type SeedResponse struct {
+	Message    string   `json:"message"`    // Human-readable summary
+	TotalUsers int      `json:"totalUsers"` // Number of sample users processed
+	Created    int      `json:"created"`    // Users that were newly inserted
+	Skipped    int      `json:"skipped"`    // Users that already existed
+	Errors     []string `json:"errors"`     // Error messages for users that failed
+	ErrorCount int      `json:"errorCount"` // Number of failed users
+}
+
+// SeedCounts is what seeding a document did with one kind of record
+type SeedCounts struct {
+	Total     int `json:"total"`     // Records in the document
+	Created   int `json:"created"`   // New records
+	Updated   int `json:"updated"`   // Existing records changed to match the document
+	Unchanged int `json:"unchanged"` // Existing records that already matched
+}
+
+// GenerateResponse is the JSON structure returned by POST /api/seed/generate
+// Unchanged counts the generated records whose email or key already existed
+type GenerateResponse struct {
+	Message      string     `json:"message"`
+	Seed         uint64     `json:"seed"` // Random seed; the same seed generates the same records
+	Users        SeedCounts `json:"users"`
+	FeatureFlags SeedCounts `json:"featureFlags"`
+}
+
+// SeedDocumentResponse is the JSON structure returned by POST /api/seed with a seed document
+type SeedDocumentResponse struct {
+	Message      string     `json:"message"`
+	Users        SeedCounts `json:"users"`
+	FeatureFlags SeedCounts `json:"featureFlags"`
+}
+
+// MessageResponse is the JSON structure returned by endpoints that only report a result message
+// For example, DELETE /api/users/{id} returns {"message": "User deleted successfully"}
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// CreateUserRequest is the JSON body accepted by POST /api/users
+// The validate tags are checked by the backend before anything touches the database
+type CreateUserRequest struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+	Name  string `json:"name" validate:"required,max=100"`
+}
+
+// BulkCreateUsersRequest is the body of POST /api/users/bulk
+// Every user is validated and the whole batch is created in one transaction
+type BulkCreateUsersRequest struct {
+	Users []CreateUserRequest `json:"users" validate:"required,min=1,max=1000,dive"`
+}
+
+// CreateFeatureFlagRequest is the JSON body accepted by POST /api/feature-flags
+type CreateFeatureFlagRequest struct {
+	Key         string `json:"key" validate:"required,flagkey,max=100"` // Lowercase letters, digits, and underscores
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description" validate:"max=1000"`
+	Enabled     bool   `json:"enabled"`
+}
+
+// BulkCreateFeatureFlagsRequest is the body of POST /api/feature-flags/bulk
+// Every flag is validated and the whole batch is created in one transaction
+type BulkCreateFeatureFlagsRequest struct {
+	Flags []CreateFeatureFlagRequest `json:"flags" validate:"required,min=1,max=1000,dive"`
+}
+
+// UpdateFeatureFlagRequest is the JSON body accepted by PATCH /api/feature-flags/{key}
+// Fields are pointers so that omitted fields are left unchanged
+// and "enabled": false can be told apart from "not provided"
+type UpdateFeatureFlagRequest struct {
+	Name        *string `json:"name,omitempty" validate:"omitempty,min=1,max=100"`
+	Description *string `json:"description,omitempty" validate:"omitempty,max=1000"`
+	Enabled     *bool   `json:"enabled,omitempty"`
+}
+
+// FieldError describes why a single request field failed validation
+type FieldError struct {
+	Field   string `json:"field"`   // JSON field name (e.g., "email")
+	Message string `json:"message"` // Human-readable reason
+}
+
+// DashboardResponse is the JSON structure returned by GET /api/dashboard
+// It bundles everything the zone-admin home page needs into one response
+type DashboardResponse struct {
+	Users       UserStats    `json:"users"`
+	Flags       FlagSummary  `json:"flags"`
+	Zones       []ZoneStatus `json:"zones"`
+	GeneratedAt time.Time    `json:"generatedAt"` // When the backend assembled this response
+}
+
+// UserStats summarizes the users table for the dashboard
+type UserStats struct {
+	Total         int64  `json:"total"`         // Number of users
+	CreatedLast7d int64  `json:"createdLast7d"` // Users created in the last 7 days
+	Recent        []User `json:"recent"`        // The 5 most recently created users
+}
+
+// FlagSummary summarizes feature flags for the dashboard
+type FlagSummary struct {
+	Total    int64         `json:"total"`    // Number of flags
+	Enabled  int64         `json:"enabled"`  // Flags currently turned on
+	Disabled int64         `json:"disabled"` // Flags currently turned off
+	Flags    []FeatureFlag `json:"flags"`    // Every flag, ordered by key
+}
+
+// ChangeEvent describes a single change to a feature flag or zone
+// Clients use these to refresh only what changed instead of polling everything
+type ChangeEvent struct {
+	Seq    uint64    `json:"seq"`    // Position in the change feed (increases by one per change)
+	Type   string    `json:"type"`   // What changed: "flag", "zone", "activeUsers", or "setting"
+	Key    string    `json:"key"`    // Flag key, zone name, or setting name
+	Action string    `json:"action"` // "created", "updated", "deleted", a zone status such as "unhealthy", the zone's active users, or "reset" for a setting
+	At     time.Time `json:"at"`     // When the change happened
+}
+
+// ChangesResponse is the JSON structure returned by GET /api/changes
+type ChangesResponse struct {
+	Changes []ChangeEvent `json:"changes"` // Changes after the requested cursor, oldest first
+	Cursor  string        `json:"cursor"`  // Pass as ?since= on the next request
+	Reset   bool          `json:"reset"`   // True if changes were missed; refetch full state
+}
+
+// FlagBootstrap is the JSON structure returned by GET /api/bootstrap
+// Zones fetch it once per page render to know which features to show
+type FlagBootstrap struct {
+	Flags       map[string]bool `json:"flags"`       // Enabled state of every flag, by key
+	GeneratedAt time.Time       `json:"generatedAt"` // When this snapshot was built
+}
+
+// APIUsage counts one consumer's requests to one endpoint on one day
+// Rows are upserted by every backend replica, so the counts cover the whole deployment
+type APIUsage struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Day          time.Time `gorm:"type:date;not null;uniqueIndex:idx_api_usage_day_route_consumer,priority:1" json:"day"`
+	Route        string    `gorm:"not null;uniqueIndex:idx_api_usage_day_route_consumer,priority:2" json:"route"`    // ServeMux pattern, e.g. "GET /api/users"
+	Consumer     string    `gorm:"not null;uniqueIndex:idx_api_usage_day_route_consumer,priority:3" json:"consumer"` // X-API-Consumer header, or the User-Agent product
+	Requests     int64     `gorm:"not null;default:0" json:"requests"`
+	ClientErrors int64     `gorm:"not null;default:0" json:"clientErrors"` // 4xx responses
+	ServerErrors int64     `gorm:"not null;default:0" json:"serverErrors"` // 5xx responses
+	SlowRequests int64     `gorm:"not null;default:0" json:"slowRequests"` // Slower than SLO_LATENCY_THRESHOLD (long polls excluded)
+}
+
+// TableName keeps the table singular, matching how the usage reports refer to it
+func (APIUsage) TableName() string { return "api_usage" }
+
+// APIUsageTotal is one row of the usage report: a consumer's requests to an endpoint over the report's days
+type APIUsageTotal struct {
+	Route        string `json:"route"`
+	Consumer     string `json:"consumer"`
+	Requests     int64  `json:"requests"`
+	ClientErrors int64  `json:"clientErrors"`
+	ServerErrors int64  `json:"serverErrors"`
+}
+
+// APIUsageReport is the JSON structure returned by GET /api/usage
+type APIUsageReport struct {
+	From  string          `json:"from"`  // First day included (YYYY-MM-DD, UTC)
+	To    string          `json:"to"`    // Last day included
+	Usage []APIUsageTotal `json:"usage"` // Busiest first
+}
+
+// SLOReport is the JSON structure returned by GET /api/slo/self
+type SLOReport struct {
+	Service     string         `json:"service"`
+	WindowDays  int            `json:"windowDays"` // Length of the compliance window
+	Source      string         `json:"source"`     // "api_usage" (every replica) or "memory" (this process since it started)
+	GeneratedAt time.Time      `json:"generatedAt"`
+	Objectives  []SLOObjective `json:"objectives"`
+}
+
+// SLOObjective is one objective and how much of its error budget is left
+type SLOObjective struct {
+	Name        string             `json:"name"` // "availability" or "latency"
+	Description string             `json:"description"`
+	Target      float64            `json:"target"`              // Fraction of requests that must be good, e.g. 0.999
+	Threshold   string             `json:"threshold,omitempty"` // Latency objective only, e.g. "500ms"
+	Window      SLOWindow          `json:"window"`
+	BurnRates   map[string]float64 `json:"burnRates"` // By lookback ("1h", "6h"); 1 spends the budget exactly over the window
+}
+
+// SLOWindow is an objective's compliance over the whole window
+type SLOWindow struct {
+	Total                int64   `json:"total"`
+	Good                 int64   `json:"good"`
+	SLI                  float64 `json:"sli"`                  // good / total (1 when there were no requests)
+	ErrorBudgetRemaining float64 `json:"errorBudgetRemaining"` // 1 untouched, 0 spent, negative overspent
+}
+
+// BackupJob is one database backup or restore, run by the backend (see backup.go)
+// The backup_jobs table is left out of backups, so a restore keeps the job history
+type BackupJob struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Kind       string     `gorm:"not null" json:"kind"`         // "backup" or "restore"
+	Backup     string     `gorm:"not null" json:"backup"`       // Name in the backup store, e.g. "backup-20261014T093000.125Z.dump"
+	Status     string     `gorm:"not null;index" json:"status"` // "running", "succeeded", or "failed"
+	Error      string     `gorm:"type:text" json:"error,omitempty"`
+	SizeBytes  int64      `json:"sizeBytes"` // Bytes written (backup) or read (restore)
+	Host       string     `json:"host"`      // Pod or machine that ran it
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// Backup is one dump in the backup store
+type Backup struct {
+	Name      string    `json:"name"`
+	SizeBytes int64     `json:"sizeBytes"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// BackupsResponse is the JSON structure returned by GET /internal/backups
+type BackupsResponse struct {
+	Store   string   `json:"store"`   // Where backups are kept, e.g. "s3://bucket/backups/"
+	Backups []Backup `json:"backups"` // Newest first
+}
+
+// BackupJobsResponse is the JSON structure returned by GET /internal/backups/jobs
+type BackupJobsResponse struct {
+	Jobs []BackupJob `json:"jobs"` // Newest first
+}
+
+// RestoreRequest is the JSON body accepted by POST /internal/backups/{name}/restore
+// Confirm must repeat the backup's name, so a restore can't be started by accident
+type RestoreRequest struct {
+	Confirm string `json:"confirm" validate:"required"`
+}
+
+// JSONList is a list stored as a JSON array in a text column; nil is stored as []
+type JSONList[T any] []T
+
+// StringList is a list of strings stored as a JSON array, such as event types, zones, or roles
+type StringList = JSONList[string]
+
+// Value stores the list as JSON
+func (l JSONList[T]) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]T(l))
+	return string(data), err
+}
+
+// Scan reads a list stored by Value
+func (l *JSONList[T]) Scan(value interface{}) error {
+	return scanJSON(value, l)
+}
+
+// scanJSON decodes a JSON column into dest
+func scanJSON(value interface{}, dest any) error {
+	switch v := value.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), dest)
+	case []byte:
+		return json.Unmarshal(v, dest)
+	}
+	return fmt.Errorf("cannot scan %T into %T", value, dest)
+}
+
+// WebhookSubscription is a target for outbound webhooks (see webhooks.go)
+// Every event of a subscribed type is POSTed to URL, signed with Secret
+type WebhookSubscription struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	URL       string     `gorm:"type:text;not null" json:"url"`
+	Events    StringList `gorm:"type:text;not null" json:"events"` // e.g. ["flag.updated", "zone.incident"]; ["*"] for every event
+	Secret    string     `gorm:"not null" json:"-"`                // HMAC key; only returned when the subscription is created
+	Enabled   bool       `gorm:"not null" json:"enabled"`          // Disabled subscriptions get no new deliveries
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// WebhookSubscriptionCreated is the JSON structure returned by POST /api/webhook-subscriptions,
+// the only response that includes the signing secret
+type WebhookSubscriptionCreated struct {
+	WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+// WebhookDelivery is one event sent (or to be sent) to one subscription, with its last attempt
+// Pending deliveries are picked up by next_attempt_at; the others are the delivery log
+type WebhookDelivery struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	SubscriptionID uint       `gorm:"not null;index" json:"subscriptionId"`
+	Event          string     `gorm:"not null" json:"event"`                                              // Event type, e.g. "flag.updated"
+	EventID        string     `gorm:"not null" json:"eventId"`                                            // Shared by every subscription's delivery of the event
+	Payload        string     `gorm:"type:text;not null" json:"payload"`                                  // The exact body that was signed
+	Status         string     `gorm:"not null;index:idx_webhook_deliveries_due,priority:1" json:"status"` // "pending", "delivered", or "failed"
+	Attempts       int        `gorm:"not null;default:0" json:"attempts"`
+	ResponseStatus int        `json:"responseStatus,omitempty"`                                                   // HTTP status of the last attempt; 0 if there was no response
+	Error          string     `gorm:"type:text" json:"error,omitempty"`                                           // Why the last attempt failed
+	NextAttemptAt  *time.Time `gorm:"index:idx_webhook_deliveries_due,priority:2" json:"nextAttemptAt,omitempty"` // Set while pending
+	DeliveredAt    *time.Time `json:"deliveredAt,omitempty"`
+	CreatedAt      time.Time  `gorm:"index" json:"createdAt"`
+}
+
+// WebhookEvent is the body of every webhook delivery
+// Data is the flag or user as stored after the change, {"key"} or {"id"} of a deleted one,
+// or the zone's status with its previous status
+type WebhookEvent struct {
+	ID        string      `json:"id"`   // Receivers can drop events they have already handled
+	Type      string      `json:"type"` // e.g. "flag.updated"
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+// CreateWebhookSubscriptionRequest is the JSON body accepted by POST /api/webhook-subscriptions
+type CreateWebhookSubscriptionRequest struct {
+	URL    string   `json:"url" validate:"required,http_url,max=2000"`
+	Events []string `json:"events" validate:"required,min=1,dive,webhookevent"`
+	Secret string   `json:"secret" validate:"omitempty,min=16,max=200"` // Generated when omitted
+}
+
+// UpdateWebhookSubscriptionRequest is the JSON body accepted by PATCH /api/webhook-subscriptions/{id}
+// Omitted fields are left unchanged
+type UpdateWebhookSubscriptionRequest struct {
+	URL     *string  `json:"url,omitempty" validate:"omitempty,http_url,max=2000"`
+	Events  []string `json:"events,omitempty" validate:"omitempty,min=1,dive,webhookevent"`
+	Enabled *bool    `json:"enabled,omitempty"`
+}
+
+// EmailMessage is one rendered email, queued or already sent
+// Pending messages are picked up by next_attempt_at; the others are the send log
+type EmailMessage struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Template      string     `gorm:"not null" json:"template"`                  // e.g. "invitation"
+	To            string     `gorm:"column:recipient;not null;index" json:"to"` // "to" is reserved in MySQL
+	Subject       string     `gorm:"type:text;not null" json:"subject"`
+	TextBody      string     `gorm:"type:text;not null" json:"-"`
+	HTMLBody      string     `gorm:"type:text;not null" json:"-"`
+	Status        string     `gorm:"not null;index:idx_email_messages_due,priority:1" json:"status"` // "pending", "sent", "failed", or "suppressed"
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	Error         string     `gorm:"type:text" json:"error,omitempty"`                                       // Why the last attempt failed
+	NextAttemptAt *time.Time `gorm:"index:idx_email_messages_due,priority:2" json:"nextAttemptAt,omitempty"` // Set while pending
+	SentAt        *time.Time `json:"sentAt,omitempty"`
+	CreatedAt     time.Time  `gorm:"index" json:"createdAt"`
+}
+
+// EmailSuppression is an address no email is sent to, e.g. after it bounced
+type EmailSuppression struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Email     string    `gorm:"uniqueIndex;not null" json:"email"` // Lowercase
+	Reason    string    `gorm:"not null" json:"reason"`            // "bounce", "complaint", "unsubscribe", or "manual"
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// SendEmailRequest is the JSON body accepted by POST /api/emails
+// Data fills in the template; every field the template uses must be present
+type SendEmailRequest struct {
+	Template string            `json:"template" validate:"required,emailtemplate"`
+	To       string            `json:"to" validate:"required,email,max=254"`
+	Data     map[string]string `json:"data"`
+}
+
+// CreateEmailSuppressionRequest is the JSON body accepted by POST /api/email-suppressions
+type CreateEmailSuppressionRequest struct {
+	Email  string `json:"email" validate:"required,email,max=254"`
+	Reason string `json:"reason" validate:"omitempty,oneof=bounce complaint unsubscribe manual"` // Default: manual
+}
+
+// Job is one unit of background work in the jobs table, run by the worker registered for its kind
+// Finished jobs stay for a while as the queue's history; dead ones until they are retried or deleted
+type Job struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	Kind        string     `gorm:"not null;index:idx_jobs_due,priority:1" json:"kind"`   // e.g. "email.send"
+	Payload     string     `gorm:"type:text;not null" json:"payload"`                    // JSON, as the worker reads it
+	Status      string     `gorm:"not null;index:idx_jobs_due,priority:2" json:"status"` // "pending", "running", "succeeded", or "dead"
+	Attempts    int        `gorm:"not null;default:0" json:"attempts"`
+	MaxAttempts int        `gorm:"not null" json:"maxAttempts"`
+	LastError   string     `gorm:"type:text" json:"lastError,omitempty"`                // Why the last attempt failed
+	RunAt       time.Time  `gorm:"not null;index:idx_jobs_due,priority:3" json:"runAt"` // When it is due, or was last started
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+	CreatedAt   time.Time  `gorm:"index" json:"createdAt"`
+}
+
+// ScheduleParams are a schedule's task settings, stored as a JSON object in a text column
+type ScheduleParams map[string]interface{}
+
+// Value stores the params as JSON
+func (p ScheduleParams) Value() (driver.Value, error) {
+	if p == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(map[string]interface{}(p))
+	return string(data), err
+}
+
+// Scan reads params stored by Value
+func (p *ScheduleParams) Scan(value interface{}) error {
+	return scanJSON(value, p)
+}
+
+// Schedule runs a task on a cron schedule (see schedules.go)
+type Schedule struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	Name      string         `gorm:"uniqueIndex;not null" json:"name"`
+	Cron      string         `gorm:"not null" json:"cron"` // e.g. "30 6 * * 1-5", "@hourly", or "@every 15m"
+	Task      string         `gorm:"not null" json:"task"` // e.g. "flag.set"
+	Params    ScheduleParams `gorm:"type:text;not null" json:"params"`
+	Enabled   bool           `gorm:"not null" json:"enabled"`
+	Builtin   bool           `gorm:"not null" json:"builtin"` // Created by the backend; can be changed and disabled, not deleted
+	LastRunAt *time.Time     `json:"lastRunAt,omitempty"`
+	NextRunAt *time.Time     `gorm:"index" json:"nextRunAt,omitempty"` // Unset while disabled
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+}
+
+// ScheduleRun is one run of a schedule, started by its cron expression or by hand
+type ScheduleRun struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	ScheduleID uint       `gorm:"not null;index" json:"scheduleId"`
+	Trigger    string     `gorm:"column:triggered_by;not null" json:"trigger"` // "cron" or "manual"
+	Status     string     `gorm:"not null" json:"status"`                      // "pending", "running", "succeeded", or "failed"
+	Output     string     `gorm:"type:text" json:"output,omitempty"`           // What the task did, e.g. "Pruned 12 rows"
+	Error      string     `gorm:"type:text" json:"error,omitempty"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	CreatedAt  time.Time  `gorm:"index" json:"createdAt"`
+}
+
+// CreateScheduleRequest is the JSON body accepted by POST /api/schedules
+// Params are checked against the task; Enabled defaults to true
+type CreateScheduleRequest struct {
+	Name    string         `json:"name" validate:"required,max=100,schedulename"`
+	Cron    string         `json:"cron" validate:"required,max=100,schedulecron"`
+	Task    string         `json:"task" validate:"required,scheduletask"`
+	Params  ScheduleParams `json:"params"`
+	Enabled *bool          `json:"enabled"`
+}
+
+// UpdateScheduleRequest is the JSON body accepted by PATCH /api/schedules/{id}
+// Only the fields that are present are changed; new params replace the old ones
+type UpdateScheduleRequest struct {
+	Cron    *string        `json:"cron,omitempty" validate:"omitempty,max=100,schedulecron"`
+	Params  ScheduleParams `json:"params,omitempty"`
+	Enabled *bool          `json:"enabled,omitempty"`
+}
+
+// Announcement is a banner shown by the zones, such as a welcome message or an outage notice
+// (see announcements.go); it is active between StartsAt and EndsAt
+type Announcement struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	Message     string     `gorm:"type:text;not null" json:"message"`
+	Severity    string     `gorm:"not null" json:"severity"`        // "info", "warning", or "critical"
+	Zones       StringList `gorm:"type:text;not null" json:"zones"` // e.g. ["zone-main"]; empty for every zone
+	StartsAt    *time.Time `json:"startsAt,omitempty"`              // Unset: active from when it is created
+	EndsAt      *time.Time `json:"endsAt,omitempty"`                // Unset: active until it is deleted
+	Dismissible bool       `gorm:"not null" json:"dismissible"`     // Whether visitors may close the banner
+	Locale      string     `gorm:"-" json:"locale,omitempty"`       // The message's locale, when GET /api/announcements/active translated it
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+// CreateAnnouncementRequest is the JSON body accepted by POST /api/announcements
+// Severity defaults to "info"; EndsAt must be after StartsAt when both are set
+type CreateAnnouncementRequest struct {
+	Message     string     `json:"message" validate:"required,max=2000"`
+	Severity    string     `json:"severity" validate:"omitempty,oneof=info warning critical"`
+	Zones       []string   `json:"zones" validate:"omitempty,max=10,dive,required"`
+	StartsAt    *time.Time `json:"startsAt"`
+	EndsAt      *time.Time `json:"endsAt"`
+	Dismissible bool       `json:"dismissible"`
+}
+
+// UpdateAnnouncementRequest is the JSON body accepted by PATCH /api/announcements/{id}
+// Only the fields that are present are changed; new zones replace the old ones
+type UpdateAnnouncementRequest struct {
+	Message     *string    `json:"message,omitempty" validate:"omitempty,min=1,max=2000"`
+	Severity    *string    `json:"severity,omitempty" validate:"omitempty,oneof=info warning critical"`
+	Zones       []string   `json:"zones,omitempty" validate:"omitempty,max=10,dive,required"`
+	StartsAt    *time.Time `json:"startsAt,omitempty"`
+	EndsAt      *time.Time `json:"endsAt,omitempty"`
+	Dismissible *bool      `json:"dismissible,omitempty"`
+}
+
+// MaintenanceMode is maintenance switched on for every zone, or for one (see maintenance.go)
+// While it is on, the zones show their maintenance page to everyone but AllowedIPs
+type MaintenanceMode struct {
+	ID         uint       `gorm:"primaryKey" json:"-"`
+	Zone       string     `gorm:"uniqueIndex;not null" json:"zone"`     // Empty for every zone
+	Message    string     `gorm:"type:text;not null" json:"message"`    // Shown on the maintenance page
+	AllowedIPs StringList `gorm:"type:text;not null" json:"allowedIps"` // e.g. ["203.0.113.7", "10.0.0.0/8"]
+	EndsAt     *time.Time `json:"endsAt,omitempty"`                     // Unset: on until it is switched off
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
+
+// SetMaintenanceRequest is the JSON body accepted by PUT /api/maintenance and
+// PUT /api/zones/{name}/maintenance; EndsAt must be in the future
+type SetMaintenanceRequest struct {
+	Message    string     `json:"message" validate:"required,max=2000"`
+	AllowedIPs []string   `json:"allowedIps" validate:"omitempty,max=100,dive,ip|cidr"`
+	EndsAt     *time.Time `json:"endsAt"`
+}
+
+// MaintenanceStatus is the JSON structure returned by GET /api/zones/{name}/maintenance, which
+// the zones poll to decide whether to show their maintenance page
+type MaintenanceStatus struct {
+	Zone        string     `json:"zone"`
+	Maintenance bool       `json:"maintenance"` // Whether the zone is in maintenance, its own or every zone's
+	Show        bool       `json:"show"`        // Whether to show the maintenance page: in maintenance, and the client isn't allowed in
+	Global      bool       `json:"global"`      // The maintenance is every zone's
+	Message     string     `json:"message,omitempty"`
+	EndsAt      *time.Time `json:"endsAt,omitempty"`
+}
+
+// Setting is one system setting that was set (see settings.go); settings without a row have
+// their default
+type Setting struct {
+	Key       string    `gorm:"primaryKey" json:"key"`           // The setting's name in Settings, e.g. "siteTitle"
+	Value     string    `gorm:"type:text;not null" json:"value"` // JSON-encoded
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Settings is the JSON structure returned by GET /api/settings: the site-wide values the zones read
+// that aren't on/off switches, each with its default unless it was set
+type Settings struct {
+	SiteTitle               string `json:"siteTitle"`               // Shown in the zones' header and page titles
+	SupportEmail            string `json:"supportEmail"`            // Where the zones send visitors for help; empty for nowhere
+	DefaultLocale           string `json:"defaultLocale"`           // BCP 47 locale for visitors without a preference, e.g. "en"
+	DashboardRefreshSeconds int    `json:"dashboardRefreshSeconds"` // How often the admin dashboard reloads its data
+}
+
+// UpdateSettingsRequest is the JSON body accepted by PATCH /api/settings; only the settings
+// present change. An empty supportEmail removes it
+type UpdateSettingsRequest struct {
+	SiteTitle               *string `json:"siteTitle,omitempty" validate:"omitempty,min=1,max=100"`
+	SupportEmail            *string `json:"supportEmail,omitempty" validate:"omitempty,max=254,email|eq="`
+	DefaultLocale           *string `json:"defaultLocale,omitempty" validate:"omitempty,locale"`
+	DashboardRefreshSeconds *int    `json:"dashboardRefreshSeconds,omitempty" validate:"omitempty,min=5,max=3600"`
+}
+
+// Redirect is a short link (see redirects.go): GET /r/{slug} sends visitors on to TargetURL
+type Redirect struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	Slug      string     `gorm:"uniqueIndex;not null" json:"slug"`
+	TargetURL string     `gorm:"type:text;not null" json:"targetUrl"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`            // Unset: the link works until it is deleted
+	Hits      int64      `gorm:"not null;default:0" json:"hits"` // Visits, saved every few seconds
+	LastHitAt *time.Time `json:"lastHitAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// CreateRedirectRequest is the JSON body accepted by POST /api/redirects; ExpiresAt must be in the future
+type CreateRedirectRequest struct {
+	Slug      string     `json:"slug" validate:"omitempty,max=100,slug"` // Generated when empty
+	TargetURL string     `json:"targetUrl" validate:"required,http_url,max=2000"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// UpdateRedirectRequest is the JSON body accepted by PATCH /api/redirects/{slug}
+// The slug can't change, since it is in links already shared
+type UpdateRedirectRequest struct {
+	TargetURL *string    `json:"targetUrl,omitempty" validate:"omitempty,http_url,max=2000"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// NavigationItem is one entry of the menu the zones' shell renders (see navigation.go)
+// An item with a flag is only shown while the flag is on; one with roles only to those roles
+type NavigationItem struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	Key       string     `gorm:"uniqueIndex;not null" json:"key"` // e.g. "feature-flags"
+	Label     string     `gorm:"not null" json:"label"`
+	Href      string     `gorm:"not null" json:"href"`               // A path such as "/admin/flags", or an http(s) URL
+	Zone      string     `gorm:"not null" json:"zone,omitempty"`     // Zone that serves Href, e.g. "zone-admin"; empty for external links
+	Position  int        `gorm:"not null;default:0" json:"position"` // Items are shown by position, then by ID
+	Flag      string     `gorm:"not null" json:"flag,omitempty"`     // Feature flag key that must be on
+	Roles     StringList `gorm:"type:text;not null" json:"roles"`    // e.g. ["admin"]; empty for everyone
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// CreateNavigationItemRequest is the JSON body accepted by POST /api/navigation/items
+// Position defaults to after the last item
+type CreateNavigationItemRequest struct {
+	Key      string   `json:"key" validate:"required,max=100,navkey"`
+	Label    string   `json:"label" validate:"required,max=100"`
+	Href     string   `json:"href" validate:"required,max=500,navhref"`
+	Zone     string   `json:"zone" validate:"max=100"`
+	Position *int     `json:"position" validate:"omitempty,gte=0"`
+	Flag     string   `json:"flag" validate:"omitempty,max=100,flagkey"`
+	Roles    []string `json:"roles" validate:"omitempty,max=20,dive,required,max=50"`
+}
+
+// UpdateNavigationItemRequest is the JSON body accepted by PATCH /api/navigation/items/{key}
+// Only the fields that are present are changed; an empty zone or flag clears it, and new roles
+// replace the old ones
+type UpdateNavigationItemRequest struct {
+	Label    *string  `json:"label,omitempty" validate:"omitempty,min=1,max=100"`
+	Href     *string  `json:"href,omitempty" validate:"omitempty,max=500,navhref"`
+	Zone     *string  `json:"zone,omitempty" validate:"omitempty,max=100"`
+	Position *int     `json:"position,omitempty" validate:"omitempty,gte=0"`
+	Flag     *string  `json:"flag,omitempty" validate:"omitempty,max=100"`
+	Roles    []string `json:"roles,omitempty" validate:"omitempty,max=20,dive,required,max=50"`
+}
+
+// NavigationOrderRequest is the JSON body accepted by PUT /api/navigation/order:
+// every item's key, in the order to show them
+type NavigationOrderRequest struct {
+	Keys []string `json:"keys" validate:"required,min=1,dive,required"`
+}
+
+// ZoneRoute says which zone serves a path (see routing.go): an exact path such as "/about",
+// or a prefix such as "/admin/*" for everything under it
+type ZoneRoute struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Path        string    `gorm:"uniqueIndex;not null" json:"path"`
+	Zone        string    `gorm:"not null" json:"zone"` // e.g. "zone-admin"
+	Description string    `gorm:"type:text" json:"description,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// ZoneRouteChange records one change to the routing table, kept after the route is deleted
+type ZoneRouteChange struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	RouteID      uint      `gorm:"not null;index" json:"routeId"`
+	Action       string    `gorm:"not null" json:"action"` // "created", "updated", or "deleted"
+	Path         string    `gorm:"not null" json:"path"`
+	Zone         string    `gorm:"not null" json:"zone,omitempty"`         // Zone after the change; empty when deleted
+	PreviousZone string    `gorm:"not null" json:"previousZone,omitempty"` // Zone before the change; empty when created
+	ChangedBy    string    `gorm:"not null" json:"changedBy"`              // X-API-Consumer header, or the User-Agent product
+	CreatedAt    time.Time `gorm:"index" json:"createdAt"`
+}
+
+// RoutingManifest is the JSON structure returned by GET /api/routing-manifest
+type RoutingManifest struct {
+	Version uint                   `json:"version"` // ID of the latest routing change; 0 before the first
+	Routes  []RoutingManifestRoute `json:"routes"`  // Most specific first, the order rewrites must be tried in
+}
+
+// RoutingManifestRoute is one route in the shape of a Next.js rewrite
+type RoutingManifestRoute struct {
+	Source      string `json:"source"`      // e.g. "/admin/:path*"
+	Destination string `json:"destination"` // The zone's URL with the same path, e.g. "http://zone-admin:3001/admin/:path*"
+	Zone        string `json:"zone"`
+}
+
+// CreateZoneRouteRequest is the JSON body accepted by POST /api/zone-routes
+type CreateZoneRouteRequest struct {
+	Path        string `json:"path" validate:"required,max=200,routepath"`
+	Zone        string `json:"zone" validate:"required"`
+	Description string `json:"description" validate:"max=500"`
+}
+
+// UpdateZoneRouteRequest is the JSON body accepted by PATCH /api/zone-routes/{id}
+// Only the fields that are present are changed
+type UpdateZoneRouteRequest struct {
+	Path        *string `json:"path,omitempty" validate:"omitempty,max=200,routepath"`
+	Zone        *string `json:"zone,omitempty" validate:"omitempty,min=1"`
+	Description *string `json:"description,omitempty" validate:"omitempty,max=500"`
+}
+
+// ExperimentVariant is one arm of an experiment; traffic is split between variants by weight
+type ExperimentVariant struct {
+	Key    string `json:"key" validate:"required,max=50,flagkey"` // e.g. "control"
+	Weight int    `json:"weight" validate:"min=1,max=1000"`
+}
+
+// Experiment is an A/B test (see experiments.go): units (users or visitors) are bucketed into
+// variants, and their exposure and conversion events are totalled per variant
+type Experiment struct {
+	ID            uint                        `gorm:"primaryKey" json:"id"`
+	Key           string                      `gorm:"uniqueIndex;not null" json:"key"` // e.g. "checkout_button_color"
+	Name          string                      `gorm:"not null" json:"name"`
+	Hypothesis    string                      `gorm:"type:text" json:"hypothesis,omitempty"`
+	Status        string                      `gorm:"not null" json:"status"` // "draft", "running", or "stopped"
+	Variants      JSONList[ExperimentVariant] `gorm:"type:text;not null" json:"variants"`
+	Allocation    int                         `gorm:"not null" json:"allocation"`     // Percentage of units enrolled, 1-100
+	FlagKey       string                      `gorm:"not null" json:"flag,omitempty"` // Units are only enrolled while this flag is on
+	PrimaryMetric string                      `gorm:"not null" json:"primaryMetric"`  // Conversion metric the results compare, e.g. "purchase"
+	StartedAt     *time.Time                  `json:"startedAt,omitempty"`
+	StoppedAt     *time.Time                  `json:"stoppedAt,omitempty"`
+	CreatedAt     time.Time                   `json:"createdAt"`
+	UpdatedAt     time.Time                   `json:"updatedAt"`
+}
+
+// ExperimentAssignment is the variant a unit was bucketed into; kept so assignments stay the same
+type ExperimentAssignment struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	ExperimentID uint      `gorm:"not null;uniqueIndex:idx_experiment_assignments_unit,priority:1" json:"experimentId"`
+	Unit         string    `gorm:"not null;uniqueIndex:idx_experiment_assignments_unit,priority:2" json:"unit"`
+	Variant      string    `gorm:"not null" json:"variant"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// ExperimentEvent is one exposure or conversion of an assigned unit
+type ExperimentEvent struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	ExperimentID uint      `gorm:"not null;index:idx_experiment_events_type,priority:1" json:"experimentId"`
+	Type         string    `gorm:"not null;index:idx_experiment_events_type,priority:2" json:"type"` // "exposure" or "conversion"
+	Variant      string    `gorm:"not null" json:"variant"`
+	Unit         string    `gorm:"not null" json:"unit"`
+	Metric       string    `gorm:"not null" json:"metric,omitempty"` // Conversions only, e.g. "purchase"
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// CreateExperimentRequest is the JSON body accepted by POST /api/experiments
+// Allocation defaults to 100 and PrimaryMetric to "conversion"; experiments start as drafts
+type CreateExperimentRequest struct {
+	Key           string              `json:"key" validate:"required,max=100,flagkey"`
+	Name          string              `json:"name" validate:"required,max=200"`
+	Hypothesis    string              `json:"hypothesis" validate:"max=2000"`
+	Variants      []ExperimentVariant `json:"variants" validate:"required,min=2,max=10,dive"`
+	Allocation    int                 `json:"allocation" validate:"omitempty,min=1,max=100"`
+	Flag          string              `json:"flag" validate:"omitempty,max=100,flagkey"`
+	PrimaryMetric string              `json:"primaryMetric" validate:"omitempty,max=50,flagkey"`
+}
+
+// UpdateExperimentRequest is the JSON body accepted by PATCH /api/experiments/{key}
+// Only the fields that are present are changed. Status moves from "draft" to "running" to
+// "stopped"; variants can only change while the experiment is a draft
+type UpdateExperimentRequest struct {
+	Name          *string             `json:"name,omitempty" validate:"omitempty,min=1,max=200"`
+	Hypothesis    *string             `json:"hypothesis,omitempty" validate:"omitempty,max=2000"`
+	Status        *string             `json:"status,omitempty" validate:"omitempty,oneof=draft running stopped"`
+	Variants      []ExperimentVariant `json:"variants,omitempty" validate:"omitempty,min=2,max=10,dive"`
+	Allocation    *int                `json:"allocation,omitempty" validate:"omitempty,min=1,max=100"`
+	Flag          *string             `json:"flag,omitempty" validate:"omitempty,max=100"`
+	PrimaryMetric *string             `json:"primaryMetric,omitempty" validate:"omitempty,max=50,flagkey"`
+}
+
+// AssignExperimentRequest is the JSON body accepted by POST /api/experiments/{key}/assignments
+type AssignExperimentRequest struct {
+	Unit string `json:"unit" validate:"required,max=200"` // A user ID or an anonymous visitor ID
+}
+
+// AssignmentResponse is the JSON structure returned by POST /api/experiments/{key}/assignments
+type AssignmentResponse struct {
+	Experiment string `json:"experiment"`
+	Unit       string `json:"unit"`
+	Enrolled   bool   `json:"enrolled"`          // False when the unit falls outside the allocation or the experiment isn't running
+	Variant    string `json:"variant,omitempty"` // Set when enrolled; show the control otherwise
+}
+
+// ExperimentEventInput is one event in an ExperimentEventsRequest
+type ExperimentEventInput struct {
+	Experiment string `json:"experiment" validate:"required,max=100"`
+	Unit       string `json:"unit" validate:"required,max=200"`
+	Type       string `json:"type" validate:"required,oneof=exposure conversion"`
+	Metric     string `json:"metric" validate:"omitempty,max=50,flagkey"` // Conversions only; default: "conversion"
+}
+
+// ExperimentEventsRequest is the JSON body accepted by POST /api/experiments/events
+type ExperimentEventsRequest struct {
+	Events []ExperimentEventInput `json:"events" validate:"required,min=1,max=500,dive"`
+}
+
+// ExperimentEventsResponse is the JSON structure returned by POST /api/experiments/events
+type ExperimentEventsResponse struct {
+	Accepted int `json:"accepted"`
+	Ignored  int `json:"ignored"` // Events of unknown experiments or of units that were never enrolled
+}
+
+// ExperimentResults is the JSON structure returned by GET /api/experiments/{key}/results
+type ExperimentResults struct {
+	Experiment    string                    `json:"experiment"`
+	Status        string                    `json:"status"`
+	PrimaryMetric string                    `json:"primaryMetric"`
+	Variants      []ExperimentVariantResult `json:"variants"` // In the experiment's order, control first
+}
+
+// ExperimentVariantResult totals one variant's units and events
+type ExperimentVariantResult struct {
+	Variant        string           `json:"variant"`
+	Assigned       int64            `json:"assigned"`         // Units bucketed into the variant
+	Exposed        int64            `json:"exposed"`          // Assigned units with at least one exposure
+	Converted      int64            `json:"converted"`        // Exposed units with a conversion on the primary metric
+	ConversionRate float64          `json:"conversionRate"`   // Converted / exposed
+	Uplift         *float64         `json:"uplift,omitempty"` // Relative change of the rate against the control
+	PValue         *float64         `json:"pValue,omitempty"` // Two-sided two-proportion z-test against the control
+	Metrics        map[string]int64 `json:"metrics"`          // Converting units per metric, exposed or not
+}
+
+// SurveyOption is one choice of a "choice" or "multiple" survey question
+type SurveyOption struct {
+	Key   string `json:"key" validate:"required,max=50,flagkey"` // e.g. "pricing"
+	Label string `json:"label" validate:"required,max=200"`
+}
+
+// SurveyQuestion is one question of a survey. Type says what an answer is: "nps" a score from 0
+// to 10, "rating" a score from 1 to 5, "choice" one of the options, "multiple" any of them, and
+// "text" free text
+type SurveyQuestion struct {
+	Key      string         `json:"key" validate:"required,max=50,flagkey"` // e.g. "recommend"
+	Type     string         `json:"type" validate:"required,oneof=nps rating choice multiple text"`
+	Prompt   string         `json:"prompt" validate:"required,max=500"`
+	Options  []SurveyOption `json:"options,omitempty" validate:"required_if=Type choice,required_if=Type multiple,omitempty,max=20,dive"`
+	Required bool           `json:"required"` // Responses must answer it
+}
+
+// Survey is an in-product poll, such as an NPS question (see surveys.go). While it is active, a
+// zone shows it to the units (users or visitors) it targets, each of which may respond once
+type Survey struct {
+	ID        uint                     `gorm:"primaryKey" json:"id"`
+	Key       string                   `gorm:"uniqueIndex;not null" json:"key"` // e.g. "nps_2026_q4"
+	Title     string                   `gorm:"not null" json:"title"`
+	Status    string                   `gorm:"not null;index" json:"status"` // "draft", "active", or "closed"
+	Questions JSONList[SurveyQuestion] `gorm:"type:text;not null" json:"questions"`
+	Zones     StringList               `gorm:"type:text;not null" json:"zones"`    // e.g. ["zone-main"]; empty for every zone
+	Segments  StringList               `gorm:"type:text;not null" json:"segments"` // e.g. ["pro"]; empty for every segment
+	FlagKey   string                   `gorm:"not null" json:"flag,omitempty"`     // Only shown while this flag is on
+	Sample    int                      `gorm:"not null" json:"sample"`             // Percentage of the targeted units it is shown to, 1-100
+	StartedAt *time.Time               `json:"startedAt,omitempty"`
+	ClosedAt  *time.Time               `json:"closedAt,omitempty"`
+	CreatedAt time.Time                `json:"createdAt"`
+	UpdatedAt time.Time                `json:"updatedAt"`
+}
+
+// CreateSurveyRequest is the JSON body accepted by POST /api/surveys
+// Sample defaults to 100; surveys start as drafts
+type CreateSurveyRequest struct {
+	Key       string           `json:"key" validate:"required,max=100,flagkey"`
+	Title     string           `json:"title" validate:"required,max=200"`
+	Questions []SurveyQuestion `json:"questions" validate:"required,min=1,max=20,dive"`
+	Zones     []string         `json:"zones" validate:"omitempty,max=10,dive,required"`
+	Segments  []string         `json:"segments" validate:"omitempty,max=20,dive,required,max=50"`
+	Flag      string           `json:"flag" validate:"omitempty,max=100,flagkey"`
+	Sample    int              `json:"sample" validate:"omitempty,min=1,max=100"`
+}
+
+// UpdateSurveyRequest is the JSON body accepted by PATCH /api/surveys/{key}
+// Only the fields that are present are changed. Status moves from "draft" to "active" to
+// "closed"; questions can only change while the survey is a draft
+type UpdateSurveyRequest struct {
+	Title     *string          `json:"title,omitempty" validate:"omitempty,min=1,max=200"`
+	Status    *string          `json:"status,omitempty" validate:"omitempty,oneof=draft active closed"`
+	Questions []SurveyQuestion `json:"questions,omitempty" validate:"omitempty,min=1,max=20,dive"`
+	Zones     []string         `json:"zones,omitempty" validate:"omitempty,max=10,dive,required"`
+	Segments  []string         `json:"segments,omitempty" validate:"omitempty,max=20,dive,required,max=50"`
+	Flag      *string          `json:"flag,omitempty" validate:"omitempty,max=100"`
+	Sample    *int             `json:"sample,omitempty" validate:"omitempty,min=1,max=100"`
+}
+
+// SurveyAnswer is the answer to one question: Score for "nps" and "rating" questions, Options
+// for "choice" (exactly one) and "multiple", and Text for "text"
+type SurveyAnswer struct {
+	Question string   `json:"question" validate:"required,max=50"`
+	Score    *int     `json:"score,omitempty"`
+	Options  []string `json:"options,omitempty" validate:"omitempty,max=20,dive,required,max=50"`
+	Text     string   `json:"text,omitempty" validate:"max=2000"`
+}
+
+// SurveyResponse is one unit's answers to a survey; a unit responds to each survey once
+type SurveyResponse struct {
+	ID        uint                   `gorm:"primaryKey" json:"id"`
+	SurveyID  uint                   `gorm:"not null;uniqueIndex:idx_survey_responses_unit,priority:1" json:"surveyId"`
+	Unit      string                 `gorm:"not null;uniqueIndex:idx_survey_responses_unit,priority:2" json:"unit"`
+	Zone      string                 `json:"zone,omitempty"` // The zone it was answered in
+	Answers   JSONList[SurveyAnswer] `gorm:"type:text;not null" json:"answers"`
+	CreatedAt time.Time              `json:"createdAt"`
+}
+
+// SubmitSurveyResponseRequest is the JSON body accepted by POST /api/surveys/{key}/responses
+type SubmitSurveyResponseRequest struct {
+	Unit    string         `json:"unit" validate:"required,max=200"` // A user ID or an anonymous visitor ID
+	Zone    string         `json:"zone" validate:"max=100"`
+	Answers []SurveyAnswer `json:"answers" validate:"required,min=1,max=20,dive"`
+}
+
+// SurveyResults is the JSON structure returned by GET /api/surveys/{key}/results
+type SurveyResults struct {
+	Survey    string                 `json:"survey"`
+	Status    string                 `json:"status"`
+	Responses int64                  `json:"responses"`
+	Questions []SurveyQuestionResult `json:"questions"` // In the survey's order
+}
+
+// SurveyQuestionResult totals the answers to one question
+type SurveyQuestionResult struct {
+	Question string           `json:"question"`
+	Type     string           `json:"type"`
+	Answered int64            `json:"answered"`          // Responses that answered it
+	Counts   map[string]int64 `json:"counts,omitempty"`  // Answers per score or option key, zeros included; not for text
+	Average  *float64         `json:"average,omitempty"` // Mean score of "nps" and "rating" questions
+	NPS      *float64         `json:"nps,omitempty"`     // Net Promoter Score of "nps" questions: % of 9-10 less % of 0-6
+}
+
+// ReleaseNote is what changed in one version of a zone, or of the whole site, for the zones'
+// "What's new" panel (see release_notes.go); it is listed from PublishedAt on
+type ReleaseNote struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	Version     string     `gorm:"size:50;not null;uniqueIndex:idx_release_notes_version,priority:2" json:"version"`        // e.g. "2.4.0"
+	Zone        string     `gorm:"size:50;not null;uniqueIndex:idx_release_notes_version,priority:1" json:"zone,omitempty"` // e.g. "zone-admin"; empty for the whole site
+	Body        string     `gorm:"type:text;not null" json:"body"`                                                          // Markdown, rendered by the zones
+	FlagKey     string     `gorm:"not null" json:"flag,omitempty"`                                                          // Only listed while this flag is on
+	PublishedAt *time.Time `gorm:"index" json:"publishedAt,omitempty"`                                                      // Unset: a draft; in the future: scheduled
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+// CreateReleaseNoteRequest is the JSON body accepted by POST /api/release-notes
+// Without publishedAt the notes are a draft
+type CreateReleaseNoteRequest struct {
+	Version     string     `json:"version" validate:"required,max=50"`
+	Zone        string     `json:"zone" validate:"max=50"`
+	Body        string     `json:"body" validate:"required,max=20000"`
+	Flag        string     `json:"flag" validate:"omitempty,max=100,flagkey"`
+	PublishedAt *time.Time `json:"publishedAt"`
+}
+
+// UpdateReleaseNoteRequest is the JSON body accepted by PATCH /api/release-notes/{id}
+// Only the fields that are present are changed; an empty zone or flag clears it
+type UpdateReleaseNoteRequest struct {
+	Version     *string    `json:"version,omitempty" validate:"omitempty,min=1,max=50"`
+	Zone        *string    `json:"zone,omitempty" validate:"omitempty,max=50"`
+	Body        *string    `json:"body,omitempty" validate:"omitempty,min=1,max=20000"`
+	Flag        *string    `json:"flag,omitempty" validate:"omitempty,max=100"`
+	PublishedAt *time.Time `json:"publishedAt,omitempty"`
+}
+
+// AnalyticsRollup counts one kind of event on one page of a zone on one day (see analytics.go)
+// Rows are upserted by every backend replica, like api_usage. The sizes keep the unique index
+// within MySQL's key length limit
+type AnalyticsRollup struct {
+	ID    uint      `gorm:"primaryKey" json:"id"`
+	Day   time.Time `gorm:"type:date;not null;uniqueIndex:idx_analytics_daily_key,priority:1" json:"day"`
+	Zone  string    `gorm:"size:50;not null;uniqueIndex:idx_analytics_daily_key,priority:2" json:"zone"`  // Empty for site-wide visitor counts
+	Type  string    `gorm:"size:20;not null;uniqueIndex:idx_analytics_daily_key,priority:3" json:"type"`  // "pageview", "custom", or "visitor"
+	Name  string    `gorm:"size:100;not null;uniqueIndex:idx_analytics_daily_key,priority:4" json:"name"` // Custom event name, e.g. "signup"
+	Path  string    `gorm:"size:200;not null;uniqueIndex:idx_analytics_daily_key,priority:5" json:"path"`
+	Count int64     `gorm:"not null;default:0" json:"count"` // Scaled up when ANALYTICS_SAMPLE_RATE is below 1
+}
+
+// TableName names the table after what it holds, one row per day and key
+func (AnalyticsRollup) TableName() string { return "analytics_daily" }
+
+// AnalyticsVisitor records that a visitor was seen in a zone on a day, so each is counted once
+type AnalyticsVisitor struct {
+	ID      uint      `gorm:"primaryKey" json:"id"`
+	Day     time.Time `gorm:"type:date;not null;uniqueIndex:idx_analytics_visitors_key,priority:1" json:"day"`
+	Zone    string    `gorm:"size:50;not null;uniqueIndex:idx_analytics_visitors_key,priority:2" json:"zone"`    // Empty for the whole site
+	Visitor string    `gorm:"size:32;not null;uniqueIndex:idx_analytics_visitors_key,priority:3" json:"visitor"` // Hash of the visitor ID the zone sent
+}
+
+// AnalyticsEvent is one event in an AnalyticsEventsRequest
+type AnalyticsEvent struct {
+	Type    string `json:"type" validate:"required,oneof=pageview custom"`
+	Name    string `json:"name" validate:"required_if=Type custom,max=100"` // Custom events only, e.g. "signup"
+	Zone    string `json:"zone" validate:"required"`
+	Path    string `json:"path" validate:"required,startswith=/,max=2000"` // The query string and fragment are dropped
+	Visitor string `json:"visitor" validate:"max=200"`                     // An anonymous visitor ID; only a hash is stored
+}
+
+// AnalyticsEventsRequest is the JSON body accepted by POST /api/events
+type AnalyticsEventsRequest struct {
+	Events []AnalyticsEvent `json:"events" validate:"required,min=1,dive"` // At most ANALYTICS_MAX_BATCH_SIZE
+}
+
+// AnalyticsEventsResponse is the JSON structure returned by POST /api/events
+type AnalyticsEventsResponse struct {
+	Accepted   int     `json:"accepted"`
+	Sampled    int     `json:"sampled"`    // Events dropped by sampling; the accepted ones are scaled up to make up for them
+	SampleRate float64 `json:"sampleRate"` // ANALYTICS_SAMPLE_RATE
+}
+
+// HeartbeatRequest is the JSON body accepted by POST /api/zones/{name}/heartbeat
+type HeartbeatRequest struct {
+	Session string `json:"session" validate:"required,max=200"` // An anonymous session ID; only a hash is kept
+}
+
+// ActiveUsers is the JSON structure returned by GET /api/zones/{name}/active-users and the heartbeat
+type ActiveUsers struct {
+	Zone          string    `json:"zone"`
+	ActiveUsers   int       `json:"activeUsers"`   // Sessions with a heartbeat in the last windowSeconds
+	WindowSeconds int       `json:"windowSeconds"` // ANALYTICS_ACTIVE_WINDOW
+	At            time.Time `json:"at"`
+}
+
+// AnalyticsReport is the JSON structure returned by GET /api/analytics
+type AnalyticsReport struct {
+	From      string                `json:"from"`           // First day included (YYYY-MM-DD, UTC)
+	To        string                `json:"to"`             // Last day included
+	Zone      string                `json:"zone,omitempty"` // Every zone when empty
+	Totals    AnalyticsTotals       `json:"totals"`
+	Days      []AnalyticsDay        `json:"days"`      // Every day from from to to, including empty ones
+	TopPages  []AnalyticsPage       `json:"topPages"`  // Most viewed first
+	TopEvents []AnalyticsEventTotal `json:"topEvents"` // Most frequent first
+}
+
+// AnalyticsTotals are the counts over a report's whole range
+// Visitors are only counted per day, since the same visitor comes back on other days
+type AnalyticsTotals struct {
+	PageViews int64 `json:"pageViews"`
+	Events    int64 `json:"events"` // Custom events
+}
+
+// AnalyticsDay is one day of an AnalyticsReport
+type AnalyticsDay struct {
+	Day       string `json:"day"`
+	PageViews int64  `json:"pageViews"`
+	Events    int64  `json:"events"`
+	Visitors  int64  `json:"visitors"` // Distinct visitor IDs; events without one aren't counted
+}
+
+// AnalyticsPage is a page's views over a report's range
+type AnalyticsPage struct {
+	Path  string `json:"path"`
+	Views int64  `json:"views"`
+}
+
+// AnalyticsEventTotal is a custom event's count over a report's range
+type AnalyticsEventTotal struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// Organization is a team that shares this backend with others; its projects hold its data
+type Organization struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Slug      string    `gorm:"uniqueIndex;not null" json:"slug"` // e.g. "acme"; the default organization is "default"
+	Name      string    `gorm:"not null" json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Project scopes users, feature flags, and zones: requests acting for one project never see
+// another's. A request picks its project with a project API key or the X-Project header
+// ("<organization>/<project>"); without either it acts for the default project (ID 1)
+type Project struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	OrganizationID uint       `gorm:"not null;uniqueIndex:idx_projects_organization_slug,priority:1" json:"organizationId"`
+	Slug           string     `gorm:"not null;uniqueIndex:idx_projects_organization_slug,priority:2" json:"slug"` // Unique within the organization
+	Name           string     `gorm:"not null" json:"name"`
+	Zones          StringList `gorm:"type:text;not null" json:"zones"` // e.g. ["zone-main"]; empty for every zone
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+// ProjectAPIKey lets a client act for its project ("Authorization: Bearer mzk_...") and change
+// the project's users and flags; only a hash of the key is stored
+type ProjectAPIKey struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ProjectID uint      `gorm:"not null;index" json:"projectId"`
+	Name      string    `gorm:"not null" json:"name"`          // What the key is for, e.g. "zone-main production"
+	Prefix    string    `gorm:"not null" json:"prefix"`        // The start of the key, to tell keys apart
+	TokenHash string    `gorm:"uniqueIndex;not null" json:"-"` // Hex SHA-256 of the key
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ProjectAPIKeyCreated is the JSON structure returned when a project API key is created,
+// the only response that includes the key
+type ProjectAPIKeyCreated struct {
+	ProjectAPIKey
+	Key string `json:"key"`
+}
+
+// CreateOrganizationRequest is the JSON body accepted by POST /api/organizations
+type CreateOrganizationRequest struct {
+	Slug string `json:"slug" validate:"required,max=50,slug"`
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// UpdateOrganizationRequest is the JSON body accepted by PATCH /api/organizations/{org}
+type UpdateOrganizationRequest struct {
+	Name *string `json:"name,omitempty" validate:"omitempty,min=1,max=100"`
+}
+
+// CreateProjectRequest is the JSON body accepted by POST /api/organizations/{org}/projects
+type CreateProjectRequest struct {
+	Slug  string   `json:"slug" validate:"required,max=50,slug"`
+	Name  string   `json:"name" validate:"required,max=100"`
+	Zones []string `json:"zones" validate:"omitempty,max=20,dive,required,max=100"`
+}
+
+// UpdateProjectRequest is the JSON body accepted by PATCH /api/organizations/{org}/projects/{project}
+// Only the fields that are present are changed; new zones replace the old ones
+type UpdateProjectRequest struct {
+	Name  *string  `json:"name,omitempty" validate:"omitempty,min=1,max=100"`
+	Zones []string `json:"zones,omitempty" validate:"omitempty,max=20,dive,required,max=100"`
+}
+
+// CreateProjectAPIKeyRequest is the JSON body accepted by POST /api/organizations/{org}/projects/{project}/api-keys
+type CreateProjectAPIKeyRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// ContactSubmission is one message sent through a zone's contact form (see contact.go)
+type ContactSubmission struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Name       string    `gorm:"not null" json:"name"`
+	Email      string    `gorm:"not null" json:"email"`
+	Subject    string    `json:"subject,omitempty"`
+	Message    string    `gorm:"type:text;not null" json:"message"`
+	Zone       string    `json:"zone,omitempty"`                  // The zone whose form it came from, e.g. "zone-main"
+	Status     string    `gorm:"not null;index" json:"status"`    // "new", "open", "resolved", or "spam"
+	SpamReason string    `json:"spamReason,omitempty"`            // Why it was marked spam when it arrived: "honeypot" or "links"
+	Note       string    `gorm:"type:text" json:"note,omitempty"` // Left by whoever triages it
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// ContactRequest is the JSON body accepted by POST /api/contact
+// Website is a honeypot: the form hides it, so only bots fill it in. CaptchaToken is the
+// widget's response token, needed when CONTACT_CAPTCHA_VERIFY_URL is set
+type ContactRequest struct {
+	Name         string `json:"name" validate:"required,max=100"`
+	Email        string `json:"email" validate:"required,email,max=255"`
+	Subject      string `json:"subject" validate:"max=200"`
+	Message      string `json:"message" validate:"required,max=5000"`
+	Zone         string `json:"zone" validate:"max=100"`
+	Website      string `json:"website" validate:"max=500"`
+	CaptchaToken string `json:"captchaToken" validate:"max=4096"`
+}
+
+// UpdateContactSubmissionRequest is the JSON body accepted by PATCH /api/contact/submissions/{id}
+// Only the fields that are present are changed
+type UpdateContactSubmissionRequest struct {
+	Status *string `json:"status,omitempty" validate:"omitempty,oneof=new open resolved spam"`
+	Note   *string `json:"note,omitempty" validate:"omitempty,max=2000"`
+}
+
+// NewsletterSubscription is one address signed up for the newsletter (see newsletter.go)
+// Only hashes of the confirmation and unsubscribe tokens are stored, and never returned
+type NewsletterSubscription struct {
+	ID                   uint       `gorm:"primaryKey" json:"id"`
+	Email                string     `gorm:"uniqueIndex;not null" json:"email"` // Lowercase
+	Status               string     `gorm:"not null;index" json:"status"`      // "pending", "confirmed", or "unsubscribed"
+	Zone                 string     `json:"zone,omitempty"`                    // The zone whose form it came from, e.g. "zone-main"
+	ConfirmTokenHash     string     `gorm:"index" json:"-"`                    // Hex SHA-256 of the pending confirmation token; empty once confirmed
+	ConfirmExpiresAt     *time.Time `json:"-"`
+	UnsubscribeTokenHash string     `gorm:"uniqueIndex;not null" json:"-"` // Hex SHA-256 of the token in every email's unsubscribe link
+	ConfirmedAt          *time.Time `json:"confirmedAt,omitempty"`
+	UnsubscribedAt       *time.Time `json:"unsubscribedAt,omitempty"`
+	CreatedAt            time.Time  `json:"createdAt"`
+	UpdatedAt            time.Time  `json:"updatedAt"`
+}
+
+// SubscribeRequest is the JSON body accepted by POST /api/newsletter/subscribe
+type SubscribeRequest struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+	Zone  string `json:"zone" validate:"max=100"`
+}
+
+// NewsletterTokenRequest is the JSON body accepted by POST /api/newsletter/confirm and
+// POST /api/newsletter/unsubscribe: the token from the link in the email
+type NewsletterTokenRequest struct {
+	Token string `json:"token" validate:"required,max=100"`
+}
+
+// Feedback is one rating left through a zone's in-product feedback widget (see feedback.go)
+type Feedback struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Rating    int       `gorm:"not null" json:"rating"` // 1 (worst) to 5 (best)
+	Message   string    `gorm:"type:text" json:"message,omitempty"`
+	Page      string    `json:"page,omitempty"`               // The path it was left on, e.g. "/pricing"
+	Zone      string    `gorm:"not null;index" json:"zone"`   // e.g. "zone-main"
+	UserID    string    `json:"userId,omitempty"`             // The zone's ID for the signed-in user; empty for visitors
+	Status    string    `gorm:"not null;index" json:"status"` // "new", "triaged", or "closed"
+	Note      string    `gorm:"type:text" json:"note,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TableName keeps the table singular; "feedbacks" isn't a word
+func (Feedback) TableName() string { return "feedback" }
+
+// CreateFeedbackRequest is the JSON body accepted by POST /api/feedback
+type CreateFeedbackRequest struct {
+	Rating  int    `json:"rating" validate:"required,min=1,max=5"`
+	Message string `json:"message" validate:"max=5000"`
+	Page    string `json:"page" validate:"max=500"`
+	Zone    string `json:"zone" validate:"required,max=100"`
+	UserID  string `json:"userId" validate:"max=255"`
+}
+
+// UpdateFeedbackRequest is the JSON body accepted by PATCH /api/feedback/{id}
+// Only the fields that are present are changed
+type UpdateFeedbackRequest struct {
+	Status *string `json:"status,omitempty" validate:"omitempty,oneof=new triaged closed"`
+	Note   *string `json:"note,omitempty" validate:"omitempty,max=2000"`
+}
+
+// Upload is one file uploaded straight to the upload bucket with a presigned URL (see uploads.go)
+type Upload struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	Key          string     `gorm:"uniqueIndex;not null" json:"key"` // The object's key in the bucket
+	Filename     string     `gorm:"not null" json:"filename"`
+	ContentType  string     `gorm:"not null" json:"contentType"`
+	Size         int64      `gorm:"not null" json:"size"` // In bytes, as declared; completing the upload checks the file has it
+	Zone         string     `json:"zone,omitempty"`
+	Status       string     `gorm:"not null;index" json:"status"` // "pending", "ready", or "rejected"
+	RejectReason string     `json:"rejectReason,omitempty"`
+	ExpiresAt    time.Time  `gorm:"not null" json:"expiresAt"` // When the upload URL stops working
+	CompletedAt  *time.Time `json:"completedAt,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
+
+// UploadCreated is the JSON structure returned when an upload is created: the client sends
+// the file with an HTTP PUT to UploadURL, with Headers, then completes the upload
+type UploadCreated struct {
+	Upload
+	UploadURL string            `json:"uploadUrl"`
+	Headers   map[string]string `json:"headers"`
+}
+
+// SearchResult is one match of GET /api/search
+type SearchResult struct {
+	Type    string  `json:"type"` // "user", "flag", or "announcement"
+	ID      string  `json:"id"`   // The user's or announcement's ID, or the flag's key
+	Title   string  `json:"title"`
+	Snippet string  `json:"snippet,omitempty"`
+	URL     string  `json:"url"`  // Where the API serves what matched
+	Rank    float64 `json:"rank"` // Higher is better; only comparable within one response
+}
+
+// SearchResponse is the JSON structure returned by GET /api/search
+type SearchResponse struct {
+	Query   string           `json:"query"`
+	Results []SearchResult   `json:"results"`
+	Facets  map[string]int64 `json:"facets"` // How many matches there are of each type, however many were returned
+}
+
+// ActivityEvent is one entry of the activity feed behind GET /api/activity (see activity.go)
+// Flag and user events belong to the project of the flag or user; zone incidents and deployments
+// have no project (ProjectID 0) and are seen by every project that sees their zone
+type ActivityEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ProjectID uint      `gorm:"not null;index" json:"-"`
+	Type      string    `gorm:"not null;index" json:"type"` // "flag", "user", "zone", or "deployment"
+	Action    string    `gorm:"not null" json:"action"`     // e.g. "created"; "incident" or "recovered" for zones; a deployment's status
+	Subject   string    `gorm:"not null" json:"subject"`    // The flag's key, the user's ID, or the zone's name
+	Zone      string    `json:"zone,omitempty"`             // Set for zone and deployment events
+	Summary   string    `gorm:"type:text;not null" json:"summary"`
+	CreatedAt time.Time `gorm:"index" json:"createdAt"`
+}
+
+// RetentionPolicy is one cleanup target as GET /api/retention reports it
+type RetentionPolicy struct {
+	Target        string     `json:"target"`   // The cleanup task's target, e.g. "audit"
+	Schedule      string     `json:"schedule"` // The built-in schedule that runs it, e.g. "cleanup-audit"
+	Tables        []string   `json:"tables"`
+	RetentionDays int        `json:"retentionDays"`    // 0 keeps everything
+	Cutoff        *time.Time `json:"cutoff,omitempty"` // Older rows are deleted; unset when everything is kept
+	Due           int64      `json:"due"`              // How many rows the cleanup would delete now
+}
+
+// Bundle is an environment's configuration as GET /api/export/bundle exports it and
+// POST /api/import/bundle imports it (see bundle.go). Entries have the same shape (and
+// validation) as the create endpoints' bodies; the flags are the project's, the rest is shared
+type Bundle struct {
+	Version       int                           `json:"version" validate:"required"` // Format version, 1
+	ExportedAt    time.Time                     `json:"exportedAt"`                  // Ignored on import
+	FeatureFlags  []CreateFeatureFlagRequest    `json:"featureFlags" validate:"dive"`
+	Announcements []CreateAnnouncementRequest   `json:"announcements" validate:"dive"`
+	Navigation    []CreateNavigationItemRequest `json:"navigation" validate:"dive"`
+	ZoneRoutes    []CreateZoneRouteRequest      `json:"zoneRoutes" validate:"dive"`
+}
+
+// BundleChange is one change that importing a bundle makes, or would make
+type BundleChange struct {
+	Resource string   `json:"resource"`         // "featureFlag", "announcement", "navigationItem", or "zoneRoute"
+	Key      string   `json:"key"`              // The flag's or item's key, the route's path, or the announcement's message
+	Action   string   `json:"action"`           // "created", "updated", or "deleted"
+	Fields   []string `json:"fields,omitempty"` // The fields an update changes
+}
+
+// BundleImportResponse is the JSON structure returned by POST /api/import/bundle, and by
+// POST /api/feature-flags/apply with only flag changes
+type BundleImportResponse struct {
+	DryRun    bool           `json:"dryRun"`    // Nothing was changed; Changes is what would be
+	Unchanged int            `json:"unchanged"` // Entries that already matched
+	Changes   []BundleChange `json:"changes"`
+}
+
+// Translation is the text of one field of a flag or announcement in one locale (see
+// translations.go); the flag or announcement itself has the default locale's text
+type Translation struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ProjectID uint      `gorm:"not null;uniqueIndex:idx_translations_subject,priority:1" json:"-"`        // The flag's project; 0 for announcements
+	Resource  string    `gorm:"not null;uniqueIndex:idx_translations_subject,priority:2" json:"resource"` // "flag" or "announcement"
+	Subject   string    `gorm:"not null;uniqueIndex:idx_translations_subject,priority:3" json:"subject"`  // The flag's key or the announcement's ID
+	Locale    string    `gorm:"not null;uniqueIndex:idx_translations_subject,priority:4" json:"locale"`   // BCP 47, e.g. "de" or "pt-BR"
+	Field     string    `gorm:"not null;uniqueIndex:idx_translations_subject,priority:5" json:"field"`    // "name", "description", or "message"
+	Text      string    `gorm:"type:text;not null" json:"text"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// FlagTranslation is a flag's name and description in one locale: the JSON body accepted by
+// PUT /api/feature-flags/{key}/translations/{locale}
+// An empty description falls back to the default locale's
+type FlagTranslation struct {
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description,omitempty" validate:"max=1000"`
+}
+
+// AnnouncementTranslation is an announcement's message in one locale: the JSON body accepted by
+// PUT /api/announcements/{id}/translations/{locale}
+type AnnouncementTranslation struct {
+	Message string `json:"message" validate:"required,max=2000"`
+}
+
+// ImageVariant is a resized copy of an image upload, stored next to it in the upload bucket
+type ImageVariant struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UploadID    uint      `gorm:"not null;uniqueIndex:idx_image_variants_upload_name,priority:1" json:"uploadId"`
+	Name        string    `gorm:"not null;uniqueIndex:idx_image_variants_upload_name,priority:2" json:"name"` // "thumb" or "medium"
+	Key         string    `gorm:"not null" json:"key"`
+	ContentType string    `gorm:"not null" json:"contentType"`
+	Width       int       `gorm:"not null" json:"width"`
+	Height      int       `gorm:"not null" json:"height"`
+	Size        int64     `gorm:"not null" json:"size"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// CreateUploadRequest is the JSON body accepted by POST /api/uploads
+type CreateUploadRequest struct {
+	Filename    string `json:"filename" validate:"required,max=255"`
+	ContentType string `json:"contentType" validate:"required,max=100"`
+	Size        int64  `json:"size" validate:"required,min=1"`
+	Zone        string `json:"zone" validate:"max=100"`
 }
@@ -0,0 +1,42 @@
+// Package pb holds the protobuf messages served to internal consumers that
+// ask for application/x-protobuf instead of JSON
+package pb
+
+//go:generate buf generate
+
+import (
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// FromHealthResponse converts a zone status response into its protobuf message
+func FromHealthResponse(response models.HealthResponse) *HealthResponse {
+	zones := make([]*ZoneStatus, len(response.Zones))
+	for i, zone := range response.Zones {
+		zones[i] = &ZoneStatus{
+			Name:      zone.Name,
+			Status:    zone.Status,
+			Url:       zone.URL,
+			LastCheck: timestamppb.New(zone.LastCheck),
+			Message:   zone.Message,
+		}
+	}
+	return &HealthResponse{Status: response.Status, Zones: zones}
+}
+
+// FromFeatureFlags converts a list of feature flags into its protobuf message
+func FromFeatureFlags(flags []models.FeatureFlag) *FeatureFlagList {
+	list := &FeatureFlagList{Flags: make([]*FeatureFlag, len(flags))}
+	for i, flag := range flags {
+		list.Flags[i] = &FeatureFlag{
+			Id:          uint64(flag.ID),
+			Key:         flag.Key,
+			Name:        flag.Name,
+			Description: flag.Description,
+			Enabled:     flag.Enabled,
+			CreatedAt:   timestamppb.New(flag.CreatedAt),
+			UpdatedAt:   timestamppb.New(flag.UpdatedAt),
+		}
+	}
+	return list
+}
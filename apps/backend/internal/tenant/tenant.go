@@ -0,0 +1,76 @@
+// Package tenant carries the project a request acts for, so the REST and GraphQL handlers
+// scope every user and feature flag query to it
+package tenant
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// DefaultProjectID is the project of requests that don't name one, and of every row
+// that existed before projects did
+const DefaultProjectID uint = 1
+
+// Project is what a request needs to know about its project
+type Project struct {
+	ID    uint
+	Zones []string // The zones the project sees; empty means every zone
+}
+
+// Default is the project of requests that don't name one
+var Default = Project{ID: DefaultProjectID}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx that acts for project
+func NewContext(ctx context.Context, project Project) context.Context {
+	return context.WithValue(ctx, contextKey{}, project)
+}
+
+// FromContext returns the project ctx acts for, or Default
+func FromContext(ctx context.Context) Project {
+	if project, ok := ctx.Value(contextKey{}).(Project); ok {
+		return project
+	}
+	return Default
+}
+
+// HasZone reports whether the project sees the zone named name
+func (p Project) HasZone(name string) bool {
+	return len(p.Zones) == 0 || slices.Contains(p.Zones, name)
+}
+
+// Scope limits a query to the rows of ctx's project, e.g. db.Scopes(tenant.Scope(ctx))
+func Scope(ctx context.Context) func(*gorm.DB) *gorm.DB {
+	id := FromContext(ctx).ID
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("project_id = ?", id)
+	}
+}
+
+// FlagKey is the flag cache and change feed key of the flag key in projectID
+// Flags of the default project keep their plain key; the others are "<projectID>/<key>"
+// (flag keys can't contain a slash)
+func FlagKey(projectID uint, key string) string {
+	if projectID == DefaultProjectID {
+		return key
+	}
+	return strconv.FormatUint(uint64(projectID), 10) + "/" + key
+}
+
+// SplitFlagKey undoes FlagKey
+func SplitFlagKey(scoped string) (uint, string) {
+	prefix, key, ok := strings.Cut(scoped, "/")
+	if !ok {
+		return DefaultProjectID, scoped
+	}
+	id, err := strconv.ParseUint(prefix, 10, 64)
+	if err != nil {
+		return DefaultProjectID, scoped
+	}
+	return uint(id), key
+}
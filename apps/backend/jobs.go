@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// The job queue runs background work outside request handlers: a handler (or a flag or zone
+// change) stores a row in the jobs table, usually in the same transaction as what the job works
+// on, and the leader (see leader.go) runs due jobs through the worker registered for their kind.
+// A failed job is retried with exponential backoff until it runs out of attempts and is dead,
+// where it stays until somebody retries or deletes it (POST /api/jobs/{id}/retry, DELETE /api/jobs/{id}).
+// A job is run at least once: one in flight while leadership moves runs again on the next leader,
+// so workers must be safe to repeat
+
+// jobBatchSize is how many due jobs of a kind are loaded at a time
+const jobBatchSize = 100
+
+// jobRuns counts job runs by kind and result: "succeeded", "retry" (failed, will be retried),
+// or "dead" (out of attempts, or failed for good)
+var jobRuns = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+	Name: "job_runs_total",
+	Help: "Background job runs, by kind and result (succeeded, retry, or dead).",
+}, []string{"kind", "result"})
+
+// jobWorker runs the jobs of one kind
+// run bounds its own work; the context it gets is only cancelled when leadership ends
+type jobWorker struct {
+	run         func(ctx context.Context, job models.Job) error
+	maxAttempts int
+	backoff     time.Duration // Before the first retry; doubles after each (see retryWait)
+	concurrency int           // Jobs of this kind run at once
+
+	wake chan struct{} // Signalled when jobs are queued, so the leader needn't wait for the next poll
+}
+
+// permanentJobError is a failure that retrying can't fix, so the job is dead right away
+type permanentJobError struct{ err error }
+
+func (e *permanentJobError) Error() string { return e.err.Error() }
+func (e *permanentJobError) Unwrap() error { return e.err }
+
+// permanent marks err as not worth retrying
+func permanent(err error) error {
+	return &permanentJobError{err: err}
+}
+
+// jobQueue stores jobs and runs them through the registered workers
+type jobQueue struct {
+	db      *gorm.DB
+	cfg     JobsConfig
+	workers map[string]*jobWorker
+
+	logLevel *logLevel // The server's, for debug lines about failed attempts
+}
+
+// newJobQueue creates a queue that stores jobs in database
+// Register every worker before run starts; jobs are only run while run is running (a leader task)
+func newJobQueue(database *gorm.DB, cfg JobsConfig) *jobQueue {
+	return &jobQueue{db: database, cfg: cfg, workers: map[string]*jobWorker{}}
+}
+
+// register sets the worker for kind, e.g. "email.send"
+func (q *jobQueue) register(kind string, worker jobWorker) {
+	worker.wake = make(chan struct{}, 1)
+	q.workers[kind] = &worker
+}
+
+// enqueue stores a pending job of kind for every payload, each encoded as JSON
+// tx is the transaction that stores what the jobs work on, or the queue's database; call
+// notify once it is committed
+func (q *jobQueue) enqueue(tx *gorm.DB, kind string, payloads ...interface{}) error {
+	worker, ok := q.workers[kind]
+	if !ok {
+		return fmt.Errorf("no worker for job kind %q", kind)
+	}
+	now := time.Now()
+	jobs := make([]models.Job, len(payloads))
+	for i, payload := range payloads {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		jobs[i] = models.Job{Kind: kind, Payload: string(data), Status: "pending", MaxAttempts: worker.maxAttempts, RunAt: now}
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+	return tx.Create(&jobs).Error
+}
+
+// notify starts jobs of kind queued on this replica without waiting for the next poll
+func (q *jobQueue) notify(kind string) {
+	worker, ok := q.workers[kind]
+	if !ok {
+		return
+	}
+	select {
+	case worker.wake <- struct{}{}:
+	default: // A wake-up is already pending
+	}
+}
+
+// run runs due jobs of every kind until ctx is cancelled; registered as a leader task
+// Each kind has its own loop, so a slow webhook target doesn't hold up email
+func (q *jobQueue) run(ctx context.Context) {
+	// Jobs a previous leader was running when it stopped never finished
+	if result := q.db.WithContext(ctx).Model(&models.Job{}).Where("status = ?", "running").Update("status", "pending"); result.Error != nil {
+		log.Printf("Failed to requeue running jobs: %v", result.Error)
+	} else if result.RowsAffected > 0 {
+		log.Printf("Requeued %d jobs left running by the previous leader", result.RowsAffected)
+	}
+
+	group := errgroup.Group{}
+	for kind, worker := range q.workers {
+		group.Go(func() error {
+			q.work(ctx, kind, worker)
+			return nil
+		})
+	}
+	group.Wait()
+}
+
+// work runs due jobs of kind every JOB_POLL_INTERVAL, and right away when this replica
+// queues some, until ctx is cancelled
+func (q *jobQueue) work(ctx context.Context, kind string, worker *jobWorker) {
+	ticker := time.NewTicker(q.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		for q.runDue(ctx, kind, worker) == jobBatchSize && ctx.Err() == nil {
+			// A full batch: there may be more due right now
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-worker.wake:
+		}
+	}
+}
+
+// runDue runs one batch of due jobs of kind, oldest first, and returns how many there were
+func (q *jobQueue) runDue(ctx context.Context, kind string, worker *jobWorker) int {
+	var due []models.Job
+	err := q.db.WithContext(ctx).Clauses(dbresolver.Write).
+		Where("kind = ? AND status = ? AND run_at <= ?", kind, "pending", time.Now()).
+		Order("run_at").Limit(jobBatchSize).Find(&due).Error
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Failed to load due %s jobs: %v", kind, err)
+		}
+		return 0
+	}
+
+	group := errgroup.Group{}
+	group.SetLimit(worker.concurrency)
+	for _, job := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		group.Go(func() error {
+			q.execute(ctx, worker, job)
+			return nil
+		})
+	}
+	group.Wait()
+	return len(due)
+}
+
+// execute runs job once and records the outcome
+func (q *jobQueue) execute(ctx context.Context, worker *jobWorker, job models.Job) {
+	now := time.Now()
+	claimed := q.db.WithContext(ctx).Model(&models.Job{}).Where("id = ? AND status = ?", job.ID, "pending").
+		Updates(map[string]interface{}{"status": "running", "attempts": gorm.Expr("attempts + 1"), "started_at": now})
+	if claimed.Error != nil || claimed.RowsAffected == 0 {
+		return // Deleted, or already taken
+	}
+	job.Attempts++
+
+	err := worker.run(ctx, job)
+
+	// Not tied to the leader's context: a run that happened is recorded even if leadership just ended
+	updates := map[string]interface{}{"status": "pending", "last_error": ""}
+	var stopped *permanentJobError
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// Leadership ended mid-run; the next leader runs it again without counting this attempt
+		updates["attempts"] = job.Attempts - 1
+		delete(updates, "last_error")
+	case err == nil:
+		updates["status"], updates["finished_at"] = "succeeded", time.Now()
+		jobRuns.WithLabelValues(job.Kind, "succeeded").Inc()
+	case errors.As(err, &stopped) || job.Attempts >= job.MaxAttempts:
+		updates["status"], updates["last_error"], updates["finished_at"] = "dead", err.Error(), time.Now()
+		jobRuns.WithLabelValues(job.Kind, "dead").Inc()
+		log.Printf("Job %d (%s) is dead after %d attempts: %v", job.ID, job.Kind, job.Attempts, err)
+	default:
+		updates["last_error"], updates["run_at"] = err.Error(), time.Now().Add(retryWait(worker.backoff, job.Attempts))
+		jobRuns.WithLabelValues(job.Kind, "retry").Inc()
+		q.logLevel.debugf("job %d (%s) attempt %d failed: %v", job.ID, job.Kind, job.Attempts, err)
+	}
+	if err := q.db.Model(&models.Job{}).Where("id = ?", job.ID).Updates(updates).Error; err != nil {
+		log.Printf("Failed to record job %d: %v", job.ID, err)
+	}
+}
+
+// decodeJobPayload reads job's payload into v; a payload that doesn't fit is a permanent failure
+func decodeJobPayload(job models.Job, v interface{}) error {
+	if err := json.Unmarshal([]byte(job.Payload), v); err != nil {
+		return permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+	return nil
+}
+
+// prune deletes succeeded jobs older than JOB_RETENTION_DAYS and returns how many there were
+// (on a dry run, would be); dead jobs wait for somebody to look at them. The cleanup-jobs schedule (see schedules.go)
+func (q *jobQueue) prune(ctx context.Context, dryRun bool) (int64, error) {
+	if q.cfg.RetentionDays <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().AddDate(0, 0, -q.cfg.RetentionDays)
+	return purge(q.db.WithContext(ctx).Where("status = ? AND created_at < ?", "succeeded", cutoff), &models.Job{}, dryRun)
+}
+
+// jobFilterFields are the job fields ?filter= and ?orderby= accept
+var jobFilterFields = filterFields{
+	"id":        {Column: "id", Kind: filterNumber},
+	"kind":      {Column: "kind", Kind: filterString},
+	"status":    {Column: "status", Kind: filterString},
+	"attempts":  {Column: "attempts", Kind: filterNumber},
+	"runAt":     {Column: "run_at", Kind: filterTime},
+	"createdAt": {Column: "created_at", Kind: filterTime},
+}
+
+// getJobsHandler responds to GET /api/jobs
+// Jobs newest first (the latest 100 unless a page size is asked for), narrowed with the shared
+// ?filter= and ?orderby= parameters, e.g. ?filter=status eq "dead" for the dead letters
+func (s *Server) getJobsHandler(w http.ResponseWriter, r *http.Request) {
+	listQuery, err := parseListQuery(r, jobFilterFields)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid query: "+err.Error())
+		return
+	}
+	if r.URL.Query().Get("pageSize") == "" {
+		listQuery.page.PageSize = min(listQuery.page.PageSize, 100)
+	}
+
+	var jobs []models.Job
+	if err := listQuery.apply(s.db.WithContext(r.Context()).Model(&models.Job{}), "id DESC").Find(&jobs).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	setNextPageLink(w, r, listQuery.page, len(jobs))
+	writeJSON(w, r, http.StatusOK, jobs)
+}
+
+// getJobHandler responds to GET /api/jobs/{id}
+func (s *Server) getJobHandler(w http.ResponseWriter, r *http.Request) {
+	if job, ok := findByID[models.Job](w, r, s.db, "Job"); ok {
+		writeJSON(w, r, http.StatusOK, job)
+	}
+}
+
+// retryJobHandler responds to POST /api/jobs/{id}/retry
+// A dead job is queued again with all of its attempts; other jobs are refused
+func (s *Server) retryJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := findByID[models.Job](w, r, s.db, "Job")
+	if !ok {
+		return
+	}
+	if job.Status != "dead" {
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("Only dead jobs can be retried, not %s ones", job.Status))
+		return
+	}
+
+	updates := map[string]interface{}{"status": "pending", "attempts": 0, "run_at": time.Now(), "finished_at": nil}
+	// The status guard keeps two retries from both succeeding
+	result := s.db.WithContext(r.Context()).Model(&models.Job{}).Where("id = ? AND status = ?", job.ID, "dead").Updates(updates)
+	if result.Error != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		writeError(w, r, http.StatusConflict, "Job was retried already")
+		return
+	}
+	log.Printf("Job %d (%s) retried", job.ID, job.Kind)
+
+	var retried models.Job
+	if err := s.db.WithContext(r.Context()).Clauses(dbresolver.Write).First(&retried, job.ID).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	s.jobs.notify(job.Kind)
+	writeJSON(w, r, http.StatusOK, retried)
+}
+
+// deleteJobHandler responds to DELETE /api/jobs/{id}
+// Only dead jobs can be deleted: a pending one would leave its work undone without a trace
+func (s *Server) deleteJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := findByID[models.Job](w, r, s.db, "Job")
+	if !ok {
+		return
+	}
+	if job.Status != "dead" {
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("Only dead jobs can be deleted, not %s ones", job.Status))
+		return
+	}
+	if err := s.db.WithContext(r.Context()).Where("id = ? AND status = ?", job.ID, "dead").Delete(&models.Job{}).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "Job deleted successfully"})
+}
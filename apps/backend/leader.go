@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// Some background work has to happen once per deployment rather than once per replica, e.g.
+// pruning api_usage. Those loops are registered with a leaderElector, which runs them only on
+// the replica holding the Kubernetes Lease LEADER_ELECTION_LEASE_NAME and cancels them as soon
+// as it stops holding it. Per-replica work (usage flushes, the flag snapshot, LISTEN/NOTIFY,
+// zone checks behind each replica's own snapshot) keeps running everywhere
+
+// Where a pod finds its namespace when neither LEADER_ELECTION_NAMESPACE nor POD_NAMESPACE is set
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// leaderElectionLeading is 1 on the replica running the leader tasks; summed over pods it should be 1
+var leaderElectionLeading = promauto.With(metricsRegistry).NewGauge(prometheus.GaugeOpts{
+	Name: "leader_election_leading",
+	Help: "1 while this replica holds the leader lease and runs the cluster-wide background tasks",
+})
+
+// leaderTask is a background loop that runs on the leader until ctx is cancelled
+type leaderTask struct {
+	name string
+	run  func(ctx context.Context)
+}
+
+// leaderElector runs the registered tasks while this replica is the leader
+// With LEADER_ELECTION_ENABLED=false (one replica, local development, tests) it is always the leader
+type leaderElector struct {
+	cfg      LeaderConfig
+	identity string               // This replica in the Lease, the pod name
+	client   kubernetes.Interface // Set by start from the in-cluster config unless already set
+	tasks    []leaderTask
+
+	leading atomic.Bool
+	holder  atomic.Pointer[string] // Identity of the current leader, as last observed
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc // Stops the running tasks; nil while not leading
+	running sync.WaitGroup
+
+	stopElection context.CancelFunc
+	elected      chan struct{} // Closed when the election loop has returned
+}
+
+// leaderStatus is the GET /internal/leader response
+type leaderStatus struct {
+	Enabled  bool     `json:"enabled"`
+	Identity string   `json:"identity"`
+	Leader   string   `json:"leader"` // Empty while nobody holds the lease
+	Leading  bool     `json:"leading"`
+	Tasks    []string `json:"tasks"`
+}
+
+// newLeaderElector creates an elector for this pod; register tasks with onLeader, then call start
+func newLeaderElector(cfg LeaderConfig) *leaderElector {
+	identity, err := os.Hostname()
+	if err != nil || identity == "" {
+		identity = fmt.Sprintf("backend-%d", os.Getpid())
+	}
+	return &leaderElector{cfg: cfg, identity: identity, elected: make(chan struct{})}
+}
+
+// onLeader registers a task to run while this replica leads; run must return once ctx is cancelled
+// Tasks are registered before start; one that is running when the lease is lost is cancelled,
+// and started again from scratch if this replica becomes the leader again
+func (l *leaderElector) onLeader(name string, run func(ctx context.Context)) {
+	l.tasks = append(l.tasks, leaderTask{name: name, run: run})
+}
+
+// start begins competing for the lease (or, with leader election off, starts the tasks right away)
+func (l *leaderElector) start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	l.stopElection = cancel
+	if !l.cfg.Enabled {
+		l.holder.Store(&l.identity)
+		l.startLeading(ctx)
+		close(l.elected)
+		return nil
+	}
+
+	if l.client == nil {
+		restConfig, err := rest.InClusterConfig()
+		if err != nil {
+			cancel()
+			return fmt.Errorf("leader election needs to run in Kubernetes: %w", err)
+		}
+		if l.client, err = kubernetes.NewForConfig(restConfig); err != nil {
+			cancel()
+			return err
+		}
+	}
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Name: l.cfg.LeaseName, Namespace: leaseNamespace(l.cfg.Namespace)},
+		Client:     l.client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: l.identity},
+	}
+	electionConfig := leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: l.cfg.LeaseDuration,
+		RenewDeadline: l.cfg.RenewDeadline,
+		RetryPeriod:   l.cfg.RetryPeriod,
+		Name:          l.cfg.LeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: l.startLeading,
+			OnStoppedLeading: l.stopLeading,
+			OnNewLeader: func(identity string) {
+				l.holder.Store(&identity)
+				if identity != l.identity {
+					log.Printf("Leader election: %s is the leader", identity)
+				}
+			},
+		},
+	}
+	// Checks the timings (e.g. RENEW_DEADLINE must exceed 1.2 × RETRY_PERIOD) before anything runs
+	if _, err := leaderelection.NewLeaderElector(electionConfig); err != nil {
+		cancel()
+		return fmt.Errorf("invalid leader election settings: %w", err)
+	}
+	log.Printf("Leader election: %s competing for lease %s/%s", l.identity, lock.LeaseMeta.Namespace, lock.LeaseMeta.Name)
+	go l.elect(ctx, electionConfig)
+	return nil
+}
+
+// elect keeps competing for the lease until stop is called
+// Run returns each time leadership is lost, after OnStoppedLeading has waited for the tasks
+func (l *leaderElector) elect(ctx context.Context, electionConfig leaderelection.LeaderElectionConfig) {
+	defer close(l.elected)
+	for ctx.Err() == nil {
+		elector, _ := leaderelection.NewLeaderElector(electionConfig) // Validated by start
+		elector.Run(ctx)
+	}
+	// The lease is released here once the tasks are done, not by Run (ReleaseOnCancel),
+	// which would let another replica start them while the last run here is still finishing
+	l.release(electionConfig.Lock)
+}
+
+// startLeading starts every task with a context cancelled when leadership ends
+func (l *leaderElector) startLeading(ctx context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ctx.Err() != nil {
+		return // Run calls this in a goroutine, which may start after leadership was already lost
+	}
+	ctx, l.cancel = context.WithCancel(ctx)
+	l.leading.Store(true)
+	leaderElectionLeading.Set(1)
+	if l.cfg.Enabled {
+		log.Printf("Leader election: %s is now the leader", l.identity)
+	}
+
+	for _, task := range l.tasks {
+		l.running.Add(1)
+		go func(task leaderTask) {
+			defer l.running.Done()
+			task.run(ctx)
+		}(task)
+	}
+}
+
+// stopLeading cancels the tasks and waits for them to return
+func (l *leaderElector) stopLeading() {
+	l.mu.Lock()
+	cancel := l.cancel
+	l.cancel = nil
+	l.mu.Unlock()
+	if cancel == nil {
+		return // Never led during this round of Run
+	}
+
+	cancel()
+	l.running.Wait()
+	l.leading.Store(false)
+	leaderElectionLeading.Set(0)
+	if l.cfg.Enabled {
+		log.Printf("Leader election: %s stopped leading", l.identity)
+	}
+}
+
+// release gives up the lease right away, so another replica takes over without waiting
+// LEADER_ELECTION_LEASE_DURATION for it to expire
+func (l *leaderElector) release(lock resourcelock.Interface) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.cfg.RenewDeadline)
+	defer cancel()
+	record, _, err := lock.Get(ctx)
+	if err != nil || record.HolderIdentity != l.identity {
+		return
+	}
+	now := metav1.Now()
+	released := resourcelock.LeaderElectionRecord{
+		LeaderTransitions:    record.LeaderTransitions,
+		LeaseDurationSeconds: 1,
+		AcquireTime:          now,
+		RenewTime:            now,
+	}
+	if err := lock.Update(ctx, released); err != nil {
+		log.Printf("Leader election: failed to release the lease: %v", err)
+		return
+	}
+	log.Printf("Leader election: %s released the lease", l.identity)
+}
+
+// stop ends the election during shutdown: the tasks are cancelled and waited for, then the
+// lease is released. Safe to call on a nil elector
+func (l *leaderElector) stop() {
+	if l == nil || l.stopElection == nil {
+		return
+	}
+	l.stopElection()
+	<-l.elected
+	if !l.cfg.Enabled {
+		l.stopLeading()
+	}
+}
+
+// isLeading reports whether this replica runs the leader tasks
+// A nil elector (a Server built without one, as in tests) counts as leading
+func (l *leaderElector) isLeading() bool {
+	return l == nil || l.leading.Load()
+}
+
+// status reports the election as this replica sees it
+func (l *leaderElector) status() leaderStatus {
+	status := leaderStatus{
+		Enabled:  l.cfg.Enabled,
+		Identity: l.identity,
+		Leading:  l.leading.Load(),
+		Tasks:    []string{},
+	}
+	if holder := l.holder.Load(); holder != nil {
+		status.Leader = *holder
+	}
+	for _, task := range l.tasks {
+		status.Tasks = append(status.Tasks, task.name)
+	}
+	return status
+}
+
+// leaderHandler responds to GET /internal/leader
+func (l *leaderElector) leaderHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, l.status())
+}
+
+// leaseNamespace returns configured (LEADER_ELECTION_NAMESPACE), POD_NAMESPACE, or the pod's service account namespace
+func leaseNamespace(configured string) string {
+	if configured != "" {
+		return configured
+	}
+	if namespace := os.Getenv("POD_NAMESPACE"); namespace != "" {
+		return namespace
+	}
+	if data, err := os.ReadFile(serviceAccountNamespaceFile); err == nil {
+		if namespace := strings.TrimSpace(string(data)); namespace != "" {
+			return namespace
+		}
+	}
+	return "default"
+}
+
+// runEvery calls fn now and then every interval until ctx is cancelled; for leader tasks
+func runEvery(ctx context.Context, interval time.Duration, fn func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		fn(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
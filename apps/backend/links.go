@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+)
+
+// link is a hypermedia link to a related resource or an action on the resource
+// Clients follow links instead of building URLs, so paths can change between API versions
+type link struct {
+	Href   string `json:"href"`
+	Method string `json:"method,omitempty"` // HTTP method for actions (e.g., "PATCH"); omitted for plain GET links
+}
+
+// resourceLinks maps a link relation (e.g., "self", "collection", "toggle") to its link
+type resourceLinks map[string]link
+
+// linkedUser is a user with its links, used by v2 and JSON:API responses
+type linkedUser struct {
+	models.User
+	Links resourceLinks `json:"links"`
+}
+
+// linkedFeatureFlag is a feature flag with its links, used by v2 and JSON:API responses
+type linkedFeatureFlag struct {
+	models.FeatureFlag
+	Links resourceLinks `json:"links"`
+}
+
+// apiPrefix returns the path prefix of the API version that served the request, under BASE_PATH
+// Links always point back into the same version the client is using
+func apiPrefix(r *http.Request) string {
+	if apiVersion(r) >= 2 {
+		return requestConfig(r).Server.BasePath + "/api/v2"
+	}
+	return requestConfig(r).Server.BasePath + "/api"
+}
+
+// userLinks returns the links for a user
+func userLinks(prefix string, user models.User) resourceLinks {
+	self := fmt.Sprintf("%s/users/%d", prefix, user.ID)
+	return resourceLinks{
+		"self":       {Href: self},
+		"collection": {Href: prefix + "/users"},
+		"delete":     {Href: self, Method: http.MethodDelete},
+	}
+}
+
+// flagLinks returns the links for a feature flag
+// "toggle" is a PATCH of {"enabled": <opposite of the current value>} to the flag,
+// and "changes" is the long-polling feed that reports when flags are updated
+func flagLinks(prefix string, flag models.FeatureFlag) resourceLinks {
+	self := prefix + "/feature-flags/" + url.PathEscape(flag.Key)
+	return resourceLinks{
+		"self":       {Href: self},
+		"collection": {Href: prefix + "/feature-flags"},
+		"toggle":     {Href: self, Method: http.MethodPatch},
+		"delete":     {Href: self, Method: http.MethodDelete},
+		"changes":    {Href: prefix + "/changes"},
+	}
+}
+
+// withLinks adds links to users and feature flags; other values are returned unchanged
+func withLinks(r *http.Request, v interface{}) interface{} {
+	prefix := apiPrefix(r)
+	switch value := v.(type) {
+	case models.User:
+		return linkedUser{User: value, Links: userLinks(prefix, value)}
+	case []models.User:
+		linked := make([]linkedUser, len(value))
+		for i, user := range value {
+			linked[i] = linkedUser{User: user, Links: userLinks(prefix, user)}
+		}
+		return linked
+	case models.FeatureFlag:
+		return linkedFeatureFlag{FeatureFlag: value, Links: flagLinks(prefix, value)}
+	case []models.FeatureFlag:
+		linked := make([]linkedFeatureFlag, len(value))
+		for i, flag := range value {
+			linked[i] = linkedFeatureFlag{FeatureFlag: flag, Links: flagLinks(prefix, flag)}
+		}
+		return linked
+	default:
+		return v
+	}
+}
+
+// toJSONAPILinks converts resource links into a JSON:API links object
+// JSON:API link objects can't carry a method, so actions put it in meta
+func toJSONAPILinks(links resourceLinks) map[string]interface{} {
+	result := make(map[string]interface{}, len(links))
+	for rel, l := range links {
+		if l.Method == "" {
+			result[rel] = l.Href
+			continue
+		}
+		result[rel] = map[string]interface{}{
+			"href": l.Href,
+			"meta": map[string]string{"method": l.Method},
+		}
+	}
+	return result
+}
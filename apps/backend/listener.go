@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// newListener opens the listener described by LISTEN (or PORT) in cfg
+// LISTEN accepts "unix:/path/to/socket" for a Unix domain socket, or a TCP
+// address ("tcp::8080", ":8080", "127.0.0.1:8080"); when empty we listen on PORT
+// It returns the listener and a human readable address for the startup log
+func newListener(cfg ServerConfig) (net.Listener, string, error) {
+	addr := cfg.Listen
+	if addr == "" {
+		addr = ":" + strconv.Itoa(cfg.Port)
+	}
+
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		return newUnixListener(path, cfg.ListenSocketMode)
+	}
+
+	addr = strings.TrimPrefix(addr, "tcp:")
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, "", err
+	}
+	return ln, addr, nil
+}
+
+// newUnixListener listens on a Unix domain socket at path, with the permissions in socketMode (LISTEN_SOCKET_MODE)
+func newUnixListener(path, socketMode string) (net.Listener, string, error) {
+	if path == "" {
+		return nil, "", fmt.Errorf("LISTEN=unix: requires a socket path")
+	}
+
+	mode, err := strconv.ParseUint(socketMode, 8, 32)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid LISTEN_SOCKET_MODE %q: %w", socketMode, err)
+	}
+
+	// A socket file left behind by a previous run (e.g., after a crash) would make Listen fail
+	// Only sockets are removed so a typo in LISTEN can't delete a regular file
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, "", fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+		ln.Close()
+		return nil, "", fmt.Errorf("failed to set permissions on %s: %w", path, err)
+	}
+	return ln, "unix:" + path, nil
+}
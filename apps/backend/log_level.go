@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm/logger"
+)
+
+// Log levels, from most to least verbose
+// debug: also logs every SQL query and cache/zone/notification details
+// info:  the default; startup, errors, slow queries, and access logs
+// warn:  drops access log lines for successful requests
+const (
+	levelDebug int32 = iota
+	levelInfo
+	levelWarn
+)
+
+var logLevelNames = map[int32]string{levelDebug: "debug", levelInfo: "info", levelWarn: "warn"}
+
+// logLevel is a Server's log level; PUT /internal/log-level changes it at runtime
+// A nil *logLevel stays at info, for code that runs without one
+type logLevel struct {
+	level atomic.Int32
+
+	// A temporary level change (PUT with a duration) is undone by revert
+	mu       sync.Mutex
+	revert   *time.Timer
+	revertTo int32
+	until    time.Time
+}
+
+// newLogLevel starts at the named level (LOG_LEVEL), or info if the name isn't one
+func newLogLevel(name string) *logLevel {
+	l := &logLevel{}
+	level, ok := parseLogLevel(name)
+	if !ok {
+		level = levelInfo
+	}
+	l.level.Store(level)
+	return l
+}
+
+// parseLogLevel converts "debug", "info", or "warn" to a level
+func parseLogLevel(name string) (int32, bool) {
+	for level, levelName := range logLevelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, true
+		}
+	}
+	return 0, false
+}
+
+// get returns the current level
+func (l *logLevel) get() int32 {
+	if l == nil {
+		return levelInfo
+	}
+	return l.level.Load()
+}
+
+// set changes the level, leaving a pending revert in place
+func (l *logLevel) set(level int32) {
+	l.level.Store(level)
+}
+
+// debugEnabled reports whether debug logging is on
+func (l *logLevel) debugEnabled() bool {
+	return l.get() <= levelDebug
+}
+
+// debugf logs only at the debug level
+func (l *logLevel) debugf(format string, args ...interface{}) {
+	if l.debugEnabled() {
+		log.Printf("level=debug msg=%q", fmt.Sprintf(format, args...))
+	}
+}
+
+// gormLevel is the GORM logger level matching the current log level
+func (l *logLevel) gormLevel() logger.LogLevel {
+	if l.debugEnabled() {
+		return logger.Info // Every query
+	}
+	return logger.Warn // Slow and failed queries
+}
+
+// logLevelRequest is the body of PUT /internal/log-level
+type logLevelRequest struct {
+	Level string `json:"level" validate:"required,oneof=debug info warn"`
+	// Optional: switch back to the previous level after this long (e.g., "15m")
+	Duration string `json:"duration,omitempty"`
+}
+
+// logLevelResponse describes the current level
+type logLevelResponse struct {
+	Level     string     `json:"level"`
+	RevertsAt *time.Time `json:"revertsAt,omitempty"` // When a temporary change ends
+}
+
+// describe describes the level for responses; the caller holds l.mu
+func (l *logLevel) describe() logLevelResponse {
+	response := logLevelResponse{Level: logLevelNames[l.get()]}
+	if l.revert != nil {
+		until := l.until
+		response.RevertsAt = &until
+	}
+	return response
+}
+
+// getLogLevelHandler responds to GET /internal/log-level
+func (s *Server) getLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	l := s.live.logLevel
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	writeJSON(w, r, http.StatusOK, l.describe())
+}
+
+// setLogLevelHandler responds to PUT /internal/log-level
+// With a duration the previous level comes back on its own, so debug logging
+// switched on during an incident can't be forgotten
+func (s *Server) setLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	var req logLevelRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	var duration time.Duration
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			writeError(w, r, http.StatusBadRequest, "duration must be a positive Go duration, e.g. 15m")
+			return
+		}
+		duration = d
+	}
+
+	level, _ := parseLogLevel(req.Level)
+
+	l := s.live.logLevel
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// A new change replaces any pending revert; the level it reverts to is
+	// the one before the first temporary change
+	previous := l.get()
+	if l.revert != nil {
+		l.revert.Stop()
+		l.revert = nil
+		previous = l.revertTo
+	}
+
+	l.set(level)
+	if duration > 0 {
+		l.revertTo = previous
+		l.until = time.Now().Add(duration)
+		var timer *time.Timer
+		timer = time.AfterFunc(duration, func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			// Stop can lose the race with a timer that already fired
+			if l.revert != timer {
+				return
+			}
+			l.set(l.revertTo)
+			l.revert = nil
+			log.Printf("Log level reverted to %s", logLevelNames[l.revertTo])
+		})
+		l.revert = timer
+		log.Printf("Log level set to %s for %s", req.Level, duration)
+	} else {
+		log.Printf("Log level set to %s", req.Level)
+	}
+
+	writeJSON(w, r, http.StatusOK, l.describe())
+}
@@ -1,111 +1,227 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
-	"os"
-	"sync"
+	"strings"
 	"time"
 
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/nextjs-microfrontend/backend/internal/graph"
 	"github.com/nextjs-microfrontend/backend/internal/models"
-	"github.com/rs/cors"
-	"gorm.io/driver/postgres"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
 )
 
-// ZoneStatus represents the health status of a single zone (Next.js app)
-// This struct will be converted to JSON when sent to clients
-type ZoneStatus struct {
-	Name      string    `json:"name"`      // Name of the zone (e.g., "zone-main")
-	Status    string    `json:"status"`    // Health status: "healthy", "unhealthy", or "degraded"
-	URL       string    `json:"url"`       // URL that was checked
-	LastCheck time.Time `json:"lastCheck"` // When we last checked this zone
-	Message   string    `json:"message"`   // Human-readable message about the status
+// postgresDSN builds a PostgreSQL connection string for host
+// Replicas share the primary's port, credentials, and database name
+// Format: "host=localhost user=admin password=secret dbname=mydb port=5432"
+func postgresDSN(cfg DatabaseConfig, host string) string {
+	return fmt.Sprintf(
+		"host=%s user=%s password=%s dbname=%s port=%d sslmode=disable",
+		host,
+		cfg.User,
+		cfg.Password,
+		cfg.Name,
+		cfg.Port,
+	)
 }
 
-// HealthResponse is the JSON structure returned by /api/zones/status
-// Contains overall status and array of individual zone statuses
-type HealthResponse struct {
-	Status string       `json:"status"` // Overall API status
-	Zones  []ZoneStatus `json:"zones"`  // Array of zone health statuses
-}
+// initDB initializes the database connection for the server and runs migrations
+// It connects to PostgreSQL (or SQLite or MySQL, see DB_DRIVER) and creates/updates the database schema
+func initDB(cfg DatabaseConfig, level *logLevel) (*gorm.DB, error) {
+	database, err := openPrimaryDB(cfg, level)
+	if err != nil {
+		return nil, err
+	}
 
-// Global variables
-var (
-	// Database connection (will be initialized in main)
-	db *gorm.DB
+	// Runs before replicas are registered so schema inspection always reads the primary
+	// With DB_AUTO_MIGRATE=false migrations are left to `backend migrate up`
+	if cfg.AutoMigrate {
+		if err := migrateSchema(database); err != nil {
+			return nil, err
+		}
+	}
 
-	// Feature flag cache for performance
-	// Stores feature flags in memory to reduce database queries
-	// Key: flag key (string), Value: FeatureFlag struct
-	flagCache sync.Map
+	if err := useReadReplicas(database, cfg); err != nil {
+		return nil, err
+	}
 
-	// Zone URLs for health checks
-	// These are INTERNAL Kubernetes service URLs (pod-to-pod communication)
-	zoneMainURL  = getEnv("ZONE_MAIN_URL", "http://zone-main")
-	zoneAdminURL = getEnv("ZONE_ADMIN_URL", "http://zone-admin/admin")
-)
+	log.Println("Database connected and migrated successfully")
+	return database, nil
+}
 
-// getEnv retrieves an environment variable or returns a fallback value
-// This is useful for configuration that changes between environments
-func getEnv(key, fallback string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// openPrimaryDB connects to the primary database with query tracing, metrics,
+// and pool limits; shared by the server and the seed and migrate commands
+// Queries are logged at level (see db_logger.go)
+func openPrimaryDB(cfg DatabaseConfig, level *logLevel) (*gorm.DB, error) {
+	// Open connection to PostgreSQL, or whatever DB_DRIVER selects (see dialect.go)
+	// Single statements don't need GORM's implicit transaction; multi-step writes
+	// (e.g., updating a flag) use db.Transaction explicitly
+	// Failed and slow queries are logged by dbLogger (see db_logger.go)
+	// Creating a slice inserts DB_BATCH_SIZE rows per statement
+	database, err := openWithRetry(cfg, primaryDialector(cfg), &gorm.Config{
+		SkipDefaultTransaction: true,
+		CreateBatchSize:        cfg.BatchSize,
+		Logger:                 newDBLogger(cfg.SlowQueryThreshold, level),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
-	return fallback
-}
 
-// initDB initializes the database connection and runs migrations
-// It connects to PostgreSQL and creates/updates the database schema
-func initDB() (*gorm.DB, error) {
-	// Build PostgreSQL connection string
-	// Format: "host=localhost user=admin password=secret dbname=mydb port=5432"
-	dsn := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		getEnv("DB_HOST", "postgres"),
-		getEnv("DB_USER", "admin"),
-		getEnv("DB_PASSWORD", "devpassword"),
-		getEnv("DB_NAME", "multizone"),
-		getEnv("DB_PORT", "5432"),
-	)
+	// Every query becomes a span under its request's trace (see tracing.go)
+	// and is counted and timed per table on /metrics (see metrics.go)
+	if err := database.Use(gormTracing{}); err != nil {
+		return nil, fmt.Errorf("failed to enable query tracing: %w", err)
+	}
+	if err := database.Use(gormMetrics{}); err != nil {
+		return nil, fmt.Errorf("failed to enable query metrics: %w", err)
+	}
 
-	// Open connection to PostgreSQL
-	database, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	// Connection pool limits
+	// database/sql allows unlimited open connections by default, which exhausts
+	// our small Postgres instance under load; requests wait for a free connection instead
+	sqlDB, err := database.DB()
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %w", err)
+		return nil, fmt.Errorf("failed to access connection pool: %w", err)
+	}
+	if usingSQLite(database) {
+		configureSQLitePool(sqlDB)
+	} else {
+		sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+		sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+		sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+		sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 	}
 
+	return database, nil
+}
+
+// migrateSchema creates and updates the tables, then applies pending migrations
+func migrateSchema(database *gorm.DB) error {
 	// Auto-migrate the database models
 	// This will create tables if they don't exist
 	// If tables exist, it will update them (add new columns, but won't delete existing ones)
-	if err := database.AutoMigrate(&models.User{}, &models.FeatureFlag{}); err != nil {
-		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	if err := database.AutoMigrate(&models.User{}, &models.FeatureFlag{}, &models.DeploymentEvent{}, &models.APIUsage{}, &models.BackupJob{},
+		&models.WebhookSubscription{}, &models.WebhookDelivery{}, &models.EmailMessage{}, &models.EmailSuppression{},
+		&models.Job{}, &models.Schedule{}, &models.ScheduleRun{}, &models.Announcement{},
+		&models.NavigationItem{}, &models.ZoneRoute{}, &models.ZoneRouteChange{},
+		&models.Experiment{}, &models.ExperimentAssignment{}, &models.ExperimentEvent{},
+		&models.AnalyticsRollup{}, &models.AnalyticsVisitor{},
+		&models.Organization{}, &models.Project{}, &models.ProjectAPIKey{},
+		&models.ContactSubmission{}, &models.Feedback{}, &models.Upload{}, &models.ImageVariant{},
+		&models.ActivityEvent{}, &models.Translation{}, &models.MaintenanceMode{}, &models.Setting{}, &models.Redirect{},
+		&models.NewsletterSubscription{}, &models.Survey{}, &models.SurveyResponse{},
+		&models.ReleaseNote{}); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
 	}
 
-	log.Println("Database connected and migrated successfully")
-	return database, nil
+	// Every user and flag belongs to a project, the default one unless it names another (see tenancy.go)
+	if err := dropGlobalUniqueIndexes(database); err != nil {
+		return err
+	}
+	if err := ensureDefaultProject(database); err != nil {
+		return err
+	}
+
+	// Indexes and other changes that struct tags can't describe (see migrations.go)
+	return runMigrations(database)
+}
+
+// useReadReplicas routes reads to DB_REPLICA_HOSTS, if any
+// With DB_REPLICA_HOSTS set, SELECTs outside a transaction go to a random replica
+// and everything else (writes, transactions) goes to the primary
+func useReadReplicas(database *gorm.DB, cfg DatabaseConfig) error {
+	hosts := cfg.ReplicaHosts
+	if len(hosts) == 0 {
+		return nil
+	}
+	if usingSQLite(database) {
+		log.Printf("Ignoring DB_REPLICA_HOSTS: read replicas need DB_DRIVER=postgres or mysql")
+		return nil
+	}
+
+	replicas := make([]gorm.Dialector, len(hosts))
+	for i, host := range hosts {
+		replicas[i] = replicaDialector(cfg, host)
+	}
+	resolver := dbresolver.Register(dbresolver.Config{
+		Replicas: replicas,
+		Policy:   dbresolver.RandomPolicy{},
+	}).
+		SetMaxOpenConns(cfg.MaxOpenConns).
+		SetMaxIdleConns(cfg.MaxIdleConns).
+		SetConnMaxLifetime(cfg.ConnMaxLifetime).
+		SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	if err := database.Use(resolver); err != nil {
+		return fmt.Errorf("failed to configure read replicas: %w", err)
+	}
+	log.Printf("Routing reads to %d replica(s): %s", len(replicas), strings.Join(hosts, ","))
+	return nil
+}
+
+// openWithRetry connects to the database, retrying with exponential backoff
+// On cluster start the backend often comes up before Postgres accepts connections;
+// waiting here avoids crash-looping until it does
+func openWithRetry(cfg DatabaseConfig, dialector gorm.Dialector, gormConfig *gorm.Config) (*gorm.DB, error) {
+	attempts := cfg.ConnectAttempts
+	backoff := cfg.ConnectBackoff
+	const maxBackoff = 30 * time.Second
+
+	for attempt := 1; ; attempt++ {
+		// gorm.Open pings the database, so an error here means Postgres isn't reachable yet
+		database, err := gorm.Open(dialector, gormConfig)
+		if err == nil {
+			return database, nil
+		}
+		if database != nil {
+			if sqlDB, dbErr := database.DB(); dbErr == nil {
+				sqlDB.Close()
+			}
+		}
+
+		if attempt >= attempts {
+			return nil, fmt.Errorf("gave up after %d attempts: %w", attempt, err)
+		}
+		log.Printf("Database not reachable (attempt %d/%d), retrying in %s: %v", attempt, attempts, backoff, err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxBackoff)
+	}
 }
 
 // checkZoneHealth performs an HTTP health check on a zone
 // It returns a ZoneStatus indicating whether the zone is responding
-func checkZoneHealth(name, url string) ZoneStatus {
+// The check is abandoned when ctx is done or after HEALTH_CHECK_TIMEOUT, whichever is first
+func (s *Server) checkZoneHealth(ctx context.Context, name, url string) models.ZoneStatus {
+	ctx, span := tracer.Start(ctx, "zone.check", trace.WithAttributes(attribute.String("zone.name", name)))
+	defer span.End()
+
+	// A deadline rather than the client's Timeout, so a reload can change it
+	ctx, cancel := context.WithTimeout(ctx, s.live.healthCheckTimeout())
+	defer cancel()
+
 	// Create a status object with basic info
-	status := ZoneStatus{
+	status := models.ZoneStatus{
 		Name:      name,
 		URL:       url,
 		LastCheck: time.Now(),
 	}
 
-	// Create an HTTP client with a timeout
-	// This prevents hanging if a zone is unresponsive
-	client := &http.Client{
-		Timeout: 5 * time.Second,
-	}
-
 	// Try to make a GET request to the zone
-	resp, err := client.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		status.Status = "unhealthy"
+		status.Message = fmt.Sprintf("Invalid zone URL: %v", err)
+		return status
+	}
+	resp, err := s.healthCheckClient.Do(req)
 	if err != nil {
 		// If we can't connect, mark as unhealthy
 		status.Status = "unhealthy"
@@ -114,6 +230,10 @@ func checkZoneHealth(name, url string) ZoneStatus {
 	}
 	defer resp.Body.Close() // Always close the response body
 
+	// Read what's left of the body so the connection can go back into the pool
+	// (a large page is cut off instead; that connection just isn't reused)
+	io.CopyN(io.Discard, resp.Body, 64<<10)
+
 	// Check the HTTP status code
 	if resp.StatusCode == http.StatusOK {
 		status.Status = "healthy"
@@ -129,407 +249,1133 @@ func checkZoneHealth(name, url string) ZoneStatus {
 
 // healthHandler responds to /health endpoint
 // This is a simple endpoint to check if the backend itself is running
+// It includes the build (see version.go), so probes and dashboards see which one answered
 func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
+	writeJSON(w, r, http.StatusOK, map[string]any{
 		"status":  "ok",
 		"service": "backend-api",
+		"build":   currentBuild(),
 	})
 }
 
-// zonesStatusHandler responds to /api/zones/status endpoint
-// This endpoint checks the health of all zones and returns their status
-func zonesStatusHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// readyHandler responds to /readyz on the internal listener
+// Unlike /health it checks dependencies: it returns 503 while the database
+// can't be reached, so Kubernetes stops routing traffic to this pod until it can
+func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
+	// Stop receiving new traffic while draining (see shutdown.go)
+	if s.shuttingDown.Load() {
+		writeJSON(w, r, http.StatusServiceUnavailable, map[string]string{
+			"status": "unavailable",
+			"reason": "shutting down",
+		})
+		return
+	}
+
+	// db is nil in mock mode, which has no dependencies
+	if s.db != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
 
-	// Check health of both zones by making HTTP requests to them
-	mainStatus := checkZoneHealth("zone-main", zoneMainURL)
-	adminStatus := checkZoneHealth("zone-admin", zoneAdminURL)
+		sqlDB, err := s.db.DB()
+		if err == nil {
+			err = sqlDB.PingContext(ctx)
+		}
+		if err != nil {
+			writeJSON(w, r, http.StatusServiceUnavailable, map[string]string{
+				"status": "unavailable",
+				"reason": "database unreachable",
+			})
+			return
+		}
+	}
 
+	writeJSON(w, r, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// checkAllZones checks the health of every zone and returns their statuses
+// Shared by the REST and GraphQL APIs so both report the same zones
+func (s *Server) checkAllZones() []models.ZoneStatus {
+	// Check health of every zone by making HTTP requests to them
+	statuses := make([]models.ZoneStatus, 0, len(s.zones))
+	for _, zone := range s.zones {
+		// Callers that arrive while a check of this zone is in flight share its result
+		// The check is shared, so it isn't tied to any one caller's request context
+		result, _, _ := s.zoneChecks.Do(zone.Name, func() (interface{}, error) {
+			status := s.checkZoneHealth(context.Background(), zone.Name, zone.URL)
+			s.applyMaintenance(&status) // A zone in maintenance isn't reported as down (see maintenance.go)
+			s.faults.applyZone(&status) // Unless a fault reports it down on purpose (see chaos.go)
+			s.live.logLevel.debugf("zone %s is %s: %s", status.Name, status.Status, status.Message)
+			s.changes.observeZoneStatus(status) // Publishes a change if the status flipped
+			return status, nil
+		})
+		statuses = append(statuses, result.(models.ZoneStatus))
+	}
+	return statuses
+}
+
+// restAPI serves the REST routes through the services in service.go
+// The same handlers serve Postgres or mock mode; only the repositories differ
+type restAPI struct {
+	users  *userService
+	flags  *flagService
+	zones  ZoneRepository
+	images *imageProcessor // Avatars; nil in mock mode
+
+	seedDir string      // SEED_DIR, where POST /api/seed?file= reads from
+	slack   SlackConfig // Who may run the slash commands (see slack.go)
+
+	translations *translationStore // Flag names and descriptions by Accept-Language; nil in mock mode
+}
+
+// zonesStatusHandler responds to /api/zones/status endpoint
+// This endpoint returns the health of the project's zones from the snapshot in zone_status.go
+func (a *restAPI) zonesStatusHandler(w http.ResponseWriter, r *http.Request) {
 	// Build the response with all zone statuses
-	response := HealthResponse{
+	response := models.HealthResponse{
 		Status: "ok",
-		Zones: []ZoneStatus{
-			mainStatus,
-			adminStatus,
-		},
+		Zones:  projectZones(r.Context(), a.zones.Statuses()),
+	}
+
+	// Internal consumers may ask for protobuf or MessagePack instead of JSON
+	if writeBinary(w, r, http.StatusOK, response) {
+		return
 	}
 
 	// Encode the response as JSON and send it to the client
-	json.NewEncoder(w).Encode(response)
+	writeJSON(w, r, http.StatusOK, response)
 }
 
 // getUsersHandler responds to GET /api/users
-// Returns a list of all users in the database
-func getUsersHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	var users []models.User
-	// Find all users in the database
-	// GORM will execute: SELECT * FROM users
-	if err := db.Find(&users).Error; err != nil {
+// Returns one page of users
+func (a *restAPI) getUsersHandler(w http.ResponseWriter, r *http.Request) {
+	// Optional ?filter= and ?orderby= (see filter.go)
+	query, err := parseListQuery(r, userFilterFields)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid query: "+err.Error())
+		return
+	}
+
+	// Stream one user per line for large exports (Accept: application/x-ndjson),
+	// or CSV with optional ?columns= (Accept: text/csv)
+	if wantsNDJSON(r) || wantsCSV(r) {
+		rows, err := a.users.export(r.Context(), query)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+			return
+		}
+		if wantsNDJSON(r) {
+			streamNDJSON(w, r, rows)
+		} else {
+			streamCSV(w, r, "users.csv", rows, userCSVColumns)
+		}
+		return
+	}
+
+	// Find one page of users (v1 gets the largest page allowed)
+	users, err := a.users.list(r.Context(), query)
+	if err != nil {
 		// If there's an error, return HTTP 500
-		http.Error(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+
+	// v2 returns one page at a time with pagination metadata
+	if apiVersion(r) >= 2 {
+		total, err := a.users.count(r.Context(), query)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+			return
+		}
+		writeList(w, r, users, total, query.page)
 		return
 	}
 
 	// Return the users as JSON
-	json.NewEncoder(w).Encode(users)
+	setNextPageLink(w, r, query.page, len(users))
+	writeJSON(w, r, http.StatusOK, users)
 }
 
 // createUserHandler responds to POST /api/users
-// Creates a new user in the database
-func createUserHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	// Parse the JSON request body into a User struct
-	var user models.User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	// Validate required fields
-	if user.Email == "" || user.Name == "" {
-		http.Error(w, "Email and name are required", http.StatusBadRequest)
+// Creates a new user
+func (a *restAPI) createUserHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse and validate the JSON request body
+	var req models.CreateUserRequest
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 
-	// Create the user in the database
-	// GORM will execute: INSERT INTO users (email, name, created_at, updated_at) VALUES (...)
-	if err := db.Create(&user).Error; err != nil {
-		// Check if it's a duplicate email error
-		http.Error(w, fmt.Sprintf("Failed to create user: %v", err), http.StatusInternalServerError)
+	user, err := a.users.create(r.Context(), req)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to create user: %v", err))
 		return
 	}
 
 	// Return the created user (with ID and timestamps populated)
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(user)
+	writeJSON(w, r, http.StatusCreated, user)
 }
 
 // getUserHandler responds to GET /api/users/:id
 // Returns a single user by ID
-func getUserHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	// Extract ID from URL path
-	// Simple approach: parse the last segment of the path
-	id := r.PathValue("id")
-
-	var user models.User
-	// Find user by ID
-	// GORM will execute: SELECT * FROM users WHERE id = ?
-	if err := db.First(&user, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "User not found", http.StatusNotFound)
+func (a *restAPI) getUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := a.users.get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			writeError(w, r, http.StatusNotFound, "User not found")
 		} else {
-			http.Error(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
 		}
 		return
 	}
+	if user.Avatar, err = a.images.avatar(r.Context(), user); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
 
-	json.NewEncoder(w).Encode(user)
+	// Lets clients revalidate with If-Modified-Since
+	setLastModified(w, user.UpdatedAt)
+	writeJSON(w, r, http.StatusOK, user)
 }
 
 // deleteUserHandler responds to DELETE /api/users/:id
 // Deletes a user by ID
-func deleteUserHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	// Extract ID from URL path
-	id := r.PathValue("id")
-
-	// Delete the user
-	// GORM will execute: DELETE FROM users WHERE id = ?
-	result := db.Delete(&models.User{}, id)
-	if result.Error != nil {
-		http.Error(w, fmt.Sprintf("Database error: %v", result.Error), http.StatusInternalServerError)
-		return
-	}
-
-	// Check if any rows were affected
-	if result.RowsAffected == 0 {
-		http.Error(w, "User not found", http.StatusNotFound)
+func (a *restAPI) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	if err := a.users.delete(r.Context(), r.PathValue("id")); err != nil {
+		if errors.Is(err, errNotFound) {
+			writeError(w, r, http.StatusNotFound, "User not found")
+		} else {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		}
 		return
 	}
 
 	// Return success message
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "User deleted successfully",
+	writeJSON(w, r, http.StatusOK, models.MessageResponse{
+		Message: "User deleted successfully",
 	})
 }
 
-// seedDatabaseHandler responds to POST /api/seed
-// Seeds the database with sample user data (same data as the seed job)
-func seedDatabaseHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// seedHandler responds to POST /api/seed
+// Without a body it adds the sample users (the same ones `backend seed` adds);
+// with a seed document (JSON or YAML body, or ?file= in SEED_DIR) it upserts its users and flags
+func (a *restAPI) seedHandler(w http.ResponseWriter, r *http.Request) {
+	doc, ok, err := readSeedRequest(r, a.seedDir)
+	if err != nil {
+		var invalid *seedValidationError
+		if errors.As(err, &invalid) {
+			writeValidationErrors(w, r, invalid.fields)
+			return
+		}
+		writeError(w, r, http.StatusBadRequest, "Invalid seed document: "+err.Error())
+		return
+	}
+	if ok {
+		a.seedDocument(w, r, doc)
+		return
+	}
+
+	response := a.users.seed(r.Context())
 
-	// Sample users to seed (same as in seed.go)
-	sampleUsers := []models.User{
-		{Email: "alice@example.com", Name: "Alice Johnson"},
-		{Email: "bob@example.com", Name: "Bob Smith"},
-		{Email: "charlie@example.com", Name: "Charlie Brown"},
-		{Email: "diana@example.com", Name: "Diana Prince"},
-		{Email: "eve@example.com", Name: "Eve Anderson"},
+	// Return appropriate status code
+	status := http.StatusOK
+	if response.ErrorCount > 0 && response.Created == 0 {
+		status = http.StatusInternalServerError
 	}
 
-	createdCount := 0
-	skippedCount := 0
-	errors := []string{}
+	writeJSON(w, r, status, response)
+}
+
+// seedDocument upserts a seed document's users, then its flags
+// The two aren't one transaction, so a failure can leave the users applied; seeding again is safe
+func (a *restAPI) seedDocument(w http.ResponseWriter, r *http.Request, doc seedDocument) {
+	users, err := a.users.upsert(r.Context(), doc.users)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to seed users: %v", err))
+		return
+	}
+	flags, err := a.flags.upsert(r.Context(), doc.flags)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to seed feature flags: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, models.SeedDocumentResponse{
+		Message:      "Seed document applied",
+		Users:        users,
+		FeatureFlags: flags,
+	})
+}
 
-	// Insert sample users using FirstOrCreate to avoid duplicates
-	for _, user := range sampleUsers {
-		var existingUser models.User
-		result := db.Where("email = ?", user.Email).FirstOrCreate(&existingUser, user)
+// getFeatureFlagsHandler responds to GET /api/feature-flags
+// Returns one page of feature flags
+func (a *restAPI) getFeatureFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	// Optional ?filter= and ?orderby= (see filter.go)
+	query, err := parseListQuery(r, flagFilterFields)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid query: "+err.Error())
+		return
+	}
 
-		if result.Error != nil {
-			errors = append(errors, fmt.Sprintf("Error creating user %s: %v", user.Email, result.Error))
-			continue
+	// Stream one flag per line for large exports (Accept: application/x-ndjson),
+	// or CSV with optional ?columns= (Accept: text/csv)
+	if wantsNDJSON(r) || wantsCSV(r) {
+		rows, err := a.flags.export(r.Context(), query)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+			return
 		}
-
-		// Check if a new record was created (RowsAffected > 0 means created, not found)
-		if result.RowsAffected > 0 {
-			createdCount++
+		if wantsNDJSON(r) {
+			streamNDJSON(w, r, rows)
 		} else {
-			skippedCount++
+			streamCSV(w, r, "feature-flags.csv", rows, flagCSVColumns)
 		}
+		return
 	}
 
-	// Build response
-	response := map[string]interface{}{
-		"message":       "Database seeding completed",
-		"totalUsers":    len(sampleUsers),
-		"created":       createdCount,
-		"skipped":       skippedCount,
-		"errors":        errors,
-		"errorCount":    len(errors),
+	// Fetch one page of feature flags (v1 and binary formats get the largest page allowed)
+	flags, err := a.flags.list(r.Context(), query)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
 	}
 
-	// Return appropriate status code
-	if len(errors) > 0 && createdCount == 0 {
-		w.WriteHeader(http.StatusInternalServerError)
-	} else {
-		w.WriteHeader(http.StatusOK)
+	// Binary formats (protobuf, MessagePack) have no pagination metadata;
+	// internal consumers that need every flag can use /api/bootstrap
+	if binaryFormat(r) != "" {
+		setNextPageLink(w, r, query.page, len(flags))
+		writeBinary(w, r, http.StatusOK, flags)
+		return
 	}
 
-	json.NewEncoder(w).Encode(response)
-}
-
-// getFeatureFlagsHandler responds to GET /api/feature-flags
-// Returns a list of all feature flags from the database
-func getFeatureFlagsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	var flags []models.FeatureFlag
-	// Fetch all feature flags from the database
-	if err := db.Find(&flags).Error; err != nil {
-		http.Error(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
+	if err := a.translations.localizeFlags(w, r, flags); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
 		return
 	}
 
-	// Update cache with fresh data
-	for _, flag := range flags {
-		flagCache.Store(flag.Key, flag)
+	// v2 returns one page at a time with pagination metadata
+	if apiVersion(r) >= 2 {
+		total, err := a.flags.count(r.Context(), query)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+			return
+		}
+		writeList(w, r, flags, total, query.page)
+		return
 	}
 
-	json.NewEncoder(w).Encode(flags)
+	setNextPageLink(w, r, query.page, len(flags))
+	writeJSON(w, r, http.StatusOK, flags)
 }
 
 // getFeatureFlagHandler responds to GET /api/feature-flags/{key}
-// Returns a specific feature flag by its key
-func getFeatureFlagHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	// Extract key from URL path
-	key := r.PathValue("key")
-
-	// Try to get from cache first
-	if cached, ok := flagCache.Load(key); ok {
-		json.NewEncoder(w).Encode(cached)
-		return
-	}
-
-	// If not in cache, fetch from database
-	var flag models.FeatureFlag
-	if err := db.Where("key = ?", key).First(&flag).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Feature flag not found", http.StatusNotFound)
+// Returns a specific feature flag by its key, from the cache when it is there
+func (a *restAPI) getFeatureFlagHandler(w http.ResponseWriter, r *http.Request) {
+	flag, err := a.flags.get(r.Context(), r.PathValue("key"))
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			writeError(w, r, http.StatusNotFound, "Feature flag not found")
 		} else {
-			http.Error(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
 		}
 		return
 	}
 
-	// Store in cache for future requests
-	flagCache.Store(key, flag)
+	localized := []models.FeatureFlag{flag}
+	if err := a.translations.localizeFlags(w, r, localized); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
 
-	json.NewEncoder(w).Encode(flag)
+	setLastModified(w, flag.UpdatedAt)
+	writeJSON(w, r, http.StatusOK, localized[0])
 }
 
 // createFeatureFlagHandler responds to POST /api/feature-flags
-// Creates a new feature flag in the database
-func createFeatureFlagHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	// Parse the JSON request body into a FeatureFlag struct
-	var flag models.FeatureFlag
-	if err := json.NewDecoder(r.Body).Decode(&flag); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+// Creates a new feature flag
+func (a *restAPI) createFeatureFlagHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse and validate the JSON request body
+	var req models.CreateFeatureFlagRequest
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 
-	// Validate required fields
-	if flag.Key == "" || flag.Name == "" {
-		http.Error(w, "Key and name are required", http.StatusBadRequest)
-		return
-	}
-
-	// Create the feature flag in the database
-	if err := db.Create(&flag).Error; err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create feature flag: %v", err), http.StatusInternalServerError)
+	flag, err := a.flags.create(r.Context(), req)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to create feature flag: %v", err))
 		return
 	}
 
-	// Add to cache
-	flagCache.Store(flag.Key, flag)
-
 	// Return the created feature flag
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(flag)
+	writeJSON(w, r, http.StatusCreated, flag)
 }
 
 // updateFeatureFlagHandler responds to PATCH /api/feature-flags/{key}
 // Updates a feature flag's properties (typically to toggle enabled state)
-func updateFeatureFlagHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	// Extract key from URL path
-	key := r.PathValue("key")
-
-	// Parse the update data
-	var updates map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+func (a *restAPI) updateFeatureFlagHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse and validate the update data
+	var req models.UpdateFeatureFlagRequest
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 
-	// Find the existing feature flag
-	var flag models.FeatureFlag
-	if err := db.Where("key = ?", key).First(&flag).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Feature flag not found", http.StatusNotFound)
+	flag, err := a.flags.update(r.Context(), r.PathValue("key"), req)
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			writeError(w, r, http.StatusNotFound, "Feature flag not found")
 		} else {
-			http.Error(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to update feature flag: %v", err))
 		}
 		return
 	}
 
-	// Update the flag with provided fields
-	if err := db.Model(&flag).Updates(updates).Error; err != nil {
-		http.Error(w, fmt.Sprintf("Failed to update feature flag: %v", err), http.StatusInternalServerError)
+	writeJSON(w, r, http.StatusOK, flag)
+}
+
+// deleteFeatureFlagHandler responds to DELETE /api/feature-flags/{key}
+// Deletes a feature flag by its key
+func (a *restAPI) deleteFeatureFlagHandler(w http.ResponseWriter, r *http.Request) {
+	if err := a.flags.delete(r.Context(), r.PathValue("key")); err != nil {
+		if errors.Is(err, errNotFound) {
+			writeError(w, r, http.StatusNotFound, "Feature flag not found")
+		} else {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		}
 		return
 	}
 
-	// Reload the updated flag
-	if err := db.Where("key = ?", key).First(&flag).Error; err != nil {
-		http.Error(w, fmt.Sprintf("Failed to reload feature flag: %v", err), http.StatusInternalServerError)
-		return
+	// Return success message
+	writeJSON(w, r, http.StatusOK, models.MessageResponse{
+		Message: "Feature flag deleted successfully",
+	})
+}
+
+// apiHandlers are the handlers behind the REST routes
+// Normally their repositories are Postgres; --mock swaps in in-memory ones (see mock.go)
+type apiHandlers struct {
+	dashboard         http.HandlerFunc
+	zonesStatus       http.HandlerFunc
+	getUsers          http.HandlerFunc
+	createUser        http.HandlerFunc
+	bulkCreateUsers   http.HandlerFunc
+	getUser           http.HandlerFunc
+	deleteUser        http.HandlerFunc
+	getFeatureFlags   http.HandlerFunc
+	getFeatureFlag    http.HandlerFunc
+	createFeatureFlag http.HandlerFunc
+	bulkCreateFlags   http.HandlerFunc
+	applyFlags        http.HandlerFunc
+	updateFeatureFlag http.HandlerFunc
+	deleteFeatureFlag http.HandlerFunc
+	bootstrap         http.HandlerFunc
+	changes           http.HandlerFunc
+	deployments       http.HandlerFunc
+	seed              http.HandlerFunc
+	slackCommands     http.HandlerFunc
+}
+
+// newAPIHandlers returns the REST handlers backed by the given repositories
+// Deployments are stored separately (see github_webhook.go), so their handler is passed in
+func (s *Server) newAPIHandlers(users UserRepository, flags FlagRepository, zones ZoneRepository, deployments http.HandlerFunc) apiHandlers {
+	api := &restAPI{
+		users:  &userService{repo: users, webhooks: s.webhooks, activity: s.activity},
+		flags:  &flagService{repo: flags, cache: s.flagCache, changes: s.changes, timeout: s.config.Server.RequestTimeout, logLevel: s.live.logLevel},
+		zones:  zones,
+		images: s.images,
+
+		seedDir: s.config.Database.SeedDir,
+		slack:   s.config.Slack,
+
+		translations: s.translations,
 	}
 
-	// Update cache
-	flagCache.Store(key, flag)
+	s.flags = api.flags
+
+	snapshot := newFlagSnapshotStore(api.flags.all, s.config.API.FlagSnapshotRefresh)
+	go snapshot.watch(s.changes)
+
+	return apiHandlers{
+		dashboard:         api.dashboardHandler,
+		zonesStatus:       api.zonesStatusHandler,
+		getUsers:          api.getUsersHandler,
+		createUser:        api.createUserHandler,
+		bulkCreateUsers:   api.bulkCreateUsersHandler,
+		getUser:           api.getUserHandler,
+		deleteUser:        api.deleteUserHandler,
+		getFeatureFlags:   api.getFeatureFlagsHandler,
+		getFeatureFlag:    api.getFeatureFlagHandler,
+		createFeatureFlag: api.createFeatureFlagHandler,
+		bulkCreateFlags:   api.bulkCreateFeatureFlagsHandler,
+		applyFlags:        api.applyFeatureFlagsHandler,
+		updateFeatureFlag: api.updateFeatureFlagHandler,
+		deleteFeatureFlag: api.deleteFeatureFlagHandler,
+		bootstrap:         snapshot.handler,
+		changes:           s.changes.handler,
+		deployments:       deployments,
+		seed:              api.seedHandler,
+		slackCommands:     api.slackCommandHandler,
+	}
+}
 
-	json.NewEncoder(w).Encode(flag)
+// databaseAPIHandlers returns the Postgres-backed handlers
+func (s *Server) databaseAPIHandlers() apiHandlers {
+	return s.newAPIHandlers(
+		newGormUserRepository(s.db, s.stmtDB),
+		newGormFlagRepository(s.db, s.stmtDB),
+		zoneStatusFunc(s.zoneStatuses.get),
+		s.getDeploymentEventsHandler,
+	)
 }
 
-// deleteFeatureFlagHandler responds to DELETE /api/feature-flags/{key}
-// Deletes a feature flag by its key
-func deleteFeatureFlagHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// registerAPIRoutes registers the REST endpoints of one API version on api, a group
+// that already sets the version (and the rate limit and auth that go with it)
+// Read endpoints are wrapped in conditionalGet so polling clients get cheap 304 responses
+func (s *Server) registerAPIRoutes(api *routeGroup, h apiHandlers) {
+	// Database queries are cut off after REQUEST_TIMEOUT
+	timed := api.group("", s.withRequestTimeout)
 
-	// Extract key from URL path
-	key := r.PathValue("key")
+	// Admin dashboard endpoint (users, flags, and zones in one response)
+	timed.handleFunc("GET /dashboard", h.dashboard)
 
-	// Delete the feature flag
-	result := db.Where("key = ?", key).Delete(&models.FeatureFlag{})
-	if result.Error != nil {
-		http.Error(w, fmt.Sprintf("Database error: %v", result.Error), http.StatusInternalServerError)
-		return
+	// Zone health endpoint
+	timed.handleFunc("/zones/status", h.zonesStatus, conditionalGet(10*time.Second))
+
+	// User management endpoints
+	timed.handleFunc("GET /users", h.getUsers, conditionalGet(0))     // List users (one page)
+	timed.handleFunc("POST /users", h.createUser)                     // Create new user
+	timed.handleFunc("POST /users/bulk", h.bulkCreateUsers)           // Create many users at once
+	timed.handleFunc("GET /users/{id}", h.getUser, conditionalGet(0)) // Get single user
+	timed.handleFunc("DELETE /users/{id}", h.deleteUser)              // Delete user
+
+	// Feature flag management endpoints
+	timed.handleFunc("GET /feature-flags", h.getFeatureFlags, conditionalGet(0))      // List all feature flags
+	timed.handleFunc("GET /feature-flags/{key}", h.getFeatureFlag, conditionalGet(0)) // Get specific flag
+	timed.handleFunc("POST /feature-flags", h.createFeatureFlag)                      // Create new flag
+	timed.handleFunc("POST /feature-flags/bulk", h.bulkCreateFlags)                   // Create many flags at once
+	timed.handleFunc("POST /feature-flags/apply", h.applyFlags)                       // Make the flags match a desired state
+	timed.handleFunc("PATCH /feature-flags/{key}", h.updateFeatureFlag)               // Update flag
+	timed.handleFunc("DELETE /feature-flags/{key}", h.deleteFeatureFlag)              // Delete flag
+
+	// Pre-encoded flag states for zones to bootstrap from (see flag_snapshot.go)
+	timed.handleFunc("GET /bootstrap", h.bootstrap)
+
+	// Long-polling change notifications (flag and zone changes)
+	// Long polls wait longer than REQUEST_TIMEOUT, so they skip it
+	api.handleFunc("GET /changes", h.changes)
+
+	// Deployment timeline endpoint
+	timed.handleFunc("GET /deployments", h.deployments) // Recent zone deployment events
+
+	// Database seeding endpoint
+	timed.handleFunc("POST /seed", h.seed) // Seed database with sample data
+}
+
+// routes registers every public endpoint on a new mux
+// Endpoints that need the database (webhooks, usage, GraphQL) are left out in mock mode
+func (s *Server) routes(handlers apiHandlers) *http.ServeMux {
+	mockMode := s.db == nil
+
+	// Create a new HTTP request multiplexer (router)
+	mux := http.NewServeMux()
+	// Every public route is under BASE_PATH (empty unless mounted under a path prefix)
+	root := newRouteGroup(mux).group(s.config.Server.BasePath)
+	if s.config.Server.BasePath != "" {
+		log.Printf("Serving public routes under %s", s.config.Server.BasePath)
 	}
 
-	// Check if any rows were affected
-	if result.RowsAffected == 0 {
-		http.Error(w, "Feature flag not found", http.StatusNotFound)
-		return
+	// Register route handlers
+	// Health check endpoint (unversioned)
+	// Readiness (/readyz) is on the internal listener with the other operational endpoints (see internal.go)
+	root.handleFunc("/health", healthHandler)
+
+	// Which build this is: version, commit, build time, and Go version (see version.go)
+	root.handleFunc("GET /version", versionHandler)
+
+	// Status page built into the binary, for when the zone-admin app is down (see statuspage.go)
+	root.handle("GET /dashboard/", statusPageHandler(s.config.Server.BasePath))
+
+	// Short links shared by the zones, outside /api so they stay short (see redirects.go); not available
+	// in mock mode
+	if !mockMode {
+		root.handleFunc("GET /r/{slug}", s.followRedirectHandler, s.rateLimitMiddleware, s.withRequestTimeout)
 	}
 
-	// Remove from cache
-	flagCache.Delete(key)
+	// Every zone's sitemap merged into one, for search engines (see sitemap.go); it reads only the
+	// zones, so it works in mock mode too
+	root.handleFunc("GET /sitemap.xml", s.sitemapHandler, s.rateLimitMiddleware, conditionalGet(s.config.Zones.SitemapCacheTTL))
+
+	// Everything under /api shares the per-client rate limit (RATE_LIMIT_RPS)
+
+	// Versioned REST API
+	// v1 (/api) returns bare JSON as before; v2 (/api/v2) wraps every response
+	// in a {data, meta, links} envelope and paginates list endpoints
+	// The version comes first so rate limit and auth errors have the version's shape
+	// Each request acts for one project (see tenancy.go), whose API keys may change its data
+	s.registerAPIRoutes(root.group("/api", withAPIVersion(1), s.rateLimitMiddleware, s.resolveTenant, s.requireProjectToken), handlers)
+	s.registerAPIRoutes(root.group("/api/v2", withAPIVersion(2), s.rateLimitMiddleware, s.resolveTenant, s.requireProjectToken), handlers)
+
+	// Unversioned endpoints
+	api := root.group("/api", s.rateLimitMiddleware)
+	timed := api.group("", s.withRequestTimeout)
+	// Unversioned endpoints that read or change one project's data act for it like the versioned API
+	project := timed.group("", s.resolveTenant, s.requireProjectToken)
+
+	// Availability and latency SLOs for this API, with error budget and burn rates (see slo.go)
+	timed.handleFunc("GET /slo/self", s.selfSLOHandler)
+
+	// Incoming webhooks (unversioned, called by external services)
+	// Not available in mock mode because deliveries are stored in the database
+	// GitHub signs its deliveries, so the webhook doesn't take API_TOKEN
+	if !mockMode {
+		timed.handleFunc("POST /webhooks/github", s.githubWebhookHandler) // GitHub deployment/workflow events
+		timed.handleFunc("GET /usage", s.getAPIUsageHandler)              // Daily request counts by endpoint and consumer
+	}
 
-	// Return success message
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Feature flag deleted successfully",
-	})
+	// Slack slash commands (/flags toggle, /zones status), signed with SLACK_SIGNING_SECRET (see slack.go)
+	if s.config.Slack.SigningSecret != "" {
+		timed.handleFunc("POST /slack/commands", handlers.slackCommands)
+	}
+
+	// Outbound webhook subscriptions and their delivery logs (see webhooks.go)
+	// Stored in the database, so not available in mock mode
+	if !mockMode {
+		timed.handleFunc("GET /webhook-subscriptions", s.listWebhookSubscriptionsHandler)
+		timed.handleFunc("POST /webhook-subscriptions", s.createWebhookSubscriptionHandler, s.requireAPIToken)
+		timed.handleFunc("GET /webhook-subscriptions/{id}", s.getWebhookSubscriptionHandler)
+		timed.handleFunc("PATCH /webhook-subscriptions/{id}", s.updateWebhookSubscriptionHandler, s.requireAPIToken)
+		timed.handleFunc("DELETE /webhook-subscriptions/{id}", s.deleteWebhookSubscriptionHandler, s.requireAPIToken)
+		timed.handleFunc("GET /webhook-subscriptions/{id}/deliveries", s.getWebhookDeliveriesHandler)
+	}
+
+	// Organizations, their projects, and the projects' API keys (see tenancy.go); not available in mock mode
+	if !mockMode {
+		timed.handleFunc("GET /organizations", s.listOrganizationsHandler)
+		timed.handleFunc("POST /organizations", s.createOrganizationHandler, s.requireAPIToken)
+		timed.handleFunc("GET /organizations/{org}", s.getOrganizationHandler)
+		timed.handleFunc("PATCH /organizations/{org}", s.updateOrganizationHandler, s.requireAPIToken)
+		timed.handleFunc("DELETE /organizations/{org}", s.deleteOrganizationHandler, s.requireAPIToken)
+		timed.handleFunc("GET /organizations/{org}/projects", s.listProjectsHandler)
+		timed.handleFunc("POST /organizations/{org}/projects", s.createProjectHandler, s.requireAPIToken)
+		timed.handleFunc("GET /organizations/{org}/projects/{project}", s.getProjectHandler)
+		timed.handleFunc("PATCH /organizations/{org}/projects/{project}", s.updateProjectHandler, s.requireAPIToken)
+		timed.handleFunc("DELETE /organizations/{org}/projects/{project}", s.deleteProjectHandler, s.requireAPIToken)
+		timed.handleFunc("GET /organizations/{org}/projects/{project}/api-keys", s.listProjectAPIKeysHandler)
+		timed.handleFunc("POST /organizations/{org}/projects/{project}/api-keys", s.createProjectAPIKeyHandler, s.requireAPIToken)
+		timed.handleFunc("DELETE /organizations/{org}/projects/{project}/api-keys/{id}", s.deleteProjectAPIKeyHandler, s.requireAPIToken)
+	}
+
+	// Background jobs and their dead letters (see jobs.go); not available in mock mode
+	if !mockMode {
+		timed.handleFunc("GET /jobs", s.getJobsHandler)
+		timed.handleFunc("GET /jobs/{id}", s.getJobHandler)
+		timed.handleFunc("POST /jobs/{id}/retry", s.retryJobHandler, s.requireAPIToken)
+		timed.handleFunc("DELETE /jobs/{id}", s.deleteJobHandler, s.requireAPIToken)
+	}
+
+	// Banners for the zones (see announcements.go); the active ones are public, since zone-main shows them
+	// to every visitor. Not available in mock mode
+	if !mockMode {
+		timed.handleFunc("GET /announcements", s.listAnnouncementsHandler)
+		timed.handleFunc("GET /announcements/active", s.getActiveAnnouncementsHandler, conditionalGet(30*time.Second))
+		timed.handleFunc("POST /announcements", s.createAnnouncementHandler, s.requireAPIToken)
+		timed.handleFunc("GET /announcements/{id}", s.getAnnouncementHandler)
+		timed.handleFunc("PATCH /announcements/{id}", s.updateAnnouncementHandler, s.requireAPIToken)
+		timed.handleFunc("DELETE /announcements/{id}", s.deleteAnnouncementHandler, s.requireAPIToken)
+	}
+
+	// Translations of flags and announcements, picked by Accept-Language where the zones read them
+	// (see translations.go); a flag's belong to its project. Not available in mock mode
+	if !mockMode {
+		project.handleFunc("GET /feature-flags/{key}/translations", s.getFlagTranslationsHandler)
+		project.handleFunc("PUT /feature-flags/{key}/translations/{locale}", s.putFlagTranslationHandler)
+		project.handleFunc("DELETE /feature-flags/{key}/translations/{locale}", s.deleteFlagTranslationHandler)
+		timed.handleFunc("GET /announcements/{id}/translations", s.getAnnouncementTranslationsHandler)
+		timed.handleFunc("PUT /announcements/{id}/translations/{locale}", s.putAnnouncementTranslationHandler, s.requireAPIToken)
+		timed.handleFunc("DELETE /announcements/{id}/translations/{locale}", s.deleteAnnouncementTranslationHandler, s.requireAPIToken)
+	}
+
+	// Site-wide settings such as the site title (see settings.go); reading them is public, since every
+	// zone's shell fetches them when it renders. Mock mode only has the defaults
+	timed.handleFunc("GET /settings", s.getSettingsHandler, conditionalGet(0))
+	if !mockMode {
+		timed.handleFunc("PATCH /settings", s.updateSettingsHandler, s.requireAPIToken)
+		timed.handleFunc("DELETE /settings/{name}", s.resetSettingHandler, s.requireAPIToken)
+	}
+
+	// Short link management (see redirects.go); following them is GET /r/{slug}. Not available in mock mode
+	if !mockMode {
+		timed.handleFunc("GET /redirects", s.listRedirectsHandler)
+		timed.handleFunc("POST /redirects", s.createRedirectHandler, s.requireAPIToken)
+		timed.handleFunc("GET /redirects/{slug}", s.getRedirectHandler)
+		timed.handleFunc("PATCH /redirects/{slug}", s.updateRedirectHandler, s.requireAPIToken)
+		timed.handleFunc("DELETE /redirects/{slug}", s.deleteRedirectHandler, s.requireAPIToken)
+	}
+
+	// The zones' navigation menu (see navigation.go); GET /navigation is public, since every zone's shell
+	// fetches it when it renders. Not available in mock mode
+	if !mockMode {
+		timed.handleFunc("GET /navigation", s.getNavigationHandler, conditionalGet(0))
+		timed.handleFunc("PUT /navigation/order", s.orderNavigationHandler, s.requireAPIToken)
+		timed.handleFunc("GET /navigation/items", s.listNavigationItemsHandler)
+		timed.handleFunc("POST /navigation/items", s.createNavigationItemHandler, s.requireAPIToken)
+		timed.handleFunc("GET /navigation/items/{key}", s.getNavigationItemHandler)
+		timed.handleFunc("PATCH /navigation/items/{key}", s.updateNavigationItemHandler, s.requireAPIToken)
+		timed.handleFunc("DELETE /navigation/items/{key}", s.deleteNavigationItemHandler, s.requireAPIToken)
+	}
+
+	// Which zone serves which paths, for the root app's rewrites (see routing.go); the manifest is public,
+	// since the root app reads it when it builds. Not available in mock mode
+	if !mockMode {
+		timed.handleFunc("GET /routing-manifest", s.getRoutingManifestHandler, conditionalGet(0))
+		timed.handleFunc("GET /zone-routes", s.listZoneRoutesHandler)
+		timed.handleFunc("POST /zone-routes", s.createZoneRouteHandler, s.requireAPIToken)
+		timed.handleFunc("GET /zone-routes/changes", s.getZoneRouteChangesHandler)
+		timed.handleFunc("GET /zone-routes/{id}", s.getZoneRouteHandler)
+		timed.handleFunc("PATCH /zone-routes/{id}", s.updateZoneRouteHandler, s.requireAPIToken)
+		timed.handleFunc("DELETE /zone-routes/{id}", s.deleteZoneRouteHandler, s.requireAPIToken)
+	}
+
+	// Page views and custom events from the zones, and their daily totals (see analytics.go); events are
+	// public, since the zones send them from every visitor's browser. Not available in mock mode
+	if !mockMode {
+		timed.handleFunc("POST /events", s.recordEventsHandler)
+		timed.handleFunc("GET /analytics", s.getAnalyticsHandler)
+	}
+
+	// Maintenance mode for every zone or one (see maintenance.go); the zones' own state is public, since
+	// they poll it for every visitor. Not available in mock mode
+	if !mockMode {
+		timed.handleFunc("GET /maintenance", s.listMaintenanceHandler)
+		timed.handleFunc("PUT /maintenance", s.setMaintenanceHandler, s.requireAPIToken)
+		timed.handleFunc("DELETE /maintenance", s.deleteMaintenanceHandler, s.requireAPIToken)
+		timed.handleFunc("GET /zones/{name}/maintenance", s.getZoneMaintenanceHandler, conditionalGet(0))
+		timed.handleFunc("PUT /zones/{name}/maintenance", s.setMaintenanceHandler, s.requireAPIToken)
+		timed.handleFunc("DELETE /zones/{name}/maintenance", s.deleteMaintenanceHandler, s.requireAPIToken)
+	}
+
+	// Live active users per zone from the zones' session heartbeats (see presence.go); heartbeats are
+	// public, since the zones send them from every visitor's browser. A project sees only its zones' counts
+	timed.handleFunc("POST /zones/{name}/heartbeat", s.heartbeatHandler)
+	project.handleFunc("GET /zones/{name}/active-users", s.getActiveUsersHandler)
+
+	// A/B experiments (see experiments.go); assignments and events are public, since the zones request
+	// them for every visitor. Not available in mock mode
+	if !mockMode {
+		timed.handleFunc("GET /experiments", s.listExperimentsHandler)
+		timed.handleFunc("POST /experiments", s.createExperimentHandler, s.requireAPIToken)
+		timed.handleFunc("POST /experiments/events", s.recordExperimentEventsHandler)
+		timed.handleFunc("GET /experiments/{key}", s.getExperimentHandler)
+		timed.handleFunc("PATCH /experiments/{key}", s.updateExperimentHandler, s.requireAPIToken)
+		timed.handleFunc("DELETE /experiments/{key}", s.deleteExperimentHandler, s.requireAPIToken)
+		timed.handleFunc("POST /experiments/{key}/assignments", s.assignExperimentHandler)
+		timed.handleFunc("GET /experiments/{key}/results", s.getExperimentResultsHandler)
+	}
+
+	// In-product surveys and polls (see surveys.go); fetching the active survey and responding are
+	// public, since the zones do both from every visitor's browser. The responses themselves need
+	// API_TOKEN, since they carry units and free text; the results are totals. Not available in mock mode
+	if !mockMode {
+		timed.handleFunc("GET /surveys", s.listSurveysHandler)
+		timed.handleFunc("POST /surveys", s.createSurveyHandler, s.requireAPIToken)
+		timed.handleFunc("GET /surveys/active", s.getActiveSurveyHandler)
+		timed.handleFunc("GET /surveys/{key}", s.getSurveyHandler)
+		timed.handleFunc("PATCH /surveys/{key}", s.updateSurveyHandler, s.requireAPIToken)
+		timed.handleFunc("DELETE /surveys/{key}", s.deleteSurveyHandler, s.requireAPIToken)
+		timed.handleFunc("POST /surveys/{key}/responses", s.submitSurveyResponseHandler)
+		timed.handleFunc("GET /surveys/{key}/responses", s.listSurveyResponsesHandler, s.requireAdminToken)
+		timed.handleFunc("GET /surveys/{key}/results", s.getSurveyResultsHandler)
+	}
+
+	// Release notes for the zones' "What's new" panel (see release_notes.go); the published ones are
+	// public, since every zone shows them. Not available in mock mode
+	if !mockMode {
+		timed.handleFunc("GET /release-notes", s.listReleaseNotesHandler)
+		timed.handleFunc("POST /release-notes", s.createReleaseNoteHandler, s.requireAPIToken)
+		timed.handleFunc("GET /release-notes/published", s.getPublishedReleaseNotesHandler, conditionalGet(30*time.Second))
+		timed.handleFunc("GET /release-notes/{id}", s.getReleaseNoteHandler)
+		timed.handleFunc("PATCH /release-notes/{id}", s.updateReleaseNoteHandler, s.requireAPIToken)
+		timed.handleFunc("DELETE /release-notes/{id}", s.deleteReleaseNoteHandler, s.requireAPIToken)
+	}
+
+	// The zones' contact form and its triage (see contact.go); sending a message is public, since any
+	// visitor may, and limited by CONTACT_RATE_LIMIT instead. Reading the messages needs API_TOKEN,
+	// since they hold visitors' names and addresses. Not available in mock mode
+	if !mockMode {
+		timed.handleFunc("POST /contact", s.submitContactHandler)
+		timed.handleFunc("GET /contact/submissions", s.listContactSubmissionsHandler, s.requireAdminToken)
+		timed.handleFunc("GET /contact/submissions/{id}", s.getContactSubmissionHandler, s.requireAdminToken)
+		timed.handleFunc("PATCH /contact/submissions/{id}", s.updateContactSubmissionHandler, s.requireAPIToken)
+		timed.handleFunc("DELETE /contact/submissions/{id}", s.deleteContactSubmissionHandler, s.requireAPIToken)
+	}
+
+	// Double opt-in newsletter signups from zone-main's footer (see newsletter.go); signing up,
+	// confirming, and unsubscribing are public, since any visitor may, and signups are limited by
+	// NEWSLETTER_RATE_LIMIT instead. The list of addresses (and its CSV export) needs API_TOKEN.
+	// Only when NEWSLETTER_CONFIRM_URL is set, and not in mock mode
+	if !mockMode && s.config.Newsletter.ConfirmURL != "" {
+		timed.handleFunc("POST /newsletter/subscribe", s.subscribeHandler)
+		timed.handleFunc("POST /newsletter/confirm", s.confirmSubscriptionHandler)
+		timed.handleFunc("POST /newsletter/unsubscribe", s.unsubscribeHandler)
+		timed.handleFunc("GET /newsletter/subscriptions", s.listNewsletterSubscriptionsHandler, s.requireAdminToken)
+		timed.handleFunc("DELETE /newsletter/subscriptions/{id}", s.deleteNewsletterSubscriptionHandler, s.requireAPIToken)
+	}
+
+	// In-product feedback from the zones and its triage (see feedback.go); leaving feedback is public,
+	// since the zones send it from every visitor's browser. Reading it (and its CSV export) needs
+	// API_TOKEN, since it carries user IDs and what they wrote. Not available in mock mode
+	if !mockMode {
+		timed.handleFunc("GET /feedback", s.listFeedbackHandler, s.requireAdminToken)
+		timed.handleFunc("POST /feedback", s.createFeedbackHandler)
+		timed.handleFunc("GET /feedback/{id}", s.getFeedbackHandler, s.requireAdminToken)
+		timed.handleFunc("PATCH /feedback/{id}", s.updateFeedbackHandler, s.requireAPIToken)
+		timed.handleFunc("DELETE /feedback/{id}", s.deleteFeedbackHandler, s.requireAPIToken)
+	}
+
+	// File uploads straight to UPLOAD_S3_BUCKET with presigned URLs (see uploads.go); only when it is set
+	// Upload IDs are sequential, so everything by ID needs API_TOKEN; the public download is by
+	// the file's object key instead, which can't be guessed
+	if s.uploads != nil {
+		timed.handleFunc("GET /uploads", s.listUploadsHandler, s.requireAdminToken)
+		timed.handleFunc("POST /uploads", s.createUploadHandler, s.requireAPIToken)
+		timed.handleFunc("GET /uploads/{id}", s.getUploadHandler, s.requireAdminToken)
+		timed.handleFunc("POST /uploads/{id}/complete", s.completeUploadHandler, s.requireAPIToken)
+		timed.handleFunc("GET /uploads/{id}/download", s.downloadUploadHandler, s.requireAdminToken)
+		timed.handleFunc("DELETE /uploads/{id}", s.deleteUploadHandler, s.requireAPIToken)
+		timed.handleFunc("GET /files/{key...}", s.downloadFileHandler)
+	}
+
+	// Avatars made from image uploads in a background job (see images.go), for the project's users;
+	// only where uploads are
+	if s.images != nil {
+		project.handleFunc("PUT /users/{id}/avatar", s.setAvatarHandler)
+		project.handleFunc("DELETE /users/{id}/avatar", s.deleteAvatarHandler)
+	}
+
+	// What happened to flags, users, zones, and deployments, newest first (see activity.go); it names
+	// users and their addresses, so reading it needs API_TOKEN or the project's key. Not available in mock mode
+	if !mockMode {
+		project.handleFunc("GET /activity", s.listActivityHandler, s.requireProjectAdminToken)
+	}
+
+	// The zones' incidents, recoveries, and maintenance as an Atom feed (see incident_feed.go); public,
+	// since most feed readers can't send API keys. Those that can get their project's zones only.
+	// Not available in mock mode
+	if !mockMode {
+		project.handleFunc("GET /incidents/feed.atom", s.incidentFeedHandler, conditionalGet(time.Minute))
+	}
+
+	// Global search across users, flags, and announcements for the admin zone (see search.go);
+	// not available in mock mode
+	if !mockMode {
+		project.handleFunc("GET /search", s.searchHandler)
+	}
+
+	// What each retention cleanup would delete now (see retention.go); not available in mock mode
+	if !mockMode {
+		timed.handleFunc("GET /retention", s.retentionReportHandler)
+	}
+
+	// The project's flags and the shared configuration as one bundle, for cloning an environment or
+	// restoring one (see bundle.go). The project is named like anywhere else, but since the bundle
+	// holds the shared configuration too, both need API_TOKEN; not available in mock mode
+	if !mockMode {
+		timed.handleFunc("GET /export/bundle", s.exportBundleHandler, s.resolveTenant, s.requireAdminToken)
+		timed.handleFunc("POST /import/bundle", s.importBundleHandler, s.resolveTenant, s.requireAPIToken)
+	}
+
+	// Cron schedules, their run history, and running one now (see schedules.go); not available in mock mode
+	if !mockMode {
+		timed.handleFunc("GET /schedules", s.listSchedulesHandler)
+		timed.handleFunc("POST /schedules", s.createScheduleHandler, s.requireAPIToken)
+		timed.handleFunc("GET /schedules/{id}", s.getScheduleHandler)
+		timed.handleFunc("PATCH /schedules/{id}", s.updateScheduleHandler, s.requireAPIToken)
+		timed.handleFunc("DELETE /schedules/{id}", s.deleteScheduleHandler, s.requireAPIToken)
+		timed.handleFunc("GET /schedules/{id}/runs", s.getScheduleRunsHandler)
+		timed.handleFunc("POST /schedules/{id}/run", s.runScheduleHandler, s.requireAPIToken)
+	}
+
+	// Templated email and the suppression list (see email.go), when EMAIL_PROVIDER is set
+	// Reading them needs API_TOKEN too, since they hold recipients' addresses and what was sent to them
+	if s.mailer != nil {
+		timed.handleFunc("POST /emails", s.sendEmailHandler, s.requireAPIToken)
+		timed.handleFunc("GET /emails", s.getEmailsHandler, s.requireAdminToken)
+		timed.handleFunc("GET /emails/{id}", s.getEmailHandler, s.requireAdminToken)
+		timed.handleFunc("GET /email-suppressions", s.getEmailSuppressionsHandler, s.requireAdminToken)
+		timed.handleFunc("POST /email-suppressions", s.createEmailSuppressionHandler, s.requireAPIToken)
+		timed.handleFunc("DELETE /email-suppressions/{email}", s.deleteEmailSuppressionHandler, s.requireAPIToken)
+	}
+
+	// Fake data for load tests; off unless SEED_GENERATE_ENABLED=true (see generate.go)
+	// Big runs take longer than REQUEST_TIMEOUT, so it has no timeout of its own
+	if !mockMode && s.config.Database.SeedGenerateEnabled {
+		api.handleFunc("POST /seed/generate", s.generateHandler, s.requireAPIToken)
+		log.Println("Fake data generator enabled: POST /api/seed/generate")
+	}
+
+	// Gateway mode: proxy admin tooling requests to internal-only zone endpoints
+	// Every method needs API_TOKEN, since the zones trust what arrives with ZONE_PROXY_TOKEN
+	if s.config.Zones.GatewayMode {
+		api.handleFunc("/zones/{name}/proxy/{path...}", s.zoneProxyHandler, s.requireAdminToken)
+		log.Println("Gateway mode enabled: proxying /api/zones/{name}/proxy/* to zones")
+	}
+
+	// GraphQL endpoint
+	// Aggregates users, feature flags, and zone status so the admin dashboard
+	// can fetch everything it needs in a single request
+	// The resolvers query the database directly, so GraphQL is not served in mock mode
+	if !mockMode {
+		graphqlServer := handler.NewDefaultServer(graph.NewExecutableSchema(graph.Config{
+			Resolvers: &graph.Resolver{
+				DB:           s.stmtDB,
+				FlagCache:    s.flagCache,
+				CheckZones:   s.zoneStatuses.get,
+				MaxListSize:  s.config.API.MaxPageSize,
+				OnFlagChange: s.changes.publishFlagChange,
+			},
+		}))
+		// Mutations are POSTs, so with API_TOKEN set only GET queries go without it (or a project API key)
+		timed.handle("/graphql", graphqlServer, s.resolveTenant, s.requireProjectToken) // GraphQL queries and mutations
+		// Interactive query editor; it posts queries to the endpoint above, so it needs the full path
+		api.handle("GET /graphql/playground", playground.Handler("GraphQL", s.config.Server.BasePath+"/api/graphql"))
+	}
+	return mux
+}
+
+// handler wraps mux in the middleware every public request goes through
+// It fails only when the ACCESS_LOG_* settings are invalid
+func (s *Server) handler(mux *http.ServeMux, sentryEnabled bool) (http.Handler, error) {
+	// One access log line per request (format chosen by ACCESS_LOG_FORMAT, see access_log.go)
+	accessLog, err := newAccessLogger(s.config.Logging, s.live.logLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	// Optional middleware stays nil when it is turned off
+	var logRequests, countUsage, reportErrors, injectFaults middleware
+	if accessLog != nil {
+		logRequests = routeMiddleware(mux, accessLog.middleware)
+	}
+	if s.usage != nil {
+		countUsage = routeMiddleware(mux, s.usage.middleware)
+	}
+	if sentryEnabled {
+		reportErrors = sentryMiddleware
+	}
+	if s.faults != nil {
+		injectFaults = s.faults.middleware
+	}
+
+	// In the order a request goes through them
+	return chain{
+		withConfig(&s.config), // Give the request helpers this server's settings (see requestConfig)
+		logRequests,
+		routeMiddleware(mux, tracingMiddleware),   // Start a span per request (exported only when OTLP is configured)
+		countUsage,                                // Count requests per endpoint and consumer for /api/usage
+		routeMiddleware(mux, s.metricsMiddleware), // Count and time every request, including CORS preflights
+		routeMiddleware(mux, recoveryMiddleware),  // Answer panics with a 500 instead of dropping the connection
+		reportErrors,                              // Report panics to Sentry and give writeError a hub for 5xx reports
+		s.corsMiddleware,                          // Enable CORS for CORS_ALLOWED_ORIGINS (reloadable, see reload.go)
+		requestIDMiddleware,                       // Tag each request with an ID
+		injectFaults,                              // Slow down or fail requests on purpose (CHAOS_ENABLED, see chaos.go)
+		s.compressionMiddleware,                   // Compress responses when the client supports it
+	}.then(mux), nil
 }
 
 // main is the entry point of the application
+// It dispatches to the serve, seed, and migrate subcommands (see cli.go)
 func main() {
-	// Initialize database connection
-	var err error
-	db, err = initDB()
+	if err := newRootCommand().Execute(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
+
+// runServer starts the API server configured by cfg (loaded from configPath, if set) and blocks
+// until it has shut down
+// With mockMode it serves in-memory sample data so zones can be developed without Postgres;
+// demoMode is mock mode with generated data that resets every DEMO_RESET_INTERVAL (see demo.go)
+func runServer(cfg Config, configPath string, mockMode, demoMode bool) {
+	if demoMode {
+		mockMode = true
+		cfg = demoConfig(cfg)
+	}
+
+	// Panics and 5xx responses are reported to Sentry when SENTRY_DSN is set
+	sentryEnabled := initSentry(cfg.Sentry)
+
+	// OpenTelemetry tracing, configured through the standard OTEL_* variables
+	shutdownTracing, err := initTracing(context.Background())
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		log.Printf("Tracing disabled: %v", err)
 	}
 
-	log.Println("Database initialized successfully")
+	// REST handlers backed by the database, or by the in-memory mock store
+	var s *Server
+	var handlers apiHandlers
+	if demoMode {
+		s = newServer(nil, cfg)
+		store := newDemoStore(time.Now(), s.zones, cfg.Demo)
+		handlers = s.mockAPIHandlers(store)
+		go s.resetDemoEvery(store, cfg.Demo.ResetInterval)
+		log.Printf("Demo mode enabled: serving generated data (no database), reset every %s", cfg.Demo.ResetInterval)
+	} else if mockMode {
+		s = newServer(nil, cfg)
+		handlers = s.mockAPIHandlers(newMockStore(time.Now(), s.zones))
+		log.Println("Mock mode enabled: serving in-memory sample data (no database)")
+	} else {
+		// Initialize database connection
+		database, err := initDB(cfg.Database, newLogLevel(cfg.Logging.Level))
+		if err != nil {
+			log.Fatalf("Failed to initialize database: %v", err)
+		}
+		s = newServer(database, cfg)
+		database = s.db // Logs queries at the server's log level from here on
 
-	// Create a new HTTP request multiplexer (router)
-	mux := http.NewServeMux()
+		// Background jobs, run by the leader (see jobs.go); the components below register theirs
+		s.jobs = newJobQueue(database, cfg.Jobs)
 
-	// Register route handlers
-	// Health check endpoints
-	mux.HandleFunc("/health", healthHandler)
-	mux.HandleFunc("/api/zones/status", zonesStatusHandler)
+		// Outbound webhooks for flag, user, and zone changes; the leader sends them (see webhooks.go)
+		s.webhooks = newWebhookDispatcher(database, s.jobs, cfg)
+		s.changes.webhooks = s.webhooks
 
-	// User management endpoints
-	mux.HandleFunc("GET /api/users", getUsersHandler)           // List all users
-	mux.HandleFunc("POST /api/users", createUserHandler)        // Create new user
-	mux.HandleFunc("GET /api/users/{id}", getUserHandler)       // Get single user
-	mux.HandleFunc("DELETE /api/users/{id}", deleteUserHandler) // Delete user
+		// What happened to flags, users, zones, and deployments, for GET /api/activity (see activity.go)
+		s.activity = newActivityLog(database, cfg)
+		s.changes.activity = s.activity
 
-	// Feature flag management endpoints
-	mux.HandleFunc("GET /api/feature-flags", getFeatureFlagsHandler)              // List all feature flags
-	mux.HandleFunc("GET /api/feature-flags/{key}", getFeatureFlagHandler)         // Get specific flag
-	mux.HandleFunc("POST /api/feature-flags", createFeatureFlagHandler)           // Create new flag
-	mux.HandleFunc("PATCH /api/feature-flags/{key}", updateFeatureFlagHandler)    // Update flag
-	mux.HandleFunc("DELETE /api/feature-flags/{key}", deleteFeatureFlagHandler)   // Delete flag
+		// Flags and announcements in other languages, by Accept-Language (see translations.go)
+		s.translations = newTranslationStore(database)
 
-	// Database seeding endpoint
-	mux.HandleFunc("POST /api/seed", seedDatabaseHandler)       // Seed database with sample data
+		// Site-wide settings that aren't feature flags, cached for a while (see settings.go)
+		s.settings = newSettingsStore(database)
+
+		// Short links at /r/{slug}, cached, with visits saved every few seconds (see redirects.go)
+		s.redirects = newRedirectStore(database)
+
+		// Templated email through SMTP or SendGrid, when EMAIL_PROVIDER is set (see email.go)
+		if s.mailer, err = newMailer(database, s.jobs, cfg); err != nil {
+			log.Fatalf("Failed to set up email: %v", err)
+		}
+		if s.mailer != nil {
+			s.changes.mailer = s.mailer
+			log.Printf("Email enabled: sending through %s as %s", cfg.Email.Provider, cfg.Email.From)
+		}
+
+		// Presigned file uploads, and the job that processes avatars (see uploads.go and images.go)
+		if s.uploads, err = newUploadStore(cfg.Uploads); err != nil {
+			log.Fatalf("Failed to set up uploads: %v", err)
+		} else if s.uploads != nil {
+			s.images = newImageProcessor(database, s.uploads, s.jobs, cfg)
+			log.Printf("Uploads enabled: %s", s.uploads)
+		}
+
+		// Keep flag caches on other replicas in sync through Postgres LISTEN/NOTIFY, or by polling on MySQL
+		// A SQLite database belongs to a single process, so there is nobody to tell
+		switch {
+		case usingMySQL(database):
+			go newFlagPoller(s).run()
+		case !usingSQLite(database):
+			s.changes.broadcast = s.notifyFlagChange
+			go s.listenForFlagChanges(postgresDSN(cfg.Database, cfg.Database.Host))
+		}
+
+		log.Println("Database initialized successfully")
+		handlers = s.databaseAPIHandlers()
+
+		// Per-endpoint, per-consumer request counts, aggregated daily (see usage.go)
+		s.usage = newUsageRecorder(database, cfg)
+
+		// Page views and custom events sent by the zones, aggregated daily (see analytics.go)
+		s.analytics = newAnalyticsRecorder(database, cfg.Analytics)
+
+		// Cron schedules stored in the database, including the retention cleanups (see schedules.go)
+		s.scheduler = newScheduler(database, s.jobs, s.scheduledTasks(), cfg.Scheduler)
+		if err := s.scheduler.createBuiltins(context.Background(), s.builtinSchedules()); err != nil {
+			log.Fatalf("Failed to create the built-in schedules: %v", err)
+		}
+
+		// Debug lines from the components follow this server's log level
+		s.jobs.logLevel = s.live.logLevel
+		s.webhooks.logLevel = s.live.logLevel
+		s.scheduler.logLevel = s.live.logLevel
+
+		// Cluster-wide background tasks run on one replica at a time (see leader.go)
+		s.leader = newLeaderElector(cfg.Leader)
+		s.leader.onLeader("jobs", s.jobs.run)
+		s.leader.onLeader("scheduler", s.scheduler.run)
+		s.leader.onLeader("zone-watch", s.watchZones) // Finds zone incidents without waiting for a request
+		s.webhooks.leader = s.leader
+		s.activity.leader = s.leader
+		if s.mailer != nil {
+			s.mailer.leader = s.leader
+			s.mailer.logLevel = s.live.logLevel
+		}
+		s.changes.slack = newSlackNotifier(cfg.Slack.WebhookURL, s.leader) // Zone incidents in a Slack channel, when SLACK_WEBHOOK_URL is set
+		if err := s.leader.start(); err != nil {
+			log.Fatalf("Failed to start leader election: %v", err)
+		}
+
+		// Backup and restore endpoints on the internal listener (see backup.go)
+		if cfg.Backup.Enabled {
+			if s.backups, err = newBackupRunner(database, cfg); err != nil {
+				log.Fatalf("Failed to set up backups: %v", err)
+			}
+			s.backups.onRestore = s.flagsRestored
+			log.Printf("Backups enabled: %s", s.backups.store)
+		}
+	}
+
+	// Drop sessions without a recent heartbeat and publish active user counts (see presence.go)
+	go s.presence.run()
 
-	// Enable CORS (Cross-Origin Resource Sharing)
-	// This allows the Next.js admin frontend to make API calls to this backend
-	handler := cors.New(cors.Options{
-		AllowedOrigins: []string{"*"}, // Allow requests from any origin (in production, specify exact origins)
-		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"Content-Type"},
-	}).Handler(mux)
+	// Flag cache and zone status gauges read this server's counters, and the pool stats its database
+	s.registerCacheMetrics()
+	if s.db != nil {
+		s.registerDBMetrics()
+	}
 
-	// Get the port from environment variable or use 8080 as default
-	port := getEnv("PORT", "8080")
-	addr := fmt.Sprintf(":%s", port)
+	// Routes wrapped in the middleware chain (CORS, recovery, metrics, tracing, access log)
+	handler, err := s.handler(s.routes(handlers), sentryEnabled)
+	if err != nil {
+		log.Fatalf("Invalid access log settings: %v", err)
+	}
+
+	// Operational endpoints (/metrics) are served on a separate, non-public port
+	s.startInternalServer()
+	if s.faults != nil {
+		log.Println("Fault injection enabled: /internal/faults can slow down or fail this replica on purpose")
+	}
+
+	// Apply log level, CORS, and zone check changes on SIGHUP or when the config file changes (see reload.go)
+	s.configPath = configPath
+	s.watchConfig()
+
+	// Listen on TCP (PORT, default 8080) or on a Unix domain socket when LISTEN=unix:/path is set
+	listener, addr, err := newListener(cfg.Server)
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
 
 	// Log startup information
 	log.Printf("Backend API server starting on %s", addr)
 	log.Printf("Monitoring zones:")
-	log.Printf("  - Main:  %s", zoneMainURL)
-	log.Printf("  - Admin: %s", zoneAdminURL)
-	log.Printf("Database connection: postgres@%s", getEnv("DB_HOST", "postgres"))
+	log.Printf("  - Main:  %s", cfg.Zones.MainURL)
+	log.Printf("  - Admin: %s", cfg.Zones.AdminURL)
+	if !mockMode && usingSQLite(s.db) {
+		log.Printf("Database connection: sqlite@%s", cfg.Database.SQLitePath)
+	} else if !mockMode {
+		log.Printf("Database connection: %s@%s", cfg.Database.Driver, cfg.Database.Host)
+	}
 
 	// Start the HTTP server
-	// This is a blocking call - the program will run until terminated
-	if err := http.ListenAndServe(addr, handler); err != nil {
+	// This blocks until SIGTERM/SIGINT, then drains in-flight requests (see shutdown.go)
+	if err := s.serve(listener, handler); err != nil {
 		log.Fatal(err)
 	}
+
+	if sentryEnabled {
+		flushSentry()
+	}
+
+	// Send spans still buffered by the batch exporter
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
 }
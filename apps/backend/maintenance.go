@@ -0,0 +1,202 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Maintenance mode takes every zone, or one, offline on purpose. The zones poll
+// GET /api/zones/{name}/maintenance from their middleware, with the visitor's IP as ?ip=, and
+// render their maintenance page while it is on, except to allowlisted IPs (such as the office's)
+// so the team can check the zone before it reopens. Health checks report a zone in maintenance
+// as "maintenance" whatever its maintenance page answers, so planned downtime isn't an incident
+
+// zoneMaintenance returns the maintenance mode that applies to zone at now: the zone's own,
+// else every zone's; ok is false when neither is on
+func (s *Server) zoneMaintenance(ctx context.Context, zone string, now time.Time) (mode models.MaintenanceMode, ok bool, err error) {
+	var modes []models.MaintenanceMode
+	err = s.db.WithContext(ctx).
+		Where("zone IN ? AND (ends_at IS NULL OR ends_at > ?)", []string{"", zone}, now).
+		Find(&modes).Error
+	if err != nil || len(modes) == 0 {
+		return mode, false, err
+	}
+	// The zone's own maintenance is more specific than every zone's (whose zone is empty)
+	slices.SortFunc(modes, func(a, b models.MaintenanceMode) int { return cmp.Compare(b.Zone, a.Zone) })
+	return modes[0], true, nil
+}
+
+// applyMaintenance reports a zone in maintenance as "maintenance" with its message, whatever its
+// health check found. Mock mode has no maintenance, since it has no database
+func (s *Server) applyMaintenance(status *models.ZoneStatus) {
+	if s.db == nil {
+		return
+	}
+	// Health checks aren't requests, so the lookup gets a deadline of its own
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Server.RequestTimeout)
+	defer cancel()
+	mode, ok, err := s.zoneMaintenance(ctx, status.Name, time.Now())
+	if err != nil {
+		// Reported as checked, so an outage during a database hiccup still shows
+		log.Printf("Failed to read the maintenance mode of zone %s: %v", status.Name, err)
+		return
+	}
+	if ok {
+		status.Status = "maintenance"
+		status.Message = mode.Message
+	}
+}
+
+// allowedIP reports whether ip is one of allowed's addresses or in one of its CIDR ranges
+func allowedIP(allowed models.StringList, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, entry := range allowed {
+		if strings.Contains(entry, "/") {
+			if prefix, err := netip.ParsePrefix(entry); err == nil && prefix.Contains(addr) {
+				return true
+			}
+		} else if other, err := netip.ParseAddr(entry); err == nil && other.Unmap() == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// listMaintenanceHandler responds to GET /api/maintenance
+// The maintenance modes that are on, every zone's (with an empty zone) first
+func (s *Server) listMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	modes := []models.MaintenanceMode{}
+	err := s.db.WithContext(r.Context()).
+		Where("ends_at IS NULL OR ends_at > ?", time.Now()).
+		Order("zone").Find(&modes).Error
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, modes)
+}
+
+// setMaintenanceHandler responds to PUT /api/maintenance and PUT /api/zones/{name}/maintenance
+// Switches maintenance on for every zone or for the named one, replacing what was set before
+func (s *Server) setMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	zone, ok := s.maintenanceZone(w, r)
+	if !ok {
+		return
+	}
+	var req models.SetMaintenanceRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	if req.EndsAt != nil && !req.EndsAt.After(time.Now()) {
+		writeValidationErrors(w, r, []models.FieldError{{Field: "endsAt", Message: "must be in the future"}})
+		return
+	}
+
+	mode := models.MaintenanceMode{Zone: zone, Message: req.Message, AllowedIPs: models.StringList(req.AllowedIPs), EndsAt: req.EndsAt}
+	if mode.AllowedIPs == nil {
+		mode.AllowedIPs = models.StringList{}
+	}
+	err := s.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "zone"}},
+			DoUpdates: clause.AssignmentColumns([]string{"message", "allowed_ips", "ends_at", "updated_at"}),
+		}).Create(&mode).Error; err != nil {
+			return err
+		}
+		// An update leaves the created row's ID and timestamps behind, so read back what was stored
+		return tx.Where("zone = ?", zone).First(&mode).Error
+	})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to set maintenance mode: %v", err))
+		return
+	}
+	log.Printf("Maintenance mode on for %s: %s", maintenanceScope(zone), mode.Message)
+	writeJSON(w, r, http.StatusOK, mode)
+}
+
+// deleteMaintenanceHandler responds to DELETE /api/maintenance and DELETE /api/zones/{name}/maintenance
+// Switching every zone's maintenance off leaves the zones' own on
+func (s *Server) deleteMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	zone, ok := s.maintenanceZone(w, r)
+	if !ok {
+		return
+	}
+	result := s.db.WithContext(r.Context()).Where("zone = ? AND (ends_at IS NULL OR ends_at > ?)", zone, time.Now()).Delete(&models.MaintenanceMode{})
+	if result.Error != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		writeError(w, r, http.StatusNotFound, "Maintenance mode is not on for "+maintenanceScope(zone))
+		return
+	}
+	// A mode that ended by itself is left for the next PUT to replace
+	log.Printf("Maintenance mode off for %s", maintenanceScope(zone))
+	writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "Maintenance mode switched off"})
+}
+
+// getZoneMaintenanceHandler responds to GET /api/zones/{name}/maintenance?ip=
+// Whether the zone should show its maintenance page to the client at ip (default: the caller),
+// so a zone's server can ask on behalf of its visitor
+func (s *Server) getZoneMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	zone, ok := s.maintenanceZone(w, r)
+	if !ok {
+		return
+	}
+	ip := r.URL.Query().Get("ip")
+	if ip == "" {
+		ip = remoteHost(r)
+	} else if _, err := netip.ParseAddr(ip); err != nil {
+		writeError(w, r, http.StatusBadRequest, "ip must be an IP address")
+		return
+	}
+
+	mode, on, err := s.zoneMaintenance(r.Context(), zone, time.Now())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	status := models.MaintenanceStatus{Zone: zone}
+	if on {
+		status.Maintenance = true
+		status.Show = !allowedIP(mode.AllowedIPs, ip)
+		status.Global = mode.Zone == ""
+		status.Message = mode.Message
+		status.EndsAt = mode.EndsAt
+	}
+	writeJSON(w, r, http.StatusOK, status)
+}
+
+// maintenanceZone returns the {name} path value, or "" (every zone) on the routes without one
+// It writes a 404 response and returns false for a zone that isn't configured
+func (s *Server) maintenanceZone(w http.ResponseWriter, r *http.Request) (string, bool) {
+	zone := r.PathValue("name")
+	if _, ok := s.findZone(zone); zone != "" && !ok {
+		writeError(w, r, http.StatusNotFound, "Zone not found")
+		return "", false
+	}
+	return zone, true
+}
+
+// maintenanceScope names what a maintenance mode covers, for logs and messages
+func maintenanceScope(zone string) string {
+	if zone == "" {
+		return "every zone"
+	}
+	return zone
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+// metricsRegistry holds every metric served on /metrics
+// A dedicated registry (instead of the global default) keeps the output limited
+// to what we register here and what the Go and process collectors report
+var metricsRegistry = prometheus.NewRegistry()
+
+// HTTP request metrics, labelled by the ServeMux pattern rather than the raw path
+// so /api/users/1 and /api/users/2 share a series
+var (
+	httpRequests = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by method, route, and status code.",
+	}, []string{"method", "route", "status"})
+
+	// Latency is labelled by route only: one histogram per endpoint gives its p99
+	// directly, and status codes would multiply every bucket series
+	httpRequestDuration = promauto.With(metricsRegistry).NewHistogramVec(prometheus.HistogramOpts{
+		Name: "http_request_duration_seconds",
+		Help: "Time from receiving a request to finishing its response, by method and route.",
+		// Fine-grained where API calls land (5ms-1s), coarse up to long polls (30s)
+		Buckets: []float64{.005, .01, .025, .05, .075, .1, .15, .25, .35, .5, .75, 1, 2.5, 5, 10, 30},
+	}, []string{"method", "route"})
+
+	// 5xx responses per endpoint, so an alert's error rate is a single division:
+	// rate(http_server_errors_total) / rate(http_requests_total)
+	httpServerErrors = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "http_server_errors_total",
+		Help: "HTTP requests answered with a 5xx status, by method and route.",
+	}, []string{"method", "route"})
+)
+
+// Database query metrics, recorded by gormMetrics
+// Connection pool stats (go_sql_*) come from collectors.NewDBStatsCollector, registered by registerDBMetrics
+var (
+	dbQueries = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "db_queries_total",
+		Help: "Database queries run through GORM, by operation, table, and outcome (ok or error).",
+	}, []string{"operation", "table", "outcome"})
+
+	dbQueryDuration = promauto.With(metricsRegistry).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Time spent running database queries, by operation and table.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 10},
+	}, []string{"operation", "table"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// registerCacheMetrics registers the flag cache and zone status metrics of s
+// Called once by runServer: a second Server registering them would panic, so
+// other instances (e.g. in tests) simply don't export them
+func (s *Server) registerCacheMetrics() {
+	// Flag cache counters are read from the cache itself when Prometheus scrapes
+	factory := promauto.With(metricsRegistry)
+	factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "flag_cache_entries",
+		Help: "Feature flags currently held in the in-memory cache.",
+	}, func() float64 { return float64(s.flagCache.Stats().Size) })
+	factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "flag_cache_capacity",
+		Help: "Maximum number of feature flags the cache holds (FLAG_CACHE_SIZE).",
+	}, func() float64 { return float64(s.flagCache.Stats().Capacity) })
+	factory.NewCounterFunc(prometheus.CounterOpts{
+		Name: "flag_cache_hits_total",
+		Help: "Feature flag lookups served from the cache.",
+	}, func() float64 { return float64(s.flagCache.Stats().Hits) })
+	factory.NewCounterFunc(prometheus.CounterOpts{
+		Name: "flag_cache_misses_total",
+		Help: "Feature flag lookups that had to load from the database.",
+	}, func() float64 { return float64(s.flagCache.Stats().Misses) })
+	factory.NewCounterFunc(prometheus.CounterOpts{
+		Name: "flag_cache_evictions_total",
+		Help: "Feature flags dropped from the cache to make room for others.",
+	}, func() float64 { return float64(s.flagCache.Stats().Evictions) })
+
+	s.registerZoneStatusMetrics()
+}
+
+// registerDBMetrics exports the connection pool of s's database (open, in use, idle,
+// wait count and duration) as go_sql_* metrics. Called once by runServer, like
+// registerCacheMetrics, since the collector's series can only be registered once
+func (s *Server) registerDBMetrics() {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return
+	}
+	metricsRegistry.MustRegister(collectors.NewDBStatsCollector(sqlDB, "primary"))
+}
+
+// metricsHandler serves the registry in the Prometheus exposition format
+func metricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// metricsMiddleware records the count and duration of every request handled by next,
+// and feeds the server's SLO tracker (see slo.go)
+// mux is used only to look up the route pattern a request matched
+func (s *Server) metricsMiddleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		elapsed := time.Since(start)
+		_, route := mux.Handler(r)
+		s.slo.observe(r.Method, route, sw.status, elapsed)
+
+		// Unmatched paths share one series, so scanners can't create unbounded label values
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(sw.status)).Inc()
+		httpRequestDuration.WithLabelValues(r.Method, route).Observe(elapsed.Seconds())
+		if sw.status >= http.StatusInternalServerError {
+			httpServerErrors.WithLabelValues(r.Method, route).Inc()
+		}
+	})
+}
+
+// gormMetrics is a GORM plugin that counts and times queries per operation and table
+type gormMetrics struct{}
+
+// Name implements gorm.Plugin
+func (gormMetrics) Name() string { return "metrics" }
+
+// gormStartKey is where the query start time is kept on the statement between callbacks
+const gormStartKey = "metrics:start"
+
+// Initialize implements gorm.Plugin by registering before/after callbacks for every operation
+func (p gormMetrics) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("metrics:before_create", p.before),
+		cb.Create().After("gorm:create").Register("metrics:after_create", p.after("create")),
+		cb.Query().Before("gorm:query").Register("metrics:before_query", p.before),
+		cb.Query().After("gorm:query").Register("metrics:after_query", p.after("query")),
+		cb.Update().Before("gorm:update").Register("metrics:before_update", p.before),
+		cb.Update().After("gorm:update").Register("metrics:after_update", p.after("update")),
+		cb.Delete().Before("gorm:delete").Register("metrics:before_delete", p.before),
+		cb.Delete().After("gorm:delete").Register("metrics:after_delete", p.after("delete")),
+		cb.Row().Before("gorm:row").Register("metrics:before_row", p.before),
+		cb.Row().After("gorm:row").Register("metrics:after_row", p.after("row")),
+		cb.Raw().Before("gorm:raw").Register("metrics:before_raw", p.before),
+		cb.Raw().After("gorm:raw").Register("metrics:after_raw", p.after("raw")),
+	)
+}
+
+// before records when the query started
+func (gormMetrics) before(tx *gorm.DB) {
+	tx.InstanceSet(gormStartKey, time.Now())
+}
+
+// after observes the query's duration and outcome
+func (gormMetrics) after(operation string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		value, ok := tx.InstanceGet(gormStartKey)
+		if !ok {
+			return
+		}
+		// Raw SQL (migrations, pg_notify) has no table
+		table := tx.Statement.Table
+		if table == "" {
+			table = "none"
+		}
+		outcome := "ok"
+		if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			outcome = "error"
+		}
+		dbQueries.WithLabelValues(operation, table, outcome).Inc()
+		dbQueryDuration.WithLabelValues(operation, table).Observe(time.Since(value.(time.Time)).Seconds())
+	}
+}
+
+// statusResponseWriter remembers the status code and body size of the response
+// (used by the metrics and access log middleware)
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+// WriteHeader records the first status code and passes it on
+func (sw *statusResponseWriter) WriteHeader(code int) {
+	if !sw.wroteHeader {
+		sw.status = code
+		sw.wroteHeader = true
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+// Write implies a 200 status if WriteHeader wasn't called
+func (sw *statusResponseWriter) Write(p []byte) (int, error) {
+	sw.wroteHeader = true
+	n, err := sw.ResponseWriter.Write(p)
+	sw.bytes += int64(n)
+	return n, err
+}
+
+// Flush keeps streaming responses (NDJSON, CSV) working through the wrapper
+func (sw *statusResponseWriter) Flush() {
+	if flusher, ok := sw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the underlying ResponseWriter to http.ResponseController
+func (sw *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
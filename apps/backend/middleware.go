@@ -0,0 +1,299 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/nextjs-microfrontend/backend/internal/cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+)
+
+// Cross-cutting behavior is composed in two places instead of at every registration:
+// Server.handler lists, in order, the middleware every public request goes through
+// (access log, tracing, metrics, recovery, CORS, ...), and routes puts endpoints in
+// route groups whose middleware (rate limit, API version, auth, request timeout)
+// applies to every route registered on them
+
+// middleware wraps a handler with behavior shared by many routes
+type middleware func(http.Handler) http.Handler
+
+// chain is a list of middleware; the first one sees the request first
+// nil entries are skipped, so optional middleware can be listed in place
+type chain []middleware
+
+// then wraps h in the chain
+func (c chain) then(h http.Handler) http.Handler {
+	for i := len(c) - 1; i >= 0; i-- {
+		if c[i] != nil {
+			h = c[i](h)
+		}
+	}
+	return h
+}
+
+// with returns c followed by m, leaving c as it was
+func (c chain) with(m ...middleware) chain {
+	return append(c[:len(c):len(c)], m...)
+}
+
+// routeMiddleware adapts middleware that looks up the route pattern on mux
+// (for metrics and log labels) to a plain middleware
+func routeMiddleware(mux *http.ServeMux, wrap func(*http.ServeMux, http.Handler) http.Handler) middleware {
+	return func(next http.Handler) http.Handler {
+		return wrap(mux, next)
+	}
+}
+
+// routeGroup registers routes under a path prefix, each wrapped in the group's chain
+type routeGroup struct {
+	mux    *http.ServeMux
+	prefix string
+	chain  chain
+}
+
+// newRouteGroup returns the root group of mux, with no prefix
+func newRouteGroup(mux *http.ServeMux, m ...middleware) *routeGroup {
+	return &routeGroup{mux: mux, chain: chain(m)}
+}
+
+// group returns a group under prefix (relative to g's) whose routes also go through m, after g's middleware
+func (g *routeGroup) group(prefix string, m ...middleware) *routeGroup {
+	return &routeGroup{mux: g.mux, prefix: g.prefix + prefix, chain: g.chain.with(m...)}
+}
+
+// handle registers h for pattern ("[METHOD ]/path", the path relative to the group's prefix),
+// wrapped in the group's middleware and then m
+func (g *routeGroup) handle(pattern string, h http.Handler, m ...middleware) {
+	method, path, hasMethod := strings.Cut(pattern, " ")
+	if !hasMethod {
+		method, path = "", pattern
+	}
+	pattern = g.prefix + path
+	if method != "" {
+		pattern = method + " " + pattern
+	}
+	g.mux.Handle(pattern, g.chain.with(m...).then(h))
+}
+
+// handleFunc is handle for a handler function
+func (g *routeGroup) handleFunc(pattern string, h http.HandlerFunc, m ...middleware) {
+	g.handle(pattern, h, m...)
+}
+
+// requireAPIToken makes requests that change data (anything but GET, HEAD, and
+// OPTIONS) send "Authorization: Bearer <API_TOKEN>"; it does nothing while API_TOKEN is empty
+// Reads stay open so zones can fetch flags and status without a secret
+func (s *Server) requireAPIToken(next http.Handler) http.Handler {
+	token := s.config.API.Token
+	if token == "" {
+		return next
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if checkAPIToken(w, r, want) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// requireAdminToken is requireAPIToken for every method, reads included, for routes whose data
+// isn't for the zones to read: visitors' emails and messages, or the zones' internal endpoints
+func (s *Server) requireAdminToken(next http.Handler) http.Handler {
+	token := s.config.API.Token
+	if token == "" {
+		return next
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if checkAPIToken(w, r, want) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// checkAPIToken reports whether r sends want as its Authorization header
+// It writes the 401 response when it doesn't
+func checkAPIToken(w http.ResponseWriter, r *http.Request, want []byte) bool {
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="backend-api"`)
+		writeError(w, r, http.StatusUnauthorized, "missing or invalid API token")
+		return false
+	}
+	return true
+}
+
+// randomToken returns 128 random bits as 32 hex digits, for secrets (API keys, webhook secrets,
+// newsletter tokens) and for IDs nobody should be able to guess (webhook events, upload keys)
+func randomToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requireProjectToken is requireAPIToken for the routes that only touch the data of the
+// request's project (users, flags, GraphQL), which also accept a project API key (see tenancy.go)
+// It goes after resolveTenant, which has already refused unknown keys
+func (s *Server) requireProjectToken(next http.Handler) http.Handler {
+	withToken := s.requireAPIToken(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hasProjectKey(r.Context()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		withToken.ServeHTTP(w, r)
+	})
+}
+
+// requireProjectAdminToken is requireAdminToken for the routes that read the request's project's
+// history (the activity feed), which also accept a project API key; it goes after resolveTenant too
+func (s *Server) requireProjectAdminToken(next http.Handler) http.Handler {
+	withToken := s.requireAdminToken(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hasProjectKey(r.Context()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		withToken.ServeHTTP(w, r)
+	})
+}
+
+// rateLimited counts requests answered 429 by the rate limiter
+var rateLimited = promauto.With(metricsRegistry).NewCounter(prometheus.CounterOpts{
+	Name: "http_rate_limited_total",
+	Help: "Requests rejected for exceeding RATE_LIMIT_RPS.",
+})
+
+// Clients tracked by the rate limiter; the least recently seen are forgotten first
+// (and start again with a full burst)
+const rateLimitClients = 10000
+
+// rateLimiter allows each client (by clientIP) limit requests per second on average,
+// in bursts of up to burst; a limit of 0 lets everything through
+type rateLimiter struct {
+	mu      sync.Mutex
+	clients *cache.LRU[string, *rate.Limiter]
+	limit   rate.Limit
+	burst   int
+}
+
+// newRateLimiter returns the /api limiter for RATE_LIMIT_RPS and RATE_LIMIT_BURST
+// It is built even when RATE_LIMIT_RPS is 0, so a reload can switch it on
+func newRateLimiter(cfg APIConfig) *rateLimiter {
+	l := &rateLimiter{clients: cache.NewLRU[string, *rate.Limiter](rateLimitClients)}
+	l.setRate(rate.Limit(cfg.RateLimitRPS), cfg.RateLimitBurst)
+	return l
+}
+
+// setRate changes the limit and burst; when either changes, every client starts again
+// with a full burst at the new rate
+func (l *rateLimiter) setRate(limit rate.Limit, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if limit == l.limit && burst == l.burst {
+		return
+	}
+	l.limit, l.burst = limit, burst
+	l.clients.Purge()
+}
+
+// rate returns the current limit and burst
+func (l *rateLimiter) rate() (rate.Limit, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit, l.burst
+}
+
+// allow reports whether client may make a request now
+func (l *rateLimiter) allow(client string) bool {
+	l.mu.Lock()
+	if l.limit <= 0 {
+		l.mu.Unlock()
+		return true
+	}
+	limiter, ok := l.clients.Load(client)
+	if !ok {
+		limiter = rate.NewLimiter(l.limit, l.burst)
+		l.clients.Store(client, limiter)
+	}
+	l.mu.Unlock()
+	return limiter.Allow()
+}
+
+// rateLimitMiddleware answers 429 to clients over their RATE_LIMIT_RPS budget
+func (s *Server) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.live.rateLimit.allow(s.clientIP(r)) {
+			rateLimited.Inc()
+			w.Header().Set("Retry-After", "1")
+			writeError(w, r, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the address of the client that sent r, for the per-client limits
+// Only a request from one of TRUSTED_PROXIES has its X-Forwarded-For believed, since anyone
+// else can set the header to anything; the client is then the right-most address in it
+// that isn't a trusted proxy, the last hop no one between us and it could have forged
+func (s *Server) clientIP(r *http.Request) string {
+	host := remoteHost(r)
+	if !s.trustedProxy(host) {
+		return host
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" || s.trustedProxy(hop) {
+			continue
+		}
+		if addr, err := netip.ParseAddr(hop); err == nil {
+			return addr.Unmap().String()
+		}
+		// A trusted proxy passed on something that isn't an address; don't guess past it
+		return host
+	}
+	return host
+}
+
+// trustedProxy reports whether addr is in TRUSTED_PROXIES
+func (s *Server) trustedProxy(addr string) bool {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, prefix := range s.trustedProxies {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies turns TRUSTED_PROXIES (addresses and CIDR ranges, already validated
+// by loadConfig) into prefixes; a single address is a prefix of its full length
+func parseTrustedProxies(entries []string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(entry); err == nil {
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	return prefixes
+}
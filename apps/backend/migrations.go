@@ -0,0 +1,308 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migration is a schema change that AutoMigrate can't express from struct tags,
+// such as composite indexes with a sort order
+// Migrations run once, in order, and are recorded in the schema_migrations table
+type migration struct {
+	ID          string
+	Description string
+	Statements  []string // Run one at a time; pgx doesn't allow several statements in one Exec
+	Down        []string // Undo Statements, for `backend migrate down`
+	// Statements and Down for MySQL, which has no CREATE INDEX IF NOT EXISTS and names the
+	// table in DROP INDEX; it never had the indexes older migrations replaced
+	MySQL     []string
+	MySQLDown []string
+	// PostgresOnly migrations use what only Postgres has (e.g. tsvector), and the code that
+	// needs them does without on the other dialects; there they are recorded but run nothing
+	PostgresOnly bool
+}
+
+// up returns the statements that apply m on database's dialect
+func (m migration) up(database *gorm.DB) []string {
+	switch {
+	case m.PostgresOnly && database.Dialector.Name() != "postgres":
+		return nil
+	case database.Dialector.Name() == "mysql":
+		return m.MySQL
+	}
+	return m.Statements
+}
+
+// down returns the statements that undo m on database's dialect
+func (m migration) down(database *gorm.DB) []string {
+	switch {
+	case m.PostgresOnly && database.Dialector.Name() != "postgres":
+		return nil
+	case database.Dialector.Name() == "mysql":
+		return m.MySQLDown
+	}
+	return m.Down
+}
+
+// schemaMigration is a row in schema_migrations
+type schemaMigration struct {
+	ID        string `gorm:"primaryKey"`
+	AppliedAt time.Time
+}
+
+// TableName keeps the table name stable regardless of GORM's naming strategy
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// migrationLockID is the Postgres advisory lock held while migrations run,
+// so pods starting at the same time don't apply the same migration twice
+const migrationLockID = 741852
+
+// migrationLockName is the MySQL named lock for the same purpose
+const migrationLockName = "backend_migrations"
+
+// migrations are applied in order after AutoMigrate; never edit or reorder one that has shipped
+// Each index matches a query the API runs; TestQueryPlans checks that the planner uses it,
+// so add a case there with any new index
+var migrations = []migration{
+	{
+		ID:          "0001_feature_flags_enabled_key",
+		Description: "Index flags by enabled state and key",
+		// Meant for ?filter=enabled eq true, but the list is ordered by id and lookups use
+		// idx_feature_flags_project_key, so the planner never chose it (dropped by 0005)
+		Statements: []string{
+			`CREATE INDEX IF NOT EXISTS idx_feature_flags_enabled_key ON feature_flags (enabled, key)`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_feature_flags_enabled_key`,
+		},
+		MySQL: []string{
+			"CREATE INDEX idx_feature_flags_enabled_key ON feature_flags (enabled, `key`)",
+		},
+		MySQLDown: []string{
+			`DROP INDEX idx_feature_flags_enabled_key ON feature_flags`,
+		},
+	},
+	{
+		ID:          "0002_users_created_at",
+		Description: "Index users by creation time",
+		// Serves the dashboard's "created in the last 7 days" count and its 5 most recent users,
+		// which otherwise scan and sort the whole table
+		Statements: []string{
+			`CREATE INDEX IF NOT EXISTS idx_users_created_at ON users (created_at DESC)`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_users_created_at`,
+		},
+		MySQL: []string{
+			`CREATE INDEX idx_users_created_at ON users (created_at DESC)`,
+		},
+		MySQLDown: []string{
+			`DROP INDEX idx_users_created_at ON users`,
+		},
+	},
+	{
+		ID:          "0003_deployment_events_zone_created_at",
+		Description: "Index deployment events by zone and time",
+		// Serves GET /api/deployments?zone=..., which reads the newest 100 events for one zone
+		// The composite index also covers zone-only lookups, so the single-column one is dropped
+		Statements: []string{
+			`CREATE INDEX IF NOT EXISTS idx_deployment_events_zone_created_at ON deployment_events (zone, created_at DESC)`,
+			`DROP INDEX IF EXISTS idx_deployment_events_zone`,
+		},
+		Down: []string{
+			`CREATE INDEX IF NOT EXISTS idx_deployment_events_zone ON deployment_events (zone)`,
+			`DROP INDEX IF EXISTS idx_deployment_events_zone_created_at`,
+		},
+		MySQL: []string{
+			`CREATE INDEX idx_deployment_events_zone_created_at ON deployment_events (zone, created_at DESC)`,
+		},
+		MySQLDown: []string{
+			`CREATE INDEX idx_deployment_events_zone ON deployment_events (zone)`,
+			`DROP INDEX idx_deployment_events_zone_created_at ON deployment_events`,
+		},
+	},
+	{
+		ID:          "0004_search_vectors",
+		Description: "Add full-text search vectors to users, flags, and announcements",
+		// Serves GET /api/search (see search.go) from GIN indexes instead of scanning every row;
+		// the generated columns stay current without triggers, and their weights match searchSources
+		PostgresOnly: true,
+		Statements: []string{
+			`ALTER TABLE users ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (` +
+				`setweight(to_tsvector('simple', coalesce(name, '')), 'A') || ` +
+				`setweight(to_tsvector('simple', coalesce(email, '')), 'B')) STORED`,
+			`CREATE INDEX IF NOT EXISTS idx_users_search_vector ON users USING GIN (search_vector)`,
+			`ALTER TABLE feature_flags ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (` +
+				`setweight(to_tsvector('simple', coalesce(key, '') || ' ' || coalesce(name, '')), 'A') || ` +
+				`setweight(to_tsvector('simple', coalesce(description, '')), 'B')) STORED`,
+			`CREATE INDEX IF NOT EXISTS idx_feature_flags_search_vector ON feature_flags USING GIN (search_vector)`,
+			`ALTER TABLE announcements ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (` +
+				`setweight(to_tsvector('simple', coalesce(message, '')), 'A')) STORED`,
+			`CREATE INDEX IF NOT EXISTS idx_announcements_search_vector ON announcements USING GIN (search_vector)`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_announcements_search_vector`,
+			`ALTER TABLE announcements DROP COLUMN IF EXISTS search_vector`,
+			`DROP INDEX IF EXISTS idx_feature_flags_search_vector`,
+			`ALTER TABLE feature_flags DROP COLUMN IF EXISTS search_vector`,
+			`DROP INDEX IF EXISTS idx_users_search_vector`,
+			`ALTER TABLE users DROP COLUMN IF EXISTS search_vector`,
+		},
+	},
+	{
+		ID:          "0005_drop_feature_flags_enabled_key",
+		Description: "Drop the unused flag index on enabled state and key",
+		// Filtered flag lists walk the primary key for their ORDER BY id, so the index only slowed writes
+		Statements: []string{
+			`DROP INDEX IF EXISTS idx_feature_flags_enabled_key`,
+		},
+		Down: []string{
+			`CREATE INDEX IF NOT EXISTS idx_feature_flags_enabled_key ON feature_flags (enabled, key)`,
+		},
+		MySQL: []string{
+			`DROP INDEX idx_feature_flags_enabled_key ON feature_flags`,
+		},
+		MySQLDown: []string{
+			"CREATE INDEX idx_feature_flags_enabled_key ON feature_flags (enabled, `key`)",
+		},
+	},
+}
+
+// runMigrations applies any migrations that haven't run yet
+// Each migration runs in its own transaction together with its schema_migrations row
+func runMigrations(database *gorm.DB) error {
+	if err := database.AutoMigrate(&schemaMigration{}); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	unlock, err := lockMigrationRun(database)
+	if err != nil {
+		return fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	defer unlock()
+
+	for _, m := range migrations {
+		err := database.Transaction(func(tx *gorm.DB) error {
+			if err := lockMigrations(tx); err != nil {
+				return err
+			}
+
+			var applied int64
+			if err := tx.Model(&schemaMigration{}).Where("id = ?", m.ID).Count(&applied).Error; err != nil {
+				return err
+			}
+			if applied > 0 {
+				return nil
+			}
+
+			for _, statement := range m.up(tx) {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+			log.Printf("Applied migration %s: %s", m.ID, m.Description)
+			return tx.Create(&schemaMigration{ID: m.ID, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s failed: %w", m.ID, err)
+		}
+	}
+	return nil
+}
+
+// lockMigrationRun keeps other replicas from migrating on MySQL until the returned function is called
+// MySQL commits DDL immediately, ending tx, so the lock is held for the whole run instead of
+// per migration like lockMigrations; on the other dialects it does nothing
+func lockMigrationRun(database *gorm.DB) (func(), error) {
+	if database.Dialector.Name() != "mysql" {
+		return func() {}, nil
+	}
+	return mysqlLock(database, migrationLockName)
+}
+
+// lockMigrations keeps other replicas from migrating until tx ends
+// SQLite needs no lock: only one process opens the file, and its writes are serialized anyway
+func lockMigrations(tx *gorm.DB) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	// Released automatically when the transaction ends
+	return tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockID).Error
+}
+
+// rollbackMigrations undoes the last steps applied migrations, newest first
+// Tables and columns created by AutoMigrate are left in place
+func rollbackMigrations(database *gorm.DB, steps int) error {
+	if err := database.AutoMigrate(&schemaMigration{}); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	unlock, err := lockMigrationRun(database)
+	if err != nil {
+		return fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	defer unlock()
+
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		m := migrations[i]
+		rolledBack := false
+		err := database.Transaction(func(tx *gorm.DB) error {
+			if err := lockMigrations(tx); err != nil {
+				return err
+			}
+
+			result := tx.Where("id = ?", m.ID).Delete(&schemaMigration{})
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+
+			for _, statement := range m.down(tx) {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+			rolledBack = true
+			log.Printf("Rolled back migration %s: %s", m.ID, m.Description)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("rollback of %s failed: %w", m.ID, err)
+		}
+		if rolledBack {
+			steps--
+		}
+	}
+	return nil
+}
+
+// migrationState is one line of `backend migrate status`
+type migrationState struct {
+	migration
+	AppliedAt *time.Time // nil while pending
+}
+
+// migrationStatus lists every migration with when it was applied
+func migrationStatus(database *gorm.DB) ([]migrationState, error) {
+	var applied []schemaMigration
+	if database.Migrator().HasTable(&schemaMigration{}) {
+		if err := database.Find(&applied).Error; err != nil {
+			return nil, err
+		}
+	}
+	appliedAt := make(map[string]time.Time, len(applied))
+	for _, row := range applied {
+		appliedAt[row.ID] = row.AppliedAt
+	}
+
+	states := make([]migrationState, len(migrations))
+	for i, m := range migrations {
+		states[i].migration = m
+		if at, ok := appliedAt[m.ID]; ok {
+			states[i].AppliedAt = &at
+		}
+	}
+	return states, nil
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+)
+
+// Mock mode (--mock) serves the same REST routes from an in-memory store filled with
+// realistic sample data, so zone developers can run the backend without Postgres
+//
+// Writes (create, update, delete) work and are visible to later reads, but everything
+// resets on restart. ?filter= and ?orderby= are ignored because they translate to SQL
+
+// mockStore holds the data served in mock mode
+type mockStore struct {
+	mu          sync.Mutex
+	users       []models.User
+	flags       []models.FeatureFlag
+	deployments []models.DeploymentEvent
+	zones       []zoneTarget
+	nextUserID  uint
+	nextFlagID  uint
+}
+
+// Names used to generate sample users
+var (
+	mockFirstNames = []string{
+		"Alice", "Bob", "Charlie", "Diana", "Eve", "Frank", "Grace", "Hiro", "Isabel", "Jamal",
+		"Kenji", "Lena", "Mateo", "Nadia", "Oscar", "Priya", "Quinn", "Rosa", "Sami", "Tara",
+	}
+	mockLastNames = []string{
+		"Johnson", "Smith", "Brown", "Prince", "Anderson", "Garcia", "Okafor", "Tanaka", "Rossi", "Nguyen",
+		"Müller", "Kowalski", "Silva", "Haddad", "Larsen", "Patel", "Murphy", "Costa", "Ivanova", "Wilkins",
+	}
+)
+
+// mockFeatureFlags are the sample flags, including the ones the zones read
+var mockFeatureFlags = []models.FeatureFlag{
+	{Key: "show_welcome_banner", Name: "Show Welcome Banner", Description: "Show the welcome banner on the zone-main home page", Enabled: true},
+	{Key: "new_dashboard", Name: "New Dashboard", Description: "Use the redesigned admin dashboard layout", Enabled: false},
+	{Key: "beta_features", Name: "Beta Features", Description: "Enable features that are still being tested", Enabled: false},
+	{Key: "dark_mode", Name: "Dark Mode", Description: "Offer a dark color scheme toggle in the header", Enabled: true},
+	{Key: "maintenance_banner", Name: "Maintenance Banner", Description: "Warn visitors about upcoming scheduled maintenance", Enabled: false},
+	{Key: "checkout_v2", Name: "Checkout v2", Description: "Route purchases through the new checkout flow", Enabled: true},
+}
+
+// newMockStore builds the sample data relative to now so "created last 7 days" stats look realistic
+// zones are the zones to make up deployments and statuses for
+func newMockStore(now time.Time, zones []zoneTarget) *mockStore {
+	m := &mockStore{zones: zones}
+
+	// 40 users spread over the last month, oldest first so IDs increase with creation time
+	for i := 0; i < 40; i++ {
+		first := mockFirstNames[i%len(mockFirstNames)]
+		last := mockLastNames[(i+i/len(mockFirstNames)*7)%len(mockLastNames)]
+		created := now.Add(-time.Duration(40-i) * 18 * time.Hour)
+		m.nextUserID++
+		m.users = append(m.users, models.User{
+			ID:        m.nextUserID,
+			Email:     strings.ToLower(fmt.Sprintf("%s.%s@example.com", first, strings.ReplaceAll(last, "ü", "u"))),
+			Name:      first + " " + last,
+			CreatedAt: created,
+			UpdatedAt: created,
+		})
+	}
+
+	for i, flag := range mockFeatureFlags {
+		m.nextFlagID++
+		flag.ID = m.nextFlagID
+		flag.CreatedAt = now.AddDate(0, 0, -30+i*3)
+		flag.UpdatedAt = now.Add(-time.Duration(i+1) * 5 * time.Hour)
+		m.flags = append(m.flags, flag)
+	}
+
+	// A short deployment history for every zone
+	var eventID uint
+	for i, zone := range zones {
+		for j, status := range []string{"success", "failure", "success"} {
+			eventID++
+			healthStatus := "healthy"
+			if status == "failure" {
+				healthStatus = "unhealthy"
+			}
+			m.deployments = append(m.deployments, models.DeploymentEvent{
+				ID:           eventID,
+				Zone:         zone.Name,
+				Source:       "github",
+				DeliveryID:   fmt.Sprintf("mock-%d", eventID),
+				EventType:    "deployment_status",
+				Action:       "created",
+				Environment:  zone.Name,
+				Ref:          "main",
+				SHA:          fmt.Sprintf("%07x", 0xa1b2c3d+eventID*4099),
+				Status:       status,
+				URL:          fmt.Sprintf("https://github.com/example/nextjs-microfrontend/actions/runs/%d", 9000+eventID),
+				Actor:        strings.ToLower(mockFirstNames[(i*3+j)%len(mockFirstNames)]),
+				HealthStatus: healthStatus,
+				CreatedAt:    now.Add(-time.Duration((2-j)*26+i*3) * time.Hour),
+			})
+		}
+	}
+	sort.Slice(m.deployments, func(a, b int) bool {
+		return m.deployments[a].CreatedAt.After(m.deployments[b].CreatedAt)
+	})
+
+	return m
+}
+
+// mockAPIHandlers returns handlers that serve m instead of the database
+// They are the database handlers with in-memory repositories; the change feed is
+// already in memory, so it is shared too
+func (s *Server) mockAPIHandlers(m *mockStore) apiHandlers {
+	return s.newAPIHandlers(mockUsers{m}, mockFlags{m}, zoneStatusFunc(m.zoneStatuses), m.deploymentsHandler)
+}
+
+// zoneStatuses reports every zone as healthy without contacting it
+func (m *mockStore) zoneStatuses() []models.ZoneStatus {
+	statuses := make([]models.ZoneStatus, len(m.zones))
+	for i, zone := range m.zones {
+		statuses[i] = models.ZoneStatus{
+			Name:      zone.Name,
+			Status:    "healthy",
+			URL:       zone.URL,
+			LastCheck: time.Now(),
+			Message:   "Mock mode: zone was not checked",
+		}
+	}
+	return statuses
+}
+
+// mockPage returns the items on the requested page
+func mockPage[T any](items []T, page pageRequest) []T {
+	start := min(page.Offset(), len(items))
+	end := min(start+page.PageSize, len(items))
+	return items[start:end]
+}
+
+// mockUsers is the UserRepository of mock mode
+type mockUsers struct{ *mockStore }
+
+func (m mockUsers) List(ctx context.Context, query listQuery) ([]models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]models.User(nil), mockPage(m.users, query.page)...), nil
+}
+
+func (m mockUsers) Count(ctx context.Context, query listQuery) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int64(len(m.users)), nil
+}
+
+func (m mockUsers) Export(ctx context.Context, query listQuery) (rowCursor[models.User], error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return newSliceCursor(append([]models.User(nil), m.users...)), nil
+}
+
+// findUser returns the index of the user with the given ID, or -1
+// Callers must hold m.mu
+func (m mockUsers) findUser(id string) int {
+	for i, user := range m.users {
+		if strconv.FormatUint(uint64(user.ID), 10) == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m mockUsers) Get(ctx context.Context, id string) (models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.findUser(id)
+	if i < 0 {
+		return models.User{}, errNotFound
+	}
+	return m.users[i], nil
+}
+
+// emailTaken reports whether any user has email, like the unique constraint on the users table
+// Callers must hold m.mu
+func (m mockUsers) emailTaken(email string) bool {
+	for _, user := range m.users {
+		if user.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+// add assigns the next ID and timestamps to user and stores it
+// Callers must hold m.mu
+func (m mockUsers) add(user *models.User) {
+	now := time.Now()
+	m.nextUserID++
+	user.ID, user.CreatedAt, user.UpdatedAt = m.nextUserID, now, now
+	m.users = append(m.users, *user)
+}
+
+func (m mockUsers) Create(ctx context.Context, user *models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.emailTaken(user.Email) {
+		return errors.New("duplicate email")
+	}
+	m.add(user)
+	return nil
+}
+
+// CreateMany checks existing users and the batch itself before adding any
+func (m mockUsers) CreateMany(ctx context.Context, users []models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	emails := make(map[string]bool, len(users))
+	for _, user := range users {
+		if emails[user.Email] || m.emailTaken(user.Email) {
+			return fmt.Errorf("duplicate email %s", user.Email)
+		}
+		emails[user.Email] = true
+	}
+	for i := range users {
+		m.add(&users[i])
+	}
+	return nil
+}
+
+func (m mockUsers) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.findUser(id)
+	if i < 0 {
+		return errNotFound
+	}
+	m.users = append(m.users[:i], m.users[i+1:]...)
+	return nil
+}
+
+func (m mockUsers) Seed(ctx context.Context, users []models.User) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	created := 0
+	for _, user := range users {
+		if m.emailTaken(user.Email) {
+			continue
+		}
+		m.add(&user)
+		created++
+	}
+	return created, nil
+}
+
+func (m mockUsers) Upsert(ctx context.Context, users []models.User) (models.SeedCounts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := models.SeedCounts{Total: len(users)}
+	for _, user := range users {
+		i := slices.IndexFunc(m.users, func(u models.User) bool { return u.Email == user.Email })
+		switch {
+		case i < 0:
+			m.add(&user)
+			counts.Created++
+		case m.users[i].Name != user.Name:
+			m.users[i].Name, m.users[i].UpdatedAt = user.Name, time.Now()
+			counts.Updated++
+		default:
+			counts.Unchanged++
+		}
+	}
+	return counts, nil
+}
+
+func (m mockUsers) Stats(ctx context.Context) (models.UserStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var stats models.UserStats
+	weekAgo := time.Now().AddDate(0, 0, -7)
+	stats.Total = int64(len(m.users))
+	for _, user := range m.users {
+		if !user.CreatedAt.Before(weekAgo) {
+			stats.CreatedLast7d++
+		}
+	}
+	recent := append([]models.User(nil), m.users...)
+	sort.Slice(recent, func(a, b int) bool { return recent[a].CreatedAt.After(recent[b].CreatedAt) })
+	stats.Recent = recent[:min(5, len(recent))]
+	return stats, nil
+}
+
+// mockFlags is the FlagRepository of mock mode
+type mockFlags struct{ *mockStore }
+
+func (m mockFlags) List(ctx context.Context, query listQuery) ([]models.FeatureFlag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]models.FeatureFlag(nil), mockPage(m.flags, query.page)...), nil
+}
+
+func (m mockFlags) Count(ctx context.Context, query listQuery) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int64(len(m.flags)), nil
+}
+
+func (m mockFlags) Export(ctx context.Context, query listQuery) (rowCursor[models.FeatureFlag], error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return newSliceCursor(append([]models.FeatureFlag(nil), m.flags...)), nil
+}
+
+func (m mockFlags) All(ctx context.Context) ([]models.FeatureFlag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	flags := append([]models.FeatureFlag(nil), m.flags...)
+	sort.Slice(flags, func(a, b int) bool { return flags[a].Key < flags[b].Key })
+	return flags, nil
+}
+
+// findFlag returns the index of the flag with the given key, or -1
+// Callers must hold m.mu
+func (m mockFlags) findFlag(key string) int {
+	for i, flag := range m.flags {
+		if flag.Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m mockFlags) Get(ctx context.Context, key string) (models.FeatureFlag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.findFlag(key)
+	if i < 0 {
+		return models.FeatureFlag{}, errNotFound
+	}
+	return m.flags[i], nil
+}
+
+// add assigns the next ID and timestamps to flag and stores it
+// Callers must hold m.mu
+func (m mockFlags) add(flag *models.FeatureFlag) {
+	now := time.Now()
+	m.nextFlagID++
+	flag.ID, flag.CreatedAt, flag.UpdatedAt = m.nextFlagID, now, now
+	m.flags = append(m.flags, *flag)
+}
+
+func (m mockFlags) Create(ctx context.Context, flag *models.FeatureFlag) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.findFlag(flag.Key) >= 0 {
+		return errors.New("duplicate key")
+	}
+	m.add(flag)
+	return nil
+}
+
+// CreateMany checks existing flags and the batch itself before adding any
+func (m mockFlags) CreateMany(ctx context.Context, flags []models.FeatureFlag) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make(map[string]bool, len(flags))
+	for _, flag := range flags {
+		if keys[flag.Key] || m.findFlag(flag.Key) >= 0 {
+			return fmt.Errorf("duplicate key %s", flag.Key)
+		}
+		keys[flag.Key] = true
+	}
+	for i := range flags {
+		m.add(&flags[i])
+	}
+	return nil
+}
+
+func (m mockFlags) Upsert(ctx context.Context, flags []models.FeatureFlag) (models.SeedCounts, map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := models.SeedCounts{Total: len(flags)}
+	changed := map[string]string{}
+	for _, flag := range flags {
+		i := m.findFlag(flag.Key)
+		switch {
+		case i < 0:
+			m.add(&flag)
+			counts.Created++
+			changed[flag.Key] = "created"
+		case m.flags[i].Name != flag.Name || m.flags[i].Description != flag.Description || m.flags[i].Enabled != flag.Enabled:
+			stored := &m.flags[i]
+			stored.Name, stored.Description, stored.Enabled, stored.UpdatedAt = flag.Name, flag.Description, flag.Enabled, time.Now()
+			counts.Updated++
+			changed[flag.Key] = "updated"
+		default:
+			counts.Unchanged++
+		}
+	}
+	return counts, changed, nil
+}
+
+func (m mockFlags) Sync(ctx context.Context, flags []models.CreateFeatureFlagRequest, dryRun, prune bool) (bundlePlan[models.CreateFeatureFlagRequest], error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	plan := planFlags(m.flags, flags, prune)
+	if dryRun {
+		return plan, nil
+	}
+	for _, f := range slices.Concat(plan.create, mapValues(plan.update)) {
+		flag := models.FeatureFlag{Key: f.Key, Name: f.Name, Description: f.Description, Enabled: f.Enabled}
+		if i := m.findFlag(f.Key); i >= 0 {
+			stored := &m.flags[i]
+			stored.Name, stored.Description, stored.Enabled, stored.UpdatedAt = flag.Name, flag.Description, flag.Enabled, time.Now()
+		} else {
+			m.add(&flag)
+		}
+	}
+	deleted := map[string]bool{}
+	for _, change := range plan.changes {
+		deleted[change.Key] = change.Action == "deleted"
+	}
+	m.flags = slices.DeleteFunc(m.flags, func(f models.FeatureFlag) bool { return deleted[f.Key] })
+	return plan, nil
+}
+
+func (m mockFlags) Update(ctx context.Context, key string, req models.UpdateFeatureFlagRequest) (models.FeatureFlag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.findFlag(key)
+	if i < 0 {
+		return models.FeatureFlag{}, errNotFound
+	}
+
+	flag := &m.flags[i]
+	if req.Name != nil {
+		flag.Name = *req.Name
+	}
+	if req.Description != nil {
+		flag.Description = *req.Description
+	}
+	if req.Enabled != nil {
+		flag.Enabled = *req.Enabled
+	}
+	flag.UpdatedAt = time.Now()
+	return *flag, nil
+}
+
+func (m mockFlags) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.findFlag(key)
+	if i < 0 {
+		return errNotFound
+	}
+	m.flags = append(m.flags[:i], m.flags[i+1:]...)
+	return nil
+}
+
+func (m *mockStore) deploymentsHandler(w http.ResponseWriter, r *http.Request) {
+	zone := r.URL.Query().Get("zone")
+
+	m.mu.Lock()
+	events := []models.DeploymentEvent{}
+	for _, event := range m.deployments {
+		if zone == "" || event.Zone == zone {
+			events = append(events, event)
+		}
+	}
+	m.mu.Unlock()
+
+	if wantsCSV(r) {
+		writeCSV(w, r, "deployments.csv", events, deploymentCSVColumns)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, events)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// `backend mockzone` stands in for a Next.js zone during local development: it answers every path
+// with a small HTML page, healthy or not as --behavior says, so the health poller, incidents, and
+// the zone.incident webhooks, Slack messages, and emails can be worked on without running the
+// zones. Point ZONE_MAIN_URL or ZONE_ADMIN_URL at it, and switch its behavior while it runs with
+// PUT /_mockzone?behavior=down
+
+// mockZoneBehaviors are the values of --behavior, in the order the help lists them
+var mockZoneBehaviors = []string{"healthy", "degraded", "slow", "flaky", "flapping", "down"}
+
+// mockZoneOptions are the flags of `backend mockzone`, which PUT /_mockzone can change
+type mockZoneOptions struct {
+	Name      string        `json:"name"`
+	Behavior  string        `json:"behavior"`
+	Status    int           `json:"status"`    // Status of the responses that fail
+	Latency   string        `json:"latency"`   // Delay of every response with slow
+	ErrorRate float64       `json:"errorRate"` // Share of responses that fail with flaky
+	Period    string        `json:"period"`    // How long flapping stays up, then down
+	latency   time.Duration // Parsed Latency
+	period    time.Duration // Parsed Period
+}
+
+// validate parses the durations and checks every option, so a typo fails before anything is served
+func (o *mockZoneOptions) validate() error {
+	if !slices.Contains(mockZoneBehaviors, o.Behavior) {
+		return fmt.Errorf("behavior must be one of %s", strings.Join(mockZoneBehaviors, ", "))
+	}
+	if o.Status < 400 || o.Status > 599 {
+		return fmt.Errorf("status must be between 400 and 599")
+	}
+	if o.ErrorRate < 0 || o.ErrorRate > 1 {
+		return fmt.Errorf("error rate must be between 0 and 1")
+	}
+	var err error
+	if o.latency, err = time.ParseDuration(o.Latency); err != nil || o.latency < 0 {
+		return fmt.Errorf("latency must be a duration, e.g. 8s")
+	}
+	if o.period, err = time.ParseDuration(o.Period); err != nil || o.period <= 0 {
+		return fmt.Errorf("period must be a positive duration, e.g. 30s")
+	}
+	return nil
+}
+
+// mockZonePage is the page served by a mock zone without --html, and for every failed response
+var mockZonePage = template.Must(template.New("mockzone").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>{{.Name}}</title></head>
+<body>
+<h1>{{.Name}}</h1>
+<p>Mock zone ({{.Behavior}}): HTTP {{.Status}}</p>
+</body>
+</html>
+`))
+
+// mockZone is the handler of `backend mockzone`
+type mockZone struct {
+	mu      sync.Mutex
+	options mockZoneOptions
+	since   time.Time // When the behavior was last set, where flapping starts up
+	html    []byte    // The --html page for successful responses; nil for the built-in one
+}
+
+// newMockZone creates a mock zone with validated options
+func newMockZone(options mockZoneOptions, html []byte) *mockZone {
+	return &mockZone{options: options, since: time.Now(), html: html}
+}
+
+// current returns the options in effect and when they were set
+func (z *mockZone) current() (mockZoneOptions, time.Time) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.options, z.since
+}
+
+// ServeHTTP answers every path but /_mockzone as the zone would with its behavior
+func (z *mockZone) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/_mockzone" {
+		z.controlHandler(w, r)
+		return
+	}
+
+	options, since := z.current()
+	failed := false
+	switch options.Behavior {
+	case "degraded":
+		failed = true
+	case "slow":
+		if !sleepContext(r.Context(), options.latency) {
+			return // The client, such as a health check past HEALTH_CHECK_TIMEOUT, gave up
+		}
+	case "flaky":
+		failed = rand.Float64() < options.ErrorRate
+	case "flapping":
+		failed = time.Since(since)/options.period%2 == 1
+	case "down":
+		// Closing the connection without a response is what a crashed zone looks like to the
+		// health check, which reports it as unhealthy rather than degraded
+		if conn, _, err := http.NewResponseController(w).Hijack(); err == nil {
+			conn.Close()
+			log.Printf("%s %s: connection closed", r.Method, r.URL.Path)
+			return
+		}
+		failed = true
+	}
+
+	status := http.StatusOK
+	if failed {
+		status = options.Status
+	}
+	log.Printf("%s %s: %d", r.Method, r.URL.Path, status)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if status == http.StatusOK && z.html != nil {
+		w.Write(z.html)
+		return
+	}
+	mockZonePage.Execute(w, map[string]any{"Name": options.Name, "Behavior": options.Behavior, "Status": status})
+}
+
+// controlHandler responds to GET and PUT /_mockzone
+// PUT changes the options given as query parameters (behavior, status, latency, error-rate,
+// period) and returns them all, like GET
+func (z *mockZone) controlHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		z.mu.Lock()
+		options := z.options
+		query := r.URL.Query()
+		if query.Has("behavior") {
+			options.Behavior = query.Get("behavior")
+		}
+		if query.Has("status") {
+			options.Status, _ = strconv.Atoi(query.Get("status"))
+		}
+		if query.Has("latency") {
+			options.Latency = query.Get("latency")
+		}
+		if query.Has("error-rate") {
+			var err error
+			if options.ErrorRate, err = strconv.ParseFloat(query.Get("error-rate"), 64); err != nil {
+				options.ErrorRate = -1
+			}
+		}
+		if query.Has("period") {
+			options.Period = query.Get("period")
+		}
+		if err := options.validate(); err != nil {
+			z.mu.Unlock()
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		z.options = options
+		z.since = time.Now()
+		z.mu.Unlock()
+		log.Printf("Behavior is now %s", options.Behavior)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	options, _ := z.current()
+	writeJSON(w, r, http.StatusOK, options)
+}
+
+// readMockZoneHTML reads the --html page, if one was given
+func readMockZoneHTML(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	html, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read --html: %w", err)
+	}
+	return html, nil
+}
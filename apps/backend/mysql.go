@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"github.com/nextjs-microfrontend/backend/internal/tenant"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// DB_DRIVER=mysql connects to MySQL 8 with the DB_* settings (set DB_PORT=3306). It serves
+// the same models, migrations, and endpoints as Postgres; what differs:
+//
+//   - flag changes reach other replicas by polling (flagPoller), since MySQL has no LISTEN/NOTIFY
+//   - migrations hold a named lock (GET_LOCK) for the whole run, and a failed one isn't rolled
+//     back, since MySQL commits DDL immediately
+//   - backups (pg_dump) aren't available
+
+// mysqlDialector opens the MySQL database on host
+// Strings without a size become VARCHAR(255) instead of LONGTEXT, which MySQL can't index
+// (Postgres and SQLite don't need a length); long text is type:text in the models
+func mysqlDialector(cfg DatabaseConfig, host string) gorm.Dialector {
+	return mysql.New(mysql.Config{DSN: mysqlDSN(cfg, host), DefaultStringSize: 255})
+}
+
+// mysqlDSN builds a MySQL connection string for host from the DB_* settings
+// Times are read and written in UTC, like Postgres timestamptz columns
+func mysqlDSN(cfg DatabaseConfig, host string) string {
+	dsn := mysqldriver.NewConfig()
+	dsn.Net = "tcp"
+	dsn.Addr = net.JoinHostPort(host, strconv.Itoa(cfg.Port))
+	dsn.User = cfg.User
+	dsn.Passwd = cfg.Password
+	dsn.DBName = cfg.Name
+	dsn.ParseTime = true
+	dsn.Loc = time.UTC
+	dsn.Params = map[string]string{"charset": "utf8mb4"}
+	return dsn.FormatDSN()
+}
+
+// mysqlLock waits for the MySQL named lock name and returns the function that releases it
+// GET_LOCK belongs to the session rather than a transaction, so it is taken on a connection
+// of its own that goes back to the pool only once the lock is released
+func mysqlLock(database *gorm.DB, name string) (func(), error) {
+	sqlDB, err := database.DB()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, -1)", name).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if acquired.Int64 != 1 {
+		conn.Close()
+		return nil, fmt.Errorf("failed to acquire lock %s", name)
+	}
+	return func() {
+		conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", name)
+		conn.Close()
+	}, nil
+}
+
+// flagPoller keeps this replica's flag cache and change feed in step with flag changes
+// made on other replicas when there is no LISTEN/NOTIFY: every FLAG_SNAPSHOT_REFRESH it
+// compares each flag's updated_at with the previous poll
+type flagPoller struct {
+	s *Server
+
+	mu    sync.Mutex
+	local map[string]bool      // Flags changed on this replica since the last poll, already published
+	seen  map[string]time.Time // By tenant.FlagKey
+}
+
+// newFlagPoller creates a poller for s; it becomes s's broadcast hook so local changes aren't published twice
+func newFlagPoller(s *Server) *flagPoller {
+	p := &flagPoller{s: s, local: map[string]bool{}}
+	s.changes.broadcast = p.localChange
+	return p
+}
+
+// localChange records a flag written by this replica (the change feed's broadcast hook)
+func (p *flagPoller) localChange(key, action string) {
+	p.mu.Lock()
+	p.local[key] = true
+	p.mu.Unlock()
+}
+
+// run polls until the process exits
+func (p *flagPoller) run() {
+	ticker := time.NewTicker(p.s.config.API.FlagSnapshotRefresh)
+	defer ticker.Stop()
+	log.Printf("Polling for flag changes from other replicas every %s", p.s.config.API.FlagSnapshotRefresh)
+	for {
+		if err := p.poll(context.Background()); err != nil {
+			log.Printf("Failed to poll for flag changes: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// poll applies the flag changes since the previous poll; the first one only takes stock
+func (p *flagPoller) poll(ctx context.Context) error {
+	var flags []models.FeatureFlag
+	// Replicas may lag behind the primary, which would make changes look undone
+	if err := p.s.db.WithContext(ctx).Clauses(dbresolver.Write).Select("project_id", "key", "updated_at").Find(&flags).Error; err != nil {
+		return err
+	}
+	current := make(map[string]time.Time, len(flags))
+	for _, flag := range flags {
+		current[tenant.FlagKey(flag.ProjectID, flag.Key)] = flag.UpdatedAt
+	}
+
+	p.mu.Lock()
+	previous, local := p.seen, p.local
+	p.seen, p.local = current, map[string]bool{}
+	p.mu.Unlock()
+	if previous == nil {
+		return nil
+	}
+
+	changed := func(key, action string) {
+		if local[key] {
+			return
+		}
+		p.s.live.logLevel.debugf("flag %s %s on another replica", key, action)
+		p.s.flagCache.Delete(key)
+		p.s.changes.publish("flag", key, action)
+	}
+	for key, updatedAt := range current {
+		if before, ok := previous[key]; !ok {
+			changed(key, "created")
+		} else if !updatedAt.Equal(before) {
+			changed(key, "updated")
+		}
+	}
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			changed(key, "deleted")
+		}
+	}
+	return nil
+}
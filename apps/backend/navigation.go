@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// The navigation menu is data: the shell in each zone fetches GET /api/navigation when it
+// renders, so adding a section that lives in another zone is a POST to /api/navigation/items
+// instead of a coordinated deploy of every zone. Items can depend on a feature flag, which
+// makes launching a section a flag flip, and on the viewer's role, which the shell passes
+// along as ?role= since it owns the session
+
+// navigationKeyPattern is the allowed format for navigation item keys (e.g. "feature-flags")
+var navigationKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// validNavigationHref accepts a path on the site (but not a protocol-relative "//host" URL)
+// or an absolute http(s) URL for external links
+func validNavigationHref(href string) bool {
+	if strings.HasPrefix(href, "/") {
+		return !strings.HasPrefix(href, "//")
+	}
+	u, err := url.Parse(href)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// checkNavigationItem returns the problems with an item that the validate tags can't see
+// A flag that doesn't exist yet is allowed; the item stays hidden until it is created and on
+func (s *Server) checkNavigationItem(item models.NavigationItem) []models.FieldError {
+	var fieldErrors []models.FieldError
+	if _, ok := s.findZone(item.Zone); item.Zone != "" && !ok {
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "zone", Message: "must be a zone (" + s.zoneNames() + ")"})
+	}
+	if item.Flag != "" && !flagKeyPattern.MatchString(item.Flag) {
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "flag", Message: "must contain only lowercase letters, digits, and underscores"})
+	}
+	return fieldErrors
+}
+
+// navigationOrder is the order items are shown in
+func navigationOrder(query *gorm.DB) *gorm.DB {
+	return query.Order("position").Order("id")
+}
+
+// getNavigationHandler responds to GET /api/navigation?role=
+// The items the viewer sees, in order: those without a flag or whose flag is on, and without
+// roles or with the viewer's role; without ?role= only the items for everyone
+func (s *Server) getNavigationHandler(w http.ResponseWriter, r *http.Request) {
+	role := r.URL.Query().Get("role")
+	var items []models.NavigationItem
+	if err := navigationOrder(s.db.WithContext(r.Context())).Find(&items).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+
+	// Flags come from the flag cache, and each one is looked up once however many items use it
+	flagOn := map[string]bool{}
+	visible := []models.NavigationItem{}
+	for _, item := range items {
+		if len(item.Roles) > 0 && !slices.Contains(item.Roles, role) {
+			continue
+		}
+		if item.Flag != "" {
+			on, seen := flagOn[item.Flag]
+			if !seen {
+				flag, err := s.flags.get(r.Context(), item.Flag)
+				if err != nil && !errors.Is(err, errNotFound) {
+					writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+					return
+				}
+				on = err == nil && flag.Enabled
+				flagOn[item.Flag] = on
+			}
+			if !on {
+				continue
+			}
+		}
+		visible = append(visible, item)
+	}
+	writeJSON(w, r, http.StatusOK, visible)
+}
+
+// listNavigationItemsHandler responds to GET /api/navigation/items
+// Every item in order, whatever its flag and roles, for editing the menu
+func (s *Server) listNavigationItemsHandler(w http.ResponseWriter, r *http.Request) {
+	var items []models.NavigationItem
+	if err := navigationOrder(s.db.WithContext(r.Context())).Find(&items).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, items)
+}
+
+// createNavigationItemHandler responds to POST /api/navigation/items
+func (s *Server) createNavigationItemHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateNavigationItemRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	item := models.NavigationItem{Key: req.Key, Label: req.Label, Href: req.Href, Zone: req.Zone, Flag: req.Flag, Roles: models.StringList(req.Roles)}
+	if item.Roles == nil {
+		item.Roles = models.StringList{}
+	}
+	if fieldErrors := s.checkNavigationItem(item); len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+	if req.Position != nil {
+		item.Position = *req.Position
+	} else {
+		var last struct{ Position *int }
+		if err := s.db.WithContext(r.Context()).Model(&models.NavigationItem{}).Select("MAX(position) AS position").Scan(&last).Error; err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+			return
+		}
+		if last.Position != nil {
+			item.Position = *last.Position + 1
+		}
+	}
+
+	var existing int64
+	if err := s.db.WithContext(r.Context()).Model(&models.NavigationItem{}).Where(byKey(req.Key)).Count(&existing).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	if existing > 0 {
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("A navigation item with key %s already exists", req.Key))
+		return
+	}
+	if err := s.db.WithContext(r.Context()).Create(&item).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to create navigation item: %v", err))
+		return
+	}
+	log.Printf("Navigation item %s added: %s", item.Key, item.Href)
+
+	w.Header().Set("Location", fmt.Sprintf("%s/api/navigation/items/%s", s.config.Server.BasePath, item.Key))
+	writeJSON(w, r, http.StatusCreated, item)
+}
+
+// getNavigationItemHandler responds to GET /api/navigation/items/{key}
+func (s *Server) getNavigationItemHandler(w http.ResponseWriter, r *http.Request) {
+	if item, ok := findBy[models.NavigationItem](w, r, s.db, "Navigation item", byKey(r.PathValue("key"))); ok {
+		writeJSON(w, r, http.StatusOK, item)
+	}
+}
+
+// updateNavigationItemHandler responds to PATCH /api/navigation/items/{key}
+func (s *Server) updateNavigationItemHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateNavigationItemRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	item, ok := findBy[models.NavigationItem](w, r, s.db, "Navigation item", byKey(r.PathValue("key")))
+	if !ok {
+		return
+	}
+
+	if req.Label != nil {
+		item.Label = *req.Label
+	}
+	if req.Href != nil {
+		item.Href = *req.Href
+	}
+	if req.Zone != nil {
+		item.Zone = *req.Zone
+	}
+	if req.Position != nil {
+		item.Position = *req.Position
+	}
+	if req.Flag != nil {
+		item.Flag = *req.Flag
+	}
+	if req.Roles != nil {
+		item.Roles = models.StringList(req.Roles)
+	}
+	if fieldErrors := s.checkNavigationItem(item); len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+	if err := s.db.WithContext(r.Context()).Save(&item).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to update navigation item: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, item)
+}
+
+// deleteNavigationItemHandler responds to DELETE /api/navigation/items/{key}
+func (s *Server) deleteNavigationItemHandler(w http.ResponseWriter, r *http.Request) {
+	item, ok := findBy[models.NavigationItem](w, r, s.db, "Navigation item", byKey(r.PathValue("key")))
+	if !ok {
+		return
+	}
+	if err := s.db.WithContext(r.Context()).Delete(&item).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "Navigation item deleted successfully"})
+}
+
+// orderNavigationHandler responds to PUT /api/navigation/order
+// Renumbers every item in the given order in one transaction, e.g. after dragging items around
+// in zone-admin; the keys must be exactly the existing items
+func (s *Server) orderNavigationHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.NavigationOrderRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	err := s.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		var keys []string
+		if err := tx.Model(&models.NavigationItem{}).Pluck("key", &keys).Error; err != nil {
+			return err
+		}
+		slices.Sort(keys)
+		requested := slices.Clone(req.Keys)
+		slices.Sort(requested)
+		if !slices.Equal(keys, requested) {
+			return errNavigationOrderMismatch
+		}
+		for i, key := range req.Keys {
+			if err := tx.Model(&models.NavigationItem{}).Where(byKey(key)).Update("position", i).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errNavigationOrderMismatch):
+		writeError(w, r, http.StatusBadRequest, "keys must list every navigation item exactly once")
+		return
+	case err != nil:
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to reorder navigation: %v", err))
+		return
+	}
+	s.listNavigationItemsHandler(w, r)
+}
+
+// errNavigationOrderMismatch is returned when a reorder doesn't name every item exactly once
+var errNavigationOrderMismatch = errors.New("navigation order mismatch")
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// ndjsonContentType is the media type for newline-delimited JSON
+// Each line of the response body is one complete JSON object
+const ndjsonContentType = "application/x-ndjson"
+
+// ndjsonFlushEvery controls how many rows are written between flushes
+// Flushing sends buffered rows to the client so it can start processing early
+const ndjsonFlushEvery = 100
+
+// wantsNDJSON reports whether the client asked for an NDJSON stream via the Accept header
+func wantsNDJSON(r *http.Request) bool {
+	return acceptsMediaType(r, ndjsonContentType)
+}
+
+// streamNDJSON writes every row of rows as one JSON object per line, and closes rows
+// Rows are read from a database cursor one at a time instead of loading the whole
+// table into a slice, so memory use stays flat no matter how many rows there are
+func streamNDJSON[T any](w http.ResponseWriter, r *http.Request, rows rowCursor[T]) {
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+	extendWriteDeadline(w, requestConfig(r).Server.WriteTimeout)
+
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w) // Encode appends the newline after each object
+
+	count := 0
+	for rows.Next() {
+		var item T
+		if err := rows.Scan(&item); err != nil {
+			// Headers are already sent, so the best we can do is stop and log
+			log.Printf("NDJSON stream aborted while scanning row: %v", err)
+			return
+		}
+		if err := encoder.Encode(item); err != nil {
+			// Usually means the client disconnected
+			log.Printf("NDJSON stream aborted while writing: %v", err)
+			return
+		}
+
+		count++
+		if flusher != nil && count%ndjsonFlushEvery == 0 {
+			flusher.Flush()
+			extendWriteDeadline(w, requestConfig(r).Server.WriteTimeout)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("NDJSON stream aborted by cursor error: %v", err)
+	}
+}
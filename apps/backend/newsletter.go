@@ -0,0 +1,276 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/cache"
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
+)
+
+// zone-main's footer signup form posts to POST /api/newsletter/subscribe. Signups are double
+// opt-in: the address is stored as pending and emailed a link to NEWSLETTER_CONFIRM_URL with a
+// token, and only once that page posts the token to /api/newsletter/confirm is it confirmed.
+// The first email to an address also links to NEWSLETTER_UNSUBSCRIBE_URL with the subscription's
+// unsubscribe token. The token is made once per address, so that link keeps working, and only its
+// hash is stored, so later confirmation emails go without one. Signing up answers the same way
+// whatever the address's state, so the form can't be used to find out who is subscribed; the
+// confirmed list is exported from GET /api/newsletter/subscriptions, which needs API_TOKEN like
+// every read of visitors' addresses
+
+// newsletterSubscriptionFilterFields are the subscription fields ?filter= and ?orderby= accept
+var newsletterSubscriptionFilterFields = filterFields{
+	"id":             {Column: "id", Kind: filterNumber},
+	"email":          {Column: "email", Kind: filterString},
+	"status":         {Column: "status", Kind: filterString},
+	"zone":           {Column: "zone", Kind: filterString},
+	"confirmedAt":    {Column: "confirmed_at", Kind: filterTime},
+	"unsubscribedAt": {Column: "unsubscribed_at", Kind: filterTime},
+	"createdAt":      {Column: "created_at", Kind: filterTime},
+}
+
+// newsletterSubscriptionCSVColumns are the columns of GET /api/newsletter/subscriptions as CSV,
+// in default order
+var newsletterSubscriptionCSVColumns = []csvColumn[models.NewsletterSubscription]{
+	{"id", func(n models.NewsletterSubscription) string { return strconv.FormatUint(uint64(n.ID), 10) }},
+	{"email", func(n models.NewsletterSubscription) string { return n.Email }},
+	{"status", func(n models.NewsletterSubscription) string { return n.Status }},
+	{"zone", func(n models.NewsletterSubscription) string { return n.Zone }},
+	{"confirmedAt", func(n models.NewsletterSubscription) string { return csvOptionalTime(n.ConfirmedAt) }},
+	{"unsubscribedAt", func(n models.NewsletterSubscription) string { return csvOptionalTime(n.UnsubscribedAt) }},
+	{"createdAt", func(n models.NewsletterSubscription) string { return csvTime(n.CreatedAt) }},
+}
+
+// csvOptionalTime formats a timestamp that may be unset
+func csvOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return csvTime(*t)
+}
+
+// newNewsletterRateLimiter allows each client NEWSLETTER_RATE_LIMIT signups an hour, all at once
+// or spread out, or returns nil when it is 0
+func newNewsletterRateLimiter(cfg NewsletterConfig) *rateLimiter {
+	if cfg.RateLimit <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		clients: cache.NewLRU[string, *rate.Limiter](rateLimitClients),
+		limit:   rate.Every(time.Hour / time.Duration(cfg.RateLimit)),
+		burst:   cfg.RateLimit,
+	}
+}
+
+// hashNewsletterToken is what is stored of a confirmation or unsubscribe token
+func hashNewsletterToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newsletterLink is page (NEWSLETTER_CONFIRM_URL or NEWSLETTER_UNSUBSCRIBE_URL) with ?token=
+func newsletterLink(page, token string) string {
+	link, err := url.Parse(page)
+	if err != nil {
+		return page // Checked by the config validation
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String()
+}
+
+// subscribeHandler responds to POST /api/newsletter/subscribe
+// 202 for every valid address: a new or unsubscribed address becomes pending and is sent a
+// confirmation link, a pending one is sent a new link (the old one stops working), and a confirmed
+// one is left alone. The unsubscribe token is only made for a new address; 429 past
+// NEWSLETTER_RATE_LIMIT
+func (s *Server) subscribeHandler(w http.ResponseWriter, r *http.Request) {
+	if s.newsletterLimit != nil && !s.newsletterLimit.allow(s.clientIP(r)) {
+		w.Header().Set("Retry-After", strconv.Itoa(int((time.Hour / time.Duration(s.config.Newsletter.RateLimit)).Seconds())))
+		writeError(w, r, http.StatusTooManyRequests, "Too many signups; try again later")
+		return
+	}
+	var req models.SubscribeRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	if _, ok := s.findZone(req.Zone); req.Zone != "" && !ok {
+		writeValidationErrors(w, r, []models.FieldError{{Field: "zone", Message: "must be a zone (" + s.zoneNames() + ")"}})
+		return
+	}
+
+	email := strings.ToLower(req.Email)
+	var subscription models.NewsletterSubscription
+	err := s.db.WithContext(r.Context()).Where("email = ?", email).First(&subscription).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		subscription = models.NewsletterSubscription{Email: email}
+	case err != nil:
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+
+	if subscription.Status != "confirmed" {
+		confirmToken := randomToken()
+		expiresAt := time.Now().Add(s.config.Newsletter.TokenTTL)
+		subscription.Status = "pending"
+		subscription.Zone = req.Zone
+		subscription.ConfirmTokenHash, subscription.ConfirmExpiresAt = hashNewsletterToken(confirmToken), &expiresAt
+		// Only the hash is kept, so a later email can't repeat the link; it goes without one
+		var unsubscribeToken string
+		if subscription.UnsubscribeTokenHash == "" {
+			unsubscribeToken = randomToken()
+			subscription.UnsubscribeTokenHash = hashNewsletterToken(unsubscribeToken)
+		}
+		subscription.UnsubscribedAt = nil
+		if err := s.db.WithContext(r.Context()).Save(&subscription).Error; err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to save subscription: %v", err))
+			return
+		}
+		s.sendNewsletterConfirmation(r, subscription, confirmToken, unsubscribeToken)
+	}
+	writeJSON(w, r, http.StatusAccepted, models.MessageResponse{Message: "Check your inbox to confirm your subscription"})
+}
+
+// sendNewsletterConfirmation emails the confirmation link for subscription, with the unsubscribe
+// link unless unsubscribeToken is empty (an earlier email has it)
+func (s *Server) sendNewsletterConfirmation(r *http.Request, subscription models.NewsletterSubscription, confirmToken, unsubscribeToken string) {
+	if s.mailer == nil {
+		log.Printf("Newsletter confirmation for subscription %d not sent: EMAIL_PROVIDER is not set", subscription.ID)
+		return
+	}
+	data := map[string]string{"url": newsletterLink(s.config.Newsletter.ConfirmURL, confirmToken), "unsubscribeUrl": ""}
+	if unsubscribeToken != "" {
+		data["unsubscribeUrl"] = newsletterLink(s.config.Newsletter.UnsubscribeURL, unsubscribeToken)
+	}
+	if _, err := s.mailer.enqueue(r.Context(), "newsletter-confirm", subscription.Email, data); err != nil {
+		log.Printf("Failed to queue newsletter confirmation for subscription %d: %v", subscription.ID, err)
+	}
+}
+
+// confirmSubscriptionHandler responds to POST /api/newsletter/confirm
+// 404 for a token that isn't pending (already used, replaced by a newer signup, or made up) and
+// 410 for one past NEWSLETTER_TOKEN_TTL, which signing up again replaces
+func (s *Server) confirmSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.NewsletterTokenRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	var subscription models.NewsletterSubscription
+	err := s.db.WithContext(r.Context()).
+		Where("confirm_token_hash = ? AND status = ?", hashNewsletterToken(req.Token), "pending").
+		First(&subscription).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		writeError(w, r, http.StatusNotFound, "Confirmation link not found")
+		return
+	case err != nil:
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	now := time.Now()
+	if subscription.ConfirmExpiresAt != nil && !now.Before(*subscription.ConfirmExpiresAt) {
+		writeError(w, r, http.StatusGone, "Confirmation link expired")
+		return
+	}
+
+	subscription.Status, subscription.ConfirmedAt = "confirmed", &now
+	subscription.ConfirmTokenHash, subscription.ConfirmExpiresAt = "", nil
+	if err := s.db.WithContext(r.Context()).Save(&subscription).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to confirm subscription: %v", err))
+		return
+	}
+	log.Printf("Newsletter subscription %d confirmed", subscription.ID)
+	writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "Subscription confirmed"})
+}
+
+// unsubscribeHandler responds to POST /api/newsletter/unsubscribe
+// Works for pending and confirmed subscriptions alike, and again for one already unsubscribed,
+// so an old email's link doesn't fail; 404 for an unknown token
+func (s *Server) unsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.NewsletterTokenRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	var subscription models.NewsletterSubscription
+	err := s.db.WithContext(r.Context()).
+		Where("unsubscribe_token_hash = ?", hashNewsletterToken(req.Token)).
+		First(&subscription).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		writeError(w, r, http.StatusNotFound, "Unsubscribe link not found")
+		return
+	case err != nil:
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+
+	if subscription.Status != "unsubscribed" {
+		now := time.Now()
+		subscription.Status, subscription.UnsubscribedAt = "unsubscribed", &now
+		subscription.ConfirmTokenHash, subscription.ConfirmExpiresAt = "", nil
+		if err := s.db.WithContext(r.Context()).Save(&subscription).Error; err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to unsubscribe: %v", err))
+			return
+		}
+		log.Printf("Newsletter subscription %d unsubscribed", subscription.ID)
+	}
+	writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "You have been unsubscribed"})
+}
+
+// listNewsletterSubscriptionsHandler responds to GET /api/newsletter/subscriptions
+// Newest first, narrowed with the shared ?filter= and ?orderby= parameters, e.g.
+// ?filter=status eq "confirmed". CSV exports (Accept: text/csv) stream every match, which is
+// how the mailing list is handed to whatever sends the newsletter
+func (s *Server) listNewsletterSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	listQuery, err := parseListQuery(r, newsletterSubscriptionFilterFields)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid query: "+err.Error())
+		return
+	}
+	query := s.db.WithContext(r.Context()).Model(&models.NewsletterSubscription{})
+
+	if wantsCSV(r) {
+		rows, err := openGormCursor[models.NewsletterSubscription](listQuery.stream(query, "id DESC"))
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+			return
+		}
+		streamCSV(w, r, "newsletter-subscriptions.csv", rows, newsletterSubscriptionCSVColumns)
+		return
+	}
+
+	var subscriptions []models.NewsletterSubscription
+	if err := listQuery.apply(query, "id DESC").Find(&subscriptions).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	setNextPageLink(w, r, listQuery.page, len(subscriptions))
+	writeJSON(w, r, http.StatusOK, subscriptions)
+}
+
+// deleteNewsletterSubscriptionHandler responds to DELETE /api/newsletter/subscriptions/{id}
+// Erases the address altogether, e.g. when its owner asks; unsubscribing keeps the record
+func (s *Server) deleteNewsletterSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	subscription, ok := findByID[models.NewsletterSubscription](w, r, s.db, "Newsletter subscription")
+	if !ok {
+		return
+	}
+	if err := s.db.WithContext(r.Context()).Delete(&subscription).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	log.Printf("Newsletter subscription %d deleted", subscription.ID)
+	writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "Newsletter subscription deleted successfully"})
+}
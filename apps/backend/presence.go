@@ -0,0 +1,187 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"github.com/nextjs-microfrontend/backend/internal/tenant"
+)
+
+// The zones send a heartbeat to POST /api/zones/{name}/heartbeat every so often for each open
+// session (e.g. every 30 seconds from a visible tab), and a session counts as active until
+// ANALYTICS_ACTIVE_WINDOW passes without one. Sessions are only held in memory, as a hash of their
+// ID, so each replica counts the heartbeats it received; the admin dashboard's live counter is
+// fed by GET /api/zones/{name}/active-users and the activeUsers events of /api/changes
+
+// presenceSweepInterval is how often expired sessions are dropped and count changes published,
+// so a burst of heartbeats is one change event rather than one per heartbeat
+const presenceSweepInterval = 5 * time.Second
+
+// presenceTracker holds the last heartbeat of every active session per zone
+type presenceTracker struct {
+	window      time.Duration // ANALYTICS_ACTIVE_WINDOW: how recent a heartbeat keeps a session active
+	maxSessions int           // ANALYTICS_MAX_ACTIVE_SESSIONS
+
+	mu        sync.Mutex
+	sessions  map[string]map[string]time.Time // Zone -> session hash -> last heartbeat
+	total     int                             // Sessions across zones, bounded by ANALYTICS_MAX_ACTIVE_SESSIONS
+	published map[string]int                  // Count last published per zone
+
+	changes *changeFeed
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// newPresenceTracker creates an empty tracker that publishes count changes to changes
+// Counts are only published while run is running
+func newPresenceTracker(changes *changeFeed, cfg AnalyticsConfig) *presenceTracker {
+	return &presenceTracker{
+		window:      cfg.ActiveWindow,
+		maxSessions: cfg.MaxActiveSessions,
+		sessions:    map[string]map[string]time.Time{},
+		published:   map[string]int{},
+		changes:     changes,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// heartbeat marks session as active in zone now
+// A new session past ANALYTICS_MAX_ACTIVE_SESSIONS isn't counted, so made-up session IDs can't
+// grow memory; it is once a sweep has made room
+func (p *presenceTracker) heartbeat(zone, session string, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sessions := p.sessions[zone]
+	if sessions == nil {
+		sessions = map[string]time.Time{}
+		p.sessions[zone] = sessions
+	}
+	hash := hashVisitor(session)
+	if _, ok := sessions[hash]; !ok {
+		if p.total >= p.maxSessions {
+			return
+		}
+		p.total++
+	}
+	sessions[hash] = now
+}
+
+// count returns how many sessions of zone had a heartbeat within ANALYTICS_ACTIVE_WINDOW of now
+func (p *presenceTracker) count(zone string, now time.Time) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cutoff := now.Add(-p.window)
+	active := 0
+	for _, seen := range p.sessions[zone] {
+		if seen.After(cutoff) {
+			active++
+		}
+	}
+	return active
+}
+
+// sweep drops the sessions that expired by now and publishes every zone whose count changed
+// since the last sweep as an activeUsers change, with the new count as its action
+func (p *presenceTracker) sweep(now time.Time) {
+	p.mu.Lock()
+	cutoff := now.Add(-p.window)
+	changed := map[string]int{}
+	for zone, sessions := range p.sessions {
+		for hash, seen := range sessions {
+			if !seen.After(cutoff) {
+				delete(sessions, hash)
+				p.total--
+			}
+		}
+		if len(sessions) != p.published[zone] {
+			changed[zone] = len(sessions)
+			p.published[zone] = len(sessions)
+		}
+		if len(sessions) == 0 {
+			delete(p.sessions, zone)
+			delete(p.published, zone)
+		}
+	}
+	p.mu.Unlock()
+
+	// Published outside the lock, since waking the change feed's clients takes its own
+	for zone, active := range changed {
+		p.changes.publish("activeUsers", zone, strconv.Itoa(active))
+	}
+}
+
+// run sweeps every presenceSweepInterval until close is called
+func (p *presenceTracker) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(presenceSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			p.sweep(now)
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// close stops run and waits for it to return; called during shutdown. Safe to call on a nil
+// tracker, or one that was never run
+func (p *presenceTracker) close() {
+	if p == nil {
+		return
+	}
+	p.once.Do(func() { close(p.stop) })
+	select {
+	case <-p.done:
+	case <-time.After(time.Second):
+	}
+}
+
+// activeUsers is the response of the active users endpoints for zone
+func (s *Server) activeUsers(zone string, now time.Time) models.ActiveUsers {
+	return models.ActiveUsers{
+		Zone:          zone,
+		ActiveUsers:   s.presence.count(zone, now),
+		WindowSeconds: int(s.config.Analytics.ActiveWindow / time.Second),
+		At:            now,
+	}
+}
+
+// heartbeatHandler responds to POST /api/zones/{name}/heartbeat
+// Marks the session in the body as active and returns the zone's active users, counting it
+func (s *Server) heartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	zone := r.PathValue("name")
+	if _, ok := s.findZone(zone); !ok {
+		writeError(w, r, http.StatusNotFound, "Zone not found")
+		return
+	}
+	var req models.HeartbeatRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	now := time.Now()
+	s.presence.heartbeat(zone, req.Session, now)
+	writeJSON(w, r, http.StatusOK, s.activeUsers(zone, now))
+}
+
+// getActiveUsersHandler responds to GET /api/zones/{name}/active-users
+// Zones outside the project are not found, as in the zone status
+func (s *Server) getActiveUsersHandler(w http.ResponseWriter, r *http.Request) {
+	zone := r.PathValue("name")
+	if _, ok := s.findZone(zone); !ok || !tenant.FromContext(r.Context()).HasZone(zone) {
+		writeError(w, r, http.StatusNotFound, "Zone not found")
+		return
+	}
+	writeJSON(w, r, http.StatusOK, s.activeUsers(zone, time.Now()))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// httpPanics counts handler panics turned into 500 responses
+var httpPanics = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+	Name: "http_panics_total",
+	Help: "Handler panics recovered by the recovery middleware, by method and route.",
+}, []string{"method", "route"})
+
+// problemContentType is the media type of RFC 9457 problem details
+const problemContentType = "application/problem+json"
+
+// problemDetails is an RFC 9457 error document
+type problemDetails struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail"`
+	Instance  string `json:"instance"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// keptOnPanic are the response headers (canonical form) set by the middleware
+// around the handler, which still apply to the 500 response
+var keptOnPanic = map[string]bool{
+	http.CanonicalHeaderKey(requestIDHeader): true,
+	"Vary":                                   true,
+	"Access-Control-Allow-Origin":            true,
+	"Access-Control-Expose-Headers":          true,
+}
+
+// recoveryMiddleware turns a panic in next into a 500 problem+json response,
+// logs the stack with the request's details, and counts it in http_panics_total
+// It sits outside sentryMiddleware, which reports the panic and re-panics
+// mux is used only to look up the route pattern
+func recoveryMiddleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// Deliberate aborts (e.g., from a reverse proxy) are handled quietly by net/http
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			_, route := mux.Handler(r)
+			requestID := w.Header().Get(requestIDHeader)
+			httpPanics.WithLabelValues(r.Method, route).Inc()
+			log.Printf("level=error msg=\"handler panic\" method=%s path=%q route=%q request_id=%s panic=%q stack=%q",
+				r.Method, r.URL.Path, route, requestID, fmt.Sprint(recovered), debug.Stack())
+
+			// Part of the response is already on the wire; aborting the connection is
+			// the only way to tell the client it is incomplete
+			if sw.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+
+			// Headers set by the handler (caching, content type) don't describe this response
+			for key := range w.Header() {
+				if !keptOnPanic[key] {
+					w.Header().Del(key)
+				}
+			}
+			writeDocument(w, http.StatusInternalServerError, problemContentType, problemDetails{
+				Type:      "about:blank",
+				Title:     http.StatusText(http.StatusInternalServerError),
+				Status:    http.StatusInternalServerError,
+				Detail:    "The server hit an unexpected error while handling this request",
+				Instance:  r.URL.Path,
+				RequestID: requestID,
+			})
+		}()
+
+		next.ServeHTTP(sw, r)
+	})
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/cache"
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Redirects are short links for marketing campaigns and the like, shared across the zones:
+// GET /r/{slug} sends the visitor on to the link's target and counts the visit, and the
+// targets are managed through /api/redirects, so a link can be pointed elsewhere without
+// deploying a zone. Lookups are cached and visits counted in memory, so following a link
+// normally doesn't touch the database
+
+// Bounds of the redirect cache, which holds the links followed recently
+const (
+	redirectCacheSize = 10000
+	// A replica that didn't make a change to a link keeps following it as it was for this long
+	redirectCacheTTL = 30 * time.Second
+)
+
+// redirectHitFlushInterval is how often the visits counted in memory are added to redirects.hits
+const redirectHitFlushInterval = 10 * time.Second
+
+// redirectSlugAlphabet is what generated slugs are made of
+const redirectSlugAlphabet = "abcdefghijkmnpqrstuvwxyz23456789" // No l, o, 0, or 1, which are easily confused
+
+// cachedRedirect is a redirect and when it was read
+type cachedRedirect struct {
+	redirect models.Redirect
+	loadedAt time.Time
+}
+
+// redirectHits are the visits to one link since the last flush
+type redirectHits struct {
+	count int64
+	last  time.Time
+}
+
+// redirectStore looks up short links through a cache and counts their visits
+type redirectStore struct {
+	db    *gorm.DB
+	cache *cache.LRU[string, cachedRedirect]
+
+	mu   sync.Mutex
+	hits map[string]*redirectHits // By slug; only slugs that exist are counted, which bounds it
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newRedirectStore creates a store that reads links from database and starts its flush loop
+func newRedirectStore(database *gorm.DB) *redirectStore {
+	s := &redirectStore{
+		db:    database,
+		cache: cache.NewLRU[string, cachedRedirect](redirectCacheSize),
+		hits:  map[string]*redirectHits{},
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// lookup returns the redirect with slug, from the cache while it is fresh
+func (s *redirectStore) lookup(ctx context.Context, slug string) (models.Redirect, error) {
+	if cached, ok := s.cache.Load(slug); ok && time.Since(cached.loadedAt) < redirectCacheTTL {
+		return cached.redirect, nil
+	}
+	var redirect models.Redirect
+	if err := s.db.WithContext(ctx).Where("slug = ?", slug).First(&redirect).Error; err != nil {
+		return redirect, err
+	}
+	s.cache.Store(slug, cachedRedirect{redirect: redirect, loadedAt: time.Now()})
+	return redirect, nil
+}
+
+// hit counts one visit to slug at now
+func (s *redirectStore) hit(slug string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hits := s.hits[slug]
+	if hits == nil {
+		hits = &redirectHits{}
+		s.hits[slug] = hits
+	}
+	hits.count++
+	hits.last = now
+}
+
+// run flushes every redirectHitFlushInterval until close is called, then flushes one last time
+func (s *redirectStore) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(redirectHitFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-s.stop:
+			s.flush()
+			return
+		}
+	}
+}
+
+// close saves the visits counted since the last flush; called during shutdown before the
+// database pool is closed. Safe to call on a nil store
+func (s *redirectStore) close() {
+	if s == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+}
+
+// flush adds the visits counted in memory to the links' hits
+// Each replica adds its own (hits = hits + n); on failure the counts are kept for the next flush
+func (s *redirectStore) flush() {
+	s.mu.Lock()
+	pending := s.hits
+	s.hits = map[string]*redirectHits{}
+	s.mu.Unlock()
+
+	for slug, hits := range pending {
+		// UpdateColumns, since a visit isn't a change to the link (updated_at stays)
+		err := s.db.Model(&models.Redirect{}).Where("slug = ?", slug).UpdateColumns(map[string]any{
+			"hits":        gorm.Expr("hits + ?", hits.count),
+			"last_hit_at": hits.last,
+		}).Error
+		if err == nil {
+			continue
+		}
+		log.Printf("Failed to save %d visits to /r/%s, retrying on the next flush: %v", hits.count, slug, err)
+		s.mu.Lock()
+		if newer, ok := s.hits[slug]; ok {
+			newer.count += hits.count
+		} else {
+			s.hits[slug] = hits
+		}
+		s.mu.Unlock()
+	}
+}
+
+// forget drops slug from this replica's cache after a change to it
+func (s *redirectStore) forget(slug string) {
+	s.cache.Delete(slug)
+}
+
+// redirectTarget is where a visit to redirect goes: its target URL, with the query parameters of
+// the short link (e.g. ?utm_source=newsletter) that the target doesn't set itself
+func redirectTarget(redirect models.Redirect, query url.Values) string {
+	if len(query) == 0 {
+		return redirect.TargetURL
+	}
+	target, err := url.Parse(redirect.TargetURL)
+	if err != nil {
+		return redirect.TargetURL
+	}
+	values := target.Query()
+	for key, value := range query {
+		if !values.Has(key) {
+			values[key] = value
+		}
+	}
+	target.RawQuery = values.Encode()
+	return target.String()
+}
+
+// followRedirectHandler responds to GET /r/{slug}
+// A 302 to the link's target, so browsers ask again (and are counted) on every visit and a
+// changed target takes effect; 404 for an unknown link and 410 for an expired one
+func (s *Server) followRedirectHandler(w http.ResponseWriter, r *http.Request) {
+	slug := r.PathValue("slug")
+	redirect, err := s.redirects.lookup(r.Context(), slug)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		writeError(w, r, http.StatusNotFound, "Link not found")
+		return
+	case err != nil:
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	now := time.Now()
+	if redirect.ExpiresAt != nil && !now.Before(*redirect.ExpiresAt) {
+		writeError(w, r, http.StatusGone, "Link expired")
+		return
+	}
+
+	s.redirects.hit(slug, now)
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, redirectTarget(redirect, r.URL.Query()), http.StatusFound)
+}
+
+// slugTaken reports whether a redirect with slug exists
+func (s *Server) slugTaken(ctx context.Context, slug string) (bool, error) {
+	var existing int64
+	err := s.db.WithContext(ctx).Model(&models.Redirect{}).Where("slug = ?", slug).Count(&existing).Error
+	return existing > 0, err
+}
+
+// newRedirectSlug generates a random slug of 7 characters
+func newRedirectSlug() string {
+	slug := make([]byte, 7)
+	for i := range slug {
+		slug[i] = redirectSlugAlphabet[rand.IntN(len(redirectSlugAlphabet))]
+	}
+	return string(slug)
+}
+
+// listRedirectsHandler responds to GET /api/redirects
+// Every redirect, including expired ones, newest first
+func (s *Server) listRedirectsHandler(w http.ResponseWriter, r *http.Request) {
+	redirects := []models.Redirect{}
+	if err := s.db.WithContext(r.Context()).Order("id DESC").Find(&redirects).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, redirects)
+}
+
+// createRedirectHandler responds to POST /api/redirects
+// Without a slug, a random one is generated
+func (s *Server) createRedirectHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateRedirectRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		writeValidationErrors(w, r, []models.FieldError{{Field: "expiresAt", Message: "must be in the future"}})
+		return
+	}
+
+	redirect := models.Redirect{Slug: req.Slug, TargetURL: req.TargetURL, ExpiresAt: req.ExpiresAt}
+	for attempt := 0; ; attempt++ {
+		if req.Slug == "" {
+			redirect.Slug = newRedirectSlug()
+		}
+		taken, err := s.slugTaken(r.Context(), redirect.Slug)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+			return
+		}
+		if !taken {
+			break
+		}
+		if req.Slug != "" || attempt == 4 {
+			writeError(w, r, http.StatusConflict, fmt.Sprintf("A redirect with slug %s already exists", redirect.Slug))
+			return
+		}
+	}
+	if err := s.db.WithContext(r.Context()).Create(&redirect).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to create redirect: %v", err))
+		return
+	}
+	log.Printf("Redirect /r/%s created: %s", redirect.Slug, redirect.TargetURL)
+
+	w.Header().Set("Location", fmt.Sprintf("%s/api/redirects/%s", s.config.Server.BasePath, redirect.Slug))
+	writeJSON(w, r, http.StatusCreated, redirect)
+}
+
+// getRedirectHandler responds to GET /api/redirects/{slug}
+func (s *Server) getRedirectHandler(w http.ResponseWriter, r *http.Request) {
+	if redirect, ok := findBy[models.Redirect](w, r, s.db, "Redirect", "slug = ?", r.PathValue("slug")); ok {
+		writeJSON(w, r, http.StatusOK, redirect)
+	}
+}
+
+// updateRedirectHandler responds to PATCH /api/redirects/{slug}
+// Setting expiresAt to now stops the link while keeping it and its hits
+func (s *Server) updateRedirectHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateRedirectRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	redirect, ok := findBy[models.Redirect](w, r, s.db, "Redirect", "slug = ?", r.PathValue("slug"))
+	if !ok {
+		return
+	}
+
+	if req.TargetURL != nil {
+		redirect.TargetURL = *req.TargetURL
+	}
+	if req.ExpiresAt != nil {
+		redirect.ExpiresAt = req.ExpiresAt
+	}
+	// Only the columns a PATCH changes, so visits saved meanwhile aren't overwritten
+	err := s.db.WithContext(r.Context()).Model(&redirect).Select("target_url", "expires_at", "updated_at").Updates(&redirect).Error
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to update redirect: %v", err))
+		return
+	}
+	s.redirects.forget(redirect.Slug)
+	log.Printf("Redirect /r/%s updated: %s", redirect.Slug, redirect.TargetURL)
+	writeJSON(w, r, http.StatusOK, redirect)
+}
+
+// deleteRedirectHandler responds to DELETE /api/redirects/{slug}
+func (s *Server) deleteRedirectHandler(w http.ResponseWriter, r *http.Request) {
+	redirect, ok := findBy[models.Redirect](w, r, s.db, "Redirect", "slug = ?", r.PathValue("slug"))
+	if !ok {
+		return
+	}
+	if err := s.db.WithContext(r.Context()).Delete(&redirect).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	s.redirects.forget(redirect.Slug)
+	log.Printf("Redirect /r/%s deleted", redirect.Slug)
+	writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "Redirect deleted successfully"})
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+)
+
+// Release notes drive the zones' "What's new" panel: each entry is what changed in one version of
+// a zone (or of the whole site), written in Markdown and managed from zone-admin through
+// /api/release-notes. The zones read what has been published from GET /api/release-notes/published,
+// so a note written ahead of a release goes out when its publish date passes. A note can also wait
+// on a feature flag, which announces a staged launch only once the flag is turned on
+
+// Bounds of GET /api/release-notes/published?limit=
+const (
+	releaseNotesDefaultLimit = 20
+	releaseNotesMaxLimit     = 100
+)
+
+// releaseNoteFilterFields are the release note fields ?filter= and ?orderby= accept
+var releaseNoteFilterFields = filterFields{
+	"id":          {Column: "id", Kind: filterNumber},
+	"version":     {Column: "version", Kind: filterString},
+	"zone":        {Column: "zone", Kind: filterString},
+	"flag":        {Column: "flag_key", Kind: filterString},
+	"publishedAt": {Column: "published_at", Kind: filterTime},
+	"createdAt":   {Column: "created_at", Kind: filterTime},
+}
+
+// checkReleaseNote returns the problems with a release note that the validate tags can't see: a
+// zone that doesn't exist and a badly formed flag. A flag that doesn't exist yet is allowed; the
+// note isn't listed until it is created and on
+func (s *Server) checkReleaseNote(note models.ReleaseNote) []models.FieldError {
+	var fieldErrors []models.FieldError
+	if _, ok := s.findZone(note.Zone); note.Zone != "" && !ok {
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "zone", Message: "must be a zone (" + s.zoneNames() + ")"})
+	}
+	if note.FlagKey != "" && !flagKeyPattern.MatchString(note.FlagKey) {
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "flag", Message: "must contain only lowercase letters, digits, and underscores"})
+	}
+	return fieldErrors
+}
+
+// releaseNoteTaken reports whether a release note other than id has note's version and zone
+func (s *Server) releaseNoteTaken(r *http.Request, note models.ReleaseNote) (bool, error) {
+	var existing int64
+	err := s.db.WithContext(r.Context()).Model(&models.ReleaseNote{}).
+		Where("version = ? AND zone = ? AND id <> ?", note.Version, note.Zone, note.ID).Count(&existing).Error
+	return existing > 0, err
+}
+
+// releaseNoteConflict is the 409 message for notes whose version and zone are taken
+func releaseNoteConflict(note models.ReleaseNote) string {
+	if note.Zone == "" {
+		return fmt.Sprintf("Release notes for version %s already exist", note.Version)
+	}
+	return fmt.Sprintf("Release notes for version %s of %s already exist", note.Version, note.Zone)
+}
+
+// listReleaseNotesHandler responds to GET /api/release-notes
+// Every release note, including drafts and scheduled ones, newest first, narrowed with the shared
+// ?filter= and ?orderby= parameters
+func (s *Server) listReleaseNotesHandler(w http.ResponseWriter, r *http.Request) {
+	listQuery, err := parseListQuery(r, releaseNoteFilterFields)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid query: "+err.Error())
+		return
+	}
+	notes := []models.ReleaseNote{}
+	if err := listQuery.apply(s.db.WithContext(r.Context()).Model(&models.ReleaseNote{}), "id DESC").Find(&notes).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	setNextPageLink(w, r, listQuery.page, len(notes))
+	writeJSON(w, r, http.StatusOK, notes)
+}
+
+// getPublishedReleaseNotesHandler responds to GET /api/release-notes/published?zone=&since=&limit=
+// The notes published so far, newest first: the zone's and the whole site's when a zone is given,
+// only those published after since when it is (for an unread count), and only those whose flag is on
+func (s *Server) getPublishedReleaseNotesHandler(w http.ResponseWriter, r *http.Request) {
+	zone := r.URL.Query().Get("zone")
+	if _, ok := s.findZone(zone); zone != "" && !ok {
+		writeError(w, r, http.StatusBadRequest, "Unknown zone "+zone+" (expected one of "+s.zoneNames()+")")
+		return
+	}
+	limit := releaseNotesDefaultLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > releaseNotesMaxLimit {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid limit %q (expected 1 to %d)", value, releaseNotesMaxLimit))
+			return
+		}
+	}
+
+	query := s.db.WithContext(r.Context()).Where("published_at <= ?", time.Now())
+	if zone != "" {
+		query = query.Where("zone IN ?", []string{zone, ""})
+	}
+	if value := r.URL.Query().Get("since"); value != "" {
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid since %q (expected an RFC 3339 time)", value))
+			return
+		}
+		query = query.Where("published_at > ?", since)
+	}
+	var notes []models.ReleaseNote
+	if err := query.Order("published_at DESC").Order("id DESC").Find(&notes).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+
+	// Flags come from the flag cache, and each one is looked up once however many notes use it
+	flagOn := map[string]bool{}
+	published := []models.ReleaseNote{}
+	for _, note := range notes {
+		if len(published) == limit {
+			break
+		}
+		if note.FlagKey != "" {
+			on, seen := flagOn[note.FlagKey]
+			if !seen {
+				flag, err := s.flags.get(r.Context(), note.FlagKey)
+				if err != nil && !errors.Is(err, errNotFound) {
+					writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+					return
+				}
+				on = err == nil && flag.Enabled
+				flagOn[note.FlagKey] = on
+			}
+			if !on {
+				continue
+			}
+		}
+		published = append(published, note)
+	}
+	writeJSON(w, r, http.StatusOK, published)
+}
+
+// createReleaseNoteHandler responds to POST /api/release-notes
+func (s *Server) createReleaseNoteHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateReleaseNoteRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	note := models.ReleaseNote{
+		Version:     req.Version,
+		Zone:        req.Zone,
+		Body:        req.Body,
+		FlagKey:     req.Flag,
+		PublishedAt: req.PublishedAt,
+	}
+	if fieldErrors := s.checkReleaseNote(note); len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+	taken, err := s.releaseNoteTaken(r, note)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	if taken {
+		writeError(w, r, http.StatusConflict, releaseNoteConflict(note))
+		return
+	}
+	if err := s.db.WithContext(r.Context()).Create(&note).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to create release note: %v", err))
+		return
+	}
+	log.Printf("Release note %d created (version %s)", note.ID, note.Version)
+
+	w.Header().Set("Location", fmt.Sprintf("%s/api/release-notes/%d", s.config.Server.BasePath, note.ID))
+	writeJSON(w, r, http.StatusCreated, note)
+}
+
+// getReleaseNoteHandler responds to GET /api/release-notes/{id}
+func (s *Server) getReleaseNoteHandler(w http.ResponseWriter, r *http.Request) {
+	if note, ok := findByID[models.ReleaseNote](w, r, s.db, "Release note"); ok {
+		writeJSON(w, r, http.StatusOK, note)
+	}
+}
+
+// updateReleaseNoteHandler responds to PATCH /api/release-notes/{id}
+func (s *Server) updateReleaseNoteHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateReleaseNoteRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	note, ok := findByID[models.ReleaseNote](w, r, s.db, "Release note")
+	if !ok {
+		return
+	}
+
+	if req.Version != nil {
+		note.Version = *req.Version
+	}
+	if req.Zone != nil {
+		note.Zone = *req.Zone
+	}
+	if req.Body != nil {
+		note.Body = *req.Body
+	}
+	if req.Flag != nil {
+		note.FlagKey = *req.Flag
+	}
+	if req.PublishedAt != nil {
+		note.PublishedAt = req.PublishedAt
+	}
+	if fieldErrors := s.checkReleaseNote(note); len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+	if req.Version != nil || req.Zone != nil {
+		taken, err := s.releaseNoteTaken(r, note)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+			return
+		}
+		if taken {
+			writeError(w, r, http.StatusConflict, releaseNoteConflict(note))
+			return
+		}
+	}
+	if err := s.db.WithContext(r.Context()).Save(&note).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to update release note: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, note)
+}
+
+// deleteReleaseNoteHandler responds to DELETE /api/release-notes/{id}
+func (s *Server) deleteReleaseNoteHandler(w http.ResponseWriter, r *http.Request) {
+	note, ok := findByID[models.ReleaseNote](w, r, s.db, "Release note")
+	if !ok {
+		return
+	}
+	if err := s.db.WithContext(r.Context()).Delete(&note).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	log.Printf("Release note %d deleted (version %s)", note.ID, note.Version)
+	writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "Release note deleted successfully"})
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/rs/cors"
+	"golang.org/x/time/rate"
+)
+
+// Some settings can change without a restart: on SIGHUP, or when the --config file
+// changes (checked every CONFIG_RELOAD_INTERVAL, which also catches Kubernetes
+// ConfigMap updates), the configuration is loaded again and these are applied
+// Any other change is logged as needing a restart. Environment variables still
+// override the file, so a reloadable setting must be set in the file to be changed
+var reloadableSettings = map[string]bool{
+	"LOG_LEVEL":            true,
+	"CORS_ALLOWED_ORIGINS": true,
+	"HEALTH_CHECK_TIMEOUT": true,
+	"ZONE_STATUS_MAX_AGE":  true,
+	"RATE_LIMIT_RPS":       true,
+	"RATE_LIMIT_BURST":     true,
+}
+
+// liveConfig holds a Server's reloadable settings
+// Server.config never changes once the server is built, so settings that change while
+// requests are being served are read from here instead
+type liveConfig struct {
+	cors         atomic.Pointer[cors.Cors] // Built from CORS_ALLOWED_ORIGINS
+	corsOrigins  atomic.Pointer[[]string]  // CORS_ALLOWED_ORIGINS itself, for GET /internal/config
+	checkTimeout atomic.Int64              // HEALTH_CHECK_TIMEOUT
+	statusMaxAge atomic.Int64              // ZONE_STATUS_MAX_AGE
+	rateLimit    *rateLimiter              // Per-client /api budget from RATE_LIMIT_RPS and RATE_LIMIT_BURST
+	logLevel     *logLevel                 // LOG_LEVEL, which PUT /internal/log-level also changes
+}
+
+// newLiveConfig returns cfg's reloadable settings
+func newLiveConfig(cfg Config) *liveConfig {
+	l := &liveConfig{rateLimit: newRateLimiter(cfg.API), logLevel: newLogLevel(cfg.Logging.Level)}
+	l.store(cfg)
+	return l
+}
+
+// store applies cfg's reloadable settings
+func (l *liveConfig) store(cfg Config) {
+	l.cors.Store(newCORS(cfg.Server.CORSAllowedOrigins))
+	l.corsOrigins.Store(&cfg.Server.CORSAllowedOrigins)
+	l.checkTimeout.Store(int64(cfg.Zones.HealthCheckTimeout))
+	l.statusMaxAge.Store(int64(cfg.Zones.StatusMaxAge))
+	l.rateLimit.setRate(rate.Limit(cfg.API.RateLimitRPS), cfg.API.RateLimitBurst)
+}
+
+func (l *liveConfig) healthCheckTimeout() time.Duration {
+	return time.Duration(l.checkTimeout.Load())
+}
+
+func (l *liveConfig) zoneStatusMaxAge() time.Duration {
+	return time.Duration(l.statusMaxAge.Load())
+}
+
+// newCORS builds the CORS (Cross-Origin Resource Sharing) policy for origins
+// This allows the Next.js admin frontend to make API calls to this backend
+func newCORS(origins []string) *cors.Cors {
+	return cors.New(cors.Options{
+		AllowedOrigins: origins, // CORS_ALLOWED_ORIGINS; "*" allows requests from any origin
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"Content-Type", requestIDHeader, projectHeader, "traceparent", "tracestate"}, // Zones' client-side fetches may carry trace context and their project
+		ExposedHeaders: []string{requestIDHeader, "Link"},
+	})
+}
+
+// corsMiddleware applies the current CORS policy, so a reload takes effect on the next request
+func (s *Server) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.live.cors.Load().ServeHTTP(w, r, next.ServeHTTP)
+	})
+}
+
+// configReloader reloads the configuration from path on SIGHUP and when the file changes
+type configReloader struct {
+	live    *liveConfig // Where the reloadable settings are applied
+	path    string
+	current Config // Last configuration loaded, to compare reloads against
+	data    []byte // Contents of path when current was loaded
+}
+
+// watchConfig starts reloading the server's configuration from its --config file in the background
+func (s *Server) watchConfig() {
+	path := s.configPath
+	r := &configReloader{live: s.live, path: path, current: s.config}
+	if path != "" {
+		r.data, _ = os.ReadFile(path)
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	// A nil channel never fires, so without a file (or with CONFIG_RELOAD_INTERVAL=0) only SIGHUP reloads
+	var poll <-chan time.Time
+	if path != "" && s.config.Server.ConfigReloadInterval > 0 {
+		poll = time.NewTicker(s.config.Server.ConfigReloadInterval).C
+	}
+
+	go func() {
+		for {
+			select {
+			case <-hangup:
+				log.Println("SIGHUP received; reloading configuration")
+				r.reload()
+			case <-poll:
+				// ConfigMap volumes swap a symlink, so compare what the path reads as now
+				data, err := os.ReadFile(path)
+				if err != nil || bytes.Equal(data, r.data) {
+					continue
+				}
+				log.Printf("%s changed; reloading configuration", path)
+				r.reload()
+			}
+		}
+	}()
+}
+
+// reload loads the configuration again and applies the reloadable settings that changed
+// An invalid file is rejected as a whole, keeping every current setting
+func (r *configReloader) reload() {
+	if r.path != "" {
+		r.data, _ = os.ReadFile(r.path)
+	}
+	next, err := loadConfig(r.path)
+	if err != nil {
+		log.Printf("Configuration reload failed; keeping the current settings: %v", err)
+		return
+	}
+
+	// Only touch the log level if it changed, so a reload doesn't cut short a
+	// temporary level set through PUT /internal/log-level
+	levelChanged := next.Logging.Level != r.current.Logging.Level
+
+	var applied, restart []string
+	for _, change := range diffConfig(r.current, next) {
+		if reloadableSettings[change.name] {
+			applied = append(applied, fmt.Sprintf("%s=%s (was %s)", change.name, change.to, change.from))
+		} else {
+			// Values are left out since some of these are secrets
+			restart = append(restart, change.name)
+		}
+	}
+	r.current = next
+
+	if len(applied) == 0 && len(restart) == 0 {
+		log.Println("Configuration reloaded; nothing changed")
+		return
+	}
+	if len(applied) > 0 {
+		if levelChanged {
+			level, _ := parseLogLevel(next.Logging.Level)
+			r.live.logLevel.set(level)
+		}
+		r.live.store(next)
+		log.Printf("Configuration reloaded: %s", strings.Join(applied, ", "))
+	}
+	if len(restart) > 0 {
+		log.Printf("Configuration reload: %s changed; restart to apply", strings.Join(restart, ", "))
+	}
+}
+
+// configChange is one setting, named by its environment variable, that differs between two configurations
+type configChange struct {
+	name     string
+	from, to string
+}
+
+// diffConfig lists the settings that differ between from and to, in declaration order
+func diffConfig(from, to Config) []configChange {
+	return diffSettings(reflect.ValueOf(from), reflect.ValueOf(to))
+}
+
+func diffSettings(from, to reflect.Value) []configChange {
+	var changes []configChange
+	for i := 0; i < from.NumField(); i++ {
+		field := from.Type().Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			changes = append(changes, diffSettings(from.Field(i), to.Field(i))...)
+			continue
+		}
+		a, b := from.Field(i).Interface(), to.Field(i).Interface()
+		if !reflect.DeepEqual(a, b) {
+			changes = append(changes, configChange{name: field.Tag.Get("env"), from: fmt.Sprint(a), to: fmt.Sprint(b)})
+		}
+	}
+	return changes
+}
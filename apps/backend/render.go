@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// jsonAPIContentType is the media type defined by the JSON:API specification (https://jsonapi.org)
+// Clients that send it in the Accept header get resources shaped as {data: {type, id, attributes}}
+const jsonAPIContentType = "application/vnd.api+json"
+
+// acceptsMediaType reports whether the Accept header lists the given media type
+func acceptsMediaType(r *http.Request, mediaType string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		parsed, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && parsed == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// wantsJSONAPI reports whether the client asked for JSON:API formatted responses
+func wantsJSONAPI(r *http.Request) bool {
+	return acceptsMediaType(r, jsonAPIContentType)
+}
+
+// writeJSON sends v as the response body with the given status code
+// The representation is chosen from the Accept header (plain JSON or JSON:API)
+// and the API version (v2 wraps the payload in a {data, meta} envelope and adds
+// links to users and feature flags)
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	switch {
+	case wantsJSONAPI(r):
+		doc := toJSONAPIDocument(r, v)
+		if apiVersion(r) >= 2 {
+			doc.addMeta("requestId", requestIDFrom(r.Context()))
+		}
+		writeDocument(w, status, jsonAPIContentType, doc)
+	case apiVersion(r) >= 2:
+		writeRaw(w, r, status, envelope{
+			Data: withLinks(r, v),
+			Meta: envelopeMeta{RequestID: requestIDFrom(r.Context())},
+		})
+	default:
+		writeRaw(w, r, status, v)
+	}
+}
+
+// writeRaw sends v as plain JSON exactly as given, without any envelope
+func writeRaw(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	writeDocument(w, status, "application/json", v)
+}
+
+// writeDocument encodes body as JSON with the given Content-Type
+func writeDocument(w http.ResponseWriter, status int, contentType string, body interface{}) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// writeError sends an error response with the given status code
+// Plain v1 clients get a text message (same as http.Error), v2 clients get
+// an {error, meta} envelope, and JSON:API clients get a standard {errors: [...]} document
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if status >= http.StatusInternalServerError {
+		reportServerError(r, status, message)
+	}
+
+	switch {
+	case wantsJSONAPI(r):
+		writeDocument(w, status, jsonAPIContentType, jsonAPIErrorDocument{
+			Errors: []jsonAPIError{{
+				Status: strconv.Itoa(status),
+				Title:  http.StatusText(status),
+				Detail: message,
+			}},
+		})
+	case apiVersion(r) >= 2:
+		var body envelopeError
+		body.Error.Status = status
+		body.Error.Message = message
+		body.Meta.RequestID = requestIDFrom(r.Context())
+		writeDocument(w, status, "application/json", body)
+	default:
+		http.Error(w, message, status)
+	}
+}
+
+// findByID loads the T named by the {id} path value; what names it in the 404, e.g. "Job"
+// It writes a 404 (or 500) response and returns false when there is none
+func findByID[T any](w http.ResponseWriter, r *http.Request, db *gorm.DB, what string) (T, bool) {
+	record, err := getByID[T](r.Context(), db, r.PathValue("id"))
+	return record, found(w, r, err, what)
+}
+
+// findBy loads the first T matching conds, e.g. byKey(r.PathValue("key")), like findByID
+func findBy[T any](w http.ResponseWriter, r *http.Request, db *gorm.DB, what string, conds ...interface{}) (T, bool) {
+	record, err := getWhere[T](r.Context(), db, conds...)
+	return record, found(w, r, err, what)
+}
+
+// found reports whether a lookup of what succeeded, writing the 404 or 500 response when it didn't
+func found(w http.ResponseWriter, r *http.Request, err error, what string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errNotFound):
+		writeError(w, r, http.StatusNotFound, what+" not found")
+	default:
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+	}
+	return false
+}
+
+// decodeJSON parses a JSON request body into v
+// JSON:API request documents ({data: {type, attributes}}) are unwrapped
+// so handlers can decode into the same structs either way
+func decodeJSON(r *http.Request, v interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != jsonAPIContentType {
+		return json.NewDecoder(r.Body).Decode(v)
+	}
+
+	var doc struct {
+		Data *struct {
+			Attributes json.RawMessage `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+		return err
+	}
+	if doc.Data == nil || doc.Data.Attributes == nil {
+		return fmt.Errorf("JSON:API document is missing data.attributes")
+	}
+	return json.Unmarshal(doc.Data.Attributes, v)
+}
+
+// jsonAPIResource is a single resource object in a JSON:API document
+type jsonAPIResource struct {
+	Type          string                 `json:"type"`
+	ID            string                 `json:"id"`
+	Attributes    map[string]interface{} `json:"attributes"`
+	Relationships map[string]interface{} `json:"relationships,omitempty"`
+	Links         map[string]interface{} `json:"links,omitempty"`
+}
+
+// jsonAPIDocument is the top-level JSON:API response object
+type jsonAPIDocument struct {
+	Data  interface{}            `json:"data,omitempty"`
+	Meta  map[string]interface{} `json:"meta,omitempty"`
+	Links *envelopeLinks         `json:"links,omitempty"`
+}
+
+// addMeta sets a meta member, creating the meta object if needed
+func (d *jsonAPIDocument) addMeta(key string, value interface{}) {
+	if d.Meta == nil {
+		d.Meta = map[string]interface{}{}
+	}
+	d.Meta[key] = value
+}
+
+// jsonAPIError is a single JSON:API error object
+type jsonAPIError struct {
+	Status string              `json:"status"`
+	Title  string              `json:"title"`
+	Detail string              `json:"detail,omitempty"`
+	Source *jsonAPIErrorSource `json:"source,omitempty"`
+}
+
+// jsonAPIErrorSource points at the part of the request document that caused an error
+type jsonAPIErrorSource struct {
+	Pointer string `json:"pointer"`
+}
+
+// jsonAPIErrorDocument is the top-level JSON:API error response
+type jsonAPIErrorDocument struct {
+	Errors []jsonAPIError `json:"errors"`
+}
+
+// toJSONAPIDocument converts a response value into a JSON:API document
+// Known resources become data objects; other payloads (messages, summaries) become meta
+func toJSONAPIDocument(r *http.Request, v interface{}) jsonAPIDocument {
+	prefix := apiPrefix(r)
+	switch value := v.(type) {
+	case models.User:
+		return jsonAPIDocument{Data: toJSONAPIResource("users", strconv.FormatUint(uint64(value.ID), 10), value, userLinks(prefix, value))}
+	case []models.User:
+		data := make([]jsonAPIResource, len(value))
+		for i, user := range value {
+			data[i] = toJSONAPIResource("users", strconv.FormatUint(uint64(user.ID), 10), user, userLinks(prefix, user))
+		}
+		return jsonAPIDocument{Data: data}
+	case models.FeatureFlag:
+		return jsonAPIDocument{Data: toJSONAPIResource("feature-flags", strconv.FormatUint(uint64(value.ID), 10), value, flagLinks(prefix, value))}
+	case []models.FeatureFlag:
+		data := make([]jsonAPIResource, len(value))
+		for i, flag := range value {
+			data[i] = toJSONAPIResource("feature-flags", strconv.FormatUint(uint64(flag.ID), 10), flag, flagLinks(prefix, flag))
+		}
+		return jsonAPIDocument{Data: data}
+	case models.HealthResponse:
+		// Zones are identified by name
+		data := make([]jsonAPIResource, len(value.Zones))
+		for i, zone := range value.Zones {
+			data[i] = toJSONAPIResource("zones", zone.Name, zone, nil)
+		}
+		return jsonAPIDocument{Data: data, Meta: map[string]interface{}{"status": value.Status}}
+	default:
+		return jsonAPIDocument{Meta: toAttributes(v)}
+	}
+}
+
+// toJSONAPIResource builds a resource object whose attributes are every JSON field except the id
+func toJSONAPIResource(resourceType, id string, v interface{}, links resourceLinks) jsonAPIResource {
+	attributes := toAttributes(v)
+	delete(attributes, "id")
+	resource := jsonAPIResource{Type: resourceType, ID: id, Attributes: attributes}
+	if links != nil {
+		resource.Links = toJSONAPILinks(links)
+	}
+	return resource
+}
+
+// toAttributes converts a struct into a map using its JSON field names
+func toAttributes(v interface{}) map[string]interface{} {
+	attributes := map[string]interface{}{}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return attributes
+	}
+	json.Unmarshal(data, &attributes)
+	return attributes
+}
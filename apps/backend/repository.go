@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"github.com/nextjs-microfrontend/backend/internal/tenant"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Repositories are the only code that knows where users, feature flags, and zone
+// statuses are stored. The services in service.go work against these interfaces,
+// so the same logic serves Postgres (below) or the in-memory store of --mock (mock.go)
+//
+// Users and flags belong to a project (see tenancy.go): every query below is scoped to the
+// project of its context with tenant.Scope, and every row created gets that project's ID
+
+// errNotFound is returned by repositories when no record matches; handlers answer 404
+var errNotFound = errors.New("record not found")
+
+// rowCursor reads the rows of an export one at a time (see streamNDJSON and streamCSV)
+type rowCursor[T any] interface {
+	Next() bool
+	Scan(item *T) error
+	Err() error
+	Close() error
+}
+
+// UserRepository stores users
+type UserRepository interface {
+	// List returns the page of users matched by query
+	List(ctx context.Context, query listQuery) ([]models.User, error)
+	// Count returns how many users match query, ignoring its page
+	Count(ctx context.Context, query listQuery) (int64, error)
+	// Export opens a cursor over every user matched by query
+	Export(ctx context.Context, query listQuery) (rowCursor[models.User], error)
+	Get(ctx context.Context, id string) (models.User, error)
+	Create(ctx context.Context, user *models.User) error
+	// CreateMany creates all users or none of them
+	CreateMany(ctx context.Context, users []models.User) error
+	Delete(ctx context.Context, id string) error
+	// Seed adds the users whose emails don't exist yet and returns how many it added
+	Seed(ctx context.Context, users []models.User) (int, error)
+	// Upsert adds the users whose emails are new and updates the others to match
+	Upsert(ctx context.Context, users []models.User) (models.SeedCounts, error)
+	// Stats counts users and returns the most recently created ones
+	Stats(ctx context.Context) (models.UserStats, error)
+}
+
+// FlagRepository stores feature flags
+type FlagRepository interface {
+	List(ctx context.Context, query listQuery) ([]models.FeatureFlag, error)
+	Count(ctx context.Context, query listQuery) (int64, error)
+	Export(ctx context.Context, query listQuery) (rowCursor[models.FeatureFlag], error)
+	// All returns every flag ordered by key
+	All(ctx context.Context) ([]models.FeatureFlag, error)
+	Get(ctx context.Context, key string) (models.FeatureFlag, error)
+	Create(ctx context.Context, flag *models.FeatureFlag) error
+	// CreateMany creates all flags or none of them
+	CreateMany(ctx context.Context, flags []models.FeatureFlag) error
+	// Update changes the fields set in req and returns the flag as stored afterwards
+	Update(ctx context.Context, key string, req models.UpdateFeatureFlagRequest) (models.FeatureFlag, error)
+	Delete(ctx context.Context, key string) error
+	// Upsert adds the flags whose keys are new and updates the others to match;
+	// it also returns the keys it created or updated, with "created" or "updated"
+	Upsert(ctx context.Context, flags []models.FeatureFlag) (models.SeedCounts, map[string]string, error)
+	// Sync makes the project's flags match flags, creating and updating them in one transaction
+	// (and, with prune, deleting the ones flags doesn't have), and returns the changes; on a dry
+	// run it only works them out
+	Sync(ctx context.Context, flags []models.CreateFeatureFlagRequest, dryRun, prune bool) (bundlePlan[models.CreateFeatureFlagRequest], error)
+}
+
+// ZoneRepository reports zone health
+type ZoneRepository interface {
+	// Statuses returns the latest status of every zone; unreachable zones are unhealthy, not errors
+	Statuses() []models.ZoneStatus
+}
+
+// zoneStatusFunc adapts a function to ZoneRepository
+type zoneStatusFunc func() []models.ZoneStatus
+
+func (f zoneStatusFunc) Statuses() []models.ZoneStatus { return f() }
+
+// gormUserRepository stores users in Postgres
+type gormUserRepository struct {
+	db   *gorm.DB // Writes and queries built from ?filter=
+	stmt *gorm.DB // Fixed-shape lookups, with cached prepared statements (see stmtDB)
+}
+
+func newGormUserRepository(db, stmt *gorm.DB) *gormUserRepository {
+	return &gormUserRepository{db: db, stmt: stmt}
+}
+
+func (r *gormUserRepository) List(ctx context.Context, query listQuery) ([]models.User, error) {
+	var users []models.User
+	// GORM will execute: SELECT * FROM users WHERE project_id = ? ORDER BY id LIMIT ? OFFSET ?
+	err := query.apply(r.db.WithContext(ctx).Scopes(tenant.Scope(ctx)), "id").Find(&users).Error
+	return users, err
+}
+
+func (r *gormUserRepository) Count(ctx context.Context, query listQuery) (int64, error) {
+	var total int64
+	err := query.filter(r.db.WithContext(ctx).Model(&models.User{}).Scopes(tenant.Scope(ctx))).Count(&total).Error
+	return total, err
+}
+
+func (r *gormUserRepository) Export(ctx context.Context, query listQuery) (rowCursor[models.User], error) {
+	return openGormCursor[models.User](query.stream(r.db.WithContext(ctx).Model(&models.User{}).Scopes(tenant.Scope(ctx)), "id"))
+}
+
+func (r *gormUserRepository) Get(ctx context.Context, id string) (models.User, error) {
+	var user models.User
+	// GORM will execute: SELECT * FROM users WHERE project_id = ? AND id = ?
+	err := r.stmt.WithContext(ctx).Scopes(tenant.Scope(ctx)).First(&user, id).Error
+	return user, notFound(err)
+}
+
+func (r *gormUserRepository) Create(ctx context.Context, user *models.User) error {
+	// GORM will execute: INSERT INTO users (project_id, email, name, created_at, updated_at) VALUES (...)
+	user.ProjectID = tenant.FromContext(ctx).ID
+	return r.db.WithContext(ctx).Create(user).Error
+}
+
+func (r *gormUserRepository) CreateMany(ctx context.Context, users []models.User) error {
+	// GORM will execute one INSERT INTO users (...) VALUES (...), (...) per DB_BATCH_SIZE rows
+	for i := range users {
+		users[i].ProjectID = tenant.FromContext(ctx).ID
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return tx.Create(&users).Error
+	})
+}
+
+func (r *gormUserRepository) Delete(ctx context.Context, id string) error {
+	// GORM will execute: DELETE FROM users WHERE project_id = ? AND id = ?
+	result := r.db.WithContext(ctx).Scopes(tenant.Scope(ctx)).Delete(&models.User{}, id)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return errNotFound
+	}
+	return result.Error
+}
+
+func (r *gormUserRepository) Seed(ctx context.Context, users []models.User) (int, error) {
+	created, _, err := seedDatabase(ctx, r.db, users, nil)
+	return created, err
+}
+
+func (r *gormUserRepository) Upsert(ctx context.Context, users []models.User) (models.SeedCounts, error) {
+	var counts models.SeedCounts
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		counts, err = upsertUsers(tx, users)
+		return err
+	})
+	return counts, err
+}
+
+func (r *gormUserRepository) Stats(ctx context.Context) (models.UserStats, error) {
+	var stats models.UserStats
+
+	if err := r.stmt.WithContext(ctx).Model(&models.User{}).Scopes(tenant.Scope(ctx)).Count(&stats.Total).Error; err != nil {
+		return stats, err
+	}
+	weekAgo := time.Now().AddDate(0, 0, -7)
+	if err := r.stmt.WithContext(ctx).Model(&models.User{}).Scopes(tenant.Scope(ctx)).Where("created_at >= ?", weekAgo).Count(&stats.CreatedLast7d).Error; err != nil {
+		return stats, err
+	}
+	if err := r.stmt.WithContext(ctx).Scopes(tenant.Scope(ctx)).Order("created_at DESC").Limit(5).Find(&stats.Recent).Error; err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// gormFlagRepository stores feature flags in Postgres
+type gormFlagRepository struct {
+	db   *gorm.DB
+	stmt *gorm.DB
+}
+
+func newGormFlagRepository(db, stmt *gorm.DB) *gormFlagRepository {
+	return &gormFlagRepository{db: db, stmt: stmt}
+}
+
+func (r *gormFlagRepository) List(ctx context.Context, query listQuery) ([]models.FeatureFlag, error) {
+	var flags []models.FeatureFlag
+	err := query.apply(r.db.WithContext(ctx).Scopes(tenant.Scope(ctx)), "id").Find(&flags).Error
+	return flags, err
+}
+
+func (r *gormFlagRepository) Count(ctx context.Context, query listQuery) (int64, error) {
+	var total int64
+	err := query.filter(r.db.WithContext(ctx).Model(&models.FeatureFlag{}).Scopes(tenant.Scope(ctx))).Count(&total).Error
+	return total, err
+}
+
+func (r *gormFlagRepository) Export(ctx context.Context, query listQuery) (rowCursor[models.FeatureFlag], error) {
+	return openGormCursor[models.FeatureFlag](query.stream(r.db.WithContext(ctx).Model(&models.FeatureFlag{}).Scopes(tenant.Scope(ctx)), "id"))
+}
+
+// byKey matches the flag (or navigation item) with key; "key" is a reserved word in MySQL, and GORM quotes a clause's column
+func byKey(key string) clause.Eq {
+	return clause.Eq{Column: "key", Value: key}
+}
+
+func (r *gormFlagRepository) All(ctx context.Context) ([]models.FeatureFlag, error) {
+	var flags []models.FeatureFlag
+	err := r.stmt.WithContext(ctx).Scopes(tenant.Scope(ctx)).Order(clause.OrderByColumn{Column: clause.Column{Name: "key"}}).Find(&flags).Error
+	return flags, err
+}
+
+func (r *gormFlagRepository) Get(ctx context.Context, key string) (models.FeatureFlag, error) {
+	var flag models.FeatureFlag
+	err := r.stmt.WithContext(ctx).Scopes(tenant.Scope(ctx)).Where(byKey(key)).First(&flag).Error
+	return flag, notFound(err)
+}
+
+func (r *gormFlagRepository) Create(ctx context.Context, flag *models.FeatureFlag) error {
+	flag.ProjectID = tenant.FromContext(ctx).ID
+	return r.db.WithContext(ctx).Create(flag).Error
+}
+
+func (r *gormFlagRepository) CreateMany(ctx context.Context, flags []models.FeatureFlag) error {
+	for i := range flags {
+		flags[i].ProjectID = tenant.FromContext(ctx).ID
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return tx.Create(&flags).Error
+	})
+}
+
+func (r *gormFlagRepository) Update(ctx context.Context, key string, req models.UpdateFeatureFlagRequest) (models.FeatureFlag, error) {
+	// Only update the fields that were provided
+	// A map is used so that "enabled": false is not skipped as a zero value
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.Description != nil {
+		updates["description"] = *req.Description
+	}
+	if req.Enabled != nil {
+		updates["enabled"] = *req.Enabled
+	}
+
+	// Find, update, and reload in one transaction so the result is exactly this update
+	// (queries don't get an implicit transaction since SkipDefaultTransaction is on)
+	var flag models.FeatureFlag
+	err := r.stmt.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Scopes(tenant.Scope(ctx)).Where(byKey(key)).First(&flag).Error; err != nil {
+			return notFound(err)
+		}
+		if err := tx.Model(&flag).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Scopes(tenant.Scope(ctx)).Where(byKey(key)).First(&flag).Error
+	})
+	return flag, err
+}
+
+func (r *gormFlagRepository) Delete(ctx context.Context, key string) error {
+	result := r.db.WithContext(ctx).Scopes(tenant.Scope(ctx)).Where(byKey(key)).Delete(&models.FeatureFlag{})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return errNotFound
+	}
+	return result.Error
+}
+
+func (r *gormFlagRepository) Upsert(ctx context.Context, flags []models.FeatureFlag) (models.SeedCounts, map[string]string, error) {
+	var counts models.SeedCounts
+	var changed map[string]string
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		counts, changed, err = upsertFlags(tx, flags)
+		return err
+	})
+	return counts, changed, err
+}
+
+func (r *gormFlagRepository) Sync(ctx context.Context, flags []models.CreateFeatureFlagRequest, dryRun, prune bool) (bundlePlan[models.CreateFeatureFlagRequest], error) {
+	var plan bundlePlan[models.CreateFeatureFlagRequest]
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current []models.FeatureFlag
+		if err := tx.Scopes(tenant.Scope(ctx)).Order(quoteColumn(tx, "key")).Find(&current).Error; err != nil {
+			return err
+		}
+		plan = planFlags(current, flags, prune)
+		if dryRun {
+			return nil
+		}
+		return applyFlagPlan(tx, current, plan)
+	})
+	return plan, err
+}
+
+// notFound turns GORM's not-found error into errNotFound
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errNotFound
+	}
+	return err
+}
+
+// getByID returns the T whose primary key is id from db, or errNotFound (also when id isn't a number)
+// Records without a repository of their own, such as announcements and jobs, are looked up with it
+// and getWhere; db may be scoped first, e.g. to the request's project
+func getByID[T any](ctx context.Context, db *gorm.DB, id string) (T, error) {
+	var record T
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return record, errNotFound
+	}
+	err = db.WithContext(ctx).First(&record, n).Error
+	return record, notFound(err)
+}
+
+// getWhere returns the first T in db matching conds (as for Where), or errNotFound
+func getWhere[T any](ctx context.Context, db *gorm.DB, conds ...interface{}) (T, error) {
+	var record T
+	err := db.WithContext(ctx).Where(conds[0], conds[1:]...).First(&record).Error
+	return record, notFound(err)
+}
+
+// gormCursor reads rows from a database cursor, so exports hold one row in memory at a time
+type gormCursor[T any] struct {
+	query *gorm.DB
+	rows  *sql.Rows
+}
+
+// openGormCursor runs query and returns a cursor over its rows
+func openGormCursor[T any](query *gorm.DB) (rowCursor[T], error) {
+	rows, err := query.Rows()
+	if err != nil {
+		return nil, err
+	}
+	return &gormCursor[T]{query: query, rows: rows}, nil
+}
+
+func (c *gormCursor[T]) Next() bool         { return c.rows.Next() }
+func (c *gormCursor[T]) Scan(item *T) error { return c.query.ScanRows(c.rows, item) }
+func (c *gormCursor[T]) Err() error         { return c.rows.Err() }
+func (c *gormCursor[T]) Close() error       { return c.rows.Close() }
+
+// sliceCursor reads rows that are already in memory (mock mode)
+type sliceCursor[T any] struct {
+	items []T
+	next  int
+}
+
+func newSliceCursor[T any](items []T) rowCursor[T] {
+	return &sliceCursor[T]{items: items}
+}
+
+func (c *sliceCursor[T]) Next() bool {
+	c.next++
+	return c.next <= len(c.items)
+}
+
+func (c *sliceCursor[T]) Scan(item *T) error {
+	*item = c.items[c.next-1]
+	return nil
+}
+
+func (c *sliceCursor[T]) Err() error   { return nil }
+func (c *sliceCursor[T]) Close() error { return nil }
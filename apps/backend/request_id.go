@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// requestIDHeader carries a unique ID for each request
+// Clients (or the ingress) may send one; otherwise the backend generates it
+const requestIDHeader = "X-Request-ID"
+
+// requestIDKey is the context key under which the request ID is stored
+type requestIDKey struct{}
+
+// requestIDMiddleware assigns every request an ID, exposes it in the
+// X-Request-ID response header, and stores it in the request context
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = uuid.NewString()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestIDFrom returns the request ID stored in ctx, or "" if there is none
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Every history table has a retention setting, and a built-in cleanup schedule (see
+// schedule_tasks.go) deletes what is older, so none of them grows without bound. Most tables'
+// settings live with the component that writes them (USAGE_RETENTION_DAYS, ...); the zones'
+// deployment timeline and the audit trails have theirs under RETENTION_*. A cleanup can be a
+// dry run that only counts, and GET /api/retention reports what every cleanup would delete now
+
+// retentionTarget is what one cleanup target prunes, and when
+type retentionTarget struct {
+	name   string   // The cleanup task's target, and the schedule's name after "cleanup-"
+	tables []string // The tables it deletes from
+	days   int      // The retention setting; 0 keeps everything (uploads have none, see pruneUploads)
+	daily  bool     // Cleaned up daily rather than hourly
+	prune  func(ctx context.Context, dryRun bool) (int64, error)
+}
+
+// retentionTargets are the cleanup targets, in the order their schedules were first created;
+// email is only one when EMAIL_PROVIDER is set, and uploads when UPLOAD_S3_BUCKET is
+func (s *Server) retentionTargets() []retentionTarget {
+	targets := []retentionTarget{
+		{name: "usage", tables: []string{"api_usage"}, days: s.config.Usage.RetentionDays, prune: s.usage.prune},
+		{name: "webhooks", tables: []string{"webhook_deliveries"}, days: s.config.Webhooks.RetentionDays, prune: s.webhooks.prune},
+		{name: "jobs", tables: []string{"jobs"}, days: s.config.Jobs.RetentionDays, prune: s.jobs.prune},
+		{name: "analytics", tables: []string{"analytics_daily"}, days: s.config.Analytics.RetentionDays, prune: s.analytics.prune},
+	}
+	if s.mailer != nil {
+		targets = append(targets, retentionTarget{name: "email", tables: []string{"email_messages"}, days: s.config.Email.RetentionDays, prune: s.mailer.prune})
+	}
+	targets = append(targets,
+		retentionTarget{name: "schedule-runs", tables: []string{"schedule_runs"}, days: s.config.Scheduler.RunRetentionDays, daily: true, prune: s.scheduler.prune},
+		retentionTarget{name: "analytics-visitors", tables: []string{"analytics_visitors"}, days: s.config.Analytics.VisitorRetentionDays, prune: s.analytics.pruneVisitors},
+		retentionTarget{name: "health", tables: []string{"deployment_events"}, days: s.config.Retention.HealthDays, daily: true, prune: s.pruneHealth},
+		retentionTarget{name: "audit", tables: []string{"activity_events", "zone_route_changes"}, days: s.config.Retention.AuditDays, daily: true, prune: s.pruneAudit},
+	)
+	if s.uploads != nil {
+		targets = append(targets, retentionTarget{name: "uploads", tables: []string{"uploads"}, prune: s.pruneUploads})
+	}
+	return targets
+}
+
+// retentionTarget returns the cleanup target named name
+func (s *Server) retentionTarget(name string) (retentionTarget, bool) {
+	for _, target := range s.retentionTargets() {
+		if target.name == name {
+			return target, true
+		}
+	}
+	return retentionTarget{}, false
+}
+
+// purge deletes the rows of model that query matches and returns how many there were, or on a
+// dry run only counts them
+func purge(query *gorm.DB, model interface{}, dryRun bool) (int64, error) {
+	if dryRun {
+		var count int64
+		err := query.Model(model).Count(&count).Error
+		return count, err
+	}
+	result := query.Delete(model)
+	return result.RowsAffected, result.Error
+}
+
+// pruneHealth deletes deployment events older than RETENTION_HEALTH_DAYS, with the health
+// checks recorded on them; the cleanup-health schedule
+func (s *Server) pruneHealth(ctx context.Context, dryRun bool) (int64, error) {
+	if s.config.Retention.HealthDays <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().AddDate(0, 0, -s.config.Retention.HealthDays)
+	return purge(s.db.WithContext(ctx).Where("created_at < ?", cutoff), &models.DeploymentEvent{}, dryRun)
+}
+
+// pruneAudit deletes activity events and routing changes older than RETENTION_AUDIT_DAYS; the
+// cleanup-audit schedule. The latest routing change is kept, since its ID is the routing
+// manifest's version
+func (s *Server) pruneAudit(ctx context.Context, dryRun bool) (int64, error) {
+	if s.config.Retention.AuditDays <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().AddDate(0, 0, -s.config.Retention.AuditDays)
+	activity, err := purge(s.db.WithContext(ctx).Where("created_at < ?", cutoff), &models.ActivityEvent{}, dryRun)
+	if err != nil {
+		return 0, err
+	}
+
+	var latest models.ZoneRouteChange
+	if err := s.db.WithContext(ctx).Select("id").Order("id DESC").Limit(1).Find(&latest).Error; err != nil {
+		return activity, err
+	}
+	routes, err := purge(s.db.WithContext(ctx).Where("created_at < ? AND id < ?", cutoff, latest.ID), &models.ZoneRouteChange{}, dryRun)
+	return activity + routes, err
+}
+
+// retentionReportHandler responds to GET /api/retention
+// Every cleanup target with its tables, retention setting, and how many rows its cleanup would
+// delete now (a dry run of each), so a new setting can be checked before the schedule runs
+func (s *Server) retentionReportHandler(w http.ResponseWriter, r *http.Request) {
+	policies := []models.RetentionPolicy{}
+	for _, target := range s.retentionTargets() {
+		due, err := target.prune(r.Context(), true)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to count %s rows: %v", target.name, err))
+			return
+		}
+		policy := models.RetentionPolicy{
+			Target: target.name, Schedule: "cleanup-" + target.name, Tables: target.tables, RetentionDays: target.days, Due: due,
+		}
+		if target.days > 0 {
+			cutoff := time.Now().UTC().AddDate(0, 0, -target.days)
+			policy.Cutoff = &cutoff
+		}
+		policies = append(policies, policy)
+	}
+	writeJSON(w, r, http.StatusOK, policies)
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// The routing table says which zone owns which paths. The root app builds its rewrites from
+// GET /api/routing-manifest instead of hard-coding them, and every change is recorded in
+// zone_route_changes with who made it, so path ownership can be looked up and audited
+
+// zoneRoutePattern is the allowed format for route paths: "/", an exact path such as
+// "/about", or a prefix ending in "/*" such as "/admin/*" ("/*" is everything)
+var zoneRoutePattern = regexp.MustCompile(`^((/[A-Za-z0-9._~-]+)+(/\*)?|/\*?)$`)
+
+// rewriteSource turns a route path into a Next.js rewrite source: "/admin/*" becomes
+// "/admin/:path*", which also matches "/admin" itself
+func rewriteSource(path string) string {
+	if prefix, ok := strings.CutSuffix(path, "/*"); ok {
+		return prefix + "/:path*"
+	}
+	return path
+}
+
+// zoneOrigin is the scheme and host of a zone's URL; the path is dropped, since a rewrite keeps
+// the full request path and a zone with a base path (zone-admin's /admin) expects it there
+func zoneOrigin(zoneURL string) string {
+	u, err := url.Parse(zoneURL)
+	if err != nil || u.Host == "" {
+		return strings.TrimSuffix(zoneURL, "/")
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// compareRoutes orders routes most specific first: longer prefixes before shorter ones,
+// and an exact path before the prefix of the same path
+func compareRoutes(a, b models.ZoneRoute) int {
+	aPrefix, aWildcard := strings.CutSuffix(a.Path, "/*")
+	bPrefix, bWildcard := strings.CutSuffix(b.Path, "/*")
+	if len(aPrefix) != len(bPrefix) {
+		return len(bPrefix) - len(aPrefix)
+	}
+	if aWildcard != bWildcard {
+		if aWildcard {
+			return 1
+		}
+		return -1
+	}
+	return strings.Compare(a.Path, b.Path)
+}
+
+// zoneRouteChangeFilterFields are the change log fields ?filter= and ?orderby= accept
+var zoneRouteChangeFilterFields = filterFields{
+	"id":        {Column: "id", Kind: filterNumber},
+	"routeId":   {Column: "route_id", Kind: filterNumber},
+	"action":    {Column: "action", Kind: filterString},
+	"path":      {Column: "path", Kind: filterString},
+	"zone":      {Column: "zone", Kind: filterString},
+	"changedBy": {Column: "changed_by", Kind: filterString},
+	"createdAt": {Column: "created_at", Kind: filterTime},
+}
+
+// recordRouteChange adds a change for route to the change log in tx
+func recordRouteChange(tx *gorm.DB, r *http.Request, route models.ZoneRoute, action, previousZone string) error {
+	change := models.ZoneRouteChange{RouteID: route.ID, Action: action, Path: route.Path, Zone: route.Zone, PreviousZone: previousZone, ChangedBy: usageConsumer(r)}
+	if action == "deleted" {
+		change.Zone = ""
+	}
+	return tx.Create(&change).Error
+}
+
+// checkZoneRoute returns a field error if route names a zone that doesn't exist
+func (s *Server) checkZoneRoute(route models.ZoneRoute) []models.FieldError {
+	if _, ok := s.findZone(route.Zone); !ok {
+		return []models.FieldError{{Field: "zone", Message: "must be a zone (" + s.zoneNames() + ")"}}
+	}
+	return nil
+}
+
+// pathTaken writes a 409 (or 500) response and returns true if another route has path
+func (s *Server) pathTaken(w http.ResponseWriter, r *http.Request, path string, id uint) bool {
+	var existing int64
+	err := s.db.WithContext(r.Context()).Model(&models.ZoneRoute{}).Where("path = ? AND id <> ?", path, id).Count(&existing).Error
+	switch {
+	case err != nil:
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+	case existing > 0:
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("%s is already routed", path))
+	default:
+		return false
+	}
+	return true
+}
+
+// getRoutingManifestHandler responds to GET /api/routing-manifest
+// Every route as a rewrite to its zone's URL, most specific first
+func (s *Server) getRoutingManifestHandler(w http.ResponseWriter, r *http.Request) {
+	var routes []models.ZoneRoute
+	if err := s.db.WithContext(r.Context()).Find(&routes).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	var latest models.ZoneRouteChange
+	if err := s.db.WithContext(r.Context()).Order("id DESC").Limit(1).Find(&latest).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+
+	slices.SortFunc(routes, compareRoutes)
+	manifest := models.RoutingManifest{Version: latest.ID, Routes: make([]models.RoutingManifestRoute, 0, len(routes))}
+	for _, route := range routes {
+		zone, ok := s.findZone(route.Zone)
+		if !ok {
+			continue // A zone that was removed from the configuration
+		}
+		source := rewriteSource(route.Path)
+		manifest.Routes = append(manifest.Routes, models.RoutingManifestRoute{
+			Source:      source,
+			Destination: zoneOrigin(zone.URL) + source,
+			Zone:        zone.Name,
+		})
+	}
+	writeJSON(w, r, http.StatusOK, manifest)
+}
+
+// listZoneRoutesHandler responds to GET /api/zone-routes
+func (s *Server) listZoneRoutesHandler(w http.ResponseWriter, r *http.Request) {
+	var routes []models.ZoneRoute
+	if err := s.db.WithContext(r.Context()).Order("path").Find(&routes).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, routes)
+}
+
+// createZoneRouteHandler responds to POST /api/zone-routes
+func (s *Server) createZoneRouteHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateZoneRouteRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	route := models.ZoneRoute{Path: req.Path, Zone: req.Zone, Description: req.Description}
+	if fieldErrors := s.checkZoneRoute(route); len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+	if s.pathTaken(w, r, route.Path, 0) {
+		return
+	}
+
+	err := s.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&route).Error; err != nil {
+			return err
+		}
+		return recordRouteChange(tx, r, route, "created", "")
+	})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to create zone route: %v", err))
+		return
+	}
+	log.Printf("Zone route %s added: served by %s", route.Path, route.Zone)
+
+	w.Header().Set("Location", fmt.Sprintf("%s/api/zone-routes/%d", s.config.Server.BasePath, route.ID))
+	writeJSON(w, r, http.StatusCreated, route)
+}
+
+// getZoneRouteHandler responds to GET /api/zone-routes/{id}
+func (s *Server) getZoneRouteHandler(w http.ResponseWriter, r *http.Request) {
+	if route, ok := findByID[models.ZoneRoute](w, r, s.db, "Zone route"); ok {
+		writeJSON(w, r, http.StatusOK, route)
+	}
+}
+
+// updateZoneRouteHandler responds to PATCH /api/zone-routes/{id}
+func (s *Server) updateZoneRouteHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateZoneRouteRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	route, ok := findByID[models.ZoneRoute](w, r, s.db, "Zone route")
+	if !ok {
+		return
+	}
+
+	previousZone := route.Zone
+	if req.Path != nil {
+		route.Path = *req.Path
+	}
+	if req.Zone != nil {
+		route.Zone = *req.Zone
+	}
+	if req.Description != nil {
+		route.Description = *req.Description
+	}
+	if fieldErrors := s.checkZoneRoute(route); len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+	if s.pathTaken(w, r, route.Path, route.ID) {
+		return
+	}
+
+	err := s.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&route).Error; err != nil {
+			return err
+		}
+		return recordRouteChange(tx, r, route, "updated", previousZone)
+	})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to update zone route: %v", err))
+		return
+	}
+	if previousZone != route.Zone {
+		log.Printf("Zone route %s moved from %s to %s", route.Path, previousZone, route.Zone)
+	}
+	writeJSON(w, r, http.StatusOK, route)
+}
+
+// deleteZoneRouteHandler responds to DELETE /api/zone-routes/{id}
+// Its change log stays
+func (s *Server) deleteZoneRouteHandler(w http.ResponseWriter, r *http.Request) {
+	route, ok := findByID[models.ZoneRoute](w, r, s.db, "Zone route")
+	if !ok {
+		return
+	}
+	err := s.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&route).Error; err != nil {
+			return err
+		}
+		return recordRouteChange(tx, r, route, "deleted", route.Zone)
+	})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	log.Printf("Zone route %s removed", route.Path)
+	writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "Zone route deleted successfully"})
+}
+
+// getZoneRouteChangesHandler responds to GET /api/zone-routes/changes
+// The change log of every route, newest first (the latest 100 unless a page size is asked for),
+// narrowed with the shared ?filter= and ?orderby= parameters, e.g. ?filter=path eq "/admin/*"
+func (s *Server) getZoneRouteChangesHandler(w http.ResponseWriter, r *http.Request) {
+	listQuery, err := parseListQuery(r, zoneRouteChangeFilterFields)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid query: "+err.Error())
+		return
+	}
+	if r.URL.Query().Get("pageSize") == "" {
+		listQuery.page.PageSize = min(listQuery.page.PageSize, 100)
+	}
+
+	var changes []models.ZoneRouteChange
+	if err := listQuery.apply(s.db.WithContext(r.Context()).Model(&models.ZoneRouteChange{}), "id DESC").Find(&changes).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	setNextPageLink(w, r, listQuery.page, len(changes))
+	writeJSON(w, r, http.StatusOK, changes)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// GET /internal/config shows what a pod is actually running with: every setting's
+// effective value, and whether it came from its default, the --config file, or the
+// environment. Secrets are masked, so the output can be pasted into an issue
+
+// redactedValue replaces secrets that are set; empty ones stay empty, so it still shows whether they are
+const redactedValue = "[redacted]"
+
+// configSetting is one entry of GET /internal/config
+type configSetting struct {
+	Key        string `json:"key"` // YAML path, e.g. "server.port"
+	Env        string `json:"env"`
+	Value      any    `json:"value"`
+	Source     string `json:"source"` // "default", "file", or "env"
+	Reloadable bool   `json:"reloadable,omitempty"`
+	Secret     bool   `json:"secret,omitempty"`
+}
+
+// runtimeConfigResponse is the body of GET /internal/config
+type runtimeConfigResponse struct {
+	File     string          `json:"file,omitempty"` // The --config file, if any
+	Settings []configSetting `json:"settings"`
+}
+
+// effectiveConfig is the server's configuration with the reloadable settings as last applied
+// by a reload, and the log level as it is now (PUT /internal/log-level may have changed it)
+func (s *Server) effectiveConfig() Config {
+	cfg := s.config
+	if origins := s.live.corsOrigins.Load(); origins != nil {
+		cfg.Server.CORSAllowedOrigins = *origins
+	}
+	cfg.Zones.HealthCheckTimeout = s.live.healthCheckTimeout()
+	cfg.Zones.StatusMaxAge = s.live.zoneStatusMaxAge()
+	limit, burst := s.live.rateLimit.rate()
+	cfg.API.RateLimitRPS, cfg.API.RateLimitBurst = float64(limit), burst
+	cfg.Logging.Level = logLevelNames[s.live.logLevel.get()]
+	return cfg
+}
+
+// configFileKeys returns the set YAML paths ("server.port") in the --config file
+// A file that no longer reads or parses has no keys; reloads would reject it too
+func configFileKeys(path string) map[string]bool {
+	keys := map[string]bool{}
+	if path == "" {
+		return keys
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return keys
+	}
+	var doc map[string]any
+	if yaml.Unmarshal(data, &doc) != nil {
+		return keys
+	}
+
+	var walk func(prefix string, node map[string]any)
+	walk = func(prefix string, node map[string]any) {
+		for key, value := range node {
+			if child, ok := value.(map[string]any); ok {
+				walk(prefix+key+".", child)
+			} else {
+				keys[prefix+key] = true
+			}
+		}
+	}
+	walk("", doc)
+	return keys
+}
+
+// configSettings lists v's settings in declaration order, with their sources
+func configSettings(v reflect.Value, prefix string, fileKeys map[string]bool) []configSetting {
+	var settings []configSetting
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if field.Type.Kind() == reflect.Struct {
+			settings = append(settings, configSettings(value, prefix+name+".", fileKeys)...)
+			continue
+		}
+
+		setting := configSetting{
+			Key:        prefix + name,
+			Env:        field.Tag.Get("env"),
+			Value:      value.Interface(),
+			Source:     "default",
+			Reloadable: reloadableSettings[field.Tag.Get("env")],
+			Secret:     field.Tag.Get("secret") == "true",
+		}
+		switch {
+		case os.Getenv(setting.Env) != "":
+			setting.Source = "env"
+		case fileKeys[setting.Key]:
+			setting.Source = "file"
+		}
+		switch {
+		case setting.Secret && !value.IsZero():
+			setting.Value = redactedValue
+		case field.Type == durationType:
+			setting.Value = fmt.Sprint(value.Interface()) // "5s" rather than nanoseconds
+		}
+		settings = append(settings, setting)
+	}
+	return settings
+}
+
+// runtimeConfigHandler responds to GET /internal/config
+func (s *Server) runtimeConfigHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, runtimeConfigResponse{
+		File:     s.configPath,
+		Settings: configSettings(reflect.ValueOf(s.effectiveConfig()), "", configFileKeys(s.configPath)),
+	})
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+)
+
+// The tasks schedules can run (see schedules.go), and the schedules the backend ships with
+
+// cleanupParams are the params of the cleanup task
+type cleanupParams struct {
+	Target string `json:"target" validate:"required,oneof=usage webhooks email jobs schedule-runs analytics analytics-visitors health audit uploads"`
+	DryRun bool   `json:"dryRun"` // Only count the rows that would be deleted
+}
+
+// flagSetParams are the params of the flag.set task
+type flagSetParams struct {
+	Key     string `json:"key" validate:"required,flagkey"`
+	Enabled *bool  `json:"enabled" validate:"required"`
+}
+
+// usageReportParams are the params of the usage.report task
+type usageReportParams struct {
+	Recipients []string `json:"recipients" validate:"required,min=1,max=20,dive,email"`
+	Days       int      `json:"days" validate:"omitempty,min=1,max=31"` // Default: 7
+}
+
+// usageReportRows is how many route and consumer pairs a usage report lists
+const usageReportRows = 20
+
+// scheduledTasks are the implementations of scheduleTaskNames
+func (s *Server) scheduledTasks() map[string]scheduledTask {
+	return map[string]scheduledTask{
+		"cleanup":      {params: func() interface{} { return &cleanupParams{} }, run: s.cleanupTask},
+		"flag.set":     {params: func() interface{} { return &flagSetParams{} }, run: s.flagSetTask},
+		"usage.report": {params: func() interface{} { return &usageReportParams{} }, run: s.usageReportTask},
+		"zones.check":  {run: s.zoneCheckTask},
+	}
+}
+
+// builtinSchedules are created on startup unless they exist (see scheduler.createBuiltins);
+// they replace the hourly retention loops, so each cleanup can be rescheduled or run by hand
+// The busy tables are cleaned up hourly, so no run has too much to delete; the others daily
+func (s *Server) builtinSchedules() []models.Schedule {
+	var schedules []models.Schedule
+	for _, target := range s.retentionTargets() {
+		cron := "@hourly"
+		if target.daily {
+			cron = "@daily"
+		}
+		schedules = append(schedules, models.Schedule{
+			Name: "cleanup-" + target.name, Cron: cron, Task: "cleanup", Params: models.ScheduleParams{"target": target.name},
+		})
+	}
+	return schedules
+}
+
+// cleanupTask deletes rows past their retention setting from one table, or on a dry run
+// only reports how many there are
+func (s *Server) cleanupTask(ctx context.Context, params interface{}) (string, error) {
+	p := params.(*cleanupParams)
+	target, ok := s.retentionTarget(p.Target)
+	if !ok {
+		// Only email and uploads can be missing
+		if p.Target == "uploads" {
+			return "", errors.New("uploads are off (UPLOAD_S3_BUCKET is empty)")
+		}
+		return "", errors.New("email is off (EMAIL_PROVIDER is empty)")
+	}
+
+	deleted, err := target.prune(ctx, p.DryRun)
+	if err != nil {
+		return "", fmt.Errorf("failed to prune %s: %w", target.name, err)
+	}
+	if p.DryRun {
+		return fmt.Sprintf("Would delete %d rows", deleted), nil
+	}
+	if deleted > 0 {
+		log.Printf("Pruned %d old %s rows", deleted, target.name)
+	}
+	return fmt.Sprintf("Deleted %d rows", deleted), nil
+}
+
+// flagSetTask turns a flag on or off, through the flag service like any other change
+func (s *Server) flagSetTask(ctx context.Context, params interface{}) (string, error) {
+	p := params.(*flagSetParams)
+	flag, err := s.flags.update(ctx, p.Key, models.UpdateFeatureFlagRequest{Enabled: p.Enabled})
+	if errors.Is(err, errNotFound) {
+		return "", fmt.Errorf("no feature flag named %s", p.Key)
+	}
+	if err != nil {
+		return "", err
+	}
+	state := "off"
+	if flag.Enabled {
+		state = "on"
+	}
+	log.Printf("Schedule turned feature flag %s %s", flag.Key, state)
+	return fmt.Sprintf("Turned %s %s", flag.Key, state), nil
+}
+
+// usageReportTask emails the busiest routes of the last few days to the recipients
+func (s *Server) usageReportTask(ctx context.Context, params interface{}) (string, error) {
+	p := params.(*usageReportParams)
+	if s.mailer == nil {
+		return "", errors.New("email is off (EMAIL_PROVIDER is empty)")
+	}
+	days := p.Days
+	if days == 0 {
+		days = 7
+	}
+	// The days before today, which are complete
+	to := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	from := to.AddDate(0, 0, 1-days)
+	report, err := s.usageReport(ctx, from, to, "", "", usageReportRows)
+	if err != nil {
+		return "", fmt.Errorf("failed to total usage: %w", err)
+	}
+
+	var body strings.Builder
+	table := tabwriter.NewWriter(&body, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "Route\tConsumer\tRequests\t4xx\t5xx")
+	for _, row := range report.Usage {
+		fmt.Fprintf(table, "%s\t%s\t%d\t%d\t%d\n", row.Route, row.Consumer, row.Requests, row.ClientErrors, row.ServerErrors)
+	}
+	table.Flush()
+	if len(report.Usage) == 0 {
+		body.WriteString("No requests were recorded.\n")
+	}
+
+	data := map[string]string{"title": "API usage", "period": report.From + " to " + report.To, "body": body.String()}
+	for _, to := range p.Recipients {
+		if _, err := s.mailer.enqueue(ctx, "report", to, data); err != nil {
+			return "", fmt.Errorf("failed to queue the report for %s: %w", to, err)
+		}
+	}
+	return fmt.Sprintf("Queued the report for %s to %s for %d recipients", report.From, report.To, len(p.Recipients)), nil
+}
+
+// zoneCheckTask checks every zone now; incidents go out as they do for any other check
+func (s *Server) zoneCheckTask(context.Context, interface{}) (string, error) {
+	s.zoneStatuses.refresh()
+	statuses := s.zoneStatuses.get()
+	summary := make([]string, len(statuses))
+	for i, zone := range statuses {
+		summary[i] = zone.Name + " " + zone.Status
+	}
+	return strings.Join(summary, ", "), nil
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+)
+
+// Schedules run tasks on cron expressions: flag changes at a set time, zone health checks,
+// the retention cleanups, and usage reports. They are stored in the schedules table, so they
+// can be changed through the API without a deploy. The leader (see leader.go) starts each
+// schedule when it is due as a schedule.run job (see jobs.go), which records the run in
+// schedule_runs; POST /api/schedules/{id}/run starts one by hand the same way.
+// A run that fails is not retried; the next one is
+
+const (
+	// scheduleJobKind is the job that runs one schedule run
+	scheduleJobKind = "schedule.run"
+
+	// schedulerMaxWait is the longest the leader waits before reading the schedules again,
+	// so changes made on other replicas are picked up
+	schedulerMaxWait = time.Minute
+)
+
+// scheduleNamePattern is the allowed format for schedule names (e.g. "nightly-usage-report")
+var scheduleNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// scheduleTaskNames are the tasks a schedule can run (see Server.scheduledTasks)
+var scheduleTaskNames = []string{"cleanup", "flag.set", "usage.report", "zones.check"}
+
+// cronParser reads the five standard fields and descriptors such as @hourly and @every 15m
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// scheduleRuns counts finished runs by task and result: "succeeded" or "failed"
+var scheduleRuns = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+	Name: "schedule_runs_total",
+	Help: "Scheduled task runs, by task and result (succeeded or failed).",
+}, []string{"task", "result"})
+
+// parseCron parses a cron expression in timezone (SCHEDULER_TIMEZONE), unless it starts with its own CRON_TZ=
+func parseCron(spec, timezone string) (cron.Schedule, error) {
+	if !strings.HasPrefix(spec, "CRON_TZ=") && !strings.HasPrefix(spec, "TZ=") {
+		spec = "CRON_TZ=" + timezone + " " + spec
+	}
+	return cronParser.Parse(spec)
+}
+
+// nextRun is when spec is next due in timezone after after, or nil if it never is (e.g. "0 0 30 2 *")
+func nextRun(spec, timezone string, after time.Time) *time.Time {
+	schedule, err := parseCron(spec, timezone)
+	if err != nil {
+		return nil
+	}
+	next := schedule.Next(after)
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+// scheduledTask is something a schedule can run
+type scheduledTask struct {
+	// params returns a new value of the task's params type to decode a schedule's params into;
+	// nil for a task that takes none
+	params func() interface{}
+	// run does the work and returns a line for the run history
+	run func(ctx context.Context, params interface{}) (string, error)
+}
+
+// decodeScheduleParams checks params against task and returns them as the task's params type
+func decodeScheduleParams(task scheduledTask, params models.ScheduleParams) (interface{}, []models.FieldError) {
+	if task.params == nil {
+		if len(params) > 0 {
+			return nil, []models.FieldError{{Field: "params", Message: "must be empty for this task"}}
+		}
+		return nil, nil
+	}
+	value := task.params()
+	data, err := json.Marshal(params)
+	if err == nil {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(value)
+	}
+	if err != nil {
+		return nil, []models.FieldError{{Field: "params", Message: "don't fit the task: " + err.Error()}}
+	}
+	fieldErrors := validateStruct(value)
+	for i := range fieldErrors {
+		fieldErrors[i].Field = "params." + fieldErrors[i].Field
+	}
+	if len(fieldErrors) > 0 {
+		return nil, fieldErrors
+	}
+	return value, nil
+}
+
+// scheduler starts due schedules and runs them
+type scheduler struct {
+	db    *gorm.DB
+	jobs  *jobQueue
+	tasks map[string]scheduledTask
+	cfg   SchedulerConfig
+
+	wake chan struct{} // Signalled when a schedule changes on this replica, so the leader needn't wait
+
+	logLevel *logLevel // The server's, for debug lines about started schedules
+}
+
+// scheduleRunJob is the payload of a schedule.run job
+type scheduleRunJob struct {
+	RunID uint `json:"runId"`
+}
+
+// newScheduler creates a scheduler for the schedules in database and registers the job that
+// runs them with jobs; tasks are the implementations of scheduleTaskNames
+func newScheduler(database *gorm.DB, jobs *jobQueue, tasks map[string]scheduledTask, cfg SchedulerConfig) *scheduler {
+	s := &scheduler{db: database, jobs: jobs, tasks: tasks, cfg: cfg, wake: make(chan struct{}, 1)}
+	jobs.register(scheduleJobKind, jobWorker{
+		run: s.execute,
+		// A task that fails is recorded in the run history and waits for the next run;
+		// the job itself only fails when the run can't be recorded
+		maxAttempts: 1,
+		concurrency: 2,
+	})
+	return s
+}
+
+// createBuiltins adds the schedules the backend ships with, except those that already exist
+// Once created they are the operator's: a changed cron expression or a disabled schedule stays so
+func (s *scheduler) createBuiltins(ctx context.Context, schedules []models.Schedule) error {
+	now := time.Now()
+	for _, schedule := range schedules {
+		schedule.Builtin, schedule.Enabled, schedule.NextRunAt = true, true, nextRun(schedule.Cron, s.cfg.Timezone, now)
+		// Replicas starting at the same time may both try; the unique name keeps one
+		err := s.db.WithContext(ctx).Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "name"}}, DoNothing: true}).Create(&schedule).Error
+		if err != nil {
+			return fmt.Errorf("failed to create schedule %s: %w", schedule.Name, err)
+		}
+	}
+	return nil
+}
+
+// changed tells the leader, if it is this replica, that a schedule was created or changed
+func (s *scheduler) changed() {
+	select {
+	case s.wake <- struct{}{}:
+	default: // A wake-up is already pending
+	}
+}
+
+// run starts schedules as they become due until ctx is cancelled; registered as a leader task
+func (s *scheduler) run(ctx context.Context) {
+	for {
+		timer := time.NewTimer(s.startDue(ctx))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		case <-s.wake:
+			timer.Stop()
+		}
+	}
+}
+
+// startDue starts every enabled schedule that is due, and returns how long to wait for the next
+// A schedule that was due several times while there was no leader runs once
+func (s *scheduler) startDue(ctx context.Context) time.Duration {
+	now := time.Now()
+	var due []models.Schedule
+	err := s.db.WithContext(ctx).Clauses(dbresolver.Write).Where("enabled = ? AND next_run_at <= ?", true, now).Find(&due).Error
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Failed to load due schedules: %v", err)
+		}
+		return schedulerMaxWait
+	}
+	for _, schedule := range due {
+		if _, err := s.start(ctx, schedule, "cron"); err != nil {
+			log.Printf("Failed to start schedule %s: %v", schedule.Name, err)
+		}
+	}
+
+	var next models.Schedule
+	err = s.db.WithContext(ctx).Clauses(dbresolver.Write).Where("enabled = ? AND next_run_at IS NOT NULL", true).
+		Order("next_run_at").Limit(1).Find(&next).Error
+	if err != nil || next.NextRunAt == nil {
+		return schedulerMaxWait
+	}
+	// At least a second, so a schedule that failed to start isn't retried in a tight loop
+	return min(max(time.Until(*next.NextRunAt), time.Second), schedulerMaxWait)
+}
+
+// start queues a run of schedule; trigger is "cron" or "manual"
+// A cron run also moves the schedule on to its next time
+func (s *scheduler) start(ctx context.Context, schedule models.Schedule, trigger string) (models.ScheduleRun, error) {
+	now := time.Now()
+	run := models.ScheduleRun{ScheduleID: schedule.ID, Trigger: trigger, Status: "pending"}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{"last_run_at": now}
+		if trigger == "cron" {
+			updates["next_run_at"] = nextRun(schedule.Cron, s.cfg.Timezone, now)
+		}
+		if err := tx.Model(&models.Schedule{}).Where("id = ?", schedule.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&run).Error; err != nil {
+			return err
+		}
+		return s.jobs.enqueue(tx, scheduleJobKind, scheduleRunJob{RunID: run.ID})
+	})
+	if err != nil {
+		return run, err
+	}
+	s.logLevel.debugf("started schedule %s (%s)", schedule.Name, trigger)
+	s.jobs.notify(scheduleJobKind)
+	return run, nil
+}
+
+// execute runs a schedule run and records the outcome; the schedule.run job worker
+func (s *scheduler) execute(ctx context.Context, job models.Job) error {
+	var payload scheduleRunJob
+	if err := decodeJobPayload(job, &payload); err != nil {
+		return err
+	}
+	var run models.ScheduleRun
+	err := s.db.WithContext(ctx).Clauses(dbresolver.Write).First(&run, payload.RunID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || run.Status == "succeeded" || run.Status == "failed" {
+		return nil // Deleted with its schedule, or finished by an earlier run
+	}
+	if err != nil {
+		return err
+	}
+	var schedule models.Schedule
+	err = s.db.WithContext(ctx).Clauses(dbresolver.Write).First(&schedule, run.ScheduleID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	startedAt := time.Now()
+	if err := s.db.WithContext(ctx).Model(&run).Updates(map[string]interface{}{"status": "running", "started_at": startedAt}).Error; err != nil {
+		return err
+	}
+	var output string
+	task, ok := s.tasks[schedule.Task]
+	params, fieldErrors := decodeScheduleParams(task, schedule.Params)
+	switch {
+	case !ok:
+		err = fmt.Errorf("unknown task %q", schedule.Task)
+	case len(fieldErrors) > 0:
+		err = fmt.Errorf("%s %s", fieldErrors[0].Field, fieldErrors[0].Message)
+	default:
+		runCtx, cancel := context.WithTimeout(ctx, s.cfg.RunTimeout)
+		output, err = task.run(runCtx, params)
+		cancel()
+	}
+	if err != nil && ctx.Err() != nil {
+		return err // Leadership ended mid-run; the next leader runs it again
+	}
+
+	// Not tied to the leader's context: a run that happened is recorded even if leadership just ended
+	updates := map[string]interface{}{"status": "succeeded", "output": output, "finished_at": time.Now()}
+	if err != nil {
+		updates["status"], updates["error"] = "failed", err.Error()
+		log.Printf("Schedule %s (%s) failed: %v", schedule.Name, schedule.Task, err)
+	}
+	scheduleRuns.WithLabelValues(schedule.Task, updates["status"].(string)).Inc()
+	return s.db.Model(&run).Updates(updates).Error
+}
+
+// prune deletes runs older than SCHEDULER_RUN_RETENTION_DAYS and returns how many there were
+// (on a dry run, would be)
+func (s *scheduler) prune(ctx context.Context, dryRun bool) (int64, error) {
+	if s.cfg.RunRetentionDays <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().AddDate(0, 0, -s.cfg.RunRetentionDays)
+	query := s.db.WithContext(ctx).Where("status IN ? AND created_at < ?", []string{"succeeded", "failed"}, cutoff)
+	return purge(query, &models.ScheduleRun{}, dryRun)
+}
+
+// scheduleRunFilterFields are the run history fields ?filter= and ?orderby= accept
+var scheduleRunFilterFields = filterFields{
+	"id":        {Column: "id", Kind: filterNumber},
+	"trigger":   {Column: "triggered_by", Kind: filterString},
+	"status":    {Column: "status", Kind: filterString},
+	"createdAt": {Column: "created_at", Kind: filterTime},
+}
+
+// listSchedulesHandler responds to GET /api/schedules
+func (s *Server) listSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	var schedules []models.Schedule
+	if err := s.db.WithContext(r.Context()).Order("name").Find(&schedules).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, schedules)
+}
+
+// createScheduleHandler responds to POST /api/schedules
+func (s *Server) createScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateScheduleRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	if _, fieldErrors := decodeScheduleParams(s.scheduler.tasks[req.Task], req.Params); len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+
+	schedule := models.Schedule{Name: req.Name, Cron: req.Cron, Task: req.Task, Params: req.Params, Enabled: req.Enabled == nil || *req.Enabled}
+	if schedule.Params == nil {
+		schedule.Params = models.ScheduleParams{}
+	}
+	if schedule.Enabled {
+		schedule.NextRunAt = nextRun(schedule.Cron, s.config.Scheduler.Timezone, time.Now())
+	}
+	var existing int64
+	if err := s.db.WithContext(r.Context()).Model(&models.Schedule{}).Where("name = ?", req.Name).Count(&existing).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	if existing > 0 {
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("A schedule named %s already exists", req.Name))
+		return
+	}
+	if err := s.db.WithContext(r.Context()).Create(&schedule).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to create schedule: %v", err))
+		return
+	}
+	s.scheduler.changed()
+	log.Printf("Schedule %s created: %s runs %s", schedule.Name, schedule.Cron, schedule.Task)
+
+	w.Header().Set("Location", fmt.Sprintf("%s/api/schedules/%d", s.config.Server.BasePath, schedule.ID))
+	writeJSON(w, r, http.StatusCreated, schedule)
+}
+
+// getScheduleHandler responds to GET /api/schedules/{id}
+func (s *Server) getScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	if schedule, ok := findByID[models.Schedule](w, r, s.db, "Schedule"); ok {
+		writeJSON(w, r, http.StatusOK, schedule)
+	}
+}
+
+// updateScheduleHandler responds to PATCH /api/schedules/{id}
+// A new cron expression or enabling the schedule counts the next run from now
+func (s *Server) updateScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateScheduleRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	schedule, ok := findByID[models.Schedule](w, r, s.db, "Schedule")
+	if !ok {
+		return
+	}
+	if req.Params != nil {
+		if _, fieldErrors := decodeScheduleParams(s.scheduler.tasks[schedule.Task], req.Params); len(fieldErrors) > 0 {
+			writeValidationErrors(w, r, fieldErrors)
+			return
+		}
+		schedule.Params = req.Params
+	}
+	if req.Cron != nil {
+		schedule.Cron = *req.Cron
+	}
+	if req.Enabled != nil {
+		schedule.Enabled = *req.Enabled
+	}
+	schedule.NextRunAt = nil
+	if schedule.Enabled {
+		schedule.NextRunAt = nextRun(schedule.Cron, s.config.Scheduler.Timezone, time.Now())
+	}
+
+	// Select writes the unset next run and false as well
+	err := s.db.WithContext(r.Context()).Model(&schedule).Select("cron", "params", "enabled", "next_run_at").Updates(&schedule).Error
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to update schedule: %v", err))
+		return
+	}
+	s.scheduler.changed()
+	writeJSON(w, r, http.StatusOK, schedule)
+}
+
+// deleteScheduleHandler responds to DELETE /api/schedules/{id}
+// Its run history is deleted with it; built-in schedules can only be disabled
+func (s *Server) deleteScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := findByID[models.Schedule](w, r, s.db, "Schedule")
+	if !ok {
+		return
+	}
+	if schedule.Builtin {
+		writeError(w, r, http.StatusConflict, "Built-in schedules can be disabled but not deleted")
+		return
+	}
+	err := s.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("schedule_id = ?", schedule.ID).Delete(&models.ScheduleRun{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&schedule).Error
+	})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "Schedule deleted successfully"})
+}
+
+// runScheduleHandler responds to POST /api/schedules/{id}/run
+// Queues a run right away, even for a disabled schedule; it doesn't move the next cron run
+func (s *Server) runScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := findByID[models.Schedule](w, r, s.db, "Schedule")
+	if !ok {
+		return
+	}
+	run, err := s.scheduler.start(r.Context(), schedule, "manual")
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to start schedule: %v", err))
+		return
+	}
+	log.Printf("Schedule %s started by hand", schedule.Name)
+	writeJSON(w, r, http.StatusAccepted, run)
+}
+
+// getScheduleRunsHandler responds to GET /api/schedules/{id}/runs
+// The run history, newest first (the latest 100 unless a page size is asked for), narrowed with
+// the shared ?filter= and ?orderby= parameters, e.g. ?filter=status eq "failed"
+func (s *Server) getScheduleRunsHandler(w http.ResponseWriter, r *http.Request) {
+	listQuery, err := parseListQuery(r, scheduleRunFilterFields)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid query: "+err.Error())
+		return
+	}
+	schedule, ok := findByID[models.Schedule](w, r, s.db, "Schedule")
+	if !ok {
+		return
+	}
+	if r.URL.Query().Get("pageSize") == "" {
+		listQuery.page.PageSize = min(listQuery.page.PageSize, 100)
+	}
+
+	var runs []models.ScheduleRun
+	query := s.db.WithContext(r.Context()).Model(&models.ScheduleRun{}).Where("schedule_id = ?", schedule.ID)
+	if err := listQuery.apply(query, "id DESC").Find(&runs).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	setNextPageLink(w, r, listQuery.page, len(runs))
+	writeJSON(w, r, http.StatusOK, runs)
+}
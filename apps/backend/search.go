@@ -0,0 +1,195 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"github.com/nextjs-microfrontend/backend/internal/tenant"
+	"gorm.io/gorm"
+)
+
+// GET /api/search backs the admin zone's global search box. On Postgres every searchable table
+// has a search_vector column (migration 0004), generated from the columns below and GIN-indexed,
+// and matches are ranked with ts_rank; each word of the query matches words it begins, so the
+// box can search as the user types. SQLite and MySQL look for each word anywhere in the same
+// columns with LIKE instead, and rank matches by the weights of the columns they are in
+
+// searchMaxTerms is how many words of a query are searched for; the rest are ignored
+const searchMaxTerms = 8
+
+// searchField is a column a search source matches, and how much a match in it counts
+// The weights are ts_rank's defaults for the setweight labels in migration 0004: A is 1, B 0.4
+type searchField struct {
+	column string
+	weight float64
+}
+
+// searchSource is a table GET /api/search looks in
+type searchSource struct {
+	kind    string // The results' type, and the value of ?type= that picks only them
+	table   string
+	fields  []searchField // The columns search_vector is generated from
+	ref     string        // The column that identifies a match in its URL
+	title   string        // The column shown as the match's title
+	snippet string        // The column shown under it; "" for none
+	path    string        // The match's API path, with %s for ref
+	scoped  bool          // Rows belong to a project (see tenant.Scope)
+}
+
+// searchSources are the tables GET /api/search looks in, in the order facets are listed
+var searchSources = []searchSource{
+	{
+		kind: "user", table: "users", fields: []searchField{{"name", 1}, {"email", 0.4}},
+		ref: "id", title: "name", snippet: "email", path: "/api/users/%s", scoped: true,
+	},
+	{
+		kind: "flag", table: "feature_flags", fields: []searchField{{"key", 1}, {"name", 1}, {"description", 0.4}},
+		ref: "key", title: "name", snippet: "description", path: "/api/feature-flags/%s", scoped: true,
+	},
+	{
+		kind: "announcement", table: "announcements", fields: []searchField{{"message", 1}},
+		ref: "id", title: "message", path: "/api/announcements/%s",
+	},
+}
+
+// searchTerms splits a query into the lower-case words it searches for
+func searchTerms(q string) []string {
+	terms := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) })
+	return terms[:min(len(terms), searchMaxTerms)]
+}
+
+// searchRow is a match as the database returns it
+type searchRow struct {
+	Ref     string
+	Title   string
+	Snippet string
+	Score   float64 // Not "rank", which MySQL reserves
+}
+
+// match limits a query on source's table to the rows that match every term, and returns the
+// expression that ranks them
+func (src searchSource) match(db *gorm.DB, terms []string) (*gorm.DB, string, []interface{}) {
+	if !usingSQLite(db) && !usingMySQL(db) {
+		prefixes := make([]string, len(terms))
+		for i, term := range terms {
+			prefixes[i] = term + ":*"
+		}
+		query := strings.Join(prefixes, " & ")
+		return db.Where("search_vector @@ to_tsquery('simple', ?)", query), "ts_rank(search_vector, to_tsquery('simple', ?))", []interface{}{query}
+	}
+
+	var rank []string
+	var rankArgs []interface{}
+	for _, term := range terms {
+		pattern := "%" + escapeLike(term) + "%"
+		var matches []string
+		var args []interface{}
+		for _, field := range src.fields {
+			like := "LOWER(" + quoteColumn(db, field.column) + ") LIKE ? " + likeEscape(db)
+			matches = append(matches, like)
+			args = append(args, pattern)
+			rank = append(rank, "CASE WHEN "+like+" THEN "+strconv.FormatFloat(field.weight, 'f', -1, 64)+" ELSE 0 END")
+			rankArgs = append(rankArgs, pattern)
+		}
+		db = db.Where("("+strings.Join(matches, " OR ")+")", args...)
+	}
+	return db, "(" + strings.Join(rank, " + ") + ")", rankArgs
+}
+
+// search returns the best limit matches of terms in src, and how many there are in all
+func (src searchSource) search(ctx context.Context, db *gorm.DB, terms []string, limit int) ([]searchRow, int64, error) {
+	query := db.WithContext(ctx).Table(src.table)
+	if src.scoped {
+		query = query.Scopes(tenant.Scope(ctx))
+	}
+	query, rank, rankArgs := src.match(query, terms)
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil || total == 0 || limit == 0 {
+		return nil, total, err
+	}
+	snippet := "''"
+	if src.snippet != "" {
+		snippet = quoteColumn(db, src.snippet)
+	}
+	columns := fmt.Sprintf("%s AS ref, %s AS title, %s AS snippet, %s AS score", quoteColumn(db, src.ref), quoteColumn(db, src.title), snippet, rank)
+	var rows []searchRow
+	err := query.Select(columns, rankArgs...).Order("score DESC, id").Limit(limit).Scan(&rows).Error
+	return rows, total, err
+}
+
+// truncateText shortens s to at most n runes, ending it with an ellipsis if it was longer
+func truncateText(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return strings.TrimRightFunc(string(runes[:n-1]), unicode.IsSpace) + "…"
+}
+
+// searchHandler responds to GET /api/search?q=
+// The best ?limit= (default 20) matches across users, flags, and announcements, best first;
+// ?type=user (or flag, or announcement) narrows them to one type. facets counts every match of
+// each type either way, so the UI can show how many of each there are
+func (s *Server) searchHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	terms := searchTerms(q)
+	if len(terms) == 0 {
+		writeError(w, r, http.StatusBadRequest, "q must contain a word to search for")
+		return
+	}
+	kind := query.Get("type")
+	if kind != "" && !slices.ContainsFunc(searchSources, func(src searchSource) bool { return src.kind == kind }) {
+		kinds := make([]string, len(searchSources))
+		for i, src := range searchSources {
+			kinds[i] = src.kind
+		}
+		writeError(w, r, http.StatusBadRequest, "type must be one of "+strings.Join(kinds, ", "))
+		return
+	}
+	limit := 20
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			writeError(w, r, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, s.config.API.MaxPageSize)
+	}
+
+	response := models.SearchResponse{Query: q, Results: []models.SearchResult{}, Facets: map[string]int64{}}
+	for _, src := range searchSources {
+		sourceLimit := limit
+		if kind != "" && kind != src.kind {
+			sourceLimit = 0 // Counted for the facets only
+		}
+		rows, total, err := src.search(r.Context(), s.db, terms, sourceLimit)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Search failed: %v", err))
+			return
+		}
+		response.Facets[src.kind] = total
+		for _, row := range rows {
+			response.Results = append(response.Results, models.SearchResult{
+				Type:    src.kind,
+				ID:      row.Ref,
+				Title:   truncateText(row.Title, 100),
+				Snippet: truncateText(row.Snippet, 200),
+				URL:     s.config.Server.BasePath + fmt.Sprintf(src.path, row.Ref),
+				Rank:    row.Score,
+			})
+		}
+	}
+	// Stable, so equal ranks keep the order of searchSources and then of each table's IDs
+	slices.SortStableFunc(response.Results, func(a, b models.SearchResult) int { return cmp.Compare(b.Rank, a.Rank) })
+	response.Results = response.Results[:min(len(response.Results), limit)]
+	writeJSON(w, r, http.StatusOK, response)
+}
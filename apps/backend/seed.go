@@ -1,159 +1,347 @@
-//go:build seed
-// +build seed
-
 package main
 
 import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"mime"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/nextjs-microfrontend/backend/internal/models"
-	"gorm.io/driver/postgres"
+	"github.com/nextjs-microfrontend/backend/internal/tenant"
+	"gopkg.in/yaml.v3"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// This is a standalone program that seeds the database with sample users and feature flags
-// It can be run as a Kubernetes Job to populate test data
+// sampleUsers are the users added by POST /api/seed and `backend seed`
+func sampleUsers() []models.User {
+	return []models.User{
+		{Email: "alice@example.com", Name: "Alice Johnson"},
+		{Email: "bob@example.com", Name: "Bob Smith"},
+		{Email: "charlie@example.com", Name: "Charlie Brown"},
+		{Email: "diana@example.com", Name: "Diana Prince"},
+		{Email: "eve@example.com", Name: "Eve Anderson"},
+	}
+}
 
-// getEnv retrieves an environment variable or returns a fallback value
-func getEnv(key, fallback string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// sampleFeatureFlags are the flags added by `backend seed`; they start disabled
+func sampleFeatureFlags() []models.FeatureFlag {
+	return []models.FeatureFlag{
+		{Key: "show_welcome_banner", Name: "Show Welcome Banner", Description: "Displays a welcome banner on the main page"},
+		{Key: "new_user_dashboard", Name: "New User Dashboard", Description: "Enable the redesigned user dashboard interface"},
+		{Key: "beta_features", Name: "Beta Features", Description: "Enable access to beta features for testing"},
 	}
-	return fallback
 }
 
-func main() {
-	log.Println("=== Database Seeder ===")
+// seedFile is the format of seed documents: `backend seed --file`, and POST /api/seed
+// with a body or ?file=. JSON or YAML, with the same keys either way:
+//
+//	users:
+//	  - {email: alice@example.com, name: Alice Johnson}
+//	featureFlags:
+//	  - {key: dark_mode, name: Dark Mode, enabled: true}
+//
+// Entries have the same shape (and validation) as the create endpoints' bodies
+type seedFile struct {
+	Users        []models.CreateUserRequest        `json:"users" validate:"dive"`
+	FeatureFlags []models.CreateFeatureFlagRequest `json:"featureFlags" validate:"dive"`
+}
+
+// seedDocument is a parsed and validated seed file
+type seedDocument struct {
+	users []models.User
+	flags []models.FeatureFlag
+}
+
+// seedValidationError lists the invalid fields of a seed document
+type seedValidationError struct {
+	fields []models.FieldError
+}
+
+func (e *seedValidationError) Error() string {
+	problems := make([]string, len(e.fields))
+	for i, fe := range e.fields {
+		problems[i] = fe.Field + " " + fe.Message
+	}
+	return strings.Join(problems, "; ")
+}
 
-	// Build PostgreSQL connection string from environment variables
-	dsn := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		getEnv("DB_HOST", "postgres"),
-		getEnv("DB_USER", "admin"),
-		getEnv("DB_PASSWORD", "devpassword"),
-		getEnv("DB_NAME", "multizone"),
-		getEnv("DB_PORT", "5432"),
-	)
+// isYAMLSeedFile reports whether path names a YAML seed file rather than JSON
+func isYAMLSeedFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
 
-	// Connect to the database
-	log.Printf("Connecting to database at %s...", getEnv("DB_HOST", "postgres"))
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+// readSeedFile loads and validates a JSON or YAML (by extension) seed file
+func readSeedFile(path string) (seedDocument, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
-	}
-
-	log.Println("Database connected successfully")
-
-	// Ensure the database tables exist
-	if err := db.AutoMigrate(&models.User{}, &models.FeatureFlag{}); err != nil {
-		log.Fatalf("Failed to migrate database: %v", err)
-	}
-
-	log.Println("Database schema migrated")
-
-	// Sample users to seed
-	sampleUsers := []models.User{
-		{
-			Email: "alice@example.com",
-			Name:  "Alice Johnson",
-		},
-		{
-			Email: "bob@example.com",
-			Name:  "Bob Smith",
-		},
-		{
-			Email: "charlie@example.com",
-			Name:  "Charlie Brown",
-		},
-		{
-			Email: "diana@example.com",
-			Name:  "Diana Prince",
-		},
-		{
-			Email: "eve@example.com",
-			Name:  "Eve Anderson",
-		},
-	}
-
-	// Insert sample users
-	// Using FirstOrCreate to avoid duplicates (won't insert if email already exists)
-	log.Printf("Seeding %d users...", len(sampleUsers))
-
-	createdCount := 0
-	for _, user := range sampleUsers {
-		var existingUser models.User
-		result := db.Where("email = ?", user.Email).FirstOrCreate(&existingUser, user)
+		return seedDocument{}, err
+	}
+	doc, err := parseSeedDocument(data, isYAMLSeedFile(path))
+	if err != nil {
+		return seedDocument{}, fmt.Errorf("invalid seed file %s: %w", path, err)
+	}
+	return doc, nil
+}
 
-		if result.Error != nil {
-			log.Printf("Error creating user %s: %v", user.Email, result.Error)
-			continue
+// parseSeedDocument decodes and validates a seed document
+// Validation failures are a *seedValidationError, so handlers can list the fields
+func parseSeedDocument(data []byte, isYAML bool) (seedDocument, error) {
+	// YAML is converted to JSON first, so both formats share the JSON field names and checks
+	if isYAML {
+		var value interface{}
+		if err := yaml.Unmarshal(data, &value); err != nil {
+			return seedDocument{}, err
 		}
+		var err error
+		if data, err = json.Marshal(value); err != nil {
+			return seedDocument{}, err
+		}
+	}
 
-		// Check if a new record was created (RowsAffected > 0 means it was created, not found)
-		if result.RowsAffected > 0 {
-			createdCount++
-			log.Printf("✓ Created user: %s (%s)", user.Name, user.Email)
-		} else {
-			log.Printf("- Skipped (already exists): %s (%s)", user.Name, user.Email)
+	// Unknown fields are most likely typos, which would otherwise seed empty values
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var file seedFile
+	if err := decoder.Decode(&file); err != nil {
+		return seedDocument{}, err
+	}
+
+	fieldErrors := validateStruct(file)
+	// A document naming the same email or key twice would make the upsert ambiguous
+	emails, keys := map[string]int{}, map[string]int{}
+	for i, u := range file.Users {
+		if first, ok := emails[u.Email]; ok {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: fmt.Sprintf("users[%d].email", i), Message: fmt.Sprintf("duplicates users[%d]", first)})
 		}
+		emails[u.Email] = i
+	}
+	for i, f := range file.FeatureFlags {
+		if first, ok := keys[f.Key]; ok {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: fmt.Sprintf("featureFlags[%d].key", i), Message: fmt.Sprintf("duplicates featureFlags[%d]", first)})
+		}
+		keys[f.Key] = i
+	}
+	if len(fieldErrors) > 0 {
+		return seedDocument{}, &seedValidationError{fields: fieldErrors}
 	}
 
-	log.Printf("\n=== User Seeding Complete ===")
-	log.Printf("Total users processed: %d", len(sampleUsers))
-	log.Printf("New users created: %d", createdCount)
-	log.Printf("Existing users skipped: %d", len(sampleUsers)-createdCount)
-
-	// Sample feature flags to seed
-	sampleFlags := []models.FeatureFlag{
-		{
-			Key:         "show_welcome_banner",
-			Name:        "Show Welcome Banner",
-			Description: "Displays a welcome banner on the main page",
-			Enabled:     false, // Start disabled
-		},
-		{
-			Key:         "new_user_dashboard",
-			Name:        "New User Dashboard",
-			Description: "Enable the redesigned user dashboard interface",
-			Enabled:     false,
-		},
-		{
-			Key:         "beta_features",
-			Name:        "Beta Features",
-			Description: "Enable access to beta features for testing",
-			Enabled:     false,
-		},
-	}
-
-	// Insert sample feature flags
-	// Using FirstOrCreate to avoid duplicates (won't insert if key already exists)
-	log.Printf("\n\nSeeding %d feature flags...", len(sampleFlags))
-
-	createdFlagCount := 0
-	for _, flag := range sampleFlags {
-		var existingFlag models.FeatureFlag
-		result := db.Where("key = ?", flag.Key).FirstOrCreate(&existingFlag, flag)
+	doc := seedDocument{
+		users: make([]models.User, len(file.Users)),
+		flags: make([]models.FeatureFlag, len(file.FeatureFlags)),
+	}
+	for i, u := range file.Users {
+		doc.users[i] = models.User{Email: u.Email, Name: u.Name}
+	}
+	for i, f := range file.FeatureFlags {
+		doc.flags[i] = models.FeatureFlag{Key: f.Key, Name: f.Name, Description: f.Description, Enabled: f.Enabled}
+	}
+	return doc, nil
+}
 
-		if result.Error != nil {
-			log.Printf("Error creating feature flag %s: %v", flag.Key, result.Error)
+// seedDirFile resolves ?file= on POST /api/seed to a file in dir (SEED_DIR)
+// Only plain file names are accepted, so a request can't read anything outside the directory
+func seedDirFile(dir, name string) (string, error) {
+	if dir == "" {
+		return "", errors.New("seed files are disabled (SEED_DIR is not set)")
+	}
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid seed file name %q", name)
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// Largest seed document POST /api/seed reads from a request body
+const maxSeedDocumentSize = 10 << 20
+
+// readSeedRequest reads the seed document of a POST /api/seed request, from ?file= in seedDir or the body
+// ok is false when the request has neither, meaning "seed the samples"
+func readSeedRequest(r *http.Request, seedDir string) (doc seedDocument, ok bool, err error) {
+	if name := r.URL.Query().Get("file"); name != "" {
+		path, err := seedDirFile(seedDir, name)
+		if err != nil {
+			return doc, false, err
+		}
+		doc, err = readSeedFile(path)
+		return doc, err == nil, err
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxSeedDocumentSize))
+	if err != nil {
+		return doc, false, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return doc, false, nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	isYAML := mediaType == "application/yaml" || mediaType == "application/x-yaml" || mediaType == "text/yaml"
+	doc, err = parseSeedDocument(data, isYAML)
+	return doc, err == nil, err
+}
+
+// upsertSeed applies a seed document to the database in one transaction (see upsertUsers, upsertFlags)
+func upsertSeed(ctx context.Context, database *gorm.DB, doc seedDocument) (users, flags models.SeedCounts, err error) {
+	err = database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if users, err = upsertUsers(tx, doc.users); err != nil {
+			return err
+		}
+		flags, _, err = upsertFlags(tx, doc.flags)
+		return err
+	})
+	return users, flags, err
+}
+
+// upsertUsers creates the users whose emails are new and renames the existing ones whose
+// name differs; users that already match are left alone, so seeding twice changes nothing
+// Users are matched and created in the project of tx's context
+func upsertUsers(tx *gorm.DB, users []models.User) (models.SeedCounts, error) {
+	counts := models.SeedCounts{Total: len(users)}
+	emails := make([]string, len(users))
+	for i, u := range users {
+		emails[i] = u.Email
+		users[i].ProjectID = tenant.FromContext(tx.Statement.Context).ID
+	}
+	existing, err := findSeeded[models.User](tx, "email", emails, func(u models.User) string { return u.Email })
+	if err != nil {
+		return counts, fmt.Errorf("error reading users: %w", err)
+	}
+
+	var pending []models.User
+	for _, u := range users {
+		old, found := existing[u.Email]
+		switch {
+		case !found:
+			counts.Created++
+		case old.Name != u.Name:
+			counts.Updated++
+		default:
+			counts.Unchanged++
 			continue
 		}
+		pending = append(pending, u)
+	}
+	if len(pending) == 0 {
+		return counts, nil
+	}
+
+	// INSERT ... ON CONFLICT (project_id, email) DO UPDATE SET name = excluded.name, updated_at = excluded.updated_at
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "project_id"}, {Name: "email"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "updated_at"}),
+	}).Create(&pending).Error; err != nil {
+		return counts, fmt.Errorf("error upserting users: %w", err)
+	}
+	return counts, nil
+}
+
+// upsertFlags is upsertUsers for feature flags (matched by key; name, description, and
+// enabled are updated). It also returns the flags it created or updated, by key, with "created" or "updated"
+func upsertFlags(tx *gorm.DB, flags []models.FeatureFlag) (models.SeedCounts, map[string]string, error) {
+	counts := models.SeedCounts{Total: len(flags)}
+	keys := make([]string, len(flags))
+	for i, f := range flags {
+		keys[i] = f.Key
+		flags[i].ProjectID = tenant.FromContext(tx.Statement.Context).ID
+	}
+	existing, err := findSeeded[models.FeatureFlag](tx, "key", keys, func(f models.FeatureFlag) string { return f.Key })
+	if err != nil {
+		return counts, nil, fmt.Errorf("error reading feature flags: %w", err)
+	}
 
-		// Check if a new record was created (RowsAffected > 0 means it was created, not found)
-		if result.RowsAffected > 0 {
-			createdFlagCount++
-			log.Printf("✓ Created feature flag: %s (%s)", flag.Name, flag.Key)
-		} else {
-			log.Printf("- Skipped (already exists): %s (%s)", flag.Name, flag.Key)
+	changed := map[string]string{}
+	var pending []models.FeatureFlag
+	for _, f := range flags {
+		old, found := existing[f.Key]
+		switch {
+		case !found:
+			counts.Created++
+			changed[f.Key] = "created"
+		case old.Name != f.Name || old.Description != f.Description || old.Enabled != f.Enabled:
+			counts.Updated++
+			changed[f.Key] = "updated"
+		default:
+			counts.Unchanged++
+			continue
+		}
+		pending = append(pending, f)
+	}
+	if len(pending) == 0 {
+		return counts, changed, nil
+	}
+
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "project_id"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "description", "enabled", "updated_at"}),
+	}).Create(&pending).Error; err != nil {
+		return counts, nil, fmt.Errorf("error upserting feature flags: %w", err)
+	}
+	return counts, changed, nil
+}
+
+// findSeeded loads the rows of tx's project whose column is one of values, by that value
+// Values are looked up DB_BATCH_SIZE (the connection's CreateBatchSize) at a time to stay
+// under the database's parameter limit
+func findSeeded[T any](tx *gorm.DB, column string, values []string, keyOf func(T) string) (map[string]T, error) {
+	found := make(map[string]T, len(values))
+	batchSize := cmp.Or(tx.CreateBatchSize, len(values))
+	for start := 0; start < len(values); start += batchSize {
+		var rows []T
+		chunk := values[start:min(start+batchSize, len(values))]
+		if err := tx.Scopes(tenant.Scope(tx.Statement.Context)).Where(quoteColumn(tx, column)+" IN ?", chunk).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			found[keyOf(row)] = row
 		}
 	}
+	return found, nil
+}
 
-	log.Printf("\n=== Feature Flag Seeding Complete ===")
-	log.Printf("Total feature flags processed: %d", len(sampleFlags))
-	log.Printf("New flags created: %d", createdFlagCount)
-	log.Printf("Existing flags skipped: %d", len(sampleFlags)-createdFlagCount)
+// seedDatabase inserts users and flags in batches into ctx's project, skipping any whose email
+// or key already exists there
+// It returns how many of each were created
+func seedDatabase(ctx context.Context, database *gorm.DB, users []models.User, flags []models.FeatureFlag) (int, int, error) {
+	usersCreated, flagsCreated := 0, 0
+	projectID := tenant.FromContext(ctx).ID
 
-	log.Println("\n\n=== ALL SEEDING COMPLETE ===")
+	// GORM will execute: INSERT INTO users (...) VALUES (...), (...) ON CONFLICT (project_id, email) DO NOTHING
+	// RowsAffected only counts inserted rows, so conflicts show up as skipped
+	if len(users) > 0 {
+		for i := range users {
+			users[i].ProjectID = projectID
+		}
+		result := database.WithContext(ctx).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "project_id"}, {Name: "email"}},
+			DoNothing: true,
+		}).Create(&users)
+		if result.Error != nil {
+			return 0, 0, fmt.Errorf("error creating users: %w", result.Error)
+		}
+		usersCreated = int(result.RowsAffected)
+	}
+
+	if len(flags) > 0 {
+		for i := range flags {
+			flags[i].ProjectID = projectID
+		}
+		result := database.WithContext(ctx).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "project_id"}, {Name: "key"}},
+			DoNothing: true,
+		}).Create(&flags)
+		if result.Error != nil {
+			return usersCreated, 0, fmt.Errorf("error creating feature flags: %w", result.Error)
+		}
+		flagsCreated = int(result.RowsAffected)
+	}
+	return usersCreated, flagsCreated, nil
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	sentryhttp "github.com/getsentry/sentry-go/http"
+)
+
+// initSentry configures the Sentry client from cfg and reports whether it is enabled
+func initSentry(cfg SentryConfig) bool {
+	if cfg.DSN == "" {
+		return false
+	}
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:              cfg.DSN,
+		Environment:      cfg.Environment,
+		Release:          cfg.Release,
+		AttachStacktrace: true,
+		// Cookies, Authorization, and client IPs stay out of Sentry
+		SendDefaultPII: false,
+	})
+	if err != nil {
+		log.Printf("Sentry disabled: %v", err)
+		return false
+	}
+	log.Printf("Sentry error reporting enabled (environment=%s, release=%s)", cfg.Environment, cfg.Release)
+	return true
+}
+
+// sentryMiddleware reports panics with the request attached, then re-panics so
+// recoveryMiddleware can log them and answer with a 500
+// It also puts a request-scoped hub in the context for reportServerError
+func sentryMiddleware(next http.Handler) http.Handler {
+	return sentryhttp.New(sentryhttp.Options{
+		Repanic: true,
+		Timeout: 2 * time.Second,
+	}).Handle(next)
+}
+
+// reportServerError sends a 5xx response to Sentry, tagged with the status
+// and request ID so it can be matched with the pod logs
+// The stack trace points at the handler that wrote the error
+func reportServerError(r *http.Request, status int, message string) {
+	hub := sentry.GetHubFromContext(r.Context())
+	if hub == nil {
+		return
+	}
+	hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetTag("status", strconv.Itoa(status))
+		scope.SetTag("request_id", requestIDFrom(r.Context()))
+		hub.CaptureException(errors.New(message))
+	})
+}
+
+// flushSentry waits for queued events to be sent before the process exits
+func flushSentry() {
+	sentry.Flush(2 * time.Second)
+}
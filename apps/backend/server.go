@@ -0,0 +1,212 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"sync/atomic"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/cache"
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+)
+
+// Server holds the state the HTTP handlers share: the database, the flag cache,
+// the monitored zones and their health snapshot, and the change feed
+// Handlers are methods on it (or on the services it wires up), so two Servers,
+// e.g. in parallel tests, never see each other's data
+type Server struct {
+	// Settings the server was started with (see config.go); never modified, so tests
+	// can give each Server its own. The reloadable ones are read from live instead
+	config Config
+
+	// Reloadable settings, as last applied by a reload (see reload.go)
+	live *liveConfig
+
+	// The --config file config was loaded from ("" if none); reloads re-read it
+	configPath string
+
+	// Database connection; nil in mock mode
+	db *gorm.DB
+
+	// Session on db that caches prepared statements, for the hot fixed-shape queries
+	// (flag lookups, dashboard stats, GraphQL). Queries built from ?filter= use db instead,
+	// since every distinct filter would otherwise add a prepared statement to every connection
+	stmtDB *gorm.DB
+
+	// Feature flag cache for performance
+	// Stores feature flags in memory to reduce database queries
+	// Bounded so a huge number of flags can't grow memory without limit; the least
+	// recently used flags are evicted first and reloaded from the database on demand
+	// Sized by FLAG_CACHE_SIZE
+	flagCache *cache.LRU[string, models.FeatureFlag]
+
+	// All zones monitored by the backend, in display order (ZONE_MAIN_URL, ZONE_ADMIN_URL)
+	zones []zoneTarget
+
+	// HTTP client shared by every zone health check
+	// Reusing it keeps connections to each zone alive between polls instead of
+	// dialing (and leaving a TIME_WAIT socket behind) on every check
+	healthCheckClient *http.Client
+
+	// Deduplicate concurrent zone checks: when many requests ask for zone status at once,
+	// only one health check runs per zone and every caller shares its result
+	// (flag cache fills are deduplicated the same way in flagService)
+	zoneChecks singleflight.Group
+
+	// Last result of checkAllZones, shared by the REST, dashboard, and GraphQL zone status
+	zoneStatuses *zoneStatusSnapshot
+
+	// The zones' sitemaps merged for /sitemap.xml (see sitemap.go)
+	sitemap *sitemapCache
+
+	// Feed of flag and zone changes behind /api/changes
+	changes *changeFeed
+
+	// Sessions with a recent heartbeat per zone, for the live active users count (see presence.go)
+	presence *presenceTracker
+
+	// Availability and latency of this process's requests, for GET /api/slo/self (see slo.go)
+	slo *sloTracker
+
+	// Per-endpoint, per-consumer request counts; nil in mock mode (there is no database)
+	usage *usageRecorder
+
+	// Page views and custom events from the zones, rolled up daily; nil in mock mode
+	analytics *analyticsRecorder
+
+	// Latency, errors, and unhealthy zones injected through /internal/faults (see chaos.go); nil unless CHAOS_ENABLED=true
+	faults *faultInjector
+
+	// TRUSTED_PROXIES, whose X-Forwarded-For says who the client is (see clientIP)
+	trustedProxies []netip.Prefix
+
+	// Per-client budget of contact form messages (see contact.go); nil when CONTACT_RATE_LIMIT is 0
+	contactLimit *rateLimiter
+
+	// Per-client budget of newsletter signups (see newsletter.go); nil when NEWSLETTER_RATE_LIMIT is 0
+	newsletterLimit *rateLimiter
+
+	// Checks the contact form's CAPTCHA tokens; nil when CONTACT_CAPTCHA_VERIFY_URL is empty
+	captcha *captchaVerifier
+
+	// Database backups and restores behind /internal/backups; nil unless BACKUP_ENABLED=true
+	backups *backupRunner
+
+	// Presigned uploads to UPLOAD_S3_BUCKET behind /api/uploads (see uploads.go); nil when it is empty or in mock mode
+	uploads *uploadStore
+
+	// Makes the variants of avatar uploads (see images.go); nil when uploads is
+	images *imageProcessor
+
+	// Runs the background tasks only one replica may run (usage pruning) while this one leads; nil in mock mode
+	leader *leaderElector
+
+	// Outbound webhook subscriptions and deliveries behind /api/webhook-subscriptions; nil in mock mode
+	webhooks *webhookDispatcher
+
+	// Flag, user, zone, and deployment events behind /api/activity; nil in mock mode
+	activity *activityLog
+
+	// Translations of flags and announcements (see translations.go); nil in mock mode
+	translations *translationStore
+
+	// Site-wide settings such as the site title (see settings.go); nil in mock mode, which has the defaults
+	settings *settingsStore
+
+	// Short links followed at /r/{slug}, with their visits counted (see redirects.go); nil in mock mode
+	redirects *redirectStore
+
+	// Templated email behind /api/emails; nil in mock mode or when EMAIL_PROVIDER is empty
+	mailer *mailer
+
+	// Background jobs (webhook deliveries, email) behind /api/jobs; nil in mock mode
+	jobs *jobQueue
+
+	// Cron schedules behind /api/schedules; nil in mock mode
+	scheduler *scheduler
+
+	// The flag service the REST handlers use, for tasks that change flags (see schedule_tasks.go)
+	flags *flagService
+
+	// Set once SIGTERM or SIGINT arrives; readyHandler reports 503 from then on (see shutdown.go)
+	shuttingDown atomic.Bool
+}
+
+// newServer builds a Server configured by cfg
+// database is nil in mock mode; otherwise it must already be migrated (see initDB)
+// The server's queries are logged at its own log level, which PUT /internal/log-level changes
+func newServer(database *gorm.DB, cfg Config) *Server {
+	live := newLiveConfig(cfg)
+	if database != nil {
+		database = database.Session(&gorm.Session{Logger: newDBLogger(cfg.Database.SlowQueryThreshold, live.logLevel)})
+	}
+	s := &Server{
+		config:    cfg,
+		live:      live,
+		db:        database,
+		flagCache: cache.NewLRU[string, models.FeatureFlag](cfg.API.FlagCacheSize),
+		zones: []zoneTarget{
+			{Name: "zone-main", URL: cfg.Zones.MainURL},
+			{Name: "zone-admin", URL: cfg.Zones.AdminURL},
+		},
+		healthCheckClient: newHealthCheckClient(),
+		changes:           newChangeFeed(),
+		trustedProxies:    parseTrustedProxies(cfg.Server.TrustedProxies),
+		contactLimit:      newContactRateLimiter(cfg.Contact),
+		newsletterLimit:   newNewsletterRateLimiter(cfg.Newsletter),
+		captcha:           newCaptchaVerifier(cfg.Contact),
+	}
+	s.zoneStatuses = newZoneStatusSnapshot(s.checkAllZones, s.live)
+	s.sitemap = newSitemapCache(s.healthCheckClient, s.zones, cfg.Zones)
+	s.presence = newPresenceTracker(s.changes, cfg.Analytics)
+	s.slo = newSLOTracker(cfg)
+	if cfg.Server.ChaosEnabled {
+		s.faults = newFaultInjector(cfg.Server.BasePath)
+	}
+	if database != nil {
+		s.stmtDB = database.Session(&gorm.Session{PrepareStmt: true})
+	}
+	return s
+}
+
+// newHealthCheckClient returns the client used for zone health checks
+func newHealthCheckClient() *http.Client {
+	return &http.Client{
+		// checkZoneHealth bounds each check by HEALTH_CHECK_TIMEOUT, so an unresponsive zone can't hang it
+		// Each check is traced as an outbound HTTP span and carries traceparent to the zone
+		Transport: otelhttp.NewTransport(&http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   2 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSHandshakeTimeout:   2 * time.Second,
+			ResponseHeaderTimeout: 5 * time.Second,
+			// Zones are the only hosts, so a couple of idle connections each is plenty
+			MaxIdleConns:        16,
+			MaxIdleConnsPerHost: 2,
+			MaxConnsPerHost:     4,
+			IdleConnTimeout:     90 * time.Second,
+		}),
+	}
+}
+
+// zoneTarget is a zone the backend knows how to reach
+type zoneTarget struct {
+	Name string // Zone name (e.g., "zone-main")
+	URL  string // Internal URL used for health checks
+}
+
+// findZone looks up a zone by name
+func (s *Server) findZone(name string) (zoneTarget, bool) {
+	for _, zone := range s.zones {
+		if zone.Name == name {
+			return zone, true
+		}
+	}
+	return zoneTarget{}, false
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/cache"
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"github.com/nextjs-microfrontend/backend/internal/tenant"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/singleflight"
+)
+
+// Services hold the business logic behind the REST handlers: turning requests into
+// records, keeping the flag cache warm, and publishing flag changes. Handlers only
+// decode, call a service, and render, and services only reach storage through the
+// repositories in repository.go
+
+// userService manages users
+// Users created or deleted through it are sent to webhook subscribers; seeding isn't, and
+// neither are the users of projects other than the default one (subscriptions are deployment-wide)
+// They are recorded in the activity feed of their own project
+type userService struct {
+	repo     UserRepository
+	webhooks *webhookDispatcher // nil in mock mode
+	activity *activityLog       // nil in mock mode
+}
+
+func (s *userService) list(ctx context.Context, query listQuery) ([]models.User, error) {
+	return s.repo.List(ctx, query)
+}
+
+func (s *userService) count(ctx context.Context, query listQuery) (int64, error) {
+	return s.repo.Count(ctx, query)
+}
+
+func (s *userService) export(ctx context.Context, query listQuery) (rowCursor[models.User], error) {
+	return s.repo.Export(ctx, query)
+}
+
+func (s *userService) get(ctx context.Context, id string) (models.User, error) {
+	return s.repo.Get(ctx, id)
+}
+
+func (s *userService) create(ctx context.Context, req models.CreateUserRequest) (models.User, error) {
+	user := models.User{Email: req.Email, Name: req.Name}
+	if err := s.repo.Create(ctx, &user); err != nil {
+		return user, err
+	}
+	s.webhooksFor(ctx).userCreated(user)
+	s.activity.userCreated(ctx, user)
+	return user, nil
+}
+
+// createMany creates every user in req, or none of them
+func (s *userService) createMany(ctx context.Context, req models.BulkCreateUsersRequest) ([]models.User, error) {
+	users := make([]models.User, len(req.Users))
+	for i, u := range req.Users {
+		users[i] = models.User{Email: u.Email, Name: u.Name}
+	}
+	if err := s.repo.CreateMany(ctx, users); err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		s.webhooksFor(ctx).userCreated(user)
+		s.activity.userCreated(ctx, user)
+	}
+	return users, nil
+}
+
+func (s *userService) delete(ctx context.Context, id string) error {
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	if userID, err := strconv.ParseUint(id, 10, 64); err == nil {
+		s.webhooksFor(ctx).userDeleted(uint(userID))
+	}
+	s.activity.userDeleted(ctx, id)
+	return nil
+}
+
+// webhooksFor returns the dispatcher for ctx's project, nil for any but the default project
+func (s *userService) webhooksFor(ctx context.Context) *webhookDispatcher {
+	if tenant.FromContext(ctx).ID != tenant.DefaultProjectID {
+		return nil
+	}
+	return s.webhooks
+}
+
+// seed adds the sample users (the same ones `backend seed` adds) and reports what happened
+func (s *userService) seed(ctx context.Context) models.SeedResponse {
+	users := sampleUsers()
+	errors := []string{}
+
+	created, err := s.repo.Seed(ctx, users)
+	skipped := len(users) - created
+	if err != nil {
+		errors = append(errors, err.Error())
+		skipped = 0
+	}
+
+	return models.SeedResponse{
+		Message:    "Database seeding completed",
+		TotalUsers: len(users),
+		Created:    created,
+		Skipped:    skipped,
+		Errors:     errors,
+		ErrorCount: len(errors),
+	}
+}
+
+// upsert applies a seed document's users
+func (s *userService) upsert(ctx context.Context, users []models.User) (models.SeedCounts, error) {
+	return s.repo.Upsert(ctx, users)
+}
+
+func (s *userService) stats(ctx context.Context) (models.UserStats, error) {
+	return s.repo.Stats(ctx)
+}
+
+// flagService manages feature flags
+// Every read that returns flags refreshes the cache, and every write updates it
+// and publishes the change to long-polling clients and other replicas
+// Cache entries and changes are keyed by tenant.FlagKey, so projects' flags with the same key
+// don't mix
+type flagService struct {
+	repo     FlagRepository
+	cache    *cache.LRU[string, models.FeatureFlag]
+	changes  *changeFeed
+	timeout  time.Duration // REQUEST_TIMEOUT, for loads shared by several requests
+	logLevel *logLevel     // The server's, for debug lines about cache misses
+
+	// Concurrent cache misses on the same key wait for a single load instead of each running one
+	loads singleflight.Group
+}
+
+// list returns one page of flags and caches them
+func (s *flagService) list(ctx context.Context, query listQuery) ([]models.FeatureFlag, error) {
+	flags, err := s.repo.List(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	for _, flag := range flags {
+		s.cache.Store(tenant.FlagKey(tenant.FromContext(ctx).ID, flag.Key), flag)
+	}
+	return flags, nil
+}
+
+func (s *flagService) count(ctx context.Context, query listQuery) (int64, error) {
+	return s.repo.Count(ctx, query)
+}
+
+func (s *flagService) export(ctx context.Context, query listQuery) (rowCursor[models.FeatureFlag], error) {
+	return s.repo.Export(ctx, query)
+}
+
+// all returns every flag ordered by key, for the bootstrap snapshot
+func (s *flagService) all(ctx context.Context) ([]models.FeatureFlag, error) {
+	return s.repo.All(ctx)
+}
+
+// get returns a flag from the cache, loading it from the repository on a miss
+func (s *flagService) get(ctx context.Context, key string) (models.FeatureFlag, error) {
+	project := tenant.FromContext(ctx)
+	scoped := tenant.FlagKey(project.ID, key)
+	_, span := tracer.Start(ctx, "flagCache.Load")
+	cached, ok := s.cache.Load(scoped)
+	span.SetAttributes(attribute.Bool("cache.hit", ok))
+	span.End()
+	if ok {
+		return cached, nil
+	}
+
+	result, err, _ := s.loads.Do(scoped, func() (interface{}, error) {
+		s.logLevel.debugf("flag cache miss for %s, loading from the database", scoped)
+		// Shared by every waiting request, so it gets its own deadline instead of one caller's
+		ctx, cancel := context.WithTimeout(tenant.NewContext(context.Background(), project), s.timeout)
+		defer cancel()
+
+		flag, err := s.repo.Get(ctx, key)
+		if err != nil {
+			return flag, err
+		}
+		s.cache.Store(scoped, flag)
+		return flag, nil
+	})
+	return result.(models.FeatureFlag), err
+}
+
+func (s *flagService) create(ctx context.Context, req models.CreateFeatureFlagRequest) (models.FeatureFlag, error) {
+	flag := models.FeatureFlag{
+		Key:         req.Key,
+		Name:        req.Name,
+		Description: req.Description,
+		Enabled:     req.Enabled,
+	}
+	if err := s.repo.Create(ctx, &flag); err != nil {
+		return flag, err
+	}
+
+	scoped := tenant.FlagKey(tenant.FromContext(ctx).ID, flag.Key)
+	s.cache.Store(scoped, flag)
+	s.changes.publishFlagChange(scoped, "created")
+	return flag, nil
+}
+
+// createMany creates every flag in req, or none of them
+func (s *flagService) createMany(ctx context.Context, req models.BulkCreateFeatureFlagsRequest) ([]models.FeatureFlag, error) {
+	flags := make([]models.FeatureFlag, len(req.Flags))
+	for i, f := range req.Flags {
+		flags[i] = models.FeatureFlag{
+			Key:         f.Key,
+			Name:        f.Name,
+			Description: f.Description,
+			Enabled:     f.Enabled,
+		}
+	}
+	if err := s.repo.CreateMany(ctx, flags); err != nil {
+		return nil, err
+	}
+
+	// Only touch the cache once every flag has been stored
+	for _, flag := range flags {
+		scoped := tenant.FlagKey(tenant.FromContext(ctx).ID, flag.Key)
+		s.cache.Store(scoped, flag)
+		s.changes.publishFlagChange(scoped, "created")
+	}
+	return flags, nil
+}
+
+func (s *flagService) update(ctx context.Context, key string, req models.UpdateFeatureFlagRequest) (models.FeatureFlag, error) {
+	flag, err := s.repo.Update(ctx, key, req)
+	if err != nil {
+		return flag, err
+	}
+
+	scoped := tenant.FlagKey(tenant.FromContext(ctx).ID, key)
+	s.cache.Store(scoped, flag)
+	s.changes.publishFlagChange(scoped, "updated")
+	return flag, nil
+}
+
+func (s *flagService) delete(ctx context.Context, key string) error {
+	if err := s.repo.Delete(ctx, key); err != nil {
+		return err
+	}
+
+	scoped := tenant.FlagKey(tenant.FromContext(ctx).ID, key)
+	s.cache.Delete(scoped)
+	s.changes.publishFlagChange(scoped, "deleted")
+	return nil
+}
+
+// upsert applies a seed document's flags; changed flags are dropped from the cache
+// (the next read loads them as stored) and published like any other change
+func (s *flagService) upsert(ctx context.Context, flags []models.FeatureFlag) (models.SeedCounts, error) {
+	counts, changed, err := s.repo.Upsert(ctx, flags)
+	if err != nil {
+		return counts, err
+	}
+	s.changed(ctx, changed)
+	return counts, nil
+}
+
+// apply makes the project's flags match a desired state (see flag_sync.go); the changes are
+// published like any other, and only worked out on a dry run
+func (s *flagService) apply(ctx context.Context, flags []models.CreateFeatureFlagRequest, dryRun, prune bool) (models.BundleImportResponse, error) {
+	plan, err := s.repo.Sync(ctx, flags, dryRun, prune)
+	if err != nil {
+		return models.BundleImportResponse{}, err
+	}
+	if !dryRun {
+		s.changed(ctx, plan.changedKeys())
+	}
+	return plan.response(dryRun), nil
+}
+
+// changed drops flags of ctx's project changed in the database without the service (by key,
+// with "created", "updated", or "deleted") from the cache and publishes the changes
+func (s *flagService) changed(ctx context.Context, changed map[string]string) {
+	for key, action := range changed {
+		scoped := tenant.FlagKey(tenant.FromContext(ctx).ID, key)
+		s.cache.Delete(scoped)
+		s.changes.publishFlagChange(scoped, action)
+	}
+}
+
+// summary returns every flag with enabled/disabled counts, for the dashboard
+func (s *flagService) summary(ctx context.Context) (models.FlagSummary, error) {
+	var summary models.FlagSummary
+	flags, err := s.repo.All(ctx)
+	if err != nil {
+		return summary, err
+	}
+
+	summary.Flags = flags
+	summary.Total = int64(len(flags))
+	for _, flag := range flags {
+		if flag.Enabled {
+			summary.Enabled++
+		}
+		// Keep the flag cache warm while we have fresh data
+		s.cache.Store(tenant.FlagKey(tenant.FromContext(ctx).ID, flag.Key), flag)
+	}
+	summary.Disabled = summary.Total - summary.Enabled
+	return summary, nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"golang.org/x/text/language"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// System settings are the site-wide values the zones read that aren't on/off switches (those are
+// feature flags), such as the site title and the support email. GET /api/settings returns all of
+// them, each with its default unless it was set, and PATCH /api/settings sets some. A setting that
+// was set is a row in the settings table, keyed by its JSON name with its value JSON-encoded, so a
+// new setting is a field on models.Settings and models.UpdateSettingsRequest and a default in
+// defaultSettings, without a migration
+
+// settingsCacheTTL is how long a replica serves the settings it read before reading them again, so
+// a change made on another replica shows within this long
+const settingsCacheTTL = 30 * time.Second
+
+// defaultSettings are the settings before any was set
+func defaultSettings() models.Settings {
+	return models.Settings{
+		SiteTitle:               "Multi-Zone Microfrontend",
+		DefaultLocale:           defaultLocale.String(),
+		DashboardRefreshSeconds: 30,
+	}
+}
+
+// settingNames are the JSON names of every setting, sorted
+func settingNames() []string {
+	encoded, _ := json.Marshal(defaultSettings())
+	var values map[string]json.RawMessage
+	json.Unmarshal(encoded, &values)
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// settingsStore reads and writes the settings table, caching what it read for settingsCacheTTL
+// A nil store always has the defaults, which is what mock mode has
+type settingsStore struct {
+	db *gorm.DB
+
+	mu       sync.Mutex
+	cached   models.Settings
+	loadedAt time.Time // Zero when nothing is cached
+}
+
+// newSettingsStore creates a store that keeps settings in database
+func newSettingsStore(database *gorm.DB) *settingsStore {
+	return &settingsStore{db: database}
+}
+
+// get returns the settings, from the cache while it is fresh
+func (s *settingsStore) get(ctx context.Context) (models.Settings, error) {
+	if s == nil {
+		return defaultSettings(), nil
+	}
+	// Held while loading, so a burst of requests after the cache expires reads the table once
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.loadedAt.IsZero() && time.Since(s.loadedAt) < settingsCacheTTL {
+		return s.cached, nil
+	}
+
+	var rows []models.Setting
+	if err := s.db.WithContext(ctx).Find(&rows).Error; err != nil {
+		return models.Settings{}, err
+	}
+	settings := defaultSettings()
+	for _, row := range rows {
+		// Each row is applied on its own, so one left behind by a setting that was removed, or
+		// changed type, keeps the default instead of failing every read
+		next := settings
+		field, _ := json.Marshal(map[string]json.RawMessage{row.Key: json.RawMessage(row.Value)})
+		if err := json.Unmarshal(field, &next); err != nil {
+			log.Printf("Ignoring setting %s: %v", row.Key, err)
+			continue
+		}
+		settings = next
+	}
+	s.cached, s.loadedAt = settings, time.Now()
+	return settings, nil
+}
+
+// update stores the settings present in req and returns their names
+func (s *settingsStore) update(ctx context.Context, req models.UpdateSettingsRequest) ([]string, error) {
+	encoded, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &values); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	if len(names) == 0 {
+		return names, nil
+	}
+
+	rows := make([]models.Setting, len(names))
+	for i, name := range names {
+		rows[i] = models.Setting{Key: name, Value: string(values[name])}
+	}
+	err = s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&rows).Error
+	s.invalidate()
+	return names, err
+}
+
+// reset deletes name's row, so it has its default again; it reports whether it had one
+func (s *settingsStore) reset(ctx context.Context, name string) (bool, error) {
+	result := s.db.WithContext(ctx).Where(quoteColumn(s.db, "key")+" = ?", name).Delete(&models.Setting{})
+	s.invalidate()
+	return result.RowsAffected > 0, result.Error
+}
+
+// invalidate drops the cached settings, so the next read sees a change made here at once
+func (s *settingsStore) invalidate() {
+	s.mu.Lock()
+	s.loadedAt = time.Time{}
+	s.mu.Unlock()
+}
+
+// getSettingsHandler responds to GET /api/settings
+// Every setting, with its default unless it was set
+func (s *Server) getSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	settings, err := s.settings.get(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, settings)
+}
+
+// updateSettingsHandler responds to PATCH /api/settings
+// Sets the settings in the body and returns all of them
+func (s *Server) updateSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateSettingsRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	if req.DefaultLocale != nil {
+		// Stored in its canonical form, e.g. "pt-BR" for "pt-br"
+		tag, _ := language.Parse(*req.DefaultLocale)
+		canonical := tag.String()
+		req.DefaultLocale = &canonical
+	}
+	names, err := s.settings.update(r.Context(), req)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to update settings: %v", err))
+		return
+	}
+	for _, name := range names {
+		s.changes.publish("setting", name, "updated")
+	}
+	s.getSettingsHandler(w, r)
+}
+
+// resetSettingHandler responds to DELETE /api/settings/{name}
+// Puts the setting back to its default and returns every setting; a setting that already has its
+// default is left as it is
+func (s *Server) resetSettingHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !slices.Contains(settingNames(), name) {
+		writeError(w, r, http.StatusNotFound, "Setting not found")
+		return
+	}
+	reset, err := s.settings.reset(r.Context(), name)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	if reset {
+		s.changes.publish("setting", name, "reset")
+	}
+	s.getSettingsHandler(w, r)
+}
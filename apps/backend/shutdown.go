@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// serve runs the HTTP server on listener until SIGTERM or SIGINT, then shuts down gracefully:
+// it fails readiness, stops accepting connections, releases long-polling clients,
+// waits for in-flight requests, and closes the database pool
+func (s *Server) serve(listener net.Listener, handler http.Handler) error {
+	server := newHTTPServer(s.config.Server, handler)
+	// Long polls would otherwise hold shutdown for up to their full wait
+	server.RegisterOnShutdown(s.changes.close)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	// A second signal kills the process immediately
+	stop()
+
+	s.shuttingDown.Store(true)
+	log.Printf("Shutdown signal received; draining for %s before closing the listener", s.config.Server.ShutdownDelay)
+	time.Sleep(s.config.Server.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("In-flight requests did not finish within %s: %v", s.config.Server.ShutdownTimeout, err)
+		server.Close()
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Server error during shutdown: %v", err)
+	}
+
+	// Let the leader tasks finish and hand the lease to another replica, then save usage and
+	// analytics counted since the last flush while the database is still open
+	s.leader.stop()
+	s.presence.close()
+	s.usage.close()
+	s.redirects.close()
+	s.analytics.close()
+
+	// db is nil in mock mode
+	if s.db != nil {
+		if sqlDB, err := s.db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}
+	log.Println("Server stopped")
+	return nil
+}
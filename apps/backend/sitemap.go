@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// GET /sitemap.xml is every zone's sitemap merged into one document, so search engines find the
+// whole site from one URL instead of a sitemap per zone. Each zone's /sitemap.xml is fetched from
+// its internal URL (a sitemap index is followed to the sitemaps it lists), and the merged document
+// is cached for SITEMAP_CACHE_TTL. A zone that can't be fetched keeps the URLs it had the last
+// time it could be, so one zone being down doesn't drop its pages from search results. When no
+// zone ever could be, the failure is cached too, for SITEMAP_TIMEOUT (the 503's Retry-After), so
+// requests don't queue up behind a fetch each
+
+// sitemapNamespace is the namespace of the Sitemaps protocol's documents
+const sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// Bounds of what is read from the zones
+const (
+	// The protocol allows 50,000 URLs in a sitemap; past that the merged document is cut off
+	sitemapMaxURLs = 50000
+	// A sitemap index's first sitemapMaxChildren sitemaps are fetched, the rest ignored
+	sitemapMaxChildren = 20
+	// Bytes read of each sitemap; the protocol allows 50 MB uncompressed
+	sitemapMaxBytes = 50 << 20
+)
+
+// sitemapURLSet is the merged sitemap GET /sitemap.xml writes
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+}
+
+// zoneSitemap is a sitemap as a zone serves it: a urlset, or a sitemapindex listing other sitemaps
+// The namespace isn't checked, so a zone that leaves it out is still read
+type zoneSitemap struct {
+	XMLName  xml.Name     `xml:""`
+	URLs     []sitemapURL `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// sitemapCache builds the merged sitemap and keeps it for SITEMAP_CACHE_TTL
+type sitemapCache struct {
+	client  *http.Client
+	zones   []zoneTarget
+	ttl     time.Duration // SITEMAP_CACHE_TTL
+	timeout time.Duration // SITEMAP_TIMEOUT, for fetching every zone's sitemap
+
+	mu       sync.Mutex
+	body     []byte
+	builtAt  time.Time               // Zero when nothing is cached
+	lastGood map[string][]sitemapURL // By zone name: the URLs of its last sitemap that could be fetched
+	err      error                   // Why the last build failed, returned until failedAt is old enough
+	failedAt time.Time               // Zero unless the last build failed
+}
+
+// newSitemapCache creates a cache that fetches the sitemaps of zones with client
+func newSitemapCache(client *http.Client, zones []zoneTarget, cfg ZonesConfig) *sitemapCache {
+	return &sitemapCache{
+		client:   client,
+		zones:    zones,
+		ttl:      cfg.SitemapCacheTTL,
+		timeout:  cfg.SitemapTimeout,
+		lastGood: map[string][]sitemapURL{},
+	}
+}
+
+// get returns the merged sitemap, built again once the cached one is older than SITEMAP_CACHE_TTL
+// It fails only when no zone's sitemap could be fetched, now or before; the failure is returned
+// again for SITEMAP_TIMEOUT (or SITEMAP_CACHE_TTL, if shorter) before the zones are tried again
+func (c *sitemapCache) get(ctx context.Context) ([]byte, error) {
+	// Held while building, so a burst of requests after the cache expires fetches the sitemaps once
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.builtAt.IsZero() && time.Since(c.builtAt) < c.ttl {
+		return c.body, nil
+	}
+	if !c.failedAt.IsZero() && time.Since(c.failedAt) < min(c.timeout, c.ttl) {
+		return nil, c.err
+	}
+
+	// Not tied to the request that happens to build it, since the requests waiting get the result too
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.timeout)
+	defer cancel()
+	fetched := make([][]sitemapURL, len(c.zones))
+	group := errgroup.Group{}
+	for i, zone := range c.zones {
+		group.Go(func() error {
+			urls, err := c.fetchZone(ctx, zone)
+			if err != nil {
+				log.Printf("Failed to fetch the sitemap of %s: %v", zone.Name, err)
+				return nil
+			}
+			fetched[i] = urls
+			return nil
+		})
+	}
+	group.Wait()
+
+	// Every zone's URLs are kept before merging, since the merge may stop early
+	var sources [][]sitemapURL
+	for i, zone := range c.zones {
+		if fetched[i] != nil {
+			c.lastGood[zone.Name] = fetched[i]
+		}
+		if urls := c.lastGood[zone.Name]; urls != nil {
+			sources = append(sources, urls)
+		}
+	}
+	if len(sources) == 0 {
+		c.err, c.failedAt = fmt.Errorf("no zone's sitemap could be fetched"), time.Now()
+		return nil, c.err
+	}
+
+	set := sitemapURLSet{XMLNS: sitemapNamespace}
+	seen := map[string]bool{}
+merge:
+	for _, urls := range sources {
+		for _, u := range urls {
+			if seen[u.Loc] {
+				continue
+			}
+			if len(set.URLs) == sitemapMaxURLs {
+				log.Printf("The merged sitemap has more than %d URLs; the rest are left out", sitemapMaxURLs)
+				break merge
+			}
+			seen[u.Loc] = true
+			set.URLs = append(set.URLs, u)
+		}
+	}
+
+	data, err := xml.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	c.body = append([]byte(xml.Header), data...)
+	c.builtAt, c.failedAt = time.Now(), time.Time{}
+	return c.body, nil
+}
+
+// fetchZone returns the URLs in zone's sitemap
+// A sitemap index's sitemaps are fetched from the zone too, at the path their loc gives, since
+// their locs are public URLs the backend may not be able to reach
+func (c *sitemapCache) fetchZone(ctx context.Context, zone zoneTarget) ([]sitemapURL, error) {
+	base, err := url.Parse(zone.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zone URL: %w", err)
+	}
+	sitemap, err := c.fetch(ctx, zone.URL+"/sitemap.xml")
+	if err != nil {
+		return nil, err
+	}
+	switch sitemap.XMLName.Local {
+	case "urlset":
+		return append([]sitemapURL{}, sitemap.URLs...), nil
+	case "sitemapindex":
+	default:
+		return nil, fmt.Errorf("not a sitemap: <%s>", sitemap.XMLName.Local)
+	}
+
+	urls := []sitemapURL{}
+	for i, child := range sitemap.Sitemaps {
+		if i == sitemapMaxChildren {
+			log.Printf("The sitemap index of %s lists more than %d sitemaps; the rest are left out", zone.Name, sitemapMaxChildren)
+			break
+		}
+		loc, err := url.Parse(child.Loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sitemap URL %q: %w", child.Loc, err)
+		}
+		childURL := *base
+		childURL.Path, childURL.RawPath, childURL.RawQuery = loc.Path, loc.RawPath, loc.RawQuery
+		childSitemap, err := c.fetch(ctx, childURL.String())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", loc.Path, err)
+		}
+		urls = append(urls, childSitemap.URLs...)
+	}
+	return urls, nil
+}
+
+// fetch reads the sitemap at target
+func (c *sitemapCache) fetch(ctx context.Context, target string) (zoneSitemap, error) {
+	var sitemap zoneSitemap
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return sitemap, err
+	}
+	req.Header.Set("Accept", "application/xml")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return sitemap, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return sitemap, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, sitemapMaxBytes)).Decode(&sitemap); err != nil {
+		return sitemap, fmt.Errorf("invalid sitemap: %w", err)
+	}
+	return sitemap, nil
+}
+
+// sitemapHandler responds to GET /sitemap.xml
+// The zones' sitemaps merged, each URL once; 503 when no zone's sitemap could ever be fetched
+func (s *Server) sitemapHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := s.sitemap.get(r.Context())
+	if err != nil {
+		w.Header().Set("Retry-After", strconv.Itoa(int(s.config.Zones.SitemapTimeout.Seconds())+1))
+		writeError(w, r, http.StatusServiceUnavailable, fmt.Sprintf("Sitemap unavailable: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
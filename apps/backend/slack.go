@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// The Slack app lets operators act from a channel instead of opening zone-admin:
+// slash commands (/flags toggle <key>, /zones status) are POSTed to /api/slack/commands,
+// signed with the app's signing secret, and zone incidents are posted to a channel
+// through an incoming webhook
+
+const (
+	// maxSlackRequestAge rejects replayed commands; Slack's own recommendation
+	maxSlackRequestAge = 5 * time.Minute
+
+	// slackNotifyTimeout bounds one channel notification
+	slackNotifyTimeout = 10 * time.Second
+)
+
+// slackResponse is the reply to a slash command
+// "ephemeral" replies are only shown to the user who ran the command, "in_channel" ones to everybody
+type slackResponse struct {
+	ResponseType string `json:"response_type"`
+	Text         string `json:"text"`
+}
+
+// slackCommandHandler responds to POST /api/slack/commands
+// Slack shows anything but a 200 as a failed command, so mistakes in the command get a
+// 200 with an explanation; only unsigned requests are refused
+func (a *restAPI) slackCommandHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodySize))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+	if !validSlackSignature(a.slack.SigningSecret, timestamp, body, r.Header.Get("X-Slack-Signature"), time.Now()) {
+		writeError(w, r, http.StatusUnauthorized, "Invalid Slack signature")
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid slash command payload")
+		return
+	}
+	user := form.Get("user_id")
+	if len(a.slack.AllowedUsers) > 0 && !slices.Contains(a.slack.AllowedUsers, user) {
+		writeJSON(w, r, http.StatusOK, slackResponse{ResponseType: "ephemeral", Text: "You aren't allowed to use this command."})
+		return
+	}
+
+	args := strings.Fields(form.Get("text"))
+	var reply slackResponse
+	switch form.Get("command") {
+	case "/flags":
+		reply = a.slackFlagsCommand(r.Context(), user, args)
+	case "/zones":
+		reply = a.slackZonesCommand(args)
+	default:
+		reply = slackResponse{ResponseType: "ephemeral", Text: fmt.Sprintf("Unknown command %s", form.Get("command"))}
+	}
+	writeJSON(w, r, http.StatusOK, reply)
+}
+
+// slackFlagsCommand runs /flags toggle <key>, which flips the flag and tells the channel
+func (a *restAPI) slackFlagsCommand(ctx context.Context, user string, args []string) slackResponse {
+	if len(args) != 2 || args[0] != "toggle" {
+		return slackResponse{ResponseType: "ephemeral", Text: "Usage: /flags toggle <key>"}
+	}
+	key := args[1]
+
+	flag, err := a.flags.get(ctx, key)
+	if err == nil {
+		enabled := !flag.Enabled
+		flag, err = a.flags.update(ctx, key, models.UpdateFeatureFlagRequest{Enabled: &enabled})
+	}
+	if errors.Is(err, errNotFound) {
+		return slackResponse{ResponseType: "ephemeral", Text: fmt.Sprintf("No feature flag named `%s`", key)}
+	}
+	if err != nil {
+		return slackResponse{ResponseType: "ephemeral", Text: fmt.Sprintf("Failed to toggle `%s`: %v", key, err)}
+	}
+
+	state := "off"
+	if flag.Enabled {
+		state = "on"
+	}
+	log.Printf("Slack user %s turned feature flag %s %s", user, key, state)
+	return slackResponse{ResponseType: "in_channel", Text: fmt.Sprintf("<@%s> turned `%s` %s", user, key, state)}
+}
+
+// slackZonesCommand runs /zones status, which lists each zone's health
+func (a *restAPI) slackZonesCommand(args []string) slackResponse {
+	if len(args) != 1 || args[0] != "status" {
+		return slackResponse{ResponseType: "ephemeral", Text: "Usage: /zones status"}
+	}
+	var lines []string
+	for _, zone := range a.zones.Statuses() {
+		lines = append(lines, fmt.Sprintf("%s *%s* is %s: %s", slackStatusEmoji(zone.Status), zone.Name, zone.Status, zone.Message))
+	}
+	return slackResponse{ResponseType: "ephemeral", Text: strings.Join(lines, "\n")}
+}
+
+// slackStatusEmoji is the emoji shown next to a zone status
+func slackStatusEmoji(status string) string {
+	switch status {
+	case "healthy":
+		return ":large_green_circle:"
+	case "degraded":
+		return ":large_yellow_circle:"
+	case "maintenance":
+		return ":large_blue_circle:"
+	default:
+		return ":red_circle:"
+	}
+}
+
+// validSlackSignature checks X-Slack-Signature ("v0=" and the hex HMAC-SHA256 of
+// "v0:<timestamp>:<body>" with the signing secret) and that the request is recent
+func validSlackSignature(secret, timestamp string, body []byte, signature string, now time.Time) bool {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > maxSlackRequestAge || age < -maxSlackRequestAge {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// slackNotifier posts zone incidents and recoveries to the SLACK_WEBHOOK_URL channel
+// Its methods do nothing on a nil notifier, which is what an empty SLACK_WEBHOOK_URL gives
+type slackNotifier struct {
+	url    string
+	client *http.Client
+
+	// Every replica that checks the zones sees a transition, so only the leader posts it
+	leader *leaderElector
+}
+
+// newSlackNotifier returns a notifier for webhookURL (SLACK_WEBHOOK_URL), or nil when it is empty
+func newSlackNotifier(webhookURL string, leader *leaderElector) *slackNotifier {
+	if webhookURL == "" {
+		return nil
+	}
+	return &slackNotifier{
+		url:    webhookURL,
+		client: &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport), Timeout: slackNotifyTimeout},
+		leader: leader,
+	}
+}
+
+// zoneChanged posts a zone that stopped being healthy or is healthy again, in the background
+func (n *slackNotifier) zoneChanged(previous string, status models.ZoneStatus) {
+	if n == nil || !n.leader.isLeading() {
+		return
+	}
+	var text string
+	switch zoneTransitionEvent(previous, status.Status) {
+	case "zone.incident":
+		text = fmt.Sprintf("%s *%s* is %s (was %s): %s", slackStatusEmoji(status.Status), status.Name, status.Status, previous, status.Message)
+	case "zone.recovered":
+		text = fmt.Sprintf("%s *%s* has recovered (was %s)", slackStatusEmoji(status.Status), status.Name, previous)
+	default:
+		return
+	}
+	go func() {
+		if err := n.post(text); err != nil {
+			log.Printf("Failed to post zone %s to Slack: %v", status.Name, err)
+		}
+	}()
+}
+
+// post sends a message to the incoming webhook
+func (n *slackNotifier) post(text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Slack responded %s", resp.Status)
+	}
+	return nil
+}
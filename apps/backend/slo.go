@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+)
+
+// sloBurnWindows are the lookbacks burn rates are reported for: the usual
+// multiwindow alerting pair, where a fast 1h burn pages and a slower 6h one is a ticket
+var sloBurnWindows = []struct {
+	name     string
+	duration time.Duration
+}{{"1h", time.Hour}, {"6h", 6 * time.Hour}}
+
+// sloCounted reports whether a request counts towards the SLOs; routes are under basePath (BASE_PATH)
+// Probes, CORS preflights, and unmatched paths don't (the same requests api_usage skips)
+func sloCounted(method, route, basePath string) bool {
+	probe := usageRoutesIgnored[strings.TrimPrefix(route, basePath)]
+	return route != "" && !probe && method != http.MethodOptions
+}
+
+// sloLatencyMeasured reports whether a route's latency counts; long polls are slow by design
+func sloLatencyMeasured(route string) bool {
+	return !strings.HasSuffix(route, "/changes")
+}
+
+// sloSlow reports whether a request missed the latency threshold (SLO_LATENCY_THRESHOLD)
+func sloSlow(route string, elapsed, threshold time.Duration) bool {
+	return sloLatencyMeasured(route) && elapsed > threshold
+}
+
+// sloCounts are request counts for one minute, or summed over many
+type sloCounts struct {
+	requests     int64 // Every counted request (availability)
+	serverErrors int64
+	measured     int64 // Requests whose latency counts
+	slow         int64
+}
+
+func (c *sloCounts) add(other sloCounts) {
+	c.requests += other.requests
+	c.serverErrors += other.serverErrors
+	c.measured += other.measured
+	c.slow += other.slow
+}
+
+// sloMinutes is how many one-minute buckets are kept: enough for the longest burn window
+const sloMinutes = 6 * 60
+
+// sloTracker counts this process's requests per minute for burn rates, plus a
+// running total used as the window when there is no api_usage history (mock mode)
+type sloTracker struct {
+	basePath  string        // BASE_PATH
+	threshold time.Duration // SLO_LATENCY_THRESHOLD
+
+	mu      sync.Mutex
+	buckets [sloMinutes]sloCounts
+	minutes [sloMinutes]int64 // Unix minute each bucket holds; older buckets are reset on reuse
+	total   sloCounts
+}
+
+// newSLOTracker creates an empty tracker for the routes and latency threshold in cfg
+func newSLOTracker(cfg Config) *sloTracker {
+	return &sloTracker{basePath: cfg.Server.BasePath, threshold: cfg.SLO.LatencyThreshold}
+}
+
+// observe counts one finished request
+func (t *sloTracker) observe(method, route string, status int, elapsed time.Duration) {
+	if !sloCounted(method, route, t.basePath) {
+		return
+	}
+	c := sloCounts{requests: 1}
+	if status >= http.StatusInternalServerError {
+		c.serverErrors = 1
+	}
+	if sloLatencyMeasured(route) {
+		c.measured = 1
+		if elapsed > t.threshold {
+			c.slow = 1
+		}
+	}
+
+	minute := time.Now().Unix() / 60
+	i := minute % sloMinutes
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.minutes[i] != minute {
+		t.minutes[i] = minute
+		t.buckets[i] = sloCounts{}
+	}
+	t.buckets[i].add(c)
+	t.total.add(c)
+}
+
+// since sums the buckets covering the last d (at most sloMinutes)
+func (t *sloTracker) since(d time.Duration) sloCounts {
+	now := time.Now().Unix() / 60
+	oldest := now - int64(d/time.Minute) + 1
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var sum sloCounts
+	for i, minute := range t.minutes {
+		if minute >= oldest && minute <= now {
+			sum.add(t.buckets[i])
+		}
+	}
+	return sum
+}
+
+// sinceStart returns everything counted since the process started
+func (t *sloTracker) sinceStart() sloCounts {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.total
+}
+
+// sloWindowFromUsage sums the api_usage rows of the last SLO_WINDOW_DAYS days (today included)
+// They cover every replica, but miss counts not flushed yet (see USAGE_FLUSH_INTERVAL)
+func (s *Server) sloWindowFromUsage(ctx context.Context) (sloCounts, error) {
+	var rows []struct {
+		Route        string
+		Requests     int64
+		ServerErrors int64
+		SlowRequests int64
+	}
+	from := time.Now().UTC().AddDate(0, 0, 1-s.config.SLO.WindowDays).Format(time.DateOnly)
+	err := s.db.WithContext(ctx).Model(&models.APIUsage{}).
+		Select("route, SUM(requests) AS requests, SUM(server_errors) AS server_errors, SUM(slow_requests) AS slow_requests").
+		Where("day >= ?", from).
+		Group("route").
+		Scan(&rows).Error
+	if err != nil {
+		return sloCounts{}, err
+	}
+
+	var window sloCounts
+	for _, row := range rows {
+		c := sloCounts{requests: row.Requests, serverErrors: row.ServerErrors, slow: row.SlowRequests}
+		if sloLatencyMeasured(row.Route) {
+			c.measured = row.Requests
+		}
+		window.add(c)
+	}
+	return window, nil
+}
+
+// sloObjective builds one objective from its good/total counts over the window and burn windows
+func sloObjective(name, description string, target float64, window sloCounts, burn map[string]sloCounts,
+	counts func(sloCounts) (total, bad int64)) models.SLOObjective {
+	budget := 1 - target
+
+	total, bad := counts(window)
+	objective := models.SLOObjective{
+		Name:        name,
+		Description: description,
+		Target:      target,
+		Window:      models.SLOWindow{Total: total, Good: total - bad, SLI: 1, ErrorBudgetRemaining: 1},
+		BurnRates:   map[string]float64{},
+	}
+	if total > 0 {
+		errorRate := float64(bad) / float64(total)
+		objective.Window.SLI = 1 - errorRate
+		objective.Window.ErrorBudgetRemaining = 1 - errorRate/budget
+	}
+
+	// Burn rate: how many times faster than sustainable the budget is being spent
+	for lookback, c := range burn {
+		rate := 0.0
+		if total, bad := counts(c); total > 0 {
+			rate = float64(bad) / float64(total) / budget
+		}
+		objective.BurnRates[lookback] = rate
+	}
+	return objective
+}
+
+// selfSLOHandler responds to GET /api/slo/self
+// The window comes from api_usage when there is a database, otherwise from this
+// process since it started; burn rates always come from this process
+func (s *Server) selfSLOHandler(w http.ResponseWriter, r *http.Request) {
+	report := models.SLOReport{
+		Service:     "backend-api",
+		WindowDays:  s.config.SLO.WindowDays,
+		GeneratedAt: time.Now().UTC(),
+	}
+
+	var window sloCounts
+	if s.usage != nil {
+		var err error
+		if window, err = s.sloWindowFromUsage(r.Context()); err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+			return
+		}
+		report.Source = "api_usage"
+	} else {
+		window = s.slo.sinceStart()
+		report.Source = "memory"
+	}
+
+	burn := map[string]sloCounts{}
+	for _, lookback := range sloBurnWindows {
+		burn[lookback.name] = s.slo.since(lookback.duration)
+	}
+
+	availability := sloObjective("availability", "Requests answered without a 5xx status",
+		s.config.SLO.AvailabilityTarget, window, burn,
+		func(c sloCounts) (int64, int64) { return c.requests, c.serverErrors })
+	latency := sloObjective("latency", fmt.Sprintf("Requests finished within %s (long polls excluded)", s.config.SLO.LatencyThreshold),
+		s.config.SLO.LatencyTarget, window, burn,
+		func(c sloCounts) (int64, int64) { return c.measured, c.slow })
+	latency.Threshold = s.config.SLO.LatencyThreshold.String()
+
+	report.Objectives = []models.SLOObjective{availability, latency}
+	writeJSON(w, r, http.StatusOK, report)
+}
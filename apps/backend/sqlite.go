@@ -0,0 +1,36 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// DB_DRIVER=sqlite stores everything in an embedded SQLite database (pure Go, no cgo),
+// so the backend runs without provisioning Postgres. It serves the same models and
+// migrations; what needs Postgres is skipped:
+//
+//   - flag change notifications to other replicas (LISTEN/NOTIFY), since SQLite is single-process
+//   - read replicas (DB_REPLICA_HOSTS)
+//   - the migration advisory lock, since only one process opens the file
+
+// sqliteDSN adds the connection pragmas to path (":memory:" for a database that lives
+// only as long as the process)
+// busy_timeout makes a writer wait for a lock instead of failing with SQLITE_BUSY
+func sqliteDSN(path string) string {
+	pragmas := []string{"_pragma=busy_timeout(5000)", "_pragma=foreign_keys(1)"}
+	if path != ":memory:" {
+		// Readers don't block the writer (and vice versa) with a write-ahead log
+		pragmas = append(pragmas, "_pragma=journal_mode(WAL)")
+	}
+	return path + "?" + strings.Join(pragmas, "&")
+}
+
+// configureSQLitePool keeps a single connection open forever
+// SQLite allows one writer at a time, and every connection to ":memory:" would
+// otherwise get its own empty database
+func configureSQLitePool(sqlDB *sql.DB) {
+	sqlDB.SetMaxOpenConns(1)
+	sqlDB.SetMaxIdleConns(1)
+	sqlDB.SetConnMaxLifetime(0)
+	sqlDB.SetConnMaxIdleTime(0)
+}
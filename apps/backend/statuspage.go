@@ -0,0 +1,31 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// statusPageFiles is the status page compiled into the binary, so it keeps working
+// when the zone-admin app (the usual dashboard) is the thing that's down
+//
+//go:embed statuspage
+var statusPageFiles embed.FS
+
+// statusPageHandler serves the status page at /dashboard/ under basePath (BASE_PATH)
+// The page is static; its script reads zone status, flags, and deployments from the public API
+// with relative URLs, so it works under any base path
+func statusPageHandler(basePath string) http.Handler {
+	files, err := fs.Sub(statusPageFiles, "statuspage")
+	if err != nil {
+		panic(err) // The directory is embedded above, so this can't happen
+	}
+	fileServer := http.StripPrefix(basePath+"/dashboard", http.FileServerFS(files))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Embedded files have no modification time, so make browsers revalidate rather than guess
+		w.Header().Set("Cache-Control", "no-cache")
+		// Only the page's own script, styles, and API calls
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+		fileServer.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,126 @@
+// Status page: reads the public API and refreshes every few seconds
+// Paths are relative to /dashboard/, so the page works wherever the API is mounted
+"use strict";
+
+const REFRESH_MS = 10000;
+const INCIDENT_LIMIT = 10;
+
+async function getJSON(path) {
+  const response = await fetch(path, { headers: { Accept: "application/json" } });
+  if (!response.ok) {
+    throw new Error(`${path}: ${response.status} ${await response.text()}`);
+  }
+  return response.json();
+}
+
+function cell(text, className) {
+  const td = document.createElement("td");
+  if (className) {
+    const badge = document.createElement("span");
+    badge.className = `badge ${className}`;
+    badge.textContent = text;
+    td.appendChild(badge);
+  } else {
+    td.textContent = text;
+  }
+  return td;
+}
+
+// fill replaces a table's rows; rows are arrays of cells
+function fill(id, rows, emptyText) {
+  const tbody = document.querySelector(`#${id} tbody`);
+  tbody.replaceChildren();
+  if (rows.length === 0) {
+    const td = cell(emptyText);
+    td.colSpan = document.querySelectorAll(`#${id} th`).length;
+    td.className = "empty";
+    rows = [[td]];
+  }
+  for (const cells of rows) {
+    const tr = document.createElement("tr");
+    tr.append(...cells);
+    tbody.appendChild(tr);
+  }
+}
+
+// failed fills a table with the error that stopped it from loading
+function failed(id, err) {
+  fill(id, [], `Failed to load: ${err.message}`);
+  document.querySelector(`#${id} tbody td`).className = "error";
+}
+
+function when(timestamp) {
+  return timestamp ? new Date(timestamp).toLocaleString() : "-";
+}
+
+// Maintenance is planned, so it is neither good nor bad
+function healthClass(status) {
+  if (status === "maintenance") {
+    return "";
+  }
+  return status === "healthy" || status === "success" ? "good" : "bad";
+}
+
+// activeUsers is a zone's live active users, or "-" when the count can't be read
+async function activeUsers(zone) {
+  try {
+    const { activeUsers } = await getJSON(`../api/zones/${encodeURIComponent(zone)}/active-users`);
+    return String(activeUsers);
+  } catch {
+    return "-";
+  }
+}
+
+async function loadZones() {
+  const { zones } = await getJSON("../api/zones/status");
+  const active = await Promise.all(zones.map((zone) => activeUsers(zone.name)));
+  fill("zones", zones.map((zone, i) => [
+    cell(zone.name),
+    cell(zone.status, healthClass(zone.status)),
+    cell(active[i]),
+    cell(zone.message || ""),
+    cell(when(zone.lastCheck)),
+  ]), "No zones configured");
+}
+
+// An incident is a failed deployment, or one after which the zone wasn't healthy
+async function loadIncidents() {
+  const events = await getJSON("../api/deployments?pageSize=100");
+  const incidents = events
+    .filter((e) => ["failure", "error"].includes(e.status) || (e.healthStatus && e.healthStatus !== "healthy"))
+    .slice(0, INCIDENT_LIMIT);
+  fill("incidents", incidents.map((e) => {
+    const deployment = document.createElement("a");
+    deployment.href = e.url;
+    deployment.textContent = `${e.environment || e.eventType} ${e.ref}@${(e.sha || "").slice(0, 7)}`;
+    const td = cell("");
+    td.appendChild(deployment);
+    return [
+      cell(when(e.createdAt)),
+      cell(e.zone),
+      td,
+      cell(e.status, healthClass(e.status)),
+      cell(e.healthStatus || "-", e.healthStatus ? healthClass(e.healthStatus) : ""),
+    ];
+  }), "No recent incidents");
+}
+
+async function loadFlags() {
+  const flags = await getJSON("../api/feature-flags");
+  fill("flags", flags.map((flag) => [
+    cell(flag.key),
+    cell(flag.name),
+    cell(flag.enabled ? "on" : "off", flag.enabled ? "good" : ""),
+    cell(when(flag.updatedAt)),
+  ]), "No feature flags");
+}
+
+// Each section loads on its own, so a database outage still leaves the zone status visible
+async function refresh() {
+  const sections = { zones: loadZones, incidents: loadIncidents, flags: loadFlags };
+  await Promise.all(Object.entries(sections).map(([id, load]) => load().catch((err) => failed(id, err))));
+  document.getElementById("updated").textContent = `Updated ${new Date().toLocaleTimeString()}`;
+}
+
+refresh();
+setInterval(refresh, REFRESH_MS);
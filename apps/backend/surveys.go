@@ -0,0 +1,512 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Surveys are in-product polls, such as an NPS question, managed from zone-admin through
+// /api/surveys. While a survey is active, a zone asks GET /api/surveys/active which survey (if
+// any) to show a unit (a user ID, or a visitor ID for anonymous traffic), posts the unit's answers
+// to POST /api/surveys/{key}/responses, and GET /api/surveys/{key}/results totals them. A survey
+// targets zones, audience segments the zone puts the viewer in (e.g. "pro"), units with a flag
+// on, and a sample of those units, bucketed like experiment units so a unit stays in or out
+
+// surveyTransitions are the status changes allowed, from each status to the next
+var surveyTransitions = map[string]string{"draft": "active", "active": "closed"}
+
+// surveyScoreRanges are the scores "nps" and "rating" questions accept, lowest and highest
+var surveyScoreRanges = map[string][2]int{"nps": {0, 10}, "rating": {1, 5}}
+
+// surveyResponseFilterFields are the response fields ?filter= and ?orderby= accept
+var surveyResponseFilterFields = filterFields{
+	"id":        {Column: "id", Kind: filterNumber},
+	"unit":      {Column: "unit", Kind: filterString},
+	"zone":      {Column: "zone", Kind: filterString},
+	"createdAt": {Column: "created_at", Kind: filterTime},
+}
+
+// checkSurvey returns the problems with a survey that the validate tags can't see: repeated
+// question or option keys, options on questions without any, zones that don't exist, and a
+// badly formed flag. A flag that doesn't exist yet is allowed; nobody sees the survey until it
+// is created and on
+func (s *Server) checkSurvey(survey models.Survey) []models.FieldError {
+	var fieldErrors []models.FieldError
+	questions := map[string]bool{}
+	for i, question := range survey.Questions {
+		if questions[question.Key] {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: fmt.Sprintf("questions[%d].key", i), Message: "must not repeat another question's key"})
+		}
+		questions[question.Key] = true
+		if question.Type != "choice" && question.Type != "multiple" && len(question.Options) > 0 {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: fmt.Sprintf("questions[%d].options", i), Message: "must be empty unless type is choice or multiple"})
+		}
+		options := map[string]bool{}
+		for j, option := range question.Options {
+			if options[option.Key] {
+				fieldErrors = append(fieldErrors, models.FieldError{Field: fmt.Sprintf("questions[%d].options[%d].key", i, j), Message: "must not repeat another option's key"})
+			}
+			options[option.Key] = true
+		}
+	}
+	for i, name := range survey.Zones {
+		if _, ok := s.findZone(name); !ok {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: fmt.Sprintf("zones[%d]", i), Message: "must be a zone (" + s.zoneNames() + ")"})
+		}
+	}
+	if survey.FlagKey != "" && !flagKeyPattern.MatchString(survey.FlagKey) {
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "flag", Message: "must contain only lowercase letters, digits, and underscores"})
+	}
+	return fieldErrors
+}
+
+// checkAnswers returns the problems with answers to survey: answers to questions it doesn't have
+// or to one question twice, answers of the wrong kind, and required questions left out. It
+// drops what doesn't belong to each answer's type, e.g. text sent with a score
+func checkAnswers(survey models.Survey, answers []models.SurveyAnswer) []models.FieldError {
+	var fieldErrors []models.FieldError
+	answered := map[string]bool{}
+	for i := range answers {
+		answer := &answers[i]
+		field := fmt.Sprintf("answers[%d]", i)
+		index := slices.IndexFunc(survey.Questions, func(q models.SurveyQuestion) bool { return q.Key == answer.Question })
+		if index < 0 {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: field + ".question", Message: "must be a question of the survey"})
+			continue
+		}
+		if answered[answer.Question] {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: field + ".question", Message: "must not repeat another answer's question"})
+			continue
+		}
+		answered[answer.Question] = true
+
+		question := survey.Questions[index]
+		switch question.Type {
+		case "nps", "rating":
+			scores := surveyScoreRanges[question.Type]
+			if answer.Score == nil || *answer.Score < scores[0] || *answer.Score > scores[1] {
+				fieldErrors = append(fieldErrors, models.FieldError{Field: field + ".score", Message: fmt.Sprintf("must be between %d and %d", scores[0], scores[1])})
+			}
+			answer.Options, answer.Text = nil, ""
+		case "choice", "multiple":
+			keys := make([]string, len(question.Options))
+			for j, option := range question.Options {
+				keys[j] = option.Key
+			}
+			valid := len(answer.Options) > 0 && (question.Type == "multiple" || len(answer.Options) == 1)
+			for j, option := range answer.Options {
+				valid = valid && slices.Contains(keys, option) && !slices.Contains(answer.Options[:j], option)
+			}
+			if !valid {
+				message := "must be one of the question's options (" + strings.Join(keys, ", ") + ")"
+				if question.Type == "multiple" {
+					message = "must be some of the question's options (" + strings.Join(keys, ", ") + "), each once"
+				}
+				fieldErrors = append(fieldErrors, models.FieldError{Field: field + ".options", Message: message})
+			}
+			answer.Score, answer.Text = nil, ""
+		case "text":
+			if strings.TrimSpace(answer.Text) == "" {
+				fieldErrors = append(fieldErrors, models.FieldError{Field: field + ".text", Message: "is required"})
+			}
+			answer.Score, answer.Options = nil, nil
+		}
+	}
+	for _, question := range survey.Questions {
+		if question.Required && !answered[question.Key] {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: "answers", Message: "must answer " + question.Key})
+		}
+	}
+	return fieldErrors
+}
+
+// listSurveysHandler responds to GET /api/surveys
+// Every survey, newest first
+func (s *Server) listSurveysHandler(w http.ResponseWriter, r *http.Request) {
+	var surveys []models.Survey
+	if err := s.db.WithContext(r.Context()).Order("id DESC").Find(&surveys).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, surveys)
+}
+
+// createSurveyHandler responds to POST /api/surveys
+// New surveys are drafts; nobody sees them until they are made active
+func (s *Server) createSurveyHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateSurveyRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	survey := models.Survey{
+		Key:       req.Key,
+		Title:     req.Title,
+		Status:    "draft",
+		Questions: models.JSONList[models.SurveyQuestion](req.Questions),
+		Zones:     models.StringList(req.Zones),
+		Segments:  models.StringList(req.Segments),
+		FlagKey:   req.Flag,
+		Sample:    req.Sample,
+	}
+	if survey.Zones == nil {
+		survey.Zones = models.StringList{}
+	}
+	if survey.Segments == nil {
+		survey.Segments = models.StringList{}
+	}
+	if survey.Sample == 0 {
+		survey.Sample = 100
+	}
+	if fieldErrors := s.checkSurvey(survey); len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+
+	var existing int64
+	if err := s.db.WithContext(r.Context()).Model(&models.Survey{}).Where(byKey(req.Key)).Count(&existing).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	if existing > 0 {
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("A survey with key %s already exists", req.Key))
+		return
+	}
+	if err := s.db.WithContext(r.Context()).Create(&survey).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to create survey: %v", err))
+		return
+	}
+	log.Printf("Survey %s created with %d questions", survey.Key, len(survey.Questions))
+
+	w.Header().Set("Location", fmt.Sprintf("%s/api/surveys/%s", s.config.Server.BasePath, survey.Key))
+	writeJSON(w, r, http.StatusCreated, survey)
+}
+
+// getSurveyHandler responds to GET /api/surveys/{key}
+func (s *Server) getSurveyHandler(w http.ResponseWriter, r *http.Request) {
+	if survey, ok := findBy[models.Survey](w, r, s.db, "Survey", byKey(r.PathValue("key"))); ok {
+		writeJSON(w, r, http.StatusOK, survey)
+	}
+}
+
+// updateSurveyHandler responds to PATCH /api/surveys/{key}
+// Setting the status starts ("active") or ends ("closed") the survey. The questions are fixed
+// once it has started, since responses already given answer them
+func (s *Server) updateSurveyHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateSurveyRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	survey, ok := findBy[models.Survey](w, r, s.db, "Survey", byKey(r.PathValue("key")))
+	if !ok {
+		return
+	}
+
+	previousStatus := survey.Status
+	if req.Questions != nil && survey.Status != "draft" {
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("Survey %s has started, so its questions can't change", survey.Key))
+		return
+	}
+	if req.Status != nil && *req.Status != survey.Status {
+		if surveyTransitions[survey.Status] != *req.Status {
+			writeError(w, r, http.StatusConflict, fmt.Sprintf("Survey %s can't go from %s to %s", survey.Key, survey.Status, *req.Status))
+			return
+		}
+		now := time.Now()
+		if *req.Status == "active" {
+			survey.StartedAt = &now
+		} else {
+			survey.ClosedAt = &now
+		}
+		survey.Status = *req.Status
+	}
+
+	if req.Title != nil {
+		survey.Title = *req.Title
+	}
+	if req.Questions != nil {
+		survey.Questions = models.JSONList[models.SurveyQuestion](req.Questions)
+	}
+	if req.Zones != nil {
+		survey.Zones = models.StringList(req.Zones)
+	}
+	if req.Segments != nil {
+		survey.Segments = models.StringList(req.Segments)
+	}
+	if req.Flag != nil {
+		survey.FlagKey = *req.Flag
+	}
+	if req.Sample != nil {
+		survey.Sample = *req.Sample
+	}
+	if fieldErrors := s.checkSurvey(survey); len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+	if err := s.db.WithContext(r.Context()).Save(&survey).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to update survey: %v", err))
+		return
+	}
+	if survey.Status != previousStatus {
+		log.Printf("Survey %s is %s", survey.Key, survey.Status)
+	}
+	writeJSON(w, r, http.StatusOK, survey)
+}
+
+// deleteSurveyHandler responds to DELETE /api/surveys/{key}
+// Its responses go with it
+func (s *Server) deleteSurveyHandler(w http.ResponseWriter, r *http.Request) {
+	survey, ok := findBy[models.Survey](w, r, s.db, "Survey", byKey(r.PathValue("key")))
+	if !ok {
+		return
+	}
+	err := s.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("survey_id = ?", survey.ID).Delete(&models.SurveyResponse{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&survey).Error
+	})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "Survey deleted successfully"})
+}
+
+// getActiveSurveyHandler responds to GET /api/surveys/active?unit=&zone=&segment=
+// The newest active survey the unit is targeted by and hasn't responded to, or 204 when there
+// is none. ?segment= may be repeated for a viewer in several segments; a survey with segments
+// is only shown to viewers in one of them
+func (s *Server) getActiveSurveyHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	unit, zone, segments := query.Get("unit"), query.Get("zone"), query["segment"]
+	if unit == "" {
+		writeError(w, r, http.StatusBadRequest, "unit is required")
+		return
+	}
+	if _, ok := s.findZone(zone); zone != "" && !ok {
+		writeError(w, r, http.StatusBadRequest, "Unknown zone "+zone+" (expected one of "+s.zoneNames()+")")
+		return
+	}
+
+	var surveys []models.Survey
+	if err := s.db.WithContext(r.Context()).Where("status = ?", "active").Order("id DESC").Find(&surveys).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	// Zones and segments are JSON lists, so they are matched here rather than in SQL; there are
+	// only ever a few active surveys
+	var targeted []models.Survey
+	for _, survey := range surveys {
+		if zone != "" && len(survey.Zones) > 0 && !slices.Contains(survey.Zones, zone) {
+			continue
+		}
+		if len(survey.Segments) > 0 && !slices.ContainsFunc(segments, func(segment string) bool { return slices.Contains(survey.Segments, segment) }) {
+			continue
+		}
+		if experimentBucket("survey", survey.Key, unit) >= survey.Sample*experimentBuckets/100 {
+			continue
+		}
+		if survey.FlagKey != "" {
+			flag, err := s.flags.get(r.Context(), survey.FlagKey)
+			if err != nil && !errors.Is(err, errNotFound) {
+				writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+				return
+			}
+			if err != nil || !flag.Enabled {
+				continue
+			}
+		}
+		targeted = append(targeted, survey)
+	}
+	if len(targeted) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	ids := make([]uint, len(targeted))
+	for i, survey := range targeted {
+		ids[i] = survey.ID
+	}
+	var responded []uint
+	err := s.db.WithContext(r.Context()).Model(&models.SurveyResponse{}).
+		Where("unit = ? AND survey_id IN ?", unit, ids).Pluck("survey_id", &responded).Error
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	for _, survey := range targeted {
+		if !slices.Contains(responded, survey.ID) {
+			writeJSON(w, r, http.StatusOK, survey)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// submitSurveyResponseHandler responds to POST /api/surveys/{key}/responses
+// 409 when the survey isn't active or the unit has already responded to it. Targeting isn't
+// checked again, so a unit that was shown the survey can answer it after its flag went off
+func (s *Server) submitSurveyResponseHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.SubmitSurveyResponseRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	survey, ok := findBy[models.Survey](w, r, s.db, "Survey", byKey(r.PathValue("key")))
+	if !ok {
+		return
+	}
+	if survey.Status != "active" {
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("Survey %s isn't accepting responses", survey.Key))
+		return
+	}
+	fieldErrors := checkAnswers(survey, req.Answers)
+	if _, ok := s.findZone(req.Zone); req.Zone != "" && !ok {
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "zone", Message: "must be a zone (" + s.zoneNames() + ")"})
+	}
+	if len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+
+	response := models.SurveyResponse{SurveyID: survey.ID, Unit: req.Unit, Zone: req.Zone, Answers: models.JSONList[models.SurveyAnswer](req.Answers)}
+	result := s.db.WithContext(r.Context()).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "survey_id"}, {Name: "unit"}},
+		DoNothing: true,
+	}).Create(&response)
+	switch {
+	case result.Error != nil:
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to save response: %v", result.Error))
+		return
+	case result.RowsAffected == 0:
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("%s has already responded to survey %s", req.Unit, survey.Key))
+		return
+	}
+	writeJSON(w, r, http.StatusCreated, response)
+}
+
+// listSurveyResponsesHandler responds to GET /api/surveys/{key}/responses
+// Newest first, narrowed with the shared ?filter= and ?orderby= parameters, e.g. ?filter=zone eq "zone-main"
+func (s *Server) listSurveyResponsesHandler(w http.ResponseWriter, r *http.Request) {
+	listQuery, err := parseListQuery(r, surveyResponseFilterFields)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid query: "+err.Error())
+		return
+	}
+	survey, ok := findBy[models.Survey](w, r, s.db, "Survey", byKey(r.PathValue("key")))
+	if !ok {
+		return
+	}
+	responses := []models.SurveyResponse{}
+	query := s.db.WithContext(r.Context()).Model(&models.SurveyResponse{}).Where("survey_id = ?", survey.ID)
+	if err := listQuery.apply(query, "id DESC").Find(&responses).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	setNextPageLink(w, r, listQuery.page, len(responses))
+	writeJSON(w, r, http.StatusOK, responses)
+}
+
+// getSurveyResultsHandler responds to GET /api/surveys/{key}/results
+// Per question: how many responses answered it, how often each score or option was picked, and
+// for scores the average (and for "nps" questions the Net Promoter Score). Answers are JSON, so
+// the responses are read through a cursor and totalled here rather than in SQL
+func (s *Server) getSurveyResultsHandler(w http.ResponseWriter, r *http.Request) {
+	survey, ok := findBy[models.Survey](w, r, s.db, "Survey", byKey(r.PathValue("key")))
+	if !ok {
+		return
+	}
+
+	results := models.SurveyResults{
+		Survey:    survey.Key,
+		Status:    survey.Status,
+		Questions: make([]models.SurveyQuestionResult, len(survey.Questions)),
+	}
+	index := map[string]int{}
+	sums := make([]int64, len(survey.Questions))
+	promoters := make([]int64, len(survey.Questions))
+	detractors := make([]int64, len(survey.Questions))
+	for i, question := range survey.Questions {
+		index[question.Key] = i
+		result := models.SurveyQuestionResult{Question: question.Key, Type: question.Type}
+		if scores, ok := surveyScoreRanges[question.Type]; ok {
+			result.Counts = map[string]int64{}
+			for score := scores[0]; score <= scores[1]; score++ {
+				result.Counts[strconv.Itoa(score)] = 0
+			}
+		} else if len(question.Options) > 0 {
+			result.Counts = map[string]int64{}
+			for _, option := range question.Options {
+				result.Counts[option.Key] = 0
+			}
+		}
+		results.Questions[i] = result
+	}
+
+	rows, err := openGormCursor[models.SurveyResponse](s.db.WithContext(r.Context()).Model(&models.SurveyResponse{}).Where("survey_id = ?", survey.ID))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var response models.SurveyResponse
+		if err := rows.Scan(&response); err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+			return
+		}
+		results.Responses++
+		for _, answer := range response.Answers {
+			i, ok := index[answer.Question]
+			if !ok {
+				continue
+			}
+			result := &results.Questions[i]
+			result.Answered++
+			switch {
+			case answer.Score != nil:
+				result.Counts[strconv.Itoa(*answer.Score)]++
+				sums[i] += int64(*answer.Score)
+				if *answer.Score >= 9 {
+					promoters[i]++
+				} else if *answer.Score <= 6 {
+					detractors[i]++
+				}
+			case len(answer.Options) > 0:
+				for _, option := range answer.Options {
+					if _, ok := result.Counts[option]; ok {
+						result.Counts[option]++
+					}
+				}
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+
+	for i := range results.Questions {
+		result := &results.Questions[i]
+		if _, ok := surveyScoreRanges[result.Type]; !ok || result.Answered == 0 {
+			continue
+		}
+		average := round4(float64(sums[i]) / float64(result.Answered))
+		result.Average = &average
+		if result.Type == "nps" {
+			nps := round4(float64(promoters[i]-detractors[i]) * 100 / float64(result.Answered))
+			result.NPS = &nps
+		}
+	}
+	writeJSON(w, r, http.StatusOK, results)
+}
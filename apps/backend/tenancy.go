@@ -0,0 +1,471 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"github.com/nextjs-microfrontend/backend/internal/tenant"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Several teams can share one deployment: organizations own projects, and every user and
+// feature flag belongs to one project. resolveTenant works out which project a request acts
+// for, and the repositories scope every query to it (see tenant.Scope), so a project never
+// sees another's data. Requests that don't name a project act for the default one, which
+// owns everything from before projects existed, so single-team deployments work as before
+//
+// A request names its project in one of two ways:
+//   - "Authorization: Bearer mzk_...", a project API key, which may also change the
+//     project's users and flags (see requireProjectToken)
+//   - "X-Project: <organization>/<project>", which needs API_TOKEN when one is set
+
+// projectKeyPrefix starts every project API key, telling it apart from API_TOKEN
+const projectKeyPrefix = "mzk_"
+
+// projectHeader names the project of requests authenticated with API_TOKEN
+const projectHeader = "X-Project"
+
+// tenantSlugPattern is the allowed format for organization and project slugs (e.g. "acme")
+var tenantSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// projectKeyContextKey marks requests authenticated with a project API key
+type projectKeyContextKey struct{}
+
+// hasProjectKey reports whether the request of ctx sent a valid project API key
+func hasProjectKey(ctx context.Context) bool {
+	return ctx.Value(projectKeyContextKey{}) != nil
+}
+
+// hashProjectKey is the token_hash stored for key
+func hashProjectKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// tenantProject is what requests acting for project need to know about it
+func tenantProject(project models.Project) tenant.Project {
+	return tenant.Project{ID: project.ID, Zones: project.Zones}
+}
+
+// resolveTenant puts the project a request acts for in its context
+// An unknown project API key is a 401, and an unknown X-Project a 400; in mock mode there
+// is only the default project
+func (s *Server) resolveTenant(next http.Handler) http.Handler {
+	if s.db == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "+projectKeyPrefix); ok {
+			var project models.Project
+			err := s.db.WithContext(ctx).Joins("JOIN project_api_keys ON project_api_keys.project_id = projects.id").
+				Where("project_api_keys.token_hash = ?", hashProjectKey(projectKeyPrefix+key)).First(&project).Error
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				w.Header().Set("WWW-Authenticate", `Bearer realm="backend-api"`)
+				writeError(w, r, http.StatusUnauthorized, "invalid project API key")
+				return
+			case err != nil:
+				writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+				return
+			}
+			ctx = context.WithValue(tenant.NewContext(ctx, tenantProject(project)), projectKeyContextKey{}, true)
+		} else if name := r.Header.Get(projectHeader); name != "" {
+			authorization := []byte(r.Header.Get("Authorization"))
+			if s.config.API.Token != "" && subtle.ConstantTimeCompare(authorization, []byte("Bearer "+s.config.API.Token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="backend-api"`)
+				writeError(w, r, http.StatusUnauthorized, projectHeader+" needs the API token; use a project API key instead")
+				return
+			}
+			orgSlug, projectSlug, ok := strings.Cut(name, "/")
+			if !ok {
+				writeError(w, r, http.StatusBadRequest, projectHeader+" must be <organization>/<project>")
+				return
+			}
+			var project models.Project
+			err := s.db.WithContext(ctx).Joins("JOIN organizations ON organizations.id = projects.organization_id").
+				Where("organizations.slug = ? AND projects.slug = ?", orgSlug, projectSlug).First(&project).Error
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				writeError(w, r, http.StatusBadRequest, "Unknown project "+name)
+				return
+			case err != nil:
+				writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+				return
+			}
+			ctx = tenant.NewContext(ctx, tenantProject(project))
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// projectZones returns the statuses of the zones ctx's project sees
+func projectZones(ctx context.Context, statuses []models.ZoneStatus) []models.ZoneStatus {
+	project := tenant.FromContext(ctx)
+	visible := make([]models.ZoneStatus, 0, len(statuses))
+	for _, status := range statuses {
+		if project.HasZone(status.Name) {
+			visible = append(visible, status)
+		}
+	}
+	return visible
+}
+
+// flagKeys returns the tenant.FlagKey of every flag in every project
+func flagKeys(ctx context.Context, database *gorm.DB) []string {
+	var flags []models.FeatureFlag
+	database.WithContext(ctx).Select("project_id", "key").Find(&flags)
+	keys := make([]string, len(flags))
+	for i, flag := range flags {
+		keys[i] = tenant.FlagKey(flag.ProjectID, flag.Key)
+	}
+	return keys
+}
+
+// ensureDefaultProject creates the default organization and project (both ID 1) if they are missing
+func ensureDefaultProject(database *gorm.DB) error {
+	rows := []interface{}{
+		&models.Organization{ID: 1, Slug: "default", Name: "Default"},
+		&models.Project{ID: tenant.DefaultProjectID, OrganizationID: 1, Slug: "default", Name: "Default", Zones: models.StringList{}},
+	}
+	for _, row := range rows {
+		result := database.Clauses(clause.OnConflict{DoNothing: true}).Create(row)
+		if result.Error != nil {
+			return fmt.Errorf("failed to create the default project: %w", result.Error)
+		}
+		// Postgres sequences don't move past IDs that were inserted explicitly
+		if result.RowsAffected > 0 && database.Dialector.Name() == "postgres" {
+			table := result.Statement.Table
+			if err := database.Exec("SELECT setval(pg_get_serial_sequence(?, 'id'), (SELECT MAX(id) FROM "+table+"))", table).Error; err != nil {
+				return fmt.Errorf("failed to create the default project: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// dropGlobalUniqueIndexes drops the indexes that made emails and flag keys unique across
+// the deployment, from before they were unique per project
+func dropGlobalUniqueIndexes(database *gorm.DB) error {
+	indexes := []struct {
+		model interface{}
+		name  string
+	}{
+		{&models.User{}, "idx_users_email"},
+		{&models.FeatureFlag{}, "idx_feature_flags_key"},
+	}
+	for _, index := range indexes {
+		if !database.Migrator().HasIndex(index.model, index.name) {
+			continue
+		}
+		if err := database.Migrator().DropIndex(index.model, index.name); err != nil {
+			return fmt.Errorf("failed to drop index %s: %w", index.name, err)
+		}
+	}
+	return nil
+}
+
+// findProject loads the project named by the {org} and {project} path values
+// It writes a 404 (or 500) response and returns false when there is none
+func (s *Server) findProject(w http.ResponseWriter, r *http.Request) (models.Project, bool) {
+	organization, ok := findBy[models.Organization](w, r, s.db, "Organization", "slug = ?", r.PathValue("org"))
+	if !ok {
+		return models.Project{}, false
+	}
+	return findBy[models.Project](w, r, s.db, "Project", "organization_id = ? AND slug = ?", organization.ID, r.PathValue("project"))
+}
+
+// checkProject returns a field error for every zone of project that doesn't exist
+func (s *Server) checkProject(project models.Project) []models.FieldError {
+	var fieldErrors []models.FieldError
+	for i, name := range project.Zones {
+		if _, ok := s.findZone(name); !ok {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: fmt.Sprintf("zones[%d]", i), Message: "must be a zone (" + s.zoneNames() + ")"})
+		}
+	}
+	return fieldErrors
+}
+
+// listOrganizationsHandler responds to GET /api/organizations
+func (s *Server) listOrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+	var organizations []models.Organization
+	if err := s.db.WithContext(r.Context()).Order("slug").Find(&organizations).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, organizations)
+}
+
+// createOrganizationHandler responds to POST /api/organizations
+func (s *Server) createOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateOrganizationRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	var existing int64
+	if err := s.db.WithContext(r.Context()).Model(&models.Organization{}).Where("slug = ?", req.Slug).Count(&existing).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	if existing > 0 {
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("An organization with slug %s already exists", req.Slug))
+		return
+	}
+	organization := models.Organization{Slug: req.Slug, Name: req.Name}
+	if err := s.db.WithContext(r.Context()).Create(&organization).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to create organization: %v", err))
+		return
+	}
+	log.Printf("Organization %s created", organization.Slug)
+
+	w.Header().Set("Location", fmt.Sprintf("%s/api/organizations/%s", s.config.Server.BasePath, organization.Slug))
+	writeJSON(w, r, http.StatusCreated, organization)
+}
+
+// getOrganizationHandler responds to GET /api/organizations/{org}
+func (s *Server) getOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	if organization, ok := findBy[models.Organization](w, r, s.db, "Organization", "slug = ?", r.PathValue("org")); ok {
+		writeJSON(w, r, http.StatusOK, organization)
+	}
+}
+
+// updateOrganizationHandler responds to PATCH /api/organizations/{org}
+func (s *Server) updateOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateOrganizationRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	organization, ok := findBy[models.Organization](w, r, s.db, "Organization", "slug = ?", r.PathValue("org"))
+	if !ok {
+		return
+	}
+
+	if req.Name != nil {
+		organization.Name = *req.Name
+	}
+	if err := s.db.WithContext(r.Context()).Save(&organization).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to update organization: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, organization)
+}
+
+// deleteOrganizationHandler responds to DELETE /api/organizations/{org}
+// Only an organization without projects can be deleted
+func (s *Server) deleteOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	organization, ok := findBy[models.Organization](w, r, s.db, "Organization", "slug = ?", r.PathValue("org"))
+	if !ok {
+		return
+	}
+	var projects int64
+	if err := s.db.WithContext(r.Context()).Model(&models.Project{}).Where("organization_id = ?", organization.ID).Count(&projects).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	if projects > 0 {
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("Organization %s still has %d project(s)", organization.Slug, projects))
+		return
+	}
+	if err := s.db.WithContext(r.Context()).Delete(&organization).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "Organization deleted successfully"})
+}
+
+// listProjectsHandler responds to GET /api/organizations/{org}/projects
+func (s *Server) listProjectsHandler(w http.ResponseWriter, r *http.Request) {
+	organization, ok := findBy[models.Organization](w, r, s.db, "Organization", "slug = ?", r.PathValue("org"))
+	if !ok {
+		return
+	}
+	var projects []models.Project
+	if err := s.db.WithContext(r.Context()).Where("organization_id = ?", organization.ID).Order("slug").Find(&projects).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, projects)
+}
+
+// createProjectHandler responds to POST /api/organizations/{org}/projects
+func (s *Server) createProjectHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateProjectRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	organization, ok := findBy[models.Organization](w, r, s.db, "Organization", "slug = ?", r.PathValue("org"))
+	if !ok {
+		return
+	}
+
+	project := models.Project{OrganizationID: organization.ID, Slug: req.Slug, Name: req.Name, Zones: models.StringList(req.Zones)}
+	if project.Zones == nil {
+		project.Zones = models.StringList{}
+	}
+	if fieldErrors := s.checkProject(project); len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+	var existing int64
+	if err := s.db.WithContext(r.Context()).Model(&models.Project{}).Where("organization_id = ? AND slug = ?", organization.ID, req.Slug).Count(&existing).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	if existing > 0 {
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("Organization %s already has a project with slug %s", organization.Slug, req.Slug))
+		return
+	}
+	if err := s.db.WithContext(r.Context()).Create(&project).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to create project: %v", err))
+		return
+	}
+	log.Printf("Project %s/%s created", organization.Slug, project.Slug)
+
+	w.Header().Set("Location", fmt.Sprintf("%s/api/organizations/%s/projects/%s", s.config.Server.BasePath, organization.Slug, project.Slug))
+	writeJSON(w, r, http.StatusCreated, project)
+}
+
+// getProjectHandler responds to GET /api/organizations/{org}/projects/{project}
+func (s *Server) getProjectHandler(w http.ResponseWriter, r *http.Request) {
+	if project, ok := s.findProject(w, r); ok {
+		writeJSON(w, r, http.StatusOK, project)
+	}
+}
+
+// updateProjectHandler responds to PATCH /api/organizations/{org}/projects/{project}
+func (s *Server) updateProjectHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateProjectRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	project, ok := s.findProject(w, r)
+	if !ok {
+		return
+	}
+
+	if req.Name != nil {
+		project.Name = *req.Name
+	}
+	if req.Zones != nil {
+		project.Zones = models.StringList(req.Zones)
+	}
+	if fieldErrors := s.checkProject(project); len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+	if err := s.db.WithContext(r.Context()).Save(&project).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to update project: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, project)
+}
+
+// deleteProjectHandler responds to DELETE /api/organizations/{org}/projects/{project}
+// The project's users, flags, and API keys are deleted with it; the default project stays
+func (s *Server) deleteProjectHandler(w http.ResponseWriter, r *http.Request) {
+	project, ok := s.findProject(w, r)
+	if !ok {
+		return
+	}
+	if project.ID == tenant.DefaultProjectID {
+		writeError(w, r, http.StatusConflict, "The default project can't be deleted")
+		return
+	}
+
+	var keys []string
+	err := s.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.FeatureFlag{}).Where("project_id = ?", project.ID).Pluck("key", &keys).Error; err != nil {
+			return err
+		}
+		for _, model := range []interface{}{&models.User{}, &models.FeatureFlag{}, &models.ProjectAPIKey{}} {
+			if err := tx.Where("project_id = ?", project.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&project).Error
+	})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	for _, key := range keys {
+		scoped := tenant.FlagKey(project.ID, key)
+		s.flagCache.Delete(scoped)
+		s.changes.publishFlagChange(scoped, "deleted")
+	}
+	log.Printf("Project %s deleted with %d flag(s)", r.PathValue("org")+"/"+project.Slug, len(keys))
+	writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "Project deleted successfully"})
+}
+
+// listProjectAPIKeysHandler responds to GET /api/organizations/{org}/projects/{project}/api-keys
+// Keys are listed by their prefix; the keys themselves are only returned when created
+func (s *Server) listProjectAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	project, ok := s.findProject(w, r)
+	if !ok {
+		return
+	}
+	var keys []models.ProjectAPIKey
+	if err := s.db.WithContext(r.Context()).Where("project_id = ?", project.ID).Order("id").Find(&keys).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, keys)
+}
+
+// createProjectAPIKeyHandler responds to POST /api/organizations/{org}/projects/{project}/api-keys
+func (s *Server) createProjectAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateProjectAPIKeyRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	project, ok := s.findProject(w, r)
+	if !ok {
+		return
+	}
+
+	secret := projectKeyPrefix + randomToken()
+	key := models.ProjectAPIKey{ProjectID: project.ID, Name: req.Name, Prefix: secret[:len(projectKeyPrefix)+8], TokenHash: hashProjectKey(secret)}
+	if err := s.db.WithContext(r.Context()).Create(&key).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to create API key: %v", err))
+		return
+	}
+	log.Printf("API key %s created for project %s", key.Prefix, r.PathValue("org")+"/"+project.Slug)
+
+	w.Header().Set("Location", fmt.Sprintf("%s/api/organizations/%s/projects/%s/api-keys/%d", s.config.Server.BasePath, r.PathValue("org"), project.Slug, key.ID))
+	writeJSON(w, r, http.StatusCreated, models.ProjectAPIKeyCreated{ProjectAPIKey: key, Key: secret})
+}
+
+// deleteProjectAPIKeyHandler responds to DELETE /api/organizations/{org}/projects/{project}/api-keys/{id}
+// Requests with the key are refused from then on
+func (s *Server) deleteProjectAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	project, ok := s.findProject(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, "API key not found")
+		return
+	}
+	result := s.db.WithContext(r.Context()).Where("project_id = ?", project.ID).Delete(&models.ProjectAPIKey{}, id)
+	switch {
+	case result.Error != nil:
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", result.Error))
+	case result.RowsAffected == 0:
+		writeError(w, r, http.StatusNotFound, "API key not found")
+	default:
+		writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "API key deleted successfully"})
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// newHTTPServer creates the server with the timeouts from cfg
+func newHTTPServer(cfg ServerConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// withRequestTimeout gives the request context a deadline of REQUEST_TIMEOUT,
+// which GORM queries made with WithContext(r.Context()) respect
+// NDJSON and CSV exports are exempt: they manage their own write deadline (see extendWriteDeadline)
+func (s *Server) withRequestTimeout(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wantsNDJSON(r) || wantsCSV(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), s.config.Server.RequestTimeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// extendWriteDeadline moves the connection's write deadline to d from now
+// Long polls and streaming exports call it so they aren't cut off by HTTP_WRITE_TIMEOUT;
+// streams call it after every flush, so only a client that stops reading times out
+func extendWriteDeadline(w http.ResponseWriter, d time.Duration) {
+	// Fails only if no wrapper in the chain exposes the connection; the server default applies then
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(d))
+}
@@ -0,0 +1,12 @@
+//go:build tools
+// +build tools
+
+package main
+
+// This file pins code generation tools in go.mod so everyone runs the same version
+// It is excluded from normal builds by the "tools" build tag
+
+import (
+	_ "github.com/99designs/gqlgen"
+	_ "github.com/tinylib/msgp"
+)
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// tracer creates the backend's own spans (dashboard sections, cache lookups, zone checks)
+// It is a no-op until initTracing installs an exporting provider
+var tracer = otel.Tracer("github.com/nextjs-microfrontend/backend")
+
+// initTracing exports spans over OTLP/HTTP when an OTLP endpoint is configured
+// Everything else comes from the standard variables read by the SDK: OTEL_SERVICE_NAME,
+// OTEL_RESOURCE_ATTRIBUTES, OTEL_TRACES_SAMPLER, OTEL_EXPORTER_OTLP_HEADERS, and so on
+// The returned function flushes buffered spans and must be called before exiting
+func initTracing(ctx context.Context) (func(context.Context) error, error) {
+	// W3C traceparent/tracestate (and baggage) are read from incoming requests and sent
+	// on zone health checks and proxied requests even when nothing is exported here,
+	// so a trace that starts in a zone still continues into the next zone
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	noop := func(context.Context) error { return nil }
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") ||
+		(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "") {
+		return noop, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return noop, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	// Later detectors win, so OTEL_SERVICE_NAME overrides the default name
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName("backend-api")),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return noop, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	log.Println("OpenTelemetry tracing enabled (OTLP/HTTP)")
+	return provider.Shutdown, nil
+}
+
+// tracingMiddleware starts a server span for every request, named after the
+// ServeMux route pattern it matches (e.g., "GET /api/users/{id}")
+// A traceparent header from the calling zone makes it a child of the zone's span
+func tracingMiddleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "http.request",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			if _, route := mux.Handler(r); route != "" {
+				return route
+			}
+			return r.Method + " unmatched"
+		}),
+	)
+}
+
+// gormTracing is a GORM plugin that wraps every query in a client span
+// Spans are children of the span in the statement context, so queries must be
+// made with WithContext(r.Context()) to show up under their request
+type gormTracing struct{}
+
+// Name implements gorm.Plugin
+func (gormTracing) Name() string { return "tracing" }
+
+// gormSpanKey is where the open span is kept on the statement between callbacks
+const gormSpanKey = "tracing:span"
+
+// Initialize implements gorm.Plugin by registering before/after callbacks for every operation
+func (p gormTracing) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("tracing:before_create", p.before("create")),
+		cb.Create().After("gorm:create").Register("tracing:after_create", p.after),
+		cb.Query().Before("gorm:query").Register("tracing:before_query", p.before("query")),
+		cb.Query().After("gorm:query").Register("tracing:after_query", p.after),
+		cb.Update().Before("gorm:update").Register("tracing:before_update", p.before("update")),
+		cb.Update().After("gorm:update").Register("tracing:after_update", p.after),
+		cb.Delete().Before("gorm:delete").Register("tracing:before_delete", p.before("delete")),
+		cb.Delete().After("gorm:delete").Register("tracing:after_delete", p.after),
+		cb.Row().Before("gorm:row").Register("tracing:before_row", p.before("row")),
+		cb.Row().After("gorm:row").Register("tracing:after_row", p.after),
+		cb.Raw().Before("gorm:raw").Register("tracing:before_raw", p.before("raw")),
+		cb.Raw().After("gorm:raw").Register("tracing:after_raw", p.after),
+	)
+}
+
+// before opens the span for an operation
+func (gormTracing) before(operation string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		_, span := tracer.Start(tx.Statement.Context, "db."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperationName(operation)),
+		)
+		tx.InstanceSet(gormSpanKey, span)
+	}
+}
+
+// after records the statement and outcome, then ends the span
+// The SQL uses placeholders, so bound values (emails, names) never reach the trace
+func (gormTracing) after(tx *gorm.DB) {
+	value, ok := tx.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	defer span.End()
+
+	span.SetAttributes(
+		semconv.DBQueryText(tx.Statement.SQL.String()),
+		semconv.DBCollectionName(tx.Statement.Table),
+		attribute.Int64("db.rows_affected", tx.Statement.RowsAffected),
+	)
+	// A missing record is an expected result (404), not a failed query
+	if err := tx.Error; err != nil && err != gorm.ErrRecordNotFound {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
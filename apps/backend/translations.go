@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"github.com/nextjs-microfrontend/backend/internal/tenant"
+	"golang.org/x/text/language"
+	"gorm.io/gorm"
+)
+
+// Flags' names and descriptions and announcements' messages can be translated: the text stored on
+// the flag or announcement is English, and each translation is a row in the translations table.
+// The endpoints the zones read (GET /api/feature-flags, /api/feature-flags/{key}, and
+// /api/announcements/active) pick the best of a record's translations for the request's
+// Accept-Language header, and fall back to English when none fits
+
+// defaultLocale is the locale of the text stored on flags and announcements themselves
+var defaultLocale = language.English
+
+// Resources with translations
+const (
+	translatedFlag         = "flag"
+	translatedAnnouncement = "announcement"
+)
+
+// translationStore stores the translations of flags and announcements
+// Its methods do nothing on a nil store, which is what mock mode has
+type translationStore struct {
+	db *gorm.DB
+}
+
+// newTranslationStore creates a store that keeps translations in database
+func newTranslationStore(database *gorm.DB) *translationStore {
+	return &translationStore{db: database}
+}
+
+// translatedFields are one subject's translations: by locale, then field
+type translatedFields map[string]map[string]string
+
+// load returns the translations of resource's subjects in projectID, by subject
+func (t *translationStore) load(ctx context.Context, projectID uint, resource string, subjects []string) (map[string]translatedFields, error) {
+	var rows []models.Translation
+	err := t.db.WithContext(ctx).Where("project_id = ? AND resource = ? AND subject IN ?", projectID, resource, subjects).Find(&rows).Error
+	found := map[string]translatedFields{}
+	for _, row := range rows {
+		if found[row.Subject] == nil {
+			found[row.Subject] = translatedFields{}
+		}
+		if found[row.Subject][row.Locale] == nil {
+			found[row.Subject][row.Locale] = map[string]string{}
+		}
+		found[row.Subject][row.Locale][row.Field] = row.Text
+	}
+	return found, err
+}
+
+// save replaces subject's translation into locale with fields; empty fields aren't stored
+func (t *translationStore) save(ctx context.Context, projectID uint, resource, subject, locale string, fields map[string]string) error {
+	return t.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("project_id = ? AND resource = ? AND subject = ? AND locale = ?", projectID, resource, subject, locale).
+			Delete(&models.Translation{}).Error; err != nil {
+			return err
+		}
+		var rows []models.Translation
+		for field, text := range fields {
+			if text != "" {
+				rows = append(rows, models.Translation{ProjectID: projectID, Resource: resource, Subject: subject, Locale: locale, Field: field, Text: text})
+			}
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.Create(&rows).Error
+	})
+}
+
+// remove deletes subject's translations: into locale, or into every locale when it is empty
+// It returns how many fields were deleted
+func (t *translationStore) remove(ctx context.Context, projectID uint, resource, subject, locale string) (int64, error) {
+	query := t.db.WithContext(ctx).Where("project_id = ? AND resource = ? AND subject = ?", projectID, resource, subject)
+	if locale != "" {
+		query = query.Where("locale = ?", locale)
+	}
+	result := query.Delete(&models.Translation{})
+	return result.RowsAffected, result.Error
+}
+
+// acceptedLanguages is the request's Accept-Language header, most preferred first; nil when it
+// has none or it doesn't parse
+func acceptedLanguages(r *http.Request) []language.Tag {
+	tags, _, err := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if err != nil {
+		return nil
+	}
+	return tags
+}
+
+// negotiate picks which of a subject's translations to show to a client that accepts accept:
+// the locale, or "" for the default locale's text
+func negotiate(accept []language.Tag, translations translatedFields) string {
+	if len(accept) == 0 || len(translations) == 0 {
+		return ""
+	}
+	// The default comes first, so it wins when nothing matches; the rest are sorted so ties
+	// between translations are decided the same way every time
+	locales := []string{""}
+	for locale := range translations {
+		locales = append(locales, locale)
+	}
+	slices.Sort(locales[1:])
+	tags := []language.Tag{defaultLocale}
+	for _, locale := range locales[1:] {
+		tags = append(tags, language.Make(locale))
+	}
+	_, index, confidence := language.NewMatcher(tags).Match(accept...)
+	if confidence == language.No {
+		return ""
+	}
+	return locales[index]
+}
+
+// localizeFlags replaces the names and descriptions of flags with their translations for r's
+// Accept-Language header, where there are any
+func (t *translationStore) localizeFlags(w http.ResponseWriter, r *http.Request, flags []models.FeatureFlag) error {
+	if t == nil {
+		return nil
+	}
+	w.Header().Add("Vary", "Accept-Language")
+	accept := acceptedLanguages(r)
+	if len(accept) == 0 || len(flags) == 0 {
+		return nil
+	}
+
+	keys := make([]string, len(flags))
+	for i, flag := range flags {
+		keys[i] = flag.Key
+	}
+	translations, err := t.load(r.Context(), tenant.FromContext(r.Context()).ID, translatedFlag, keys)
+	if err != nil {
+		return err
+	}
+	for i := range flags {
+		locale := negotiate(accept, translations[flags[i].Key])
+		if locale == "" {
+			continue
+		}
+		fields := translations[flags[i].Key][locale]
+		flags[i].Name = fields["name"]
+		if description, ok := fields["description"]; ok {
+			flags[i].Description = description
+		}
+	}
+	return nil
+}
+
+// localizeAnnouncements replaces the messages of announcements with their translations for r's
+// Accept-Language header, where there are any, and sets their locale
+func (t *translationStore) localizeAnnouncements(w http.ResponseWriter, r *http.Request, announcements []models.Announcement) error {
+	if t == nil {
+		return nil
+	}
+	w.Header().Add("Vary", "Accept-Language")
+	accept := acceptedLanguages(r)
+	if len(accept) == 0 || len(announcements) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(announcements))
+	for i, announcement := range announcements {
+		ids[i] = strconv.FormatUint(uint64(announcement.ID), 10)
+	}
+	translations, err := t.load(r.Context(), 0, translatedAnnouncement, ids)
+	if err != nil {
+		return err
+	}
+	for i := range announcements {
+		if locale := negotiate(accept, translations[ids[i]]); locale != "" {
+			announcements[i].Message = translations[ids[i]][locale]["message"]
+			announcements[i].Locale = locale
+		}
+	}
+	return nil
+}
+
+// translationLocale reads the {locale} path value as a BCP 47 tag, in its canonical form
+// It writes a 400 response and returns false when it isn't one
+func translationLocale(w http.ResponseWriter, r *http.Request) (string, bool) {
+	tag, err := language.Parse(r.PathValue("locale"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid locale %q: use a BCP 47 tag such as de or pt-BR", r.PathValue("locale")))
+		return "", false
+	}
+	return tag.String(), true
+}
+
+// findTranslatedFlag loads the flag named by the {key} path value in the request's project
+// It writes a 404 (or 500) response and returns false when there is none
+func (s *Server) findTranslatedFlag(w http.ResponseWriter, r *http.Request) (models.FeatureFlag, bool) {
+	flag, err := s.flags.get(r.Context(), r.PathValue("key"))
+	return flag, found(w, r, err, "Feature flag")
+}
+
+// getFlagTranslationsHandler responds to GET /api/feature-flags/{key}/translations
+// The flag's translations, by locale
+func (s *Server) getFlagTranslationsHandler(w http.ResponseWriter, r *http.Request) {
+	flag, ok := s.findTranslatedFlag(w, r)
+	if !ok {
+		return
+	}
+	translations, err := s.translations.load(r.Context(), tenant.FromContext(r.Context()).ID, translatedFlag, []string{flag.Key})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	byLocale := map[string]models.FlagTranslation{}
+	for locale, fields := range translations[flag.Key] {
+		byLocale[locale] = models.FlagTranslation{Name: fields["name"], Description: fields["description"]}
+	}
+	writeJSON(w, r, http.StatusOK, byLocale)
+}
+
+// putFlagTranslationHandler responds to PUT /api/feature-flags/{key}/translations/{locale}
+// Sets the flag's name and description in the locale, replacing any translation it had
+func (s *Server) putFlagTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.FlagTranslation
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	locale, ok := translationLocale(w, r)
+	if !ok {
+		return
+	}
+	flag, ok := s.findTranslatedFlag(w, r)
+	if !ok {
+		return
+	}
+	fields := map[string]string{"name": req.Name, "description": req.Description}
+	if err := s.translations.save(r.Context(), tenant.FromContext(r.Context()).ID, translatedFlag, flag.Key, locale, fields); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to save translation: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, req)
+}
+
+// deleteFlagTranslationHandler responds to DELETE /api/feature-flags/{key}/translations/{locale}
+func (s *Server) deleteFlagTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	locale, ok := translationLocale(w, r)
+	if !ok {
+		return
+	}
+	flag, ok := s.findTranslatedFlag(w, r)
+	if !ok {
+		return
+	}
+	s.deleteTranslation(w, r, tenant.FromContext(r.Context()).ID, translatedFlag, flag.Key, locale)
+}
+
+// getAnnouncementTranslationsHandler responds to GET /api/announcements/{id}/translations
+// The announcement's translations, by locale
+func (s *Server) getAnnouncementTranslationsHandler(w http.ResponseWriter, r *http.Request) {
+	announcement, ok := findByID[models.Announcement](w, r, s.db, "Announcement")
+	if !ok {
+		return
+	}
+	id := strconv.FormatUint(uint64(announcement.ID), 10)
+	translations, err := s.translations.load(r.Context(), 0, translatedAnnouncement, []string{id})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	byLocale := map[string]models.AnnouncementTranslation{}
+	for locale, fields := range translations[id] {
+		byLocale[locale] = models.AnnouncementTranslation{Message: fields["message"]}
+	}
+	writeJSON(w, r, http.StatusOK, byLocale)
+}
+
+// putAnnouncementTranslationHandler responds to PUT /api/announcements/{id}/translations/{locale}
+// Sets the announcement's message in the locale
+func (s *Server) putAnnouncementTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.AnnouncementTranslation
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	locale, ok := translationLocale(w, r)
+	if !ok {
+		return
+	}
+	announcement, ok := findByID[models.Announcement](w, r, s.db, "Announcement")
+	if !ok {
+		return
+	}
+	id := strconv.FormatUint(uint64(announcement.ID), 10)
+	if err := s.translations.save(r.Context(), 0, translatedAnnouncement, id, locale, map[string]string{"message": req.Message}); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to save translation: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, req)
+}
+
+// deleteAnnouncementTranslationHandler responds to DELETE /api/announcements/{id}/translations/{locale}
+func (s *Server) deleteAnnouncementTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	locale, ok := translationLocale(w, r)
+	if !ok {
+		return
+	}
+	announcement, ok := findByID[models.Announcement](w, r, s.db, "Announcement")
+	if !ok {
+		return
+	}
+	s.deleteTranslation(w, r, 0, translatedAnnouncement, strconv.FormatUint(uint64(announcement.ID), 10), locale)
+}
+
+// deleteTranslation deletes subject's translation into locale and writes the response: 404
+// when it had none
+func (s *Server) deleteTranslation(w http.ResponseWriter, r *http.Request, projectID uint, resource, subject, locale string) {
+	deleted, err := s.translations.remove(r.Context(), projectID, resource, subject, locale)
+	switch {
+	case err != nil:
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+	case deleted == 0:
+		writeError(w, r, http.StatusNotFound, "Translation not found")
+	default:
+		writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "Translation deleted successfully"})
+	}
+}
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Files never pass through the backend or the zones' API routes: POST /api/uploads checks the
+// type and size, records the upload as pending, and returns a presigned URL the browser PUTs the
+// file to, straight into UPLOAD_S3_BUCKET. Completing the upload then checks what arrived against
+// what was declared, and only ready uploads can be downloaded
+
+// uploadFilenamePattern matches the characters replaced in the file name part of an object key
+var uploadFilenamePattern = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// uploadLimit is one UPLOAD_TYPE_LIMITS entry: the largest file of a media type, or of every
+// subtype when the pattern is e.g. "image/*"
+type uploadLimit struct {
+	pattern  string
+	maxBytes int64
+}
+
+// byteUnits are the size suffixes parseUploadLimit accepts, in 1024s
+var byteUnits = []struct {
+	suffix string
+	bytes  int64
+}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+
+// parseUploadLimit parses "<media type>=<size>", where the size is in bytes or has a KB, MB,
+// or GB suffix, e.g. "image/*=10MB" or "text/plain=65536"
+func parseUploadLimit(entry string) (uploadLimit, error) {
+	pattern, size, ok := strings.Cut(entry, "=")
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if kind, sub, found := strings.Cut(pattern, "/"); !ok || !found || kind == "" || sub == "" {
+		return uploadLimit{}, fmt.Errorf("invalid upload limit %q", entry)
+	}
+	size = strings.ToUpper(strings.TrimSpace(size))
+	unit := int64(1)
+	for _, u := range byteUnits {
+		if number, found := strings.CutSuffix(size, u.suffix); found {
+			size, unit = strings.TrimSpace(number), u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || n <= 0 {
+		return uploadLimit{}, fmt.Errorf("invalid upload limit %q", entry)
+	}
+	return uploadLimit{pattern: pattern, maxBytes: n * unit}, nil
+}
+
+// formatBytes writes a size the way UPLOAD_TYPE_LIMITS does, e.g. "10MB"
+func formatBytes(n int64) string {
+	for _, u := range byteUnits {
+		if n >= u.bytes && n%u.bytes == 0 {
+			return strconv.FormatInt(n/u.bytes, 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(n, 10) + "B"
+}
+
+// uploadStore presigns uploads to and downloads from UPLOAD_S3_BUCKET, and checks what arrived
+type uploadStore struct {
+	client  *minio.Client // Stats and deletes objects, from inside the cluster
+	presign *minio.Client // Signs URLs for UPLOAD_S3_PUBLIC_ENDPOINT, which is part of the signature
+	bucket  string
+	prefix  string
+	limits  []uploadLimit
+	expiry  time.Duration // UPLOAD_URL_EXPIRY
+}
+
+// newUploadStore returns the store for UPLOAD_S3_BUCKET, or nil when it is empty
+func newUploadStore(cfg UploadConfig) (*uploadStore, error) {
+	if cfg.S3Bucket == "" {
+		return nil, nil
+	}
+	client, err := newS3Client(cfg.S3Endpoint, cfg.S3Region, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3Insecure)
+	if err != nil {
+		return nil, fmt.Errorf("invalid UPLOAD_S3_ENDPOINT: %w", err)
+	}
+	presign := client
+	if cfg.S3PublicEndpoint != "" {
+		if presign, err = newS3Client(cfg.S3PublicEndpoint, cfg.S3Region, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3Insecure); err != nil {
+			return nil, fmt.Errorf("invalid UPLOAD_S3_PUBLIC_ENDPOINT: %w", err)
+		}
+	}
+	store := &uploadStore{client: client, presign: presign, bucket: cfg.S3Bucket, prefix: cfg.S3Prefix, expiry: cfg.URLExpiry}
+	for _, entry := range cfg.TypeLimits {
+		limit, err := parseUploadLimit(entry)
+		if err != nil {
+			return nil, err
+		}
+		store.limits = append(store.limits, limit)
+	}
+	return store, nil
+}
+
+// String describes where uploads go, e.g. "s3://bucket/uploads/"
+func (u *uploadStore) String() string { return "s3://" + u.bucket + "/" + u.prefix }
+
+// maxBytes returns the largest file of contentType that may be uploaded, or false if the type
+// may not be uploaded at all; an exact type's limit wins over its "type/*" one
+func (u *uploadStore) maxBytes(contentType string) (int64, bool) {
+	kind, _, _ := strings.Cut(contentType, "/")
+	var wildcard *uploadLimit
+	for i, limit := range u.limits {
+		switch limit.pattern {
+		case contentType:
+			return limit.maxBytes, true
+		case kind + "/*":
+			wildcard = &u.limits[i]
+		}
+	}
+	if wildcard == nil {
+		return 0, false
+	}
+	return wildcard.maxBytes, true
+}
+
+// allowedTypes lists the UPLOAD_TYPE_LIMITS patterns, for validation messages
+func (u *uploadStore) allowedTypes() string {
+	patterns := make([]string, len(u.limits))
+	for i, limit := range u.limits {
+		patterns[i] = limit.pattern
+	}
+	return strings.Join(patterns, ", ")
+}
+
+// objectKey is where a new upload of filename is stored: a random directory keeps keys unique
+// and unguessable, and the name keeps only characters that are safe in a URL
+func (u *uploadStore) objectKey(filename string) string {
+	name := strings.Trim(uploadFilenamePattern.ReplaceAllString(filename, "-"), "-.")
+	if len(name) > 100 {
+		name = name[len(name)-100:]
+	}
+	if name == "" {
+		name = "file"
+	}
+	return u.prefix + randomToken() + "/" + name
+}
+
+// putURL presigns a PUT of upload's object; the client must send the signed Content-Type
+func (u *uploadStore) putURL(ctx context.Context, upload models.Upload) (string, error) {
+	headers := http.Header{"Content-Type": {upload.ContentType}}
+	signed, err := u.presign.PresignHeader(ctx, http.MethodPut, u.bucket, upload.Key, time.Until(upload.ExpiresAt), nil, headers)
+	if err != nil {
+		return "", err
+	}
+	return signed.String(), nil
+}
+
+// getURL presigns a GET of the object at key that serves it with disposition, e.g. as an
+// attachment under the upload's file name
+func (u *uploadStore) getURL(ctx context.Context, key, disposition string) (string, error) {
+	params := url.Values{"response-content-disposition": {disposition}}
+	signed, err := u.presign.PresignedGetObject(ctx, u.bucket, key, u.expiry, params)
+	if err != nil {
+		return "", err
+	}
+	return signed.String(), nil
+}
+
+// stat returns what is stored at key; errNotFound if nothing is
+func (u *uploadStore) stat(ctx context.Context, key string) (minio.ObjectInfo, error) {
+	info, err := u.client.StatObject(ctx, u.bucket, key, minio.StatObjectOptions{})
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return info, errNotFound
+	}
+	return info, err
+}
+
+// get reads the object at key, which must be at most maxBytes; errNotFound if there is none
+func (u *uploadStore) get(ctx context.Context, key string, maxBytes int64) ([]byte, error) {
+	object, err := u.client.GetObject(ctx, u.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+	data, err := io.ReadAll(io.LimitReader(object, maxBytes+1))
+	switch {
+	case minio.ToErrorResponse(err).Code == "NoSuchKey":
+		return nil, errNotFound
+	case err != nil:
+		return nil, err
+	case int64(len(data)) > maxBytes:
+		return nil, fmt.Errorf("%s is over %s", key, formatBytes(maxBytes))
+	}
+	return data, nil
+}
+
+// put stores data at key, replacing what is there
+func (u *uploadStore) put(ctx context.Context, key, contentType string, data []byte) error {
+	_, err := u.client.PutObject(ctx, u.bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+// remove deletes the object at key; deleting a missing object succeeds
+func (u *uploadStore) remove(ctx context.Context, key string) error {
+	return u.client.RemoveObject(ctx, u.bucket, key, minio.RemoveObjectOptions{})
+}
+
+// uploadFilterFields are the upload fields ?filter= and ?orderby= accept
+var uploadFilterFields = filterFields{
+	"id":          {Column: "id", Kind: filterNumber},
+	"filename":    {Column: "filename", Kind: filterString},
+	"contentType": {Column: "content_type", Kind: filterString},
+	"size":        {Column: "size", Kind: filterNumber},
+	"zone":        {Column: "zone", Kind: filterString},
+	"status":      {Column: "status", Kind: filterString},
+	"createdAt":   {Column: "created_at", Kind: filterTime},
+}
+
+// createUploadHandler responds to POST /api/uploads
+// The upload is pending until it is completed; the URL works for UPLOAD_URL_EXPIRY
+func (s *Server) createUploadHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateUploadRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	var fieldErrors []models.FieldError
+	contentType, _, err := mime.ParseMediaType(req.ContentType)
+	maxBytes, allowed := s.uploads.maxBytes(contentType)
+	switch {
+	case err != nil || !allowed:
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "contentType", Message: "must be an allowed type (" + s.uploads.allowedTypes() + ")"})
+	case req.Size > maxBytes:
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "size", Message: fmt.Sprintf("must be at most %s for %s", formatBytes(maxBytes), contentType)})
+	}
+	if _, ok := s.findZone(req.Zone); req.Zone != "" && !ok {
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "zone", Message: "must be a zone (" + s.zoneNames() + ")"})
+	}
+	if len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+
+	upload := models.Upload{
+		Key: s.uploads.objectKey(req.Filename), Filename: req.Filename, ContentType: contentType, Size: req.Size,
+		Zone: req.Zone, Status: "pending", ExpiresAt: time.Now().Add(s.config.Uploads.URLExpiry).UTC(),
+	}
+	uploadURL, err := s.uploads.putURL(r.Context(), upload)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to sign the upload URL: %v", err))
+		return
+	}
+	if err := s.db.WithContext(r.Context()).Create(&upload).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to create upload: %v", err))
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s/api/uploads/%d", s.config.Server.BasePath, upload.ID))
+	writeJSON(w, r, http.StatusCreated, models.UploadCreated{
+		Upload:    upload,
+		UploadURL: uploadURL,
+		Headers:   map[string]string{"Content-Type": upload.ContentType},
+	})
+}
+
+// completeUploadHandler responds to POST /api/uploads/{id}/complete
+// The stored object must have the declared size and type, within the type's limit; one that
+// doesn't is deleted and the upload rejected (422). 409 if nothing has been uploaded yet, or
+// the upload is no longer pending, and 410 once its upload URL has expired (the cleanup-uploads
+// schedule deletes it and whatever was sent)
+func (s *Server) completeUploadHandler(w http.ResponseWriter, r *http.Request) {
+	upload, ok := findByID[models.Upload](w, r, s.db, "Upload")
+	if !ok {
+		return
+	}
+	if upload.Status != "pending" {
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("Upload %d is already %s", upload.ID, upload.Status))
+		return
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		writeError(w, r, http.StatusGone, fmt.Sprintf("Upload %d expired at %s; create a new one", upload.ID, upload.ExpiresAt.UTC().Format(time.RFC3339)))
+		return
+	}
+	info, err := s.uploads.stat(r.Context(), upload.Key)
+	switch {
+	case errors.Is(err, errNotFound):
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("Upload %d has no file yet; PUT it to the upload URL first", upload.ID))
+		return
+	case err != nil:
+		writeError(w, r, http.StatusBadGateway, fmt.Sprintf("Failed to check the uploaded file: %v", err))
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(info.ContentType)
+	maxBytes, _ := s.uploads.maxBytes(upload.ContentType)
+	switch {
+	case info.Size != upload.Size:
+		upload.RejectReason = fmt.Sprintf("the file is %d bytes, not the %d declared", info.Size, upload.Size)
+	case info.Size > maxBytes:
+		// The limit may have been lowered since the upload was created
+		upload.RejectReason = fmt.Sprintf("the file is over the %s limit for %s", formatBytes(maxBytes), upload.ContentType)
+	case contentType != upload.ContentType:
+		upload.RejectReason = fmt.Sprintf("the file is %s, not the %s declared", info.ContentType, upload.ContentType)
+	}
+	now := time.Now().UTC()
+	upload.CompletedAt = &now
+	upload.Status = "ready"
+	if upload.RejectReason != "" {
+		upload.Status = "rejected"
+		if err := s.uploads.remove(r.Context(), upload.Key); err != nil {
+			log.Printf("Failed to delete rejected upload %s: %v", upload.Key, err)
+		}
+	}
+	if err := s.db.WithContext(r.Context()).Save(&upload).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to update upload: %v", err))
+		return
+	}
+	if upload.Status == "rejected" {
+		writeError(w, r, http.StatusUnprocessableEntity, fmt.Sprintf("Upload %d was rejected: %s", upload.ID, upload.RejectReason))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, upload)
+}
+
+// listUploadsHandler responds to GET /api/uploads
+// Newest first, narrowed with the shared ?filter= and ?orderby= parameters, e.g. ?filter=status eq "ready"
+func (s *Server) listUploadsHandler(w http.ResponseWriter, r *http.Request) {
+	listQuery, err := parseListQuery(r, uploadFilterFields)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid query: "+err.Error())
+		return
+	}
+	var uploads []models.Upload
+	if err := listQuery.apply(s.db.WithContext(r.Context()).Model(&models.Upload{}), "id DESC").Find(&uploads).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	setNextPageLink(w, r, listQuery.page, len(uploads))
+	writeJSON(w, r, http.StatusOK, uploads)
+}
+
+// getUploadHandler responds to GET /api/uploads/{id}
+func (s *Server) getUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if upload, ok := findByID[models.Upload](w, r, s.db, "Upload"); ok {
+		writeJSON(w, r, http.StatusOK, upload)
+	}
+}
+
+// downloadUploadHandler responds to GET /api/uploads/{id}/download
+func (s *Server) downloadUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if upload, ok := findByID[models.Upload](w, r, s.db, "Upload"); ok {
+		s.redirectToUpload(w, r, upload)
+	}
+}
+
+// downloadFileHandler responds to GET /api/files/{key...}
+// The public download: the upload is named by its object key, whose random directory can't be
+// guessed, so only those given the URL (e.g. with a user's avatar) can fetch the file
+func (s *Server) downloadFileHandler(w http.ResponseWriter, r *http.Request) {
+	if upload, ok := findBy[models.Upload](w, r, s.db, "File", byKey(r.PathValue("key"))); ok {
+		s.redirectToUpload(w, r, upload)
+	}
+}
+
+// fileURL is the public download URL of upload (see downloadFileHandler)
+func fileURL(basePath string, upload models.Upload) string {
+	return basePath + "/api/files/" + upload.Key
+}
+
+// redirectToUpload redirects to a presigned URL for upload's file, which works for
+// UPLOAD_URL_EXPIRY; 409 unless the upload is ready. ?variant=thumb (or medium) redirects to
+// that resized copy of an image, served inline (see images.go)
+func (s *Server) redirectToUpload(w http.ResponseWriter, r *http.Request, upload models.Upload) {
+	if upload.Status != "ready" {
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("Upload is %s, not ready", upload.Status))
+		return
+	}
+	key, disposition := upload.Key, mime.FormatMediaType("attachment", map[string]string{"filename": upload.Filename})
+	if name := r.URL.Query().Get("variant"); name != "" {
+		var variant models.ImageVariant
+		err := s.db.WithContext(r.Context()).Where("upload_id = ? AND name = ?", upload.ID, name).First(&variant).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			writeError(w, r, http.StatusNotFound, fmt.Sprintf("Upload has no %s variant", name))
+			return
+		case err != nil:
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+			return
+		}
+		key, disposition = variant.Key, "inline"
+	}
+	downloadURL, err := s.uploads.getURL(r.Context(), key, disposition)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to sign the download URL: %v", err))
+		return
+	}
+	http.Redirect(w, r, downloadURL, http.StatusTemporaryRedirect)
+}
+
+// pruneUploads deletes pending uploads whose upload URL has expired, with any file sent for them;
+// the cleanup-uploads schedule. They can't be completed any more, so there is no retention setting
+func (s *Server) pruneUploads(ctx context.Context, dryRun bool) (int64, error) {
+	expired := func() *gorm.DB {
+		return s.db.WithContext(ctx).Where("status = ? AND expires_at < ?", "pending", time.Now())
+	}
+	if dryRun {
+		return purge(expired(), &models.Upload{}, true)
+	}
+	var uploads []models.Upload
+	if err := expired().Select("id", "key").Find(&uploads).Error; err != nil {
+		return 0, err
+	}
+	var deleted int64
+	for _, upload := range uploads {
+		if err := s.uploads.remove(ctx, upload.Key); err != nil {
+			return deleted, fmt.Errorf("failed to delete %s: %w", upload.Key, err)
+		}
+		if err := s.db.WithContext(ctx).Delete(&upload).Error; err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// deleteUploadHandler responds to DELETE /api/uploads/{id}
+// The file and its variants are deleted from the bucket too, and users with it as their avatar
+// have none
+func (s *Server) deleteUploadHandler(w http.ResponseWriter, r *http.Request) {
+	upload, ok := findByID[models.Upload](w, r, s.db, "Upload")
+	if !ok {
+		return
+	}
+	if err := s.images.forget(r.Context(), upload); err != nil {
+		writeError(w, r, http.StatusBadGateway, fmt.Sprintf("Failed to delete the image variants: %v", err))
+		return
+	}
+	if err := s.uploads.remove(r.Context(), upload.Key); err != nil {
+		writeError(w, r, http.StatusBadGateway, fmt.Sprintf("Failed to delete the file: %v", err))
+		return
+	}
+	if err := s.db.WithContext(r.Context()).Delete(&upload).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "Upload deleted successfully"})
+}
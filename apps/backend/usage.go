@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// consumerHeader lets a caller name itself in usage reports (e.g., "zone-admin", "nightly-export")
+const consumerHeader = "X-API-Consumer"
+
+// maxUsageKeys bounds how many (day, route, consumer) counters are held between flushes
+// Past it, new consumers are counted as "other", so made-up consumer names can't grow memory
+const maxUsageKeys = 10000
+
+// usageRoutesIgnored are probe endpoints that would only add noise to the report (without BASE_PATH)
+var usageRoutesIgnored = map[string]bool{"/health": true}
+
+// usageKey identifies one api_usage row
+type usageKey struct {
+	day      string // YYYY-MM-DD (UTC)
+	route    string
+	consumer string
+}
+
+// usageCounts are the counts collected for one key since the last flush
+type usageCounts struct {
+	requests, clientErrors, serverErrors, slowRequests int64
+}
+
+// usageRecorder counts requests per day, route, and consumer in memory and
+// periodically adds them to the api_usage table
+type usageRecorder struct {
+	db     *gorm.DB
+	cfg    UsageConfig
+	mu     sync.Mutex
+	counts map[usageKey]*usageCounts
+
+	// BASE_PATH and SLO_LATENCY_THRESHOLD, to count requests the way the SLOs do
+	basePath     string
+	sloThreshold time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newUsageRecorder creates a recorder that saves to database and starts its flush loop
+func newUsageRecorder(database *gorm.DB, cfg Config) *usageRecorder {
+	u := &usageRecorder{
+		db:           database,
+		cfg:          cfg.Usage,
+		basePath:     cfg.Server.BasePath,
+		sloThreshold: cfg.SLO.LatencyThreshold,
+		counts:       map[usageKey]*usageCounts{},
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	go u.run()
+	return u
+}
+
+// middleware counts every request handled by next that matched a route
+// mux is used only to look up the route pattern
+func (u *usageRecorder) middleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		_, route := mux.Handler(r)
+		if !sloCounted(r.Method, route, u.basePath) {
+			return
+		}
+		slow := sloSlow(route, time.Since(start), u.sloThreshold)
+		u.record(time.Now().UTC().Format(time.DateOnly), route, usageConsumer(r), sw.status, slow)
+	})
+}
+
+// usageConsumer names the caller: the X-API-Consumer header if sent, otherwise
+// the product part of the User-Agent ("backend-go-client/1.0" → "backend-go-client")
+func usageConsumer(r *http.Request) string {
+	consumer := strings.TrimSpace(r.Header.Get(consumerHeader))
+	if consumer == "" {
+		consumer, _, _ = strings.Cut(r.UserAgent(), "/")
+		consumer, _, _ = strings.Cut(consumer, " ")
+	}
+	if consumer == "" {
+		return "unknown"
+	}
+	if len(consumer) > 64 {
+		consumer = consumer[:64]
+	}
+	return consumer
+}
+
+// record adds one request to the in-memory counts
+// slow marks a request that missed the SLO latency threshold (see slo.go)
+func (u *usageRecorder) record(day, route, consumer string, status int, slow bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	key := usageKey{day: day, route: route, consumer: consumer}
+	counts, ok := u.counts[key]
+	if !ok {
+		if len(u.counts) >= maxUsageKeys {
+			key.consumer = "other"
+			counts = u.counts[key]
+		}
+		if counts == nil {
+			counts = &usageCounts{}
+			u.counts[key] = counts
+		}
+	}
+
+	counts.requests++
+	switch {
+	case status >= http.StatusInternalServerError:
+		counts.serverErrors++
+	case status >= http.StatusBadRequest:
+		counts.clientErrors++
+	}
+	if slow {
+		counts.slowRequests++
+	}
+}
+
+// run flushes every USAGE_FLUSH_INTERVAL until close is called, then flushes one last time
+func (u *usageRecorder) run() {
+	defer close(u.done)
+	ticker := time.NewTicker(u.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			u.flush()
+		case <-u.stop:
+			u.flush()
+			return
+		}
+	}
+}
+
+// close writes the counts collected since the last flush; called during shutdown
+// before the database pool is closed. Safe to call on a nil recorder
+func (u *usageRecorder) close() {
+	if u == nil {
+		return
+	}
+	close(u.stop)
+	<-u.done
+}
+
+// flush adds the collected counts to api_usage
+// Each replica adds its own counts (requests = requests + EXCLUDED.requests), so
+// replicas never overwrite each other; on failure the counts are kept for the next flush
+func (u *usageRecorder) flush() {
+	u.mu.Lock()
+	counts := u.counts
+	u.counts = map[usageKey]*usageCounts{}
+	u.mu.Unlock()
+	if len(counts) == 0 {
+		return
+	}
+
+	rows := make([]models.APIUsage, 0, len(counts))
+	for key, c := range counts {
+		day, _ := time.Parse(time.DateOnly, key.day)
+		rows = append(rows, models.APIUsage{
+			Day:          day,
+			Route:        key.route,
+			Consumer:     key.consumer,
+			Requests:     c.requests,
+			ClientErrors: c.clientErrors,
+			ServerErrors: c.serverErrors,
+			SlowRequests: c.slowRequests,
+		})
+	}
+
+	err := u.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "day"}, {Name: "route"}, {Name: "consumer"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "requests"}, Value: gorm.Expr("api_usage.requests + " + excludedColumn(u.db, "requests"))},
+			{Column: clause.Column{Name: "client_errors"}, Value: gorm.Expr("api_usage.client_errors + " + excludedColumn(u.db, "client_errors"))},
+			{Column: clause.Column{Name: "server_errors"}, Value: gorm.Expr("api_usage.server_errors + " + excludedColumn(u.db, "server_errors"))},
+			{Column: clause.Column{Name: "slow_requests"}, Value: gorm.Expr("api_usage.slow_requests + " + excludedColumn(u.db, "slow_requests"))},
+		},
+	}).Create(&rows).Error
+	if err == nil {
+		return
+	}
+
+	log.Printf("Failed to save API usage (%d rows), retrying on the next flush: %v", len(rows), err)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for key, c := range counts {
+		if existing, ok := u.counts[key]; ok {
+			existing.requests += c.requests
+			existing.clientErrors += c.clientErrors
+			existing.serverErrors += c.serverErrors
+			existing.slowRequests += c.slowRequests
+		} else {
+			u.counts[key] = c
+		}
+	}
+}
+
+// prune deletes rows older than USAGE_RETENTION_DAYS and returns how many there were, or only
+// counts them on a dry run. It runs on the leader only, as the cleanup-usage schedule (see schedules.go)
+func (u *usageRecorder) prune(ctx context.Context, dryRun bool) (int64, error) {
+	if u.cfg.RetentionDays <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().UTC().AddDate(0, 0, -u.cfg.RetentionDays).Format(time.DateOnly)
+	return purge(u.db.WithContext(ctx).Where("day < ?", cutoff), &models.APIUsage{}, dryRun)
+}
+
+// getAPIUsageHandler responds to GET /api/usage
+// Query parameters: from and to (YYYY-MM-DD, UTC, default the last 7 days),
+// route and consumer to narrow the report, and limit (default 50, at most LIST_MAX_PAGE_SIZE)
+// Counts flushed in the last USAGE_FLUSH_INTERVAL may not be included yet
+func (s *Server) getAPIUsageHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	from, to := today.AddDate(0, 0, -6), today
+	for name, target := range map[string]*time.Time{"from": &from, "to": &to} {
+		if value := query.Get(name); value != "" {
+			day, err := time.Parse(time.DateOnly, value)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, fmt.Sprintf("%s must be a date (YYYY-MM-DD)", name))
+				return
+			}
+			*target = day
+		}
+	}
+	if to.Before(from) {
+		writeError(w, r, http.StatusBadRequest, "to must not be before from")
+		return
+	}
+
+	limit := s.config.API.DefaultPageSize
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			writeError(w, r, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, s.config.API.MaxPageSize)
+	}
+
+	report, err := s.usageReport(r.Context(), from, to, query.Get("route"), query.Get("consumer"), limit)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, report)
+}
+
+// usageReport totals requests per route and consumer from from to to (UTC days, inclusive),
+// busiest first; route and consumer narrow it when they aren't empty
+func (s *Server) usageReport(ctx context.Context, from, to time.Time, route, consumer string, limit int) (models.APIUsageReport, error) {
+	tx := s.db.WithContext(ctx).Model(&models.APIUsage{}).
+		Select("route, consumer, SUM(requests) AS requests, SUM(client_errors) AS client_errors, SUM(server_errors) AS server_errors").
+		// A half-open range rather than BETWEEN: SQLite stores day as a timestamp string
+		// ("2024-05-01 00:00:00+00:00"), which sorts after the bare date "2024-05-01"
+		Where("day >= ? AND day < ?", from.Format(time.DateOnly), to.AddDate(0, 0, 1).Format(time.DateOnly))
+	if route != "" {
+		tx = tx.Where("route = ?", route)
+	}
+	if consumer != "" {
+		tx = tx.Where("consumer = ?", consumer)
+	}
+
+	report := models.APIUsageReport{
+		From:  from.Format(time.DateOnly),
+		To:    to.Format(time.DateOnly),
+		Usage: []models.APIUsageTotal{},
+	}
+	err := tx.Group("route, consumer").Order("requests DESC").Limit(limit).Scan(&report.Usage).Error
+	return report, err
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"golang.org/x/text/language"
+)
+
+// flagKeyPattern is the allowed format for feature flag keys (e.g., "new_dashboard")
+var flagKeyPattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// validate checks request structs against their `validate` struct tags
+// A single instance is shared because it caches struct metadata
+var validate = newValidator()
+
+// newValidator creates the validator with custom rules and JSON field names
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	// Report errors using JSON field names ("email") instead of Go names ("Email")
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	// flagkey: lowercase letters, digits, and underscores only
+	v.RegisterValidation("flagkey", func(fl validator.FieldLevel) bool {
+		return flagKeyPattern.MatchString(fl.Field().String())
+	})
+
+	// webhookevent: one of webhookEventTypes, or "*" for all of them
+	v.RegisterValidation("webhookevent", func(fl validator.FieldLevel) bool {
+		event := fl.Field().String()
+		return event == "*" || slices.Contains(webhookEventTypes, event)
+	})
+
+	// emailtemplate: the name of one of the email_templates (see email.go)
+	v.RegisterValidation("emailtemplate", func(fl validator.FieldLevel) bool {
+		_, ok := emailTemplates[fl.Field().String()]
+		return ok
+	})
+
+	// schedulename: lowercase letters, digits, and dashes, starting with a letter or digit
+	v.RegisterValidation("schedulename", func(fl validator.FieldLevel) bool {
+		return scheduleNamePattern.MatchString(fl.Field().String())
+	})
+
+	// schedulecron: a cron expression parseCron accepts (in any timezone, so UTC will do)
+	v.RegisterValidation("schedulecron", func(fl validator.FieldLevel) bool {
+		_, err := parseCron(fl.Field().String(), "UTC")
+		return err == nil
+	})
+
+	// scheduletask: one of scheduleTaskNames
+	v.RegisterValidation("scheduletask", func(fl validator.FieldLevel) bool {
+		return slices.Contains(scheduleTaskNames, fl.Field().String())
+	})
+
+	// navkey: lowercase letters, digits, and dashes, starting with a letter or digit
+	v.RegisterValidation("navkey", func(fl validator.FieldLevel) bool {
+		return navigationKeyPattern.MatchString(fl.Field().String())
+	})
+
+	// navhref: a path on the site, or an http(s) URL
+	v.RegisterValidation("navhref", func(fl validator.FieldLevel) bool {
+		return validNavigationHref(fl.Field().String())
+	})
+
+	// routepath: "/", an exact path, or a prefix ending in "/*"
+	v.RegisterValidation("routepath", func(fl validator.FieldLevel) bool {
+		return zoneRoutePattern.MatchString(fl.Field().String())
+	})
+
+	// slug: an organization or project slug (lowercase letters, digits, and dashes)
+	v.RegisterValidation("slug", func(fl validator.FieldLevel) bool {
+		return tenantSlugPattern.MatchString(fl.Field().String())
+	})
+
+	// locale: a BCP 47 tag, as Accept-Language negotiation understands them (see translations.go)
+	v.RegisterValidation("locale", func(fl validator.FieldLevel) bool {
+		_, err := language.Parse(fl.Field().String())
+		return err == nil
+	})
+
+	return v
+}
+
+// decodeAndValidate decodes the request body into v and validates it
+// On failure it writes a 400 response and returns false, so handlers can simply:
+//
+//	if !decodeAndValidate(w, r, &req) {
+//		return
+//	}
+func decodeAndValidate(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := decodeJSON(r, v); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body")
+		return false
+	}
+
+	if fieldErrors := validateStruct(v); len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return false
+	}
+	return true
+}
+
+// validateStruct runs the validator and converts failures into per-field errors
+func validateStruct(v interface{}) []models.FieldError {
+	err := validate.Struct(v)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return []models.FieldError{{Field: "", Message: err.Error()}}
+	}
+
+	fieldErrors := make([]models.FieldError, len(validationErrors))
+	for i, fe := range validationErrors {
+		// The namespace keeps the path into nested lists ("users[3].email");
+		// only the root struct name is dropped
+		_, field, _ := strings.Cut(fe.Namespace(), ".")
+		fieldErrors[i] = models.FieldError{
+			Field:   field,
+			Message: validationMessage(fe),
+		}
+	}
+	return fieldErrors
+}
+
+// validationMessage turns a validator error into a readable message
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "flagkey":
+		return "must contain only lowercase letters, digits, and underscores"
+	case "webhookevent":
+		return "must be an event type (" + strings.Join(webhookEventTypes, ", ") + `) or "*"`
+	case "emailtemplate":
+		return "must be an email template (" + strings.Join(emailTemplateNames(), ", ") + ")"
+	case "schedulename":
+		return "must contain only lowercase letters, digits, and dashes"
+	case "schedulecron":
+		return `must be a cron expression, e.g. "30 6 * * 1-5", "@daily", or "@every 15m"`
+	case "scheduletask":
+		return "must be a schedule task (" + strings.Join(scheduleTaskNames, ", ") + ")"
+	case "navkey":
+		return "must contain only lowercase letters, digits, and dashes"
+	case "navhref":
+		return `must be a path such as "/admin/flags" or an http:// or https:// URL`
+	case "slug":
+		return "must contain only lowercase letters, digits, and dashes, starting with a letter or digit"
+	case "routepath":
+		return `must be a path such as "/about", or a prefix such as "/admin/*"`
+	case "required_if":
+		field, value, _ := strings.Cut(fe.Param(), " ")
+		return fmt.Sprintf("is required when %s is %s", strings.ToLower(field), value)
+	case "startswith":
+		return fmt.Sprintf("must start with %q", fe.Param())
+	case "http_url":
+		return "must be an http:// or https:// URL"
+	case "locale":
+		return `must be a BCP 47 locale, e.g. "en" or "pt-BR"`
+	case "email|eq=":
+		return "must be a valid email address, or empty"
+	case "ip|cidr":
+		return `must be an IP address or CIDR range, e.g. "203.0.113.7" or "10.0.0.0/8"`
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "min":
+		switch fe.Kind() {
+		case reflect.Slice:
+			return fmt.Sprintf("must have at least %s items", fe.Param())
+		case reflect.Int, reflect.Int64:
+			return fmt.Sprintf("must be at least %s", fe.Param())
+		}
+		return fmt.Sprintf("must be at least %s characters", fe.Param())
+	case "max":
+		switch fe.Kind() {
+		case reflect.Slice:
+			return fmt.Sprintf("must have at most %s items", fe.Param())
+		case reflect.Int, reflect.Int64:
+			return fmt.Sprintf("must be at most %s", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s characters", fe.Param())
+	default:
+		return fmt.Sprintf("failed the %q rule", fe.Tag())
+	}
+}
+
+// writeValidationErrors sends a 400 response listing every invalid field
+// The shape follows the same negotiation rules as writeError
+func writeValidationErrors(w http.ResponseWriter, r *http.Request, fieldErrors []models.FieldError) {
+	status := http.StatusBadRequest
+
+	switch {
+	case wantsJSONAPI(r):
+		// One JSON:API error object per field, pointing at the offending attribute
+		doc := jsonAPIErrorDocument{Errors: make([]jsonAPIError, len(fieldErrors))}
+		for i, fe := range fieldErrors {
+			doc.Errors[i] = jsonAPIError{
+				Status: strconv.Itoa(status),
+				Title:  "Validation failed",
+				Detail: fe.Field + " " + fe.Message,
+				Source: &jsonAPIErrorSource{Pointer: "/data/attributes/" + fieldPointer(fe.Field)},
+			}
+		}
+		writeDocument(w, status, jsonAPIContentType, doc)
+	case apiVersion(r) >= 2:
+		var body envelopeError
+		body.Error.Status = status
+		body.Error.Message = "Validation failed"
+		body.Error.Fields = fieldErrors
+		body.Meta.RequestID = requestIDFrom(r.Context())
+		writeDocument(w, status, "application/json", body)
+	default:
+		// v1 clients display the plain-text body, so list the fields in one line
+		parts := make([]string, len(fieldErrors))
+		for i, fe := range fieldErrors {
+			parts[i] = fe.Field + " " + fe.Message
+		}
+		http.Error(w, "Validation failed: "+strings.Join(parts, "; "), status)
+	}
+}
+
+// fieldPointer turns a field path like "users[3].email" into JSON pointer segments ("users/3/email")
+func fieldPointer(field string) string {
+	return strings.NewReplacer("[", "/", "]", "", ".", "/").Replace(field)
+}
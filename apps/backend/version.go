@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Build information, set at build time (the Dockerfile does this from its build args):
+//
+//	go build -ldflags "-X main.version=v1.4.0 -X main.gitCommit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%FT%TZ)"
+//
+// Without them a `go build` in a checkout still reports the commit the Go toolchain
+// records; `go run` and `go test` builds report none
+var (
+	version   = "dev"
+	gitCommit = ""
+	buildTime = ""
+)
+
+// currentBuild describes this binary; it doesn't change while the process runs
+var currentBuild = sync.OnceValue(func() models.BuildInfo {
+	build := models.BuildInfo{
+		Version:   version,
+		Commit:    gitCommit,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && build.Commit == "" {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				build.Commit = setting.Value
+			case "vcs.modified":
+				build.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return build
+})
+
+// buildRevision returns the VCS commit the binary was built from, or "" if unknown
+func buildRevision() string {
+	return currentBuild().Commit
+}
+
+// versionHandler responds to GET /version
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, currentBuild())
+}
+
+// backend_build_info is always 1; its labels let dashboards show, and alerts join on, the build each pod runs
+func init() {
+	build := currentBuild()
+	promauto.With(metricsRegistry).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "backend_build_info",
+		Help: "Always 1, labelled with the version, commit, and Go version of the running build.",
+	}, []string{"version", "commit", "go_version"}).WithLabelValues(build.Version, build.Commit, build.GoVersion).Set(1)
+}
@@ -0,0 +1,506 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+)
+
+// Outbound webhooks tell other services about changes as they happen. A change becomes one
+// webhook_deliveries row per enabled subscription that wants its event type, written by the
+// replica that made the change together with a webhook.deliver job (see jobs.go) for each; the
+// leader runs the jobs, retrying failed ones with exponential backoff, so deliveries survive
+// restarts and go out from one place.
+// Delivery is at least once: one in flight while leadership moves may be sent again, so
+// receivers should ignore an X-Webhook-Delivery ID they have already handled
+
+// webhookEventTypes are the events a subscription can ask for
+// Flag events cover every flag change made on this deployment (REST, GraphQL, seeding, restores);
+// user events cover the REST API; zone events are a zone leaving or returning to "healthy"
+var webhookEventTypes = []string{
+	"flag.created", "flag.updated", "flag.deleted",
+	"user.created", "user.deleted",
+	"zone.incident", "zone.recovered",
+}
+
+// Headers sent with every delivery
+const (
+	webhookEventHeader     = "X-Webhook-Event"
+	webhookDeliveryHeader  = "X-Webhook-Delivery"
+	webhookSignatureHeader = "X-Webhook-Signature-256" // "sha256=<hex HMAC of the body>", like GitHub's
+)
+
+const (
+	// maxRetryWait caps the doubling wait between attempts (see retryWait)
+	maxRetryWait = time.Hour
+
+	// webhookJobKind is the job (see jobs.go) that sends one delivery
+	webhookJobKind = "webhook.deliver"
+
+	// webhookConcurrency bounds how many deliveries are sent at once, so a slow target
+	// doesn't hold up every other subscription
+	webhookConcurrency = 4
+)
+
+// webhookAttempts counts delivery attempts by result: "delivered", "retry" (failed, will be
+// retried), or "failed" (out of attempts)
+var webhookAttempts = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+	Name: "webhook_delivery_attempts_total",
+	Help: "Outbound webhook delivery attempts, by result (delivered, retry, or failed).",
+}, []string{"result"})
+
+// webhookDispatcher turns flag, user, and zone changes into deliveries and sends them
+// Its methods do nothing on a nil dispatcher, which is what mock mode has
+type webhookDispatcher struct {
+	db     *gorm.DB
+	client *http.Client
+	cfg    WebhookConfig
+
+	// REQUEST_TIMEOUT, for queueing deliveries outside any request
+	timeout time.Duration
+
+	// Zone transitions are seen by every replica that checks the zones, so only the
+	// leader records them; nil (as in tests) records them here
+	leader *leaderElector
+
+	jobs *jobQueue // Sends the deliveries
+
+	logLevel *logLevel // The server's, for debug lines about deliveries
+}
+
+// webhookZoneChange is the data of zone.incident and zone.recovered events
+type webhookZoneChange struct {
+	Zone           models.ZoneStatus `json:"zone"`
+	PreviousStatus string            `json:"previousStatus"`
+}
+
+// newWebhookDispatcher creates a dispatcher that stores deliveries in database and registers
+// the job that sends them with jobs
+func newWebhookDispatcher(database *gorm.DB, jobs *jobQueue, cfg Config) *webhookDispatcher {
+	d := &webhookDispatcher{
+		db:      database,
+		cfg:     cfg.Webhooks,
+		timeout: cfg.Server.RequestTimeout,
+		client: &http.Client{
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+			// A redirected POST would arrive as a GET, so a redirect counts as a failed attempt
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		jobs: jobs,
+	}
+	jobs.register(webhookJobKind, jobWorker{
+		run:         d.deliver,
+		maxAttempts: cfg.Webhooks.MaxAttempts,
+		backoff:     cfg.Webhooks.RetryBackoff,
+		concurrency: webhookConcurrency,
+	})
+	return d
+}
+
+// flagChanged queues flag.<action> for a flag created, updated, or deleted on this replica
+func (d *webhookDispatcher) flagChanged(key, action string) {
+	if d == nil {
+		return
+	}
+	d.enqueue("flag."+action, func(ctx context.Context) (interface{}, error) {
+		if action == "deleted" {
+			return map[string]string{"key": key}, nil
+		}
+		var flag models.FeatureFlag
+		// Replicas may not have the change yet
+		err := d.db.WithContext(ctx).Clauses(dbresolver.Write).Where(clause.Eq{Column: "key", Value: key}).First(&flag).Error
+		return flag, err
+	})
+}
+
+// userCreated queues user.created
+func (d *webhookDispatcher) userCreated(user models.User) {
+	if d == nil {
+		return
+	}
+	d.enqueue("user.created", func(context.Context) (interface{}, error) { return user, nil })
+}
+
+// userDeleted queues user.deleted
+func (d *webhookDispatcher) userDeleted(id uint) {
+	if d == nil {
+		return
+	}
+	d.enqueue("user.deleted", func(context.Context) (interface{}, error) { return map[string]uint{"id": id}, nil })
+}
+
+// zoneChanged queues zone.incident when a zone stops being healthy and zone.recovered when it is
+// healthy again; changes between unhealthy and degraded are not events
+func (d *webhookDispatcher) zoneChanged(previous string, status models.ZoneStatus) {
+	if d == nil || !d.leader.isLeading() {
+		return
+	}
+	event := zoneTransitionEvent(previous, status.Status)
+	if event == "" {
+		return
+	}
+	d.enqueue(event, func(context.Context) (interface{}, error) {
+		return webhookZoneChange{Zone: status, PreviousStatus: previous}, nil
+	})
+}
+
+// zoneTransitionEvent is zone.incident for a zone that was healthy and zone.recovered for one
+// that is healthy again, or "" for a change between unhealthy and degraded
+// Maintenance is planned: going into it isn't an incident and coming out of it healthy isn't a
+// recovery, but coming out of it unhealthy is an incident
+func zoneTransitionEvent(previous, current string) string {
+	switch {
+	case current == "maintenance", previous == "maintenance" && current == "healthy":
+		return ""
+	case previous == "healthy", previous == "maintenance":
+		return "zone.incident"
+	case current == "healthy":
+		return "zone.recovered"
+	default:
+		return ""
+	}
+}
+
+// enqueue stores a delivery of event for every subscription that wants it
+// load builds the event's data; it only runs when there is a subscriber
+// The change has already happened, so a cancelled request must not drop its event:
+// enqueue gets a deadline of its own
+func (d *webhookDispatcher) enqueue(event string, load func(ctx context.Context) (interface{}, error)) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+
+	subscriptions, err := d.subscribers(ctx, event)
+	if err != nil {
+		log.Printf("Failed to find webhook subscriptions for %s: %v", event, err)
+		return
+	}
+	if len(subscriptions) == 0 {
+		return
+	}
+
+	data, err := load(ctx)
+	if err != nil {
+		log.Printf("Failed to load the data of webhook event %s: %v", event, err)
+		return
+	}
+	eventID := randomToken()
+	payload, err := json.Marshal(models.WebhookEvent{ID: eventID, Type: event, CreatedAt: time.Now().UTC(), Data: data})
+	if err != nil {
+		log.Printf("Failed to encode webhook event %s: %v", event, err)
+		return
+	}
+
+	now := time.Now()
+	deliveries := make([]models.WebhookDelivery, len(subscriptions))
+	for i, subscription := range subscriptions {
+		deliveries[i] = models.WebhookDelivery{
+			SubscriptionID: subscription.ID,
+			Event:          event,
+			EventID:        eventID,
+			Payload:        string(payload),
+			Status:         "pending",
+			NextAttemptAt:  &now,
+		}
+	}
+	err = d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&deliveries).Error; err != nil {
+			return err
+		}
+		jobs := make([]interface{}, len(deliveries))
+		for i, delivery := range deliveries {
+			jobs[i] = webhookDeliverJob{DeliveryID: delivery.ID}
+		}
+		return d.jobs.enqueue(tx, webhookJobKind, jobs...)
+	})
+	if err != nil {
+		log.Printf("Failed to queue webhook event %s: %v", event, err)
+		return
+	}
+	d.logLevel.debugf("queued webhook event %s for %d subscriptions", event, len(deliveries))
+	d.jobs.notify(webhookJobKind)
+}
+
+// subscribers returns the enabled subscriptions to event
+// Events are a JSON list in a text column, so they are matched here rather than in SQL
+func (d *webhookDispatcher) subscribers(ctx context.Context, event string) ([]models.WebhookSubscription, error) {
+	var subscriptions []models.WebhookSubscription
+	if err := d.db.WithContext(ctx).Where("enabled = ?", true).Find(&subscriptions).Error; err != nil {
+		return nil, err
+	}
+	matching := subscriptions[:0]
+	for _, subscription := range subscriptions {
+		if slices.Contains(subscription.Events, event) || slices.Contains(subscription.Events, "*") {
+			matching = append(matching, subscription)
+		}
+	}
+	return matching, nil
+}
+
+// webhookDeliverJob is the payload of a webhook.deliver job
+type webhookDeliverJob struct {
+	DeliveryID uint `json:"deliveryId"`
+}
+
+// deliver sends a delivery once and records the outcome; the webhook.deliver job worker
+func (d *webhookDispatcher) deliver(ctx context.Context, job models.Job) error {
+	var payload webhookDeliverJob
+	if err := decodeJobPayload(job, &payload); err != nil {
+		return err
+	}
+	var delivery models.WebhookDelivery
+	err := d.db.WithContext(ctx).Clauses(dbresolver.Write).First(&delivery, payload.DeliveryID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || delivery.Status == "delivered" {
+		return nil // Deleted with its subscription, or already sent by an earlier run
+	}
+	if err != nil {
+		return err
+	}
+	var subscription models.WebhookSubscription
+	if err := d.db.WithContext(ctx).Clauses(dbresolver.Write).First(&subscription, delivery.SubscriptionID).Error; err != nil {
+		return err
+	}
+	if !subscription.Enabled {
+		err := errors.New("subscription disabled")
+		d.record(delivery, 0, err, true)
+		return permanent(err)
+	}
+
+	status, err := d.send(ctx, subscription, delivery)
+	if err != nil && ctx.Err() != nil {
+		return err // Leadership ended mid-send; the next leader sends it again
+	}
+	delivery.Attempts++
+	d.record(delivery, status, err, job.Attempts >= job.MaxAttempts)
+	return err
+}
+
+// record stores the outcome of an attempt: delivered, failed for good (final, e.g. out of
+// attempts), or pending until a retry after the backoff
+func (d *webhookDispatcher) record(delivery models.WebhookDelivery, status int, err error, final bool) {
+	now := time.Now()
+	updates := map[string]interface{}{"attempts": delivery.Attempts, "response_status": status, "error": ""}
+	switch {
+	case err == nil:
+		updates["status"], updates["delivered_at"], updates["next_attempt_at"] = "delivered", now, nil
+		webhookAttempts.WithLabelValues("delivered").Inc()
+	case final:
+		updates["status"], updates["error"], updates["next_attempt_at"] = "failed", err.Error(), nil
+		webhookAttempts.WithLabelValues("failed").Inc()
+		log.Printf("Webhook delivery %d (%s) to subscription %d failed after %d attempts: %v",
+			delivery.ID, delivery.Event, delivery.SubscriptionID, delivery.Attempts, err)
+	default:
+		updates["error"], updates["next_attempt_at"] = err.Error(), now.Add(retryWait(d.cfg.RetryBackoff, delivery.Attempts))
+		webhookAttempts.WithLabelValues("retry").Inc()
+		d.logLevel.debugf("webhook delivery %d attempt %d failed: %v", delivery.ID, delivery.Attempts, err)
+	}
+
+	// Not tied to the leader's context: an attempt that was made is recorded even if leadership just ended
+	if err := d.db.Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(updates).Error; err != nil {
+		log.Printf("Failed to record webhook delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// send POSTs the delivery's payload to the subscription's URL and returns the response status
+// Any 2xx response is a success; the body is ignored
+func (d *webhookDispatcher) send(ctx context.Context, subscription models.WebhookSubscription, delivery models.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "backend-webhooks/"+currentBuild().Version)
+	req.Header.Set(webhookEventHeader, delivery.Event)
+	req.Header.Set(webhookDeliveryHeader, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(webhookSignatureHeader, signWebhookPayload(subscription.Secret, []byte(delivery.Payload)))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Reading the body lets the connection be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("target responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// retryWait is the wait after the given number of failed attempts: backoff
+// (WEBHOOK_RETRY_BACKOFF, EMAIL_RETRY_BACKOFF), doubled after each attempt, at most an hour
+func retryWait(backoff time.Duration, attempts int) time.Duration {
+	wait := backoff
+	for i := 1; i < attempts && wait < maxRetryWait; i++ {
+		wait *= 2
+	}
+	return min(wait, maxRetryWait)
+}
+
+// signWebhookPayload returns the X-Webhook-Signature-256 header for body
+func signWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// prune deletes delivered and failed deliveries older than WEBHOOK_RETENTION_DAYS and returns
+// how many there were (on a dry run, would be); the cleanup-webhooks schedule (see schedules.go)
+func (d *webhookDispatcher) prune(ctx context.Context, dryRun bool) (int64, error) {
+	if d.cfg.RetentionDays <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().AddDate(0, 0, -d.cfg.RetentionDays)
+	return purge(d.db.WithContext(ctx).Where("status <> ? AND created_at < ?", "pending", cutoff), &models.WebhookDelivery{}, dryRun)
+}
+
+// watchZones checks the zones every ZONE_STATUS_MAX_AGE, so the leader notices incidents
+// even when nobody is asking for zone status; a leader task
+func (s *Server) watchZones(ctx context.Context) {
+	runEvery(ctx, s.config.Zones.StatusMaxAge, func(context.Context) { s.zoneStatuses.get() })
+}
+
+// webhookDeliveryFilterFields are the delivery log fields ?filter= and ?orderby= accept
+var webhookDeliveryFilterFields = filterFields{
+	"id":             {Column: "id", Kind: filterNumber},
+	"event":          {Column: "event", Kind: filterString},
+	"eventId":        {Column: "event_id", Kind: filterString},
+	"status":         {Column: "status", Kind: filterString},
+	"attempts":       {Column: "attempts", Kind: filterNumber},
+	"responseStatus": {Column: "response_status", Kind: filterNumber},
+	"createdAt":      {Column: "created_at", Kind: filterTime},
+}
+
+// listWebhookSubscriptionsHandler responds to GET /api/webhook-subscriptions
+func (s *Server) listWebhookSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	var subscriptions []models.WebhookSubscription
+	if err := s.db.WithContext(r.Context()).Order("id").Find(&subscriptions).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, subscriptions)
+}
+
+// createWebhookSubscriptionHandler responds to POST /api/webhook-subscriptions
+// The response is the only place the secret appears, so a generated one must be saved then
+func (s *Server) createWebhookSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateWebhookSubscriptionRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	subscription := models.WebhookSubscription{URL: req.URL, Events: req.Events, Secret: req.Secret, Enabled: true}
+	if subscription.Secret == "" {
+		subscription.Secret = randomToken() + randomToken()
+	}
+	if err := s.db.WithContext(r.Context()).Create(&subscription).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to create webhook subscription: %v", err))
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s/api/webhook-subscriptions/%d", s.config.Server.BasePath, subscription.ID))
+	writeJSON(w, r, http.StatusCreated, models.WebhookSubscriptionCreated{WebhookSubscription: subscription, Secret: subscription.Secret})
+}
+
+// getWebhookSubscriptionHandler responds to GET /api/webhook-subscriptions/{id}
+func (s *Server) getWebhookSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	if subscription, ok := findByID[models.WebhookSubscription](w, r, s.db, "Webhook subscription"); ok {
+		writeJSON(w, r, http.StatusOK, subscription)
+	}
+}
+
+// updateWebhookSubscriptionHandler responds to PATCH /api/webhook-subscriptions/{id}
+// Disabling a subscription also fails its pending deliveries (see deliver)
+func (s *Server) updateWebhookSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateWebhookSubscriptionRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	subscription, ok := findByID[models.WebhookSubscription](w, r, s.db, "Webhook subscription")
+	if !ok {
+		return
+	}
+
+	if req.URL != nil {
+		subscription.URL = *req.URL
+	}
+	if req.Events != nil {
+		subscription.Events = req.Events
+	}
+	if req.Enabled != nil {
+		subscription.Enabled = *req.Enabled
+	}
+	if err := s.db.WithContext(r.Context()).Save(&subscription).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Failed to update webhook subscription: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, subscription)
+}
+
+// deleteWebhookSubscriptionHandler responds to DELETE /api/webhook-subscriptions/{id}
+// Its deliveries, pending or not, are deleted with it
+func (s *Server) deleteWebhookSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	subscription, ok := findByID[models.WebhookSubscription](w, r, s.db, "Webhook subscription")
+	if !ok {
+		return
+	}
+	err := s.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("subscription_id = ?", subscription.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&subscription).Error
+	})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, models.MessageResponse{Message: "Webhook subscription deleted successfully"})
+}
+
+// getWebhookDeliveriesHandler responds to GET /api/webhook-subscriptions/{id}/deliveries
+// The subscription's delivery log, newest first (the latest 100 unless a page size is asked
+// for), narrowed with the shared ?filter= and ?orderby= parameters, e.g. ?filter=status eq "failed"
+func (s *Server) getWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	listQuery, err := parseListQuery(r, webhookDeliveryFilterFields)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid query: "+err.Error())
+		return
+	}
+	subscription, ok := findByID[models.WebhookSubscription](w, r, s.db, "Webhook subscription")
+	if !ok {
+		return
+	}
+	if r.URL.Query().Get("pageSize") == "" {
+		listQuery.page.PageSize = min(listQuery.page.PageSize, 100)
+	}
+
+	var deliveries []models.WebhookDelivery
+	query := s.db.WithContext(r.Context()).Model(&models.WebhookDelivery{}).Where("subscription_id = ?", subscription.ID)
+	if err := listQuery.apply(query, "id DESC").Find(&deliveries).Error; err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+		return
+	}
+	setNextPageLink(w, r, listQuery.page, len(deliveries))
+	writeJSON(w, r, http.StatusOK, deliveries)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// zoneProxyTransport sends proxied requests as client spans and injects our
+// traceparent/tracestate, replacing whatever trace headers the client sent
+var zoneProxyTransport = otelhttp.NewTransport(http.DefaultTransport)
+
+// zoneProxyTokenHeader carries ZONE_PROXY_TOKEN to the zone
+const zoneProxyTokenHeader = "X-Backend-Proxy-Token"
+
+// internalHeaderPrefix marks headers that are only meant for pod-to-pod traffic
+// They are stripped from client requests (so they can't be spoofed) and from zone responses
+const internalHeaderPrefix = "X-Internal-"
+
+// zoneProxyHandler responds to /api/zones/{name}/proxy/{path...}
+// It forwards the request to the named zone with trace and auth headers injected
+func (s *Server) zoneProxyHandler(w http.ResponseWriter, r *http.Request) {
+	zone, ok := s.findZone(r.PathValue("name"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Zone not found")
+		return
+	}
+
+	target, err := url.Parse(zone.URL)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Invalid zone URL")
+		return
+	}
+	// The mux cleans literal dot segments, but the path value is decoded, so %2F..%2F arrives
+	// as one; it would climb out of the zone's base path on the zone's host
+	path := r.PathValue("path")
+	if slices.Contains(strings.Split(path, "/"), "..") {
+		writeError(w, r, http.StatusBadRequest, "Invalid proxied path")
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Transport: zoneProxyTransport,
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			// Keep the zone's base path (e.g., "/admin") and append the proxied path
+			pr.Out.URL.Scheme = target.Scheme
+			pr.Out.URL.Host = target.Host
+			pr.Out.URL.Path = strings.TrimRight(target.Path, "/") + "/" + path
+			pr.Out.URL.RawPath = ""
+			pr.Out.Host = target.Host
+
+			// X-Forwarded-For/Host/Proto tell the zone who the original client was
+			pr.SetXForwarded()
+
+			stripInternalHeaders(pr.Out.Header)
+			pr.Out.Header.Del(zoneProxyTokenHeader)
+
+			// Client credentials for the backend are not meant for the zone
+			pr.Out.Header.Del("Authorization")
+			pr.Out.Header.Del("Cookie")
+
+			// Request ID so the zone's logs can be correlated with ours
+			// (W3C trace context is injected by zoneProxyTransport)
+			pr.Out.Header.Set(requestIDHeader, requestIDFrom(pr.In.Context()))
+			if s.config.Zones.ProxyToken != "" {
+				pr.Out.Header.Set(zoneProxyTokenHeader, s.config.Zones.ProxyToken)
+			}
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			stripInternalHeaders(resp.Header)
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("Zone proxy to %s failed: %v", zone.Name, err)
+			writeError(w, r, http.StatusBadGateway, "Zone is unreachable")
+		},
+	}
+
+	proxy.ServeHTTP(w, r)
+}
+
+// stripInternalHeaders removes every X-Internal-* header
+func stripInternalHeaders(header http.Header) {
+	for key := range header {
+		if strings.HasPrefix(http.CanonicalHeaderKey(key), internalHeaderPrefix) {
+			header.Del(key)
+		}
+	}
+}
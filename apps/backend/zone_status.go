@@ -0,0 +1,114 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nextjs-microfrontend/backend/internal/models"
+)
+
+// zoneStatusSnapshot holds the last result of checkAllZones (stale-while-revalidate)
+// Readers always get the snapshot straight away; when it is older than ZONE_STATUS_MAX_AGE
+// one background refresh replaces it, so a slow or hanging zone never delays a response
+type zoneStatusSnapshot struct {
+	check      func() []models.ZoneStatus // Checks every zone (Server.checkAllZones)
+	live       *liveConfig                // For ZONE_STATUS_MAX_AGE, which a reload may change
+	mu         sync.Mutex
+	statuses   []models.ZoneStatus
+	checkedAt  time.Time
+	refreshing bool
+
+	// Counters for GET /internal/cache/stats and /metrics
+	hits            atomic.Uint64 // Fresh snapshot served
+	staleServes     atomic.Uint64 // Snapshot older than ZONE_STATUS_MAX_AGE served while a refresh runs
+	misses          atomic.Uint64 // No snapshot yet; the caller waited for the checks
+	refreshes       atomic.Uint64 // Background refreshes completed
+	refreshFailures atomic.Uint64 // Refreshes where at least one zone was unhealthy or unreachable
+}
+
+// zoneStatusCacheStats is a snapshot of the zone status cache's counters
+type zoneStatusCacheStats struct {
+	Hits            uint64  `json:"hits"`
+	StaleServes     uint64  `json:"staleServes"`
+	Misses          uint64  `json:"misses"`
+	HitRatio        float64 `json:"hitRatio"` // Fresh or stale serves over all reads
+	Refreshes       uint64  `json:"refreshes"`
+	RefreshFailures uint64  `json:"refreshFailures"`
+	AgeSeconds      float64 `json:"ageSeconds"` // Age of the current snapshot
+}
+
+// newZoneStatusSnapshot creates an empty snapshot filled by check
+func newZoneStatusSnapshot(check func() []models.ZoneStatus, live *liveConfig) *zoneStatusSnapshot {
+	return &zoneStatusSnapshot{check: check, live: live}
+}
+
+// get returns the current zone statuses
+// Only the very first call waits for the health checks, since there is nothing to serve yet
+func (s *zoneStatusSnapshot) get() []models.ZoneStatus {
+	s.mu.Lock()
+	if s.statuses == nil {
+		s.mu.Unlock()
+		s.misses.Add(1)
+		// Concurrent first callers share the same checks through zoneChecks
+		return s.store(s.check())
+	}
+
+	statuses := s.statuses
+	if time.Since(s.checkedAt) > s.live.zoneStatusMaxAge() {
+		s.staleServes.Add(1)
+		if !s.refreshing {
+			s.refreshing = true
+			go s.refresh()
+		}
+	} else {
+		s.hits.Add(1)
+	}
+	s.mu.Unlock()
+	return statuses
+}
+
+// refresh checks every zone and replaces the snapshot
+func (s *zoneStatusSnapshot) refresh() {
+	statuses := s.check()
+	s.refreshes.Add(1)
+	for _, status := range statuses {
+		if status.Status != "healthy" && status.Status != "maintenance" {
+			s.refreshFailures.Add(1)
+			break
+		}
+	}
+	s.store(statuses)
+}
+
+// stats returns the cache counters and the age of the current snapshot
+func (s *zoneStatusSnapshot) stats() zoneStatusCacheStats {
+	stats := zoneStatusCacheStats{
+		Hits:            s.hits.Load(),
+		StaleServes:     s.staleServes.Load(),
+		Misses:          s.misses.Load(),
+		Refreshes:       s.refreshes.Load(),
+		RefreshFailures: s.refreshFailures.Load(),
+	}
+	if total := stats.Hits + stats.StaleServes + stats.Misses; total > 0 {
+		stats.HitRatio = float64(stats.Hits+stats.StaleServes) / float64(total)
+	}
+
+	s.mu.Lock()
+	if !s.checkedAt.IsZero() {
+		stats.AgeSeconds = time.Since(s.checkedAt).Seconds()
+	}
+	s.mu.Unlock()
+	return stats
+}
+
+// store replaces the snapshot and returns it
+// The slice is never modified after this, so readers can share it without copying
+func (s *zoneStatusSnapshot) store(statuses []models.ZoneStatus) []models.ZoneStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses = statuses
+	s.checkedAt = time.Now()
+	s.refreshing = false
+	return statuses
+}
@@ -1,17 +1,7 @@
 'use client'
 
 import { useEffect, useState } from 'react'
-
-// TypeScript interface matching the backend's FeatureFlag struct
-interface FeatureFlag {
-  id: number
-  key: string
-  name: string
-  description: string
-  enabled: boolean
-  createdAt: string
-  updatedAt: string
-}
+import type { FeatureFlag } from '../lib/api-types'
 
 export default function FeatureFlagManagement() {
   // State to store the list of feature flags from the database
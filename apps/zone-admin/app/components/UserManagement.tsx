@@ -1,15 +1,7 @@
 'use client'
 
 import { useEffect, useState } from 'react'
-
-// TypeScript interface matching the backend's User struct
-interface User {
-  id: number
-  email: string
-  name: string
-  createdAt: string
-  updatedAt: string
-}
+import type { SeedResponse, User } from '../lib/api-types'
 
 export default function UserManagement() {
   // State to store the list of users from the database
@@ -132,7 +124,7 @@ export default function UserManagement() {
         method: 'POST',
       })
 
-      const result = await response.json()
+      const result: SeedResponse = await response.json()
 
       if (!response.ok) {
         throw new Error(result.message || 'Failed to seed database')
@@ -1,21 +1,7 @@
 'use client'
 
 import { useEffect, useState } from 'react'
-
-// TypeScript interface matching the backend's ZoneStatus struct
-interface ZoneStatus {
-  name: string
-  status: string
-  url: string
-  lastCheck: string
-  message: string
-}
-
-// TypeScript interface matching the backend's HealthResponse struct
-interface HealthResponse {
-  status: string
-  zones: ZoneStatus[]
-}
+import type { HealthResponse } from '../lib/api-types'
 
 export default function ZoneHealthStatus() {
   // State to store the health data from the backend
@@ -1,17 +1,7 @@
 'use client'
 
 import { createContext, useContext, useEffect, useState, useCallback, ReactNode } from 'react'
-
-// TypeScript interface matching the backend's FeatureFlag struct
-interface FeatureFlag {
-  id: number
-  key: string
-  name: string
-  description: string
-  enabled: boolean
-  createdAt: string
-  updatedAt: string
-}
+import type { FeatureFlag } from '../lib/api-types'
 
 // Context type
 interface FeatureFlagContextType {
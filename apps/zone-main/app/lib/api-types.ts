@@ -0,0 +1,975 @@
+// Code generated by apps/backend/cmd/tsgen from the Go models. DO NOT EDIT.
+// Regenerate with: cd apps/backend && go generate ./internal/models
+
+// Mirrors models.User in the Go backend
+export interface User {
+  id: number
+  email: string
+  name: string
+  createdAt: string
+  updatedAt: string
+  avatar?: UserAvatar | null
+}
+
+// Mirrors models.FeatureFlag in the Go backend
+export interface FeatureFlag {
+  id: number
+  key: string
+  name: string
+  description: string
+  enabled: boolean
+  createdAt: string
+  updatedAt: string
+}
+
+// Mirrors models.DeploymentEvent in the Go backend
+export interface DeploymentEvent {
+  id: number
+  zone: string
+  source: string
+  deliveryId: string
+  eventType: string
+  action: string
+  environment: string
+  ref: string
+  sha: string
+  status: string
+  url: string
+  actor: string
+  healthStatus: string
+  createdAt: string
+}
+
+// Mirrors models.ZoneStatus in the Go backend
+export interface ZoneStatus {
+  name: string
+  status: string
+  url: string
+  lastCheck: string
+  message: string
+}
+
+// Mirrors models.HealthResponse in the Go backend
+export interface HealthResponse {
+  status: string
+  zones: ZoneStatus[]
+}
+
+// Mirrors models.SeedResponse in the Go backend
+export interface SeedResponse {
+  message: string
+  totalUsers: number
+  created: number
+  skipped: number
+  errors: string[]
+  errorCount: number
+}
+
+// Mirrors models.MessageResponse in the Go backend
+export interface MessageResponse {
+  message: string
+}
+
+// Mirrors models.CreateUserRequest in the Go backend
+export interface CreateUserRequest {
+  email: string
+  name: string
+}
+
+// Mirrors models.BulkCreateUsersRequest in the Go backend
+export interface BulkCreateUsersRequest {
+  users: CreateUserRequest[]
+}
+
+// Mirrors models.CreateFeatureFlagRequest in the Go backend
+export interface CreateFeatureFlagRequest {
+  key: string
+  name: string
+  description: string
+  enabled: boolean
+}
+
+// Mirrors models.BulkCreateFeatureFlagsRequest in the Go backend
+export interface BulkCreateFeatureFlagsRequest {
+  flags: CreateFeatureFlagRequest[]
+}
+
+// Mirrors models.UpdateFeatureFlagRequest in the Go backend
+export interface UpdateFeatureFlagRequest {
+  name?: string | null
+  description?: string | null
+  enabled?: boolean | null
+}
+
+// Mirrors models.FieldError in the Go backend
+export interface FieldError {
+  field: string
+  message: string
+}
+
+// Mirrors models.DashboardResponse in the Go backend
+export interface DashboardResponse {
+  users: UserStats
+  flags: FlagSummary
+  zones: ZoneStatus[]
+  generatedAt: string
+}
+
+// Mirrors models.UserStats in the Go backend
+export interface UserStats {
+  total: number
+  createdLast7d: number
+  recent: User[]
+}
+
+// Mirrors models.FlagSummary in the Go backend
+export interface FlagSummary {
+  total: number
+  enabled: number
+  disabled: number
+  flags: FeatureFlag[]
+}
+
+// Mirrors models.ChangeEvent in the Go backend
+export interface ChangeEvent {
+  seq: number
+  type: string
+  key: string
+  action: string
+  at: string
+}
+
+// Mirrors models.ChangesResponse in the Go backend
+export interface ChangesResponse {
+  changes: ChangeEvent[]
+  cursor: string
+  reset: boolean
+}
+
+// Mirrors models.FlagBootstrap in the Go backend
+export interface FlagBootstrap {
+  flags: Record<string, boolean>
+  generatedAt: string
+}
+
+// Mirrors models.APIUsage in the Go backend
+export interface APIUsage {
+  id: number
+  day: string
+  route: string
+  consumer: string
+  requests: number
+  clientErrors: number
+  serverErrors: number
+  slowRequests: number
+}
+
+// Mirrors models.APIUsageTotal in the Go backend
+export interface APIUsageTotal {
+  route: string
+  consumer: string
+  requests: number
+  clientErrors: number
+  serverErrors: number
+}
+
+// Mirrors models.APIUsageReport in the Go backend
+export interface APIUsageReport {
+  from: string
+  to: string
+  usage: APIUsageTotal[]
+}
+
+// Mirrors models.SLOReport in the Go backend
+export interface SLOReport {
+  service: string
+  windowDays: number
+  source: string
+  generatedAt: string
+  objectives: SLOObjective[]
+}
+
+// Mirrors models.SLOObjective in the Go backend
+export interface SLOObjective {
+  name: string
+  description: string
+  target: number
+  threshold?: string
+  window: SLOWindow
+  burnRates: Record<string, number>
+}
+
+// Mirrors models.SLOWindow in the Go backend
+export interface SLOWindow {
+  total: number
+  good: number
+  sli: number
+  errorBudgetRemaining: number
+}
+
+// Mirrors models.Announcement in the Go backend
+export interface Announcement {
+  id: number
+  message: string
+  severity: string
+  zones: string[]
+  startsAt?: string | null
+  endsAt?: string | null
+  dismissible: boolean
+  locale?: string
+  createdAt: string
+  updatedAt: string
+}
+
+// Mirrors models.CreateAnnouncementRequest in the Go backend
+export interface CreateAnnouncementRequest {
+  message: string
+  severity: string
+  zones: string[]
+  startsAt: string | null
+  endsAt: string | null
+  dismissible: boolean
+}
+
+// Mirrors models.UpdateAnnouncementRequest in the Go backend
+export interface UpdateAnnouncementRequest {
+  message?: string | null
+  severity?: string | null
+  zones?: string[]
+  startsAt?: string | null
+  endsAt?: string | null
+  dismissible?: boolean | null
+}
+
+// Mirrors models.MaintenanceMode in the Go backend
+export interface MaintenanceMode {
+  zone: string
+  message: string
+  allowedIps: string[]
+  endsAt?: string | null
+  createdAt: string
+  updatedAt: string
+}
+
+// Mirrors models.SetMaintenanceRequest in the Go backend
+export interface SetMaintenanceRequest {
+  message: string
+  allowedIps: string[]
+  endsAt: string | null
+}
+
+// Mirrors models.MaintenanceStatus in the Go backend
+export interface MaintenanceStatus {
+  zone: string
+  maintenance: boolean
+  show: boolean
+  global: boolean
+  message?: string
+  endsAt?: string | null
+}
+
+// Mirrors models.Settings in the Go backend
+export interface Settings {
+  siteTitle: string
+  supportEmail: string
+  defaultLocale: string
+  dashboardRefreshSeconds: number
+}
+
+// Mirrors models.UpdateSettingsRequest in the Go backend
+export interface UpdateSettingsRequest {
+  siteTitle?: string | null
+  supportEmail?: string | null
+  defaultLocale?: string | null
+  dashboardRefreshSeconds?: number | null
+}
+
+// Mirrors models.Redirect in the Go backend
+export interface Redirect {
+  id: number
+  slug: string
+  targetUrl: string
+  expiresAt?: string | null
+  hits: number
+  lastHitAt?: string | null
+  createdAt: string
+  updatedAt: string
+}
+
+// Mirrors models.CreateRedirectRequest in the Go backend
+export interface CreateRedirectRequest {
+  slug: string
+  targetUrl: string
+  expiresAt: string | null
+}
+
+// Mirrors models.UpdateRedirectRequest in the Go backend
+export interface UpdateRedirectRequest {
+  targetUrl?: string | null
+  expiresAt?: string | null
+}
+
+// Mirrors models.NewsletterSubscription in the Go backend
+export interface NewsletterSubscription {
+  id: number
+  email: string
+  status: string
+  zone?: string
+  confirmedAt?: string | null
+  unsubscribedAt?: string | null
+  createdAt: string
+  updatedAt: string
+}
+
+// Mirrors models.SubscribeRequest in the Go backend
+export interface SubscribeRequest {
+  email: string
+  zone: string
+}
+
+// Mirrors models.NewsletterTokenRequest in the Go backend
+export interface NewsletterTokenRequest {
+  token: string
+}
+
+// Mirrors models.SurveyOption in the Go backend
+export interface SurveyOption {
+  key: string
+  label: string
+}
+
+// Mirrors models.SurveyQuestion in the Go backend
+export interface SurveyQuestion {
+  key: string
+  type: string
+  prompt: string
+  options?: SurveyOption[]
+  required: boolean
+}
+
+// Mirrors models.Survey in the Go backend
+export interface Survey {
+  id: number
+  key: string
+  title: string
+  status: string
+  questions: SurveyQuestion[]
+  zones: string[]
+  segments: string[]
+  flag?: string
+  sample: number
+  startedAt?: string | null
+  closedAt?: string | null
+  createdAt: string
+  updatedAt: string
+}
+
+// Mirrors models.CreateSurveyRequest in the Go backend
+export interface CreateSurveyRequest {
+  key: string
+  title: string
+  questions: SurveyQuestion[]
+  zones: string[]
+  segments: string[]
+  flag: string
+  sample: number
+}
+
+// Mirrors models.UpdateSurveyRequest in the Go backend
+export interface UpdateSurveyRequest {
+  title?: string | null
+  status?: string | null
+  questions?: SurveyQuestion[]
+  zones?: string[]
+  segments?: string[]
+  flag?: string | null
+  sample?: number | null
+}
+
+// Mirrors models.SurveyAnswer in the Go backend
+export interface SurveyAnswer {
+  question: string
+  score?: number | null
+  options?: string[]
+  text?: string
+}
+
+// Mirrors models.SurveyResponse in the Go backend
+export interface SurveyResponse {
+  id: number
+  surveyId: number
+  unit: string
+  zone?: string
+  answers: SurveyAnswer[]
+  createdAt: string
+}
+
+// Mirrors models.SubmitSurveyResponseRequest in the Go backend
+export interface SubmitSurveyResponseRequest {
+  unit: string
+  zone: string
+  answers: SurveyAnswer[]
+}
+
+// Mirrors models.SurveyResults in the Go backend
+export interface SurveyResults {
+  survey: string
+  status: string
+  responses: number
+  questions: SurveyQuestionResult[]
+}
+
+// Mirrors models.SurveyQuestionResult in the Go backend
+export interface SurveyQuestionResult {
+  question: string
+  type: string
+  answered: number
+  counts?: Record<string, number>
+  average?: number | null
+  nps?: number | null
+}
+
+// Mirrors models.ReleaseNote in the Go backend
+export interface ReleaseNote {
+  id: number
+  version: string
+  zone?: string
+  body: string
+  flag?: string
+  publishedAt?: string | null
+  createdAt: string
+  updatedAt: string
+}
+
+// Mirrors models.CreateReleaseNoteRequest in the Go backend
+export interface CreateReleaseNoteRequest {
+  version: string
+  zone: string
+  body: string
+  flag: string
+  publishedAt: string | null
+}
+
+// Mirrors models.UpdateReleaseNoteRequest in the Go backend
+export interface UpdateReleaseNoteRequest {
+  version?: string | null
+  zone?: string | null
+  body?: string | null
+  flag?: string | null
+  publishedAt?: string | null
+}
+
+// Mirrors models.NavigationItem in the Go backend
+export interface NavigationItem {
+  id: number
+  key: string
+  label: string
+  href: string
+  zone?: string
+  position: number
+  flag?: string
+  roles: string[]
+  createdAt: string
+  updatedAt: string
+}
+
+// Mirrors models.CreateNavigationItemRequest in the Go backend
+export interface CreateNavigationItemRequest {
+  key: string
+  label: string
+  href: string
+  zone: string
+  position: number | null
+  flag: string
+  roles: string[]
+}
+
+// Mirrors models.UpdateNavigationItemRequest in the Go backend
+export interface UpdateNavigationItemRequest {
+  label?: string | null
+  href?: string | null
+  zone?: string | null
+  position?: number | null
+  flag?: string | null
+  roles?: string[]
+}
+
+// Mirrors models.NavigationOrderRequest in the Go backend
+export interface NavigationOrderRequest {
+  keys: string[]
+}
+
+// Mirrors models.ZoneRoute in the Go backend
+export interface ZoneRoute {
+  id: number
+  path: string
+  zone: string
+  description?: string
+  createdAt: string
+  updatedAt: string
+}
+
+// Mirrors models.ZoneRouteChange in the Go backend
+export interface ZoneRouteChange {
+  id: number
+  routeId: number
+  action: string
+  path: string
+  zone?: string
+  previousZone?: string
+  changedBy: string
+  createdAt: string
+}
+
+// Mirrors models.RoutingManifest in the Go backend
+export interface RoutingManifest {
+  version: number
+  routes: RoutingManifestRoute[]
+}
+
+// Mirrors models.RoutingManifestRoute in the Go backend
+export interface RoutingManifestRoute {
+  source: string
+  destination: string
+  zone: string
+}
+
+// Mirrors models.CreateZoneRouteRequest in the Go backend
+export interface CreateZoneRouteRequest {
+  path: string
+  zone: string
+  description: string
+}
+
+// Mirrors models.UpdateZoneRouteRequest in the Go backend
+export interface UpdateZoneRouteRequest {
+  path?: string | null
+  zone?: string | null
+  description?: string | null
+}
+
+// Mirrors models.ExperimentVariant in the Go backend
+export interface ExperimentVariant {
+  key: string
+  weight: number
+}
+
+// Mirrors models.Experiment in the Go backend
+export interface Experiment {
+  id: number
+  key: string
+  name: string
+  hypothesis?: string
+  status: string
+  variants: ExperimentVariant[]
+  allocation: number
+  flag?: string
+  primaryMetric: string
+  startedAt?: string | null
+  stoppedAt?: string | null
+  createdAt: string
+  updatedAt: string
+}
+
+// Mirrors models.CreateExperimentRequest in the Go backend
+export interface CreateExperimentRequest {
+  key: string
+  name: string
+  hypothesis: string
+  variants: ExperimentVariant[]
+  allocation: number
+  flag: string
+  primaryMetric: string
+}
+
+// Mirrors models.UpdateExperimentRequest in the Go backend
+export interface UpdateExperimentRequest {
+  name?: string | null
+  hypothesis?: string | null
+  status?: string | null
+  variants?: ExperimentVariant[]
+  allocation?: number | null
+  flag?: string | null
+  primaryMetric?: string | null
+}
+
+// Mirrors models.AssignExperimentRequest in the Go backend
+export interface AssignExperimentRequest {
+  unit: string
+}
+
+// Mirrors models.AssignmentResponse in the Go backend
+export interface AssignmentResponse {
+  experiment: string
+  unit: string
+  enrolled: boolean
+  variant?: string
+}
+
+// Mirrors models.ExperimentEventInput in the Go backend
+export interface ExperimentEventInput {
+  experiment: string
+  unit: string
+  type: string
+  metric: string
+}
+
+// Mirrors models.ExperimentEventsRequest in the Go backend
+export interface ExperimentEventsRequest {
+  events: ExperimentEventInput[]
+}
+
+// Mirrors models.ExperimentEventsResponse in the Go backend
+export interface ExperimentEventsResponse {
+  accepted: number
+  ignored: number
+}
+
+// Mirrors models.ExperimentResults in the Go backend
+export interface ExperimentResults {
+  experiment: string
+  status: string
+  primaryMetric: string
+  variants: ExperimentVariantResult[]
+}
+
+// Mirrors models.ExperimentVariantResult in the Go backend
+export interface ExperimentVariantResult {
+  variant: string
+  assigned: number
+  exposed: number
+  converted: number
+  conversionRate: number
+  uplift?: number | null
+  pValue?: number | null
+  metrics: Record<string, number>
+}
+
+// Mirrors models.AnalyticsEvent in the Go backend
+export interface AnalyticsEvent {
+  type: string
+  name: string
+  zone: string
+  path: string
+  visitor: string
+}
+
+// Mirrors models.AnalyticsEventsRequest in the Go backend
+export interface AnalyticsEventsRequest {
+  events: AnalyticsEvent[]
+}
+
+// Mirrors models.AnalyticsEventsResponse in the Go backend
+export interface AnalyticsEventsResponse {
+  accepted: number
+  sampled: number
+  sampleRate: number
+}
+
+// Mirrors models.AnalyticsReport in the Go backend
+export interface AnalyticsReport {
+  from: string
+  to: string
+  zone?: string
+  totals: AnalyticsTotals
+  days: AnalyticsDay[]
+  topPages: AnalyticsPage[]
+  topEvents: AnalyticsEventTotal[]
+}
+
+// Mirrors models.AnalyticsTotals in the Go backend
+export interface AnalyticsTotals {
+  pageViews: number
+  events: number
+}
+
+// Mirrors models.AnalyticsDay in the Go backend
+export interface AnalyticsDay {
+  day: string
+  pageViews: number
+  events: number
+  visitors: number
+}
+
+// Mirrors models.AnalyticsPage in the Go backend
+export interface AnalyticsPage {
+  path: string
+  views: number
+}
+
+// Mirrors models.AnalyticsEventTotal in the Go backend
+export interface AnalyticsEventTotal {
+  name: string
+  count: number
+}
+
+// Mirrors models.HeartbeatRequest in the Go backend
+export interface HeartbeatRequest {
+  session: string
+}
+
+// Mirrors models.ActiveUsers in the Go backend
+export interface ActiveUsers {
+  zone: string
+  activeUsers: number
+  windowSeconds: number
+  at: string
+}
+
+// Mirrors models.Organization in the Go backend
+export interface Organization {
+  id: number
+  slug: string
+  name: string
+  createdAt: string
+  updatedAt: string
+}
+
+// Mirrors models.Project in the Go backend
+export interface Project {
+  id: number
+  organizationId: number
+  slug: string
+  name: string
+  zones: string[]
+  createdAt: string
+  updatedAt: string
+}
+
+// Mirrors models.ProjectAPIKey in the Go backend
+export interface ProjectAPIKey {
+  id: number
+  projectId: number
+  name: string
+  prefix: string
+  createdAt: string
+}
+
+// Mirrors models.ProjectAPIKeyCreated in the Go backend
+export interface ProjectAPIKeyCreated {
+  id: number
+  projectId: number
+  name: string
+  prefix: string
+  createdAt: string
+  key: string
+}
+
+// Mirrors models.CreateOrganizationRequest in the Go backend
+export interface CreateOrganizationRequest {
+  slug: string
+  name: string
+}
+
+// Mirrors models.UpdateOrganizationRequest in the Go backend
+export interface UpdateOrganizationRequest {
+  name?: string | null
+}
+
+// Mirrors models.CreateProjectRequest in the Go backend
+export interface CreateProjectRequest {
+  slug: string
+  name: string
+  zones: string[]
+}
+
+// Mirrors models.UpdateProjectRequest in the Go backend
+export interface UpdateProjectRequest {
+  name?: string | null
+  zones?: string[]
+}
+
+// Mirrors models.CreateProjectAPIKeyRequest in the Go backend
+export interface CreateProjectAPIKeyRequest {
+  name: string
+}
+
+// Mirrors models.ContactSubmission in the Go backend
+export interface ContactSubmission {
+  id: number
+  name: string
+  email: string
+  subject?: string
+  message: string
+  zone?: string
+  status: string
+  spamReason?: string
+  note?: string
+  createdAt: string
+  updatedAt: string
+}
+
+// Mirrors models.ContactRequest in the Go backend
+export interface ContactRequest {
+  name: string
+  email: string
+  subject: string
+  message: string
+  zone: string
+  website: string
+  captchaToken: string
+}
+
+// Mirrors models.UpdateContactSubmissionRequest in the Go backend
+export interface UpdateContactSubmissionRequest {
+  status?: string | null
+  note?: string | null
+}
+
+// Mirrors models.Feedback in the Go backend
+export interface Feedback {
+  id: number
+  rating: number
+  message?: string
+  page?: string
+  zone: string
+  userId?: string
+  status: string
+  note?: string
+  createdAt: string
+  updatedAt: string
+}
+
+// Mirrors models.CreateFeedbackRequest in the Go backend
+export interface CreateFeedbackRequest {
+  rating: number
+  message: string
+  page: string
+  zone: string
+  userId: string
+}
+
+// Mirrors models.UpdateFeedbackRequest in the Go backend
+export interface UpdateFeedbackRequest {
+  status?: string | null
+  note?: string | null
+}
+
+// Mirrors models.Upload in the Go backend
+export interface Upload {
+  id: number
+  key: string
+  filename: string
+  contentType: string
+  size: number
+  zone?: string
+  status: string
+  rejectReason?: string
+  expiresAt: string
+  completedAt?: string | null
+  createdAt: string
+  updatedAt: string
+}
+
+// Mirrors models.UploadCreated in the Go backend
+export interface UploadCreated {
+  id: number
+  key: string
+  filename: string
+  contentType: string
+  size: number
+  zone?: string
+  status: string
+  rejectReason?: string
+  expiresAt: string
+  completedAt?: string | null
+  createdAt: string
+  updatedAt: string
+  uploadUrl: string
+  headers: Record<string, string>
+}
+
+// Mirrors models.CreateUploadRequest in the Go backend
+export interface CreateUploadRequest {
+  filename: string
+  contentType: string
+  size: number
+  zone: string
+}
+
+// Mirrors models.UserAvatar in the Go backend
+export interface UserAvatar {
+  uploadId: number
+  status: string
+  url: string
+  variants?: Record<string, string>
+}
+
+// Mirrors models.SetAvatarRequest in the Go backend
+export interface SetAvatarRequest {
+  uploadId: number
+}
+
+// Mirrors models.SearchResult in the Go backend
+export interface SearchResult {
+  type: string
+  id: string
+  title: string
+  snippet?: string
+  url: string
+  rank: number
+}
+
+// Mirrors models.SearchResponse in the Go backend
+export interface SearchResponse {
+  query: string
+  results: SearchResult[]
+  facets: Record<string, number>
+}
+
+// Mirrors models.ActivityEvent in the Go backend
+export interface ActivityEvent {
+  id: number
+  type: string
+  action: string
+  subject: string
+  zone?: string
+  summary: string
+  createdAt: string
+}
+
+// Mirrors models.RetentionPolicy in the Go backend
+export interface RetentionPolicy {
+  target: string
+  schedule: string
+  tables: string[]
+  retentionDays: number
+  cutoff?: string | null
+  due: number
+}
+
+// Mirrors models.Bundle in the Go backend
+export interface Bundle {
+  version: number
+  exportedAt: string
+  featureFlags: CreateFeatureFlagRequest[]
+  announcements: CreateAnnouncementRequest[]
+  navigation: CreateNavigationItemRequest[]
+  zoneRoutes: CreateZoneRouteRequest[]
+}
+
+// Mirrors models.BundleChange in the Go backend
+export interface BundleChange {
+  resource: string
+  key: string
+  action: string
+  fields?: string[]
+}
+
+// Mirrors models.BundleImportResponse in the Go backend
+export interface BundleImportResponse {
+  dryRun: boolean
+  unchanged: number
+  changes: BundleChange[]
+}
+
+// Mirrors models.FlagTranslation in the Go backend
+export interface FlagTranslation {
+  name: string
+  description?: string
+}
+
+// Mirrors models.AnnouncementTranslation in the Go backend
+export interface AnnouncementTranslation {
+  message: string
+}
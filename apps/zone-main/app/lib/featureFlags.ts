@@ -2,20 +2,11 @@
 // This module provides functions to check feature flags from the backend API
 // with caching to improve performance
 
+import type { FeatureFlag } from './api-types'
+
 // Backend URL - defaults to localhost for local development
 const BACKEND_URL = process.env.BACKEND_URL || 'http://backend:8080'
 
-// TypeScript interface matching the backend's FeatureFlag struct
-interface FeatureFlag {
-  id: number
-  key: string
-  name: string
-  description: string
-  enabled: boolean
-  createdAt: string
-  updatedAt: string
-}
-
 /**
  * Fetch a feature flag from the backend API
  * This function uses Next.js's built-in fetch caching